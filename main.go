@@ -22,8 +22,8 @@ import (
 	"runtime"
 
 	"github.com/mikkeloscar/kube-metrics-adapter/pkg/server"
-	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/apiserver/pkg/util/logs"
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/component-base/logs"
 )
 
 func main() {
@@ -34,8 +34,9 @@ func main() {
 		runtime.GOMAXPROCS(runtime.NumCPU())
 	}
 
-	cmd := server.NewCommandStartAdapterServer(os.Stdout, os.Stderr, wait.NeverStop)
+	cmd := server.NewCommandStartAdapterServer(genericapiserver.SetupSignalHandler())
 	cmd.Flags().AddGoFlagSet(flag.CommandLine)
+	cmd.AddCommand(server.NewCommandValidate())
 	if err := cmd.Execute(); err != nil {
 		panic(err)
 	}
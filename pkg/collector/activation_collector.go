@@ -0,0 +1,74 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+)
+
+// activationMetricSuffix is appended to the name of a metric to get the
+// name of its activation metric.
+const activationMetricSuffix = "_activation"
+
+// ActivationCollector is a collector which, in addition to the values of
+// another collector, publishes an external companion metric named
+// <metric>_activation. It's 1 if any collected value is above the
+// activation threshold and 0 otherwise, which can be used to scale a target
+// up from zero replicas.
+type ActivationCollector struct {
+	collector  Collector
+	metricName string
+	labels     map[string]string
+	threshold  float64
+}
+
+// NewActivationCollector initializes a new ActivationCollector.
+func NewActivationCollector(collector Collector, config *MetricConfig) *ActivationCollector {
+	return &ActivationCollector{
+		collector:  collector,
+		metricName: config.Name + activationMetricSuffix,
+		labels:     config.Labels,
+		threshold:  config.ActivationThreshold,
+	}
+}
+
+// GetMetrics gets metrics from the underlying collector and adds the
+// activation metric. If the underlying collector doesn't return any values,
+// e.g. because the target has no pods to collect metrics from, the
+// activation metric is 0.
+func (c *ActivationCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	values, partial, err := getPartialMetrics(ctx, c.collector)
+	if err != nil {
+		return nil, err
+	}
+
+	var active int64
+	for _, value := range values {
+		if value.floatValue() > c.threshold {
+			active = 1
+			break
+		}
+	}
+
+	activation := CollectedMetric{
+		Type: autoscalingv2.ExternalMetricSourceType,
+		External: external_metrics.ExternalMetricValue{
+			MetricName:   c.metricName,
+			MetricLabels: c.labels,
+			Timestamp:    metav1.Time{Time: time.Now().UTC()},
+		},
+	}
+	if err := activation.setFloatValue(float64(active)); err != nil {
+		return nil, err
+	}
+
+	return partialMetrics(append(values, activation), partial)
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *ActivationCollector) Interval() time.Duration {
+	return c.collector.Interval()
+}
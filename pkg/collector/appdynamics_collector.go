@@ -0,0 +1,236 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+)
+
+const (
+	// AppDynamicsCollectorName is the name of the AppDynamics collector.
+	AppDynamicsCollectorName = "appdynamics"
+
+	appDynamicsDefaultDuration   = 5
+	appDynamicsDefaultValueField = "value"
+)
+
+// appDynamicsValueFields are the supported fields of AppDynamics metric
+// values.
+var appDynamicsValueFields = map[string]func(v appDynamicsMetricValue) float64{
+	"value":   func(v appDynamicsMetricValue) float64 { return v.Value },
+	"current": func(v appDynamicsMetricValue) float64 { return v.Current },
+	"min":     func(v appDynamicsMetricValue) float64 { return v.Min },
+	"max":     func(v appDynamicsMetricValue) float64 { return v.Max },
+	"sum":     func(v appDynamicsMetricValue) float64 { return v.Sum },
+	"count":   func(v appDynamicsMetricValue) float64 { return v.Count },
+}
+
+// AppDynamicsCollectorPlugin is a collector plugin for initializing
+// collectors which query the metric data of applications from the REST API
+// of an AppDynamics controller.
+type AppDynamicsCollectorPlugin struct {
+	controller string
+	tokenFile  string
+}
+
+// NewAppDynamicsCollectorPlugin initializes a new AppDynamicsCollectorPlugin.
+// The controller URL, e.g. https://example.saas.appdynamics.com, and the API
+// client token read from the token file are used for metrics which don't
+// define their own.
+func NewAppDynamicsCollectorPlugin(controller, tokenFile string) *AppDynamicsCollectorPlugin {
+	return &AppDynamicsCollectorPlugin{
+		controller: strings.TrimSuffix(controller, "/"),
+		tokenFile:  tokenFile,
+	}
+}
+
+// NewCollector initializes a new AppDynamics collector from the specified
+// HPA.
+func (p *AppDynamicsCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	if config.Type != autoscalingv2.ExternalMetricSourceType {
+		return nil, fmt.Errorf("appdynamics collector only supports external metrics")
+	}
+
+	application, ok := config.Config["application"]
+	if !ok {
+		return nil, fmt.Errorf("no appdynamics application defined")
+	}
+
+	metricPath, ok := config.Config["metric-path"]
+	if !ok {
+		return nil, fmt.Errorf("no appdynamics metric path defined")
+	}
+
+	c := &AppDynamicsCollector{
+		hpa:         hpa,
+		controller:  p.controller,
+		token:       config.Config["token"],
+		tokenFile:   p.tokenFile,
+		application: application,
+		metricPath:  metricPath,
+		duration:    appDynamicsDefaultDuration,
+		valueField:  appDynamicsDefaultValueField,
+		aggregation: seriesAggregationSum,
+		metricName:  config.Name,
+		labels:      config.Labels,
+		interval:    interval,
+		httpClient: &http.Client{
+			Timeout:   15 * time.Second,
+			Transport: &http.Transport{},
+		},
+	}
+
+	// the token of the adapter must not be sent to another controller,
+	// so the controller can only be overridden along with the token of
+	// the metric.
+	if v, ok := config.Config["controller"]; ok && strings.TrimSuffix(v, "/") != c.controller {
+		if c.token == "" {
+			return nil, fmt.Errorf("the appdynamics controller can only be overridden together with a token")
+		}
+		c.controller = strings.TrimSuffix(v, "/")
+	}
+	if c.controller == "" {
+		return nil, fmt.Errorf("no appdynamics controller defined")
+	}
+
+	if v, ok := config.Config["duration"]; ok {
+		duration, err := strconv.Atoi(v)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid appdynamics duration '%s', must be a positive number of minutes", v)
+		}
+		c.duration = duration
+	}
+
+	if v, ok := config.Config["value-field"]; ok {
+		if _, ok := appDynamicsValueFields[v]; !ok {
+			return nil, fmt.Errorf("unsupported appdynamics value field '%s'", v)
+		}
+		c.valueField = v
+	}
+
+	if v, ok := config.Config["aggregation"]; ok {
+		if !validSeriesAggregation(v) {
+			return nil, fmt.Errorf("unsupported appdynamics aggregation '%s'", v)
+		}
+		c.aggregation = v
+	}
+
+	if c.token == "" && c.tokenFile == "" {
+		return nil, fmt.Errorf("appdynamics api client token must be defined")
+	}
+
+	return c, nil
+}
+
+// AppDynamicsCollector is a metrics collector which exposes the value of an
+// AppDynamics metric path, rolled up over the duration, as external metric.
+// The values of metric paths with wildcards matching several metrics are
+// aggregated.
+type AppDynamicsCollector struct {
+	hpa         *autoscalingv2.HorizontalPodAutoscaler
+	controller  string
+	token       string
+	tokenFile   string
+	application string
+	metricPath  string
+	duration    int
+	valueField  string
+	aggregation string
+	metricName  string
+	labels      map[string]string
+	interval    time.Duration
+	httpClient  *http.Client
+}
+
+// appDynamicsMetricValue is a value of AppDynamics metric data.
+type appDynamicsMetricValue struct {
+	Value   float64 `json:"value"`
+	Current float64 `json:"current"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	Sum     float64 `json:"sum"`
+	Count   float64 `json:"count"`
+}
+
+// appDynamicsMetricData is the metric data of a single metric returned by
+// the metric-data API.
+type appDynamicsMetricData struct {
+	MetricPath   string                   `json:"metricPath"`
+	MetricValues []appDynamicsMetricValue `json:"metricValues"`
+}
+
+// GetMetrics queries the metric data of the metric path and returns its
+// value.
+func (c *AppDynamicsCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	token, err := readCredential(c.token, c.tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read appdynamics api client token: %v", err)
+	}
+
+	params := url.Values{}
+	params.Set("metric-path", c.metricPath)
+	params.Set("time-range-type", "BEFORE_NOW")
+	params.Set("duration-in-mins", strconv.Itoa(c.duration))
+	params.Set("rollup", "true")
+	params.Set("output", "JSON")
+
+	auditQuery(c.hpa, c.metricName, AppDynamicsCollectorName, c.application+": "+c.metricPath)
+
+	endpoint := fmt.Sprintf("%s/controller/rest/applications/%s/metric-data?%s", c.controller, url.PathEscape(c.application), params.Encode())
+	request, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	request.Header.Set("Accept", "application/json")
+
+	var response []appDynamicsMetricData
+	err = doJSON(ctx, c.httpClient, request, &response)
+	if err != nil {
+		return nil, fmt.Errorf("appdynamics query failed: %v", err)
+	}
+
+	field := appDynamicsValueFields[c.valueField]
+	var values []float64
+	for _, data := range response {
+		// metric paths without data in the duration are returned
+		// without values.
+		if len(data.MetricValues) == 0 {
+			continue
+		}
+		values = append(values, field(data.MetricValues[len(data.MetricValues)-1]))
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("appdynamics metric path '%s' of application '%s' returned no values in the last %d minutes", c.metricPath, c.application, c.duration)
+	}
+	value := aggregateSeries(values, c.aggregation)
+
+	metricValue := CollectedMetric{
+		Type: autoscalingv2.ExternalMetricSourceType,
+		External: external_metrics.ExternalMetricValue{
+			MetricName:   c.metricName,
+			MetricLabels: c.labels,
+			Timestamp:    metav1.Time{Time: time.Now().UTC()},
+		},
+	}
+	err = metricValue.setFloatValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return []CollectedMetric{metricValue}, nil
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *AppDynamicsCollector) Interval() time.Duration {
+	return c.interval
+}
@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// appDynamicsBackendTest tests the AppDynamics collector.
+var appDynamicsBackendTest = backendTest{
+	adapter: "https://shop.saas.appdynamics.com",
+	config:  map[string]string{"application": "shop", "metric-path": "Overall Application Performance|Calls per Minute"},
+	newCollector: func(t *testing.T, server *httptest.Server, controller string, config map[string]string) (Collector, error) {
+		plugin := NewAppDynamicsCollectorPlugin(controller, adapterCredentialFile(t))
+		c, err := plugin.NewCollector(
+			&autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default"}},
+			&MetricConfig{
+				MetricTypeName: MetricTypeName{Type: autoscalingv2.ExternalMetricSourceType, Name: "calls"},
+				Config:         config,
+			},
+			time.Minute,
+		)
+		if err != nil {
+			return nil, err
+		}
+		c.(*AppDynamicsCollector).httpClient = serverClient(t, server)
+		return c, nil
+	},
+	credential: func(r *http.Request) string {
+		return r.Header.Get("Authorization")
+	},
+	checkRequest: func(t *testing.T, r *http.Request, config map[string]string) {
+		if r.URL.Path != "/controller/rest/applications/shop/metric-data" || r.URL.Query().Get("metric-path") != config["metric-path"] {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+	},
+}
+
+func TestAppDynamicsCollectorCredentials(t *testing.T) {
+	appDynamicsBackendTest.testCredentials(t, []backendCredentialTestCase{
+		{
+			msg:        "controller of the adapter",
+			adapter:    "https://shop.saas.appdynamics.com",
+			target:     "shop.saas.appdynamics.com",
+			credential: "Bearer " + adapterCredential,
+		},
+		{
+			msg:        "same controller as the adapter",
+			adapter:    "https://shop.saas.appdynamics.com",
+			config:     map[string]string{"controller": "https://shop.saas.appdynamics.com/"},
+			target:     "shop.saas.appdynamics.com",
+			credential: "Bearer " + adapterCredential,
+		},
+		{
+			msg:        "token of the metric",
+			adapter:    "https://shop.saas.appdynamics.com",
+			config:     map[string]string{"token": "secret"},
+			target:     "shop.saas.appdynamics.com",
+			credential: "Bearer secret",
+		},
+		{
+			msg:     "controller override with the token of the adapter",
+			adapter: "https://shop.saas.appdynamics.com",
+			config:  map[string]string{"controller": "https://attacker.example.org"},
+			err:     true,
+		},
+		{
+			msg:    "controller without an adapter controller",
+			config: map[string]string{"controller": "https://team-a.saas.appdynamics.com"},
+			err:    true,
+		},
+		{
+			msg:        "controller override with a token",
+			adapter:    "https://shop.saas.appdynamics.com",
+			config:     map[string]string{"controller": "https://team-a.saas.appdynamics.com", "token": "secret"},
+			target:     "team-a.saas.appdynamics.com",
+			credential: "Bearer secret",
+		},
+	})
+}
+
+func TestAppDynamicsCollector(t *testing.T) {
+	appDynamicsBackendTest.testValues(t, []backendValueTestCase{
+		{
+			msg:      "sum of metric paths",
+			body:     `[{"metricPath":"a","metricValues":[{"value":2}]},{"metricPath":"b","metricValues":[{"value":3}]},{"metricPath":"c","metricValues":[]}]`,
+			expected: 5000,
+		},
+		{
+			msg:      "value field",
+			config:   map[string]string{"value-field": "max"},
+			body:     `[{"metricPath":"a","metricValues":[{"value":2,"max":7.5}]}]`,
+			expected: 7500,
+		},
+		{
+			msg:  "no values",
+			body: `[{"metricPath":"a","metricValues":[]}]`,
+			err:  true,
+		},
+	})
+}
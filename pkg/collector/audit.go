@@ -0,0 +1,130 @@
+package collector
+
+import (
+	"encoding/json"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/time/rate"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+)
+
+var (
+	// secretPattern matches key/value pairs in queries which are likely to
+	// contain secrets.
+	secretPattern = regexp.MustCompile(`(?i)((?:password|passwd|secret|token|api[_-]?key|access[_-]?key|authorization)["']?\s*[=:]\s*)("[^"]*"|'[^']*'|[^\s&,;})]+)`)
+	// userInfoPattern matches credentials embedded in URLs.
+	userInfoPattern = regexp.MustCompile(`://[^/@\s]+@`)
+	// secretKeyPattern matches collector config keys whose values are
+	// likely to be secrets, e.g. bearer-token or credentials read from
+	// Secrets.
+	secretKeyPattern = regexp.MustCompile(`(?i)(password|passwd|secret|token|api[_-]?key|access[_-]?key|authorization|credential)`)
+)
+
+// queryAuditLogger is the logger used by all collectors to audit the queries
+// they run. Auditing is disabled if it's nil.
+var queryAuditLogger *QueryAuditLogger
+
+// SetQueryAuditLogger sets the logger used by collectors to audit the
+// queries they run against metric backends.
+func SetQueryAuditLogger(logger *QueryAuditLogger) {
+	queryAuditLogger = logger
+}
+
+// QueryAuditLogger writes a record of each query run against a metric
+// backend as a JSON line. Secrets are redacted from the queries and the
+// number of records written is rate limited.
+type QueryAuditLogger struct {
+	writer  io.Writer
+	limiter *rate.Limiter
+	dropped int
+	sync.Mutex
+}
+
+// queryAuditRecord is a single record written by the QueryAuditLogger.
+type queryAuditRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	Namespace string    `json:"namespace"`
+	HPA       string    `json:"hpa"`
+	Metric    string    `json:"metric"`
+	Backend   string    `json:"backend"`
+	Query     string    `json:"query"`
+	// Dropped is the number of records dropped because of rate limiting
+	// since the last record was written.
+	Dropped int `json:"dropped,omitempty"`
+}
+
+// NewQueryAuditLogger initializes a new QueryAuditLogger writing at most
+// limit records per second to the writer.
+func NewQueryAuditLogger(writer io.Writer, limit float64) *QueryAuditLogger {
+	burst := int(limit)
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &QueryAuditLogger{
+		writer:  writer,
+		limiter: rate.NewLimiter(rate.Limit(limit), burst),
+	}
+}
+
+// Log writes an audit record for a query run on behalf of the HPA.
+func (l *QueryAuditLogger) Log(hpa *autoscalingv2.HorizontalPodAutoscaler, metricName, backend, query string) {
+	l.Lock()
+	defer l.Unlock()
+
+	if !l.limiter.Allow() {
+		l.dropped++
+		return
+	}
+
+	record := queryAuditRecord{
+		Timestamp: time.Now().UTC(),
+		Namespace: hpa.Namespace,
+		HPA:       hpa.Name,
+		Metric:    metricName,
+		Backend:   redactSecrets(backend),
+		Query:     redactSecrets(query),
+		Dropped:   l.dropped,
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		glog.Errorf("Failed to encode query audit record: %v", err)
+		return
+	}
+
+	_, err = l.writer.Write(append(data, '\n'))
+	if err != nil {
+		glog.Errorf("Failed to write query audit record: %v", err)
+		return
+	}
+	l.dropped = 0
+}
+
+// auditQuery records a query in the query audit log if auditing is enabled.
+func auditQuery(hpa *autoscalingv2.HorizontalPodAutoscaler, metricName, backend, query string) {
+	if queryAuditLogger == nil {
+		return
+	}
+	queryAuditLogger.Log(hpa, metricName, backend, query)
+}
+
+// redactSecrets removes likely secrets from a query.
+func redactSecrets(query string) string {
+	query = userInfoPattern.ReplaceAllString(query, "://<redacted>@")
+	return secretPattern.ReplaceAllString(query, "${1}<redacted>")
+}
+
+// RedactConfigValue returns the value of a collector config key with likely
+// secrets removed, such that the config can be printed. Values of keys
+// which are likely to be credentials are redacted entirely.
+func RedactConfigValue(key, value string) string {
+	if secretKeyPattern.MatchString(key) {
+		return "<redacted>"
+	}
+	return redactSecrets(value)
+}
@@ -0,0 +1,285 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+)
+
+const (
+	// CloudWatchCollectorName is the name of the CloudWatch collector.
+	CloudWatchCollectorName = "cloudwatch"
+
+	cloudWatchDefaultStatistic = cloudwatch.StatisticAverage
+	cloudWatchDefaultPeriod    = time.Minute
+	cloudWatchDefaultWindow    = 5 * time.Minute
+)
+
+// CloudWatchCollectorPlugin is a collector plugin for initializing
+// collectors which get metric data from AWS CloudWatch.
+type CloudWatchCollectorPlugin struct {
+	session *session.Session
+}
+
+// NewCloudWatchCollectorPlugin initializes a new CloudWatchCollectorPlugin.
+func NewCloudWatchCollectorPlugin(session *session.Session) *CloudWatchCollectorPlugin {
+	return &CloudWatchCollectorPlugin{
+		session: session,
+	}
+}
+
+// NewCollector initializes a new CloudWatch collector from the specified
+// HPA.
+func (p *CloudWatchCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	if config.Type != autoscalingv2.ExternalMetricSourceType {
+		return nil, fmt.Errorf("cloudwatch collector only supports external metrics")
+	}
+
+	namespace, ok := config.Config["namespace"]
+	if !ok {
+		return nil, fmt.Errorf("no cloudwatch namespace defined")
+	}
+
+	metricName, ok := config.Config["metric-name"]
+	if !ok {
+		return nil, fmt.Errorf("no cloudwatch metric name defined")
+	}
+
+	dimensions, err := parseCloudWatchDimensions(config.Config["dimensions"])
+	if err != nil {
+		return nil, err
+	}
+
+	statistic := cloudWatchDefaultStatistic
+	if v, ok := config.Config["statistic"]; ok {
+		statistic = v
+	}
+
+	metric := cloudWatchMetric{
+		metric: &cloudwatch.Metric{
+			Namespace:  aws.String(namespace),
+			MetricName: aws.String(metricName),
+			Dimensions: dimensions,
+		},
+		statistic: statistic,
+	}
+
+	return p.newCollector(hpa, config, interval, []cloudWatchMetric{metric}, config.Config["expression"])
+}
+
+// cloudWatchMetric is a statistic of a CloudWatch metric.
+type cloudWatchMetric struct {
+	metric    *cloudwatch.Metric
+	statistic string
+}
+
+// newCollector initializes a CloudWatch collector of the metrics. If the
+// expression is set it's the result of the collector, a metric math
+// expression referring to the metrics as m0, m1, ..., otherwise the first
+// metric is the result.
+func (p *CloudWatchCollectorPlugin) newCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration, metrics []cloudWatchMetric, expression string) (*CloudWatchCollector, error) {
+	c := &CloudWatchCollector{
+		cloudwatch: cloudwatch.New(regionSession(p.session, config.Config["region"])),
+		hpa:        hpa,
+		metrics:    metrics,
+		expression: expression,
+		period:     cloudWatchDefaultPeriod,
+		window:     cloudWatchDefaultWindow,
+		metricName: config.Name,
+		labels:     config.Labels,
+		interval:   interval,
+	}
+
+	if v, ok := config.Config["period"]; ok {
+		period, err := time.ParseDuration(v)
+		if err != nil || period < time.Second || period%time.Second != 0 {
+			return nil, fmt.Errorf("invalid cloudwatch period '%s', must be a number of seconds", v)
+		}
+		c.period = period
+	}
+
+	if v, ok := config.Config["window"]; ok {
+		window, err := time.ParseDuration(v)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("invalid cloudwatch window '%s'", v)
+		}
+		c.window = window
+	}
+	if c.window < c.period {
+		return nil, fmt.Errorf("cloudwatch window %s must not be shorter than the period %s", c.window, c.period)
+	}
+
+	return c, nil
+}
+
+// parseCloudWatchDimensions parses dimensions of the form
+// <name>=<value>,<name>=<value>.
+func parseCloudWatchDimensions(value string) ([]*cloudwatch.Dimension, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var dimensions []*cloudwatch.Dimension
+	for _, dimension := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(dimension), "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid cloudwatch dimension '%s', must be <name>=<value>", dimension)
+		}
+		dimensions = append(dimensions, &cloudwatch.Dimension{
+			Name:  aws.String(parts[0]),
+			Value: aws.String(parts[1]),
+		})
+	}
+
+	sort.Slice(dimensions, func(i, j int) bool {
+		return aws.StringValue(dimensions[i].Name) < aws.StringValue(dimensions[j].Name)
+	})
+	return dimensions, nil
+}
+
+// CloudWatchCollector is a metrics collector which exposes the most recent
+// datapoint of a CloudWatch metric statistic, or of a metric math expression
+// of metric statistics, as external metric.
+type CloudWatchCollector struct {
+	cloudwatch cloudwatchiface.CloudWatchAPI
+	hpa        *autoscalingv2.HorizontalPodAutoscaler
+	metrics    []cloudWatchMetric
+	expression string
+	period     time.Duration
+	window     time.Duration
+	metricName string
+	labels     map[string]string
+	interval   time.Duration
+}
+
+// GetMetrics gets the metric data of the window and returns the most recent
+// datapoint.
+func (c *CloudWatchCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	now := time.Now().UTC()
+	params := &cloudwatch.GetMetricDataInput{
+		StartTime: aws.Time(now.Add(-c.window)),
+		EndTime:   aws.Time(now),
+		ScanBy:    aws.String(cloudwatch.ScanByTimestampDescending),
+	}
+	for i, metric := range c.metrics {
+		params.MetricDataQueries = append(params.MetricDataQueries, &cloudwatch.MetricDataQuery{
+			Id: aws.String(fmt.Sprintf("m%d", i)),
+			MetricStat: &cloudwatch.MetricStat{
+				Metric: metric.metric,
+				Period: aws.Int64(int64(c.period.Seconds())),
+				Stat:   aws.String(metric.statistic),
+			},
+			ReturnData: aws.Bool(c.expression == "" && i == 0),
+		})
+	}
+	if c.expression != "" {
+		params.MetricDataQueries = append(params.MetricDataQueries, &cloudwatch.MetricDataQuery{
+			Id:         aws.String("e0"),
+			Expression: aws.String(c.expression),
+			ReturnData: aws.Bool(true),
+		})
+	}
+
+	auditQuery(c.hpa, c.metricName, CloudWatchCollectorName, c.description())
+
+	resp, err := c.cloudwatch.GetMetricDataWithContext(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var failed []FailedTarget
+	var latest *time.Time
+	var value float64
+	for _, result := range resp.MetricDataResults {
+		if status := aws.StringValue(result.StatusCode); status != "" && status != cloudwatch.StatusCodeComplete {
+			failed = append(failed, FailedTarget{
+				Target: aws.StringValue(result.Id),
+				Err:    cloudWatchMessagesError(status, result.Messages),
+			})
+		}
+		for i, timestamp := range result.Timestamps {
+			if i >= len(result.Values) || timestamp == nil {
+				break
+			}
+			if latest == nil || timestamp.After(*latest) {
+				latest = timestamp
+				value = aws.Float64Value(result.Values[i])
+			}
+		}
+	}
+
+	if latest == nil {
+		if len(failed) > 0 {
+			return nil, fmt.Errorf("cloudwatch query '%s' failed: %v", c.description(), failed[0].Err)
+		}
+		return nil, fmt.Errorf("cloudwatch query '%s' has no datapoints within %s", c.description(), c.window)
+	}
+
+	metricValue := CollectedMetric{
+		Type: autoscalingv2.ExternalMetricSourceType,
+		External: external_metrics.ExternalMetricValue{
+			MetricName:   c.metricName,
+			MetricLabels: c.labels,
+			Timestamp:    metav1.Time{Time: *latest},
+		},
+	}
+	if err := metricValue.setFloatValue(value); err != nil {
+		return nil, err
+	}
+
+	// CloudWatch signals incomplete results with the status code of the
+	// results and with messages of the response.
+	if len(failed) > 0 || len(resp.Messages) > 0 {
+		return nil, &PartialResponseError{
+			Values:        []CollectedMetric{metricValue},
+			FailedTargets: failed,
+			Err:           cloudWatchMessagesError("incomplete metric data", resp.Messages),
+		}
+	}
+
+	return []CollectedMetric{metricValue}, nil
+}
+
+// cloudWatchMessagesError returns an error describing the status and the
+// messages of incomplete CloudWatch metric data.
+func cloudWatchMessagesError(status string, messages []*cloudwatch.MessageData) error {
+	if len(messages) == 0 {
+		return errors.New(status)
+	}
+
+	described := make([]string, 0, len(messages))
+	for _, message := range messages {
+		described = append(described, fmt.Sprintf("%s: %s", aws.StringValue(message.Code), aws.StringValue(message.Value)))
+	}
+	return fmt.Errorf("%s (%s)", status, strings.Join(described, "; "))
+}
+
+// description describes the queried metrics for audit logs and errors.
+func (c *CloudWatchCollector) description() string {
+	metrics := make([]string, 0, len(c.metrics))
+	for i, metric := range c.metrics {
+		metrics = append(metrics, fmt.Sprintf("m%d=%s/%s:%s", i, aws.StringValue(metric.metric.Namespace), aws.StringValue(metric.metric.MetricName), metric.statistic))
+	}
+
+	description := strings.Join(metrics, " ")
+	if c.expression != "" {
+		description = c.expression + " " + description
+	}
+	return description
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *CloudWatchCollector) Interval() time.Duration {
+	return c.interval
+}
@@ -0,0 +1,139 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/cloudwatch/cloudwatchiface"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeCloudWatchAPI answers GetMetricData requests with a fixed response
+// and records the last request.
+type fakeCloudWatchAPI struct {
+	cloudwatchiface.CloudWatchAPI
+	output *cloudwatch.GetMetricDataOutput
+	input  *cloudwatch.GetMetricDataInput
+}
+
+func (f *fakeCloudWatchAPI) GetMetricDataWithContext(ctx aws.Context, input *cloudwatch.GetMetricDataInput, opts ...request.Option) (*cloudwatch.GetMetricDataOutput, error) {
+	f.input = input
+	return f.output, nil
+}
+
+func TestCloudWatchCollectorGetMetrics(t *testing.T) {
+	now := time.Now().UTC()
+	older := now.Add(-time.Minute)
+	message := &cloudwatch.MessageData{Code: aws.String("MaxQueryTimeRangeExceed"), Value: aws.String("query time range too long")}
+
+	for _, tc := range []struct {
+		msg     string
+		results []*cloudwatch.MetricDataResult
+		message []*cloudwatch.MessageData
+		value   float64
+		partial int
+		err     bool
+	}{
+		{
+			msg: "latest datapoint of complete data",
+			results: []*cloudwatch.MetricDataResult{{
+				Id:         aws.String("m0"),
+				StatusCode: aws.String(cloudwatch.StatusCodeComplete),
+				Timestamps: []*time.Time{&older, &now},
+				Values:     aws.Float64Slice([]float64{1, 2.5}),
+			}},
+			value: 2.5,
+		},
+		{
+			msg: "partial data status",
+			results: []*cloudwatch.MetricDataResult{{
+				Id:         aws.String("m0"),
+				StatusCode: aws.String(cloudwatch.StatusCodePartialData),
+				Timestamps: []*time.Time{&now},
+				Values:     aws.Float64Slice([]float64{3}),
+			}},
+			value:   3,
+			partial: 1,
+		},
+		{
+			msg: "response messages",
+			results: []*cloudwatch.MetricDataResult{{
+				Id:         aws.String("m0"),
+				StatusCode: aws.String(cloudwatch.StatusCodeComplete),
+				Timestamps: []*time.Time{&now},
+				Values:     aws.Float64Slice([]float64{4}),
+			}},
+			message: []*cloudwatch.MessageData{message},
+			value:   4,
+		},
+		{
+			msg: "failed without datapoints",
+			results: []*cloudwatch.MetricDataResult{{
+				Id:         aws.String("m0"),
+				StatusCode: aws.String(cloudwatch.StatusCodeInternalError),
+				Messages:   []*cloudwatch.MessageData{message},
+			}},
+			err: true,
+		},
+		{
+			msg: "no datapoints",
+			results: []*cloudwatch.MetricDataResult{{
+				Id:         aws.String("m0"),
+				StatusCode: aws.String(cloudwatch.StatusCodeComplete),
+			}},
+			err: true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			c := &CloudWatchCollector{
+				cloudwatch: &fakeCloudWatchAPI{output: &cloudwatch.GetMetricDataOutput{
+					MetricDataResults: tc.results,
+					Messages:          tc.message,
+				}},
+				hpa:        &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default"}},
+				metrics:    []cloudWatchMetric{{metric: &cloudwatch.Metric{Namespace: aws.String("AWS/SQS"), MetricName: aws.String("NumberOfMessagesSent")}, statistic: "Sum"}},
+				period:     time.Minute,
+				window:     5 * time.Minute,
+				metricName: "messages",
+			}
+
+			values, err := c.GetMetrics(context.Background())
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error, got %v", values)
+				}
+				if _, ok := err.(*PartialResponseError); ok {
+					t.Fatalf("expected failure, got partial response %v", err)
+				}
+				return
+			}
+
+			partial := tc.partial > 0 || len(tc.message) > 0
+			if pErr, ok := err.(*PartialResponseError); ok {
+				if !partial {
+					t.Fatalf("unexpected partial response: %v", err)
+				}
+				if len(pErr.FailedTargets) != tc.partial {
+					t.Errorf("expected %d failed targets, got %d", tc.partial, len(pErr.FailedTargets))
+				}
+				values = pErr.Values
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if partial {
+				t.Fatalf("expected partial response, got %v", values)
+			}
+
+			if len(values) != 1 {
+				t.Fatalf("expected one value, got %d", len(values))
+			}
+			if value := values[0].floatValue(); value != tc.value {
+				t.Errorf("expected value %v, got %v", tc.value, value)
+			}
+		})
+	}
+}
@@ -1,15 +1,17 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
-	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/metrics/pkg/apis/external_metrics"
@@ -17,11 +19,18 @@ import (
 
 const (
 	AWSSQSQueueLengthMetric = "sqs-queue-length"
-	sqsQueueNameLabelKey    = "queue-name"
+	// AWSSQSCollectorName is the collector name of SQS queue length
+	// metrics configured by annotations.
+	AWSSQSCollectorName  = "sqs"
+	sqsQueueNameLabelKey = "queue-name"
+	sqsRegionLabelKey    = "region"
+	sqsRoleARNConfKey    = "role-arn"
 )
 
 type AWSCollectorPlugin struct {
 	session *session.Session
+	// namespaceRoles are the roles the HPAs of each namespace may assume.
+	namespaceRoles map[string][]string
 }
 
 func NewAWSCollectorPlugin(session *session.Session) *AWSCollectorPlugin {
@@ -30,11 +39,55 @@ func NewAWSCollectorPlugin(session *session.Session) *AWSCollectorPlugin {
 	}
 }
 
-// NewCollector initializes a new skipper collector from the specified HPA.
-func (c *AWSCollectorPlugin) NewCollector(hpa *autoscalingv2beta1.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
-	switch config.Name {
-	case AWSSQSQueueLengthMetric:
-		return NewAWSSQSCollector(c.session, config, interval)
+// regionSession returns a copy of the session for the region, or the
+// session itself if no region is given.
+func regionSession(sess *session.Session, region string) *session.Session {
+	if region == "" {
+		return sess
+	}
+	return sess.Copy(&aws.Config{Region: aws.String(region)})
+}
+
+// roleSession returns a copy of the session assuming the role, or the
+// session itself if no role is given.
+func roleSession(sess *session.Session, roleARN string) *session.Session {
+	if roleARN == "" {
+		return sess
+	}
+	return sess.Copy(&aws.Config{Credentials: stscreds.NewCredentials(sess, roleARN)})
+}
+
+// SetNamespaceRoles sets the roles the HPAs of each namespace may assume
+// with the role-arn key. HPAs can't assume roles which aren't mapped to their
+// namespace.
+func (c *AWSCollectorPlugin) SetNamespaceRoles(roles map[string][]string) {
+	c.namespaceRoles = roles
+}
+
+// checkRole returns an error if the metric config references a role which
+// isn't mapped to the namespace of the HPA.
+func (c *AWSCollectorPlugin) checkRole(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig) error {
+	roleARN, ok := config.Config[sqsRoleARNConfKey]
+	if !ok {
+		return nil
+	}
+
+	for _, role := range c.namespaceRoles[hpa.Namespace] {
+		if role == roleARN {
+			return nil
+		}
+	}
+	return fmt.Errorf("role '%s' is not allowed for namespace %s, see --aws-namespace-roles", roleARN, hpa.Namespace)
+}
+
+// NewCollector initializes a new AWS collector from the specified HPA.
+func (c *AWSCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	if config.Name == AWSSQSQueueLengthMetric || config.CollectorName == AWSSQSCollectorName {
+		err := c.checkRole(hpa, config)
+		if err != nil {
+			return nil, err
+		}
+		return NewAWSSQSCollector(c.session, hpa, config, interval)
 	}
 
 	return nil, fmt.Errorf("metric '%s' not supported", config.Name)
@@ -46,19 +99,40 @@ type AWSSQSCollector struct {
 	// region string
 	queueURL   string
 	queueName  string
+	attributes []string
 	labels     map[string]string
 	metricName string
-	metricType autoscalingv2beta1.MetricSourceType
+	metricType autoscalingv2.MetricSourceType
+	hpa        *autoscalingv2.HorizontalPodAutoscaler
 }
 
-func NewAWSSQSCollector(session *session.Session, config *MetricConfig, interval time.Duration) (*AWSSQSCollector, error) {
-	service := sqs.New(session)
+func NewAWSSQSCollector(session *session.Session, hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (*AWSSQSCollector, error) {
+	name, ok := config.Config[sqsQueueNameLabelKey]
+	if !ok {
+		name, ok = config.Labels[sqsQueueNameLabelKey]
+		if !ok {
+			return nil, fmt.Errorf("sqs queue name not specified on metric")
+		}
+	}
 
-	name, ok := config.Labels[sqsQueueNameLabelKey]
+	region, ok := config.Config[sqsRegionLabelKey]
 	if !ok {
-		return nil, fmt.Errorf("sqs queue name not specified on metric")
+		region = config.Labels[sqsRegionLabelKey]
+	}
+
+	attributes := []string{sqs.QueueAttributeNameApproximateNumberOfMessages}
+	if v, ok := config.Config["include-not-visible"]; ok {
+		includeNotVisible, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse include-not-visible value %s: %v", v, err)
+		}
+		if includeNotVisible {
+			attributes = append(attributes, sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible)
+		}
 	}
 
+	service := sqs.New(roleSession(regionSession(session, region), config.Config[sqsRoleARNConfKey]))
+
 	params := &sqs.GetQueueUrlInput{
 		QueueName: aws.String(name),
 	}
@@ -69,47 +143,58 @@ func NewAWSSQSCollector(session *session.Session, config *MetricConfig, interval
 	}
 
 	return &AWSSQSCollector{
-		sqs:        sqs.New(session),
+		sqs:        service,
 		interval:   interval,
 		queueURL:   aws.StringValue(resp.QueueUrl),
 		queueName:  name,
+		attributes: attributes,
 		metricName: config.Name,
 		metricType: config.Type,
 		labels:     config.Labels,
+		hpa:        hpa,
 	}, nil
 }
 
-func (c *AWSSQSCollector) GetMetrics() ([]CollectedMetric, error) {
+func (c *AWSSQSCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
 	params := &sqs.GetQueueAttributesInput{
 		QueueUrl:       aws.String(c.queueURL),
-		AttributeNames: aws.StringSlice([]string{sqs.QueueAttributeNameApproximateNumberOfMessages}),
+		AttributeNames: aws.StringSlice(c.attributes),
 	}
 
-	resp, err := c.sqs.GetQueueAttributes(params)
+	auditQuery(c.hpa, c.metricName, "sqs", params.String())
+
+	resp, err := c.sqs.GetQueueAttributesWithContext(ctx, params)
 	if err != nil {
 		return nil, err
 	}
 
-	if v, ok := resp.Attributes[sqs.QueueAttributeNameApproximateNumberOfMessages]; ok {
+	// the queue length is the sum of the queried attributes, i.e. the
+	// visible and, if enabled, the in flight messages.
+	length := 0
+	for _, attribute := range c.attributes {
+		v, ok := resp.Attributes[attribute]
+		if !ok {
+			return nil, fmt.Errorf("failed to get queue length for '%s'", c.queueName)
+		}
+
 		i, err := strconv.Atoi(aws.StringValue(v))
 		if err != nil {
 			return nil, err
 		}
+		length += i
+	}
 
-		metricValue := CollectedMetric{
-			Type: c.metricType,
-			External: external_metrics.ExternalMetricValue{
-				MetricName:   c.metricName,
-				MetricLabels: c.labels,
-				Timestamp:    metav1.Time{Time: time.Now().UTC()},
-				Value:        *resource.NewQuantity(int64(i), resource.DecimalSI),
-			},
-		}
-
-		return []CollectedMetric{metricValue}, nil
+	metricValue := CollectedMetric{
+		Type: c.metricType,
+		External: external_metrics.ExternalMetricValue{
+			MetricName:   c.metricName,
+			MetricLabels: c.labels,
+			Timestamp:    metav1.Time{Time: time.Now().UTC()},
+			Value:        *resource.NewQuantity(int64(length), resource.DecimalSI),
+		},
 	}
 
-	return nil, fmt.Errorf("failed to get queue length for '%s'", c.queueName)
+	return []CollectedMetric{metricValue}, nil
 }
 
 // Interval returns the interval at which the collector should run.
@@ -0,0 +1,78 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAWSCollectorPluginCheckRole(t *testing.T) {
+	role := "arn:aws:iam::123456789012:role/queue-reader"
+
+	for _, tc := range []struct {
+		msg       string
+		roles     map[string][]string
+		namespace string
+		config    map[string]string
+		err       bool
+	}{
+		{
+			msg:       "no role",
+			namespace: "team-a",
+			config:    map[string]string{"queue-name": "foo"},
+		},
+		{
+			msg:       "role without mapping",
+			namespace: "team-a",
+			config:    map[string]string{"role-arn": role},
+			err:       true,
+		},
+		{
+			msg:       "role of the namespace",
+			roles:     map[string][]string{"team-a": {role}},
+			namespace: "team-a",
+			config:    map[string]string{"role-arn": role},
+		},
+		{
+			msg:       "role of another namespace",
+			roles:     map[string][]string{"team-a": {role}},
+			namespace: "team-b",
+			config:    map[string]string{"role-arn": role},
+			err:       true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			p := NewAWSCollectorPlugin(nil)
+			if tc.roles != nil {
+				p.SetNamespaceRoles(tc.roles)
+			}
+			hpa := &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: tc.namespace}}
+
+			err := p.checkRole(hpa, &MetricConfig{Config: tc.config})
+			if tc.err && err == nil {
+				t.Error("expected error")
+			}
+			if !tc.err && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewAWSSQSCollectorInvalidIncludeNotVisible(t *testing.T) {
+	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String("eu-central-1")}))
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default"}}
+	config := &MetricConfig{Config: map[string]string{
+		"queue-name":          "foo",
+		"include-not-visible": "yes please",
+	}}
+
+	_, err := NewAWSSQSCollector(sess, hpa, config, time.Minute)
+	if err == nil {
+		t.Fatal("expected error for invalid include-not-visible value")
+	}
+}
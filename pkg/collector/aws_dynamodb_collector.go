@@ -0,0 +1,129 @@
+package collector
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+)
+
+const (
+	// DynamoDBCollectorName is the name of the DynamoDB collector.
+	DynamoDBCollectorName = "dynamodb"
+
+	dynamoDBNamespace     = "AWS/DynamoDB"
+	dynamoDBDefaultMetric = "write-utilization"
+)
+
+// dynamoDBMetric is a metric of a DynamoDB table computed from CloudWatch
+// metrics.
+type dynamoDBMetric struct {
+	metrics    []cloudWatchMetric
+	expression string
+}
+
+// dynamoDBMetrics are the supported metrics of DynamoDB tables by name.
+// Consumed capacity is reported as sum per period and converted to units per
+// second.
+var dynamoDBMetrics = map[string]dynamoDBMetric{
+	"read-utilization": {
+		metrics: []cloudWatchMetric{
+			{&cloudwatch.Metric{MetricName: aws.String("ConsumedReadCapacityUnits")}, cloudwatch.StatisticSum},
+			{&cloudwatch.Metric{MetricName: aws.String("ProvisionedReadCapacityUnits")}, cloudwatch.StatisticAverage},
+		},
+		expression: "100 * (m0 / PERIOD(m0)) / m1",
+	},
+	"write-utilization": {
+		metrics: []cloudWatchMetric{
+			{&cloudwatch.Metric{MetricName: aws.String("ConsumedWriteCapacityUnits")}, cloudwatch.StatisticSum},
+			{&cloudwatch.Metric{MetricName: aws.String("ProvisionedWriteCapacityUnits")}, cloudwatch.StatisticAverage},
+		},
+		expression: "100 * (m0 / PERIOD(m0)) / m1",
+	},
+	"consumed-read": {
+		metrics: []cloudWatchMetric{
+			{&cloudwatch.Metric{MetricName: aws.String("ConsumedReadCapacityUnits")}, cloudwatch.StatisticSum},
+		},
+		expression: "m0 / PERIOD(m0)",
+	},
+	"consumed-write": {
+		metrics: []cloudWatchMetric{
+			{&cloudwatch.Metric{MetricName: aws.String("ConsumedWriteCapacityUnits")}, cloudwatch.StatisticSum},
+		},
+		expression: "m0 / PERIOD(m0)",
+	},
+	"read-throttled": {
+		metrics: []cloudWatchMetric{
+			{&cloudwatch.Metric{MetricName: aws.String("ReadThrottleEvents")}, cloudwatch.StatisticSum},
+		},
+	},
+	"write-throttled": {
+		metrics: []cloudWatchMetric{
+			{&cloudwatch.Metric{MetricName: aws.String("WriteThrottleEvents")}, cloudwatch.StatisticSum},
+		},
+	},
+}
+
+// DynamoDBCollectorPlugin is a collector plugin for initializing collectors
+// which expose the consumed capacity, its utilization or the throttled
+// requests of DynamoDB tables.
+type DynamoDBCollectorPlugin struct {
+	cloudWatch *CloudWatchCollectorPlugin
+}
+
+// NewDynamoDBCollectorPlugin initializes a new DynamoDBCollectorPlugin.
+func NewDynamoDBCollectorPlugin(session *session.Session) *DynamoDBCollectorPlugin {
+	return &DynamoDBCollectorPlugin{
+		cloudWatch: NewCloudWatchCollectorPlugin(session),
+	}
+}
+
+// NewCollector initializes a new DynamoDB collector from the specified HPA.
+// The collector is a CloudWatch collector of the metrics of the table, or
+// of one of its global secondary indexes.
+func (p *DynamoDBCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	if config.Type != autoscalingv2.ExternalMetricSourceType {
+		return nil, fmt.Errorf("dynamodb collector only supports external metrics")
+	}
+
+	tableName, ok := config.Config["table-name"]
+	if !ok {
+		return nil, fmt.Errorf("no dynamodb table name defined")
+	}
+
+	name := dynamoDBDefaultMetric
+	if v, ok := config.Config["metric"]; ok {
+		name = v
+	}
+	metric, ok := dynamoDBMetrics[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported dynamodb metric '%s'", name)
+	}
+
+	dimensions := []*cloudwatch.Dimension{
+		{Name: aws.String("TableName"), Value: aws.String(tableName)},
+	}
+	if indexName, ok := config.Config["index-name"]; ok {
+		dimensions = append(dimensions, &cloudwatch.Dimension{
+			Name:  aws.String("GlobalSecondaryIndexName"),
+			Value: aws.String(indexName),
+		})
+	}
+
+	metrics := make([]cloudWatchMetric, 0, len(metric.metrics))
+	for _, m := range metric.metrics {
+		metrics = append(metrics, cloudWatchMetric{
+			metric: &cloudwatch.Metric{
+				Namespace:  aws.String(dynamoDBNamespace),
+				MetricName: m.metric.MetricName,
+				Dimensions: dimensions,
+			},
+			statistic: m.statistic,
+		})
+	}
+
+	return p.cloudWatch.newCollector(hpa, config, interval, metrics, metric.expression)
+}
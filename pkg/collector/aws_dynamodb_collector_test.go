@@ -0,0 +1,114 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDynamoDBCollector(t *testing.T) {
+	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String("eu-central-1")}))
+	now := time.Now().UTC()
+
+	for _, tc := range []struct {
+		msg        string
+		config     map[string]string
+		metrics    []string
+		expression string
+		dimensions int
+		err        bool
+	}{
+		{
+			msg:        "write utilization of the table",
+			config:     map[string]string{"table-name": "orders"},
+			metrics:    []string{"ConsumedWriteCapacityUnits", "ProvisionedWriteCapacityUnits"},
+			expression: "100 * (m0 / PERIOD(m0)) / m1",
+			dimensions: 1,
+		},
+		{
+			msg:        "consumed reads of an index",
+			config:     map[string]string{"table-name": "orders", "index-name": "by-customer", "metric": "consumed-read"},
+			metrics:    []string{"ConsumedReadCapacityUnits"},
+			expression: "m0 / PERIOD(m0)",
+			dimensions: 2,
+		},
+		{
+			msg:        "throttled writes",
+			config:     map[string]string{"table-name": "orders", "metric": "write-throttled"},
+			metrics:    []string{"WriteThrottleEvents"},
+			dimensions: 1,
+		},
+		{
+			msg:    "unsupported metric",
+			config: map[string]string{"table-name": "orders", "metric": "item-count"},
+			err:    true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			plugin := NewDynamoDBCollectorPlugin(sess)
+			config := &MetricConfig{
+				MetricTypeName: MetricTypeName{Type: autoscalingv2.ExternalMetricSourceType, Name: "capacity"},
+				Config:         tc.config,
+			}
+			hpa := &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default"}}
+			c, err := plugin.NewCollector(hpa, config, time.Minute)
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			api := &fakeCloudWatchAPI{output: &cloudwatch.GetMetricDataOutput{
+				MetricDataResults: []*cloudwatch.MetricDataResult{{
+					Id:         aws.String("e0"),
+					StatusCode: aws.String(cloudwatch.StatusCodeComplete),
+					Timestamps: []*time.Time{&now},
+					Values:     aws.Float64Slice([]float64{42.5}),
+				}},
+			}}
+			c.(*CloudWatchCollector).cloudwatch = api
+
+			metrics, err := c.GetMetrics(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(metrics) != 1 || metrics[0].External.Value.MilliValue() != 42500 {
+				t.Errorf("expected value 42500m, got %v", metrics)
+			}
+
+			var names []string
+			var expression string
+			for _, query := range api.input.MetricDataQueries {
+				if query.Expression != nil {
+					expression = aws.StringValue(query.Expression)
+					continue
+				}
+				names = append(names, aws.StringValue(query.MetricStat.Metric.MetricName))
+				if n := len(query.MetricStat.Metric.Dimensions); n != tc.dimensions {
+					t.Errorf("expected %d dimensions, got %d", tc.dimensions, n)
+				}
+			}
+			if len(names) != len(tc.metrics) {
+				t.Fatalf("expected metrics %v, got %v", tc.metrics, names)
+			}
+			for i := range names {
+				if names[i] != tc.metrics[i] {
+					t.Errorf("expected metrics %v, got %v", tc.metrics, names)
+				}
+			}
+			if expression != tc.expression {
+				t.Errorf("expected expression '%s', got '%s'", tc.expression, expression)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+)
+
+const (
+	// KinesisCollectorName is the name of the Kinesis collector.
+	KinesisCollectorName = "kinesis"
+
+	kinesisNamespace     = "AWS/Kinesis"
+	kinesisDefaultMetric = "iterator-age"
+)
+
+// kinesisMetric is a CloudWatch metric of a Kinesis stream.
+type kinesisMetric struct {
+	metricName string
+	statistic  string
+	// consumer is true for metrics of enhanced fan-out consumers.
+	consumer bool
+}
+
+// kinesisMetrics are the supported metrics of Kinesis streams by name.
+var kinesisMetrics = map[string]kinesisMetric{
+	"iterator-age":         {"GetRecords.IteratorAgeMilliseconds", cloudwatch.StatisticMaximum, false},
+	"millis-behind-latest": {"SubscribeToShardEvent.MillisBehindLatest", cloudwatch.StatisticMaximum, true},
+	"incoming-records":     {"IncomingRecords", cloudwatch.StatisticSum, false},
+	"incoming-bytes":       {"IncomingBytes", cloudwatch.StatisticSum, false},
+	"get-records":          {"GetRecords.Records", cloudwatch.StatisticSum, false},
+	"read-throttled":       {"ReadProvisionedThroughputExceeded", cloudwatch.StatisticSum, false},
+}
+
+// KinesisCollectorPlugin is a collector plugin for initializing collectors
+// which expose the CloudWatch metrics of Kinesis streams, e.g. the iterator
+// age of the consumers of a stream.
+type KinesisCollectorPlugin struct {
+	cloudWatch *CloudWatchCollectorPlugin
+}
+
+// NewKinesisCollectorPlugin initializes a new KinesisCollectorPlugin.
+func NewKinesisCollectorPlugin(session *session.Session) *KinesisCollectorPlugin {
+	return &KinesisCollectorPlugin{
+		cloudWatch: NewCloudWatchCollectorPlugin(session),
+	}
+}
+
+// NewCollector initializes a new Kinesis collector from the specified HPA.
+// The collector is a CloudWatch collector of the metric of the stream.
+func (p *KinesisCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	streamName, ok := config.Config["stream-name"]
+	if !ok {
+		return nil, fmt.Errorf("no kinesis stream name defined")
+	}
+
+	name := kinesisDefaultMetric
+	if v, ok := config.Config["metric"]; ok {
+		name = v
+	}
+	metric, ok := kinesisMetrics[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported kinesis metric '%s'", name)
+	}
+
+	dimensions := "StreamName=" + streamName
+	if metric.consumer {
+		consumerName, ok := config.Config["consumer-name"]
+		if !ok {
+			return nil, fmt.Errorf("kinesis metric '%s' requires a consumer name", name)
+		}
+		dimensions += ",ConsumerName=" + consumerName
+	}
+
+	cloudWatchConfig := *config
+	cloudWatchConfig.Config = map[string]string{
+		"namespace":   kinesisNamespace,
+		"metric-name": metric.metricName,
+		"dimensions":  dimensions,
+		"statistic":   metric.statistic,
+	}
+	for _, key := range []string{"statistic", "period", "window", "region"} {
+		if v, ok := config.Config[key]; ok {
+			cloudWatchConfig.Config[key] = v
+		}
+	}
+
+	return p.cloudWatch.NewCollector(hpa, &cloudWatchConfig, interval)
+}
@@ -0,0 +1,116 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestKinesisCollector(t *testing.T) {
+	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String("eu-central-1")}))
+	now := time.Now().UTC()
+
+	for _, tc := range []struct {
+		msg        string
+		config     map[string]string
+		metricName string
+		statistic  string
+		dimensions []string
+		err        bool
+	}{
+		{
+			msg:        "iterator age of the stream",
+			config:     map[string]string{"stream-name": "orders"},
+			metricName: "GetRecords.IteratorAgeMilliseconds",
+			statistic:  cloudwatch.StatisticMaximum,
+			dimensions: []string{"StreamName=orders"},
+		},
+		{
+			msg:        "lag of a consumer",
+			config:     map[string]string{"stream-name": "orders", "metric": "millis-behind-latest", "consumer-name": "billing"},
+			metricName: "SubscribeToShardEvent.MillisBehindLatest",
+			statistic:  cloudwatch.StatisticMaximum,
+			dimensions: []string{"ConsumerName=billing", "StreamName=orders"},
+		},
+		{
+			msg:        "statistic override",
+			config:     map[string]string{"stream-name": "orders", "metric": "incoming-records", "statistic": cloudwatch.StatisticAverage},
+			metricName: "IncomingRecords",
+			statistic:  cloudwatch.StatisticAverage,
+			dimensions: []string{"StreamName=orders"},
+		},
+		{
+			msg:    "consumer metric without consumer",
+			config: map[string]string{"stream-name": "orders", "metric": "millis-behind-latest"},
+			err:    true,
+		},
+		{
+			msg:    "unsupported metric",
+			config: map[string]string{"stream-name": "orders", "metric": "shards"},
+			err:    true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			plugin := NewKinesisCollectorPlugin(sess)
+			config := &MetricConfig{
+				MetricTypeName: MetricTypeName{Type: autoscalingv2.ExternalMetricSourceType, Name: "lag"},
+				Config:         tc.config,
+			}
+			hpa := &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default"}}
+			c, err := plugin.NewCollector(hpa, config, time.Minute)
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			api := &fakeCloudWatchAPI{output: &cloudwatch.GetMetricDataOutput{
+				MetricDataResults: []*cloudwatch.MetricDataResult{{
+					Id:         aws.String("m0"),
+					StatusCode: aws.String(cloudwatch.StatusCodeComplete),
+					Timestamps: []*time.Time{&now},
+					Values:     aws.Float64Slice([]float64{1500}),
+				}},
+			}}
+			c.(*CloudWatchCollector).cloudwatch = api
+
+			metrics, err := c.GetMetrics(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(metrics) != 1 || metrics[0].External.Value.Value() != 1500 {
+				t.Errorf("expected value 1500, got %v", metrics)
+			}
+
+			stat := api.input.MetricDataQueries[0].MetricStat
+			if name := aws.StringValue(stat.Metric.MetricName); name != tc.metricName {
+				t.Errorf("expected metric %s, got %s", tc.metricName, name)
+			}
+			if statistic := aws.StringValue(stat.Stat); statistic != tc.statistic {
+				t.Errorf("expected statistic %s, got %s", tc.statistic, statistic)
+			}
+			var dimensions []string
+			for _, dimension := range stat.Metric.Dimensions {
+				dimensions = append(dimensions, aws.StringValue(dimension.Name)+"="+aws.StringValue(dimension.Value))
+			}
+			if len(dimensions) != len(tc.dimensions) {
+				t.Fatalf("expected dimensions %v, got %v", tc.dimensions, dimensions)
+			}
+			for i := range dimensions {
+				if dimensions[i] != tc.dimensions[i] {
+					t.Errorf("expected dimensions %v, got %v", tc.dimensions, dimensions)
+				}
+			}
+		})
+	}
+}
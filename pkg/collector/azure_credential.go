@@ -0,0 +1,55 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+// NewAzureCredential initializes the credential of the Azure collectors. If
+// the client ID of a user assigned identity is set, the managed identity of
+// the node with that client ID is used. Otherwise the default credential
+// chain is used, which covers Workload Identity, a system assigned managed
+// identity and the credentials of the environment.
+func NewAzureCredential(clientID string) (azcore.TokenCredential, error) {
+	var credential azcore.TokenCredential
+	var err error
+	if clientID != "" {
+		credential, err = azidentity.NewManagedIdentityCredential(&azidentity.ManagedIdentityCredentialOptions{
+			ID: azidentity.ClientID(clientID),
+		})
+	} else {
+		credential, err = azidentity.NewDefaultAzureCredential(nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize azure credential: %v", err)
+	}
+	return credential, nil
+}
+
+// azureAuthRoundTripper authenticates requests with a token of the
+// credential for the scope. Tokens are cached by the credential until they
+// expire.
+type azureAuthRoundTripper struct {
+	credential azcore.TokenCredential
+	scope      string
+	next       http.RoundTripper
+}
+
+// RoundTrip sets the bearer token of the credential on a copy of the
+// request.
+func (t *azureAuthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.credential.GetToken(req.Context(), policy.TokenRequestOptions{
+		Scopes: []string{t.scope},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get azure token: %v", err)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,264 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+)
+
+const (
+	// AzureMonitorCollectorName is the name of the Azure Monitor collector.
+	AzureMonitorCollectorName = "azure-monitor"
+
+	azureManagementEndpoint        = "https://management.azure.com"
+	azureManagementScope           = "https://management.azure.com/.default"
+	azureMonitorAPIVersion         = "2018-01-01"
+	azureMonitorDefaultAggregation = "Average"
+	azureMonitorDefaultTimespan    = 5 * time.Minute
+	azureMonitorDefaultInterval    = time.Minute
+)
+
+// AzureMonitorCollectorPlugin is a collector plugin for initializing
+// collectors which query the metrics of Azure resources from the Azure
+// Monitor metrics API.
+type AzureMonitorCollectorPlugin struct {
+	credential azcore.TokenCredential
+}
+
+// NewAzureMonitorCollectorPlugin initializes a new
+// AzureMonitorCollectorPlugin authenticating with the credential.
+func NewAzureMonitorCollectorPlugin(credential azcore.TokenCredential) *AzureMonitorCollectorPlugin {
+	return &AzureMonitorCollectorPlugin{
+		credential: credential,
+	}
+}
+
+// NewCollector initializes a new Azure Monitor collector from the specified
+// HPA.
+func (p *AzureMonitorCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	if config.Type != autoscalingv2.ExternalMetricSourceType {
+		return nil, fmt.Errorf("azure-monitor collector only supports external metrics")
+	}
+
+	resourceURI, ok := config.Config["resource-uri"]
+	if !ok {
+		return nil, fmt.Errorf("no azure resource uri defined")
+	}
+	if !strings.HasPrefix(resourceURI, "/subscriptions/") {
+		return nil, fmt.Errorf("invalid azure resource uri '%s', must start with /subscriptions/", resourceURI)
+	}
+
+	metricName, ok := config.Config["metric-name"]
+	if !ok {
+		return nil, fmt.Errorf("no azure monitor metric name defined")
+	}
+
+	c := &AzureMonitorCollector{
+		hpa:               hpa,
+		resourceURI:       strings.TrimSuffix(resourceURI, "/"),
+		azureMetricName:   metricName,
+		metricNamespace:   config.Config["metric-namespace"],
+		filter:            config.Config["filter"],
+		aggregation:       azureMonitorDefaultAggregation,
+		timespan:          azureMonitorDefaultTimespan,
+		grain:             azureMonitorDefaultInterval,
+		seriesAggregation: seriesAggregationAvg,
+		metricName:        config.Name,
+		labels:            config.Labels,
+		interval:          interval,
+		httpClient: &http.Client{
+			Timeout: 15 * time.Second,
+			Transport: &azureAuthRoundTripper{
+				credential: p.credential,
+				scope:      azureManagementScope,
+				next:       &http.Transport{},
+			},
+		},
+	}
+
+	if v, ok := config.Config["aggregation"]; ok {
+		switch v {
+		case "Average", "Total", "Minimum", "Maximum", "Count":
+			c.aggregation = v
+		default:
+			return nil, fmt.Errorf("unsupported azure monitor aggregation '%s'", v)
+		}
+	}
+
+	if v, ok := config.Config["timespan"]; ok {
+		timespan, err := time.ParseDuration(v)
+		if err != nil || timespan <= 0 {
+			return nil, fmt.Errorf("invalid azure monitor timespan '%s'", v)
+		}
+		c.timespan = timespan
+	}
+
+	if v, ok := config.Config["grain"]; ok {
+		grain, err := time.ParseDuration(v)
+		if err != nil || grain < time.Minute || grain%time.Minute != 0 {
+			return nil, fmt.Errorf("invalid azure monitor grain '%s', must be a number of minutes", v)
+		}
+		c.grain = grain
+	}
+
+	if v, ok := config.Config["series-aggregation"]; ok {
+		if !validSeriesAggregation(v) {
+			return nil, fmt.Errorf("unsupported azure monitor series aggregation '%s'", v)
+		}
+		c.seriesAggregation = v
+	}
+
+	return c, nil
+}
+
+// AzureMonitorCollector is a metrics collector which exposes the latest
+// value of an Azure Monitor metric of a resource as external metric. The
+// latest values of metrics split by dimension filters are aggregated.
+type AzureMonitorCollector struct {
+	hpa               *autoscalingv2.HorizontalPodAutoscaler
+	resourceURI       string
+	azureMetricName   string
+	metricNamespace   string
+	filter            string
+	aggregation       string
+	timespan          time.Duration
+	grain             time.Duration
+	seriesAggregation string
+	metricName        string
+	labels            map[string]string
+	interval          time.Duration
+	httpClient        *http.Client
+}
+
+// azureMetricValue is a data point of an Azure Monitor time series. Only the
+// requested aggregation is set.
+type azureMetricValue struct {
+	TimeStamp time.Time `json:"timeStamp"`
+	Average   *float64  `json:"average"`
+	Total     *float64  `json:"total"`
+	Minimum   *float64  `json:"minimum"`
+	Maximum   *float64  `json:"maximum"`
+	Count     *float64  `json:"count"`
+}
+
+// value returns the value of the aggregation and false if it's not set.
+func (v azureMetricValue) value(aggregation string) (float64, bool) {
+	var value *float64
+	switch aggregation {
+	case "Average":
+		value = v.Average
+	case "Total":
+		value = v.Total
+	case "Minimum":
+		value = v.Minimum
+	case "Maximum":
+		value = v.Maximum
+	case "Count":
+		value = v.Count
+	}
+	if value == nil {
+		return 0, false
+	}
+	return *value, true
+}
+
+// azureMetricsResponse is the response of the metrics API.
+type azureMetricsResponse struct {
+	Value []struct {
+		Timeseries []struct {
+			Data []azureMetricValue `json:"data"`
+		} `json:"timeseries"`
+	} `json:"value"`
+}
+
+// azureDuration formats a duration of whole minutes as ISO 8601 duration.
+func azureDuration(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("PT%dH", int(d.Hours()))
+	}
+	return fmt.Sprintf("PT%dM", int(d.Minutes()))
+}
+
+// GetMetrics queries the metric of the resource and returns its latest
+// value.
+func (c *AzureMonitorCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	now := time.Now().UTC()
+	params := url.Values{}
+	params.Set("api-version", azureMonitorAPIVersion)
+	params.Set("metricnames", c.azureMetricName)
+	params.Set("aggregation", c.aggregation)
+	params.Set("timespan", now.Add(-c.timespan).Format(time.RFC3339)+"/"+now.Format(time.RFC3339))
+	params.Set("interval", azureDuration(c.grain))
+	if c.metricNamespace != "" {
+		params.Set("metricnamespace", c.metricNamespace)
+	}
+	if c.filter != "" {
+		params.Set("$filter", c.filter)
+	}
+
+	auditQuery(c.hpa, c.metricName, AzureMonitorCollectorName, c.resourceURI+": "+c.azureMetricName)
+
+	endpoint := fmt.Sprintf("%s%s/providers/Microsoft.Insights/metrics?%s", azureManagementEndpoint, c.resourceURI, params.Encode())
+	request, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var response azureMetricsResponse
+	err = doJSON(ctx, c.httpClient, request, &response)
+	if err != nil {
+		return nil, fmt.Errorf("azure monitor query failed: %v", err)
+	}
+
+	var values []float64
+	for _, metric := range response.Value {
+		for _, series := range metric.Timeseries {
+			var latest *azureMetricValue
+			for i, point := range series.Data {
+				if _, ok := point.value(c.aggregation); !ok {
+					continue
+				}
+				if latest == nil || point.TimeStamp.After(latest.TimeStamp) {
+					latest = &series.Data[i]
+				}
+			}
+			if latest != nil {
+				value, _ := latest.value(c.aggregation)
+				values = append(values, value)
+			}
+		}
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("azure monitor metric '%s' of '%s' has no values within %s", c.azureMetricName, c.resourceURI, c.timespan)
+	}
+	value := aggregateSeries(values, c.seriesAggregation)
+
+	metricValue := CollectedMetric{
+		Type: autoscalingv2.ExternalMetricSourceType,
+		External: external_metrics.ExternalMetricValue{
+			MetricName:   c.metricName,
+			MetricLabels: c.labels,
+			Timestamp:    metav1.Time{Time: time.Now().UTC()},
+		},
+	}
+	err = metricValue.setFloatValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return []CollectedMetric{metricValue}, nil
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *AzureMonitorCollector) Interval() time.Duration {
+	return c.interval
+}
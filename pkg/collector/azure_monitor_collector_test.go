@@ -0,0 +1,91 @@
+package collector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeAzureCredential returns a fixed token.
+type fakeAzureCredential struct{}
+
+func (fakeAzureCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: adapterCredential, ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+// azureMonitorBackendTest tests the Azure Monitor collector.
+var azureMonitorBackendTest = backendTest{
+	config: map[string]string{"resource-uri": "/subscriptions/1234/resourceGroups/shop/providers/Microsoft.Web/sites/api", "metric-name": "Requests"},
+	newCollector: func(t *testing.T, server *httptest.Server, _ string, config map[string]string) (Collector, error) {
+		plugin := NewAzureMonitorCollectorPlugin(fakeAzureCredential{})
+		c, err := plugin.NewCollector(
+			&autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default"}},
+			&MetricConfig{
+				MetricTypeName: MetricTypeName{Type: autoscalingv2.ExternalMetricSourceType, Name: "requests"},
+				Config:         config,
+			},
+			time.Minute,
+		)
+		if err != nil {
+			return nil, err
+		}
+		c.(*AzureMonitorCollector).httpClient.Transport.(*azureAuthRoundTripper).next = serverClient(t, server).Transport
+		return c, nil
+	},
+	credential: func(r *http.Request) string {
+		return r.Header.Get("Authorization")
+	},
+	checkRequest: func(t *testing.T, r *http.Request, config map[string]string) {
+		if r.URL.Path != config["resource-uri"]+"/providers/Microsoft.Insights/metrics" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+	},
+}
+
+func TestAzureMonitorCollectorCredentials(t *testing.T) {
+	azureMonitorBackendTest.testCredentials(t, []backendCredentialTestCase{
+		{
+			msg:        "resource of a subscription",
+			target:     "management.azure.com",
+			credential: "Bearer " + adapterCredential,
+		},
+		{
+			msg:    "resource uri of another host",
+			config: map[string]string{"resource-uri": "https://attacker.example.org/subscriptions/1234"},
+			err:    true,
+		},
+		{
+			msg:    "resource uri without a host",
+			config: map[string]string{"resource-uri": "//attacker.example.org/subscriptions/1234"},
+			err:    true,
+		},
+	})
+}
+
+func TestAzureMonitorCollector(t *testing.T) {
+	azureMonitorBackendTest.testValues(t, []backendValueTestCase{
+		{
+			msg:      "latest value",
+			body:     `{"value":[{"timeseries":[{"data":[{"timeStamp":"2021-01-01T00:01:00Z","average":2.5},{"timeStamp":"2021-01-01T00:00:00Z","average":1},{"timeStamp":"2021-01-01T00:02:00Z"}]}]}]}`,
+			expected: 2500,
+		},
+		{
+			msg:      "aggregation of series",
+			config:   map[string]string{"aggregation": "Total"},
+			body:     `{"value":[{"timeseries":[{"data":[{"timeStamp":"2021-01-01T00:00:00Z","total":1}]},{"data":[{"timeStamp":"2021-01-01T00:00:00Z","total":5}]}]}]}`,
+			expected: 3000,
+		},
+		{
+			msg:  "no values",
+			body: `{"value":[{"timeseries":[{"data":[{"timeStamp":"2021-01-01T00:00:00Z"}]}]}]}`,
+			err:  true,
+		},
+	})
+}
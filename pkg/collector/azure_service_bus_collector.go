@@ -0,0 +1,265 @@
+package collector
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+)
+
+const (
+	// AzureServiceBusCollectorName is the name of the Azure Service Bus
+	// collector.
+	AzureServiceBusCollectorName = "azure-servicebus"
+
+	azureServiceBusScope      = "https://servicebus.azure.net/.default"
+	azureServiceBusAPIVersion = "2021-05"
+	azureServiceBusDomain     = ".servicebus.windows.net"
+	// azureServiceBusSASExpiry is the validity of the shared access
+	// signatures of the requests.
+	azureServiceBusSASExpiry = 5 * time.Minute
+)
+
+// azureServiceBusNamespacePattern matches the names of Service Bus
+// namespaces.
+var azureServiceBusNamespacePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9-]{0,48}[a-zA-Z0-9]$`)
+
+// AzureServiceBusCollectorPlugin is a collector plugin for initializing
+// collectors which expose the number of active messages of Azure Service
+// Bus queues and topic subscriptions.
+type AzureServiceBusCollectorPlugin struct {
+	credential azcore.TokenCredential
+}
+
+// NewAzureServiceBusCollectorPlugin initializes a new
+// AzureServiceBusCollectorPlugin. The credential is used for metrics which
+// don't define a connection string.
+func NewAzureServiceBusCollectorPlugin(credential azcore.TokenCredential) *AzureServiceBusCollectorPlugin {
+	return &AzureServiceBusCollectorPlugin{
+		credential: credential,
+	}
+}
+
+// azureServiceBusConnection is a parsed Service Bus connection string.
+type azureServiceBusConnection struct {
+	host    string
+	keyName string
+	key     string
+}
+
+// parseAzureServiceBusConnectionString parses a connection string of the
+// form Endpoint=sb://<namespace>.servicebus.windows.net/;
+// SharedAccessKeyName=<name>;SharedAccessKey=<key>.
+func parseAzureServiceBusConnectionString(value string) (*azureServiceBusConnection, error) {
+	connection := &azureServiceBusConnection{}
+	for _, part := range strings.Split(value, ";") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		switch kv[0] {
+		case "Endpoint":
+			endpoint, err := url.Parse(kv[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid service bus endpoint: %v", err)
+			}
+			connection.host = endpoint.Host
+		case "SharedAccessKeyName":
+			connection.keyName = kv[1]
+		case "SharedAccessKey":
+			connection.key = kv[1]
+		}
+	}
+
+	if connection.host == "" || connection.keyName == "" || connection.key == "" {
+		return nil, fmt.Errorf("invalid service bus connection string, must contain Endpoint, SharedAccessKeyName and SharedAccessKey")
+	}
+	return connection, nil
+}
+
+// NewCollector initializes a new Azure Service Bus collector from the
+// specified HPA.
+func (p *AzureServiceBusCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	if config.Type != autoscalingv2.ExternalMetricSourceType {
+		return nil, fmt.Errorf("azure-servicebus collector only supports external metrics")
+	}
+
+	var entity string
+	queueName, hasQueue := config.Config["queue-name"]
+	topicName, hasTopic := config.Config["topic-name"]
+	switch {
+	case hasQueue && !hasTopic:
+		entity = url.PathEscape(queueName)
+	case hasTopic && !hasQueue:
+		subscriptionName, ok := config.Config["subscription-name"]
+		if !ok {
+			return nil, fmt.Errorf("no service bus subscription name defined for topic '%s'", topicName)
+		}
+		entity = url.PathEscape(topicName) + "/Subscriptions/" + url.PathEscape(subscriptionName)
+	default:
+		return nil, fmt.Errorf("either a service bus queue name or a topic name must be defined")
+	}
+
+	c := &AzureServiceBusCollector{
+		hpa:        hpa,
+		entity:     entity,
+		metricName: config.Name,
+		labels:     config.Labels,
+		interval:   interval,
+	}
+
+	transport := http.RoundTripper(&http.Transport{})
+	if v, ok := config.Config["connection-string"]; ok {
+		connection, err := parseAzureServiceBusConnectionString(v)
+		if err != nil {
+			return nil, err
+		}
+		c.host = connection.host
+		c.connection = connection
+	} else {
+		if p.credential == nil {
+			return nil, fmt.Errorf("service bus connection string must be defined")
+		}
+		transport = &azureAuthRoundTripper{
+			credential: p.credential,
+			scope:      azureServiceBusScope,
+			next:       transport,
+		}
+	}
+
+	// the namespace is the host the credentials are sent to, so it must be
+	// a namespace of service bus.
+	if v, ok := config.Config["namespace"]; ok {
+		if !azureServiceBusNamespacePattern.MatchString(strings.TrimSuffix(v, azureServiceBusDomain)) {
+			return nil, fmt.Errorf("invalid service bus namespace '%s'", v)
+		}
+		c.host = strings.TrimSuffix(v, azureServiceBusDomain) + azureServiceBusDomain
+	}
+	if c.host == "" {
+		return nil, fmt.Errorf("no service bus namespace defined")
+	}
+
+	c.httpClient = &http.Client{
+		Timeout:   15 * time.Second,
+		Transport: transport,
+	}
+
+	return c, nil
+}
+
+// AzureServiceBusCollector is a metrics collector which exposes the number
+// of active messages of a Service Bus queue or topic subscription as
+// external metric.
+type AzureServiceBusCollector struct {
+	hpa        *autoscalingv2.HorizontalPodAutoscaler
+	host       string
+	entity     string
+	connection *azureServiceBusConnection
+	metricName string
+	labels     map[string]string
+	interval   time.Duration
+	httpClient *http.Client
+}
+
+// azureServiceBusCountDetails are the message counts of a queue or
+// subscription.
+type azureServiceBusCountDetails struct {
+	ActiveMessageCount *int64 `xml:"ActiveMessageCount"`
+}
+
+// azureServiceBusEntry is the Atom entry describing a queue or
+// subscription. Entities which don't exist are returned as empty feed.
+type azureServiceBusEntry struct {
+	Content struct {
+		Queue *struct {
+			CountDetails azureServiceBusCountDetails `xml:"CountDetails"`
+		} `xml:"QueueDescription"`
+		Subscription *struct {
+			CountDetails azureServiceBusCountDetails `xml:"CountDetails"`
+		} `xml:"SubscriptionDescription"`
+	} `xml:"content"`
+}
+
+// sasToken returns a shared access signature of the resource.
+func (c *AzureServiceBusCollector) sasToken(resourceURI string) string {
+	sr := url.QueryEscape(strings.ToLower(resourceURI))
+	expiry := strconv.FormatInt(time.Now().Add(azureServiceBusSASExpiry).Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(c.connection.key))
+	mac.Write([]byte(sr + "\n" + expiry))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	return fmt.Sprintf("SharedAccessSignature sr=%s&sig=%s&se=%s&skn=%s", sr, url.QueryEscape(signature), expiry, url.QueryEscape(c.connection.keyName))
+}
+
+// GetMetrics gets the description of the queue or subscription and returns
+// its number of active messages.
+func (c *AzureServiceBusCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	resourceURI := fmt.Sprintf("https://%s/%s", c.host, c.entity)
+
+	auditQuery(c.hpa, c.metricName, AzureServiceBusCollectorName, resourceURI)
+
+	request, err := http.NewRequest(http.MethodGet, resourceURI+"?api-version="+azureServiceBusAPIVersion, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.connection != nil {
+		request.Header.Set("Authorization", c.sasToken(resourceURI))
+	}
+
+	data, err := doRequest(ctx, c.httpClient, request)
+	if err != nil {
+		return nil, fmt.Errorf("service bus request failed: %v", err)
+	}
+
+	var entry azureServiceBusEntry
+	err = xml.Unmarshal(data, &entry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service bus response: %v", err)
+	}
+
+	var count *int64
+	switch {
+	case entry.Content.Queue != nil:
+		count = entry.Content.Queue.CountDetails.ActiveMessageCount
+	case entry.Content.Subscription != nil:
+		count = entry.Content.Subscription.CountDetails.ActiveMessageCount
+	default:
+		return nil, fmt.Errorf("service bus entity '%s' not found", resourceURI)
+	}
+	if count == nil {
+		return nil, fmt.Errorf("service bus entity '%s' has no active message count", resourceURI)
+	}
+
+	metricValue := CollectedMetric{
+		Type: autoscalingv2.ExternalMetricSourceType,
+		External: external_metrics.ExternalMetricValue{
+			MetricName:   c.metricName,
+			MetricLabels: c.labels,
+			Timestamp:    metav1.Time{Time: time.Now().UTC()},
+			Value:        *resource.NewQuantity(*count, resource.DecimalSI),
+		},
+	}
+
+	return []CollectedMetric{metricValue}, nil
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *AzureServiceBusCollector) Interval() time.Duration {
+	return c.interval
+}
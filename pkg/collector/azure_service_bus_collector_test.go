@@ -0,0 +1,132 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// azureServiceBusBackendTest tests the Azure Service Bus collector. The
+// credential of requests authenticated with a shared access signature is
+// the name of the signing key.
+var azureServiceBusBackendTest = backendTest{
+	config: map[string]string{"queue-name": "orders"},
+	newCollector: func(t *testing.T, server *httptest.Server, _ string, config map[string]string) (Collector, error) {
+		plugin := NewAzureServiceBusCollectorPlugin(fakeAzureCredential{})
+		c, err := plugin.NewCollector(
+			&autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default"}},
+			&MetricConfig{
+				MetricTypeName: MetricTypeName{Type: autoscalingv2.ExternalMetricSourceType, Name: "messages"},
+				Config:         config,
+			},
+			time.Minute,
+		)
+		if err != nil {
+			return nil, err
+		}
+		httpClient := c.(*AzureServiceBusCollector).httpClient
+		if auth, ok := httpClient.Transport.(*azureAuthRoundTripper); ok {
+			auth.next = serverClient(t, server).Transport
+		} else {
+			httpClient.Transport = serverClient(t, server).Transport
+		}
+		return c, nil
+	},
+	credential: func(r *http.Request) string {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "SharedAccessSignature ") {
+			return auth
+		}
+		signature, _ := url.ParseQuery(strings.TrimPrefix(auth, "SharedAccessSignature "))
+		return "SharedAccessSignature " + signature.Get("skn")
+	},
+	checkRequest: func(t *testing.T, r *http.Request, config map[string]string) {
+		path := "/" + config["queue-name"]
+		if topic, ok := config["topic-name"]; ok {
+			path = "/" + topic + "/Subscriptions/" + config["subscription-name"]
+		}
+		if r.URL.Path != path {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+	},
+}
+
+func TestAzureServiceBusCollectorCredentials(t *testing.T) {
+	connectionString := "Endpoint=sb://shop.servicebus.windows.net/;SharedAccessKeyName=listen;SharedAccessKey=c2VjcmV0"
+
+	azureServiceBusBackendTest.testCredentials(t, []backendCredentialTestCase{
+		{
+			msg:        "namespace name",
+			config:     map[string]string{"namespace": "shop"},
+			target:     "shop.servicebus.windows.net",
+			credential: "Bearer " + adapterCredential,
+		},
+		{
+			msg:        "namespace host",
+			config:     map[string]string{"namespace": "shop.servicebus.windows.net"},
+			target:     "shop.servicebus.windows.net",
+			credential: "Bearer " + adapterCredential,
+		},
+		{
+			msg:        "namespace of the connection string",
+			config:     map[string]string{"connection-string": connectionString},
+			target:     "shop.servicebus.windows.net",
+			credential: "SharedAccessSignature listen",
+		},
+		{
+			msg:        "namespace override with a connection string",
+			config:     map[string]string{"namespace": "team-a", "connection-string": connectionString},
+			target:     "team-a.servicebus.windows.net",
+			credential: "SharedAccessSignature listen",
+		},
+		{
+			msg:    "no namespace",
+			config: map[string]string{},
+			err:    true,
+		},
+		{
+			msg:    "other host",
+			config: map[string]string{"namespace": "attacker.example.org"},
+			err:    true,
+		},
+		{
+			msg:    "other host with service bus suffix",
+			config: map[string]string{"namespace": "attacker.example.org/#.servicebus.windows.net"},
+			err:    true,
+		},
+		{
+			msg:    "other host with a connection string",
+			config: map[string]string{"namespace": "attacker.example.org", "connection-string": connectionString},
+			err:    true,
+		},
+	})
+}
+
+func TestAzureServiceBusCollector(t *testing.T) {
+	azureServiceBusBackendTest.testValues(t, []backendValueTestCase{
+		{
+			msg:      "active messages of a queue",
+			config:   map[string]string{"namespace": "shop"},
+			body:     `<entry xmlns="http://www.w3.org/2005/Atom"><content type="application/xml"><QueueDescription xmlns="http://schemas.microsoft.com/netservices/2010/10/servicebus/connect"><CountDetails><d2p1:ActiveMessageCount xmlns:d2p1="http://schemas.microsoft.com/netservices/2011/06/servicebus">17</d2p1:ActiveMessageCount></CountDetails></QueueDescription></content></entry>`,
+			expected: 17000,
+		},
+		{
+			msg:      "active messages of a subscription",
+			config:   map[string]string{"namespace": "shop", "queue-name": "", "topic-name": "events", "subscription-name": "billing"},
+			body:     `<entry xmlns="http://www.w3.org/2005/Atom"><content type="application/xml"><SubscriptionDescription xmlns="http://schemas.microsoft.com/netservices/2010/10/servicebus/connect"><CountDetails><d2p1:ActiveMessageCount xmlns:d2p1="http://schemas.microsoft.com/netservices/2011/06/servicebus">4</d2p1:ActiveMessageCount></CountDetails></SubscriptionDescription></content></entry>`,
+			expected: 4000,
+		},
+		{
+			msg:    "unknown queue",
+			config: map[string]string{"namespace": "shop"},
+			body:   `<feed xmlns="http://www.w3.org/2005/Atom"><title type="text">Publicly Listed Services</title></feed>`,
+			err:    true,
+		},
+	})
+}
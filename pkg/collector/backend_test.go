@@ -0,0 +1,193 @@
+package collector
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// adapterCredential is the credential of the adapter in backend tests,
+// read from the file returned by adapterCredentialFile.
+const adapterCredential = "adapter-secret"
+
+// adapterCredentialFile returns a file containing the credential of the
+// adapter.
+func adapterCredentialFile(t *testing.T) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "credential")
+	err := ioutil.WriteFile(file, []byte(adapterCredential+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// backendTest tests a collector querying a metric backend over HTTP. All
+// requests of the collector are sent to a test server, the hosts the
+// collector queries are told apart by the Host header of the requests.
+type backendTest struct {
+	// adapter is the backend of the adapter used for the value tests,
+	// e.g. its site, environment or project.
+	adapter string
+	// config is the metric config of all test cases, extended by the
+	// config of each case, see metricConfig.
+	config map[string]string
+	// newCollector creates the collector of the config for the backend
+	// of the adapter. The collector must send its requests to the
+	// server, e.g. with the client returned by serverClient.
+	newCollector func(t *testing.T, server *httptest.Server, adapter string, config map[string]string) (Collector, error)
+	// target returns the backend a request queries. Defaults to the host
+	// of the request.
+	target func(r *http.Request) string
+	// credential returns the credential a request is authenticated with.
+	credential func(r *http.Request) string
+	// checkRequest checks the requests of the value tests, if set.
+	checkRequest func(t *testing.T, r *http.Request, config map[string]string)
+	// serve serves requests other than the queries of the collector, e.g.
+	// token requests, if set. Returns false for queries.
+	serve func(w http.ResponseWriter, r *http.Request) bool
+}
+
+// backendValueTestCase is a test case of the value a collector gets from
+// the response of its backend. Cases expecting an error pass if the config
+// is rejected or getting the value fails.
+type backendValueTestCase struct {
+	msg      string
+	config   map[string]string
+	body     string
+	expected int64
+	err      bool
+}
+
+// backendCredentialTestCase is a test case of the backend a collector
+// queries and of the credential it sends, e.g. for configs overriding the
+// backend of the adapter.
+type backendCredentialTestCase struct {
+	msg        string
+	adapter    string
+	config     map[string]string
+	target     string
+	credential string
+	err        bool
+}
+
+// newServer starts a test server answering the queries of the collector
+// with the body. handle is called for each query.
+func (b backendTest) newServer(t *testing.T, body string, handle func(r *http.Request)) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if b.serve != nil && b.serve(w, r) {
+			return
+		}
+		handle(r)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// metricConfig returns the config of the test extended by the config of a
+// test case. Keys set to an empty value by the test case are removed.
+func (b backendTest) metricConfig(config map[string]string) map[string]string {
+	merged := make(map[string]string, len(b.config)+len(config))
+	for k, v := range b.config {
+		merged[k] = v
+	}
+	for k, v := range config {
+		if v == "" {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+// testValues tests the values the collector gets from the responses of
+// its backend, as milli values.
+func (b backendTest) testValues(t *testing.T, cases []backendValueTestCase) {
+	for _, tc := range cases {
+		t.Run(tc.msg, func(t *testing.T) {
+			config := b.metricConfig(tc.config)
+			server := b.newServer(t, tc.body, func(r *http.Request) {
+				if b.checkRequest != nil {
+					b.checkRequest(t, r, config)
+				}
+			})
+
+			c, err := b.newCollector(t, server, b.adapter, config)
+			if err != nil {
+				if tc.err {
+					return
+				}
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			metrics, err := c.GetMetrics(context.Background())
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error, got %v", metrics)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(metrics) != 1 || metrics[0].External.Value.MilliValue() != tc.expected {
+				t.Errorf("expected value %dm, got %v", tc.expected, metrics)
+			}
+		})
+	}
+}
+
+// testCredentials tests which backend the collector queries with which
+// credential, and that configs which would send the credential of the
+// adapter to another backend are rejected.
+func (b backendTest) testCredentials(t *testing.T, cases []backendCredentialTestCase) {
+	for _, tc := range cases {
+		t.Run(tc.msg, func(t *testing.T) {
+			var mutex sync.Mutex
+			queries := 0
+			server := b.newServer(t, "{}", func(r *http.Request) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				queries++
+
+				target := r.Host
+				if b.target != nil {
+					target = b.target(r)
+				}
+				if target != tc.target {
+					t.Errorf("expected query of '%s', got query of '%s'", tc.target, target)
+				}
+				if credential := b.credential(r); credential != tc.credential {
+					t.Errorf("expected credential '%s', got '%s'", tc.credential, credential)
+				}
+			})
+
+			c, err := b.newCollector(t, server, tc.adapter, b.metricConfig(tc.config))
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// the response isn't a valid result, only the query is
+			// checked.
+			_, _ = c.GetMetrics(context.Background())
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if queries == 0 {
+				t.Error("expected a query of the backend")
+			}
+		})
+	}
+}
@@ -1,23 +1,76 @@
 package collector
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
+	"github.com/golang/glog"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/metrics/pkg/apis/custom_metrics"
 	"k8s.io/metrics/pkg/apis/external_metrics"
 )
 
 const (
-	customMetricsPrefix      = "metric-config."
-	perReplicaMetricsConfKey = "per-replica"
-	intervalMetricsConfKey   = "interval"
+	customMetricsPrefix        = "metric-config."
+	perReplicaMetricsConfKey   = "per-replica"
+	intervalMetricsConfKey     = "interval"
+	transformMetricsConfKey    = "transform"
+	targetNamespaceConfKey     = "target-namespace"
+	replicaConversionConfKey   = "replica-conversion"
+	dedupEpsilonConfKey        = "dedup-epsilon"
+	utilizationConfKey         = "utilization"
+	partialResponseConfKey     = "partial-response-policy"
+	clampReplicasConfKey       = "clamp-replicas"
+	staleIntervalsConfKey      = "stale-intervals"
+	staleDecayConfKey          = "stale-decay"
+	activationConfKey          = "activation"
+	activationThresholdConfKey = "activation-threshold"
+	ttlConfKey                 = "ttl"
+	smoothingWindowConfKey     = "smoothing-window"
+	smoothingFunctionConfKey   = "smoothing-function"
+	percentileConfKey          = "percentile"
+	interpolationConfKey       = "interpolation"
+	counterConfKey             = "counter"
+	staleBehaviorConfKey       = "stale-behavior"
+	staleValueConfKey          = "stale-value"
+	timeoutConfKey             = "timeout"
+	pauseConfKey               = "pause"
+	warmUpConfKey              = "warm-up"
 )
 
+// Functions aggregating the samples within the smoothing window of a metric.
+const (
+	SmoothingFunctionAvg = "avg"
+	SmoothingFunctionMin = "min"
+	SmoothingFunctionMax = "max"
+	SmoothingFunctionP95 = "p95"
+)
+
+// ContainerLabel is the label identifying the container of the values
+// collected for ContainerResource metrics.
+const ContainerLabel = "kube-metrics-adapter/container"
+
+// ContainerResources are the resources of the resource metrics API
+// (metrics.k8s.io) which ContainerResource metrics can be collected for.
+var ContainerResources = []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory}
+
+// InterpolationLinear fills in a missed collection by linear extrapolation
+// of the trend of the previous two values.
+const InterpolationLinear = "linear"
+
 type ObjectReference struct {
-	autoscalingv2beta1.CrossVersionObjectReference
+	autoscalingv2.CrossVersionObjectReference
 	Namespace string
 }
 
@@ -25,6 +78,15 @@ type CollectorFactory struct {
 	podsPlugins     pluginMap
 	objectPlugins   objectPluginMap
 	externalPlugins map[string]CollectorPlugin
+	client          kubernetes.Interface
+	dynamicClient   dynamic.Interface
+	recorder        record.EventRecorder
+	queryPolicy     *QueryPolicy
+	// disabled are the names of the collectors which are disabled by the
+	// plugin config. pluginsLock guards the plugins and disabled, which
+	// can change at runtime.
+	disabled    map[string]bool
+	pluginsLock sync.RWMutex
 }
 
 type objectPluginMap struct {
@@ -37,7 +99,7 @@ type pluginMap struct {
 	Named map[string]CollectorPlugin
 }
 
-func NewCollectorFactory() *CollectorFactory {
+func NewCollectorFactory(client kubernetes.Interface, recorder record.EventRecorder) *CollectorFactory {
 	return &CollectorFactory{
 		podsPlugins: pluginMap{Named: map[string]CollectorPlugin{}},
 		objectPlugins: objectPluginMap{
@@ -45,14 +107,19 @@ func NewCollectorFactory() *CollectorFactory {
 			Named: map[string]*pluginMap{},
 		},
 		externalPlugins: map[string]CollectorPlugin{},
+		client:          client,
+		recorder:        recorder,
 	}
 }
 
 type CollectorPlugin interface {
-	NewCollector(hpa *autoscalingv2beta1.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error)
+	NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error)
 }
 
 func (c *CollectorFactory) RegisterPodsCollector(metricCollector string, plugin CollectorPlugin) error {
+	c.pluginsLock.Lock()
+	defer c.pluginsLock.Unlock()
+
 	if metricCollector == "" {
 		c.podsPlugins.Any = plugin
 	} else {
@@ -63,6 +130,9 @@ func (c *CollectorFactory) RegisterPodsCollector(metricCollector string, plugin
 }
 
 func (c *CollectorFactory) RegisterObjectCollector(kind, metricCollector string, plugin CollectorPlugin) error {
+	c.pluginsLock.Lock()
+	defer c.pluginsLock.Unlock()
+
 	if kind == "" {
 		if metricCollector == "" {
 			c.objectPlugins.Any.Any = plugin
@@ -101,60 +171,178 @@ func (c *CollectorFactory) RegisterObjectCollector(kind, metricCollector string,
 }
 
 func (c *CollectorFactory) RegisterExternalCollector(metrics []string, plugin CollectorPlugin) {
+	c.pluginsLock.Lock()
+	defer c.pluginsLock.Unlock()
+
 	for _, metric := range metrics {
 		c.externalPlugins[metric] = plugin
 	}
 }
 
-func (c *CollectorFactory) NewCollector(hpa *autoscalingv2beta1.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+// NewCollector initializes a new collector for the metric config from a
+// registered plugin. Generic metric options like transformations are applied
+// on top of the collector returned by the plugin.
+func (c *CollectorFactory) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	resolved, err := c.resolveConfigRef(hpa, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// the interval of a referenced ScalingMetricConfig is used unless
+	// an interval is defined in the annotations.
+	if config.Interval == 0 && resolved.Interval != 0 {
+		interval = resolved.Interval
+	}
+	config = resolved
+
+	// ContainerResource metrics are collected per pod like Pods metrics.
+	container := config.Container
+	if config.Type == autoscalingv2.ContainerResourceMetricSourceType {
+		podsConfig := *config
+		podsConfig.Type = autoscalingv2.PodsMetricSourceType
+		config = &podsConfig
+	}
+
+	collector, err := c.newPluginCollector(hpa, config, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	if container != "" {
+		collector = NewContainerResourceCollector(collector, container)
+	}
+
+	collector = NewRateLimitedCollector(collector, config)
+
+	if config.MetricSelector != nil && config.Type != autoscalingv2.ExternalMetricSourceType {
+		collector = NewMetricSelectorCollector(collector, config.MetricSelector)
+	}
+
+	if config.Counter != "" {
+		collector, err = NewCounterCollector(collector, config.Counter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.ReplicaConversion != "" {
+		collector, err = NewReplicaConversionCollector(c.client, collector, hpa, config.ReplicaConversion, config.ClampReplicas)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.Transform != "" {
+		collector, err = NewTransformCollector(collector, config.Transform, hpa, c.recorder)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.Utilization {
+		if config.Target == nil || config.Target.IsZero() {
+			glog.Warningf("Not publishing utilization for metric '%s' of HPA %s/%s, no target value defined", config.Name, hpa.Namespace, hpa.Name)
+		} else {
+			collector = NewUtilizationCollector(collector, *config.Target)
+		}
+	}
+
+	if config.Activation {
+		collector = NewActivationCollector(collector, config)
+	}
+
+	// the values are withheld after all other wrappers, such that
+	// stateful wrappers like counters see the samples of the warm-up.
+	if config.WarmUp > 0 {
+		collector = NewWarmUpCollector(collector, config)
+	}
+
+	return collector, nil
+}
+
+// newPluginCollector initializes a new collector from the plugin registered
+// for the metric config.
+func (c *CollectorFactory) newPluginCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	plugin, err := c.lookupPlugin(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// the query policy is applied to the config of each plugin collector,
+	// such that it also covers the sources of e.g. a cross check.
+	applied := *config
+	err = c.applyQueryPolicy(hpa, &applied)
+	if err != nil {
+		return nil, err
+	}
+	return plugin.NewCollector(hpa, &applied, interval)
+}
+
+// lookupPlugin returns the plugin registered for the metric config. The
+// plugin is looked up under the read lock only, as plugins like the fallback
+// collector initialize collectors of the factory themselves.
+func (c *CollectorFactory) lookupPlugin(config *MetricConfig) (CollectorPlugin, error) {
+	c.pluginsLock.RLock()
+	defer c.pluginsLock.RUnlock()
+
+	if c.disabled[backendName(config)] {
+		return nil, fmt.Errorf("collector %s of %s is disabled", backendName(config), config.MetricTypeName)
+	}
+
 	switch config.Type {
-	case autoscalingv2beta1.PodsMetricSourceType:
+	case autoscalingv2.PodsMetricSourceType:
 		// first try to find a plugin by format
 		if plugin, ok := c.podsPlugins.Named[config.CollectorName]; ok {
-			return plugin.NewCollector(hpa, config, interval)
+			return plugin, nil
 		}
 
 		// else try to use the default plugin if set
 		if c.podsPlugins.Any != nil {
-			return c.podsPlugins.Any.NewCollector(hpa, config, interval)
+			return c.podsPlugins.Any, nil
 		}
-	case autoscalingv2beta1.ObjectMetricSourceType:
+	case autoscalingv2.ObjectMetricSourceType:
 		// first try to find a plugin by kind
 		if kinds, ok := c.objectPlugins.Named[config.ObjectReference.Kind]; ok {
 			if plugin, ok := kinds.Named[config.CollectorName]; ok {
-				return plugin.NewCollector(hpa, config, interval)
+				return plugin, nil
 			}
 
 			if kinds.Any != nil {
-				return kinds.Any.NewCollector(hpa, config, interval)
+				return kinds.Any, nil
 			}
 			break
 		}
 
 		// else try to find a default plugin for this kind
 		if plugin, ok := c.objectPlugins.Any.Named[config.CollectorName]; ok {
-			return plugin.NewCollector(hpa, config, interval)
+			return plugin, nil
 		}
 
 		if c.objectPlugins.Any.Any != nil {
-			return c.objectPlugins.Any.Any.NewCollector(hpa, config, interval)
+			return c.objectPlugins.Any.Any, nil
 		}
-	case autoscalingv2beta1.ExternalMetricSourceType:
+	case autoscalingv2.ExternalMetricSourceType:
+		// first try to find a plugin by the collector name defined in
+		// the annotations.
+		if plugin, ok := c.externalPlugins[config.CollectorName]; ok {
+			return plugin, nil
+		}
+
 		if plugin, ok := c.externalPlugins[config.Name]; ok {
-			return plugin.NewCollector(hpa, config, interval)
+			return plugin, nil
 		}
 	}
 
 	return nil, fmt.Errorf("no plugin found for %s", config.MetricTypeName)
 }
 
-func getObjectReference(hpa *autoscalingv2beta1.HorizontalPodAutoscaler, metricName string) (custom_metrics.ObjectReference, error) {
+func getObjectReference(hpa *autoscalingv2.HorizontalPodAutoscaler, metricName string) (custom_metrics.ObjectReference, error) {
 	for _, metric := range hpa.Spec.Metrics {
-		if metric.Type == autoscalingv2beta1.ObjectMetricSourceType && metric.Object.MetricName == metricName {
+		if metric.Type == autoscalingv2.ObjectMetricSourceType && metric.Object.Metric.Name == metricName {
 			return custom_metrics.ObjectReference{
-				APIVersion: metric.Object.Target.APIVersion,
-				Kind:       metric.Object.Target.Kind,
-				Name:       metric.Object.Target.Name,
+				APIVersion: metric.Object.DescribedObject.APIVersion,
+				Kind:       metric.Object.DescribedObject.Kind,
+				Name:       metric.Object.DescribedObject.Name,
 				Namespace:  hpa.Namespace,
 			}, nil
 		}
@@ -164,19 +352,73 @@ func getObjectReference(hpa *autoscalingv2beta1.HorizontalPodAutoscaler, metricN
 }
 
 type MetricTypeName struct {
-	Type autoscalingv2beta1.MetricSourceType
+	Type autoscalingv2.MetricSourceType
 	Name string
 }
 
 type CollectedMetric struct {
-	Type     autoscalingv2beta1.MetricSourceType
+	Type     autoscalingv2.MetricSourceType
 	Custom   custom_metrics.MetricValue
 	External external_metrics.ExternalMetricValue
 	Labels   map[string]string
 }
 
+// floatValue returns the value of the collected metric as a float64.
+func (m CollectedMetric) floatValue() float64 {
+	if m.Type == autoscalingv2.ExternalMetricSourceType {
+		return float64(m.External.Value.MilliValue()) / 1000
+	}
+	return float64(m.Custom.Value.MilliValue()) / 1000
+}
+
+// timestamp returns the time the value of the collected metric was
+// collected at.
+func (m CollectedMetric) timestamp() time.Time {
+	if m.Type == autoscalingv2.ExternalMetricSourceType {
+		return m.External.Timestamp.Time
+	}
+	return m.Custom.Timestamp.Time
+}
+
+// setFloatValue sets the value of the collected metric. It fails if the
+// value can't be represented as quantity.
+func (m *CollectedMetric) setFloatValue(value float64) error {
+	milli, err := milliValue(value)
+	if err != nil {
+		return err
+	}
+
+	quantity := *resource.NewMilliQuantity(milli, resource.DecimalSI)
+	if m.Type == autoscalingv2.ExternalMetricSourceType {
+		m.External.Value = quantity
+		return nil
+	}
+	m.Custom.Value = quantity
+	return nil
+}
+
+// milliValue converts the value to milli units rounded to the nearest
+// integer. NaN and values outside of the int64 range are rejected.
+func milliValue(value float64) (int64, error) {
+	milli := math.Round(value * 1000)
+	if math.IsNaN(milli) || milli >= math.MaxInt64 || milli < math.MinInt64 {
+		return 0, fmt.Errorf("value %v can't be represented as quantity", value)
+	}
+	return int64(milli), nil
+}
+
+// metricLabels returns the labels identifying the collected metric series.
+func (m CollectedMetric) metricLabels() map[string]string {
+	if m.Type == autoscalingv2.ExternalMetricSourceType {
+		return m.External.MetricLabels
+	}
+	return m.Labels
+}
+
+// Collector collects metric values. GetMetrics should return once the
+// context is done, which has the collection timeout as deadline.
 type Collector interface {
-	GetMetrics() ([]CollectedMetric, error)
+	GetMetrics(ctx context.Context) ([]CollectedMetric, error)
 	Interval() time.Duration
 }
 
@@ -188,6 +430,76 @@ type MetricConfig struct {
 	PerReplica      bool
 	Interval        time.Duration
 	Labels          map[string]string
+	Transform       string
+	// TargetNamespace is the namespace of the object described by an
+	// Object metric. It defaults to the namespace of the HPA.
+	TargetNamespace string
+	// Container is the container of a ContainerResource metric.
+	Container string
+	// ReplicaConversion defines if collected values are multiplied or
+	// divided by the current replica count of the scale target.
+	ReplicaConversion string
+	// Deduplicate enables keeping the stored value when a newly collected
+	// value differs by no more than DeduplicationEpsilon.
+	Deduplicate          bool
+	DeduplicationEpsilon float64
+	// Utilization enables publishing the ratio of the collected value to
+	// the Target defined in the HPA as a companion metric.
+	Utilization bool
+	Target      *resource.Quantity
+	// PartialResponsePolicy defines how partial responses from the
+	// backend are handled, see PartialResponsePolicyUsePartial,
+	// PartialResponsePolicyServeLast and PartialResponsePolicyError.
+	PartialResponsePolicy string
+	// ClampReplicas clamps the replica count used for per replica
+	// calculations to the minReplicas and maxReplicas of the HPA.
+	ClampReplicas bool
+	// StaleIntervals is the number of collection intervals the last
+	// value is served for when collection fails. StaleDecay is the
+	// fraction the served value is reduced by for each missed interval.
+	StaleIntervals int
+	StaleDecay     float64
+	// Activation enables publishing an external companion metric which
+	// is 1 if any collected value is above the ActivationThreshold and 0
+	// otherwise.
+	Activation          bool
+	ActivationThreshold float64
+	// TTL is the time collected values are served for after they were
+	// collected. The default TTL of the metric store is used if 0.
+	TTL time.Duration
+	// SmoothingWindow enables serving the aggregation of the values
+	// collected within the window instead of the last value.
+	// SmoothingFunction is the aggregation, avg if empty.
+	SmoothingWindow   time.Duration
+	SmoothingFunction string
+	// MetricSelector is the selector of the metric identifier in the
+	// HPA. It's set on collected custom metric values such that they can
+	// be filtered by the metric label selector of requests.
+	MetricSelector *metav1.LabelSelector
+	// Percentile is the percentile of the distribution served for
+	// metrics collected as histograms. The collector defaults to the
+	// 99th percentile if 0.
+	Percentile float64
+	// Interpolation fills in a single missed collection from the trend
+	// of the previous values, see InterpolationLinear.
+	Interpolation string
+	// Counter converts collected counters into their rate or delta, see
+	// CounterRate and CounterDelta.
+	Counter string
+	// StaleBehavior defines the values served while the collector is
+	// failing, see StaleBehaviorHold, StaleBehaviorZero and
+	// StaleBehaviorValue. StaleValue is the value served with
+	// StaleBehaviorValue.
+	StaleBehavior string
+	StaleValue    float64
+	// Timeout is the time after which a collection is canceled. The
+	// collector interval is used if 0.
+	Timeout time.Duration
+	// Paused stops the collection of the metric.
+	Paused bool
+	// WarmUp is the number of successful collections whose values are
+	// withheld after the collector is started.
+	WarmUp int
 }
 
 func parseCustomMetricsAnnotations(annotations map[string]string) (map[MetricTypeName]*MetricConfig, error) {
@@ -215,9 +527,13 @@ func parseCustomMetricsAnnotations(annotations map[string]string) (map[MetricTyp
 
 		switch configs[1] {
 		case "pods":
-			metricTypeName.Type = autoscalingv2beta1.PodsMetricSourceType
+			metricTypeName.Type = autoscalingv2.PodsMetricSourceType
 		case "object":
-			metricTypeName.Type = autoscalingv2beta1.ObjectMetricSourceType
+			metricTypeName.Type = autoscalingv2.ObjectMetricSourceType
+		case "external":
+			metricTypeName.Type = autoscalingv2.ExternalMetricSourceType
+		case "container-resource":
+			metricTypeName.Type = autoscalingv2.ContainerResourceMetricSourceType
 		}
 
 		metricCollector := configs[3]
@@ -251,14 +567,219 @@ func parseCustomMetricsAnnotations(annotations map[string]string) (map[MetricTyp
 			continue
 		}
 
+		if parts[1] == transformMetricsConfKey {
+			config.Transform = val
+			continue
+		}
+
+		if parts[1] == targetNamespaceConfKey {
+			config.TargetNamespace = val
+			continue
+		}
+
+		if parts[1] == replicaConversionConfKey {
+			config.ReplicaConversion = val
+			continue
+		}
+
+		if parts[1] == utilizationConfKey {
+			utilization, err := strconv.ParseBool(val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid utilization value %s for %s", val, key)
+			}
+			config.Utilization = utilization
+			continue
+		}
+
+		if parts[1] == clampReplicasConfKey {
+			clampReplicas, err := strconv.ParseBool(val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid clamp-replicas value %s for %s", val, key)
+			}
+			config.ClampReplicas = clampReplicas
+			continue
+		}
+
+		if parts[1] == partialResponseConfKey {
+			if !ValidPartialResponsePolicy(val) {
+				return nil, fmt.Errorf("unsupported partial response policy '%s' for %s, must be one of use-partial, serve-last or error", val, key)
+			}
+			config.PartialResponsePolicy = val
+			continue
+		}
+
+		if parts[1] == warmUpConfKey {
+			warmUp, err := strconv.Atoi(val)
+			if err != nil || warmUp < 0 {
+				return nil, fmt.Errorf("invalid warm-up value %s for %s", val, key)
+			}
+			config.WarmUp = warmUp
+			continue
+		}
+
+		if parts[1] == pauseConfKey {
+			paused, err := strconv.ParseBool(val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pause value %s for %s", val, key)
+			}
+			config.Paused = paused
+			continue
+		}
+
+		if parts[1] == activationConfKey {
+			activation, err := strconv.ParseBool(val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid activation value %s for %s", val, key)
+			}
+			config.Activation = activation
+			continue
+		}
+
+		if parts[1] == activationThresholdConfKey {
+			threshold, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid activation threshold value %s for %s", val, key)
+			}
+			config.ActivationThreshold = threshold
+			continue
+		}
+
+		if parts[1] == ttlConfKey {
+			ttl, err := time.ParseDuration(val)
+			if err != nil || ttl <= 0 {
+				return nil, fmt.Errorf("invalid ttl value %s for %s", val, key)
+			}
+			config.TTL = ttl
+			continue
+		}
+
+		if parts[1] == timeoutConfKey {
+			timeout, err := time.ParseDuration(val)
+			if err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("invalid timeout value %s for %s", val, key)
+			}
+			config.Timeout = timeout
+			continue
+		}
+
+		if parts[1] == smoothingWindowConfKey {
+			window, err := time.ParseDuration(val)
+			if err != nil || window <= 0 {
+				return nil, fmt.Errorf("invalid smoothing window value %s for %s", val, key)
+			}
+			config.SmoothingWindow = window
+			continue
+		}
+
+		if parts[1] == smoothingFunctionConfKey {
+			switch val {
+			case SmoothingFunctionAvg, SmoothingFunctionMin, SmoothingFunctionMax, SmoothingFunctionP95:
+				config.SmoothingFunction = val
+			default:
+				return nil, fmt.Errorf("invalid smoothing function %s for %s, must be one of avg, min, max or p95", val, key)
+			}
+			continue
+		}
+
+		if parts[1] == percentileConfKey {
+			percentile, err := strconv.ParseFloat(val, 64)
+			if err != nil || percentile <= 0 || percentile >= 100 {
+				return nil, fmt.Errorf("invalid percentile value %s for %s, must be between 0 and 100", val, key)
+			}
+			config.Percentile = percentile
+			continue
+		}
+
+		if parts[1] == counterConfKey {
+			if val != CounterRate && val != CounterDelta {
+				return nil, fmt.Errorf("invalid counter conversion %s for %s, must be rate or delta", val, key)
+			}
+			config.Counter = val
+			continue
+		}
+
+		if parts[1] == staleBehaviorConfKey {
+			switch val {
+			case StaleBehaviorError, StaleBehaviorHold, StaleBehaviorZero, StaleBehaviorValue:
+				config.StaleBehavior = val
+			default:
+				return nil, fmt.Errorf("invalid stale behavior %s for %s, must be one of error, hold, zero or value", val, key)
+			}
+			continue
+		}
+
+		if parts[1] == staleValueConfKey {
+			value, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid stale value %s for %s", val, key)
+			}
+			config.StaleValue = value
+			continue
+		}
+
+		if parts[1] == interpolationConfKey {
+			if val != InterpolationLinear {
+				return nil, fmt.Errorf("invalid interpolation %s for %s, must be linear", val, key)
+			}
+			config.Interpolation = val
+			continue
+		}
+
+		if parts[1] == staleIntervalsConfKey {
+			intervals, err := strconv.Atoi(val)
+			if err != nil || intervals < 0 {
+				return nil, fmt.Errorf("invalid stale intervals value %s for %s", val, key)
+			}
+			config.StaleIntervals = intervals
+			continue
+		}
+
+		if parts[1] == staleDecayConfKey {
+			decay, err := strconv.ParseFloat(val, 64)
+			if err != nil || decay < 0 || decay > 1 {
+				return nil, fmt.Errorf("invalid stale decay value %s for %s, must be between 0 and 1", val, key)
+			}
+			config.StaleDecay = decay
+			continue
+		}
+
+		if parts[1] == dedupEpsilonConfKey {
+			epsilon, err := strconv.ParseFloat(val, 64)
+			if err != nil || epsilon < 0 {
+				return nil, fmt.Errorf("invalid dedup epsilon value %s for %s", val, key)
+			}
+			config.Deduplicate = true
+			config.DeduplicationEpsilon = epsilon
+			continue
+		}
+
 		config.Config[parts[1]] = val
 	}
 
 	return metrics, nil
 }
 
+// isContainerResource returns true if ContainerResource metrics can be
+// collected for the resource.
+func isContainerResource(name v1.ResourceName) bool {
+	for _, containerResource := range ContainerResources {
+		if name == containerResource {
+			return true
+		}
+	}
+	return false
+}
+
+// metricTargetValue returns the value or average value of a metric target.
+func metricTargetValue(target autoscalingv2.MetricTarget) *resource.Quantity {
+	if target.Value != nil {
+		return target.Value
+	}
+	return target.AverageValue
+}
+
 // ParseHPAMetrics parses the HPA object into a list of metric configurations.
-func ParseHPAMetrics(hpa *autoscalingv2beta1.HorizontalPodAutoscaler) ([]*MetricConfig, error) {
+func ParseHPAMetrics(hpa *autoscalingv2.HorizontalPodAutoscaler) ([]*MetricConfig, error) {
 	metricConfigs := make([]*MetricConfig, 0, len(hpa.Spec.Metrics))
 
 	// TODO: validate that the specified metric names are defined
@@ -268,41 +789,78 @@ func ParseHPAMetrics(hpa *autoscalingv2beta1.HorizontalPodAutoscaler) ([]*Metric
 		return nil, err
 	}
 
+	containers := make(map[string]string)
 	for _, metric := range hpa.Spec.Metrics {
 		typeName := MetricTypeName{
 			Type: metric.Type,
 		}
 
 		var ref custom_metrics.ObjectReference
+		var identifier autoscalingv2.MetricIdentifier
+		var target autoscalingv2.MetricTarget
 		switch metric.Type {
-		case autoscalingv2beta1.PodsMetricSourceType:
-			typeName.Name = metric.Pods.MetricName
-		case autoscalingv2beta1.ObjectMetricSourceType:
-			typeName.Name = metric.Object.MetricName
+		case autoscalingv2.PodsMetricSourceType:
+			identifier = metric.Pods.Metric
+			target = metric.Pods.Target
+		case autoscalingv2.ObjectMetricSourceType:
+			identifier = metric.Object.Metric
+			target = metric.Object.Target
 			ref = custom_metrics.ObjectReference{
-				APIVersion: metric.Object.Target.APIVersion,
-				Kind:       metric.Object.Target.Kind,
-				Name:       metric.Object.Target.Name,
+				APIVersion: metric.Object.DescribedObject.APIVersion,
+				Kind:       metric.Object.DescribedObject.Kind,
+				Name:       metric.Object.DescribedObject.Name,
 				Namespace:  hpa.Namespace,
 			}
-		case autoscalingv2beta1.ExternalMetricSourceType:
-			typeName.Name = metric.External.MetricName
+		case autoscalingv2.ExternalMetricSourceType:
+			identifier = metric.External.Metric
+			target = metric.External.Target
+		case autoscalingv2.ContainerResourceMetricSourceType:
+			// ContainerResource metrics are only collected if they're
+			// configured by annotations, otherwise they're served by
+			// the metrics server.
+			typeName.Name = string(metric.ContainerResource.Name)
+			annotated, ok := configs[typeName]
+			if !ok {
+				continue
+			}
+			if !isContainerResource(metric.ContainerResource.Name) {
+				return nil, fmt.Errorf("ContainerResource metric %s can't be collected, only %v are supported", typeName.Name, ContainerResources)
+			}
+			// the collectors of an HPA are identified by the metric
+			// type and name, so the resource can only be collected
+			// for a single container.
+			if container, ok := containers[typeName.Name]; ok && container != metric.ContainerResource.Container {
+				return nil, fmt.Errorf("ContainerResource metric %s is configured for containers %s and %s, only one container is supported", typeName.Name, container, metric.ContainerResource.Container)
+			}
+			containers[typeName.Name] = metric.ContainerResource.Container
+			config := *annotated
+			config.Container = metric.ContainerResource.Container
+			config.Target = metricTargetValue(metric.ContainerResource.Target)
+			metricConfigs = append(metricConfigs, &config)
+			continue
+		default:
+			// Resource metrics are served by the metrics server.
+			continue
 		}
+		typeName.Name = identifier.Name
 
-		if config, ok := configs[typeName]; ok {
-			config.ObjectReference = ref
-			metricConfigs = append(metricConfigs, config)
-			continue
+		config, ok := configs[typeName]
+		if !ok {
+			config = &MetricConfig{
+				MetricTypeName: typeName,
+				Config:         map[string]string{},
+			}
 		}
+		config.ObjectReference = ref
+		config.Target = metricTargetValue(target)
 
-		config := &MetricConfig{
-			MetricTypeName:  typeName,
-			ObjectReference: ref,
-			Config:          map[string]string{},
+		if metric.Type == autoscalingv2.ObjectMetricSourceType && config.TargetNamespace == "" {
+			config.TargetNamespace = hpa.Namespace
 		}
 
-		if metric.Type == autoscalingv2beta1.ExternalMetricSourceType {
-			config.Labels = metric.External.MetricSelector.MatchLabels
+		if identifier.Selector != nil {
+			config.Labels = identifier.Selector.MatchLabels
+			config.MetricSelector = identifier.Selector
 		}
 		metricConfigs = append(metricConfigs, config)
 	}
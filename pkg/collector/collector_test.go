@@ -0,0 +1,279 @@
+package collector
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+)
+
+// fakeCollector returns fixed values and error.
+type fakeCollector struct {
+	values   []CollectedMetric
+	err      error
+	interval time.Duration
+}
+
+func (c *fakeCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	return c.values, c.err
+}
+
+func (c *fakeCollector) Interval() time.Duration {
+	return c.interval
+}
+
+// externalValue returns a collected external metric with the value.
+func externalValue(name string, value float64) CollectedMetric {
+	return CollectedMetric{
+		Type: autoscalingv2.ExternalMetricSourceType,
+		External: external_metrics.ExternalMetricValue{
+			MetricName: name,
+			Value:      *resource.NewMilliQuantity(int64(math.Round(value*1000)), resource.DecimalSI),
+		},
+	}
+}
+
+func TestMilliValue(t *testing.T) {
+	for _, tc := range []struct {
+		msg   string
+		value float64
+		milli int64
+		err   bool
+	}{
+		{msg: "integer", value: 2, milli: 2000},
+		{msg: "rounds up", value: 0.0015, milli: 2},
+		{msg: "rounds instead of truncating", value: 0.29, milli: 290},
+		{msg: "negative", value: -1.2345, milli: -1235},
+		{msg: "NaN", value: math.NaN(), err: true},
+		{msg: "infinity", value: math.Inf(1), err: true},
+		{msg: "out of range", value: math.MaxInt64, err: true},
+		{msg: "negative out of range", value: -math.MaxInt64, err: true},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			milli, err := milliValue(tc.value)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error, got %d", milli)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if milli != tc.milli {
+				t.Errorf("expected %d, got %d", tc.milli, milli)
+			}
+		})
+	}
+}
+
+func TestParseCustomMetricsAnnotationsBool(t *testing.T) {
+	metric := MetricTypeName{Type: autoscalingv2.ExternalMetricSourceType, Name: "jobs"}
+	prefix := "metric-config.external.jobs.prometheus/"
+
+	for _, tc := range []struct {
+		msg      string
+		key      string
+		value    string
+		expected func(config *MetricConfig) bool
+		err      bool
+	}{
+		{
+			msg:      "utilization",
+			key:      utilizationConfKey,
+			value:    "True",
+			expected: func(config *MetricConfig) bool { return config.Utilization },
+		},
+		{
+			msg:      "clamp-replicas",
+			key:      clampReplicasConfKey,
+			value:    "1",
+			expected: func(config *MetricConfig) bool { return config.ClampReplicas },
+		},
+		{
+			msg:      "activation disabled",
+			key:      activationConfKey,
+			value:    "false",
+			expected: func(config *MetricConfig) bool { return !config.Activation },
+		},
+		{
+			msg:      "pause",
+			key:      pauseConfKey,
+			value:    "true",
+			expected: func(config *MetricConfig) bool { return config.Paused },
+		},
+		{
+			msg:   "invalid pause",
+			key:   pauseConfKey,
+			value: "yes",
+			err:   true,
+		},
+		{
+			msg:   "invalid utilization",
+			key:   utilizationConfKey,
+			value: "yes",
+			err:   true,
+		},
+		{
+			msg:   "invalid clamp-replicas",
+			key:   clampReplicasConfKey,
+			value: "ture",
+			err:   true,
+		},
+		{
+			msg:   "invalid activation",
+			key:   activationConfKey,
+			value: "on",
+			err:   true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			configs, err := parseCustomMetricsAnnotations(map[string]string{prefix + tc.key: tc.value})
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error, got %v", configs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tc.expected(configs[metric]) {
+				t.Errorf("unexpected config %+v", configs[metric])
+			}
+		})
+	}
+}
+
+func TestParseHPAMetricsContainerResource(t *testing.T) {
+	containerResource := func(name v1.ResourceName, container string) autoscalingv2.MetricSpec {
+		return autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ContainerResourceMetricSourceType,
+			ContainerResource: &autoscalingv2.ContainerResourceMetricSource{
+				Name:      name,
+				Container: container,
+				Target:    autoscalingv2.MetricTarget{Type: autoscalingv2.AverageValueMetricType, AverageValue: resource.NewQuantity(1, resource.DecimalSI)},
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		msg         string
+		annotations map[string]string
+		metrics     []autoscalingv2.MetricSpec
+		containers  []string
+		err         bool
+	}{
+		{
+			msg:     "not configured by annotations",
+			metrics: []autoscalingv2.MetricSpec{containerResource(v1.ResourceCPU, "app")},
+		},
+		{
+			msg:         "configured by annotations",
+			annotations: map[string]string{"metric-config.container-resource.cpu.json-path/json-key": "$.cpu"},
+			metrics:     []autoscalingv2.MetricSpec{containerResource(v1.ResourceCPU, "app"), containerResource(v1.ResourceMemory, "app")},
+			containers:  []string{"app"},
+		},
+		{
+			msg:         "unsupported resource",
+			annotations: map[string]string{"metric-config.container-resource.ephemeral-storage.json-path/json-key": "$.storage"},
+			metrics:     []autoscalingv2.MetricSpec{containerResource(v1.ResourceEphemeralStorage, "app")},
+			err:         true,
+		},
+		{
+			msg:         "resource of multiple containers",
+			annotations: map[string]string{"metric-config.container-resource.cpu.json-path/json-key": "$.cpu"},
+			metrics:     []autoscalingv2.MetricSpec{containerResource(v1.ResourceCPU, "app"), containerResource(v1.ResourceCPU, "sidecar")},
+			err:         true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			hpa := &autoscalingv2.HorizontalPodAutoscaler{
+				ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default", Annotations: tc.annotations},
+				Spec:       autoscalingv2.HorizontalPodAutoscalerSpec{Metrics: tc.metrics},
+			}
+
+			configs, err := ParseHPAMetrics(hpa)
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(configs) != len(tc.containers) {
+				t.Fatalf("expected %d configs, got %d", len(tc.containers), len(configs))
+			}
+			for i, config := range configs {
+				if config.Type != autoscalingv2.ContainerResourceMetricSourceType || config.Container != tc.containers[i] || config.Config["json-key"] != "$.cpu" {
+					t.Errorf("unexpected config %v", config)
+				}
+				if config.Target == nil || config.Target.Value() != 1 {
+					t.Errorf("expected the target of the metric, got %v", config.Target)
+				}
+			}
+		})
+	}
+}
+
+// podsPlugin returns collectors collecting a single pod value with the type
+// of the metric config.
+type podsPlugin struct{}
+
+func (podsPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	return &fakeCollector{values: []CollectedMetric{{
+		Type: config.Type,
+		Custom: custom_metrics.MetricValue{
+			DescribedObject: custom_metrics.ObjectReference{Kind: "Pod", Namespace: hpa.Namespace, Name: "pod"},
+			Metric:          custom_metrics.MetricIdentifier{Name: config.Name},
+			Value:           *resource.NewQuantity(1, resource.DecimalSI),
+		},
+	}}}, nil
+}
+
+func TestNewCollectorContainerResource(t *testing.T) {
+	factory := NewCollectorFactory(nil, nil)
+	err := factory.RegisterPodsCollector("", podsPlugin{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default"}}
+	config := &MetricConfig{
+		MetricTypeName: MetricTypeName{Type: autoscalingv2.ContainerResourceMetricSourceType, Name: "cpu"},
+		CollectorName:  "json-path",
+		Container:      "app",
+	}
+
+	c, err := factory.NewCollector(hpa, config, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	values, err := c.GetMetrics(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(values) != 1 {
+		t.Fatalf("expected a single value, got %v", values)
+	}
+	if values[0].Type != autoscalingv2.PodsMetricSourceType {
+		t.Errorf("expected the value to be collected as pods metric, got %s", values[0].Type)
+	}
+	if values[0].Labels[ContainerLabel] != "app" {
+		t.Errorf("expected the value to be labeled with the container, got %v", values[0].Labels)
+	}
+	if config.Type != autoscalingv2.ContainerResourceMetricSourceType {
+		t.Errorf("expected the metric config not to be modified")
+	}
+}
@@ -0,0 +1,208 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+)
+
+const (
+	// CompositeCollectorName is the name of the composite collector.
+	CompositeCollectorName = "composite"
+
+	compositeAggregationSum             = "sum"
+	compositeAggregationMax             = "max"
+	compositeAggregationWeightedAverage = "weighted-average"
+)
+
+// CompositeCollectorPlugin is a collector plugin for initializing collectors
+// which combine the values of several sources into a single value.
+type CompositeCollectorPlugin struct {
+	factory *CollectorFactory
+}
+
+// NewCompositeCollectorPlugin initializes a new CompositeCollectorPlugin. The
+// sources are initialized from the plugins registered in the factory.
+func NewCompositeCollectorPlugin(factory *CollectorFactory) *CompositeCollectorPlugin {
+	return &CompositeCollectorPlugin{
+		factory: factory,
+	}
+}
+
+// NewCollector initializes a new composite collector from the specified HPA.
+func (p *CompositeCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	if config.Type == autoscalingv2.PodsMetricSourceType {
+		return nil, fmt.Errorf("composite collector doesn't support pods metrics")
+	}
+
+	c := &CompositeCollector{
+		metricType:      config.Type,
+		metricName:      config.Name,
+		labels:          config.Labels,
+		objectReference: config.ObjectReference,
+		aggregation:     compositeAggregationSum,
+		interval:        interval,
+	}
+
+	if v, ok := config.Config["aggregation"]; ok {
+		switch v {
+		case compositeAggregationSum, compositeAggregationMax, compositeAggregationWeightedAverage:
+			c.aggregation = v
+		default:
+			return nil, fmt.Errorf("invalid aggregation '%s'", v)
+		}
+	}
+
+	sources, ok := config.Config["sources"]
+	if !ok {
+		return nil, fmt.Errorf("no sources defined for composite collector")
+	}
+
+	for _, name := range strings.Split(sources, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		sourceConfig, err := subMetricConfig(config, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if sourceConfig.CollectorName == CompositeCollectorName {
+			return nil, fmt.Errorf("%s source of composite can't be a composite", name)
+		}
+
+		source := compositeSource{
+			name:   name,
+			weight: 1,
+		}
+
+		// the weight is a setting of the composite collector and not
+		// passed on to the source.
+		if v, ok := sourceConfig.Config["weight"]; ok {
+			weight, err := strconv.ParseFloat(v, 64)
+			if err != nil || weight < 0 {
+				return nil, fmt.Errorf("invalid weight '%s' of %s source", v, name)
+			}
+			source.weight = weight
+			delete(sourceConfig.Config, "weight")
+		}
+
+		source.collector, err = p.factory.newPluginCollector(hpa, sourceConfig, interval)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize %s source of composite: %v", name, err)
+		}
+
+		c.sources = append(c.sources, source)
+	}
+
+	if len(c.sources) == 0 {
+		return nil, fmt.Errorf("no sources defined for composite collector")
+	}
+
+	return c, nil
+}
+
+// compositeSource is a source of a composite collector.
+type compositeSource struct {
+	name      string
+	collector Collector
+	weight    float64
+}
+
+// CompositeCollector is a metrics collector which collects a metric from
+// several sources and combines the values with the configured aggregation
+// into a single value. The value of a source is the sum of all values it
+// collected.
+type CompositeCollector struct {
+	sources         []compositeSource
+	metricType      autoscalingv2.MetricSourceType
+	metricName      string
+	labels          map[string]string
+	objectReference custom_metrics.ObjectReference
+	aggregation     string
+	interval        time.Duration
+}
+
+// GetMetrics collects the metric from all sources and returns the combined
+// value. The collection fails if any source fails. The timestamp of the
+// combined value is the oldest timestamp of the source values.
+func (c *CompositeCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	var result, totalWeight float64
+	var oldest time.Time
+	for i, source := range c.sources {
+		values, err := source.collector.GetMetrics(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get metrics from %s source: %v", source.name, err)
+		}
+
+		var value float64
+		for _, v := range values {
+			value += v.floatValue()
+			if timestamp := v.timestamp(); !timestamp.IsZero() && (oldest.IsZero() || timestamp.Before(oldest)) {
+				oldest = timestamp
+			}
+		}
+
+		switch c.aggregation {
+		case compositeAggregationSum:
+			result += value
+		case compositeAggregationMax:
+			if i == 0 || value > result {
+				result = value
+			}
+		case compositeAggregationWeightedAverage:
+			result += value * source.weight
+			totalWeight += source.weight
+		}
+	}
+
+	if c.aggregation == compositeAggregationWeightedAverage {
+		if totalWeight == 0 {
+			return nil, fmt.Errorf("total weight of sources is 0")
+		}
+		result /= totalWeight
+	}
+
+	if oldest.IsZero() {
+		oldest = time.Now().UTC()
+	}
+
+	now := metav1.Time{Time: oldest}
+	metricValue := CollectedMetric{
+		Type: c.metricType,
+	}
+
+	switch c.metricType {
+	case autoscalingv2.ObjectMetricSourceType:
+		metricValue.Custom = custom_metrics.MetricValue{
+			DescribedObject: c.objectReference,
+			Metric:          custom_metrics.MetricIdentifier{Name: c.metricName},
+			Timestamp:       now,
+		}
+	case autoscalingv2.ExternalMetricSourceType:
+		metricValue.External = external_metrics.ExternalMetricValue{
+			MetricName:   c.metricName,
+			MetricLabels: c.labels,
+			Timestamp:    now,
+		}
+	}
+	if err := metricValue.setFloatValue(result); err != nil {
+		return nil, err
+	}
+
+	return []CollectedMetric{metricValue}, nil
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *CompositeCollector) Interval() time.Duration {
+	return c.interval
+}
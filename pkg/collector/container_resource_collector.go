@@ -0,0 +1,49 @@
+package collector
+
+import (
+	"context"
+	"time"
+)
+
+// ContainerResourceCollector is a collector which labels the pod values
+// collected for a ContainerResource metric with the container, such that
+// they're served as the resource usage of the container.
+type ContainerResourceCollector struct {
+	collector Collector
+	container string
+}
+
+// NewContainerResourceCollector initializes a new
+// ContainerResourceCollector.
+func NewContainerResourceCollector(collector Collector, container string) *ContainerResourceCollector {
+	return &ContainerResourceCollector{
+		collector: collector,
+		container: container,
+	}
+}
+
+// GetMetrics gets metrics from the underlying collector and labels them with
+// the container.
+func (c *ContainerResourceCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	values, partial, err := getPartialMetrics(ctx, c.collector)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range values {
+		// the labels of the pod may be shared with other values.
+		labels := make(map[string]string, len(values[i].Labels)+1)
+		for key, value := range values[i].Labels {
+			labels[key] = value
+		}
+		labels[ContainerLabel] = c.container
+		values[i].Labels = labels
+	}
+
+	return partialMetrics(values, partial)
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *ContainerResourceCollector) Interval() time.Duration {
+	return c.collector.Interval()
+}
@@ -0,0 +1,126 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Conversions of counters to the values served for them.
+const (
+	// CounterRate serves the per second rate of increase of a counter.
+	CounterRate = "rate"
+	// CounterDelta serves the increase of a counter since the previous
+	// collection.
+	CounterDelta = "delta"
+)
+
+// counterSample is a collected value of a counter.
+type counterSample struct {
+	value float64
+	time  time.Time
+}
+
+// CounterCollector is a collector which converts the monotonically
+// increasing counters collected by another collector into their rate or
+// delta between consecutive collections. Series are only returned once they
+// were collected twice.
+type CounterCollector struct {
+	collector  Collector
+	conversion string
+	previous   map[string]counterSample
+}
+
+// NewCounterCollector initializes a new CounterCollector.
+func NewCounterCollector(collector Collector, conversion string) (*CounterCollector, error) {
+	switch conversion {
+	case CounterRate, CounterDelta:
+	default:
+		return nil, fmt.Errorf("invalid counter conversion '%s', must be rate or delta", conversion)
+	}
+
+	return &CounterCollector{
+		collector:  collector,
+		conversion: conversion,
+		previous:   make(map[string]counterSample),
+	}, nil
+}
+
+// GetMetrics gets metrics from the underlying collector and converts them.
+// A decreasing counter is considered reset to 0 in between.
+func (c *CounterCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	values, partial, err := getPartialMetrics(ctx, c.collector)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	current := make(map[string]counterSample, len(values))
+	converted := make([]CollectedMetric, 0, len(values))
+	for _, value := range values {
+		key := counterSeriesKey(value)
+		sample := counterSample{value: value.floatValue(), time: value.timestamp()}
+		if sample.time.IsZero() {
+			sample.time = now
+		}
+		current[key] = sample
+
+		previous, ok := c.previous[key]
+		if !ok {
+			glog.V(1).Infof("Skipping counter series %s until it was collected twice", key)
+			continue
+		}
+
+		increase := sample.value - previous.value
+		if increase < 0 {
+			// the counter was reset.
+			increase = sample.value
+		}
+
+		if c.conversion == CounterRate {
+			elapsed := sample.time.Sub(previous.time).Seconds()
+			if elapsed <= 0 {
+				continue
+			}
+			increase /= elapsed
+		}
+
+		if err := value.setFloatValue(increase); err != nil {
+			return nil, err
+		}
+		converted = append(converted, value)
+	}
+
+	// the samples of the series missing from a partial response are
+	// kept, such that they are converted once they are collected again.
+	if partial != nil {
+		for key, sample := range c.previous {
+			if _, ok := current[key]; !ok {
+				current[key] = sample
+			}
+		}
+	}
+
+	c.previous = current
+	return partialMetrics(converted, partial)
+}
+
+// counterSeriesKey returns the key identifying the series of a collected
+// metric.
+func counterSeriesKey(value CollectedMetric) string {
+	if value.Type == autoscalingv2.ExternalMetricSourceType {
+		return value.External.MetricName + "{" + labels.Set(value.External.MetricLabels).String() + "}"
+	}
+
+	object := value.Custom.DescribedObject
+	return value.Custom.Metric.Name + "/" + object.Namespace + "/" + object.Kind + "/" + object.Name
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *CounterCollector) Interval() time.Duration {
+	return c.collector.Interval()
+}
@@ -0,0 +1,214 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// CrossCheckCollectorName is the name of the cross check collector.
+	CrossCheckCollectorName = "cross-check"
+
+	crossCheckPrimary   = "primary"
+	crossCheckSecondary = "secondary"
+
+	divergenceUseMax    = "use-max"
+	divergenceUseMin    = "use-min"
+	divergenceServeLast = "serve-last"
+	divergenceError     = "error"
+
+	defaultDivergenceThreshold = 10
+)
+
+// CrossCheckCollectorPlugin is a collector plugin for initializing
+// collectors which collect a metric from two independent sources and check
+// that they agree.
+type CrossCheckCollectorPlugin struct {
+	factory *CollectorFactory
+}
+
+// NewCrossCheckCollectorPlugin initializes a new CrossCheckCollectorPlugin.
+// The sources are initialized from the plugins registered in the factory.
+func NewCrossCheckCollectorPlugin(factory *CollectorFactory) *CrossCheckCollectorPlugin {
+	return &CrossCheckCollectorPlugin{
+		factory: factory,
+	}
+}
+
+// NewCollector initializes a new cross check collector from the specified
+// HPA.
+func (p *CrossCheckCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	c := &CrossCheckCollector{
+		hpa:       hpa,
+		threshold: defaultDivergenceThreshold,
+		policy:    divergenceError,
+		recorder:  p.factory.recorder,
+		interval:  interval,
+	}
+
+	var err error
+	for _, source := range []struct {
+		name      string
+		collector *Collector
+	}{
+		{crossCheckPrimary, &c.primary},
+		{crossCheckSecondary, &c.secondary},
+	} {
+		sourceConfig, err := subMetricConfig(config, source.name)
+		if err != nil {
+			return nil, err
+		}
+
+		if sourceConfig.CollectorName == CrossCheckCollectorName {
+			return nil, fmt.Errorf("%s source of cross check can't be a cross check", source.name)
+		}
+
+		*source.collector, err = p.factory.newPluginCollector(hpa, sourceConfig, interval)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize %s source of cross check: %v", source.name, err)
+		}
+	}
+
+	if v, ok := config.Config["threshold"]; ok {
+		c.threshold, err = strconv.ParseFloat(v, 64)
+		if err != nil || c.threshold < 0 {
+			return nil, fmt.Errorf("invalid divergence threshold '%s'", v)
+		}
+	}
+
+	if v, ok := config.Config["divergence-policy"]; ok {
+		switch v {
+		case divergenceUseMax, divergenceUseMin, divergenceServeLast, divergenceError:
+			c.policy = v
+		default:
+			return nil, fmt.Errorf("unsupported divergence policy '%s'", v)
+		}
+	}
+
+	return c, nil
+}
+
+// subMetricConfig returns the metric config of a source defined by the
+// config keys with the prefix "<source>.". The collector of the source is
+// defined by the key "<source>.collector".
+func subMetricConfig(config *MetricConfig, source string) (*MetricConfig, error) {
+	prefix := source + "."
+
+	sub := *config
+	sub.CollectorName = ""
+	sub.Config = map[string]string{}
+	for key, value := range config.Config {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		key = strings.TrimPrefix(key, prefix)
+		if key == "collector" {
+			sub.CollectorName = value
+			continue
+		}
+		sub.Config[key] = value
+	}
+
+	if sub.CollectorName == "" {
+		return nil, fmt.Errorf("no collector defined for %s source", source)
+	}
+
+	return &sub, nil
+}
+
+// CrossCheckCollector is a metrics collector which collects a metric from a
+// primary and a secondary source. If the sum of the values of the sources
+// differs by more than the threshold (in percent of the larger sum) the
+// divergence policy is applied, otherwise the primary values are returned.
+type CrossCheckCollector struct {
+	primary    Collector
+	secondary  Collector
+	hpa        *autoscalingv2.HorizontalPodAutoscaler
+	threshold  float64
+	policy     string
+	recorder   record.EventRecorder
+	lastValues []CollectedMetric
+	interval   time.Duration
+}
+
+// GetMetrics collects the metric from both sources and checks that they
+// agree.
+func (c *CrossCheckCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	primary, err := c.primary.GetMetrics(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metrics from %s source: %v", crossCheckPrimary, err)
+	}
+
+	secondary, err := c.secondary.GetMetrics(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metrics from %s source: %v", crossCheckSecondary, err)
+	}
+
+	primarySum, secondarySum := sumValues(primary), sumValues(secondary)
+	if divergence(primarySum, secondarySum) <= c.threshold {
+		c.lastValues = primary
+		return primary, nil
+	}
+
+	err = fmt.Errorf("metric sources diverged by more than %g%%: %s source: %g, %s source: %g", c.threshold, crossCheckPrimary, primarySum, crossCheckSecondary, secondarySum)
+	if c.recorder != nil {
+		c.recorder.Eventf(c.hpa, v1.EventTypeWarning, "MetricSourcesDiverged", "%v", err)
+	}
+
+	switch c.policy {
+	case divergenceUseMax:
+		glog.Warningf("%v, using the larger values", err)
+		if secondarySum > primarySum {
+			return secondary, nil
+		}
+		return primary, nil
+	case divergenceUseMin:
+		glog.Warningf("%v, using the smaller values", err)
+		if secondarySum < primarySum {
+			return secondary, nil
+		}
+		return primary, nil
+	case divergenceServeLast:
+		if c.lastValues == nil {
+			return nil, err
+		}
+		glog.Warningf("%v, serving last values", err)
+		return c.lastValues, nil
+	default:
+		return nil, err
+	}
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *CrossCheckCollector) Interval() time.Duration {
+	return c.interval
+}
+
+// sumValues returns the sum of the values of the collected metrics.
+func sumValues(values []CollectedMetric) float64 {
+	var sum float64
+	for _, value := range values {
+		sum += value.floatValue()
+	}
+	return sum
+}
+
+// divergence returns the difference between a and b in percent of the
+// larger absolute value.
+func divergence(a, b float64) float64 {
+	max := math.Max(math.Abs(a), math.Abs(b))
+	if max == 0 {
+		return 0
+	}
+	return math.Abs(a-b) / max * 100
+}
@@ -0,0 +1,219 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+)
+
+const (
+	// DatadogCollectorName is the name of the Datadog collector.
+	DatadogCollectorName = "datadog"
+
+	datadogDefaultSite   = "datadoghq.com"
+	datadogDefaultWindow = 5 * time.Minute
+)
+
+// datadogSites are the Datadog sites metrics can query besides the site of
+// the adapter.
+var datadogSites = map[string]struct{}{
+	"datadoghq.com":     {},
+	"us3.datadoghq.com": {},
+	"us5.datadoghq.com": {},
+	"datadoghq.eu":      {},
+	"ap1.datadoghq.com": {},
+	"ddog-gov.com":      {},
+}
+
+// DatadogCollectorPlugin is a collector plugin for initializing collectors
+// which run Datadog metrics queries.
+type DatadogCollectorPlugin struct {
+	site       string
+	apiKeyFile string
+	appKeyFile string
+}
+
+// NewDatadogCollectorPlugin initializes a new DatadogCollectorPlugin. The
+// site, e.g. datadoghq.eu, and the keys read from the key files are used for
+// metrics which don't define their own.
+func NewDatadogCollectorPlugin(site, apiKeyFile, appKeyFile string) *DatadogCollectorPlugin {
+	if site == "" {
+		site = datadogDefaultSite
+	}
+
+	return &DatadogCollectorPlugin{
+		site:       site,
+		apiKeyFile: apiKeyFile,
+		appKeyFile: appKeyFile,
+	}
+}
+
+// NewCollector initializes a new Datadog collector from the specified HPA.
+func (p *DatadogCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	if config.Type != autoscalingv2.ExternalMetricSourceType {
+		return nil, fmt.Errorf("datadog collector only supports external metrics")
+	}
+
+	query, ok := config.Config["query"]
+	if !ok {
+		return nil, fmt.Errorf("no datadog query defined")
+	}
+
+	c := &DatadogCollector{
+		hpa:         hpa,
+		site:        p.site,
+		apiKey:      config.Config["api-key"],
+		apiKeyFile:  p.apiKeyFile,
+		appKey:      config.Config["app-key"],
+		appKeyFile:  p.appKeyFile,
+		query:       query,
+		window:      datadogDefaultWindow,
+		aggregation: seriesAggregationAvg,
+		metricName:  config.Name,
+		labels:      config.Labels,
+		interval:    interval,
+		httpClient: &http.Client{
+			Timeout:   15 * time.Second,
+			Transport: &http.Transport{},
+		},
+	}
+
+	// the keys of the adapter must not be sent to arbitrary hosts, so
+	// the site can only be overridden with a site of Datadog.
+	if v, ok := config.Config["site"]; ok && v != c.site {
+		if _, ok := datadogSites[v]; !ok {
+			return nil, fmt.Errorf("unknown datadog site '%s'", v)
+		}
+		c.site = v
+	}
+
+	if v, ok := config.Config["window"]; ok {
+		window, err := time.ParseDuration(v)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("invalid datadog window '%s'", v)
+		}
+		c.window = window
+	}
+
+	if v, ok := config.Config["aggregation"]; ok {
+		if !validSeriesAggregation(v) {
+			return nil, fmt.Errorf("unsupported datadog aggregation '%s'", v)
+		}
+		c.aggregation = v
+	}
+
+	if c.apiKey == "" && c.apiKeyFile == "" || c.appKey == "" && c.appKeyFile == "" {
+		return nil, fmt.Errorf("datadog api and application keys must be defined")
+	}
+
+	return c, nil
+}
+
+// DatadogCollector is a metrics collector which exposes the latest point of
+// the result of a Datadog metrics query as external metric. The latest
+// points of queries returning several series are aggregated.
+type DatadogCollector struct {
+	hpa         *autoscalingv2.HorizontalPodAutoscaler
+	site        string
+	apiKey      string
+	apiKeyFile  string
+	appKey      string
+	appKeyFile  string
+	query       string
+	window      time.Duration
+	aggregation string
+	metricName  string
+	labels      map[string]string
+	interval    time.Duration
+	httpClient  *http.Client
+}
+
+// datadogQueryResponse is the response of the metrics query API. Each point
+// is a pair of timestamp and value, which is null for missing values.
+type datadogQueryResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Series []struct {
+		Pointlist [][2]*float64 `json:"pointlist"`
+	} `json:"series"`
+}
+
+// GetMetrics runs the query and returns its latest point.
+func (c *DatadogCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	apiKey, err := readCredential(c.apiKey, c.apiKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read datadog api key: %v", err)
+	}
+
+	appKey, err := readCredential(c.appKey, c.appKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read datadog application key: %v", err)
+	}
+
+	now := time.Now().UTC()
+	params := url.Values{}
+	params.Set("query", c.query)
+	params.Set("from", strconv.FormatInt(now.Add(-c.window).Unix(), 10))
+	params.Set("to", strconv.FormatInt(now.Unix(), 10))
+
+	auditQuery(c.hpa, c.metricName, DatadogCollectorName, c.query)
+
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://api.%s/api/v1/query?%s", c.site, params.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("DD-API-KEY", apiKey)
+	request.Header.Set("DD-APPLICATION-KEY", appKey)
+
+	var response datadogQueryResponse
+	err = doJSON(ctx, c.httpClient, request, &response)
+	if err != nil {
+		return nil, fmt.Errorf("datadog query failed: %v", err)
+	}
+
+	if response.Status == "error" {
+		return nil, fmt.Errorf("datadog query failed: %s", response.Error)
+	}
+
+	var values []float64
+	for _, series := range response.Series {
+		for i := len(series.Pointlist) - 1; i >= 0; i-- {
+			if value := series.Pointlist[i][1]; value != nil {
+				values = append(values, *value)
+				break
+			}
+		}
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("datadog query '%s' returned no points within %s", c.query, c.window)
+	}
+	value := aggregateSeries(values, c.aggregation)
+
+	metricValue := CollectedMetric{
+		Type: autoscalingv2.ExternalMetricSourceType,
+		External: external_metrics.ExternalMetricValue{
+			MetricName:   c.metricName,
+			MetricLabels: c.labels,
+			Timestamp:    metav1.Time{Time: now},
+		},
+	}
+	err = metricValue.setFloatValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return []CollectedMetric{metricValue}, nil
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *DatadogCollector) Interval() time.Duration {
+	return c.interval
+}
@@ -0,0 +1,111 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// datadogBackendTest tests the Datadog collector. The credential of a
+// request is its api and application key.
+var datadogBackendTest = backendTest{
+	adapter: "datadoghq.eu",
+	config:  map[string]string{"query": "avg:requests{*}"},
+	newCollector: func(t *testing.T, server *httptest.Server, site string, config map[string]string) (Collector, error) {
+		plugin := NewDatadogCollectorPlugin(site, adapterCredentialFile(t), adapterCredentialFile(t))
+		c, err := plugin.NewCollector(
+			&autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default"}},
+			&MetricConfig{
+				MetricTypeName: MetricTypeName{Type: autoscalingv2.ExternalMetricSourceType, Name: "requests"},
+				Config:         config,
+			},
+			time.Minute,
+		)
+		if err != nil {
+			return nil, err
+		}
+		c.(*DatadogCollector).httpClient = serverClient(t, server)
+		return c, nil
+	},
+	credential: func(r *http.Request) string {
+		return r.Header.Get("DD-API-KEY") + "/" + r.Header.Get("DD-APPLICATION-KEY")
+	},
+	checkRequest: func(t *testing.T, r *http.Request, config map[string]string) {
+		if r.URL.Path != "/api/v1/query" || r.URL.Query().Get("query") != config["query"] {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+	},
+}
+
+func TestDatadogCollectorCredentials(t *testing.T) {
+	datadogBackendTest.testCredentials(t, []backendCredentialTestCase{
+		{
+			msg:        "default site",
+			target:     "api.datadoghq.com",
+			credential: adapterCredential + "/" + adapterCredential,
+		},
+		{
+			msg:        "site of the adapter",
+			adapter:    "datadog.proxy.example.org",
+			config:     map[string]string{"site": "datadog.proxy.example.org"},
+			target:     "api.datadog.proxy.example.org",
+			credential: adapterCredential + "/" + adapterCredential,
+		},
+		{
+			msg:        "site of datadog",
+			config:     map[string]string{"site": "datadoghq.eu"},
+			target:     "api.datadoghq.eu",
+			credential: adapterCredential + "/" + adapterCredential,
+		},
+		{
+			msg:        "keys of the metric",
+			config:     map[string]string{"site": "us5.datadoghq.com", "api-key": "api", "app-key": "app"},
+			target:     "api.us5.datadoghq.com",
+			credential: "api/app",
+		},
+		{
+			msg:    "unknown site",
+			config: map[string]string{"site": "attacker.example.org"},
+			err:    true,
+		},
+		{
+			msg:    "unknown site with a path",
+			config: map[string]string{"site": "attacker.example.org/x#"},
+			err:    true,
+		},
+		{
+			msg:    "unknown site with keys",
+			config: map[string]string{"site": "attacker.example.org", "api-key": "api", "app-key": "app"},
+			err:    true,
+		},
+	})
+}
+
+func TestDatadogCollector(t *testing.T) {
+	datadogBackendTest.testValues(t, []backendValueTestCase{
+		{
+			msg:      "latest point",
+			body:     `{"status":"ok","series":[{"pointlist":[[1000,1],[1060,2.5],[1120,null]]}]}`,
+			expected: 2500,
+		},
+		{
+			msg:      "average of series",
+			body:     `{"status":"ok","series":[{"pointlist":[[1000,1]]},{"pointlist":[[1000,3]]}]}`,
+			expected: 2000,
+		},
+		{
+			msg:  "query error",
+			body: `{"status":"error","error":"invalid query"}`,
+			err:  true,
+		},
+		{
+			msg:  "no points",
+			body: `{"status":"ok","series":[]}`,
+			err:  true,
+		},
+	})
+}
@@ -0,0 +1,85 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+)
+
+// ErrDryRun is the error of all network requests of collector plugins
+// initialized for a dry run.
+var ErrDryRun = errors.New("network access is disabled in dry run")
+
+// IsDryRunError returns true if the error was caused by a network request
+// refused in a dry run. As errors are wrapped by formatting them, the
+// message of the error is checked.
+func IsDryRunError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), ErrDryRun.Error())
+}
+
+// NewDryRunTransport returns an http.Transport refusing all connections.
+// Clients using it can be passed to collector plugins to validate metric
+// configs without accessing the cluster or any backend. An http.Transport
+// is returned, rather than any http.RoundTripper, as e.g. the AWS SDK
+// configures the TLS settings of the transport of its clients.
+func NewDryRunTransport() *http.Transport {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, ErrDryRun
+		},
+	}
+}
+
+// DryRunRecorder records the metric configs collector plugins are asked to
+// create collectors for, for validating metric configurations.
+type DryRunRecorder struct {
+	configs []*MetricConfig
+}
+
+// NewDryRunRecorder initializes a new DryRunRecorder.
+func NewDryRunRecorder() *DryRunRecorder {
+	return &DryRunRecorder{}
+}
+
+// Wrap returns a collector plugin recording the configs the plugin creates
+// collectors for.
+func (r *DryRunRecorder) Wrap(plugin CollectorPlugin) CollectorPlugin {
+	return &dryRunCollectorPlugin{
+		plugin:   plugin,
+		recorder: r,
+	}
+}
+
+// Configs returns the configs recorded since the last call and resets the
+// recorded configs. The interval of the returned configs is set to the
+// interval the collector would be run at.
+func (r *DryRunRecorder) Configs() []*MetricConfig {
+	configs := r.configs
+	r.configs = nil
+	return configs
+}
+
+// dryRunCollectorPlugin is a collector plugin recording the configs of the
+// collectors it creates.
+type dryRunCollectorPlugin struct {
+	plugin   CollectorPlugin
+	recorder *DryRunRecorder
+}
+
+// NewCollector creates a collector with the plugin and records its config.
+func (p *dryRunCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	collector, err := p.plugin.NewCollector(hpa, config, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded := *config
+	recorded.Interval = interval
+	p.recorder.configs = append(p.recorder.configs, &recorded)
+	return collector, nil
+}
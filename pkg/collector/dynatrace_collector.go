@@ -0,0 +1,195 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+)
+
+const (
+	// DynatraceCollectorName is the name of the Dynatrace collector.
+	DynatraceCollectorName = "dynatrace"
+
+	dynatraceDefaultFrom = "now-5m"
+)
+
+// DynatraceCollectorPlugin is a collector plugin for initializing collectors
+// which query the metrics v2 API of Dynatrace.
+type DynatraceCollectorPlugin struct {
+	environment string
+	tokenFile   string
+}
+
+// NewDynatraceCollectorPlugin initializes a new DynatraceCollectorPlugin. The
+// environment URL, e.g. https://abc12345.live.dynatrace.com, and the API
+// token read from the token file are used for metrics which don't define
+// their own.
+func NewDynatraceCollectorPlugin(environment, tokenFile string) *DynatraceCollectorPlugin {
+	return &DynatraceCollectorPlugin{
+		environment: strings.TrimSuffix(environment, "/"),
+		tokenFile:   tokenFile,
+	}
+}
+
+// NewCollector initializes a new Dynatrace collector from the specified HPA.
+func (p *DynatraceCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	if config.Type != autoscalingv2.ExternalMetricSourceType {
+		return nil, fmt.Errorf("dynatrace collector only supports external metrics")
+	}
+
+	metricSelector, ok := config.Config["metric-selector"]
+	if !ok {
+		return nil, fmt.Errorf("no dynatrace metric selector defined")
+	}
+
+	c := &DynatraceCollector{
+		hpa:            hpa,
+		environment:    p.environment,
+		token:          config.Config["token"],
+		tokenFile:      p.tokenFile,
+		metricSelector: metricSelector,
+		entitySelector: config.Config["entity-selector"],
+		from:           dynatraceDefaultFrom,
+		aggregation:    seriesAggregationAvg,
+		metricName:     config.Name,
+		labels:         config.Labels,
+		interval:       interval,
+		httpClient: &http.Client{
+			Timeout:   15 * time.Second,
+			Transport: &http.Transport{},
+		},
+	}
+
+	// the token of the adapter must not be sent to another environment,
+	// so the environment can only be overridden along with the token of
+	// the metric.
+	if v, ok := config.Config["environment"]; ok && strings.TrimSuffix(v, "/") != c.environment {
+		if c.token == "" {
+			return nil, fmt.Errorf("the dynatrace environment can only be overridden together with a token")
+		}
+		c.environment = strings.TrimSuffix(v, "/")
+	}
+	if c.environment == "" {
+		return nil, fmt.Errorf("no dynatrace environment defined")
+	}
+
+	if v, ok := config.Config["from"]; ok {
+		c.from = v
+	}
+
+	if v, ok := config.Config["aggregation"]; ok {
+		if !validSeriesAggregation(v) {
+			return nil, fmt.Errorf("unsupported dynatrace aggregation '%s'", v)
+		}
+		c.aggregation = v
+	}
+
+	if c.token == "" && c.tokenFile == "" {
+		return nil, fmt.Errorf("dynatrace api token must be defined")
+	}
+
+	return c, nil
+}
+
+// DynatraceCollector is a metrics collector which exposes the latest value
+// of a Dynatrace metric selector as external metric. The latest values of
+// selectors returning several series, e.g. one per entity, are aggregated.
+type DynatraceCollector struct {
+	hpa            *autoscalingv2.HorizontalPodAutoscaler
+	environment    string
+	token          string
+	tokenFile      string
+	metricSelector string
+	entitySelector string
+	from           string
+	aggregation    string
+	metricName     string
+	labels         map[string]string
+	interval       time.Duration
+	httpClient     *http.Client
+}
+
+// dynatraceQueryResponse is the response of the metrics query API. Values
+// are null for missing values.
+type dynatraceQueryResponse struct {
+	Result []struct {
+		MetricID string `json:"metricId"`
+		Data     []struct {
+			Values []*float64 `json:"values"`
+		} `json:"data"`
+	} `json:"result"`
+}
+
+// GetMetrics queries the metric selector and returns its latest value.
+func (c *DynatraceCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	token, err := readCredential(c.token, c.tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dynatrace api token: %v", err)
+	}
+
+	params := url.Values{}
+	params.Set("metricSelector", c.metricSelector)
+	params.Set("from", c.from)
+	if c.entitySelector != "" {
+		params.Set("entitySelector", c.entitySelector)
+	}
+
+	auditQuery(c.hpa, c.metricName, DynatraceCollectorName, params.Encode())
+
+	request, err := http.NewRequest(http.MethodGet, c.environment+"/api/v2/metrics/query?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Api-Token "+token)
+	request.Header.Set("Accept", "application/json")
+
+	var response dynatraceQueryResponse
+	err = doJSON(ctx, c.httpClient, request, &response)
+	if err != nil {
+		return nil, fmt.Errorf("dynatrace query failed: %v", err)
+	}
+
+	var values []float64
+	for _, result := range response.Result {
+		for _, data := range result.Data {
+			for i := len(data.Values) - 1; i >= 0; i-- {
+				if value := data.Values[i]; value != nil {
+					values = append(values, *value)
+					break
+				}
+			}
+		}
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("dynatrace metric selector '%s' returned no values from %s", c.metricSelector, c.from)
+	}
+	value := aggregateSeries(values, c.aggregation)
+
+	metricValue := CollectedMetric{
+		Type: autoscalingv2.ExternalMetricSourceType,
+		External: external_metrics.ExternalMetricValue{
+			MetricName:   c.metricName,
+			MetricLabels: c.labels,
+			Timestamp:    metav1.Time{Time: time.Now().UTC()},
+		},
+	}
+	err = metricValue.setFloatValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return []CollectedMetric{metricValue}, nil
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *DynatraceCollector) Interval() time.Duration {
+	return c.interval
+}
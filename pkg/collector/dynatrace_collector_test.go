@@ -0,0 +1,104 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// dynatraceBackendTest tests the Dynatrace collector.
+var dynatraceBackendTest = backendTest{
+	adapter: "https://abc12345.live.dynatrace.com",
+	config:  map[string]string{"metric-selector": "builtin:service.requestCount.total", "entity-selector": "type(SERVICE)"},
+	newCollector: func(t *testing.T, server *httptest.Server, environment string, config map[string]string) (Collector, error) {
+		plugin := NewDynatraceCollectorPlugin(environment, adapterCredentialFile(t))
+		c, err := plugin.NewCollector(
+			&autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default"}},
+			&MetricConfig{
+				MetricTypeName: MetricTypeName{Type: autoscalingv2.ExternalMetricSourceType, Name: "requests"},
+				Config:         config,
+			},
+			time.Minute,
+		)
+		if err != nil {
+			return nil, err
+		}
+		c.(*DynatraceCollector).httpClient = serverClient(t, server)
+		return c, nil
+	},
+	credential: func(r *http.Request) string {
+		return r.Header.Get("Authorization")
+	},
+	checkRequest: func(t *testing.T, r *http.Request, config map[string]string) {
+		if r.URL.Path != "/api/v2/metrics/query" || r.URL.Query().Get("entitySelector") != config["entity-selector"] {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+	},
+}
+
+func TestDynatraceCollectorCredentials(t *testing.T) {
+	dynatraceBackendTest.testCredentials(t, []backendCredentialTestCase{
+		{
+			msg:        "environment of the adapter",
+			adapter:    "https://abc12345.live.dynatrace.com",
+			target:     "abc12345.live.dynatrace.com",
+			credential: "Api-Token " + adapterCredential,
+		},
+		{
+			msg:        "same environment as the adapter",
+			adapter:    "https://abc12345.live.dynatrace.com",
+			config:     map[string]string{"environment": "https://abc12345.live.dynatrace.com/"},
+			target:     "abc12345.live.dynatrace.com",
+			credential: "Api-Token " + adapterCredential,
+		},
+		{
+			msg:        "token of the metric",
+			adapter:    "https://abc12345.live.dynatrace.com",
+			config:     map[string]string{"token": "secret"},
+			target:     "abc12345.live.dynatrace.com",
+			credential: "Api-Token secret",
+		},
+		{
+			msg:     "environment override with the token of the adapter",
+			adapter: "https://abc12345.live.dynatrace.com",
+			config:  map[string]string{"environment": "https://attacker.example.org"},
+			err:     true,
+		},
+		{
+			msg:    "environment without an adapter environment",
+			config: map[string]string{"environment": "https://xyz67890.live.dynatrace.com"},
+			err:    true,
+		},
+		{
+			msg:        "environment override with a token",
+			adapter:    "https://abc12345.live.dynatrace.com",
+			config:     map[string]string{"environment": "https://xyz67890.live.dynatrace.com", "token": "secret"},
+			target:     "xyz67890.live.dynatrace.com",
+			credential: "Api-Token secret",
+		},
+	})
+}
+
+func TestDynatraceCollector(t *testing.T) {
+	dynatraceBackendTest.testValues(t, []backendValueTestCase{
+		{
+			msg:      "latest value",
+			body:     `{"result":[{"metricId":"builtin:service.requestCount.total","data":[{"values":[1,2,null]}]}]}`,
+			expected: 2000,
+		},
+		{
+			msg:      "average of entities",
+			body:     `{"result":[{"metricId":"builtin:service.requestCount.total","data":[{"values":[1]},{"values":[2]}]}]}`,
+			expected: 1500,
+		},
+		{
+			msg:  "no values",
+			body: `{"result":[{"metricId":"builtin:service.requestCount.total","data":[{"values":[null]}]}]}`,
+			err:  true,
+		},
+	})
+}
@@ -0,0 +1,213 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+)
+
+// defaultExternalPluginTimeout is the timeout of the requests to an external
+// plugin process without a timeout.
+const defaultExternalPluginTimeout = 15 * time.Second
+
+// ExternalPluginConfig configures a collector plugin implemented by an
+// external process serving collections over HTTP.
+type ExternalPluginConfig struct {
+	// Name is the collector name of the plugin, used as the collector
+	// name in the metric annotations.
+	Name string `json:"name"`
+	// Type is the metric type collected by the plugin, Pods, Object or
+	// External.
+	Type string `json:"type"`
+	// Kind limits an Object plugin to objects of the kind.
+	Kind string `json:"kind,omitempty"`
+	// Metrics are the names of the external metrics collected by an
+	// External plugin, in addition to the metrics of its name.
+	Metrics []string `json:"metrics,omitempty"`
+	// URL is the endpoint collections are posted to.
+	URL string `json:"url"`
+	// Timeout is the timeout of a collection request.
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+}
+
+// externalPluginRequest is the collection request posted to an external
+// plugin process.
+type externalPluginRequest struct {
+	Namespace string                         `json:"namespace"`
+	HPA       string                         `json:"hpa"`
+	Type      string                         `json:"type"`
+	Metric    string                         `json:"metric"`
+	Labels    map[string]string              `json:"labels,omitempty"`
+	Object    custom_metrics.ObjectReference `json:"object,omitempty"`
+	Config    map[string]string              `json:"config,omitempty"`
+}
+
+// externalPluginResponse is the response of an external plugin process.
+type externalPluginResponse struct {
+	Values []externalPluginValue `json:"values"`
+}
+
+// externalPluginValue is a value collected by an external plugin process.
+// Object is the described object of a custom metric, e.g. a pod, and
+// defaults to the object of the metric. Labels are the labels of an
+// external metric value.
+type externalPluginValue struct {
+	Value  float64                         `json:"value"`
+	Object *custom_metrics.ObjectReference `json:"object,omitempty"`
+	Labels map[string]string               `json:"labels,omitempty"`
+}
+
+// ExternalPlugin is a collector plugin initializing collectors which collect
+// from an external plugin process.
+type ExternalPlugin struct {
+	config     ExternalPluginConfig
+	httpClient *http.Client
+}
+
+// NewExternalPlugin initializes a new ExternalPlugin.
+func NewExternalPlugin(config ExternalPluginConfig) *ExternalPlugin {
+	timeout := config.Timeout.Duration
+	if timeout == 0 {
+		timeout = defaultExternalPluginTimeout
+	}
+
+	return &ExternalPlugin{
+		config: config,
+		httpClient: &http.Client{
+			Timeout:   timeout,
+			Transport: &http.Transport{},
+		},
+	}
+}
+
+// NewCollector initializes a new collector of the external plugin process.
+func (p *ExternalPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	if string(config.Type) != p.config.Type {
+		return nil, fmt.Errorf("plugin '%s' doesn't support %s metrics", p.config.Name, config.Type)
+	}
+
+	request, err := json.Marshal(externalPluginRequest{
+		Namespace: hpa.Namespace,
+		HPA:       hpa.Name,
+		Type:      string(config.Type),
+		Metric:    config.Name,
+		Labels:    config.Labels,
+		Object:    config.ObjectReference,
+		Config:    config.Config,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExternalPluginCollector{
+		plugin:          p,
+		request:         request,
+		metricType:      config.Type,
+		metricName:      config.Name,
+		labels:          config.Labels,
+		objectReference: config.ObjectReference,
+		interval:        interval,
+	}, nil
+}
+
+// ExternalPluginCollector is a collector posting collection requests to an
+// external plugin process.
+type ExternalPluginCollector struct {
+	plugin          *ExternalPlugin
+	request         []byte
+	metricType      autoscalingv2.MetricSourceType
+	metricName      string
+	labels          map[string]string
+	objectReference custom_metrics.ObjectReference
+	interval        time.Duration
+}
+
+// GetMetrics posts a collection request to the plugin process and returns
+// the values of its response.
+func (c *ExternalPluginCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	request, err := http.NewRequest(http.MethodPost, c.plugin.config.URL, bytes.NewReader(c.request))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.plugin.httpClient.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("plugin '%s': %v", c.plugin.config.Name, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if retryErr := retryAfterFromResponse(resp); retryErr != nil {
+			return nil, retryErr
+		}
+		return nil, fmt.Errorf("plugin '%s': unsuccessful response: %s", c.plugin.config.Name, resp.Status)
+	}
+
+	var response externalPluginResponse
+	err = json.Unmarshal(data, &response)
+	if err != nil {
+		return nil, fmt.Errorf("plugin '%s': invalid response: %v", c.plugin.config.Name, err)
+	}
+
+	now := metav1.Time{Time: time.Now().UTC()}
+	values := make([]CollectedMetric, 0, len(response.Values))
+	for _, v := range response.Values {
+		value := *resource.NewMilliQuantity(int64(v.Value*1000), resource.DecimalSI)
+		metricValue := CollectedMetric{
+			Type: c.metricType,
+		}
+
+		switch c.metricType {
+		case autoscalingv2.ExternalMetricSourceType:
+			labels := v.Labels
+			if labels == nil {
+				labels = c.labels
+			}
+			metricValue.External = external_metrics.ExternalMetricValue{
+				MetricName:   c.metricName,
+				MetricLabels: labels,
+				Timestamp:    now,
+				Value:        value,
+			}
+		default:
+			object := c.objectReference
+			if v.Object != nil {
+				object = *v.Object
+			}
+			if c.metricType == autoscalingv2.PodsMetricSourceType && object.Kind != "Pod" {
+				return nil, fmt.Errorf("plugin '%s': value of pods metric '%s' doesn't describe a pod", c.plugin.config.Name, c.metricName)
+			}
+			metricValue.Custom = custom_metrics.MetricValue{
+				DescribedObject: object,
+				Metric:          custom_metrics.MetricIdentifier{Name: c.metricName},
+				Timestamp:       now,
+				Value:           value,
+			}
+		}
+
+		values = append(values, metricValue)
+	}
+
+	return values, nil
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *ExternalPluginCollector) Interval() time.Duration {
+	return c.interval
+}
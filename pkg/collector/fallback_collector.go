@@ -0,0 +1,136 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// FallbackCollectorName is the name of the fallback collector.
+	FallbackCollectorName = "fallback"
+
+	defaultFallbackFailureThreshold = 3
+)
+
+// FallbackCollectorPlugin is a collector plugin for initializing collectors
+// which collect a metric from a primary source and fall back to a secondary
+// source while the primary source is failing.
+type FallbackCollectorPlugin struct {
+	factory *CollectorFactory
+}
+
+// NewFallbackCollectorPlugin initializes a new FallbackCollectorPlugin. The
+// sources are initialized from the plugins registered in the factory.
+func NewFallbackCollectorPlugin(factory *CollectorFactory) *FallbackCollectorPlugin {
+	return &FallbackCollectorPlugin{
+		factory: factory,
+	}
+}
+
+// NewCollector initializes a new fallback collector from the specified HPA.
+func (p *FallbackCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	c := &FallbackCollector{
+		hpa:              hpa,
+		metricName:       config.Name,
+		failureThreshold: defaultFallbackFailureThreshold,
+		recorder:         p.factory.recorder,
+		interval:         interval,
+	}
+
+	for _, source := range []struct {
+		name      string
+		collector *Collector
+	}{
+		{crossCheckPrimary, &c.primary},
+		{crossCheckSecondary, &c.secondary},
+	} {
+		sourceConfig, err := subMetricConfig(config, source.name)
+		if err != nil {
+			return nil, err
+		}
+
+		if sourceConfig.CollectorName == FallbackCollectorName {
+			return nil, fmt.Errorf("%s source of fallback can't be a fallback", source.name)
+		}
+
+		*source.collector, err = p.factory.newPluginCollector(hpa, sourceConfig, interval)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize %s source of fallback: %v", source.name, err)
+		}
+	}
+
+	if v, ok := config.Config["failure-threshold"]; ok {
+		threshold, err := strconv.Atoi(v)
+		if err != nil || threshold < 1 {
+			return nil, fmt.Errorf("invalid failure threshold '%s'", v)
+		}
+		c.failureThreshold = threshold
+	}
+
+	return c, nil
+}
+
+// FallbackCollector is a metrics collector which collects a metric from
+// a primary source and switches to a secondary source after the primary
+// source failed the configured number of consecutive times. While the
+// secondary source is used, the primary source is still tried on every
+// collection and used again as soon as it recovers.
+type FallbackCollector struct {
+	primary          Collector
+	secondary        Collector
+	hpa              *autoscalingv2.HorizontalPodAutoscaler
+	metricName       string
+	failureThreshold int
+	failures         int
+	recorder         record.EventRecorder
+	interval         time.Duration
+}
+
+// GetMetrics collects the metric from the primary source or from the
+// secondary source if the primary source is failing.
+func (c *FallbackCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	values, err := c.primary.GetMetrics(ctx)
+	if err == nil {
+		if c.failures >= c.failureThreshold {
+			c.event(v1.EventTypeNormal, fmt.Sprintf("%s source of metric '%s' recovered, switching back from %s source", crossCheckPrimary, c.metricName, crossCheckSecondary))
+		}
+		c.failures = 0
+		return values, nil
+	}
+
+	c.failures++
+	if c.failures < c.failureThreshold {
+		return nil, fmt.Errorf("failed to get metrics from %s source: %v", crossCheckPrimary, err)
+	}
+
+	if c.failures == c.failureThreshold {
+		c.event(v1.EventTypeWarning, fmt.Sprintf("%s source of metric '%s' failed %d times, switching to %s source: %v", crossCheckPrimary, c.metricName, c.failures, crossCheckSecondary, err))
+	}
+
+	values, secondaryErr := c.secondary.GetMetrics(ctx)
+	if secondaryErr != nil {
+		return nil, fmt.Errorf("failed to get metrics from %s source: %v, %s source: %v", crossCheckPrimary, err, crossCheckSecondary, secondaryErr)
+	}
+
+	return values, nil
+}
+
+// event logs the switch between sources and records it as event on the HPA.
+func (c *FallbackCollector) event(eventType, message string) {
+	glog.Info(message)
+	if c.recorder != nil {
+		c.recorder.Event(c.hpa, eventType, "MetricSourceSwitched", message)
+	}
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *FallbackCollector) Interval() time.Duration {
+	return c.interval
+}
@@ -0,0 +1,374 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+)
+
+const (
+	// GCPMonitoringCollectorName is the name of the Google Cloud
+	// Monitoring collector.
+	GCPMonitoringCollectorName = "gcp-monitoring"
+
+	gcpMonitoringEndpoint               = "https://monitoring.googleapis.com/v3"
+	gcpMonitoringScope                  = "https://www.googleapis.com/auth/monitoring.read"
+	gcpMonitoringDefaultWindow          = 5 * time.Minute
+	gcpMonitoringDefaultAlignmentPeriod = time.Minute
+)
+
+// GCPMonitoringCollectorPlugin is a collector plugin for initializing
+// collectors which query time series from Google Cloud Monitoring
+// (Stackdriver).
+type GCPMonitoringCollectorPlugin struct {
+	project         string
+	credentialsFile string
+
+	// defaultCredentials are the credentials of metrics without a service
+	// account key, looked up once they are first needed.
+	defaultCredentials *google.Credentials
+	sync.Mutex
+}
+
+// NewGCPMonitoringCollectorPlugin initializes a new
+// GCPMonitoringCollectorPlugin. Metrics without a service account key use
+// the key of the credentials file, if set, or the application default
+// credentials, e.g. of Workload Identity. The project is used for metrics
+// which don't define a project, defaulting to the project of the
+// credentials.
+func NewGCPMonitoringCollectorPlugin(project, credentialsFile string) *GCPMonitoringCollectorPlugin {
+	return &GCPMonitoringCollectorPlugin{
+		project:         project,
+		credentialsFile: credentialsFile,
+	}
+}
+
+// SetDefaultCredentials sets the credentials of metrics without a service
+// account key instead of looking them up.
+func (p *GCPMonitoringCollectorPlugin) SetDefaultCredentials(credentials *google.Credentials) {
+	p.Lock()
+	defer p.Unlock()
+	p.defaultCredentials = credentials
+}
+
+// credentials returns the credentials of a metric, parsed from its service
+// account key if it defines one.
+func (p *GCPMonitoringCollectorPlugin) credentials(key string) (*google.Credentials, error) {
+	if key != "" {
+		return google.CredentialsFromJSON(context.Background(), []byte(key), gcpMonitoringScope)
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	if p.defaultCredentials != nil {
+		return p.defaultCredentials, nil
+	}
+
+	var credentials *google.Credentials
+	if p.credentialsFile != "" {
+		data, err := ioutil.ReadFile(p.credentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		credentials, err = google.CredentialsFromJSON(context.Background(), data, gcpMonitoringScope)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		credentials, err = google.FindDefaultCredentials(context.Background(), gcpMonitoringScope)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p.defaultCredentials = credentials
+	return credentials, nil
+}
+
+// NewCollector initializes a new Google Cloud Monitoring collector from the
+// specified HPA.
+func (p *GCPMonitoringCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	if config.Type != autoscalingv2.ExternalMetricSourceType {
+		return nil, fmt.Errorf("gcp-monitoring collector only supports external metrics")
+	}
+
+	filter, hasFilter := config.Config["filter"]
+	query, hasQuery := config.Config["query"]
+	if hasFilter == hasQuery {
+		return nil, fmt.Errorf("either a time series filter or an mql query must be defined")
+	}
+
+	serviceAccountKey := config.Config["service-account-key"]
+	credentials, err := p.credentials(serviceAccountKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get google cloud credentials: %v", err)
+	}
+
+	c := &GCPMonitoringCollector{
+		hpa:             hpa,
+		project:         p.project,
+		filter:          filter,
+		query:           query,
+		window:          gcpMonitoringDefaultWindow,
+		alignmentPeriod: gcpMonitoringDefaultAlignmentPeriod,
+		aligner:         config.Config["aligner"],
+		reducer:         config.Config["reducer"],
+		aggregation:     seriesAggregationAvg,
+		metricName:      config.Name,
+		labels:          config.Labels,
+		interval:        interval,
+		httpClient: &http.Client{
+			Timeout: 15 * time.Second,
+			Transport: &oauth2.Transport{
+				Source: credentials.TokenSource,
+				Base:   &http.Transport{},
+			},
+		},
+	}
+
+	if c.project == "" {
+		c.project = credentials.ProjectID
+	}
+	// the credentials of the adapter must not be used to query the
+	// projects of other tenants, so the project can only be overridden
+	// along with the service account key of the metric.
+	if v, ok := config.Config["project"]; ok && v != c.project {
+		if serviceAccountKey == "" {
+			return nil, fmt.Errorf("the google cloud project can only be overridden together with a service account key")
+		}
+		c.project = v
+	}
+	if c.project == "" {
+		return nil, fmt.Errorf("no google cloud project defined")
+	}
+
+	if hasQuery && (c.aligner != "" || c.reducer != "") {
+		return nil, fmt.Errorf("aligner and reducer are only supported with a time series filter")
+	}
+
+	if v, ok := config.Config["window"]; ok {
+		window, err := time.ParseDuration(v)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("invalid gcp-monitoring window '%s'", v)
+		}
+		c.window = window
+	}
+
+	if v, ok := config.Config["alignment-period"]; ok {
+		period, err := time.ParseDuration(v)
+		if err != nil || period < time.Minute {
+			return nil, fmt.Errorf("invalid gcp-monitoring alignment period '%s', must be at least 1m", v)
+		}
+		c.alignmentPeriod = period
+	}
+
+	if v, ok := config.Config["aggregation"]; ok {
+		if !validSeriesAggregation(v) {
+			return nil, fmt.Errorf("unsupported gcp-monitoring aggregation '%s'", v)
+		}
+		c.aggregation = v
+	}
+
+	return c, nil
+}
+
+// GCPMonitoringCollector is a metrics collector which exposes the latest
+// value of a Cloud Monitoring time series filter or MQL query as external
+// metric. The latest values of several time series are aggregated.
+type GCPMonitoringCollector struct {
+	hpa             *autoscalingv2.HorizontalPodAutoscaler
+	project         string
+	filter          string
+	query           string
+	window          time.Duration
+	alignmentPeriod time.Duration
+	aligner         string
+	reducer         string
+	aggregation     string
+	metricName      string
+	labels          map[string]string
+	interval        time.Duration
+	httpClient      *http.Client
+}
+
+// gcpTypedValue is a value of a time series point. 64 bit integers are
+// encoded as strings.
+type gcpTypedValue struct {
+	DoubleValue *float64 `json:"doubleValue"`
+	Int64Value  *int64   `json:"int64Value,string"`
+	BoolValue   *bool    `json:"boolValue"`
+}
+
+// float returns the value as float and false if the value isn't numeric.
+func (v gcpTypedValue) float() (float64, bool) {
+	switch {
+	case v.DoubleValue != nil:
+		return *v.DoubleValue, true
+	case v.Int64Value != nil:
+		return float64(*v.Int64Value), true
+	case v.BoolValue != nil:
+		if *v.BoolValue {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// gcpListTimeSeriesResponse is the response of listing time series by
+// filter. The points of a time series are ordered newest first.
+type gcpListTimeSeriesResponse struct {
+	TimeSeries []struct {
+		Points []struct {
+			Value gcpTypedValue `json:"value"`
+		} `json:"points"`
+	} `json:"timeSeries"`
+}
+
+// gcpQueryTimeSeriesResponse is the response of an MQL query. The points of
+// a time series are ordered newest first.
+type gcpQueryTimeSeriesResponse struct {
+	TimeSeriesData []struct {
+		PointData []struct {
+			Values []gcpTypedValue `json:"values"`
+		} `json:"pointData"`
+	} `json:"timeSeriesData"`
+}
+
+// GetMetrics queries the time series and returns the latest value.
+func (c *GCPMonitoringCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	var values []float64
+	var err error
+	if c.query != "" {
+		values, err = c.queryTimeSeries(ctx)
+	} else {
+		values, err = c.listTimeSeries(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("gcp-monitoring query of project '%s' returned no points within %s", c.project, c.window)
+	}
+	value := aggregateSeries(values, c.aggregation)
+
+	metricValue := CollectedMetric{
+		Type: autoscalingv2.ExternalMetricSourceType,
+		External: external_metrics.ExternalMetricValue{
+			MetricName:   c.metricName,
+			MetricLabels: c.labels,
+			Timestamp:    metav1.Time{Time: time.Now().UTC()},
+		},
+	}
+	err = metricValue.setFloatValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return []CollectedMetric{metricValue}, nil
+}
+
+// listTimeSeries lists the time series matching the filter within the
+// window and returns the latest value of each.
+func (c *GCPMonitoringCollector) listTimeSeries(ctx context.Context) ([]float64, error) {
+	now := time.Now().UTC()
+	params := url.Values{}
+	params.Set("filter", c.filter)
+	params.Set("interval.startTime", now.Add(-c.window).Format(time.RFC3339))
+	params.Set("interval.endTime", now.Format(time.RFC3339))
+	if c.aligner != "" || c.reducer != "" {
+		params.Set("aggregation.alignmentPeriod", strconv.Itoa(int(c.alignmentPeriod.Seconds()))+"s")
+	}
+	if c.aligner != "" {
+		params.Set("aggregation.perSeriesAligner", c.aligner)
+	}
+	if c.reducer != "" {
+		params.Set("aggregation.crossSeriesReducer", c.reducer)
+	}
+
+	auditQuery(c.hpa, c.metricName, GCPMonitoringCollectorName, c.filter)
+
+	endpoint := fmt.Sprintf("%s/projects/%s/timeSeries?%s", gcpMonitoringEndpoint, url.PathEscape(c.project), params.Encode())
+	request, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var response gcpListTimeSeriesResponse
+	err = doJSON(ctx, c.httpClient, request, &response)
+	if err != nil {
+		return nil, fmt.Errorf("gcp-monitoring query failed: %v", err)
+	}
+
+	var values []float64
+	for _, series := range response.TimeSeries {
+		for _, point := range series.Points {
+			if value, ok := point.Value.float(); ok {
+				values = append(values, value)
+				break
+			}
+		}
+	}
+	return values, nil
+}
+
+// queryTimeSeries runs the MQL query, limited to the window, and returns
+// the latest value of each resulting time series.
+func (c *GCPMonitoringCollector) queryTimeSeries(ctx context.Context) ([]float64, error) {
+	query := fmt.Sprintf("%s | within %ds", c.query, int(c.window.Seconds()))
+
+	body, err := json.Marshal(map[string]string{"query": query})
+	if err != nil {
+		return nil, err
+	}
+
+	auditQuery(c.hpa, c.metricName, GCPMonitoringCollectorName, query)
+
+	endpoint := fmt.Sprintf("%s/projects/%s/timeSeries:query", gcpMonitoringEndpoint, url.PathEscape(c.project))
+	request, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	var response gcpQueryTimeSeriesResponse
+	err = doJSON(ctx, c.httpClient, request, &response)
+	if err != nil {
+		return nil, fmt.Errorf("gcp-monitoring mql query failed: %v", err)
+	}
+
+	var values []float64
+	for _, series := range response.TimeSeriesData {
+		for _, point := range series.PointData {
+			if len(point.Values) == 0 {
+				continue
+			}
+			if value, ok := point.Values[0].float(); ok {
+				values = append(values, value)
+				break
+			}
+		}
+	}
+	return values, nil
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *GCPMonitoringCollector) Interval() time.Duration {
+	return c.interval
+}
@@ -0,0 +1,153 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// gcpBackendTest returns a test of a Google Cloud Monitoring collector
+// created by the plugin. The default credentials of the plugin are of the
+// project "platform". The service account key of a test case is the
+// project of the key, which is replaced by a key getting the token "secret"
+// from the test server. The backend of a request is the project it queries.
+func gcpBackendTest(config map[string]string, newPlugin func(gcpPlugin *GCPMonitoringCollectorPlugin) CollectorPlugin) backendTest {
+	return backendTest{
+		adapter: "shop",
+		config:  config,
+		newCollector: func(t *testing.T, server *httptest.Server, project string, config map[string]string) (Collector, error) {
+			gcpPlugin := NewGCPMonitoringCollectorPlugin(project, "")
+			gcpPlugin.SetDefaultCredentials(&google.Credentials{
+				ProjectID:   "platform",
+				TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: adapterCredential}),
+			})
+			if v, ok := config["service-account-key"]; ok {
+				config["service-account-key"] = fmt.Sprintf(`{"type":"authorized_user","project_id":"%s","client_id":"id","client_secret":"secret","refresh_token":"secret","token_uri":"%s/token"}`, v, server.URL)
+			}
+
+			c, err := newPlugin(gcpPlugin).NewCollector(
+				&autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default"}},
+				&MetricConfig{
+					MetricTypeName: MetricTypeName{Type: autoscalingv2.ExternalMetricSourceType, Name: "messages"},
+					Config:         config,
+				},
+				time.Minute,
+			)
+			if err != nil {
+				return nil, err
+			}
+			c.(*GCPMonitoringCollector).httpClient.Transport.(*oauth2.Transport).Base = serverClient(t, server).Transport
+			return c, nil
+		},
+		target: func(r *http.Request) string {
+			if r.Host != "monitoring.googleapis.com" {
+				return r.Host
+			}
+			project := strings.TrimPrefix(r.URL.Path, "/v3/projects/")
+			return project[:strings.Index(project, "/")]
+		},
+		credential: func(r *http.Request) string {
+			return r.Header.Get("Authorization")
+		},
+		serve: func(w http.ResponseWriter, r *http.Request) bool {
+			if r.URL.Path != "/token" {
+				return false
+			}
+			_ = r.ParseForm()
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token": r.Form.Get("refresh_token"),
+				"token_type":   "Bearer",
+				"expires_in":   3600,
+			})
+			return true
+		},
+	}
+}
+
+// gcpMonitoringBackendTest tests the Google Cloud Monitoring collector.
+var gcpMonitoringBackendTest = func() backendTest {
+	b := gcpBackendTest(
+		map[string]string{"filter": `metric.type = "pubsub.googleapis.com/subscription/num_undelivered_messages"`},
+		func(gcpPlugin *GCPMonitoringCollectorPlugin) CollectorPlugin { return gcpPlugin },
+	)
+	b.checkRequest = func(t *testing.T, r *http.Request, config map[string]string) {
+		path := "/v3/projects/shop/timeSeries"
+		if _, ok := config["query"]; ok {
+			path += ":query"
+		}
+		if r.Host != "monitoring.googleapis.com" || r.URL.Path != path {
+			t.Errorf("unexpected request to %s%s", r.Host, r.URL.Path)
+		}
+	}
+	return b
+}()
+
+func TestGCPMonitoringCollectorCredentials(t *testing.T) {
+	gcpMonitoringBackendTest.testCredentials(t, []backendCredentialTestCase{
+		{
+			msg:        "project of the adapter",
+			adapter:    "shop",
+			target:     "shop",
+			credential: "Bearer " + adapterCredential,
+		},
+		{
+			msg:        "project of the credentials",
+			config:     map[string]string{"project": "platform"},
+			target:     "platform",
+			credential: "Bearer " + adapterCredential,
+		},
+		{
+			msg:     "project override with the credentials of the adapter",
+			adapter: "shop",
+			config:  map[string]string{"project": "team-b"},
+			err:     true,
+		},
+		{
+			msg:        "project of the service account key",
+			config:     map[string]string{"service-account-key": "team-a"},
+			target:     "team-a",
+			credential: "Bearer secret",
+		},
+		{
+			msg:        "project override with a service account key",
+			adapter:    "shop",
+			config:     map[string]string{"project": "team-a", "service-account-key": "team-a"},
+			target:     "team-a",
+			credential: "Bearer secret",
+		},
+	})
+}
+
+func TestGCPMonitoringCollector(t *testing.T) {
+	gcpMonitoringBackendTest.testValues(t, []backendValueTestCase{
+		{
+			msg:      "latest point of time series",
+			body:     `{"timeSeries":[{"points":[{"value":{"int64Value":"12"}},{"value":{"int64Value":"3"}}]},{"points":[{"value":{"doubleValue":4}}]}]}`,
+			expected: 8000,
+		},
+		{
+			msg: "mql query",
+			config: map[string]string{
+				"filter": "",
+				"query":  "fetch pubsub_subscription | metric 'pubsub.googleapis.com/subscription/num_undelivered_messages'",
+			},
+			body:     `{"timeSeriesData":[{"pointData":[{"values":[{"doubleValue":1.5}]},{"values":[{"doubleValue":9}]}]}]}`,
+			expected: 1500,
+		},
+		{
+			msg:  "no points",
+			body: `{}`,
+			err:  true,
+		},
+	})
+}
@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+)
+
+const (
+	// PubSubCollectorName is the name of the Pub/Sub collector.
+	PubSubCollectorName = "pubsub"
+
+	pubSubDefaultMetric = "undelivered-messages"
+)
+
+// pubSubMetrics are the Cloud Monitoring metric types of the supported
+// subscription metrics by name.
+var pubSubMetrics = map[string]string{
+	"undelivered-messages": "pubsub.googleapis.com/subscription/num_undelivered_messages",
+	"oldest-unacked-age":   "pubsub.googleapis.com/subscription/oldest_unacked_message_age",
+}
+
+// PubSubCollectorPlugin is a collector plugin for initializing collectors
+// which expose the backlog of Pub/Sub subscriptions.
+type PubSubCollectorPlugin struct {
+	monitoring *GCPMonitoringCollectorPlugin
+}
+
+// NewPubSubCollectorPlugin initializes a new PubSubCollectorPlugin querying
+// the subscription metrics with the Cloud Monitoring plugin.
+func NewPubSubCollectorPlugin(monitoring *GCPMonitoringCollectorPlugin) *PubSubCollectorPlugin {
+	return &PubSubCollectorPlugin{
+		monitoring: monitoring,
+	}
+}
+
+// NewCollector initializes a new Pub/Sub collector from the specified HPA.
+// The collector is a Cloud Monitoring collector of the metric of the
+// subscription.
+func (p *PubSubCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	subscription, ok := config.Config["subscription"]
+	if !ok {
+		return nil, fmt.Errorf("no pubsub subscription defined")
+	}
+
+	name := pubSubDefaultMetric
+	if v, ok := config.Config["metric"]; ok {
+		name = v
+	}
+	metricType, ok := pubSubMetrics[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported pubsub metric '%s'", name)
+	}
+
+	monitoringConfig := *config
+	monitoringConfig.Config = map[string]string{
+		"filter":  fmt.Sprintf(`metric.type=%s AND resource.type="pubsub_subscription" AND resource.labels.subscription_id=%s`, strconv.Quote(metricType), strconv.Quote(subscription)),
+		"aligner": "ALIGN_MAX",
+	}
+	for _, key := range []string{"project", "window", "service-account-key"} {
+		if v, ok := config.Config[key]; ok {
+			monitoringConfig.Config[key] = v
+		}
+	}
+
+	return p.monitoring.NewCollector(hpa, &monitoringConfig, interval)
+}
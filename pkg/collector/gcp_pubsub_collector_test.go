@@ -0,0 +1,76 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// pubSubBackendTest tests the Pub/Sub collector.
+var pubSubBackendTest = func() backendTest {
+	b := gcpBackendTest(
+		map[string]string{"subscription": "orders"},
+		func(gcpPlugin *GCPMonitoringCollectorPlugin) CollectorPlugin {
+			return NewPubSubCollectorPlugin(gcpPlugin)
+		},
+	)
+	b.checkRequest = func(t *testing.T, r *http.Request, config map[string]string) {
+		metricType := map[string]string{
+			"":                   "num_undelivered_messages",
+			"oldest-unacked-age": "oldest_unacked_message_age",
+		}[config["metric"]]
+		filter := fmt.Sprintf(`metric.type="pubsub.googleapis.com/subscription/%s" AND resource.type="pubsub_subscription" AND resource.labels.subscription_id="%s"`, metricType, config["subscription"])
+		if r.URL.Path != "/v3/projects/shop/timeSeries" || r.URL.Query().Get("filter") != filter {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		if aligner := r.URL.Query().Get("aggregation.perSeriesAligner"); aligner != "ALIGN_MAX" {
+			t.Errorf("expected aligner ALIGN_MAX, got '%s'", aligner)
+		}
+	}
+	return b
+}()
+
+func TestPubSubCollectorCredentials(t *testing.T) {
+	pubSubBackendTest.testCredentials(t, []backendCredentialTestCase{
+		{
+			msg:        "project of the adapter",
+			adapter:    "shop",
+			target:     "shop",
+			credential: "Bearer " + adapterCredential,
+		},
+		{
+			msg:     "project override with the credentials of the adapter",
+			adapter: "shop",
+			config:  map[string]string{"project": "team-b"},
+			err:     true,
+		},
+		{
+			msg:        "project override with a service account key",
+			adapter:    "shop",
+			config:     map[string]string{"project": "team-a", "service-account-key": "team-a"},
+			target:     "team-a",
+			credential: "Bearer secret",
+		},
+	})
+}
+
+func TestPubSubCollector(t *testing.T) {
+	pubSubBackendTest.testValues(t, []backendValueTestCase{
+		{
+			msg:      "undelivered messages",
+			body:     `{"timeSeries":[{"points":[{"value":{"int64Value":"25"}}]}]}`,
+			expected: 25000,
+		},
+		{
+			msg:      "age of the oldest unacked message",
+			config:   map[string]string{"metric": "oldest-unacked-age"},
+			body:     `{"timeSeries":[{"points":[{"value":{"int64Value":"25"}}]}]}`,
+			expected: 25000,
+		},
+		{
+			msg:    "unsupported metric",
+			config: map[string]string{"metric": "ack-latency"},
+			err:    true,
+		},
+	})
+}
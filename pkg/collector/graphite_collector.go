@@ -0,0 +1,175 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+)
+
+const (
+	// GraphiteCollectorName is the name of the Graphite collector.
+	GraphiteCollectorName = "graphite"
+
+	graphiteDefaultFrom = "-5min"
+)
+
+// GraphiteCollectorPlugin is a collector plugin for initializing collectors
+// which query the render API of Graphite.
+type GraphiteCollectorPlugin struct {
+	address string
+}
+
+// NewGraphiteCollectorPlugin initializes a new GraphiteCollectorPlugin
+// querying the server.
+func NewGraphiteCollectorPlugin(address string) (*GraphiteCollectorPlugin, error) {
+	if _, err := url.Parse(address); err != nil {
+		return nil, fmt.Errorf("invalid graphite server '%s': %v", address, err)
+	}
+
+	return &GraphiteCollectorPlugin{
+		address: strings.TrimSuffix(address, "/"),
+	}, nil
+}
+
+// NewCollector initializes a new Graphite collector from the specified HPA.
+func (p *GraphiteCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	if config.Type != autoscalingv2.ExternalMetricSourceType {
+		return nil, fmt.Errorf("graphite collector only supports external metrics")
+	}
+
+	target, ok := config.Config["target"]
+	if !ok {
+		return nil, fmt.Errorf("no graphite target defined")
+	}
+
+	c := &GraphiteCollector{
+		hpa:         hpa,
+		address:     p.address,
+		target:      target,
+		from:        graphiteDefaultFrom,
+		aggregation: seriesAggregationAvg,
+		metricName:  config.Name,
+		labels:      config.Labels,
+		interval:    interval,
+		httpClient: &http.Client{
+			Timeout:   15 * time.Second,
+			Transport: &http.Transport{},
+		},
+	}
+
+	if v, ok := config.Config["from"]; ok {
+		c.from = v
+	}
+
+	if v, ok := config.Config["aggregation"]; ok {
+		if !validSeriesAggregation(v) {
+			return nil, fmt.Errorf("unsupported graphite aggregation '%s'", v)
+		}
+		c.aggregation = v
+	}
+
+	return c, nil
+}
+
+// GraphiteCollector is a metrics collector which exposes the latest
+// datapoint of a Graphite target as external metric. The latest datapoints
+// of targets returning several series are aggregated.
+type GraphiteCollector struct {
+	hpa         *autoscalingv2.HorizontalPodAutoscaler
+	address     string
+	target      string
+	from        string
+	aggregation string
+	metricName  string
+	labels      map[string]string
+	interval    time.Duration
+	httpClient  *http.Client
+}
+
+// graphiteSeries is a series of the JSON response of the render API. Each
+// datapoint is a pair of value, which is null for missing values, and
+// timestamp.
+type graphiteSeries struct {
+	Target     string        `json:"target"`
+	Datapoints [][2]*float64 `json:"datapoints"`
+}
+
+// GetMetrics queries the target and returns its latest datapoint.
+func (c *GraphiteCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	series, err := c.render(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := c.aggregate(series)
+	if err != nil {
+		return nil, err
+	}
+
+	metricValue := CollectedMetric{
+		Type: autoscalingv2.ExternalMetricSourceType,
+		External: external_metrics.ExternalMetricValue{
+			MetricName:   c.metricName,
+			MetricLabels: c.labels,
+			Timestamp:    metav1.Time{Time: time.Now().UTC()},
+		},
+	}
+	err = metricValue.setFloatValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return []CollectedMetric{metricValue}, nil
+}
+
+// render queries the render API for the series of the target.
+func (c *GraphiteCollector) render(ctx context.Context) ([]graphiteSeries, error) {
+	params := url.Values{}
+	params.Set("target", c.target)
+	params.Set("from", c.from)
+	params.Set("format", "json")
+
+	auditQuery(c.hpa, c.metricName, GraphiteCollectorName, c.target)
+
+	request, err := http.NewRequest(http.MethodGet, c.address+"/render?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var series []graphiteSeries
+	err = doJSON(ctx, c.httpClient, request, &series)
+	if err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+// aggregate aggregates the latest non-null datapoints of the series.
+func (c *GraphiteCollector) aggregate(series []graphiteSeries) (float64, error) {
+	var values []float64
+	for _, s := range series {
+		for i := len(s.Datapoints) - 1; i >= 0; i-- {
+			if value := s.Datapoints[i][0]; value != nil {
+				values = append(values, *value)
+				break
+			}
+		}
+	}
+
+	if len(values) == 0 {
+		return 0, fmt.Errorf("graphite target '%s' returned no datapoints from %s", c.target, c.from)
+	}
+	return aggregateSeries(values, c.aggregation), nil
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *GraphiteCollector) Interval() time.Duration {
+	return c.interval
+}
@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGraphiteCollector(t *testing.T) {
+	for _, tc := range []struct {
+		msg         string
+		aggregation string
+		status      int
+		body        string
+		expected    int64
+		err         bool
+	}{
+		{
+			msg:      "latest non-null datapoint",
+			status:   http.StatusOK,
+			body:     `[{"target":"jobs","datapoints":[[1,1000],[3,1060],[null,1120]]}]`,
+			expected: 3000,
+		},
+		{
+			msg:         "aggregated series",
+			aggregation: "sum",
+			status:      http.StatusOK,
+			body:        `[{"target":"a","datapoints":[[1.5,1000]]},{"target":"b","datapoints":[[2,1000]]}]`,
+			expected:    3500,
+		},
+		{
+			msg:    "no datapoints",
+			status: http.StatusOK,
+			body:   `[{"target":"jobs","datapoints":[[null,1000]]}]`,
+			err:    true,
+		},
+		{
+			msg:    "unsuccessful response",
+			status: http.StatusInternalServerError,
+			body:   "failed",
+			err:    true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/render" || r.URL.Query().Get("target") != "jobs.*" {
+					t.Errorf("unexpected request %s", r.URL)
+				}
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			plugin, err := NewGraphiteCollectorPlugin(server.URL)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			config := &MetricConfig{
+				MetricTypeName: MetricTypeName{Type: autoscalingv2.ExternalMetricSourceType, Name: "jobs"},
+				Config:         map[string]string{"target": "jobs.*"},
+			}
+			if tc.aggregation != "" {
+				config.Config["aggregation"] = tc.aggregation
+			}
+			hpa := &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default"}}
+			c, err := plugin.NewCollector(hpa, config, time.Minute)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			metrics, err := c.GetMetrics(context.Background())
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error, got %v", metrics)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(metrics) != 1 || metrics[0].External.Value.MilliValue() != tc.expected {
+				t.Errorf("expected value %dm, got %v", tc.expected, metrics)
+			}
+		})
+	}
+}
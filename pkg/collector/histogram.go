@@ -0,0 +1,257 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"k8s.io/api/core/v1"
+)
+
+// PrometheusHistogramCollectorName is the name of the pod collector which
+// scrapes a histogram from the Prometheus metrics endpoint of each pod.
+const PrometheusHistogramCollectorName = "prometheus-histogram"
+
+// defaultHistogramPercentile is the percentile served for metrics collected
+// as histograms if their config doesn't define one.
+const defaultHistogramPercentile = 99
+
+// HistogramBucket is a bucket of a histogram. Count is the cumulative count
+// of observations less than or equal to UpperBound.
+type HistogramBucket struct {
+	UpperBound float64
+	Count      float64
+}
+
+// histogramBucketJSON is the JSON encoding of a histogram bucket. The upper
+// bound is encoded as string as JSON doesn't support +Inf.
+type histogramBucketJSON struct {
+	UpperBound string  `json:"upperBound"`
+	Count      float64 `json:"count"`
+}
+
+// MarshalJSON encodes the bucket as JSON.
+func (b HistogramBucket) MarshalJSON() ([]byte, error) {
+	return json.Marshal(histogramBucketJSON{
+		UpperBound: strconv.FormatFloat(b.UpperBound, 'g', -1, 64),
+		Count:      b.Count,
+	})
+}
+
+// UnmarshalJSON decodes the bucket from JSON.
+func (b *HistogramBucket) UnmarshalJSON(data []byte) error {
+	var bucket histogramBucketJSON
+	err := json.Unmarshal(data, &bucket)
+	if err != nil {
+		return err
+	}
+
+	upperBound, err := strconv.ParseFloat(bucket.UpperBound, 64)
+	if err != nil {
+		return fmt.Errorf("invalid histogram bucket upper bound '%s': %v", bucket.UpperBound, err)
+	}
+
+	b.UpperBound = upperBound
+	b.Count = bucket.Count
+	return nil
+}
+
+// Histogram is a distribution of observations in cumulative buckets sorted
+// by their upper bound, like Prometheus histograms. The last bucket has an
+// upper bound of +Inf and counts all observations.
+type Histogram struct {
+	Buckets []HistogramBucket `json:"buckets"`
+}
+
+// Count returns the number of observations in the histogram.
+func (h *Histogram) Count() float64 {
+	if len(h.Buckets) == 0 {
+		return 0
+	}
+	return h.Buckets[len(h.Buckets)-1].Count
+}
+
+// Sub returns the observations made since the previous histogram. It
+// returns false if the buckets of the histograms differ or any count
+// decreased, e.g. because the process exposing the histogram restarted.
+func (h *Histogram) Sub(previous *Histogram) (*Histogram, bool) {
+	if previous == nil || len(previous.Buckets) != len(h.Buckets) {
+		return nil, false
+	}
+
+	result := &Histogram{Buckets: make([]HistogramBucket, 0, len(h.Buckets))}
+	for i, bucket := range h.Buckets {
+		prev := previous.Buckets[i]
+		if prev.UpperBound != bucket.UpperBound || prev.Count > bucket.Count {
+			return nil, false
+		}
+		result.Buckets = append(result.Buckets, HistogramBucket{
+			UpperBound: bucket.UpperBound,
+			Count:      bucket.Count - prev.Count,
+		})
+	}
+	return result, true
+}
+
+// Quantile estimates the q-quantile (0 < q < 1) of the observations by
+// linear interpolation within the bucket containing it, like the
+// histogram_quantile function of Prometheus. If the quantile falls into the
+// +Inf bucket the upper bound of the previous bucket is returned. It returns
+// 0 if the histogram has no observations.
+func (h *Histogram) Quantile(q float64) float64 {
+	count := h.Count()
+	if count == 0 {
+		return 0
+	}
+
+	rank := q * count
+	i := sort.Search(len(h.Buckets), func(i int) bool { return h.Buckets[i].Count >= rank })
+	if i == len(h.Buckets)-1 && math.IsInf(h.Buckets[i].UpperBound, 1) {
+		if i == 0 {
+			return 0
+		}
+		return h.Buckets[i-1].UpperBound
+	}
+
+	lowerBound, lowerCount := 0.0, 0.0
+	if i > 0 {
+		lowerBound = h.Buckets[i-1].UpperBound
+		lowerCount = h.Buckets[i-1].Count
+	}
+	bucket := h.Buckets[i]
+	if bucket.Count == lowerCount {
+		return bucket.UpperBound
+	}
+	return lowerBound + (bucket.UpperBound-lowerBound)*(rank-lowerCount)/(bucket.Count-lowerCount)
+}
+
+// histogramValue returns the percentile (0 < percentile < 100) of the
+// observations made since the previous histogram of a series was collected.
+// The percentile of all observations is returned if there is no previous
+// histogram or the histogram was reset in between. If there were no
+// observations since the previous collection the value is 0.
+func histogramValue(percentile float64, current, previous *Histogram) float64 {
+	histogram := current
+	if delta, ok := current.Sub(previous); ok {
+		histogram = delta
+	}
+	return histogram.Quantile(percentile / 100)
+}
+
+// PrometheusHistogramGetter is a pod metrics getter which scrapes a
+// histogram from the Prometheus metrics endpoint of a pod. The buckets of
+// all series of the histogram are summed up.
+type PrometheusHistogramGetter struct {
+	histogram string
+	scheme    string
+	path      string
+	port      int
+}
+
+// NewPrometheusHistogramGetter initializes a new PrometheusHistogramGetter.
+func NewPrometheusHistogramGetter(config map[string]string) (*PrometheusHistogramGetter, error) {
+	getter := &PrometheusHistogramGetter{
+		scheme: config["scheme"],
+		path:   config["path"],
+	}
+
+	histogram, ok := config["histogram"]
+	if !ok {
+		return nil, fmt.Errorf("histogram not specified")
+	}
+	getter.histogram = histogram
+
+	if v, ok := config["port"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		getter.port = n
+	}
+
+	return getter, nil
+}
+
+// GetMetric returns the number of observations of the histogram. The
+// percentile served for the metric is computed by the PodCollector from the
+// histogram returned by GetHistogram.
+func (g *PrometheusHistogramGetter) GetMetric(pod *v1.Pod) (float64, error) {
+	histogram, err := g.GetHistogram(pod)
+	if err != nil {
+		return 0, err
+	}
+	return histogram.Count(), nil
+}
+
+// GetHistogram scrapes the histogram from the metrics endpoint of the pod.
+func (g *PrometheusHistogramGetter) GetHistogram(pod *v1.Pod) (*Histogram, error) {
+	data, err := getPodMetrics(pod, g.scheme, g.path, g.port)
+	if err != nil {
+		return nil, err
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metrics: %v", err)
+	}
+
+	family, ok := families[g.histogram]
+	if !ok || family.GetType() != dto.MetricType_HISTOGRAM {
+		return nil, fmt.Errorf("histogram %s not found", g.histogram)
+	}
+
+	return sumHistograms(family.GetMetric())
+}
+
+// sumHistograms sums up the buckets of the series of a histogram, which must
+// all have the same buckets.
+func sumHistograms(metrics []*dto.Metric) (*Histogram, error) {
+	var result *Histogram
+	for _, metric := range metrics {
+		histogram := &Histogram{}
+		for _, bucket := range metric.GetHistogram().GetBucket() {
+			histogram.Buckets = append(histogram.Buckets, HistogramBucket{
+				UpperBound: bucket.GetUpperBound(),
+				Count:      float64(bucket.GetCumulativeCount()),
+			})
+		}
+		sort.Slice(histogram.Buckets, func(i, j int) bool {
+			return histogram.Buckets[i].UpperBound < histogram.Buckets[j].UpperBound
+		})
+
+		// the +Inf bucket is implicit in the text format.
+		last := len(histogram.Buckets) - 1
+		if last < 0 || !math.IsInf(histogram.Buckets[last].UpperBound, 1) {
+			histogram.Buckets = append(histogram.Buckets, HistogramBucket{
+				UpperBound: math.Inf(1),
+				Count:      float64(metric.GetHistogram().GetSampleCount()),
+			})
+		}
+
+		if result == nil {
+			result = histogram
+			continue
+		}
+
+		if len(result.Buckets) != len(histogram.Buckets) {
+			return nil, fmt.Errorf("series of the histogram have different buckets")
+		}
+		for i := range result.Buckets {
+			if result.Buckets[i].UpperBound != histogram.Buckets[i].UpperBound {
+				return nil, fmt.Errorf("series of the histogram have different buckets")
+			}
+			result.Buckets[i].Count += histogram.Buckets[i].Count
+		}
+	}
+
+	if result == nil {
+		return nil, fmt.Errorf("histogram has no series")
+	}
+	return result, nil
+}
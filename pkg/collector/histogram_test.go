@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// histogram returns a histogram with buckets of the upper bounds 0.1, 0.5,
+// 1 and +Inf and the cumulative counts.
+func histogram(counts ...float64) *Histogram {
+	h := &Histogram{}
+	for i, bound := range []float64{0.1, 0.5, 1, math.Inf(1)} {
+		h.Buckets = append(h.Buckets, HistogramBucket{UpperBound: bound, Count: counts[i]})
+	}
+	return h
+}
+
+func TestHistogramValue(t *testing.T) {
+	for _, tc := range []struct {
+		msg      string
+		current  *Histogram
+		previous *Histogram
+		expected float64
+	}{
+		{
+			msg:      "no previous histogram",
+			current:  histogram(90, 100, 100, 100),
+			expected: 0.46,
+		},
+		{
+			msg:      "observations since the previous histogram",
+			current:  histogram(90, 100, 200, 200),
+			previous: histogram(90, 100, 100, 100),
+			expected: 0.995,
+		},
+		{
+			msg:      "no observations since the previous histogram",
+			current:  histogram(90, 100, 100, 100),
+			previous: histogram(90, 100, 100, 100),
+			expected: 0,
+		},
+		{
+			msg:      "histogram reset",
+			current:  histogram(10, 10, 10, 10),
+			previous: histogram(90, 100, 100, 100),
+			expected: 0.099,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			value := histogramValue(99, tc.current, tc.previous)
+			if math.Abs(value-tc.expected) > 1e-9 {
+				t.Errorf("expected %f, got %f", tc.expected, value)
+			}
+		})
+	}
+}
+
+// fakeHistogramGetter returns the histograms of pods by name in order of
+// the collections.
+type fakeHistogramGetter struct {
+	histograms map[string][]*Histogram
+}
+
+func (g *fakeHistogramGetter) GetMetric(pod *v1.Pod) (float64, error) {
+	return 0, nil
+}
+
+func (g *fakeHistogramGetter) GetHistogram(pod *v1.Pod) (*Histogram, error) {
+	histogram := g.histograms[pod.Name][0]
+	g.histograms[pod.Name] = g.histograms[pod.Name][1:]
+	return histogram, nil
+}
+
+func TestPodCollectorHistogram(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default", UID: "uid", Labels: map[string]string{"app": "app"}},
+	})
+	c := &PodCollector{
+		client:           client,
+		namespace:        "default",
+		podLabelSelector: "app=app",
+		metricName:       "latency",
+		metricType:       autoscalingv2.PodsMetricSourceType,
+		interval:         time.Minute,
+		percentile:       50,
+		Getter: &fakeHistogramGetter{histograms: map[string][]*Histogram{
+			"pod": {histogram(100, 100, 100, 100), histogram(100, 100, 200, 200)},
+		}},
+	}
+
+	for _, expected := range []int64{50, 750} {
+		values, err := c.GetMetrics(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(values) != 1 || values[0].Custom.Value.MilliValue() != expected {
+			t.Errorf("expected value %dm, got %v", expected, values)
+		}
+	}
+}
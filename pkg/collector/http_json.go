@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// maxErrorBodyLength is the maximum length of a response body included in
+// the error of an unsuccessful response.
+const maxErrorBodyLength = 256
+
+// doJSON sends the request and decodes the JSON body of a successful response
+// into v. Responses asking to retry later are returned as RetryAfterError.
+func doJSON(ctx context.Context, client *http.Client, request *http.Request, v interface{}) error {
+	data, err := doRequest(ctx, client, request)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("invalid response: %v", err)
+	}
+	return nil
+}
+
+// doRequest sends the request and returns the body of a successful
+// response. Responses asking to retry later are returned as
+// RetryAfterError.
+func doRequest(ctx context.Context, client *http.Client, request *http.Request) ([]byte, error) {
+	resp, err := client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if retryErr := retryAfterFromResponse(resp); retryErr != nil {
+			return nil, retryErr
+		}
+
+		body := strings.TrimSpace(string(data))
+		if len(body) > maxErrorBodyLength {
+			body = body[:maxErrorBodyLength] + "..."
+		}
+		return nil, fmt.Errorf("unsuccessful response: %s: %s", resp.Status, body)
+	}
+	return data, nil
+}
+
+// readCredential returns the value if not empty, otherwise the trimmed
+// content of the file, if set. Files are read on each call such that rotated
+// credentials are picked up.
+func readCredential(value, file string) (string, error) {
+	if value != "" || file == "" {
+		return value, nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
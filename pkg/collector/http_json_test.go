@@ -0,0 +1,91 @@
+package collector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// serverTransport is an http.RoundTripper sending all requests to a test
+// server, such that collectors querying fixed hosts can be tested.
+type serverTransport struct {
+	server *url.URL
+}
+
+func (t *serverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.server.Scheme
+	req.URL.Host = t.server.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// serverClient returns an HTTP client sending all requests to the server.
+func serverClient(t *testing.T, server *httptest.Server) *http.Client {
+	t.Helper()
+	address, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{Transport: &serverTransport{server: address}}
+}
+
+func TestDoRequest(t *testing.T) {
+	for _, tc := range []struct {
+		msg        string
+		status     int
+		retryAfter string
+		body       string
+		err        string
+	}{
+		{
+			msg:    "successful response",
+			status: http.StatusOK,
+			body:   "ok",
+		},
+		{
+			msg:    "unsuccessful response",
+			status: http.StatusBadRequest,
+			body:   strings.Repeat("x", 300),
+			err:    "unsuccessful response: 400 Bad Request: " + strings.Repeat("x", maxErrorBodyLength) + "...",
+		},
+		{
+			msg:        "retry later",
+			status:     http.StatusTooManyRequests,
+			retryAfter: "30",
+			err:        "retry after 30s",
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.retryAfter != "" {
+					w.Header().Set("Retry-After", tc.retryAfter)
+				}
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := doRequest(context.Background(), server.Client(), request)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error '%s', got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(data) != tc.body {
+				t.Errorf("expected body '%s', got '%s'", tc.body, data)
+			}
+		})
+	}
+}
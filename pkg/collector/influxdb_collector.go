@@ -0,0 +1,250 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+)
+
+const (
+	// InfluxDBCollectorName is the name of the InfluxDB collector.
+	InfluxDBCollectorName = "influxdb"
+
+	influxDBDefaultValueColumn = "_value"
+)
+
+// InfluxDBCollectorPlugin is a collector plugin for initializing collectors
+// which run Flux queries against InfluxDB 2.x.
+type InfluxDBCollectorPlugin struct {
+	address   string
+	org       string
+	tokenFile string
+}
+
+// NewInfluxDBCollectorPlugin initializes a new InfluxDBCollectorPlugin
+// querying the server. The org and the token read from the token file are
+// used for metrics which don't define their own.
+func NewInfluxDBCollectorPlugin(address, org, tokenFile string) (*InfluxDBCollectorPlugin, error) {
+	if _, err := url.Parse(address); err != nil {
+		return nil, fmt.Errorf("invalid influxdb server '%s': %v", address, err)
+	}
+
+	return &InfluxDBCollectorPlugin{
+		address:   strings.TrimSuffix(address, "/"),
+		org:       org,
+		tokenFile: tokenFile,
+	}, nil
+}
+
+// NewCollector initializes a new InfluxDB collector from the specified HPA.
+func (p *InfluxDBCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	if config.Type != autoscalingv2.ExternalMetricSourceType {
+		return nil, fmt.Errorf("influxdb collector only supports external metrics")
+	}
+
+	query, ok := config.Config["query"]
+	if !ok {
+		return nil, fmt.Errorf("no flux query defined")
+	}
+
+	// the bucket is defined as variable of the query, such that queries
+	// can be reused for several buckets with from(bucket: bucket).
+	if bucket, ok := config.Config["bucket"]; ok {
+		query = fmt.Sprintf("bucket = %q\n%s", bucket, query)
+	}
+
+	c := &InfluxDBCollector{
+		hpa:         hpa,
+		address:     p.address,
+		org:         p.org,
+		token:       config.Config["token"],
+		tokenFile:   p.tokenFile,
+		query:       query,
+		valueColumn: influxDBDefaultValueColumn,
+		metricName:  config.Name,
+		labels:      config.Labels,
+		interval:    interval,
+		httpClient: &http.Client{
+			Timeout:   15 * time.Second,
+			Transport: &http.Transport{},
+		},
+	}
+
+	// the token of the adapter must not be used to query the org of
+	// another tenant, so the org can only be overridden along with the
+	// token of the metric.
+	if v, ok := config.Config["org"]; ok && v != c.org {
+		if c.token == "" {
+			return nil, fmt.Errorf("the influxdb org can only be overridden together with a token")
+		}
+		c.org = v
+	}
+	if c.org == "" {
+		return nil, fmt.Errorf("no influxdb org defined")
+	}
+
+	if v, ok := config.Config["value-column"]; ok {
+		c.valueColumn = v
+	}
+
+	return c, nil
+}
+
+// InfluxDBCollector is a metrics collector which exposes the value of the
+// last row of the result of a Flux query as external metric.
+type InfluxDBCollector struct {
+	hpa         *autoscalingv2.HorizontalPodAutoscaler
+	address     string
+	org         string
+	token       string
+	tokenFile   string
+	query       string
+	valueColumn string
+	metricName  string
+	labels      map[string]string
+	interval    time.Duration
+	httpClient  *http.Client
+}
+
+// influxDBQuery is the body of a query request of the InfluxDB API.
+type influxDBQuery struct {
+	Query   string          `json:"query"`
+	Type    string          `json:"type"`
+	Dialect influxDBDialect `json:"dialect"`
+}
+
+// influxDBDialect is the CSV dialect of the result of a query.
+type influxDBDialect struct {
+	Header      bool     `json:"header"`
+	Annotations []string `json:"annotations"`
+}
+
+// GetMetrics runs the Flux query and returns the value of its last row.
+func (c *InfluxDBCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	value, err := c.queryValue(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	metricValue := CollectedMetric{
+		Type: autoscalingv2.ExternalMetricSourceType,
+		External: external_metrics.ExternalMetricValue{
+			MetricName:   c.metricName,
+			MetricLabels: c.labels,
+			Timestamp:    metav1.Time{Time: time.Now().UTC()},
+		},
+	}
+	err = metricValue.setFloatValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return []CollectedMetric{metricValue}, nil
+}
+
+// queryValue runs the query and parses the value of the last row.
+func (c *InfluxDBCollector) queryValue(ctx context.Context) (float64, error) {
+	token, err := readCredential(c.token, c.tokenFile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read influxdb token: %v", err)
+	}
+
+	body, err := json.Marshal(influxDBQuery{
+		Query:   c.query,
+		Type:    "flux",
+		Dialect: influxDBDialect{Header: true, Annotations: []string{}},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	auditQuery(c.hpa, c.metricName, InfluxDBCollectorName, c.query)
+
+	queryURL := fmt.Sprintf("%s/api/v2/query?org=%s", c.address, url.QueryEscape(c.org))
+	request, err := http.NewRequest(http.MethodPost, queryURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/csv")
+	if token != "" {
+		request.Header.Set("Authorization", "Token "+token)
+	}
+
+	data, err := doRequest(ctx, c.httpClient, request)
+	if err != nil {
+		return 0, err
+	}
+
+	return parseInfluxDBValue(bytes.NewReader(data), c.valueColumn)
+}
+
+// parseInfluxDBValue returns the value of the column of the last row of a
+// CSV query result. The result may consist of several tables, each starting
+// with a header row.
+func parseInfluxDBValue(body io.Reader, column string) (float64, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+
+	index := -1
+	var last string
+	found := false
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse query result: %v", err)
+		}
+
+		// a header row starts a new table.
+		if header := columnIndex(record, column); header >= 0 {
+			index = header
+			continue
+		}
+
+		if index < 0 || index >= len(record) {
+			continue
+		}
+		last = record[index]
+		found = true
+	}
+
+	if !found {
+		return 0, fmt.Errorf("query returned no rows with a %s column", column)
+	}
+
+	value, err := strconv.ParseFloat(last, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value '%s' in column %s: %v", last, column, err)
+	}
+	return value, nil
+}
+
+// columnIndex returns the index of the column in a header row, -1 if not found.
+func columnIndex(record []string, column string) int {
+	for i, v := range record {
+		if v == column {
+			return i
+		}
+	}
+	return -1
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *InfluxDBCollector) Interval() time.Duration {
+	return c.interval
+}
@@ -0,0 +1,171 @@
+package collector
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInfluxDBCollectorPluginOrg(t *testing.T) {
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default"}}
+
+	for _, tc := range []struct {
+		msg      string
+		config   map[string]string
+		expected string
+		err      bool
+	}{
+		{
+			msg:      "org of the adapter",
+			config:   map[string]string{"query": `from(bucket: "jobs")`},
+			expected: "platform",
+		},
+		{
+			msg:      "same org as the adapter",
+			config:   map[string]string{"query": `from(bucket: "jobs")`, "org": "platform"},
+			expected: "platform",
+		},
+		{
+			msg:    "org override with the token of the adapter",
+			config: map[string]string{"query": `from(bucket: "jobs")`, "org": "team-a"},
+			err:    true,
+		},
+		{
+			msg:      "org override with a token",
+			config:   map[string]string{"query": `from(bucket: "jobs")`, "org": "team-a", "token": "secret"},
+			expected: "team-a",
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			plugin, err := NewInfluxDBCollectorPlugin("http://influxdb:8086", "platform", "/var/run/secrets/influxdb/token")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			config := &MetricConfig{
+				MetricTypeName: MetricTypeName{Type: autoscalingv2.ExternalMetricSourceType, Name: "jobs"},
+				Config:         tc.config,
+			}
+			collector, err := plugin.NewCollector(hpa, config, time.Minute)
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if org := collector.(*InfluxDBCollector).org; org != tc.expected {
+				t.Errorf("expected org '%s', got '%s'", tc.expected, org)
+			}
+		})
+	}
+}
+
+func TestParseInfluxDBValue(t *testing.T) {
+	for _, tc := range []struct {
+		msg      string
+		body     string
+		column   string
+		expected float64
+		err      bool
+	}{
+		{
+			msg:      "single table",
+			body:     ",result,table,_time,_value\n,_result,0,2021-01-01T00:00:00Z,1\n,_result,0,2021-01-01T00:01:00Z,2.5\n",
+			column:   "_value",
+			expected: 2.5,
+		},
+		{
+			msg:      "last row of several tables",
+			body:     ",result,table,_value\n,_result,0,1\n\n,result,table,_value\n,_result,1,4\n",
+			column:   "_value",
+			expected: 4,
+		},
+		{
+			msg:      "custom value column",
+			body:     ",result,table,_value,jobs\n,_result,0,1,7\n",
+			column:   "jobs",
+			expected: 7,
+		},
+		{
+			msg:    "no rows",
+			body:   ",result,table,_value\n",
+			column: "_value",
+			err:    true,
+		},
+		{
+			msg:    "invalid value",
+			body:   ",result,table,_value\n,_result,0,many\n",
+			column: "_value",
+			err:    true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			value, err := parseInfluxDBValue(strings.NewReader(tc.body), tc.column)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error, got value %v", value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if value != tc.expected {
+				t.Errorf("expected value %v, got %v", tc.expected, value)
+			}
+		})
+	}
+}
+
+func TestInfluxDBCollector(t *testing.T) {
+	var org, authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		org = r.URL.Query().Get("org")
+		authorization = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(",result,table,_value\n,_result,0,12\n"))
+	}))
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	err := ioutil.WriteFile(tokenFile, []byte("secret\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plugin, err := NewInfluxDBCollectorPlugin(server.URL, "platform", tokenFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default"}}
+	config := &MetricConfig{
+		MetricTypeName: MetricTypeName{Type: autoscalingv2.ExternalMetricSourceType, Name: "jobs"},
+		Config:         map[string]string{"query": `from(bucket: "jobs")`},
+	}
+	c, err := plugin.NewCollector(hpa, config, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	metrics, err := c.GetMetrics(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(metrics) != 1 || metrics[0].External.Value.Value() != 12 {
+		t.Fatalf("expected value 12, got %v", metrics)
+	}
+	if org != "platform" || authorization != "Token secret" {
+		t.Errorf("expected org and token of the adapter, got '%s' and '%s'", org, authorization)
+	}
+}
@@ -0,0 +1,191 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	batchv1listers "k8s.io/client-go/listers/batch/v1"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+)
+
+const (
+	JobQueueMetric = "job-queue"
+
+	jobStatePending  = "pending"
+	jobStateActive   = "active"
+	jobStateFinished = "finished"
+)
+
+// JobQueueCollectorPlugin is a collector plugin for initializing collectors
+// which count queued Jobs in the namespace of an HPA.
+type JobQueueCollectorPlugin struct {
+	lister batchv1listers.JobLister
+}
+
+// NewJobQueueCollectorPlugin initializes a new JobQueueCollectorPlugin. It
+// starts a Job informer which runs until stopCh is closed.
+func NewJobQueueCollectorPlugin(client kubernetes.Interface, stopCh <-chan struct{}) (*JobQueueCollectorPlugin, error) {
+	factory := informers.NewSharedInformerFactory(client, 0)
+	lister := factory.Batch().V1().Jobs().Lister()
+
+	factory.Start(stopCh)
+	for informerType, ok := range factory.WaitForCacheSync(stopCh) {
+		if !ok {
+			return nil, fmt.Errorf("failed to sync cache for %v", informerType)
+		}
+	}
+
+	return &JobQueueCollectorPlugin{
+		lister: lister,
+	}, nil
+}
+
+// NewCollector initializes a new job queue collector from the specified HPA.
+func (p *JobQueueCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	return NewJobQueueCollector(p.lister, hpa, config, interval)
+}
+
+// JobQueueCollector is a metrics collector which counts the Jobs in a
+// namespace that are not yet finished.
+type JobQueueCollector struct {
+	lister     batchv1listers.JobLister
+	namespace  string
+	selector   labels.Selector
+	states     map[string]bool
+	countPods  bool
+	metricName string
+	metricType autoscalingv2.MetricSourceType
+	labels     map[string]string
+	interval   time.Duration
+}
+
+// NewJobQueueCollector initializes a new JobQueueCollector.
+func NewJobQueueCollector(lister batchv1listers.JobLister, hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (*JobQueueCollector, error) {
+	c := &JobQueueCollector{
+		lister:     lister,
+		namespace:  hpa.Namespace,
+		selector:   labels.Everything(),
+		states:     map[string]bool{jobStatePending: true, jobStateActive: true},
+		metricName: config.Name,
+		metricType: config.Type,
+		labels:     config.Labels,
+		interval:   interval,
+	}
+
+	if v, ok := config.Config["selector"]; ok {
+		selector, err := labels.Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse job selector '%s': %v", v, err)
+		}
+		c.selector = selector
+	}
+
+	if v, ok := config.Config["states"]; ok {
+		c.states = map[string]bool{}
+		for _, state := range strings.Split(v, ",") {
+			state = strings.TrimSpace(state)
+			switch state {
+			case jobStatePending, jobStateActive:
+				c.states[state] = true
+			default:
+				return nil, fmt.Errorf("unsupported job state '%s'", state)
+			}
+		}
+	}
+
+	if v, ok := config.Config["count-pods"]; ok {
+		countPods, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid count-pods value %s", v)
+		}
+		c.countPods = countPods
+	}
+
+	return c, nil
+}
+
+// GetMetrics counts the queued Jobs matching the selector.
+func (c *JobQueueCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	jobs, err := c.lister.Jobs(c.namespace).List(c.selector)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int64
+	for _, job := range jobs {
+		if !c.states[jobState(job)] {
+			continue
+		}
+
+		if c.countPods {
+			count += int64(jobRemainingPods(job))
+		} else {
+			count++
+		}
+	}
+
+	metricValue := CollectedMetric{
+		Type: c.metricType,
+		External: external_metrics.ExternalMetricValue{
+			MetricName:   c.metricName,
+			MetricLabels: c.labels,
+			Timestamp:    metav1.Time{Time: time.Now().UTC()},
+			Value:        *resource.NewQuantity(count, resource.DecimalSI),
+		},
+	}
+
+	return []CollectedMetric{metricValue}, nil
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *JobQueueCollector) Interval() time.Duration {
+	return c.interval
+}
+
+// jobState returns the state of a Job. A Job is pending until it has any
+// active pods and is finished once it's marked either complete or failed.
+func jobState(job *batchv1.Job) string {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != v1.ConditionTrue {
+			continue
+		}
+
+		if condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed {
+			return jobStateFinished
+		}
+	}
+
+	if job.Status.Active > 0 {
+		return jobStateActive
+	}
+
+	return jobStatePending
+}
+
+// jobRemainingPods returns the number of pods the Job still needs to run to
+// completion. For Jobs without completions the parallelism is used instead.
+func jobRemainingPods(job *batchv1.Job) int32 {
+	completions := int32(1)
+	if job.Spec.Completions != nil {
+		completions = *job.Spec.Completions
+	} else if job.Spec.Parallelism != nil {
+		completions = *job.Spec.Parallelism
+	}
+
+	remaining := completions - job.Status.Succeeded
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
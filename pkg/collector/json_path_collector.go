@@ -126,6 +126,9 @@ func getPodMetrics(pod *v1.Pod, scheme, path string, port int) ([]byte, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK {
+		if retryErr := retryAfterFromResponse(resp); retryErr != nil {
+			return nil, retryErr
+		}
 		return nil, fmt.Errorf("unsuccessful response: %s", resp.Status)
 	}
 
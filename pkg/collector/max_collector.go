@@ -1,6 +1,9 @@
 package collector
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // MaxCollector is a simple aggregator collector that returns the maximum value
 // of metrics from all collectors.
@@ -18,10 +21,10 @@ func NewMaxCollector(interval time.Duration, collectors ...Collector) *MaxCollec
 }
 
 // GetMetrics gets metrics from all collectors and return the higest value.
-func (c *MaxCollector) GetMetrics() ([]CollectedMetric, error) {
+func (c *MaxCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
 	var max CollectedMetric
 	for _, collector := range c.collectors {
-		values, err := collector.GetMetrics()
+		values, err := collector.GetMetrics(ctx)
 		if err != nil {
 			return nil, err
 		}
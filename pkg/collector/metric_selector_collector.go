@@ -0,0 +1,48 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MetricSelectorCollector is a collector which sets the selector of the
+// metric identifier of the HPA on the custom metric values of another
+// collector, such that the values can be filtered by the metric label
+// selector of custom metrics API requests.
+type MetricSelectorCollector struct {
+	collector Collector
+	selector  *metav1.LabelSelector
+}
+
+// NewMetricSelectorCollector initializes a new MetricSelectorCollector.
+func NewMetricSelectorCollector(collector Collector, selector *metav1.LabelSelector) *MetricSelectorCollector {
+	return &MetricSelectorCollector{
+		collector: collector,
+		selector:  selector,
+	}
+}
+
+// GetMetrics gets metrics from the underlying collector and sets the
+// selector on custom metric values which don't have one yet.
+func (c *MetricSelectorCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	values, partial, err := getPartialMetrics(ctx, c.collector)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range values {
+		if values[i].Type != autoscalingv2.ExternalMetricSourceType && values[i].Custom.Metric.Selector == nil {
+			values[i].Custom.Metric.Selector = c.selector
+		}
+	}
+
+	return partialMetrics(values, partial)
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *MetricSelectorCollector) Interval() time.Duration {
+	return c.collector.Interval()
+}
@@ -0,0 +1,214 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"time"
+
+	"github.com/ghodss/yaml"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+)
+
+const (
+	// MockMetric is the name under which the mock plugin is registered as
+	// external collector in addition to the names of the other external
+	// metrics.
+	MockMetric = "mock"
+
+	mockGeneratorConstant = "constant"
+	mockGeneratorSine     = "sine"
+	mockGeneratorRamp     = "ramp"
+)
+
+// MockValue defines the synthetic values generated for a metric by the mock
+// collectors.
+type MockValue struct {
+	// Generator is one of constant, sine or ramp. Defaults to constant.
+	Generator string `json:"generator"`
+	// Value is the value returned by the constant generator.
+	Value float64 `json:"value"`
+	// Min and Max are the bounds of the sine and ramp generators.
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+	// PeriodSeconds is the period of the sine and ramp generators.
+	PeriodSeconds float64 `json:"periodSeconds"`
+}
+
+// defaultMockValue is used for metrics without a configured mock value.
+var defaultMockValue = &MockValue{Generator: mockGeneratorConstant, Value: 1}
+
+// LoadMockValues loads the mock values per metric name from a YAML or JSON
+// file.
+func LoadMockValues(path string) (map[string]*MockValue, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]*MockValue{}
+	err = yaml.Unmarshal(data, &values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mock values: %v", err)
+	}
+
+	for name, value := range values {
+		switch value.Generator {
+		case "":
+			value.Generator = mockGeneratorConstant
+		case mockGeneratorConstant:
+		case mockGeneratorSine, mockGeneratorRamp:
+			if value.PeriodSeconds <= 0 {
+				return nil, fmt.Errorf("mock value for metric '%s' must define a positive period", name)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported mock generator '%s' for metric '%s'", value.Generator, name)
+		}
+	}
+
+	return values, nil
+}
+
+// at returns the value of the generator at the specified time. Generated
+// values only depend on the time, so all adapter instances return the same
+// values.
+func (v *MockValue) at(t time.Time) float64 {
+	switch v.Generator {
+	case mockGeneratorSine:
+		phase := 2 * math.Pi * float64(t.UnixNano()) / (v.PeriodSeconds * float64(time.Second))
+		return v.Min + (v.Max-v.Min)*(1+math.Sin(phase))/2
+	case mockGeneratorRamp:
+		period := v.PeriodSeconds * float64(time.Second)
+		return v.Min + (v.Max-v.Min)*math.Mod(float64(t.UnixNano()), period)/period
+	default:
+		return v.Value
+	}
+}
+
+// MockCollectorPlugin is a collector plugin for initializing collectors
+// which return synthetic values instead of querying a metrics backend. It
+// can be registered in place of all other plugins for offline development.
+type MockCollectorPlugin struct {
+	client kubernetes.Interface
+	values map[string]*MockValue
+}
+
+// NewMockCollectorPlugin initializes a new MockCollectorPlugin.
+func NewMockCollectorPlugin(client kubernetes.Interface, values map[string]*MockValue) *MockCollectorPlugin {
+	return &MockCollectorPlugin{
+		client: client,
+		values: values,
+	}
+}
+
+// NewCollector initializes a new mock collector from the specified HPA.
+func (p *MockCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	value, ok := p.values[config.Name]
+	if !ok {
+		value = defaultMockValue
+	}
+
+	c := &MockCollector{
+		client:   p.client,
+		hpa:      hpa,
+		config:   *config,
+		value:    value,
+		interval: interval,
+	}
+
+	if config.Type == autoscalingv2.PodsMetricSourceType {
+		selector, err := getPodLabelSelector(p.client, hpa)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get pod label selector: %v", err)
+		}
+		c.podLabelSelector = selector
+	}
+
+	return c, nil
+}
+
+// MockCollector is a metrics collector which returns synthetic values for
+// pods, object and external metrics.
+type MockCollector struct {
+	client           kubernetes.Interface
+	hpa              *autoscalingv2.HorizontalPodAutoscaler
+	config           MetricConfig
+	value            *MockValue
+	podLabelSelector string
+	interval         time.Duration
+}
+
+// GetMetrics returns the synthetic value of the metric. For pods metrics a
+// value is returned for each of the pods of the scale target.
+func (c *MockCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	now := time.Now().UTC()
+	value := *resource.NewMilliQuantity(int64(c.value.at(now)*1000), resource.DecimalSI)
+
+	switch c.config.Type {
+	case autoscalingv2.PodsMetricSourceType:
+		pods, err := c.client.CoreV1().Pods(c.hpa.Namespace).List(ctx, metav1.ListOptions{LabelSelector: c.podLabelSelector})
+		if err != nil {
+			return nil, err
+		}
+
+		values := make([]CollectedMetric, 0, len(pods.Items))
+		for _, pod := range pods.Items {
+			values = append(values, CollectedMetric{
+				Type: c.config.Type,
+				Custom: custom_metrics.MetricValue{
+					DescribedObject: custom_metrics.ObjectReference{
+						APIVersion: "v1",
+						Kind:       "Pod",
+						Name:       pod.Name,
+						Namespace:  pod.Namespace,
+					},
+					Metric:    custom_metrics.MetricIdentifier{Name: c.config.Name},
+					Timestamp: metav1.Time{Time: now},
+					Value:     value,
+				},
+				Labels: pod.Labels,
+			})
+		}
+		return values, nil
+	case autoscalingv2.ObjectMetricSourceType:
+		object := c.config.ObjectReference
+		if c.config.TargetNamespace != "" {
+			object.Namespace = c.config.TargetNamespace
+		}
+
+		return []CollectedMetric{
+			{
+				Type: c.config.Type,
+				Custom: custom_metrics.MetricValue{
+					DescribedObject: object,
+					Metric:          custom_metrics.MetricIdentifier{Name: c.config.Name},
+					Timestamp:       metav1.Time{Time: now},
+					Value:           value,
+				},
+			},
+		}, nil
+	default:
+		return []CollectedMetric{
+			{
+				Type: c.config.Type,
+				External: external_metrics.ExternalMetricValue{
+					MetricName:   c.config.Name,
+					MetricLabels: c.config.Labels,
+					Timestamp:    metav1.Time{Time: now},
+					Value:        value,
+				},
+			},
+		}, nil
+	}
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *MockCollector) Interval() time.Duration {
+	return c.interval
+}
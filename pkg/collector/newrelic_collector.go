@@ -0,0 +1,249 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+)
+
+const (
+	// NewRelicCollectorName is the name of the New Relic collector.
+	NewRelicCollectorName = "newrelic"
+
+	newRelicRegionUS = "us"
+	newRelicRegionEU = "eu"
+
+	// newRelicNRQLQuery is the NerdGraph query running an NRQL query in
+	// an account.
+	newRelicNRQLQuery = `query($accountId: Int!, $nrql: Nrql!) { actor { account(id: $accountId) { nrql(query: $nrql) { results } } } }`
+)
+
+// newRelicEndpoints are the NerdGraph endpoints by region.
+var newRelicEndpoints = map[string]string{
+	newRelicRegionUS: "https://api.newrelic.com/graphql",
+	newRelicRegionEU: "https://api.eu.newrelic.com/graphql",
+}
+
+// NewRelicCollectorPlugin is a collector plugin for initializing collectors
+// which run NRQL queries through the NerdGraph API of New Relic.
+type NewRelicCollectorPlugin struct {
+	region     string
+	accountID  string
+	apiKeyFile string
+}
+
+// NewNewRelicCollectorPlugin initializes a new NewRelicCollectorPlugin. The
+// region, account ID and the API key read from the key file are used for
+// metrics which don't define their own.
+func NewNewRelicCollectorPlugin(region, accountID, apiKeyFile string) (*NewRelicCollectorPlugin, error) {
+	if region == "" {
+		region = newRelicRegionUS
+	}
+	if _, ok := newRelicEndpoints[region]; !ok {
+		return nil, fmt.Errorf("unsupported new relic region '%s'", region)
+	}
+
+	return &NewRelicCollectorPlugin{
+		region:     region,
+		accountID:  accountID,
+		apiKeyFile: apiKeyFile,
+	}, nil
+}
+
+// NewCollector initializes a new New Relic collector from the specified HPA.
+func (p *NewRelicCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	if config.Type != autoscalingv2.ExternalMetricSourceType {
+		return nil, fmt.Errorf("newrelic collector only supports external metrics")
+	}
+
+	query, ok := config.Config["query"]
+	if !ok {
+		return nil, fmt.Errorf("no nrql query defined")
+	}
+
+	region := p.region
+	if v, ok := config.Config["region"]; ok {
+		region = v
+	}
+	endpoint, ok := newRelicEndpoints[region]
+	if !ok {
+		return nil, fmt.Errorf("unsupported new relic region '%s'", region)
+	}
+
+	apiKey := config.Config["api-key"]
+	if apiKey == "" && p.apiKeyFile == "" {
+		return nil, fmt.Errorf("new relic api key must be defined")
+	}
+
+	// the key of the adapter must not be used to query the account of
+	// another tenant, so the account can only be overridden along with
+	// the key of the metric.
+	accountID := p.accountID
+	if v, ok := config.Config["account-id"]; ok && v != accountID {
+		if apiKey == "" {
+			return nil, fmt.Errorf("the new relic account id can only be overridden together with an api key")
+		}
+		accountID = v
+	}
+	account, err := strconv.Atoi(accountID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid new relic account id '%s'", accountID)
+	}
+
+	return &NewRelicCollector{
+		hpa:        hpa,
+		endpoint:   endpoint,
+		accountID:  account,
+		apiKey:     apiKey,
+		apiKeyFile: p.apiKeyFile,
+		query:      query,
+		valueKey:   config.Config["value-key"],
+		metricName: config.Name,
+		labels:     config.Labels,
+		interval:   interval,
+		httpClient: &http.Client{
+			Timeout:   15 * time.Second,
+			Transport: &http.Transport{},
+		},
+	}, nil
+}
+
+// NewRelicCollector is a metrics collector which exposes the single value
+// result of an NRQL query as external metric.
+type NewRelicCollector struct {
+	hpa        *autoscalingv2.HorizontalPodAutoscaler
+	endpoint   string
+	accountID  int
+	apiKey     string
+	apiKeyFile string
+	query      string
+	valueKey   string
+	metricName string
+	labels     map[string]string
+	interval   time.Duration
+	httpClient *http.Client
+}
+
+// newRelicRequest is a NerdGraph request.
+type newRelicRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// newRelicResponse is the NerdGraph response of an NRQL query.
+type newRelicResponse struct {
+	Data struct {
+		Actor struct {
+			Account struct {
+				NRQL struct {
+					Results []map[string]interface{} `json:"results"`
+				} `json:"nrql"`
+			} `json:"account"`
+		} `json:"actor"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// GetMetrics runs the NRQL query and returns its value.
+func (c *NewRelicCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	apiKey, err := readCredential(c.apiKey, c.apiKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read new relic api key: %v", err)
+	}
+
+	body, err := json.Marshal(newRelicRequest{
+		Query: newRelicNRQLQuery,
+		Variables: map[string]interface{}{
+			"accountId": c.accountID,
+			"nrql":      c.query,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	auditQuery(c.hpa, c.metricName, NewRelicCollectorName, c.query)
+
+	request, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("API-Key", apiKey)
+
+	var response newRelicResponse
+	err = doJSON(ctx, c.httpClient, request, &response)
+	if err != nil {
+		return nil, fmt.Errorf("nrql query failed: %v", err)
+	}
+
+	if len(response.Errors) > 0 {
+		return nil, fmt.Errorf("nrql query failed: %s", response.Errors[0].Message)
+	}
+
+	value, err := c.resultValue(response.Data.Actor.Account.NRQL.Results)
+	if err != nil {
+		return nil, err
+	}
+
+	metricValue := CollectedMetric{
+		Type: autoscalingv2.ExternalMetricSourceType,
+		External: external_metrics.ExternalMetricValue{
+			MetricName:   c.metricName,
+			MetricLabels: c.labels,
+			Timestamp:    metav1.Time{Time: time.Now().UTC()},
+		},
+	}
+	err = metricValue.setFloatValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return []CollectedMetric{metricValue}, nil
+}
+
+// resultValue returns the single value of the results of a query. The value
+// is the field of the value key or, without a value key, the only numeric
+// field of the single result, e.g. count of SELECT count(*).
+func (c *NewRelicCollector) resultValue(results []map[string]interface{}) (float64, error) {
+	if len(results) != 1 {
+		return 0, fmt.Errorf("nrql query '%s' returned %d results, expected a single value", c.query, len(results))
+	}
+
+	if c.valueKey != "" {
+		value, ok := results[0][c.valueKey].(float64)
+		if !ok {
+			return 0, fmt.Errorf("nrql query '%s' returned no numeric value for %s", c.query, c.valueKey)
+		}
+		return value, nil
+	}
+
+	var keys []string
+	for key, value := range results[0] {
+		if _, ok := value.(float64); ok {
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) != 1 {
+		sort.Strings(keys)
+		return 0, fmt.Errorf("nrql query '%s' returned %d numeric values %v, select one with value-key", c.query, len(keys), keys)
+	}
+	return results[0][keys[0]].(float64), nil
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *NewRelicCollector) Interval() time.Duration {
+	return c.interval
+}
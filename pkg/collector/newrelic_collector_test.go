@@ -0,0 +1,120 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newRelicBackendTest tests the New Relic collector. The backend of a
+// request is the account it queries.
+var newRelicBackendTest = backendTest{
+	adapter: "1234",
+	config:  map[string]string{"query": "SELECT count(*) FROM Transaction"},
+	newCollector: func(t *testing.T, server *httptest.Server, accountID string, config map[string]string) (Collector, error) {
+		plugin, err := NewNewRelicCollectorPlugin(newRelicRegionEU, accountID, adapterCredentialFile(t))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		c, err := plugin.NewCollector(
+			&autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default"}},
+			&MetricConfig{
+				MetricTypeName: MetricTypeName{Type: autoscalingv2.ExternalMetricSourceType, Name: "transactions"},
+				Config:         config,
+			},
+			time.Minute,
+		)
+		if err != nil {
+			return nil, err
+		}
+		c.(*NewRelicCollector).httpClient = serverClient(t, server)
+		return c, nil
+	},
+	target: func(r *http.Request) string {
+		var request struct {
+			Variables struct {
+				AccountID int `json:"accountId"`
+			} `json:"variables"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		return fmt.Sprintf("%s/accounts/%d", r.Host, request.Variables.AccountID)
+	},
+	credential: func(r *http.Request) string {
+		return r.Header.Get("API-Key")
+	},
+}
+
+func TestNewRelicCollectorCredentials(t *testing.T) {
+	newRelicBackendTest.testCredentials(t, []backendCredentialTestCase{
+		{
+			msg:        "account of the adapter",
+			adapter:    "1234",
+			target:     "api.eu.newrelic.com/accounts/1234",
+			credential: adapterCredential,
+		},
+		{
+			msg:        "same account as the adapter",
+			adapter:    "1234",
+			config:     map[string]string{"account-id": "1234"},
+			target:     "api.eu.newrelic.com/accounts/1234",
+			credential: adapterCredential,
+		},
+		{
+			msg:        "region override with the key of the adapter",
+			adapter:    "1234",
+			config:     map[string]string{"region": newRelicRegionUS},
+			target:     "api.newrelic.com/accounts/1234",
+			credential: adapterCredential,
+		},
+		{
+			msg:     "account override with the key of the adapter",
+			adapter: "1234",
+			config:  map[string]string{"account-id": "5678"},
+			err:     true,
+		},
+		{
+			msg:        "account override with a key",
+			adapter:    "1234",
+			config:     map[string]string{"account-id": "5678", "api-key": "secret"},
+			target:     "api.eu.newrelic.com/accounts/5678",
+			credential: "secret",
+		},
+	})
+}
+
+func TestNewRelicCollector(t *testing.T) {
+	newRelicBackendTest.testValues(t, []backendValueTestCase{
+		{
+			msg:      "single numeric value",
+			body:     `{"data":{"actor":{"account":{"nrql":{"results":[{"count":42}]}}}}}`,
+			expected: 42000,
+		},
+		{
+			msg:      "value key",
+			config:   map[string]string{"value-key": "average.duration"},
+			body:     `{"data":{"actor":{"account":{"nrql":{"results":[{"count":42,"average.duration":0.25}]}}}}}`,
+			expected: 250,
+		},
+		{
+			msg:  "several numeric values",
+			body: `{"data":{"actor":{"account":{"nrql":{"results":[{"count":42,"average.duration":0.25}]}}}}}`,
+			err:  true,
+		},
+		{
+			msg:  "several results",
+			body: `{"data":{"actor":{"account":{"nrql":{"results":[{"count":1},{"count":2}]}}}}}`,
+			err:  true,
+		},
+		{
+			msg:  "query error",
+			body: `{"errors":[{"message":"invalid nrql"}]}`,
+			err:  true,
+		},
+	})
+}
@@ -1,9 +1,9 @@
 package collector
 
-import autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
+import autoscalingv2 "k8s.io/api/autoscaling/v2"
 
 type ObjectMetricsGetter interface {
-	GetObjectMetric(namespace string, reference *autoscalingv2beta1.CrossVersionObjectReference) (float64, error)
+	GetObjectMetric(namespace string, reference *autoscalingv2.CrossVersionObjectReference) (float64, error)
 }
 
 // type PodCollector struct {
@@ -15,6 +15,6 @@ type ObjectMetricsGetter interface {
 // 	interval         time.Duration
 // }
 
-// func NewObjectCollector(client kubernetes.Interface, hpa *autoscalingv2beta1.HorizontalPodAutoscaler, metricName string, config *MetricConfig, interval time.Duration) (Collector, error) {
+// func NewObjectCollector(client kubernetes.Interface, hpa *autoscalingv2.HorizontalPodAutoscaler, metricName string, config *MetricConfig, interval time.Duration) (Collector, error) {
 // 	switch
 // }
@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Policies defining how partial responses of a collector are handled.
+const (
+	// PartialResponsePolicyUsePartial uses the values of the successful
+	// targets and logs a warning listing the failed targets. This is the
+	// default.
+	PartialResponsePolicyUsePartial = "use-partial"
+	// PartialResponsePolicyServeLast serves the last complete values.
+	PartialResponsePolicyServeLast = "serve-last"
+	// PartialResponsePolicyError fails the collection.
+	PartialResponsePolicyError = "error"
+)
+
+// maxReportedFailedTargets is the maximum number of failed targets included
+// in the message of a partial response error.
+const maxReportedFailedTargets = 5
+
+// FailedTarget is a target, e.g. a pod, a collector failed to collect a value
+// from.
+type FailedTarget struct {
+	Target string
+	Err    error
+}
+
+// PartialResponseError is returned by collectors when the backend signaled
+// that the collected values are incomplete. Values holds the incomplete
+// values which were collected and FailedTargets the targets whose values are
+// missing, if known.
+type PartialResponseError struct {
+	Values        []CollectedMetric
+	FailedTargets []FailedTarget
+	Err           error
+}
+
+func (e *PartialResponseError) Error() string {
+	if len(e.FailedTargets) == 0 {
+		return fmt.Sprintf("partial response: %v", e.Err)
+	}
+
+	failed := make([]string, 0, maxReportedFailedTargets)
+	for i, target := range e.FailedTargets {
+		if i == maxReportedFailedTargets {
+			failed = append(failed, fmt.Sprintf("and %d more", len(e.FailedTargets)-i))
+			break
+		}
+		failed = append(failed, fmt.Sprintf("%s: %v", target.Target, target.Err))
+	}
+	return fmt.Sprintf("partial response: %v (%s)", e.Err, strings.Join(failed, "; "))
+}
+
+// ValidPartialResponsePolicy returns true if the policy is a supported
+// partial response policy.
+func ValidPartialResponsePolicy(policy string) bool {
+	switch policy {
+	case PartialResponsePolicyServeLast, PartialResponsePolicyError, PartialResponsePolicyUsePartial:
+		return true
+	}
+	return false
+}
+
+// getPartialMetrics gets metrics from a collector wrapped by another
+// collector. The values of a partial response are returned along with the
+// partial response error instead of an error, such that the wrapper
+// processes them like the values of a complete response and returns them
+// as partial response again with partialMetrics. The policy for partial
+// responses is applied by the collector scheduler.
+func getPartialMetrics(ctx context.Context, collector Collector) ([]CollectedMetric, *PartialResponseError, error) {
+	values, err := collector.GetMetrics(ctx)
+	if partial, ok := err.(*PartialResponseError); ok {
+		return partial.Values, partial, nil
+	}
+	return values, nil, err
+}
+
+// partialMetrics returns the values processed by a wrapper as partial
+// response if the values of the wrapped collector were partial.
+func partialMetrics(values []CollectedMetric, partial *PartialResponseError) ([]CollectedMetric, error) {
+	if partial == nil {
+		return values, nil
+	}
+	return nil, &PartialResponseError{
+		Values:        values,
+		FailedTargets: partial.FailedTargets,
+		Err:           partial.Err,
+	}
+}
@@ -0,0 +1,110 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestWrappersPassPartialResponses(t *testing.T) {
+	target := resource.MustParse("2")
+
+	for _, tc := range []struct {
+		msg      string
+		wrap     func(Collector) (Collector, error)
+		expected []float64
+	}{
+		{
+			msg: "transform",
+			wrap: func(c Collector) (Collector, error) {
+				return NewTransformCollector(c, "value * 2.0", nil, nil)
+			},
+			expected: []float64{8},
+		},
+		{
+			msg: "utilization",
+			wrap: func(c Collector) (Collector, error) {
+				return NewUtilizationCollector(c, target), nil
+			},
+			expected: []float64{4, 2},
+		},
+		{
+			msg: "activation",
+			wrap: func(c Collector) (Collector, error) {
+				return NewActivationCollector(c, &MetricConfig{MetricTypeName: MetricTypeName{Name: "queue"}}), nil
+			},
+			expected: []float64{4, 1},
+		},
+		{
+			msg: "warm-up",
+			wrap: func(c Collector) (Collector, error) {
+				return NewWarmUpCollector(c, &MetricConfig{}), nil
+			},
+			expected: []float64{4},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			partial := &PartialResponseError{
+				Values:        []CollectedMetric{externalValue("queue", 4)},
+				FailedTargets: []FailedTarget{{Target: "pod-2", Err: fmt.Errorf("timeout")}},
+				Err:           fmt.Errorf("1 of 2 targets failed"),
+			}
+			c, err := tc.wrap(&fakeCollector{err: partial})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			_, err = c.GetMetrics(context.Background())
+			result, ok := err.(*PartialResponseError)
+			if !ok {
+				t.Fatalf("expected partial response, got %v", err)
+			}
+			if len(result.FailedTargets) != 1 || result.FailedTargets[0].Target != "pod-2" {
+				t.Errorf("expected failed target pod-2, got %v", result.FailedTargets)
+			}
+			if len(result.Values) != len(tc.expected) {
+				t.Fatalf("expected %d values, got %d", len(tc.expected), len(result.Values))
+			}
+			for i, value := range result.Values {
+				if value.floatValue() != tc.expected[i] {
+					t.Errorf("expected value %v, got %v", tc.expected[i], value.floatValue())
+				}
+			}
+		})
+	}
+}
+
+func TestCounterKeepsSamplesMissingFromPartialResponses(t *testing.T) {
+	fake := &fakeCollector{values: []CollectedMetric{externalValue("a", 1), externalValue("b", 1)}}
+	c, err := NewCounterCollector(fake, CounterDelta)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, step := range []struct {
+		values   []CollectedMetric
+		partial  bool
+		expected int
+	}{
+		{values: []CollectedMetric{externalValue("a", 1), externalValue("b", 1)}},
+		{values: []CollectedMetric{externalValue("a", 2)}, partial: true, expected: 1},
+		{values: []CollectedMetric{externalValue("a", 3), externalValue("b", 3)}, expected: 2},
+	} {
+		fake.values, fake.err = step.values, nil
+		if step.partial {
+			fake.values, fake.err = nil, &PartialResponseError{Values: step.values, Err: fmt.Errorf("partial")}
+		}
+
+		values, err := c.GetMetrics(context.Background())
+		if partial, ok := err.(*PartialResponseError); ok {
+			values = partial.Values
+		} else if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(values) != step.expected {
+			t.Errorf("expected %d converted series, got %d", step.expected, len(values))
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+)
+
+// PluginConfig configures the collector plugins which can be changed while
+// the adapter is running.
+type PluginConfig struct {
+	// Disabled are the names of the collectors which are disabled, e.g.
+	// prometheus. For external metrics without a collector name the
+	// metric name is used.
+	Disabled []string `json:"disabled"`
+	// Plugins are the external plugin processes to register.
+	Plugins []ExternalPluginConfig `json:"plugins"`
+}
+
+// LoadPluginConfig loads a plugin config from a YAML file.
+func LoadPluginConfig(path string) (*PluginConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parsePluginConfig(data)
+}
+
+// parsePluginConfig parses and validates a YAML plugin config.
+func parsePluginConfig(data []byte) (*PluginConfig, error) {
+	config := &PluginConfig{}
+	err := yaml.Unmarshal(data, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse plugin config: %v", err)
+	}
+
+	names := map[string]bool{}
+	for _, plugin := range config.Plugins {
+		if plugin.Name == "" {
+			return nil, fmt.Errorf("plugin without name")
+		}
+		if names[plugin.Name] {
+			return nil, fmt.Errorf("duplicate plugin '%s'", plugin.Name)
+		}
+		names[plugin.Name] = true
+
+		if plugin.URL == "" {
+			return nil, fmt.Errorf("plugin '%s' must define a url", plugin.Name)
+		}
+
+		switch autoscalingv2.MetricSourceType(plugin.Type) {
+		case autoscalingv2.PodsMetricSourceType, autoscalingv2.ObjectMetricSourceType, autoscalingv2.ExternalMetricSourceType:
+		default:
+			return nil, fmt.Errorf("unsupported type '%s' of plugin '%s', must be Pods, Object or External", plugin.Type, plugin.Name)
+		}
+	}
+
+	return config, nil
+}
+
+// SetDisabledCollectors disables the collectors of the names. Initializing
+// a collector of a disabled collector fails.
+func (c *CollectorFactory) SetDisabledCollectors(names []string) {
+	disabled := disabledCollectors(names)
+
+	c.pluginsLock.Lock()
+	c.disabled = disabled
+	c.pluginsLock.Unlock()
+}
+
+// disabledCollectors returns the set of the disabled collector names.
+func disabledCollectors(names []string) map[string]bool {
+	disabled := make(map[string]bool, len(names))
+	for _, name := range names {
+		disabled[name] = true
+	}
+	return disabled
+}
+
+// UnregisterPodsCollector removes the plugin of the pods collector.
+func (c *CollectorFactory) UnregisterPodsCollector(metricCollector string) {
+	c.pluginsLock.Lock()
+	defer c.pluginsLock.Unlock()
+
+	if metricCollector == "" {
+		c.podsPlugins.Any = nil
+		return
+	}
+	delete(c.podsPlugins.Named, metricCollector)
+}
+
+// UnregisterObjectCollector removes the plugin of the object collector of the
+// kind.
+func (c *CollectorFactory) UnregisterObjectCollector(kind, metricCollector string) {
+	c.pluginsLock.Lock()
+	defer c.pluginsLock.Unlock()
+
+	plugins := &c.objectPlugins.Any
+	if kind != "" {
+		named, ok := c.objectPlugins.Named[kind]
+		if !ok {
+			return
+		}
+		plugins = named
+	}
+
+	if metricCollector == "" {
+		plugins.Any = nil
+	} else {
+		delete(plugins.Named, metricCollector)
+	}
+
+	if kind != "" && plugins.Any == nil && len(plugins.Named) == 0 {
+		delete(c.objectPlugins.Named, kind)
+	}
+}
+
+// UnregisterExternalCollector removes the plugins of the external metrics.
+func (c *CollectorFactory) UnregisterExternalCollector(metrics []string) {
+	c.pluginsLock.Lock()
+	defer c.pluginsLock.Unlock()
+
+	for _, metric := range metrics {
+		delete(c.externalPlugins, metric)
+	}
+}
+
+// registerExternalPlugin registers an external plugin process for the type
+// of its config.
+func (c *CollectorFactory) registerExternalPlugin(config ExternalPluginConfig) error {
+	plugin := NewExternalPlugin(config)
+	switch autoscalingv2.MetricSourceType(config.Type) {
+	case autoscalingv2.PodsMetricSourceType:
+		return c.RegisterPodsCollector(config.Name, plugin)
+	case autoscalingv2.ObjectMetricSourceType:
+		return c.RegisterObjectCollector(config.Kind, config.Name, plugin)
+	default:
+		c.RegisterExternalCollector(append([]string{config.Name}, config.Metrics...), plugin)
+		return nil
+	}
+}
+
+// hasPlugin returns true if a plugin is registered under any of the names
+// the external plugin process of the config would be registered under.
+func (c *CollectorFactory) hasPlugin(config ExternalPluginConfig) bool {
+	c.pluginsLock.RLock()
+	defer c.pluginsLock.RUnlock()
+
+	switch autoscalingv2.MetricSourceType(config.Type) {
+	case autoscalingv2.PodsMetricSourceType:
+		_, ok := c.podsPlugins.Named[config.Name]
+		return ok
+	case autoscalingv2.ObjectMetricSourceType:
+		plugins := &c.objectPlugins.Any
+		if config.Kind != "" {
+			named, ok := c.objectPlugins.Named[config.Kind]
+			if !ok {
+				return false
+			}
+			plugins = named
+		}
+		_, ok := plugins.Named[config.Name]
+		return ok
+	default:
+		for _, metric := range append([]string{config.Name}, config.Metrics...) {
+			if _, ok := c.externalPlugins[metric]; ok {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// unregisterExternalPlugin removes a registered external plugin process.
+func (c *CollectorFactory) unregisterExternalPlugin(config ExternalPluginConfig) {
+	switch autoscalingv2.MetricSourceType(config.Type) {
+	case autoscalingv2.PodsMetricSourceType:
+		c.UnregisterPodsCollector(config.Name)
+	case autoscalingv2.ObjectMetricSourceType:
+		c.UnregisterObjectCollector(config.Kind, config.Name)
+	default:
+		c.UnregisterExternalCollector(append([]string{config.Name}, config.Metrics...))
+	}
+}
+
+// applyPluginConfig replaces the external plugins and disabled collectors
+// of the previous config with those of the config. The plugins are applied
+// to a copy of the registered plugins which then replaces them at once, such
+// that collectors are never initialized from a partially applied config and
+// an invalid config leaves the plugins unchanged. Plugins must not use the
+// names of the built-in collectors.
+func (c *CollectorFactory) applyPluginConfig(previous, config *PluginConfig) error {
+	c.pluginsLock.Lock()
+	defer c.pluginsLock.Unlock()
+
+	next := &CollectorFactory{
+		podsPlugins:     c.podsPlugins.clone(),
+		objectPlugins:   c.objectPlugins.clone(),
+		externalPlugins: clonePlugins(c.externalPlugins),
+	}
+
+	if previous != nil {
+		for _, plugin := range previous.Plugins {
+			next.unregisterExternalPlugin(plugin)
+		}
+	}
+
+	for _, plugin := range config.Plugins {
+		if next.hasPlugin(plugin) {
+			return fmt.Errorf("plugin '%s' collides with a registered collector", plugin.Name)
+		}
+
+		err := next.registerExternalPlugin(plugin)
+		if err != nil {
+			return fmt.Errorf("failed to register plugin '%s': %v", plugin.Name, err)
+		}
+	}
+
+	c.podsPlugins = next.podsPlugins
+	c.objectPlugins = next.objectPlugins
+	c.externalPlugins = next.externalPlugins
+	c.disabled = disabledCollectors(config.Disabled)
+
+	for _, plugin := range config.Plugins {
+		glog.Infof("Registered %s plugin '%s' at %s", plugin.Type, plugin.Name, plugin.URL)
+	}
+	return nil
+}
+
+// clone returns a copy of the plugin map.
+func (m pluginMap) clone() pluginMap {
+	return pluginMap{
+		Any:   m.Any,
+		Named: clonePlugins(m.Named),
+	}
+}
+
+// clone returns a copy of the object plugin map.
+func (m objectPluginMap) clone() objectPluginMap {
+	named := make(map[string]*pluginMap, len(m.Named))
+	for kind, plugins := range m.Named {
+		cloned := plugins.clone()
+		named[kind] = &cloned
+	}
+
+	return objectPluginMap{
+		Any:   m.Any.clone(),
+		Named: named,
+	}
+}
+
+// clonePlugins returns a copy of the plugins by name.
+func clonePlugins(plugins map[string]CollectorPlugin) map[string]CollectorPlugin {
+	cloned := make(map[string]CollectorPlugin, len(plugins))
+	for name, plugin := range plugins {
+		cloned[name] = plugin
+	}
+	return cloned
+}
+
+// WatchPluginConfig applies the plugin config of the file and applies it
+// again whenever the file changes, checked at the interval, until the stop
+// channel is closed. Collectors which are already running aren't affected by
+// a change, the config applies to the collectors initialized afterwards.
+func (c *CollectorFactory) WatchPluginConfig(path string, interval time.Duration, stopCh <-chan struct{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	config, err := parsePluginConfig(data)
+	if err != nil {
+		return err
+	}
+
+	err = c.applyPluginConfig(nil, config)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-stopCh:
+				return
+			}
+
+			changed, err := ioutil.ReadFile(path)
+			if err != nil {
+				glog.Errorf("Failed to read plugin config: %v", err)
+				continue
+			}
+
+			if bytes.Equal(changed, data) {
+				continue
+			}
+
+			// an invalid config is retried on the next change,
+			// the last valid config stays in use.
+			data = changed
+			next, err := parsePluginConfig(changed)
+			if err != nil {
+				glog.Errorf("Failed to reload plugin config: %v", err)
+				continue
+			}
+
+			err = c.applyPluginConfig(config, next)
+			if err != nil {
+				glog.Errorf("Failed to apply plugin config: %v", err)
+				continue
+			}
+			config = next
+			glog.Infof("Reloaded plugin config from %s", path)
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+)
+
+// fakePlugin creates fake collectors.
+type fakePlugin struct{}
+
+func (fakePlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	return &fakeCollector{interval: interval}, nil
+}
+
+func TestApplyPluginConfig(t *testing.T) {
+	for _, tc := range []struct {
+		msg      string
+		previous *PluginConfig
+		config   *PluginConfig
+		err      bool
+	}{
+		{
+			msg: "new plugins",
+			config: &PluginConfig{Plugins: []ExternalPluginConfig{
+				{Name: "app-stats", Type: "Pods", URL: "http://localhost:9101"},
+				{Name: "queue-depth", Type: "External", URL: "http://localhost:9100", Metrics: []string{"queue-age"}},
+			}},
+		},
+		{
+			msg: "pods plugin named like a built-in collector",
+			config: &PluginConfig{Plugins: []ExternalPluginConfig{
+				{Name: "prometheus", Type: "Pods", URL: "http://localhost:9101"},
+			}},
+			err: true,
+		},
+		{
+			msg: "external plugin collecting a built-in metric",
+			config: &PluginConfig{Plugins: []ExternalPluginConfig{
+				{Name: "queue-depth", Type: "External", URL: "http://localhost:9100", Metrics: []string{"sqs-queue-length"}},
+			}},
+			err: true,
+		},
+		{
+			msg: "replacing a plugin of the previous config",
+			previous: &PluginConfig{Plugins: []ExternalPluginConfig{
+				{Name: "app-stats", Type: "Pods", URL: "http://localhost:9101"},
+			}},
+			config: &PluginConfig{Plugins: []ExternalPluginConfig{
+				{Name: "app-stats", Type: "Pods", URL: "http://localhost:9102"},
+			}},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			factory := NewCollectorFactory(nil, nil)
+			_ = factory.RegisterPodsCollector("prometheus", fakePlugin{})
+			factory.RegisterExternalCollector([]string{"sqs-queue-length"}, fakePlugin{})
+			if tc.previous != nil {
+				err := factory.applyPluginConfig(nil, tc.previous)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			err := factory.applyPluginConfig(tc.previous, tc.config)
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				if _, ok := factory.podsPlugins.Named["prometheus"].(fakePlugin); !ok {
+					t.Error("expected built-in pods collector to be kept")
+				}
+				if _, ok := factory.externalPlugins["sqs-queue-length"].(fakePlugin); !ok {
+					t.Error("expected built-in external collector to be kept")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, plugin := range tc.config.Plugins {
+				if !factory.hasPlugin(plugin) {
+					t.Errorf("expected plugin '%s' to be registered", plugin.Name)
+				}
+			}
+		})
+	}
+}
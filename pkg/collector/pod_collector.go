@@ -1,15 +1,18 @@
 package collector
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
-	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/metrics/pkg/apis/custom_metrics"
 )
@@ -24,7 +27,7 @@ func NewPodCollectorPlugin(client kubernetes.Interface) *PodCollectorPlugin {
 	}
 }
 
-func (p *PodCollectorPlugin) NewCollector(hpa *autoscalingv2beta1.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+func (p *PodCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
 	return NewPodCollector(p.client, hpa, config, interval)
 }
 
@@ -34,15 +37,45 @@ type PodCollector struct {
 	podLabelSelector string
 	namespace        string
 	metricName       string
-	metricType       autoscalingv2beta1.MetricSourceType
+	metricType       autoscalingv2.MetricSourceType
 	interval         time.Duration
+	percentile       float64
+	// histograms are the histograms of the pods of the previous
+	// collection of histogram getters.
+	histograms map[types.UID]*Histogram
+	sync.Mutex
 }
 
 type PodMetricsGetter interface {
 	GetMetric(pod *v1.Pod) (float64, error)
 }
 
-func NewPodCollector(client kubernetes.Interface, hpa *autoscalingv2beta1.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (*PodCollector, error) {
+// PodHistogramGetter is implemented by pod metrics getters which get a
+// distribution from pods. The collector computes the served value from the
+// histogram.
+type PodHistogramGetter interface {
+	GetHistogram(pod *v1.Pod) (*Histogram, error)
+}
+
+func NewPodCollector(client kubernetes.Interface, hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (*PodCollector, error) {
+	// the config is checked before the pods are looked up.
+	var getter PodMetricsGetter
+	var err error
+	switch config.CollectorName {
+	case "json-path":
+		getter, err = NewJSONPathMetricsGetter(config.Config)
+		if err != nil {
+			return nil, err
+		}
+	case PrometheusHistogramCollectorName:
+		getter, err = NewPrometheusHistogramGetter(config.Config)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("format '%s' not supported", config.CollectorName)
+	}
+
 	// get pod selector based on HPA scale target ref
 	selector, err := getPodLabelSelector(client, hpa)
 	if err != nil {
@@ -51,47 +84,61 @@ func NewPodCollector(client kubernetes.Interface, hpa *autoscalingv2beta1.Horizo
 
 	c := &PodCollector{
 		client:           client,
+		Getter:           getter,
 		namespace:        hpa.Namespace,
 		metricName:       config.Name,
 		metricType:       config.Type,
 		interval:         interval,
 		podLabelSelector: selector,
+		percentile:       defaultHistogramPercentile,
 	}
-
-	var getter PodMetricsGetter
-	switch config.CollectorName {
-	case "json-path":
-		var err error
-		getter, err = NewJSONPathMetricsGetter(config.Config)
-		if err != nil {
-			return nil, err
-		}
-	default:
-		return nil, fmt.Errorf("format '%s' not supported", config.CollectorName)
+	if config.Percentile > 0 {
+		c.percentile = config.Percentile
 	}
 
-	c.Getter = getter
-
 	return c, nil
 }
 
-func (c *PodCollector) GetMetrics() ([]CollectedMetric, error) {
+func (c *PodCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
 	opts := metav1.ListOptions{
 		LabelSelector: c.podLabelSelector,
 	}
 
-	pods, err := c.client.CoreV1().Pods(c.namespace).List(opts)
+	pods, err := c.client.CoreV1().Pods(c.namespace).List(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
 
 	values := make([]CollectedMetric, 0, len(pods.Items))
 
+	c.Lock()
+	defer c.Unlock()
+	histograms := make(map[types.UID]*Histogram, len(pods.Items))
+
 	// TODO: get metrics in parallel
+	var failed []FailedTarget
 	for _, pod := range pods.Items {
-		value, err := c.Getter.GetMetric(&pod)
+		// the getters don't support contexts, so the collection is
+		// only aborted between pods.
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("collection aborted after %d of %d pods: %v", len(values)+len(failed), len(pods.Items), ctx.Err())
+		}
+
+		var value float64
+		var err error
+		if histogramGetter, ok := c.Getter.(PodHistogramGetter); ok {
+			var histogram *Histogram
+			histogram, err = histogramGetter.GetHistogram(&pod)
+			if err == nil {
+				value = histogramValue(c.percentile, histogram, c.histograms[pod.UID])
+				histograms[pod.UID] = histogram
+			}
+		} else {
+			value, err = c.Getter.GetMetric(&pod)
+		}
 		if err != nil {
 			glog.Errorf("Failed to get metrics from pod '%s/%s': %v", pod.Namespace, pod.Name, err)
+			failed = append(failed, FailedTarget{Target: pod.Namespace + "/" + pod.Name, Err: err})
 			continue
 		}
 
@@ -104,9 +151,9 @@ func (c *PodCollector) GetMetrics() ([]CollectedMetric, error) {
 					Name:       pod.Name,
 					Namespace:  pod.Namespace,
 				},
-				MetricName: c.metricName,
-				Timestamp:  metav1.Time{Time: time.Now().UTC()},
-				Value:      *resource.NewMilliQuantity(int64(value*1000), resource.DecimalSI),
+				Metric:    custom_metrics.MetricIdentifier{Name: c.metricName},
+				Timestamp: metav1.Time{Time: time.Now().UTC()},
+				Value:     *resource.NewMilliQuantity(int64(value*1000), resource.DecimalSI),
 			},
 			Labels: pod.Labels,
 		}
@@ -114,6 +161,17 @@ func (c *PodCollector) GetMetrics() ([]CollectedMetric, error) {
 		values = append(values, metricValue)
 	}
 
+	// only the histograms of the current pods are kept.
+	c.histograms = histograms
+
+	if len(failed) > 0 {
+		return nil, &PartialResponseError{
+			Values:        values,
+			FailedTargets: failed,
+			Err:           fmt.Errorf("failed to get metrics from %d of %d pods", len(failed), len(pods.Items)),
+		}
+	}
+
 	return values, nil
 }
 
@@ -121,21 +179,31 @@ func (c *PodCollector) Interval() time.Duration {
 	return c.interval
 }
 
-func getPodLabelSelector(client kubernetes.Interface, hpa *autoscalingv2beta1.HorizontalPodAutoscaler) (string, error) {
+func getPodLabelSelector(client kubernetes.Interface, hpa *autoscalingv2.HorizontalPodAutoscaler) (string, error) {
+	matchLabels, err := getPodMatchLabels(client, hpa)
+	if err != nil {
+		return "", err
+	}
+	return labels.Set(matchLabels).String(), nil
+}
+
+// getPodMatchLabels returns the match labels of the pod selector of the
+// scale target of the HPA.
+func getPodMatchLabels(client kubernetes.Interface, hpa *autoscalingv2.HorizontalPodAutoscaler) (map[string]string, error) {
 	switch hpa.Spec.ScaleTargetRef.Kind {
 	case "Deployment":
-		deployment, err := client.AppsV1().Deployments(hpa.Namespace).Get(hpa.Spec.ScaleTargetRef.Name, metav1.GetOptions{})
+		deployment, err := client.AppsV1().Deployments(hpa.Namespace).Get(context.TODO(), hpa.Spec.ScaleTargetRef.Name, metav1.GetOptions{})
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		return labels.Set(deployment.Spec.Selector.MatchLabels).String(), nil
+		return deployment.Spec.Selector.MatchLabels, nil
 	case "StatefulSet":
-		sts, err := client.AppsV1().StatefulSets(hpa.Namespace).Get(hpa.Spec.ScaleTargetRef.Name, metav1.GetOptions{})
+		sts, err := client.AppsV1().StatefulSets(hpa.Namespace).Get(context.TODO(), hpa.Spec.ScaleTargetRef.Name, metav1.GetOptions{})
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		return labels.Set(sts.Spec.Selector.MatchLabels).String(), nil
+		return sts.Spec.Selector.MatchLabels, nil
 	}
 
-	return "", fmt.Errorf("unable to get pod label selector for scale target ref '%s'", hpa.Spec.ScaleTargetRef.Kind)
+	return nil, fmt.Errorf("unable to get pod label selector for scale target ref '%s'", hpa.Spec.ScaleTargetRef.Kind)
 }
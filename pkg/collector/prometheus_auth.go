@@ -0,0 +1,136 @@
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// config keys of the authentication of Prometheus queries of an HPA. They're
+// meant to be set from a Secret with the credentials of a
+// ScalingMetricConfig.
+const (
+	prometheusBearerTokenConfKey = "bearer-token"
+	prometheusUsernameConfKey    = "username"
+	prometheusPasswordConfKey    = "password"
+	prometheusTenantConfKey      = "tenant"
+
+	// prometheusTenantHeader is the header selecting the tenant of
+	// multi-tenant backends like Thanos, Cortex and Mimir.
+	prometheusTenantHeader = "X-Scope-OrgID"
+)
+
+// PrometheusAuth configures the authentication of the requests to a
+// Prometheus server, e.g. an auth-protected Prometheus or Thanos Querier.
+type PrometheusAuth struct {
+	// BearerToken is sent as bearer token. BearerTokenFile is read on each
+	// request instead, such that rotated tokens are picked up.
+	BearerToken     string
+	BearerTokenFile string
+	// Username and Password are sent with basic auth.
+	Username string
+	Password string
+	// Headers are added to each request.
+	Headers map[string]string
+}
+
+// empty returns true if the auth doesn't change the requests.
+func (a *PrometheusAuth) empty() bool {
+	return a == nil || (a.BearerToken == "" && a.BearerTokenFile == "" && a.Username == "" && len(a.Headers) == 0)
+}
+
+// apply sets the authentication of the request.
+func (a *PrometheusAuth) apply(req *http.Request) error {
+	for name, value := range a.Headers {
+		req.Header.Set(name, value)
+	}
+
+	token := a.BearerToken
+	if a.BearerTokenFile != "" {
+		data, err := ioutil.ReadFile(a.BearerTokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read bearer token: %v", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	switch {
+	case token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	case a.Username != "":
+		req.SetBasicAuth(a.Username, a.Password)
+	}
+	return nil
+}
+
+// merge returns the auth with the credentials and headers of other taking
+// precedence.
+func (a *PrometheusAuth) merge(other *PrometheusAuth) *PrometheusAuth {
+	if a.empty() {
+		return other
+	}
+	if other.empty() {
+		return a
+	}
+
+	merged := *a
+	if other.BearerToken != "" || other.Username != "" {
+		merged.BearerToken = other.BearerToken
+		merged.BearerTokenFile = ""
+		merged.Username = other.Username
+		merged.Password = other.Password
+	}
+
+	merged.Headers = make(map[string]string, len(a.Headers)+len(other.Headers))
+	for name, value := range a.Headers {
+		merged.Headers[name] = value
+	}
+	for name, value := range other.Headers {
+		merged.Headers[name] = value
+	}
+	return &merged
+}
+
+// metricPrometheusAuth returns the auth of the Prometheus queries of a
+// metric config, nil if it doesn't define any. The tenant of the metric is
+// sent as tenant header.
+func metricPrometheusAuth(config *MetricConfig) *PrometheusAuth {
+	auth := &PrometheusAuth{
+		BearerToken: config.Config[prometheusBearerTokenConfKey],
+		Username:    config.Config[prometheusUsernameConfKey],
+		Password:    config.Config[prometheusPasswordConfKey],
+	}
+	if tenant, ok := config.Config[prometheusTenantConfKey]; ok {
+		auth.Headers = map[string]string{prometheusTenantHeader: tenant}
+	}
+	if auth.empty() {
+		return nil
+	}
+	return auth
+}
+
+// ParsePrometheusHeader parses a header of the form <name>: <value>.
+func ParsePrometheusHeader(value string) (string, string, error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return "", "", fmt.Errorf("invalid header '%s', must be <name>: <value>", value)
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), nil
+}
+
+// authRoundTripper is an http.RoundTripper which authenticates the requests.
+type authRoundTripper struct {
+	auth *PrometheusAuth
+	next http.RoundTripper
+}
+
+// RoundTrip authenticates a copy of the request and sends it.
+func (t *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	err := t.auth.apply(req)
+	if err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,224 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// prometheusBatchLabel is the label the samples of a batched query are
+	// tagged with to fan them back out to the individual queries.
+	prometheusBatchLabel = "kube_metrics_adapter_batch"
+	// maxPrometheusBatchSize is the maximum number of queries joined into
+	// a single request.
+	maxPrometheusBatchSize = 50
+	// prometheusBatchTimeout is the timeout of a batched query.
+	prometheusBatchTimeout = 30 * time.Second
+)
+
+// prometheusBatcher joins the instant queries of the collectors querying the
+// same Prometheus server into a single or-joined query. The result of each
+// query is reused by its collector if it was fetched within the last half
+// of its interval, such that collectors due at roughly the same time only
+// cause a single request.
+type prometheusBatcher struct {
+	promAPI promv1.API
+	queries map[string]*batchedQuery
+	sync.Mutex
+}
+
+// batchedQuery is a query known to the batcher and its last result.
+type batchedQuery struct {
+	interval   time.Duration
+	lastUsed   time.Time
+	result     model.Vector
+	resultTime time.Time
+	// pending is closed once the batch the query is run in finished. It's
+	// nil if the query isn't running.
+	pending chan struct{}
+	// unbatched is true for queries which are run on their own because
+	// a batch containing them failed, until they succeed on their own.
+	unbatched bool
+}
+
+// newPrometheusBatcher initializes a prometheusBatcher for the server of
+// the Prometheus API.
+func newPrometheusBatcher(promAPI promv1.API) *prometheusBatcher {
+	return &prometheusBatcher{
+		promAPI: promAPI,
+		queries: make(map[string]*batchedQuery),
+	}
+}
+
+// query returns the result of an instant query collected at the interval.
+// A query without a fresh result is run together with the other stale
+// queries still in use. Queries already running in a batch wait for the
+// result of the batch.
+func (b *prometheusBatcher) query(ctx context.Context, query string, interval time.Duration) (model.Vector, error) {
+	b.Lock()
+
+	now := time.Now()
+	q, ok := b.queries[query]
+	if !ok {
+		q = &batchedQuery{}
+		b.queries[query] = q
+	}
+	q.interval = interval
+	q.lastUsed = now
+
+	if !q.resultTime.IsZero() && now.Sub(q.resultTime) < interval/2 {
+		b.Unlock()
+		return q.result, nil
+	}
+
+	if q.unbatched {
+		b.Unlock()
+		return b.querySingle(ctx, query)
+	}
+
+	if pending := q.pending; pending != nil {
+		b.Unlock()
+		select {
+		case <-pending:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return b.query(ctx, query, interval)
+	}
+
+	batch := []string{query}
+	for other, o := range b.queries {
+		if len(batch) >= maxPrometheusBatchSize {
+			break
+		}
+		if other == query || o.pending != nil || o.unbatched {
+			continue
+		}
+
+		// forget queries of collectors which were stopped.
+		if now.Sub(o.lastUsed) > 2*o.interval {
+			delete(b.queries, other)
+			continue
+		}
+
+		if o.resultTime.IsZero() || now.Sub(o.resultTime) >= o.interval/2 {
+			batch = append(batch, other)
+		}
+	}
+
+	done := make(chan struct{})
+	for _, other := range batch {
+		b.queries[other].pending = done
+	}
+	b.Unlock()
+
+	// the batch is run on behalf of all its queries, so it must not be
+	// canceled along with the context of the collector running it.
+	batchCtx, cancel := context.WithTimeout(context.Background(), prometheusBatchTimeout)
+	results, err := b.run(batchCtx, batch)
+	cancel()
+
+	b.Lock()
+	for i, other := range batch {
+		batched, ok := b.queries[other]
+		if !ok {
+			continue
+		}
+		batched.pending = nil
+		switch {
+		case err == nil:
+			batched.result = results[i]
+			batched.resultTime = now
+		case len(batch) > 1:
+			// a single invalid query fails the whole batch, so the
+			// queries of the batch are run on their own until they
+			// succeed.
+			batched.unbatched = true
+		}
+	}
+	close(done)
+	b.Unlock()
+
+	if err != nil {
+		if len(batch) == 1 {
+			return nil, err
+		}
+		glog.V(1).Infof("Batched query of %d queries failed, querying individually: %v", len(batch), err)
+		return b.querySingle(ctx, query)
+	}
+	return results[0], nil
+}
+
+// querySingle runs a query excluded from batching on its own. The query is
+// batched again once it succeeded.
+func (b *prometheusBatcher) querySingle(ctx context.Context, query string) (model.Vector, error) {
+	results, err := b.run(ctx, []string{query})
+
+	b.Lock()
+	defer b.Unlock()
+	if q, ok := b.queries[query]; ok && err == nil {
+		q.unbatched = false
+		q.result = results[0]
+		q.resultTime = time.Now()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// run runs the queries as a single query and returns the result of each
+// query.
+func (b *prometheusBatcher) run(ctx context.Context, queries []string) ([]model.Vector, error) {
+	query := queries[0]
+	if len(queries) > 1 {
+		parts := make([]string, 0, len(queries))
+		for i, q := range queries {
+			parts = append(parts, fmt.Sprintf(`label_replace((%s), "%s", "%d", "", "")`, q, prometheusBatchLabel, i))
+		}
+		query = strings.Join(parts, " or ")
+	}
+
+	value, warnings, err := b.promAPI.Query(ctx, query, time.Now().UTC())
+	logQueryWarnings(query, warnings)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]model.Vector, len(queries))
+	switch value.Type() {
+	case model.ValVector:
+		samples := value.(model.Vector)
+		if len(queries) == 1 {
+			results[0] = samples
+			return results, nil
+		}
+
+		for _, sample := range samples {
+			i, err := strconv.Atoi(string(sample.Metric[prometheusBatchLabel]))
+			if err != nil || i < 0 || i >= len(queries) {
+				continue
+			}
+			delete(sample.Metric, prometheusBatchLabel)
+			results[i] = append(results[i], sample)
+		}
+	case model.ValScalar:
+		if len(queries) > 1 {
+			return nil, fmt.Errorf("batched query returned a scalar")
+		}
+		scalar := value.(*model.Scalar)
+		results[0] = model.Vector{&model.Sample{Value: scalar.Value, Timestamp: scalar.Timestamp}}
+	default:
+		return nil, fmt.Errorf("unsupported result type %s", value.Type())
+	}
+	return results, nil
+}
@@ -0,0 +1,129 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+// batchPromAPI answers instant queries with the value 1 for each query of a
+// batch and fails queries containing an invalid query.
+type batchPromAPI struct {
+	promv1.API
+	delay   time.Duration
+	queries []string
+	sync.Mutex
+}
+
+func (f *batchPromAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, promv1.Warnings, error) {
+	f.Lock()
+	f.queries = append(f.queries, query)
+	f.Unlock()
+	time.Sleep(f.delay)
+
+	if strings.Contains(query, "invalid") {
+		return nil, nil, fmt.Errorf("parse error")
+	}
+
+	parts := strings.Split(query, " or ")
+	if len(parts) == 1 {
+		return vectorValue(1), nil, nil
+	}
+	var vector model.Vector
+	for i := range parts {
+		vector = append(vector, &model.Sample{
+			Metric:    model.Metric{prometheusBatchLabel: model.LabelValue(fmt.Sprint(i))},
+			Value:     1,
+			Timestamp: model.TimeFromUnix(1000),
+		})
+	}
+	return vector, nil, nil
+}
+
+func (f *batchPromAPI) calls() []string {
+	f.Lock()
+	defer f.Unlock()
+	return append([]string(nil), f.queries...)
+}
+
+func TestPrometheusBatcherConcurrentQueries(t *testing.T) {
+	api := &batchPromAPI{delay: 10 * time.Millisecond}
+	b := newPrometheusBatcher(api)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := b.query(context.Background(), "up", time.Minute)
+			if err != nil || len(result) != 1 {
+				t.Errorf("expected a single sample, got %v: %v", result, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls := api.calls(); len(calls) != 1 {
+		t.Errorf("expected a single query, got %v", calls)
+	}
+}
+
+func TestPrometheusBatcherCanceledCollector(t *testing.T) {
+	api := &batchPromAPI{delay: 10 * time.Millisecond}
+	b := newPrometheusBatcher(api)
+	b.queries["rate(requests_total[1m])"] = &batchedQuery{interval: time.Minute, lastUsed: time.Now()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := b.query(ctx, "up", time.Minute)
+	if err != nil {
+		t.Fatalf("expected the batch not to be canceled with the collector, got %v", err)
+	}
+
+	if q := b.queries["rate(requests_total[1m])"]; q.resultTime.IsZero() {
+		t.Error("expected the result of the other query of the batch to be stored")
+	}
+}
+
+func TestPrometheusBatcherFailedBatch(t *testing.T) {
+	api := &batchPromAPI{}
+	b := newPrometheusBatcher(api)
+	b.queries["invalid("] = &batchedQuery{interval: time.Minute, lastUsed: time.Now()}
+
+	result, err := b.query(context.Background(), "up", time.Minute)
+	if err != nil || len(result) != 1 {
+		t.Fatalf("expected the query to succeed on its own, got %v: %v", result, err)
+	}
+	if b.queries["up"].unbatched {
+		t.Error("expected the valid query to be batched again")
+	}
+	if !b.queries["invalid("].unbatched {
+		t.Error("expected the invalid query to be excluded from batching")
+	}
+
+	_, err = b.query(context.Background(), "invalid(", time.Minute)
+	if err == nil {
+		t.Fatal("expected the invalid query to fail")
+	}
+	if !b.queries["invalid("].unbatched {
+		t.Error("expected the failed query to stay excluded from batching")
+	}
+
+	// the next batch doesn't contain the invalid query.
+	b.queries["up"].resultTime = time.Time{}
+	b.queries["sum(up)"] = &batchedQuery{interval: time.Minute, lastUsed: time.Now()}
+	_, err = b.query(context.Background(), "up", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	calls := api.calls()
+	if last := calls[len(calls)-1]; strings.Contains(last, "invalid") || !strings.Contains(last, " or ") {
+		t.Errorf("expected a batch without the invalid query, got '%s'", last)
+	}
+}
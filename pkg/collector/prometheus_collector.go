@@ -4,27 +4,87 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/golang/glog"
 	"github.com/prometheus/client_golang/api"
 	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/common/model"
-	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/metrics/pkg/apis/custom_metrics"
 )
 
+const (
+	// PrometheusCollectorName is the name of the Prometheus collector.
+	PrometheusCollectorName = "prometheus"
+
+	prometheusReplicaStrategyFailover   = "failover"
+	prometheusReplicaStrategyRoundRobin = "round-robin"
+	prometheusReplicaLabelKey           = "prometheus-replica"
+)
+
 type PrometheusCollectorPlugin struct {
 	promAPI promv1.API
 	client  kubernetes.Interface
+	batcher *prometheusBatcher
+	// server and auth are the address and the authentication of the
+	// server of the plugin.
+	server string
+	auth   *PrometheusAuth
+	// backend is the name of the backend in the query audit log.
+	// queryParams returns the additional query parameters of the queries
+	// of a metric config, if supported by the backend.
+	backend     string
+	queryParams func(config *MetricConfig) (url.Values, error)
+	// allowedServers are the servers HPAs may query instead of the
+	// server of the plugin. No other server is allowed if empty.
+	allowedServers map[string]bool
+	// namespaceTenants are the tenants the HPAs of each namespace may
+	// query. Tenants aren't restricted if nil.
+	namespaceTenants map[string][]string
 }
 
-func NewPrometheusCollectorPlugin(client kubernetes.Interface, prometheusServer string) (*PrometheusCollectorPlugin, error) {
+// NewPrometheusCollectorPlugin initializes a new PrometheusCollectorPlugin
+// querying the server with the auth, which may be nil.
+func NewPrometheusCollectorPlugin(client kubernetes.Interface, prometheusServer string, auth *PrometheusAuth) (*PrometheusCollectorPlugin, error) {
+	promAPI, err := newPrometheusAPI(prometheusServer, auth, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PrometheusCollectorPlugin{
+		client:  client,
+		promAPI: promAPI,
+		batcher: newPrometheusBatcher(promAPI),
+		server:  prometheusServer,
+		auth:    auth,
+		backend: PrometheusCollectorName,
+	}, nil
+}
+
+// newPrometheusAPI initializes a Prometheus API client for the specified
+// server, authenticating with the auth if not nil and adding the query
+// parameters to each query.
+func newPrometheusAPI(address string, auth *PrometheusAuth, params url.Values) (promv1.API, error) {
+	var transport http.RoundTripper = &http.Transport{}
+	if !auth.empty() {
+		transport = &authRoundTripper{auth: auth, next: transport}
+	}
+	if len(params) > 0 {
+		transport = &queryParamsRoundTripper{params: params, next: transport}
+	}
+
 	cfg := api.Config{
-		Address:      prometheusServer,
-		RoundTripper: &http.Transport{},
+		Address:      address,
+		RoundTripper: &retryAfterRoundTripper{next: transport},
 	}
 
 	promClient, err := api.NewClient(cfg)
@@ -32,55 +92,326 @@ func NewPrometheusCollectorPlugin(client kubernetes.Interface, prometheusServer
 		return nil, err
 	}
 
-	return &PrometheusCollectorPlugin{
-		client:  client,
-		promAPI: promv1.NewAPI(promClient),
-	}, nil
+	return promv1.NewAPI(promClient), nil
+}
+
+// SetAllowedServers limits the servers HPAs can query with the server and
+// replicas keys to the servers.
+func (p *PrometheusCollectorPlugin) SetAllowedServers(servers []string) {
+	p.allowedServers = make(map[string]bool, len(servers))
+	for _, server := range servers {
+		p.allowedServers[server] = true
+	}
+}
+
+// SetNamespaceTenants restricts the tenants HPAs can query with the tenant
+// key to the tenants mapped to their namespace. HPAs of a namespace mapped
+// to a single tenant always query this tenant, HPAs of a namespace mapped to
+// multiple tenants must select one of them. HPAs of other namespaces can't
+// select a tenant.
+func (p *PrometheusCollectorPlugin) SetNamespaceTenants(tenants map[string][]string) {
+	p.namespaceTenants = tenants
+}
+
+// enforceTenant returns the metric config with the tenant the HPA must query
+// according to the namespace tenants, or an error if the HPA selects a
+// tenant which isn't mapped to its namespace.
+func (p *PrometheusCollectorPlugin) enforceTenant(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig) (*MetricConfig, error) {
+	if p.namespaceTenants == nil {
+		return config, nil
+	}
+
+	tenants := p.namespaceTenants[hpa.Namespace]
+	tenant, ok := config.Config[prometheusTenantConfKey]
+	if !ok {
+		switch len(tenants) {
+		case 0:
+			return config, nil
+		case 1:
+			tenant = tenants[0]
+		default:
+			return nil, fmt.Errorf("prometheus tenant must be set to one of %s for namespace %s", strings.Join(tenants, ", "), hpa.Namespace)
+		}
+	}
+
+	allowed := false
+	for _, t := range tenants {
+		if t == tenant {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, fmt.Errorf("prometheus tenant '%s' is not allowed for namespace %s", tenant, hpa.Namespace)
+	}
+
+	enforced := *config
+	enforced.Config = make(map[string]string, len(config.Config)+1)
+	for key, value := range config.Config {
+		enforced.Config[key] = value
+	}
+	enforced.Config[prometheusTenantConfKey] = tenant
+	return &enforced, nil
 }
 
-func (p *PrometheusCollectorPlugin) NewCollector(hpa *autoscalingv2beta1.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
-	return NewPrometheusCollector(p.client, p.promAPI, hpa, config, interval)
+// checkServers returns an error if the metric config references a server
+// which isn't allowed, either with the server or the replicas key. Servers
+// other than the server of the plugin must be allowed explicitly.
+func (p *PrometheusCollectorPlugin) checkServers(config *MetricConfig) error {
+	servers := strings.Split(config.Config["replicas"], ",")
+	servers = append(servers, config.Config["server"])
+	for _, server := range servers {
+		server = strings.TrimSpace(server)
+		if server != "" && !p.allowedServers[server] {
+			return fmt.Errorf("prometheus server '%s' is not allowed, see --prometheus-allowed-servers", server)
+		}
+	}
+	return nil
+}
+
+func (p *PrometheusCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	err := p.checkServers(config)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err = p.enforceTenant(hpa, config)
+	if err != nil {
+		return nil, err
+	}
+
+	var params url.Values
+	if p.queryParams != nil {
+		params, err = p.queryParams(config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the credentials of the metric replace the credentials of the
+	// server of the plugin.
+	promAPI := p.promAPI
+	auth := metricPrometheusAuth(config)
+	if auth != nil || len(params) > 0 {
+		promAPI, err = newPrometheusAPI(p.server, p.auth.merge(auth), params)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	newAPI := func(address string) (promv1.API, error) {
+		return newPrometheusAPI(address, auth, params)
+	}
+
+	c, err := NewPrometheusCollector(p.client, promAPI, newAPI, hpa, config, interval)
+	if err != nil {
+		return nil, err
+	}
+	c.backend = p.backend
+
+	// only instant queries against the server of the plugin are batched.
+	batch := false
+	if v, ok := config.Config["batch"]; ok {
+		batch, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid batch value %s", v)
+		}
+	}
+	if batch {
+		_, replicas := config.Config["replicas"]
+		_, server := config.Config["server"]
+		if replicas || server || auth != nil || len(params) > 0 || c.minSamples > 0 {
+			return nil, fmt.Errorf("batched queries can't be combined with server, replicas, credentials, tenant, query parameters or min-samples")
+		}
+		c.batcher = p.batcher
+	}
+	return c, nil
+}
+
+// prometheusReplica is one of several interchangeable Prometheus servers
+// which can answer the queries of a collector.
+type prometheusReplica struct {
+	address string
+	promAPI promv1.API
 }
 
 type PrometheusCollector struct {
 	client          kubernetes.Interface
-	promAPI         promv1.API
+	replicas        []prometheusReplica
+	replicaStrategy string
+	// nextReplica counts the queries with the round-robin strategy to pick
+	// the replica to start at. It's updated atomically.
+	nextReplica     uint32
 	query           string
 	metricName      string
-	metricType      autoscalingv2beta1.MetricSourceType
+	metricType      autoscalingv2.MetricSourceType
 	objectReference custom_metrics.ObjectReference
 	interval        time.Duration
 	perReplica      bool
-	hpa             *autoscalingv2beta1.HorizontalPodAutoscaler
+	clampReplicas   bool
+	hpa             *autoscalingv2.HorizontalPodAutoscaler
+	minSamples      int
+	window          time.Duration
+	maxWindow       time.Duration
+	step            time.Duration
+	widenedWindow   time.Duration
+	// sampleTime is the timestamp of the latest sample of the last query.
+	sampleTime time.Time
+	// mu serializes GetMetrics as the sample time and widened window of a
+	// query are recorded on the collector.
+	mu sync.Mutex
+	// batcher joins the query with the queries of other collectors if
+	// not nil.
+	batcher *prometheusBatcher
+	// backend is the name of the backend in the query audit log.
+	backend string
 }
 
-func NewPrometheusCollector(client kubernetes.Interface, promAPI promv1.API, hpa *autoscalingv2beta1.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (*PrometheusCollector, error) {
+// NewPrometheusCollector initializes a new PrometheusCollector querying the
+// Prometheus API, or the server or replicas of the metric config with the
+// APIs initialized by newAPI.
+func NewPrometheusCollector(client kubernetes.Interface, promAPI promv1.API, newAPI func(address string) (promv1.API, error), hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (*PrometheusCollector, error) {
 	c := &PrometheusCollector{
 		client:          client,
 		objectReference: config.ObjectReference,
 		metricName:      config.Name,
 		metricType:      config.Type,
 		interval:        interval,
-		promAPI:         promAPI,
+		replicas:        []prometheusReplica{{promAPI: promAPI}},
+		replicaStrategy: prometheusReplicaStrategyFailover,
+		backend:         PrometheusCollectorName,
 		perReplica:      config.PerReplica,
+		clampReplicas:   config.ClampReplicas,
 		hpa:             hpa,
 	}
 
 	if v, ok := config.Config["query"]; ok {
-		// TODO: validate query
+		// the query is rendered and validated by the factory.
 		c.query = v
 	} else {
 		return nil, fmt.Errorf("no prometheus query defined")
 	}
 
+	// a single server overriding the server of the plugin.
+	if v, ok := config.Config["server"]; ok {
+		if _, ok := config.Config["replicas"]; ok {
+			return nil, fmt.Errorf("server and replicas can't be combined")
+		}
+
+		serverAPI, err := newAPI(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize prometheus client for server '%s': %v", v, err)
+		}
+		c.replicas = []prometheusReplica{{address: v, promAPI: serverAPI}}
+	}
+
+	if v, ok := config.Config["replicas"]; ok {
+		replicas := make([]prometheusReplica, 0)
+		for _, address := range strings.Split(v, ",") {
+			address = strings.TrimSpace(address)
+			if address == "" {
+				continue
+			}
+
+			replicaAPI, err := newAPI(address)
+			if err != nil {
+				return nil, fmt.Errorf("failed to initialize prometheus client for replica '%s': %v", address, err)
+			}
+			replicas = append(replicas, prometheusReplica{address: address, promAPI: replicaAPI})
+		}
+
+		if len(replicas) == 0 {
+			return nil, fmt.Errorf("no prometheus replicas defined")
+		}
+		c.replicas = replicas
+	}
+
+	err := c.parseWindowConfig(config.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	if v, ok := config.Config["replica-strategy"]; ok {
+		switch v {
+		case prometheusReplicaStrategyFailover, prometheusReplicaStrategyRoundRobin:
+			c.replicaStrategy = v
+		default:
+			return nil, fmt.Errorf("unsupported replica strategy '%s'", v)
+		}
+	}
+
 	return c, nil
 }
 
-func (c *PrometheusCollector) GetMetrics() ([]CollectedMetric, error) {
-	// TODO: use real context
-	value, err := c.promAPI.Query(context.Background(), c.query, time.Now().UTC())
+// queryReplicas runs the query against the Prometheus replicas and returns
+// the result of the first replica to answer successfully. With the failover
+// strategy the replicas are always tried in the configured order, with the
+// round-robin strategy each query starts at the replica following the one
+// used for the previous query.
+func (c *PrometheusCollector) queryReplicas(ctx context.Context, auditedQuery string, query func(ctx context.Context, promAPI promv1.API) (model.Value, error)) (model.Value, string, error) {
+	start := 0
+	if c.replicaStrategy == prometheusReplicaStrategyRoundRobin {
+		start = int((atomic.AddUint32(&c.nextReplica, 1) - 1) % uint32(len(c.replicas)))
+	}
+
+	var lastErr error
+	for i := 0; i < len(c.replicas); i++ {
+		replica := c.replicas[(start+i)%len(c.replicas)]
+
+		backend := replica.address
+		if backend == "" {
+			backend = c.backend
+		}
+		auditQuery(c.hpa, c.metricName, backend, auditedQuery)
+
+		value, err := query(ctx, replica.promAPI)
+		if err != nil {
+			if len(c.replicas) > 1 {
+				glog.Warningf("Failed to query prometheus replica '%s', trying next replica: %v", replica.address, err)
+			}
+			lastErr = err
+			continue
+		}
+
+		return value, replica.address, nil
+	}
+
+	if len(c.replicas) > 1 {
+		return nil, "", fmt.Errorf("all %d prometheus replicas failed, last error: %v", len(c.replicas), lastErr)
+	}
+	return nil, "", lastErr
+}
+
+// logQueryWarnings logs any warnings returned by Prometheus for a query.
+func logQueryWarnings(query string, warnings promv1.Warnings) {
+	for _, w := range warnings {
+		glog.Warningf("Prometheus query '%s' returned warning: %s", query, w)
+	}
+}
+
+// queryInstant runs the query as instant query and returns the value of the
+// first sample.
+func (c *PrometheusCollector) queryInstant(ctx context.Context) (model.SampleValue, string, error) {
+	if c.batcher != nil {
+		auditQuery(c.hpa, c.metricName, c.backend, c.query)
+		samples, err := c.batcher.query(ctx, c.query, c.interval)
+		if err != nil {
+			return 0, "", err
+		}
+		if len(samples) == 0 {
+			return 0, "", fmt.Errorf("query '%s' returned no samples", c.query)
+		}
+		c.sampleTime = samples[0].Timestamp.Time()
+		return samples[0].Value, "", nil
+	}
+
+	value, replica, err := c.queryReplicas(ctx, c.query, func(ctx context.Context, promAPI promv1.API) (model.Value, error) {
+		value, warnings, err := promAPI.Query(ctx, c.query, time.Now().UTC())
+		logQueryWarnings(c.query, warnings)
+		return value, err
+	})
 	if err != nil {
-		return nil, err
+		return 0, "", err
 	}
 
 	var sampleValue model.SampleValue
@@ -88,13 +419,34 @@ func (c *PrometheusCollector) GetMetrics() ([]CollectedMetric, error) {
 	case model.ValVector:
 		samples := value.(model.Vector)
 		if len(samples) == 0 {
-			return nil, fmt.Errorf("query '%s' returned no samples", c.query)
+			return 0, "", fmt.Errorf("query '%s' returned no samples", c.query)
 		}
 
 		sampleValue = samples[0].Value
+		c.sampleTime = samples[0].Timestamp.Time()
 	case model.ValScalar:
 		scalar := value.(*model.Scalar)
 		sampleValue = scalar.Value
+		c.sampleTime = scalar.Timestamp.Time()
+	}
+
+	return sampleValue, replica, nil
+}
+
+func (c *PrometheusCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var sampleValue model.SampleValue
+	var replica string
+	var err error
+	if c.minSamples > 0 {
+		sampleValue, replica, err = c.queryWidening(ctx)
+	} else {
+		sampleValue, replica, err = c.queryInstant(ctx)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	if sampleValue.String() == "NaN" {
@@ -110,19 +462,45 @@ func (c *PrometheusCollector) GetMetrics() ([]CollectedMetric, error) {
 		if err != nil {
 			return nil, err
 		}
+
+		if c.clampReplicas {
+			replicas = clampReplicas(replicas, c.hpa)
+		}
+
+		if replicas == 0 {
+			return nil, fmt.Errorf("unable to calculate per replica value, scale target %s/%s has no ready replicas", c.hpa.Namespace, c.hpa.Spec.ScaleTargetRef.Name)
+		}
 		sampleValue = model.SampleValue(float64(sampleValue) / float64(replicas))
 	}
 
+	timestamp := c.sampleTime.UTC()
+	if c.sampleTime.IsZero() {
+		timestamp = time.Now().UTC()
+	}
+
 	metricValue := CollectedMetric{
 		Type: c.metricType,
 		Custom: custom_metrics.MetricValue{
 			DescribedObject: c.objectReference,
-			MetricName:      c.metricName,
-			Timestamp:       metav1.Time{Time: time.Now().UTC()},
+			Metric:          custom_metrics.MetricIdentifier{Name: c.metricName},
+			Timestamp:       metav1.Time{Time: timestamp},
 			Value:           *resource.NewMilliQuantity(int64(sampleValue*1000), resource.DecimalSI),
 		},
 	}
 
+	// track which replica served the value if several are configured.
+	if replica != "" {
+		metricValue.Labels = map[string]string{prometheusReplicaLabelKey: replica}
+	}
+
+	// flag values aggregated over a widened window.
+	if c.widenedWindow > 0 {
+		if metricValue.Labels == nil {
+			metricValue.Labels = map[string]string{}
+		}
+		metricValue.Labels[prometheusWindowLabelKey] = c.widenedWindow.String()
+	}
+
 	return []CollectedMetric{metricValue}, nil
 }
 
@@ -0,0 +1,301 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakePromAPI answers instant queries with a fixed value or error.
+type fakePromAPI struct {
+	promv1.API
+	value model.Value
+	err   error
+}
+
+func (f *fakePromAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, promv1.Warnings, error) {
+	if f.err != nil {
+		return nil, nil, f.err
+	}
+	return f.value, nil, nil
+}
+
+func vectorValue(v float64) model.Value {
+	return model.Vector{&model.Sample{Value: model.SampleValue(v), Timestamp: model.TimeFromUnix(1000)}}
+}
+
+func TestPrometheusCollectorReplicas(t *testing.T) {
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default"}}
+	failing := &fakePromAPI{err: fmt.Errorf("unavailable")}
+
+	for _, tc := range []struct {
+		msg      string
+		strategy string
+		replicas []prometheusReplica
+		queries  int
+		replica  string
+		value    float64
+		err      bool
+	}{
+		{
+			msg:      "failover uses the first healthy replica",
+			strategy: prometheusReplicaStrategyFailover,
+			replicas: []prometheusReplica{
+				{address: "a", promAPI: failing},
+				{address: "b", promAPI: &fakePromAPI{value: vectorValue(2)}},
+			},
+			queries: 1,
+			replica: "b",
+			value:   2,
+		},
+		{
+			msg:      "failover always starts at the first replica",
+			strategy: prometheusReplicaStrategyFailover,
+			replicas: []prometheusReplica{
+				{address: "a", promAPI: &fakePromAPI{value: vectorValue(1)}},
+				{address: "b", promAPI: &fakePromAPI{value: vectorValue(2)}},
+			},
+			queries: 2,
+			replica: "a",
+			value:   1,
+		},
+		{
+			msg:      "round-robin starts at the next replica",
+			strategy: prometheusReplicaStrategyRoundRobin,
+			replicas: []prometheusReplica{
+				{address: "a", promAPI: &fakePromAPI{value: vectorValue(1)}},
+				{address: "b", promAPI: &fakePromAPI{value: vectorValue(2)}},
+			},
+			queries: 2,
+			replica: "b",
+			value:   2,
+		},
+		{
+			msg:      "all replicas failing",
+			strategy: prometheusReplicaStrategyFailover,
+			replicas: []prometheusReplica{
+				{address: "a", promAPI: failing},
+				{address: "b", promAPI: failing},
+			},
+			queries: 1,
+			err:     true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			c := &PrometheusCollector{
+				hpa:             hpa,
+				query:           "up",
+				metricName:      "up",
+				replicas:        tc.replicas,
+				replicaStrategy: tc.strategy,
+			}
+
+			var value model.SampleValue
+			var replica string
+			var err error
+			for i := 0; i < tc.queries; i++ {
+				value, replica, err = c.queryInstant(context.Background())
+			}
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error, got value %v", value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if replica != tc.replica {
+				t.Errorf("expected replica %s, got %s", tc.replica, replica)
+			}
+			if float64(value) != tc.value {
+				t.Errorf("expected value %v, got %v", tc.value, value)
+			}
+		})
+	}
+}
+
+func TestPrometheusCollectorConcurrentGetMetrics(t *testing.T) {
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default"}}
+	c := &PrometheusCollector{
+		hpa:        hpa,
+		query:      "up",
+		metricName: "up",
+		replicas: []prometheusReplica{
+			{address: "a", promAPI: &fakePromAPI{value: vectorValue(1)}},
+			{address: "b", promAPI: &fakePromAPI{value: vectorValue(1)}},
+		},
+		replicaStrategy: prometheusReplicaStrategyRoundRobin,
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			metrics, err := c.GetMetrics(context.Background())
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			if ts := metrics[0].Custom.Timestamp.Unix(); ts != 1000 {
+				t.Errorf("expected sample timestamp 1000, got %d", ts)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if c.nextReplica != 10 {
+		t.Errorf("expected 10 round-robin queries, got %d", c.nextReplica)
+	}
+}
+
+func TestPrometheusCollectorPluginCheckServers(t *testing.T) {
+	for _, tc := range []struct {
+		msg     string
+		allowed []string
+		config  map[string]string
+		err     bool
+	}{
+		{
+			msg:    "server of the plugin",
+			config: map[string]string{"query": "up"},
+		},
+		{
+			msg:    "server override without allowed servers",
+			config: map[string]string{"server": "http://prometheus.team-a:9090"},
+			err:    true,
+		},
+		{
+			msg:    "replicas without allowed servers",
+			config: map[string]string{"replicas": "http://prometheus-0:9090,http://prometheus-1:9090"},
+			err:    true,
+		},
+		{
+			msg:     "allowed server override",
+			allowed: []string{"http://prometheus.team-a:9090"},
+			config:  map[string]string{"server": "http://prometheus.team-a:9090"},
+		},
+		{
+			msg:     "allowed replicas",
+			allowed: []string{"http://prometheus-0:9090", "http://prometheus-1:9090"},
+			config:  map[string]string{"replicas": "http://prometheus-0:9090, http://prometheus-1:9090"},
+		},
+		{
+			msg:     "replica not allowed",
+			allowed: []string{"http://prometheus-0:9090"},
+			config:  map[string]string{"replicas": "http://prometheus-0:9090,http://evil:9090"},
+			err:     true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			p := &PrometheusCollectorPlugin{}
+			if tc.allowed != nil {
+				p.SetAllowedServers(tc.allowed)
+			}
+
+			err := p.checkServers(&MetricConfig{Config: tc.config})
+			if tc.err && err == nil {
+				t.Error("expected error")
+			}
+			if !tc.err && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestPrometheusCollectorPluginEnforceTenant(t *testing.T) {
+	namespaceTenants := map[string][]string{
+		"team-a": {"tenant-a"},
+		"team-b": {"tenant-b", "shared"},
+	}
+
+	for _, tc := range []struct {
+		msg       string
+		tenants   map[string][]string
+		namespace string
+		tenant    string
+		expected  string
+		err       bool
+	}{
+		{
+			msg:       "tenants not restricted",
+			namespace: "team-a",
+			tenant:    "tenant-b",
+			expected:  "tenant-b",
+		},
+		{
+			msg:       "single tenant of the namespace",
+			tenants:   namespaceTenants,
+			namespace: "team-a",
+			expected:  "tenant-a",
+		},
+		{
+			msg:       "tenant of another namespace",
+			tenants:   namespaceTenants,
+			namespace: "team-a",
+			tenant:    "tenant-b",
+			err:       true,
+		},
+		{
+			msg:       "selected tenant of the namespace",
+			tenants:   namespaceTenants,
+			namespace: "team-b",
+			tenant:    "shared",
+			expected:  "shared",
+		},
+		{
+			msg:       "no tenant selected of multiple tenants",
+			tenants:   namespaceTenants,
+			namespace: "team-b",
+			err:       true,
+		},
+		{
+			msg:       "unmapped namespace without tenant",
+			tenants:   namespaceTenants,
+			namespace: "team-c",
+		},
+		{
+			msg:       "unmapped namespace with tenant",
+			tenants:   namespaceTenants,
+			namespace: "team-c",
+			tenant:    "tenant-a",
+			err:       true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			p := &PrometheusCollectorPlugin{}
+			if tc.tenants != nil {
+				p.SetNamespaceTenants(tc.tenants)
+			}
+
+			config := &MetricConfig{Config: map[string]string{"query": "up"}}
+			if tc.tenant != "" {
+				config.Config[prometheusTenantConfKey] = tc.tenant
+			}
+			hpa := &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: tc.namespace}}
+
+			enforced, err := p.enforceTenant(hpa, config)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error, got config %v", enforced.Config)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tenant := enforced.Config[prometheusTenantConfKey]; tenant != tc.expected {
+				t.Errorf("expected tenant '%s', got '%s'", tc.expected, tenant)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// prometheusOperatedService is the governing service created by the
+	// Prometheus Operator for all Prometheus instances in a namespace.
+	prometheusOperatedService = "prometheus-operated"
+	prometheusOperatedPort    = 9090
+)
+
+var prometheusResource = schema.GroupVersionResource{
+	Group:    "monitoring.coreos.com",
+	Version:  "v1",
+	Resource: "prometheuses",
+}
+
+// DiscoverPrometheusServer discovers the URL of a Prometheus managed by the
+// Prometheus Operator by looking up Prometheus resources matching the label
+// selector. If namespace is "" Prometheus resources in all namespaces are
+// considered. If several Prometheus resources match, the first one ordered
+// by namespace and name is used.
+func DiscoverPrometheusServer(client dynamic.Interface, namespace, selector string) (string, error) {
+	list, err := client.Resource(prometheusResource).Namespace(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list Prometheus resources: %v", err)
+	}
+
+	if len(list.Items) == 0 {
+		return "", fmt.Errorf("no Prometheus resources found matching selector '%s'", selector)
+	}
+
+	items := list.Items
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].GetNamespace() != items[j].GetNamespace() {
+			return items[i].GetNamespace() < items[j].GetNamespace()
+		}
+		return items[i].GetName() < items[j].GetName()
+	})
+
+	prometheus := items[0]
+
+	routePrefix, _, err := unstructured.NestedString(prometheus.Object, "spec", "routePrefix")
+	if err != nil {
+		return "", fmt.Errorf("invalid routePrefix on Prometheus %s/%s: %v", prometheus.GetNamespace(), prometheus.GetName(), err)
+	}
+
+	server := url.URL{
+		Scheme: "http",
+		Host:   fmt.Sprintf("%s.%s.svc:%d", prometheusOperatedService, prometheus.GetNamespace(), prometheusOperatedPort),
+		Path:   routePrefix,
+	}
+
+	return server.String(), nil
+}
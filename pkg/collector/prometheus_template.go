@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/client-go/kubernetes"
+)
+
+// prometheusQueryData is the data Prometheus queries are rendered with, such
+// that a single query can be used by many HPAs, e.g.
+//
+//	sum(rate(http_requests_total{namespace="{{.Namespace}}",{{.LabelSelector}}}[1m]))
+type prometheusQueryData struct {
+	client kubernetes.Interface
+	hpa    *autoscalingv2.HorizontalPodAutoscaler
+
+	Namespace       string
+	HPAName         string
+	ScaleTargetKind string
+	ScaleTargetName string
+	Metric          string
+	// Labels are the labels of the metric selector of the metric.
+	Labels map[string]string
+}
+
+// LabelSelector returns the match labels of the pod selector of the scale
+// target as PromQL label matchers, e.g. app="web",tier="frontend". The
+// selector is only looked up if the query uses it.
+func (d *prometheusQueryData) LabelSelector() (string, error) {
+	if d.client == nil {
+		return "", fmt.Errorf("the pod selector of the scale target can't be looked up without a cluster")
+	}
+
+	matchLabels, err := getPodMatchLabels(d.client, d.hpa)
+	if err != nil {
+		return "", err
+	}
+
+	matchers := make([]string, 0, len(matchLabels))
+	for name, value := range matchLabels {
+		matchers = append(matchers, fmt.Sprintf("%s=%q", name, value))
+	}
+	sort.Strings(matchers)
+	return strings.Join(matchers, ","), nil
+}
+
+// renderPrometheusQuery renders the template variables of a query for the
+// HPA. Queries without template actions are returned as is.
+func renderPrometheusQuery(client kubernetes.Interface, hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, query string) (string, error) {
+	if !strings.Contains(query, "{{") {
+		return query, nil
+	}
+
+	tmpl, err := template.New(config.Name).Option("missingkey=error").Parse(query)
+	if err != nil {
+		return "", fmt.Errorf("invalid query template: %v", err)
+	}
+
+	data := &prometheusQueryData{
+		client:          client,
+		hpa:             hpa,
+		Namespace:       hpa.Namespace,
+		HPAName:         hpa.Name,
+		ScaleTargetKind: hpa.Spec.ScaleTargetRef.Kind,
+		ScaleTargetName: hpa.Spec.ScaleTargetRef.Name,
+		Metric:          config.Name,
+		Labels:          config.Labels,
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to render query template: %v", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,150 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	defaultPrometheusWindow    = 1 * time.Minute
+	defaultPrometheusMaxWindow = 10 * time.Minute
+	defaultPrometheusStep      = 15 * time.Second
+	prometheusWindowLabelKey   = "prometheus-window"
+)
+
+// parseWindowConfig parses the config of the window widening. Widening is
+// enabled by setting min-samples.
+func (c *PrometheusCollector) parseWindowConfig(config map[string]string) error {
+	v, ok := config["min-samples"]
+	if !ok {
+		return nil
+	}
+
+	minSamples, err := strconv.Atoi(v)
+	if err != nil || minSamples <= 0 {
+		return fmt.Errorf("invalid min-samples value '%s'", v)
+	}
+	c.minSamples = minSamples
+
+	c.window = defaultPrometheusWindow
+	c.maxWindow = defaultPrometheusMaxWindow
+	c.step = defaultPrometheusStep
+
+	for key, duration := range map[string]*time.Duration{
+		"window":     &c.window,
+		"max-window": &c.maxWindow,
+		"step":       &c.step,
+	} {
+		if v, ok := config[key]; ok {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid %s value '%s'", key, v)
+			}
+			*duration = d
+		}
+	}
+
+	if c.maxWindow < c.window {
+		return fmt.Errorf("max-window %s must not be smaller than window %s", c.maxWindow, c.window)
+	}
+
+	return nil
+}
+
+// queryWidening runs the query as range query over the window and returns
+// the average of the samples. If the result has fewer than min-samples
+// samples the window is doubled, up to max-window, until there are enough
+// samples. If there are still too few samples at max-window the average of
+// the samples found is used.
+func (c *PrometheusCollector) queryWidening(ctx context.Context) (model.SampleValue, string, error) {
+	window := c.window
+	for {
+		samples, replica, err := c.queryRange(ctx, window)
+		if err != nil {
+			return 0, "", err
+		}
+
+		if len(samples) >= c.minSamples || window >= c.maxWindow {
+			if len(samples) == 0 {
+				return 0, "", fmt.Errorf("query '%s' returned no samples within %s", c.query, window)
+			}
+
+			if len(samples) < c.minSamples {
+				glog.Warningf("Query '%s' returned only %d of %d samples within max window %s", c.query, len(samples), c.minSamples, window)
+			} else if window > c.window {
+				glog.Infof("Widened window of query '%s' to %s to get %d samples", c.query, window, len(samples))
+			}
+
+			// the widened window is reset once the base window
+			// has enough samples again.
+			c.widenedWindow = 0
+			if window > c.window {
+				c.widenedWindow = window
+			}
+
+			var sum model.SampleValue
+			for _, sample := range samples {
+				sum += sample
+			}
+			return sum / model.SampleValue(len(samples)), replica, nil
+		}
+
+		window *= 2
+		if window > c.maxWindow {
+			window = c.maxWindow
+		}
+	}
+}
+
+// queryRange runs the query as range query over the window and returns the
+// samples of all series. The timestamp of the latest sample is recorded as
+// sample time.
+func (c *PrometheusCollector) queryRange(ctx context.Context, window time.Duration) ([]model.SampleValue, string, error) {
+	end := time.Now().UTC()
+	r := promv1.Range{
+		Start: end.Add(-window),
+		End:   end,
+		Step:  c.step,
+	}
+
+	value, replica, err := c.queryReplicas(ctx, fmt.Sprintf("%s [range: %s]", c.query, window), func(ctx context.Context, promAPI promv1.API) (model.Value, error) {
+		value, warnings, err := promAPI.QueryRange(ctx, c.query, r)
+		logQueryWarnings(c.query, warnings)
+		return value, err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	matrix, ok := value.(model.Matrix)
+	if !ok {
+		return nil, "", fmt.Errorf("range query '%s' returned unsupported type %s", c.query, value.Type())
+	}
+
+	var samples []model.SampleValue
+	var latest model.Time
+	for _, series := range matrix {
+		for _, pair := range series.Values {
+			if pair.Value.String() == "NaN" {
+				continue
+			}
+			samples = append(samples, pair.Value)
+			if pair.Timestamp.After(latest) {
+				latest = pair.Timestamp
+			}
+		}
+	}
+
+	c.sampleTime = time.Time{}
+	if latest != 0 {
+		c.sampleTime = latest.Time()
+	}
+
+	return samples, replica, nil
+}
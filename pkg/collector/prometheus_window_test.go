@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeRangePromAPI answers range queries with samples of value 1 every
+// sample interval within the range. No samples are returned if the sample
+// interval is 0.
+type fakeRangePromAPI struct {
+	promv1.API
+	sampleInterval time.Duration
+}
+
+func (f *fakeRangePromAPI) QueryRange(ctx context.Context, query string, r promv1.Range) (model.Value, promv1.Warnings, error) {
+	series := &model.SampleStream{}
+	for t := r.End; f.sampleInterval > 0 && !t.Before(r.Start); t = t.Add(-f.sampleInterval) {
+		series.Values = append(series.Values, model.SamplePair{Timestamp: model.TimeFromUnixNano(t.UnixNano()), Value: 1})
+	}
+	return model.Matrix{series}, nil, nil
+}
+
+func TestPrometheusCollectorWidening(t *testing.T) {
+	fake := &fakeRangePromAPI{}
+	c := &PrometheusCollector{
+		hpa:        &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default"}},
+		query:      "up",
+		metricName: "up",
+		replicas:   []prometheusReplica{{address: "a", promAPI: fake}},
+		minSamples: 4,
+		window:     time.Minute,
+		maxWindow:  8 * time.Minute,
+		step:       15 * time.Second,
+	}
+
+	for _, tc := range []struct {
+		msg            string
+		sampleInterval time.Duration
+		window         string
+		err            bool
+	}{
+		{msg: "base window has enough samples", sampleInterval: 15 * time.Second},
+		{msg: "widened until enough samples", sampleInterval: 30 * time.Second, window: "2m0s"},
+		{msg: "max window with too few samples", sampleInterval: 5 * time.Minute, window: "8m0s"},
+		{msg: "reset once base window has enough samples", sampleInterval: 15 * time.Second},
+		{msg: "no samples", err: true},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			fake.sampleInterval = tc.sampleInterval
+
+			values, err := c.GetMetrics(context.Background())
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error, got %v", values)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if window := values[0].Labels[prometheusWindowLabelKey]; window != tc.window {
+				t.Errorf("expected widened window '%s', got '%s'", tc.window, window)
+			}
+		})
+	}
+}
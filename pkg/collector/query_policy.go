@@ -0,0 +1,343 @@
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/api/core/v1"
+)
+
+const (
+	queryConfKey    = "query"
+	queryRefConfKey = "query-ref"
+)
+
+// collectorQueryKeys are the config keys holding the queries of the
+// collectors whose query isn't defined by the query key. The first key is
+// the key named queries are resolved to.
+var collectorQueryKeys = map[string][]string{
+	AppDynamicsCollectorName:   {"metric-path"},
+	AzureMonitorCollectorName:  {"filter"},
+	CloudWatchCollectorName:    {"expression"},
+	DynatraceCollectorName:     {"metric-selector", "entity-selector"},
+	GCPMonitoringCollectorName: {queryConfKey, "filter"},
+	GraphiteCollectorName:      {"target"},
+}
+
+// queryKeywords are identifiers which can be followed by a parenthesis in a
+// PromQL query without being a function call.
+var queryKeywords = map[string]bool{
+	"by":          true,
+	"without":     true,
+	"on":          true,
+	"ignoring":    true,
+	"group_left":  true,
+	"group_right": true,
+	"and":         true,
+	"or":          true,
+	"unless":      true,
+	"bool":        true,
+	"offset":      true,
+}
+
+// QueryPolicy restricts the queries which can be defined in HPA
+// annotations. Queries can either be defined inline, in which case they are
+// validated against the allowed functions and denied patterns, or reference
+// a trusted named query of the policy via query-ref. The allowed functions
+// only apply to PromQL queries, the other checks to the queries of all
+// collectors.
+type QueryPolicy struct {
+	// RequireNamedQueries rejects all inline queries, only named queries
+	// can be used.
+	RequireNamedQueries bool `json:"requireNamedQueries"`
+	// AllowedFunctions is the list of functions and aggregation operators
+	// inline queries may use. If empty all functions are allowed.
+	AllowedFunctions []string `json:"allowedFunctions"`
+	// DeniedPatterns is a list of regular expressions which must not
+	// match inline queries.
+	DeniedPatterns []string `json:"deniedPatterns"`
+	// MaxQueryLength is the maximum length of inline queries. 0 means no
+	// limit.
+	MaxQueryLength int `json:"maxQueryLength"`
+	// NamedQueries are trusted queries which can be referenced by name.
+	NamedQueries map[string]string `json:"namedQueries"`
+
+	allowedFunctions map[string]bool
+	deniedPatterns   []*regexp.Regexp
+}
+
+// LoadQueryPolicy loads a query policy from a YAML or JSON file.
+func LoadQueryPolicy(path string) (*QueryPolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &QueryPolicy{}
+	err = yaml.Unmarshal(data, policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query policy: %v", err)
+	}
+
+	if len(policy.AllowedFunctions) > 0 {
+		policy.allowedFunctions = make(map[string]bool, len(policy.AllowedFunctions))
+		for _, function := range policy.AllowedFunctions {
+			policy.allowedFunctions[function] = true
+		}
+	}
+
+	for _, pattern := range policy.DeniedPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid denied pattern '%s': %v", pattern, err)
+		}
+		policy.deniedPatterns = append(policy.deniedPatterns, re)
+	}
+
+	return policy, nil
+}
+
+// SetQueryPolicy sets the policy applied to the queries of all collectors
+// created by the factory.
+func (c *CollectorFactory) SetQueryPolicy(policy *QueryPolicy) {
+	c.queryPolicy = policy
+}
+
+// applyQueryPolicy renders the query templates of the metric config,
+// resolves its query references and validates its inline queries. Queries
+// are validated after rendering, such that the policy applies to the query
+// which is run. Rejected queries are reported as event on the HPA.
+func (c *CollectorFactory) applyQueryPolicy(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig) error {
+	render := func(query string) (string, error) {
+		if !promQLCollector(config) {
+			return query, nil
+		}
+		return renderPrometheusQuery(c.client, hpa, config, query)
+	}
+
+	err := c.queryPolicy.apply(config, render)
+	if err != nil {
+		err = fmt.Errorf("query of metric '%s' rejected by query policy: %v", config.Name, err)
+		if c.recorder != nil {
+			c.recorder.Eventf(hpa, v1.EventTypeWarning, "QueryRejected", "%v", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// promQLCollector returns true if the collector of the metric config runs
+// PromQL queries.
+func promQLCollector(config *MetricConfig) bool {
+	return config.CollectorName == PrometheusCollectorName || config.CollectorName == VictoriaMetricsCollectorName
+}
+
+// queryKeys returns the config keys holding the queries of the collector of
+// the metric config. Collectors not known to define their query with
+// another key, including external plugins, define it with the query key.
+func queryKeys(config *MetricConfig) []string {
+	if keys, ok := collectorQueryKeys[config.CollectorName]; ok {
+		return keys
+	}
+	return []string{queryConfKey}
+}
+
+// containsString returns true if the value is in the values.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// apply resolves the query reference of the metric config to the named
+// query and validates the inline queries after rendering them. Sub configs
+// like primary.query are covered when the collectors of the sources are
+// created. The resolved reference or rendered query is replaced in the
+// config. Without a policy, i.e. for a nil policy, queries are only
+// rendered.
+func (p *QueryPolicy) apply(config *MetricConfig, render func(query string) (string, error)) error {
+	keys := queryKeys(config)
+	promQL := promQLCollector(config)
+
+	resolved := make(map[string]string)
+	for key, value := range config.Config {
+		switch {
+		case key == queryRefConfKey:
+			if p == nil {
+				continue
+			}
+			query, ok := p.NamedQueries[value]
+			if !ok {
+				return fmt.Errorf("named query '%s' not found", value)
+			}
+			if _, ok := config.Config[keys[0]]; ok {
+				return fmt.Errorf("both %s and %s defined", queryRefConfKey, keys[0])
+			}
+			query, err := render(query)
+			if err != nil {
+				return err
+			}
+			resolved[keys[0]] = query
+		case containsString(keys, key):
+			query, err := render(value)
+			if err != nil {
+				return err
+			}
+			if p != nil {
+				err = p.validate(query, promQL)
+				if err != nil {
+					return fmt.Errorf("%s: %v", key, err)
+				}
+			}
+			if query != value {
+				resolved[key] = query
+			}
+		}
+	}
+
+	if len(resolved) == 0 {
+		return nil
+	}
+
+	// copy the config to not modify a config shared with the caller.
+	resolvedConfig := make(map[string]string, len(config.Config))
+	for key, value := range config.Config {
+		if key == queryRefConfKey && p != nil {
+			continue
+		}
+		resolvedConfig[key] = value
+	}
+
+	for key, query := range resolved {
+		resolvedConfig[key] = query
+	}
+	config.Config = resolvedConfig
+
+	return nil
+}
+
+// validate validates an inline query against the policy. The functions of
+// the query are only checked for PromQL queries.
+func (p *QueryPolicy) validate(query string, promQL bool) error {
+	if p.RequireNamedQueries {
+		return fmt.Errorf("inline queries are not allowed, use %s", queryRefConfKey)
+	}
+
+	if p.MaxQueryLength > 0 && len(query) > p.MaxQueryLength {
+		return fmt.Errorf("query exceeds the maximum length of %d", p.MaxQueryLength)
+	}
+
+	for _, re := range p.deniedPatterns {
+		if re.MatchString(query) {
+			return fmt.Errorf("query matches denied pattern '%s'", re.String())
+		}
+	}
+
+	if p.allowedFunctions == nil || !promQL {
+		return nil
+	}
+
+	functions, err := queryFunctions(query)
+	if err != nil {
+		return err
+	}
+
+	for _, function := range functions {
+		if !p.allowedFunctions[function] {
+			return fmt.Errorf("function '%s' is not allowed", function)
+		}
+	}
+
+	return nil
+}
+
+// queryFunctions returns the functions and aggregation operators called in
+// a PromQL query, i.e. all identifiers which are not keywords and are
+// followed by an opening parenthesis or a grouping clause. String literals are skipped so they
+// can't be used to hide calls, unterminated strings and unbalanced
+// parentheses are rejected.
+func queryFunctions(query string) ([]string, error) {
+	var functions []string
+	depth := 0
+
+	for i := 0; i < len(query); {
+		ch := query[i]
+		switch {
+		case ch == '"' || ch == '\'' || ch == '`':
+			end := i + 1
+			for ; end < len(query) && query[end] != ch; end++ {
+				if query[end] == '\\' && ch != '`' {
+					end++
+				}
+			}
+			if end >= len(query) {
+				return nil, fmt.Errorf("unterminated string in query")
+			}
+			i = end + 1
+		case isIdentifierStart(ch):
+			start := i
+			for i < len(query) && isIdentifierChar(query[i]) {
+				i++
+			}
+			identifier := query[start:i]
+
+			j := i
+			for j < len(query) && (query[j] == ' ' || query[j] == '\t' || query[j] == '\n') {
+				j++
+			}
+			if queryKeywords[strings.ToLower(identifier)] {
+				continue
+			}
+
+			// aggregation operators can have the grouping clause
+			// before the parameters: sum by (label) (...).
+			if (j < len(query) && query[j] == '(') || hasGroupingPrefix(query[j:]) {
+				functions = append(functions, identifier)
+			}
+		case ch == '(':
+			depth++
+			i++
+		case ch == ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced parentheses in query")
+			}
+			i++
+		default:
+			i++
+		}
+	}
+
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced parentheses in query")
+	}
+
+	return functions, nil
+}
+
+// hasGroupingPrefix returns true if the query starts with a by or without
+// grouping clause.
+func hasGroupingPrefix(query string) bool {
+	for _, keyword := range []string{"by", "without"} {
+		if len(query) > len(keyword) && strings.EqualFold(query[:len(keyword)], keyword) && !isIdentifierChar(query[len(keyword)]) {
+			return true
+		}
+	}
+	return false
+}
+
+func isIdentifierStart(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func isIdentifierChar(ch byte) bool {
+	return isIdentifierStart(ch) || ch == ':' || (ch >= '0' && ch <= '9')
+}
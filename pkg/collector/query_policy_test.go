@@ -0,0 +1,294 @@
+package collector
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestQueryFunctions(t *testing.T) {
+	for _, tc := range []struct {
+		msg       string
+		query     string
+		functions []string
+		err       bool
+	}{
+		{
+			msg:       "functions and aggregations",
+			query:     `sum(rate(http_requests_total{app="foo"}[1m]))`,
+			functions: []string{"sum", "rate"},
+		},
+		{
+			msg:       "grouping clause before parameters",
+			query:     `sum by (pod) (rate(requests[1m]))`,
+			functions: []string{"sum", "rate"},
+		},
+		{
+			msg:       "keywords are no functions",
+			query:     `sum(a) by (pod) / on (pod) group_left() sum(b)`,
+			functions: []string{"sum", "sum"},
+		},
+		{
+			msg:   "calls in strings are skipped",
+			query: `up{job="label_replace(x)"}`,
+		},
+		{
+			msg:   "unterminated string",
+			query: `up{job="foo}`,
+			err:   true,
+		},
+		{
+			msg:   "unbalanced parentheses",
+			query: `sum(rate(up[1m])`,
+			err:   true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			functions, err := queryFunctions(tc.query)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error, got %v", functions)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(functions, tc.functions) {
+				t.Errorf("expected functions %v, got %v", tc.functions, functions)
+			}
+		})
+	}
+}
+
+func TestQueryPolicyApply(t *testing.T) {
+	policy := &QueryPolicy{
+		AllowedFunctions: []string{"sum", "rate"},
+		MaxQueryLength:   100,
+		NamedQueries: map[string]string{
+			"requests": `sum(rate(requests[1m]))`,
+		},
+		allowedFunctions: map[string]bool{"sum": true, "rate": true},
+		deniedPatterns:   []*regexp.Regexp{regexp.MustCompile(`\[[0-9]+d\]`)},
+	}
+
+	// render stands in for rendering the query template of the HPA.
+	render := func(query string) (string, error) {
+		query = strings.ReplaceAll(query, "{{.Namespace}}", "default")
+		return strings.ReplaceAll(query, "{{.Window}}", "30d"), nil
+	}
+
+	for _, tc := range []struct {
+		msg       string
+		policy    *QueryPolicy
+		collector string
+		config    map[string]string
+		expected  map[string]string
+		err       bool
+	}{
+		{
+			msg:      "allowed inline query",
+			config:   map[string]string{"query": `sum(rate(requests[1m]))`},
+			expected: map[string]string{"query": `sum(rate(requests[1m]))`},
+		},
+		{
+			msg:    "function not allowed",
+			config: map[string]string{"query": `count(requests)`},
+			err:    true,
+		},
+		{
+			msg:    "denied pattern",
+			config: map[string]string{"query": `sum(rate(requests[30d]))`},
+			err:    true,
+		},
+		{
+			msg:    "too long",
+			config: map[string]string{"query": `sum(rate(requests{app="` + strings.Repeat("a", 100) + `"}[1m]))`},
+			err:    true,
+		},
+		{
+			msg:      "prefixed inline query is validated with its source",
+			config:   map[string]string{"primary.query": `count(requests)`},
+			expected: map[string]string{"primary.query": `count(requests)`},
+		},
+		{
+			msg:      "rendered inline query",
+			config:   map[string]string{"query": `sum(rate(requests{namespace="{{.Namespace}}"}[1m]))`},
+			expected: map[string]string{"query": `sum(rate(requests{namespace="default"}[1m]))`},
+		},
+		{
+			msg:    "denied pattern in rendered query",
+			config: map[string]string{"query": `sum(rate(requests[{{.Window}}]))`},
+			err:    true,
+		},
+		{
+			msg:      "named query reference",
+			config:   map[string]string{"query-ref": "requests", "interval": "1m"},
+			expected: map[string]string{"query": `sum(rate(requests[1m]))`, "interval": "1m"},
+		},
+		{
+			msg:      "prefixed named query reference is resolved with its source",
+			config:   map[string]string{"secondary.query-ref": "requests"},
+			expected: map[string]string{"secondary.query-ref": "requests"},
+		},
+		{
+			msg:    "unknown named query",
+			config: map[string]string{"query-ref": "unknown"},
+			err:    true,
+		},
+		{
+			msg:    "reference and inline query",
+			config: map[string]string{"query-ref": "requests", "query": `sum(requests)`},
+			err:    true,
+		},
+		{
+			msg:    "inline query with named queries required",
+			policy: &QueryPolicy{RequireNamedQueries: true},
+			config: map[string]string{"query": `up`},
+			err:    true,
+		},
+		{
+			msg:       "functions of non PromQL queries are not checked",
+			collector: InfluxDBCollectorName,
+			config:    map[string]string{"query": `from(bucket: "jobs") |> count()`},
+			expected:  map[string]string{"query": `from(bucket: "jobs") |> count()`},
+		},
+		{
+			msg:       "only the query keys of the collector are validated",
+			collector: GraphiteCollectorName,
+			config:    map[string]string{"target": `summarize(requests, "30d")`, "from": "-[30d]"},
+			expected:  map[string]string{"target": `summarize(requests, "30d")`, "from": "-[30d]"},
+		},
+		{
+			msg:       "graphite target too long",
+			collector: GraphiteCollectorName,
+			config:    map[string]string{"target": strings.Repeat("a", 101)},
+			err:       true,
+		},
+		{
+			msg:       "dynatrace entity selector with denied pattern",
+			collector: DynatraceCollectorName,
+			config:    map[string]string{"metric-selector": "builtin:service.requestCount.total", "entity-selector": "type(SERVICE),tag([30d])"},
+			err:       true,
+		},
+		{
+			msg:       "cloudwatch expression with named queries required",
+			policy:    &QueryPolicy{RequireNamedQueries: true},
+			collector: CloudWatchCollectorName,
+			config:    map[string]string{"expression": "SUM(METRICS())"},
+			err:       true,
+		},
+		{
+			msg:       "named query resolved to the query key of the collector",
+			collector: GraphiteCollectorName,
+			config:    map[string]string{"query-ref": "requests"},
+			expected:  map[string]string{"target": `sum(rate(requests[1m]))`},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			p := policy
+			if tc.policy != nil {
+				p = tc.policy
+			}
+
+			collector := PrometheusCollectorName
+			if tc.collector != "" {
+				collector = tc.collector
+			}
+
+			config := &MetricConfig{CollectorName: collector, Config: tc.config}
+			err := p.apply(config, render)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error, got config %v", config.Config)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(config.Config, tc.expected) {
+				t.Errorf("expected config %v, got %v", tc.expected, config.Config)
+			}
+		})
+	}
+}
+
+func TestCollectorFactoryQueryPolicy(t *testing.T) {
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp", Namespace: "default"},
+	}
+
+	for _, tc := range []struct {
+		msg      string
+		config   *MetricConfig
+		expected map[string]string
+		err      bool
+	}{
+		{
+			msg: "query validated after rendering",
+			config: &MetricConfig{
+				MetricTypeName: MetricTypeName{Type: autoscalingv2.ObjectMetricSourceType, Name: "requests"},
+				CollectorName:  PrometheusCollectorName,
+				Config:         map[string]string{"query": `sum(rate(requests{namespace="{{.Namespace}}"}[1m]))`},
+			},
+			expected: map[string]string{"query": `sum(rate(requests{namespace="default"}[1m]))`},
+		},
+		{
+			msg: "rendered query rejected",
+			config: &MetricConfig{
+				MetricTypeName: MetricTypeName{Type: autoscalingv2.ObjectMetricSourceType, Name: "requests"},
+				CollectorName:  PrometheusCollectorName,
+				Config:         map[string]string{"query": `sum(rate(requests{hpa="{{.HPAName}}"}[1m]))`},
+			},
+			err: true,
+		},
+		{
+			msg: "query of a cross check source rejected",
+			config: &MetricConfig{
+				MetricTypeName: MetricTypeName{Type: autoscalingv2.ObjectMetricSourceType, Name: "requests"},
+				CollectorName:  CrossCheckCollectorName,
+				Config: map[string]string{
+					"primary.collector":   PrometheusCollectorName,
+					"primary.query":       `count(requests)`,
+					"secondary.collector": PrometheusCollectorName,
+					"secondary.query":     `sum(requests)`,
+				},
+			},
+			err: true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			factory := NewCollectorFactory(nil, nil)
+			factory.SetQueryPolicy(&QueryPolicy{
+				allowedFunctions: map[string]bool{"sum": true, "rate": true},
+				deniedPatterns:   []*regexp.Regexp{regexp.MustCompile(`hpa="myapp"`)},
+			})
+			recorder := NewDryRunRecorder()
+			_ = factory.RegisterObjectCollector("", PrometheusCollectorName, recorder.Wrap(fakePlugin{}))
+			crossCheckPlugin := NewCrossCheckCollectorPlugin(factory)
+			_ = factory.RegisterObjectCollector("", CrossCheckCollectorName, crossCheckPlugin)
+
+			_, err := factory.NewCollector(hpa, tc.config, time.Minute)
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			configs := recorder.Configs()
+			if len(configs) != 1 || !reflect.DeepEqual(configs[0].Config, tc.expected) {
+				t.Errorf("expected config %v, got %v", tc.expected, configs)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+)
+
+// backendRateLimiters are the rate limiters shared by all collectors of a
+// backend, by backend name.
+var backendRateLimiters = map[string]*rate.Limiter{}
+
+// SetBackendRateLimits limits the number of collections per second of the
+// collectors of each backend. All collectors of a backend, also of remote
+// clusters, share a single token bucket.
+func SetBackendRateLimits(limits map[string]float64) {
+	backendRateLimiters = make(map[string]*rate.Limiter, len(limits))
+	for backend, limit := range limits {
+		burst := int(limit)
+		if burst < 1 {
+			burst = 1
+		}
+		backendRateLimiters[backend] = rate.NewLimiter(rate.Limit(limit), burst)
+	}
+}
+
+// ParseBackendRateLimit parses a rate limit of the form <backend>=<n>/<unit>,
+// e.g. cloudwatch=5/s, where the unit is s, m or h. It returns the backend
+// and the limit per second.
+func ParseBackendRateLimit(value string) (string, float64, error) {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", 0, fmt.Errorf("invalid rate limit '%s', must be <backend>=<n>/<unit>", value)
+	}
+
+	limit := strings.SplitN(parts[1], "/", 2)
+	if len(limit) != 2 {
+		return "", 0, fmt.Errorf("invalid rate limit '%s', must be <backend>=<n>/<unit>", value)
+	}
+
+	n, err := strconv.ParseFloat(limit[0], 64)
+	if err != nil || n <= 0 {
+		return "", 0, fmt.Errorf("invalid rate limit '%s', the number of collections must be greater than 0", value)
+	}
+
+	var unit time.Duration
+	switch limit[1] {
+	case "s":
+		unit = time.Second
+	case "m":
+		unit = time.Minute
+	case "h":
+		unit = time.Hour
+	default:
+		return "", 0, fmt.Errorf("invalid rate limit '%s', the unit must be s, m or h", value)
+	}
+
+	return parts[0], n / unit.Seconds(), nil
+}
+
+// backendName returns the name of the backend of a metric config, its
+// collector name or the metric name for external metrics without one.
+func backendName(config *MetricConfig) string {
+	if config.CollectorName == "" && config.Type == autoscalingv2.ExternalMetricSourceType {
+		return config.Name
+	}
+	return config.CollectorName
+}
+
+// RateLimitedCollector is a collector which waits for a token of the rate
+// limiter of its backend before each collection.
+type RateLimitedCollector struct {
+	collector Collector
+	backend   string
+	limiter   *rate.Limiter
+}
+
+// NewRateLimitedCollector wraps the collector with the rate limiter of the
+// backend of the metric config. The collector is returned as is if the
+// backend isn't rate limited.
+func NewRateLimitedCollector(collector Collector, config *MetricConfig) Collector {
+	backend := backendName(config)
+	limiter, ok := backendRateLimiters[backend]
+	if !ok {
+		return collector
+	}
+
+	return &RateLimitedCollector{
+		collector: collector,
+		backend:   backend,
+		limiter:   limiter,
+	}
+}
+
+// GetMetrics waits for a token and gets metrics from the underlying
+// collector.
+func (c *RateLimitedCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	err := c.limiter.Wait(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("rate limit of backend %s: %v", c.backend, err)
+	}
+	return c.collector.GetMetrics(ctx)
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *RateLimitedCollector) Interval() time.Duration {
+	return c.collector.Interval()
+}
@@ -0,0 +1,91 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	replicaConversionMultiply = "multiply"
+	replicaConversionDivide   = "divide"
+)
+
+// ReplicaConversionCollector is a collector which converts the values of
+// another collector between per pod and absolute values using the current
+// number of ready replicas of the HPA's scale target.
+type ReplicaConversionCollector struct {
+	client    kubernetes.Interface
+	collector Collector
+	hpa       *autoscalingv2.HorizontalPodAutoscaler
+	direction string
+	clamp     bool
+}
+
+// NewReplicaConversionCollector initializes a new
+// ReplicaConversionCollector. The direction must be either multiply, to turn
+// per pod values into absolute values, or divide, to turn absolute values
+// into per pod values. If clamp is true the replica count is clamped to the
+// bounds of the HPA.
+func NewReplicaConversionCollector(client kubernetes.Interface, collector Collector, hpa *autoscalingv2.HorizontalPodAutoscaler, direction string, clamp bool) (*ReplicaConversionCollector, error) {
+	switch direction {
+	case replicaConversionMultiply, replicaConversionDivide:
+	default:
+		return nil, fmt.Errorf("unsupported replica conversion '%s'", direction)
+	}
+
+	return &ReplicaConversionCollector{
+		client:    client,
+		collector: collector,
+		hpa:       hpa,
+		direction: direction,
+		clamp:     clamp,
+	}, nil
+}
+
+// GetMetrics gets metrics from the underlying collector and converts them
+// using the current replica count.
+func (c *ReplicaConversionCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	values, partial, err := getPartialMetrics(ctx, c.collector)
+	if err != nil {
+		return nil, err
+	}
+
+	replicas, err := targetRefReplicas(c.client, c.hpa)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.clamp {
+		replicas = clampReplicas(replicas, c.hpa)
+	}
+
+	if replicas == 0 && c.direction == replicaConversionDivide {
+		return nil, fmt.Errorf("unable to convert metric, scale target %s/%s has no ready replicas", c.hpa.Namespace, c.hpa.Spec.ScaleTargetRef.Name)
+	}
+
+	converted := make([]CollectedMetric, 0, len(values))
+	for _, value := range values {
+		var err error
+		switch c.direction {
+		case replicaConversionMultiply:
+			err = value.setFloatValue(value.floatValue() * float64(replicas))
+		case replicaConversionDivide:
+			err = value.setFloatValue(value.floatValue() / float64(replicas))
+		}
+		if err != nil {
+			return nil, err
+		}
+		converted = append(converted, value)
+	}
+
+	return partialMetrics(converted, partial)
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *ReplicaConversionCollector) Interval() time.Duration {
+	return c.collector.Interval()
+}
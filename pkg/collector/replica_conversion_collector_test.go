@@ -0,0 +1,119 @@
+package collector
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// replicaConversionHPA returns an HPA scaling the deployment app.
+func replicaConversionHPA() *autoscalingv2.HorizontalPodAutoscaler {
+	minReplicas := int32(2)
+	return &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{Kind: "Deployment", Name: "app"},
+			MinReplicas:    &minReplicas,
+			MaxReplicas:    10,
+		},
+	}
+}
+
+func TestReplicaConversionCollector(t *testing.T) {
+	for _, tc := range []struct {
+		msg       string
+		direction string
+		replicas  int32
+		clamp     bool
+		value     float64
+		expected  float64
+		err       bool
+	}{
+		{
+			msg:       "multiply per pod value",
+			direction: replicaConversionMultiply,
+			replicas:  4,
+			value:     2.5,
+			expected:  10,
+		},
+		{
+			msg:       "divide absolute value",
+			direction: replicaConversionDivide,
+			replicas:  4,
+			value:     10,
+			expected:  2.5,
+		},
+		{
+			msg:       "multiply without ready replicas",
+			direction: replicaConversionMultiply,
+			value:     10,
+			expected:  0,
+		},
+		{
+			msg:       "divide without ready replicas",
+			direction: replicaConversionDivide,
+			value:     10,
+			err:       true,
+		},
+		{
+			msg:       "clamped to max replicas",
+			direction: replicaConversionDivide,
+			replicas:  20,
+			clamp:     true,
+			value:     10,
+			expected:  1,
+		},
+		{
+			msg:       "clamped to min replicas",
+			direction: replicaConversionMultiply,
+			replicas:  1,
+			clamp:     true,
+			value:     10,
+			expected:  20,
+		},
+		{
+			msg:       "divide without ready replicas when clamped",
+			direction: replicaConversionDivide,
+			clamp:     true,
+			value:     10,
+			err:       true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			client := fake.NewSimpleClientset(&appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+				Status:     appsv1.DeploymentStatus{ReadyReplicas: tc.replicas},
+			})
+			source := &fakeCollector{values: []CollectedMetric{externalValue("requests", tc.value)}}
+			c, err := NewReplicaConversionCollector(client, source, replicaConversionHPA(), tc.direction, tc.clamp)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			values, err := c.GetMetrics(context.Background())
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error, got %v", values)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(values) != 1 || values[0].floatValue() != tc.expected {
+				t.Errorf("expected value %v, got %v", tc.expected, values)
+			}
+		})
+	}
+}
+
+func TestNewReplicaConversionCollectorInvalidDirection(t *testing.T) {
+	_, err := NewReplicaConversionCollector(fake.NewSimpleClientset(), &fakeCollector{}, replicaConversionHPA(), "square", false)
+	if err == nil {
+		t.Error("expected error for unsupported direction")
+	}
+}
@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryAfterError is returned when a metrics backend asked to not be queried
+// again before a certain amount of time has passed, e.g. by sending a
+// Retry-After header on a 429 or 503 response.
+type RetryAfterError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%v (retry after %s)", e.Err, e.RetryAfter)
+}
+
+// RetryAfter returns the duration a backend asked to wait before the next
+// query if err is, or wraps, a RetryAfterError.
+func RetryAfter(err error) (time.Duration, bool) {
+	var retryErr *RetryAfterError
+	if errors.As(err, &retryErr) {
+		return retryErr.RetryAfter, true
+	}
+	return 0, false
+}
+
+// retryAfterFromResponse returns a RetryAfterError if the response is a 429
+// or 503 with a valid Retry-After header.
+func retryAfterFromResponse(resp *http.Response) *RetryAfterError {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return nil
+	}
+
+	retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	if !ok {
+		return nil
+	}
+
+	return &RetryAfterError{
+		Err:        fmt.Errorf("unsuccessful response: %s", resp.Status),
+		RetryAfter: retryAfter,
+	}
+}
+
+// parseRetryAfter parses the value of a Retry-After header which can either
+// be a number of seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	retryAfter := date.Sub(now)
+	if retryAfter < 0 {
+		retryAfter = 0
+	}
+	return retryAfter, true
+}
+
+// retryAfterRoundTripper is an http.RoundTripper which turns responses with
+// a Retry-After header into a RetryAfterError.
+type retryAfterRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (rt *retryAfterRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if retryErr := retryAfterFromResponse(resp); retryErr != nil {
+		_, _ = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, retryErr
+	}
+
+	return resp, nil
+}
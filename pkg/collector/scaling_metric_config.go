@@ -0,0 +1,140 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	configRefConfKey = "config-ref"
+	// scalingMetricConfigSecretLabel is the label opting a Secret in to
+	// be read for the credentials of ScalingMetricConfigs. Without it,
+	// anyone allowed to create ScalingMetricConfigs could make the adapter
+	// send any Secret of the namespace to a metrics backend of their
+	// choice.
+	scalingMetricConfigSecretLabel = "kube-metrics-adapter/scaling-metric-config"
+)
+
+// scalingMetricConfigResource is the resource of the ScalingMetricConfig
+// CRD.
+var scalingMetricConfigResource = schema.GroupVersionResource{
+	Group:    "zalando.org",
+	Version:  "v1",
+	Resource: "scalingmetricconfigs",
+}
+
+// ScalingMetricConfigSpec is the spec of a ScalingMetricConfig resource
+// which defines the configuration of a metric referenced from an HPA.
+type ScalingMetricConfigSpec struct {
+	// Interval is the collection interval of the metric.
+	Interval string `json:"interval,omitempty"`
+	// PerReplica defines if the metric value is divided by the number of
+	// replicas of the scale target.
+	PerReplica bool `json:"perReplica,omitempty"`
+	// Config is the collector specific configuration, with the same keys
+	// as the metric-config annotations, e.g. query.
+	Config map[string]string `json:"config,omitempty"`
+	// Credentials are collector config values read from Secrets in the
+	// namespace of the ScalingMetricConfig.
+	Credentials []ScalingMetricCredential `json:"credentials,omitempty"`
+}
+
+// ScalingMetricCredential is a collector config value read from a Secret.
+type ScalingMetricCredential struct {
+	// Key is the collector config key the value is set for.
+	Key          string          `json:"key"`
+	SecretKeyRef SecretKeySelect `json:"secretKeyRef"`
+}
+
+// SecretKeySelect selects a key of a Secret.
+type SecretKeySelect struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// SetDynamicClient sets the client used to get the ScalingMetricConfig
+// resources referenced from HPAs.
+func (c *CollectorFactory) SetDynamicClient(client dynamic.Interface) {
+	c.dynamicClient = client
+}
+
+// resolveConfigRef resolves the ScalingMetricConfig referenced via
+// config-ref in the metric config. The config defined in the resource is
+// merged with the config from the annotations, annotations take
+// precedence. A copy of the metric config is returned if a reference is
+// resolved.
+func (c *CollectorFactory) resolveConfigRef(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig) (*MetricConfig, error) {
+	name, ok := config.Config[configRefConfKey]
+	if !ok {
+		return config, nil
+	}
+
+	if c.dynamicClient == nil {
+		return nil, fmt.Errorf("ScalingMetricConfig references are not supported")
+	}
+
+	obj, err := c.dynamicClient.Resource(scalingMetricConfigResource).Namespace(hpa.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ScalingMetricConfig %s/%s: %v", hpa.Namespace, name, err)
+	}
+
+	var spec ScalingMetricConfigSpec
+	specObj, ok := obj.Object["spec"].(map[string]interface{})
+	if ok {
+		err = runtime.DefaultUnstructuredConverter.FromUnstructured(specObj, &spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ScalingMetricConfig %s/%s: %v", hpa.Namespace, name, err)
+		}
+	}
+
+	resolved := *config
+	resolved.Config = make(map[string]string, len(spec.Config)+len(config.Config))
+	for key, value := range spec.Config {
+		resolved.Config[key] = value
+	}
+
+	for _, credential := range spec.Credentials {
+		secret, err := c.client.CoreV1().Secrets(hpa.Namespace).Get(context.TODO(), credential.SecretKeyRef.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get secret %s/%s for ScalingMetricConfig %s: %v", hpa.Namespace, credential.SecretKeyRef.Name, name, err)
+		}
+
+		if secret.Labels[scalingMetricConfigSecretLabel] != "true" {
+			return nil, fmt.Errorf("secret %s/%s for ScalingMetricConfig %s is not labeled %s=true", hpa.Namespace, credential.SecretKeyRef.Name, name, scalingMetricConfigSecretLabel)
+		}
+
+		value, ok := secret.Data[credential.SecretKeyRef.Key]
+		if !ok {
+			return nil, fmt.Errorf("key %s not found in secret %s/%s for ScalingMetricConfig %s", credential.SecretKeyRef.Key, hpa.Namespace, credential.SecretKeyRef.Name, name)
+		}
+		resolved.Config[credential.Key] = string(value)
+	}
+
+	for key, value := range config.Config {
+		if key == configRefConfKey {
+			continue
+		}
+		resolved.Config[key] = value
+	}
+
+	if spec.PerReplica {
+		resolved.PerReplica = true
+	}
+
+	if resolved.Interval == 0 && spec.Interval != "" {
+		interval, err := time.ParseDuration(spec.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse interval value %s of ScalingMetricConfig %s/%s: %v", spec.Interval, hpa.Namespace, name, err)
+		}
+		resolved.Interval = interval
+	}
+
+	return &resolved, nil
+}
@@ -0,0 +1,87 @@
+package collector
+
+import (
+	"testing"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestResolveConfigRefCredentials(t *testing.T) {
+	config := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "zalando.org/v1",
+		"kind":       "ScalingMetricConfig",
+		"metadata": map[string]interface{}{
+			"name":      "myapp-rps",
+			"namespace": "default",
+		},
+		"spec": map[string]interface{}{
+			"config": map[string]interface{}{
+				"query": "up",
+			},
+			"credentials": []interface{}{
+				map[string]interface{}{
+					"key": "token",
+					"secretKeyRef": map[string]interface{}{
+						"name": "myapp-metrics",
+						"key":  "token",
+					},
+				},
+			},
+		},
+	}}
+
+	for _, tc := range []struct {
+		msg    string
+		labels map[string]string
+		err    bool
+	}{
+		{
+			msg:    "labeled secret",
+			labels: map[string]string{scalingMetricConfigSecretLabel: "true"},
+		},
+		{
+			msg: "unlabeled secret",
+			err: true,
+		},
+		{
+			msg:    "secret opted out",
+			labels: map[string]string{scalingMetricConfigSecretLabel: "false"},
+			err:    true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			client := fake.NewSimpleClientset(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "myapp-metrics", Namespace: "default", Labels: tc.labels},
+				Data:       map[string][]byte{"token": []byte("secret")},
+			})
+			dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+				scalingMetricConfigResource: "ScalingMetricConfigList",
+			}, config)
+
+			factory := NewCollectorFactory(client, nil)
+			factory.SetDynamicClient(dynamicClient)
+
+			hpa := &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "myapp", Namespace: "default"}}
+			resolved, err := factory.resolveConfigRef(hpa, &MetricConfig{Config: map[string]string{configRefConfKey: "myapp-rps"}})
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error, got config %v", resolved.Config)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resolved.Config["token"] != "secret" || resolved.Config["query"] != "up" {
+				t.Errorf("unexpected resolved config %v", resolved.Config)
+			}
+		})
+	}
+}
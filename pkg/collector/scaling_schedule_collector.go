@@ -0,0 +1,227 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/timewindow"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+)
+
+const (
+	ScalingScheduleMetric        = "scaling-schedule"
+	ClusterScalingScheduleMetric = "cluster-scaling-schedule"
+
+	scalingScheduleLabel = "schedule"
+
+	scheduleTypeRepeating = "Repeating"
+	scheduleTypeOneTime   = "OneTime"
+)
+
+// scalingScheduleResource is the resource of the ScalingSchedule CRD.
+var scalingScheduleResource = schema.GroupVersionResource{
+	Group:    "zalando.org",
+	Version:  "v1",
+	Resource: "scalingschedules",
+}
+
+// clusterScalingScheduleResource is the resource of the cluster scoped
+// ClusterScalingSchedule CRD.
+var clusterScalingScheduleResource = schema.GroupVersionResource{
+	Group:    "zalando.org",
+	Version:  "v1",
+	Resource: "clusterscalingschedules",
+}
+
+// ScalingScheduleSpec is the spec of a ScalingSchedule or
+// ClusterScalingSchedule resource.
+type ScalingScheduleSpec struct {
+	Schedules []Schedule `json:"schedules"`
+}
+
+// Schedule is a recurring or one-off time window during which the metric of
+// a ScalingSchedule has a configured value.
+type Schedule struct {
+	// Type is either Repeating or OneTime.
+	Type string `json:"type"`
+	// Window is the recurring time window of a Repeating schedule, e.g.
+	// "Mon-Fri 08:00-10:00".
+	Window string `json:"window,omitempty"`
+	// Timezone is the IANA timezone of the window of a Repeating
+	// schedule.
+	Timezone string `json:"timezone,omitempty"`
+	// Start and End are the RFC3339 times of a OneTime schedule.
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+	// Value is the metric value while the schedule is active.
+	Value int64 `json:"value"`
+}
+
+// ScalingScheduleCollectorPlugin is a collector plugin for initializing
+// collectors exposing the value of ScalingSchedule or ClusterScalingSchedule
+// resources as external metric.
+type ScalingScheduleCollectorPlugin struct {
+	client        dynamic.Interface
+	clusterScoped bool
+}
+
+// NewScalingScheduleCollectorPlugin initializes a new
+// ScalingScheduleCollectorPlugin for ScalingSchedules in the namespace of the
+// HPA.
+func NewScalingScheduleCollectorPlugin(client dynamic.Interface) *ScalingScheduleCollectorPlugin {
+	return &ScalingScheduleCollectorPlugin{
+		client: client,
+	}
+}
+
+// NewClusterScalingScheduleCollectorPlugin initializes a new
+// ScalingScheduleCollectorPlugin for ClusterScalingSchedules.
+func NewClusterScalingScheduleCollectorPlugin(client dynamic.Interface) *ScalingScheduleCollectorPlugin {
+	return &ScalingScheduleCollectorPlugin{
+		client:        client,
+		clusterScoped: true,
+	}
+}
+
+// NewCollector initializes a new scaling schedule collector from the
+// specified HPA.
+func (p *ScalingScheduleCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	if p.clusterScoped {
+		return NewScalingScheduleCollector(p.client.Resource(clusterScalingScheduleResource), "ClusterScalingSchedule", config, interval)
+	}
+	return NewScalingScheduleCollector(p.client.Resource(scalingScheduleResource).Namespace(hpa.Namespace), "ScalingSchedule", config, interval)
+}
+
+// ScalingScheduleCollector is a metrics collector which exposes the value of
+// the currently active schedules of a ScalingSchedule or
+// ClusterScalingSchedule. The value is the highest value of all active
+// schedules or 0 if no schedule is active.
+type ScalingScheduleCollector struct {
+	client       dynamic.ResourceInterface
+	kind         string
+	scheduleName string
+	metricName   string
+	metricType   autoscalingv2.MetricSourceType
+	labels       map[string]string
+	interval     time.Duration
+	now          func() time.Time
+}
+
+// NewScalingScheduleCollector initializes a new ScalingScheduleCollector
+// getting the schedule of the specified kind from the resource client. The
+// schedule is referenced via the schedule label of the metric selector.
+func NewScalingScheduleCollector(client dynamic.ResourceInterface, kind string, config *MetricConfig, interval time.Duration) (*ScalingScheduleCollector, error) {
+	scheduleName, ok := config.Labels[scalingScheduleLabel]
+	if !ok {
+		return nil, fmt.Errorf("%s label not defined in the selector of metric '%s'", scalingScheduleLabel, config.Name)
+	}
+
+	return &ScalingScheduleCollector{
+		client:       client,
+		kind:         kind,
+		scheduleName: scheduleName,
+		metricName:   config.Name,
+		metricType:   config.Type,
+		labels:       config.Labels,
+		interval:     interval,
+		now:          time.Now,
+	}, nil
+}
+
+// GetMetrics returns the value of the currently active schedules.
+func (c *ScalingScheduleCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	obj, err := c.client.Get(ctx, c.scheduleName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s %s: %v", c.kind, c.scheduleName, err)
+	}
+
+	spec, err := scalingScheduleSpec(obj.Object)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %v", c.kind, c.scheduleName, err)
+	}
+
+	now := c.now()
+	value, err := spec.activeValue(now)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %s: %v", c.kind, c.scheduleName, err)
+	}
+
+	metricValue := CollectedMetric{
+		Type: c.metricType,
+		External: external_metrics.ExternalMetricValue{
+			MetricName:   c.metricName,
+			MetricLabels: c.labels,
+			Timestamp:    metav1.Time{Time: now.UTC()},
+			Value:        *resource.NewQuantity(value, resource.DecimalSI),
+		},
+	}
+
+	return []CollectedMetric{metricValue}, nil
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *ScalingScheduleCollector) Interval() time.Duration {
+	return c.interval
+}
+
+// scalingScheduleSpec converts the spec of an unstructured ScalingSchedule.
+func scalingScheduleSpec(obj map[string]interface{}) (*ScalingScheduleSpec, error) {
+	spec := &ScalingScheduleSpec{}
+	specObj, ok := obj["spec"].(map[string]interface{})
+	if !ok {
+		return spec, nil
+	}
+
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(specObj, spec)
+	if err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// activeValue returns the highest value of the schedules active at the
+// specified time or 0 if no schedule is active.
+func (s *ScalingScheduleSpec) activeValue(now time.Time) (int64, error) {
+	var value int64
+	for _, schedule := range s.Schedules {
+		active, err := schedule.active(now)
+		if err != nil {
+			return 0, err
+		}
+
+		if active && schedule.Value > value {
+			value = schedule.Value
+		}
+	}
+	return value, nil
+}
+
+// active returns true if the schedule is active at the specified time.
+func (s Schedule) active(now time.Time) (bool, error) {
+	switch s.Type {
+	case scheduleTypeRepeating:
+		window, err := timewindow.Parse(s.Window, s.Timezone)
+		if err != nil {
+			return false, err
+		}
+		return window.Contains(now), nil
+	case scheduleTypeOneTime:
+		start, err := time.Parse(time.RFC3339, s.Start)
+		if err != nil {
+			return false, fmt.Errorf("invalid start '%s': %v", s.Start, err)
+		}
+		end, err := time.Parse(time.RFC3339, s.End)
+		if err != nil {
+			return false, fmt.Errorf("invalid end '%s': %v", s.End, err)
+		}
+		return !now.Before(start) && now.Before(end), nil
+	}
+	return false, fmt.Errorf("unsupported schedule type '%s'", s.Type)
+}
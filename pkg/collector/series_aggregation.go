@@ -0,0 +1,45 @@
+package collector
+
+import "math"
+
+// Functions aggregating the latest values of the series returned by a query
+// of backends like Graphite or Datadog.
+const (
+	seriesAggregationAvg = "avg"
+	seriesAggregationSum = "sum"
+	seriesAggregationMin = "min"
+	seriesAggregationMax = "max"
+)
+
+// validSeriesAggregation returns true if the aggregation is supported.
+func validSeriesAggregation(aggregation string) bool {
+	switch aggregation {
+	case seriesAggregationAvg, seriesAggregationSum, seriesAggregationMin, seriesAggregationMax:
+		return true
+	}
+	return false
+}
+
+// aggregateSeries aggregates the values, which must not be empty.
+func aggregateSeries(values []float64, aggregation string) float64 {
+	result := values[0]
+	switch aggregation {
+	case seriesAggregationSum, seriesAggregationAvg:
+		result = 0
+		for _, value := range values {
+			result += value
+		}
+		if aggregation == seriesAggregationAvg {
+			result /= float64(len(values))
+		}
+	case seriesAggregationMin:
+		for _, value := range values {
+			result = math.Min(result, value)
+		}
+	case seriesAggregationMax:
+		for _, value := range values {
+			result = math.Max(result, value)
+		}
+	}
+	return result
+}
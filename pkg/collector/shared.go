@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+)
+
+// sharedCollectorConfig is the content a shared collector key is computed
+// from.
+type sharedCollectorConfig struct {
+	// Namespace is the namespace of the HPA. Collectors are only shared
+	// within a namespace, such that the quota and the events of a
+	// collector are attributed to HPAs of the namespace it collects for
+	// and it can't depend on the resources of another namespace, e.g. a
+	// ScalingMetricConfig.
+	Namespace string `json:"namespace"`
+	// ScaleTarget is only set for Object and Pods metrics, whose
+	// collectors may select the pods or scale by the replicas of the
+	// scale target.
+	ScaleTarget *sharedScaleTarget `json:"scaleTarget,omitempty"`
+	Config      *MetricConfig      `json:"config"`
+}
+
+// sharedScaleTarget is the scale target and the replica bounds of the HPA of
+// a shared collector.
+type sharedScaleTarget struct {
+	Ref         autoscalingv2.CrossVersionObjectReference `json:"ref"`
+	MinReplicas *int32                                    `json:"minReplicas,omitempty"`
+	MaxReplicas int32                                     `json:"maxReplicas"`
+}
+
+// SharedCollectorKey returns a key identifying the collector of a metric
+// config by its content, such that HPAs whose metric configs have the same
+// key can share a single collector. It returns false if the collector
+// depends on the HPA and can't be shared. Collectors are only shared by HPAs
+// in the same namespace. Collectors of Object and Pods metrics are
+// additionally only shared by HPAs with the same scale target and replica
+// bounds, as their collectors may depend on them.
+// Collectors of templated or named Prometheus queries aren't shared.
+func SharedCollectorKey(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig) (string, bool) {
+	switch config.Type {
+	case autoscalingv2.ExternalMetricSourceType, autoscalingv2.ObjectMetricSourceType, autoscalingv2.PodsMetricSourceType:
+	default:
+		return "", false
+	}
+
+	// conversions depending on the replicas of the scale target.
+	if config.PerReplica || config.ReplicaConversion != "" {
+		return "", false
+	}
+
+	// templated queries are rendered for the HPA. Named queries may be
+	// templated as well.
+	for key, value := range config.Config {
+		if key == queryRefConfKey || strings.HasSuffix(key, "."+queryRefConfKey) {
+			return "", false
+		}
+		if (key == queryConfKey || strings.HasSuffix(key, "."+queryConfKey)) && strings.Contains(value, "{{") {
+			return "", false
+		}
+	}
+
+	shared := *config
+	// the target is only used for utilization metrics.
+	if !shared.Utilization {
+		shared.Target = nil
+	}
+
+	content := sharedCollectorConfig{
+		Namespace: hpa.Namespace,
+		Config:    &shared,
+	}
+
+	if config.Type != autoscalingv2.ExternalMetricSourceType {
+		content.ScaleTarget = &sharedScaleTarget{
+			Ref:         hpa.Spec.ScaleTargetRef,
+			MinReplicas: hpa.Spec.MinReplicas,
+			MaxReplicas: hpa.Spec.MaxReplicas,
+		}
+	}
+
+	data, err := json.Marshal(content)
+	if err != nil {
+		return "", false
+	}
+
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), true
+}
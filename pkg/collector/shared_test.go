@@ -0,0 +1,91 @@
+package collector
+
+import (
+	"testing"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSharedCollectorKey(t *testing.T) {
+	hpa := func(namespace, target string) *autoscalingv2.HorizontalPodAutoscaler {
+		return &autoscalingv2.HorizontalPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: namespace},
+			Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+				ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{Kind: "Deployment", Name: target},
+				MaxReplicas:    10,
+			},
+		}
+	}
+	config := func(metricType autoscalingv2.MetricSourceType, query string) *MetricConfig {
+		return &MetricConfig{
+			MetricTypeName: MetricTypeName{Type: metricType, Name: "queue"},
+			CollectorName:  "prometheus",
+			Config:         map[string]string{"query": query},
+		}
+	}
+
+	for _, tc := range []struct {
+		msg       string
+		hpa       *autoscalingv2.HorizontalPodAutoscaler
+		config    *MetricConfig
+		other     *autoscalingv2.HorizontalPodAutoscaler
+		otherConf *MetricConfig
+		shared    bool
+	}{
+		{
+			msg:       "identical external metrics",
+			hpa:       hpa("a", "app"),
+			config:    config(autoscalingv2.ExternalMetricSourceType, "sum(queue)"),
+			other:     hpa("a", "other"),
+			otherConf: config(autoscalingv2.ExternalMetricSourceType, "sum(queue)"),
+			shared:    true,
+		},
+		{
+			msg:       "external metrics of different namespaces",
+			hpa:       hpa("a", "app"),
+			config:    config(autoscalingv2.ExternalMetricSourceType, "sum(queue)"),
+			other:     hpa("b", "app"),
+			otherConf: config(autoscalingv2.ExternalMetricSourceType, "sum(queue)"),
+			shared:    false,
+		},
+		{
+			msg:       "different queries",
+			hpa:       hpa("a", "app"),
+			config:    config(autoscalingv2.ExternalMetricSourceType, "sum(queue)"),
+			other:     hpa("a", "app"),
+			otherConf: config(autoscalingv2.ExternalMetricSourceType, "max(queue)"),
+			shared:    false,
+		},
+		{
+			msg:       "object metrics of different scale targets",
+			hpa:       hpa("a", "app"),
+			config:    config(autoscalingv2.ObjectMetricSourceType, "sum(queue)"),
+			other:     hpa("a", "other"),
+			otherConf: config(autoscalingv2.ObjectMetricSourceType, "sum(queue)"),
+			shared:    false,
+		},
+		{
+			msg:       "object metrics of the same scale target",
+			hpa:       hpa("a", "app"),
+			config:    config(autoscalingv2.ObjectMetricSourceType, "sum(queue)"),
+			other:     hpa("a", "app"),
+			otherConf: config(autoscalingv2.ObjectMetricSourceType, "sum(queue)"),
+			shared:    true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			key, ok := SharedCollectorKey(tc.hpa, tc.config)
+			if !ok {
+				t.Fatal("expected the collector to be shareable")
+			}
+			otherKey, ok := SharedCollectorKey(tc.other, tc.otherConf)
+			if !ok {
+				t.Fatal("expected the collector to be shareable")
+			}
+			if (key == otherKey) != tc.shared {
+				t.Errorf("expected shared %t, got keys %s and %s", tc.shared, key, otherKey)
+			}
+		})
+	}
+}
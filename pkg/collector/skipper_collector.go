@@ -1,11 +1,12 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
 
-	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -33,8 +34,8 @@ func NewSkipperCollectorPlugin(client kubernetes.Interface, prometheusPlugin *Pr
 }
 
 // NewCollector initializes a new skipper collector from the specified HPA.
-func (c *SkipperCollectorPlugin) NewCollector(hpa *autoscalingv2beta1.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
-	ingress, err := c.client.ExtensionsV1beta1().Ingresses(config.ObjectReference.Namespace).Get(config.ObjectReference.Name, metav1.GetOptions{})
+func (c *SkipperCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	ingress, err := c.client.NetworkingV1().Ingresses(config.TargetNamespace).Get(context.TODO(), config.ObjectReference.Name, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -60,7 +61,7 @@ func (c *SkipperCollectorPlugin) NewCollector(hpa *autoscalingv2beta1.Horizontal
 		} else if len(collectors) == 1 {
 			collector = collectors[0]
 		} else {
-			return nil, fmt.Errorf("no hosts defined on ingress %s/%s, unable to create collector", config.ObjectReference.Namespace, config.ObjectReference.Name)
+			return nil, fmt.Errorf("no hosts defined on ingress %s/%s, unable to create collector", config.TargetNamespace, config.ObjectReference.Name)
 		}
 	default:
 		return nil, fmt.Errorf("metric '%s' not supported", config.Name)
@@ -75,13 +76,14 @@ type SkipperCollector struct {
 	client          kubernetes.Interface
 	metricName      string
 	objectReference custom_metrics.ObjectReference
-	hpa             *autoscalingv2beta1.HorizontalPodAutoscaler
+	hpa             *autoscalingv2.HorizontalPodAutoscaler
 	interval        time.Duration
 	collector       Collector
+	clampReplicas   bool
 }
 
 // NewSkipperCollector initializes a new SkipperCollector.
-func NewSkipperCollector(client kubernetes.Interface, collector Collector, hpa *autoscalingv2beta1.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (*SkipperCollector, error) {
+func NewSkipperCollector(client kubernetes.Interface, collector Collector, hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (*SkipperCollector, error) {
 	return &SkipperCollector{
 		client:          client,
 		objectReference: config.ObjectReference,
@@ -89,12 +91,13 @@ func NewSkipperCollector(client kubernetes.Interface, collector Collector, hpa *
 		metricName:      config.Name,
 		interval:        interval,
 		collector:       collector,
+		clampReplicas:   config.ClampReplicas,
 	}, nil
 }
 
 // GetMetrics gets skipper metrics from prometheus.
-func (c *SkipperCollector) GetMetrics() ([]CollectedMetric, error) {
-	values, err := c.collector.GetMetrics()
+func (c *SkipperCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	values, err := c.collector.GetMetrics(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -112,6 +115,14 @@ func (c *SkipperCollector) GetMetrics() ([]CollectedMetric, error) {
 		return nil, err
 	}
 
+	if c.clampReplicas {
+		replicas = clampReplicas(replicas, c.hpa)
+	}
+
+	if replicas == 0 {
+		return nil, fmt.Errorf("unable to calculate average value, scale target %s/%s has no ready replicas", c.hpa.Namespace, c.hpa.Spec.ScaleTargetRef.Name)
+	}
+
 	value := values[0]
 	avgValue := float64(value.Custom.Value.MilliValue()) / float64(replicas)
 	value.Custom.Value = *resource.NewMilliQuantity(int64(avgValue), resource.DecimalSI)
@@ -124,17 +135,17 @@ func (c *SkipperCollector) Interval() time.Duration {
 	return c.interval
 }
 
-func targetRefReplicas(client kubernetes.Interface, hpa *autoscalingv2beta1.HorizontalPodAutoscaler) (int32, error) {
+func targetRefReplicas(client kubernetes.Interface, hpa *autoscalingv2.HorizontalPodAutoscaler) (int32, error) {
 	var replicas int32
 	switch hpa.Spec.ScaleTargetRef.Kind {
 	case "Deployment":
-		deployment, err := client.AppsV1().Deployments(hpa.Namespace).Get(hpa.Spec.ScaleTargetRef.Name, metav1.GetOptions{})
+		deployment, err := client.AppsV1().Deployments(hpa.Namespace).Get(context.TODO(), hpa.Spec.ScaleTargetRef.Name, metav1.GetOptions{})
 		if err != nil {
 			return 0, err
 		}
 		replicas = deployment.Status.ReadyReplicas
 	case "StatefulSet":
-		sts, err := client.AppsV1().StatefulSets(hpa.Namespace).Get(hpa.Spec.ScaleTargetRef.Name, metav1.GetOptions{})
+		sts, err := client.AppsV1().StatefulSets(hpa.Namespace).Get(context.TODO(), hpa.Spec.ScaleTargetRef.Name, metav1.GetOptions{})
 		if err != nil {
 			return 0, err
 		}
@@ -143,3 +154,30 @@ func targetRefReplicas(client kubernetes.Interface, hpa *autoscalingv2beta1.Hori
 
 	return replicas, nil
 }
+
+// clampReplicas clamps a replica count to the minReplicas and maxReplicas
+// bounds of the HPA. This keeps per replica values consistent with the
+// replica counts the HPA can actually scale to, e.g. while the scale target
+// is scaled outside of the bounds right after they were changed. A scale
+// target without ready replicas isn't clamped, such that callers can still
+// reject per replica calculations for it.
+func clampReplicas(replicas int32, hpa *autoscalingv2.HorizontalPodAutoscaler) int32 {
+	if replicas == 0 {
+		return 0
+	}
+
+	minReplicas := int32(1)
+	if hpa.Spec.MinReplicas != nil {
+		minReplicas = *hpa.Spec.MinReplicas
+	}
+
+	if replicas < minReplicas {
+		return minReplicas
+	}
+
+	if hpa.Spec.MaxReplicas > 0 && replicas > hpa.Spec.MaxReplicas {
+		return hpa.Spec.MaxReplicas
+	}
+
+	return replicas
+}
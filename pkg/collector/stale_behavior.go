@@ -0,0 +1,78 @@
+package collector
+
+import (
+	"strings"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Behaviors defining the values served for a metric while its collector is
+// failing.
+const (
+	// StaleBehaviorError serves no values, such that the metric expires
+	// and is reported as NotFound. This is the default.
+	StaleBehaviorError = "error"
+	// StaleBehaviorHold serves the last collected values.
+	StaleBehaviorHold = "hold"
+	// StaleBehaviorZero serves 0 for the last collected series.
+	StaleBehaviorZero = "zero"
+	// StaleBehaviorValue serves the configured stale value for the last
+	// collected series.
+	StaleBehaviorValue = "value"
+)
+
+// StaleValues returns the values served for the series of the last
+// complete collection of a metric while its collector is failing, according
+// to the stale behavior of the metric. It returns nil if the behavior serves
+// no values. The companion metrics of the utilization and activation options
+// are derived from the substituted value like from a collected value.
+func StaleValues(lastValues []CollectedMetric, config *MetricConfig) ([]CollectedMetric, error) {
+	switch config.StaleBehavior {
+	case StaleBehaviorHold:
+		return lastValues, nil
+	case StaleBehaviorZero, StaleBehaviorValue:
+	default:
+		return nil, nil
+	}
+
+	substitute := config.StaleValue
+	if config.StaleBehavior == StaleBehaviorZero {
+		substitute = 0
+	}
+
+	var target float64
+	if config.Target != nil {
+		target = float64(config.Target.MilliValue()) / 1000
+	}
+
+	now := metav1.Time{Time: time.Now().UTC()}
+	substituted := make([]CollectedMetric, 0, len(lastValues))
+	for _, value := range lastValues {
+		name := value.Custom.Metric.Name
+		if value.Type == autoscalingv2.ExternalMetricSourceType {
+			value.External.Timestamp = now
+			name = value.External.MetricName
+		} else {
+			value.Custom.Timestamp = now
+		}
+
+		v := substitute
+		switch {
+		case config.Activation && name == config.Name+activationMetricSuffix:
+			v = 0
+			if substitute > config.ActivationThreshold {
+				v = 1
+			}
+		case config.Utilization && target != 0 && strings.HasSuffix(name, utilizationMetricSuffix):
+			v = substitute / target
+		}
+
+		if err := value.setFloatValue(v); err != nil {
+			return nil, err
+		}
+		substituted = append(substituted, value)
+	}
+	return substituted, nil
+}
@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestStaleValues(t *testing.T) {
+	target := resource.MustParse("4")
+	lastValues := []CollectedMetric{
+		externalValue("queue", 8),
+		externalValue("queue"+utilizationMetricSuffix, 2),
+		externalValue("queue"+activationMetricSuffix, 1),
+	}
+
+	for _, tc := range []struct {
+		msg      string
+		config   MetricConfig
+		expected []float64
+	}{
+		{
+			msg:    "error serves nothing",
+			config: MetricConfig{StaleBehavior: StaleBehaviorError},
+		},
+		{
+			msg:    "unset serves nothing",
+			config: MetricConfig{},
+		},
+		{
+			msg:      "hold",
+			config:   MetricConfig{StaleBehavior: StaleBehaviorHold},
+			expected: []float64{8, 2, 1},
+		},
+		{
+			msg:      "zero",
+			config:   MetricConfig{StaleBehavior: StaleBehaviorZero, Utilization: true, Target: &target, Activation: true},
+			expected: []float64{0, 0, 0},
+		},
+		{
+			msg:      "value derives companion metrics",
+			config:   MetricConfig{StaleBehavior: StaleBehaviorValue, StaleValue: 2, Utilization: true, Target: &target, Activation: true, ActivationThreshold: 1},
+			expected: []float64{2, 0.5, 1},
+		},
+		{
+			msg:      "value below activation threshold",
+			config:   MetricConfig{StaleBehavior: StaleBehaviorValue, StaleValue: 2, Utilization: true, Target: &target, Activation: true, ActivationThreshold: 5},
+			expected: []float64{2, 0.5, 0},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			config := tc.config
+			config.Name = "queue"
+			values, err := StaleValues(lastValues, &config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(values) != len(tc.expected) {
+				t.Fatalf("expected %d values, got %d", len(tc.expected), len(values))
+			}
+			for i, value := range values {
+				if value.floatValue() != tc.expected[i] {
+					t.Errorf("expected value %v for %s, got %v", tc.expected[i], value.External.MetricName, value.floatValue())
+				}
+			}
+		})
+	}
+}
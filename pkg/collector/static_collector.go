@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+)
+
+// StaticCollectorName is the name of the static collector.
+const StaticCollectorName = "static"
+
+// StaticCollectorPlugin is a collector plugin for initializing collectors
+// which always return a fixed value, e.g. as fallback source of a metric.
+type StaticCollectorPlugin struct{}
+
+// NewStaticCollectorPlugin initializes a new StaticCollectorPlugin.
+func NewStaticCollectorPlugin() *StaticCollectorPlugin {
+	return &StaticCollectorPlugin{}
+}
+
+// NewCollector initializes a new static collector from the specified HPA.
+func (p *StaticCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	if config.Type == autoscalingv2.PodsMetricSourceType {
+		return nil, fmt.Errorf("static collector doesn't support pods metrics")
+	}
+
+	v, ok := config.Config["value"]
+	if !ok {
+		return nil, fmt.Errorf("static value not specified on metric")
+	}
+
+	value, err := resource.ParseQuantity(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid static value '%s': %v", v, err)
+	}
+
+	return &StaticCollector{
+		metricType:      config.Type,
+		metricName:      config.Name,
+		labels:          config.Labels,
+		objectReference: config.ObjectReference,
+		value:           value,
+		interval:        interval,
+	}, nil
+}
+
+// StaticCollector is a metrics collector which returns a fixed value.
+type StaticCollector struct {
+	metricType      autoscalingv2.MetricSourceType
+	metricName      string
+	labels          map[string]string
+	objectReference custom_metrics.ObjectReference
+	value           resource.Quantity
+	interval        time.Duration
+}
+
+// GetMetrics returns the static value.
+func (c *StaticCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	now := metav1.Time{Time: time.Now().UTC()}
+
+	metricValue := CollectedMetric{
+		Type: c.metricType,
+	}
+
+	switch c.metricType {
+	case autoscalingv2.ObjectMetricSourceType:
+		metricValue.Custom = custom_metrics.MetricValue{
+			DescribedObject: c.objectReference,
+			Metric:          custom_metrics.MetricIdentifier{Name: c.metricName},
+			Timestamp:       now,
+			Value:           c.value,
+		}
+	case autoscalingv2.ExternalMetricSourceType:
+		metricValue.External = external_metrics.ExternalMetricValue{
+			MetricName:   c.metricName,
+			MetricLabels: c.labels,
+			Timestamp:    now,
+			Value:        c.value,
+		}
+	}
+
+	return []CollectedMetric{metricValue}, nil
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *StaticCollector) Interval() time.Duration {
+	return c.interval
+}
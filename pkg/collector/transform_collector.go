@@ -0,0 +1,135 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// transformEvaluationTimeout bounds the time a single evaluation of a
+// transform expression may take.
+const transformEvaluationTimeout = 100 * time.Millisecond
+
+// TransformCollector is a collector which transforms the values of another
+// collector using a CEL expression. The expression has access to the value
+// (`value`) and the labels (`labels`) of each collected metric and must
+// evaluate to a number.
+type TransformCollector struct {
+	collector  Collector
+	expression string
+	program    cel.Program
+	hpa        *autoscalingv2.HorizontalPodAutoscaler
+	recorder   record.EventRecorder
+	lastValues []CollectedMetric
+}
+
+// NewTransformCollector initializes a new TransformCollector. The expression
+// is compiled and type checked up front so invalid expressions are rejected
+// when the collector is created.
+func NewTransformCollector(collector Collector, expression string, hpa *autoscalingv2.HorizontalPodAutoscaler, recorder record.EventRecorder) (*TransformCollector, error) {
+	env, err := cel.NewEnv(
+		cel.Declarations(
+			decls.NewVar("value", decls.Double),
+			decls.NewVar("labels", decls.NewMapType(decls.String, decls.String)),
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("failed to compile transform expression '%s': %v", expression, issues.Err())
+	}
+
+	program, err := env.Program(ast, cel.InterruptCheckFrequency(100))
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize transform expression '%s': %v", expression, err)
+	}
+
+	return &TransformCollector{
+		collector:  collector,
+		expression: expression,
+		program:    program,
+		hpa:        hpa,
+		recorder:   recorder,
+	}, nil
+}
+
+// GetMetrics gets metrics from the underlying collector and transforms them.
+// If the transformation fails the last successfully transformed values are
+// returned instead.
+func (c *TransformCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	values, partial, err := getPartialMetrics(ctx, c.collector)
+	if err != nil {
+		return nil, err
+	}
+
+	transformed := make([]CollectedMetric, 0, len(values))
+	for _, value := range values {
+		result, err := c.evaluate(value)
+		if err == nil {
+			err = value.setFloatValue(result)
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to transform metric with expression '%s': %v", c.expression, err)
+			if c.recorder != nil {
+				c.recorder.Eventf(c.hpa, v1.EventTypeWarning, "TransformFailed", "%v", err)
+			}
+
+			if c.lastValues == nil {
+				return nil, err
+			}
+
+			glog.Warningf("%v, serving last value", err)
+			return c.lastValues, nil
+		}
+
+		transformed = append(transformed, value)
+	}
+
+	c.lastValues = transformed
+	return partialMetrics(transformed, partial)
+}
+
+// evaluate evaluates the transform expression for a single metric value.
+func (c *TransformCollector) evaluate(value CollectedMetric) (float64, error) {
+	labels := value.metricLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), transformEvaluationTimeout)
+	defer cancel()
+
+	out, _, err := c.program.ContextEval(ctx, map[string]interface{}{
+		"value":  value.floatValue(),
+		"labels": labels,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	switch result := out.Value().(type) {
+	case float64:
+		return result, nil
+	case int64:
+		return float64(result), nil
+	case uint64:
+		return float64(result), nil
+	default:
+		return 0, fmt.Errorf("expression returned unsupported type %T", result)
+	}
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *TransformCollector) Interval() time.Duration {
+	return c.collector.Interval()
+}
@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTransformCollector(t *testing.T) {
+	for _, tc := range []struct {
+		msg        string
+		expression string
+		values     []float64
+		expected   []float64
+		err        bool
+	}{
+		{
+			msg:        "scales values",
+			expression: "value * 2.0",
+			values:     []float64{1.5, 0.001},
+			expected:   []float64{3, 0.002},
+		},
+		{
+			msg:        "integer results",
+			expression: "int(value) + 1",
+			values:     []float64{1.5},
+			expected:   []float64{2},
+		},
+		{
+			msg:        "result out of range",
+			expression: "value * 1e30",
+			values:     []float64{1},
+			err:        true,
+		},
+		{
+			msg:        "unsupported result type",
+			expression: "string(value)",
+			values:     []float64{1},
+			err:        true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			values := make([]CollectedMetric, 0, len(tc.values))
+			for _, v := range tc.values {
+				values = append(values, externalValue("metric", v))
+			}
+
+			c, err := NewTransformCollector(&fakeCollector{values: values}, tc.expression, nil, nil)
+			if err != nil {
+				t.Fatalf("failed to create collector: %v", err)
+			}
+
+			transformed, err := c.GetMetrics(context.Background())
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error, got %v", transformed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(transformed) != len(tc.expected) {
+				t.Fatalf("expected %d values, got %d", len(tc.expected), len(transformed))
+			}
+			for i, expected := range tc.expected {
+				if v := transformed[i].floatValue(); v != expected {
+					t.Errorf("expected value %v, got %v", expected, v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// utilizationMetricSuffix is appended to the name of a metric to get the
+// name of its utilization metric.
+const utilizationMetricSuffix = "_utilization"
+
+// UtilizationCollector is a collector which, in addition to the values of
+// another collector, publishes the ratio of each value to the HPA target as
+// a companion metric named <metric>_utilization.
+type UtilizationCollector struct {
+	collector Collector
+	target    float64
+}
+
+// NewUtilizationCollector initializes a new UtilizationCollector. The target
+// must be non-zero.
+func NewUtilizationCollector(collector Collector, target resource.Quantity) *UtilizationCollector {
+	return &UtilizationCollector{
+		collector: collector,
+		target:    float64(target.MilliValue()) / 1000,
+	}
+}
+
+// GetMetrics gets metrics from the underlying collector and adds the
+// utilization metric for each of them.
+func (c *UtilizationCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	values, partial, err := getPartialMetrics(ctx, c.collector)
+	if err != nil {
+		return nil, err
+	}
+
+	utilizations := make([]CollectedMetric, 0, len(values))
+	for _, value := range values {
+		utilization := value
+		utilization.Custom.Metric.Name += utilizationMetricSuffix
+		utilization.External.MetricName += utilizationMetricSuffix
+		if err := utilization.setFloatValue(value.floatValue() / c.target); err != nil {
+			return nil, err
+		}
+		utilizations = append(utilizations, utilization)
+	}
+
+	return partialMetrics(append(values, utilizations...), partial)
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *UtilizationCollector) Interval() time.Duration {
+	return c.collector.Interval()
+}
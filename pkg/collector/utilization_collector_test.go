@@ -0,0 +1,62 @@
+package collector
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestUtilizationCollector(t *testing.T) {
+	for _, tc := range []struct {
+		msg      string
+		target   string
+		values   []float64
+		expected []float64
+	}{
+		{
+			msg:      "ratio to target",
+			target:   "10",
+			values:   []float64{5, 20},
+			expected: []float64{5, 20, 0.5, 2},
+		},
+		{
+			msg:      "milli target",
+			target:   "500m",
+			values:   []float64{0.25},
+			expected: []float64{0.25, 0.5},
+		},
+		{
+			msg:    "no values",
+			target: "10",
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			var values []CollectedMetric
+			for _, value := range tc.values {
+				values = append(values, externalValue("queue", value))
+			}
+			c := NewUtilizationCollector(&fakeCollector{values: values}, resource.MustParse(tc.target))
+
+			collected, err := c.GetMetrics(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(collected) != len(tc.expected) {
+				t.Fatalf("expected %d values, got %d", len(tc.expected), len(collected))
+			}
+			for i, value := range collected {
+				name := "queue"
+				if i >= len(tc.values) {
+					name += utilizationMetricSuffix
+				}
+				if value.External.MetricName != name {
+					t.Errorf("expected metric %s, got %s", name, value.External.MetricName)
+				}
+				if value.floatValue() != tc.expected[i] {
+					t.Errorf("expected value %v, got %v", tc.expected[i], value.floatValue())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// VictoriaMetricsCollectorName is the name of the VictoriaMetrics
+	// collector.
+	VictoriaMetricsCollectorName = "victoriametrics"
+
+	victoriaMetricsNoCacheConfKey       = "nocache"
+	victoriaMetricsLatencyOffsetConfKey = "latency-offset"
+	victoriaMetricsLookbackConfKey      = "lookback"
+)
+
+// NewVictoriaMetricsCollectorPlugin initializes a collector plugin querying
+// VictoriaMetrics. VictoriaMetrics implements the query API of Prometheus,
+// so the collectors are Prometheus collectors whose queries may use the
+// MetricsQL extensions and the query parameters specific to VictoriaMetrics.
+// For a VictoriaMetrics cluster the server is the URL of the select path of
+// a tenant, e.g. http://vmselect:8481/select/0/prometheus.
+func NewVictoriaMetricsCollectorPlugin(client kubernetes.Interface, server string, auth *PrometheusAuth) (*PrometheusCollectorPlugin, error) {
+	plugin, err := NewPrometheusCollectorPlugin(client, server, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	plugin.backend = VictoriaMetricsCollectorName
+	plugin.queryParams = victoriaMetricsQueryParams
+	return plugin, nil
+}
+
+// victoriaMetricsQueryParams returns the VictoriaMetrics specific query
+// parameters of a metric config:
+//
+//   - nocache disables the response cache, such that the latest samples are
+//     always included.
+//   - latency-offset is the time samples need to be ingested before they're
+//     queried, 30s by default.
+//   - lookback is the window searched for the latest raw sample of an
+//     instant query, 5m by default.
+func victoriaMetricsQueryParams(config *MetricConfig) (url.Values, error) {
+	params := url.Values{}
+
+	if v, ok := config.Config[victoriaMetricsNoCacheConfKey]; ok {
+		noCache, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %s", victoriaMetricsNoCacheConfKey, v)
+		}
+		if noCache {
+			params.Set("nocache", "1")
+		}
+	}
+
+	for key, param := range map[string]string{
+		victoriaMetricsLatencyOffsetConfKey: "latency_offset",
+		victoriaMetricsLookbackConfKey:      "step",
+	} {
+		v, ok := config.Config[key]
+		if !ok {
+			continue
+		}
+
+		// durations are passed in milliseconds, the smallest unit
+		// VictoriaMetrics supports.
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Millisecond {
+			return nil, fmt.Errorf("invalid %s value %s", key, v)
+		}
+		params.Set(param, fmt.Sprintf("%dms", d.Milliseconds()))
+	}
+
+	return params, nil
+}
+
+// queryParamsRoundTripper is an http.RoundTripper which adds query
+// parameters to the requests.
+type queryParamsRoundTripper struct {
+	params url.Values
+	next   http.RoundTripper
+}
+
+// RoundTrip adds the query parameters to a copy of the request and sends it.
+// Parameters set by the client, like the step of range queries, are kept.
+func (t *queryParamsRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	query := req.URL.Query()
+	for name, values := range t.params {
+		if _, ok := query[name]; !ok {
+			query[name] = values
+		}
+	}
+	req.URL.RawQuery = query.Encode()
+	return t.next.RoundTrip(req)
+}
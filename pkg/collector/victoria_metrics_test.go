@@ -0,0 +1,116 @@
+package collector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestVictoriaMetricsQueryParams(t *testing.T) {
+	for _, tc := range []struct {
+		msg      string
+		config   map[string]string
+		expected url.Values
+		err      bool
+	}{
+		{
+			msg:      "no parameters",
+			config:   map[string]string{},
+			expected: url.Values{},
+		},
+		{
+			msg:      "nocache",
+			config:   map[string]string{"nocache": "true"},
+			expected: url.Values{"nocache": {"1"}},
+		},
+		{
+			msg:      "nocache disabled",
+			config:   map[string]string{"nocache": "false"},
+			expected: url.Values{},
+		},
+		{
+			msg:    "invalid nocache",
+			config: map[string]string{"nocache": "yes"},
+			err:    true,
+		},
+		{
+			msg:      "latency offset and lookback",
+			config:   map[string]string{"latency-offset": "1m", "lookback": "10m"},
+			expected: url.Values{"latency_offset": {"60000ms"}, "step": {"600000ms"}},
+		},
+		{
+			msg:      "sub-second latency offset",
+			config:   map[string]string{"latency-offset": "1500ms"},
+			expected: url.Values{"latency_offset": {"1500ms"}},
+		},
+		{
+			msg:    "latency offset below a millisecond",
+			config: map[string]string{"latency-offset": "500us"},
+			err:    true,
+		},
+		{
+			msg:    "invalid lookback",
+			config: map[string]string{"lookback": "-1m"},
+			err:    true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			params, err := victoriaMetricsQueryParams(&MetricConfig{Config: tc.config})
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error, got params %v", params)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if params.Encode() != tc.expected.Encode() {
+				t.Errorf("expected params %s, got %s", tc.expected.Encode(), params.Encode())
+			}
+		})
+	}
+}
+
+func TestVictoriaMetricsCollector(t *testing.T) {
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		query = r.Form
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1000,"2.5"]}]}}`))
+	}))
+	defer server.Close()
+
+	plugin, err := NewVictoriaMetricsCollectorPlugin(nil, server.URL, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default"}}
+	config := &MetricConfig{
+		MetricTypeName: MetricTypeName{Type: autoscalingv2.ObjectMetricSourceType, Name: "rps"},
+		Config:         map[string]string{"query": "sum(rate(requests_total[1m]))", "nocache": "true"},
+	}
+	c, err := plugin.NewCollector(hpa, config, time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	metrics, err := c.GetMetrics(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(metrics) != 1 || metrics[0].Custom.Value.MilliValue() != 2500 {
+		t.Fatalf("expected value 2500m, got %v", metrics)
+	}
+	if query.Get("nocache") != "1" {
+		t.Errorf("expected nocache parameter, got query %v", query)
+	}
+}
@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// WarmUpCollector is a collector which withholds the values of another
+// collector until it collected successfully a number of times, e.g. for
+// rate-style metrics which are only meaningful after a couple of samples.
+// Failed collections don't count towards the warm-up.
+type WarmUpCollector struct {
+	collector  Collector
+	metricName string
+	warmUp     int
+	successful int
+	withheld   bool
+	sync.Mutex
+}
+
+// NewWarmUpCollector initializes a new WarmUpCollector withholding the
+// values of the first warmUp successful collections.
+func NewWarmUpCollector(collector Collector, config *MetricConfig) *WarmUpCollector {
+	return &WarmUpCollector{
+		collector:  collector,
+		metricName: config.Name,
+		warmUp:     config.WarmUp,
+	}
+}
+
+// GetMetrics gets metrics from the underlying collector and returns no
+// values until the collector is warmed up.
+func (c *WarmUpCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	values, partial, err := getPartialMetrics(ctx, c.collector)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.withheld = c.successful < c.warmUp
+	if !c.withheld {
+		return partialMetrics(values, partial)
+	}
+
+	c.successful++
+	glog.V(1).Infof("Withholding values of metric '%s' during warm-up (%d/%d)", c.metricName, c.successful, c.warmUp)
+	return nil, nil
+}
+
+// Withheld returns true if the values of the last collection were withheld.
+func (c *WarmUpCollector) Withheld() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.withheld
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *WarmUpCollector) Interval() time.Duration {
+	return c.collector.Interval()
+}
@@ -0,0 +1,198 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+)
+
+const (
+	// WavefrontCollectorName is the name of the Wavefront collector.
+	WavefrontCollectorName = "wavefront"
+
+	wavefrontDefaultWindow = 5 * time.Minute
+)
+
+// WavefrontCollectorPlugin is a collector plugin for initializing collectors
+// which run WQL queries against the query API of Wavefront (Tanzu
+// Observability).
+type WavefrontCollectorPlugin struct {
+	cluster   string
+	tokenFile string
+}
+
+// NewWavefrontCollectorPlugin initializes a new WavefrontCollectorPlugin. The
+// cluster URL, e.g. https://example.wavefront.com, and the API token read
+// from the token file are used for metrics which don't define their own.
+func NewWavefrontCollectorPlugin(cluster, tokenFile string) *WavefrontCollectorPlugin {
+	return &WavefrontCollectorPlugin{
+		cluster:   strings.TrimSuffix(cluster, "/"),
+		tokenFile: tokenFile,
+	}
+}
+
+// NewCollector initializes a new Wavefront collector from the specified HPA.
+func (p *WavefrontCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *MetricConfig, interval time.Duration) (Collector, error) {
+	if config.Type != autoscalingv2.ExternalMetricSourceType {
+		return nil, fmt.Errorf("wavefront collector only supports external metrics")
+	}
+
+	query, ok := config.Config["query"]
+	if !ok {
+		return nil, fmt.Errorf("no wavefront query defined")
+	}
+
+	c := &WavefrontCollector{
+		hpa:         hpa,
+		cluster:     p.cluster,
+		token:       config.Config["token"],
+		tokenFile:   p.tokenFile,
+		query:       query,
+		window:      wavefrontDefaultWindow,
+		aggregation: seriesAggregationAvg,
+		metricName:  config.Name,
+		labels:      config.Labels,
+		interval:    interval,
+		httpClient: &http.Client{
+			Timeout:   15 * time.Second,
+			Transport: &http.Transport{},
+		},
+	}
+
+	// the token of the adapter must not be sent to another cluster, so
+	// the cluster can only be overridden along with the token of the
+	// metric.
+	if v, ok := config.Config["cluster"]; ok && strings.TrimSuffix(v, "/") != c.cluster {
+		if c.token == "" {
+			return nil, fmt.Errorf("the wavefront cluster can only be overridden together with a token")
+		}
+		c.cluster = strings.TrimSuffix(v, "/")
+	}
+	if c.cluster == "" {
+		return nil, fmt.Errorf("no wavefront cluster defined")
+	}
+
+	if v, ok := config.Config["window"]; ok {
+		window, err := time.ParseDuration(v)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("invalid wavefront window '%s'", v)
+		}
+		c.window = window
+	}
+
+	if v, ok := config.Config["aggregation"]; ok {
+		if !validSeriesAggregation(v) {
+			return nil, fmt.Errorf("unsupported wavefront aggregation '%s'", v)
+		}
+		c.aggregation = v
+	}
+
+	if c.token == "" && c.tokenFile == "" {
+		return nil, fmt.Errorf("wavefront api token must be defined")
+	}
+
+	return c, nil
+}
+
+// WavefrontCollector is a metrics collector which exposes the latest value
+// of a WQL query as external metric. The latest values of queries returning
+// several series are aggregated.
+type WavefrontCollector struct {
+	hpa         *autoscalingv2.HorizontalPodAutoscaler
+	cluster     string
+	token       string
+	tokenFile   string
+	query       string
+	window      time.Duration
+	aggregation string
+	metricName  string
+	labels      map[string]string
+	interval    time.Duration
+	httpClient  *http.Client
+}
+
+// wavefrontQueryResponse is the response of the chart query API. The data
+// points of a series are pairs of a timestamp in seconds and a value.
+type wavefrontQueryResponse struct {
+	Timeseries []struct {
+		Label string      `json:"label"`
+		Data  [][]float64 `json:"data"`
+	} `json:"timeseries"`
+}
+
+// GetMetrics runs the query and returns the latest value.
+func (c *WavefrontCollector) GetMetrics(ctx context.Context) ([]CollectedMetric, error) {
+	token, err := readCredential(c.token, c.tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wavefront api token: %v", err)
+	}
+
+	auditQuery(c.hpa, c.metricName, WavefrontCollectorName, c.query)
+
+	now := time.Now()
+	params := url.Values{}
+	params.Set("q", c.query)
+	params.Set("s", strconv.FormatInt(now.Add(-c.window).UnixNano()/int64(time.Millisecond), 10))
+	params.Set("e", strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10))
+	params.Set("g", "m")
+	params.Set("strict", "true")
+
+	request, err := http.NewRequest(http.MethodGet, c.cluster+"/api/v2/chart/api?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	request.Header.Set("Accept", "application/json")
+
+	var response wavefrontQueryResponse
+	err = doJSON(ctx, c.httpClient, request, &response)
+	if err != nil {
+		return nil, fmt.Errorf("wavefront query failed: %v", err)
+	}
+
+	var values []float64
+	for _, series := range response.Timeseries {
+		var latest []float64
+		for _, point := range series.Data {
+			if len(point) == 2 && (latest == nil || point[0] > latest[0]) {
+				latest = point
+			}
+		}
+		if latest != nil {
+			values = append(values, latest[1])
+		}
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("wavefront query '%s' returned no points within %s", c.query, c.window)
+	}
+	value := aggregateSeries(values, c.aggregation)
+
+	metricValue := CollectedMetric{
+		Type: autoscalingv2.ExternalMetricSourceType,
+		External: external_metrics.ExternalMetricValue{
+			MetricName:   c.metricName,
+			MetricLabels: c.labels,
+			Timestamp:    metav1.Time{Time: time.Now().UTC()},
+		},
+	}
+	err = metricValue.setFloatValue(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return []CollectedMetric{metricValue}, nil
+}
+
+// Interval returns the interval at which the collector should run.
+func (c *WavefrontCollector) Interval() time.Duration {
+	return c.interval
+}
@@ -0,0 +1,104 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// wavefrontBackendTest tests the Wavefront collector.
+var wavefrontBackendTest = backendTest{
+	adapter: "https://shop.wavefront.com",
+	config:  map[string]string{"query": `ts("requests")`},
+	newCollector: func(t *testing.T, server *httptest.Server, cluster string, config map[string]string) (Collector, error) {
+		plugin := NewWavefrontCollectorPlugin(cluster, adapterCredentialFile(t))
+		c, err := plugin.NewCollector(
+			&autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default"}},
+			&MetricConfig{
+				MetricTypeName: MetricTypeName{Type: autoscalingv2.ExternalMetricSourceType, Name: "requests"},
+				Config:         config,
+			},
+			time.Minute,
+		)
+		if err != nil {
+			return nil, err
+		}
+		c.(*WavefrontCollector).httpClient = serverClient(t, server)
+		return c, nil
+	},
+	credential: func(r *http.Request) string {
+		return r.Header.Get("Authorization")
+	},
+	checkRequest: func(t *testing.T, r *http.Request, config map[string]string) {
+		if r.URL.Path != "/api/v2/chart/api" || r.URL.Query().Get("q") != config["query"] {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+	},
+}
+
+func TestWavefrontCollectorCredentials(t *testing.T) {
+	wavefrontBackendTest.testCredentials(t, []backendCredentialTestCase{
+		{
+			msg:        "cluster of the adapter",
+			adapter:    "https://shop.wavefront.com",
+			target:     "shop.wavefront.com",
+			credential: "Bearer " + adapterCredential,
+		},
+		{
+			msg:        "same cluster as the adapter",
+			adapter:    "https://shop.wavefront.com",
+			config:     map[string]string{"cluster": "https://shop.wavefront.com/"},
+			target:     "shop.wavefront.com",
+			credential: "Bearer " + adapterCredential,
+		},
+		{
+			msg:        "token of the metric",
+			adapter:    "https://shop.wavefront.com",
+			config:     map[string]string{"token": "secret"},
+			target:     "shop.wavefront.com",
+			credential: "Bearer secret",
+		},
+		{
+			msg:     "cluster override with the token of the adapter",
+			adapter: "https://shop.wavefront.com",
+			config:  map[string]string{"cluster": "https://attacker.example.org"},
+			err:     true,
+		},
+		{
+			msg:    "cluster without an adapter cluster",
+			config: map[string]string{"cluster": "https://team-a.wavefront.com"},
+			err:    true,
+		},
+		{
+			msg:        "cluster override with a token",
+			adapter:    "https://shop.wavefront.com",
+			config:     map[string]string{"cluster": "https://team-a.wavefront.com", "token": "secret"},
+			target:     "team-a.wavefront.com",
+			credential: "Bearer secret",
+		},
+	})
+}
+
+func TestWavefrontCollector(t *testing.T) {
+	wavefrontBackendTest.testValues(t, []backendValueTestCase{
+		{
+			msg:      "latest point",
+			body:     `{"timeseries":[{"label":"requests","data":[[1060,2],[1120,3.5],[1000,1]]}]}`,
+			expected: 3500,
+		},
+		{
+			msg:      "average of series",
+			body:     `{"timeseries":[{"label":"a","data":[[1000,1]]},{"label":"b","data":[[1000,4]]}]}`,
+			expected: 2500,
+		},
+		{
+			msg:  "no points",
+			body: `{"timeseries":[]}`,
+			err:  true,
+		},
+	})
+}
@@ -0,0 +1,91 @@
+package provider
+
+import (
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+)
+
+// scalingActivity is the scaling activity of an HPA.
+type scalingActivity int
+
+const (
+	// activityUnknown is the activity of HPAs which can't be looked up.
+	activityUnknown scalingActivity = iota
+	// activityScaling is the activity of HPAs whose desired replicas
+	// differ from their current replicas or which scaled within the
+	// steady period.
+	activityScaling
+	// activitySteady is the activity of all other HPAs.
+	activitySteady
+)
+
+// AdaptiveIntervalConfig configures the adaptive collection interval.
+type AdaptiveIntervalConfig struct {
+	// Factor is the factor the interval of collectors of scaling HPAs is
+	// divided by and the interval of collectors of steady HPAs is
+	// multiplied by.
+	Factor float64
+	// SteadyPeriod is the time since the last scaling after which an HPA
+	// is considered steady.
+	SteadyPeriod time.Duration
+}
+
+// SetAdaptiveInterval enables shortening the collection interval of HPAs
+// which are scaling and lengthening it for HPAs at steady state.
+func (p *HPAProvider) SetAdaptiveInterval(config *AdaptiveIntervalConfig) {
+	p.adaptiveInterval = config
+	for _, cluster := range p.clusters {
+		cluster.adaptiveInterval = config
+	}
+}
+
+// hpaActivity returns the scaling activity of an HPA, based on its status.
+func hpaActivity(hpa *autoscalingv2.HorizontalPodAutoscaler, steadyPeriod time.Duration) scalingActivity {
+	if hpa.Status.DesiredReplicas != hpa.Status.CurrentReplicas {
+		return activityScaling
+	}
+
+	if hpa.Status.LastScaleTime != nil && time.Since(hpa.Status.LastScaleTime.Time) < steadyPeriod {
+		return activityScaling
+	}
+	return activitySteady
+}
+
+// scalingActivity returns the scaling activity of the HPA of the resource
+// reference.
+func (p *HPAProvider) scalingActivity(resourceRef resourceReference) scalingActivity {
+	if p.getHPA == nil || p.adaptiveInterval == nil {
+		return activityUnknown
+	}
+
+	hpa, err := p.getHPA(resourceRef.Namespace, resourceRef.Name)
+	if err != nil {
+		return activityUnknown
+	}
+	return hpaActivity(hpa, p.adaptiveInterval.SteadyPeriod)
+}
+
+// adaptInterval returns the interval of a collector for the current scaling
+// activity of its HPAs. The interval is shortened if any of the HPAs is
+// scaling and lengthened if all of them are steady.
+func (t *CollectorScheduler) adaptInterval(interval time.Duration, refs []resourceReference) time.Duration {
+	if t.adaptiveInterval == nil || t.adaptiveInterval.Factor <= 1 || t.activity == nil {
+		return interval
+	}
+
+	steady := len(refs) > 0
+	for _, ref := range refs {
+		switch t.activity(ref) {
+		case activityScaling:
+			return time.Duration(float64(interval) / t.adaptiveInterval.Factor)
+		case activityUnknown:
+			steady = false
+		}
+	}
+
+	if steady {
+		return time.Duration(float64(interval) * t.adaptiveInterval.Factor)
+	}
+	return interval
+}
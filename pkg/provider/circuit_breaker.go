@@ -0,0 +1,116 @@
+package provider
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	"k8s.io/api/core/v1"
+)
+
+// CircuitBreakerConfig configures the circuit breaker of the collectors.
+type CircuitBreakerConfig struct {
+	// Threshold is the number of consecutive failures after which the
+	// circuit of a collector opens.
+	Threshold int
+	// Cooldown is the time the backend of a collector isn't queried for
+	// while its circuit is open.
+	Cooldown time.Duration
+}
+
+// circuitBreaker tracks the circuit of a single collector. The circuit opens
+// once the collector failed the threshold number of times in a row, after
+// which the collector isn't run for the cooldown period. The first
+// collection after the cooldown probes the backend: if it succeeds the
+// circuit closes, otherwise it opens again.
+type circuitBreaker struct {
+	config *CircuitBreakerConfig
+	open   bool
+	// until is the end of the current cooldown.
+	until time.Time
+}
+
+// newCircuitBreaker initializes the circuit breaker of a collector. It
+// returns nil, a breaker which never opens, if the config is nil.
+func newCircuitBreaker(config *CircuitBreakerConfig) *circuitBreaker {
+	if config == nil || config.Threshold <= 0 {
+		return nil
+	}
+	return &circuitBreaker{config: config}
+}
+
+// record records the result of a collection and returns the cooldown to
+// wait before the next collection if the circuit is open. The second return
+// value is true if the state of the circuit changed.
+func (b *circuitBreaker) record(consecutiveFailures int) (time.Duration, bool) {
+	if b == nil {
+		return 0, false
+	}
+
+	if consecutiveFailures == 0 {
+		changed := b.open
+		b.open = false
+		return 0, changed
+	}
+
+	if consecutiveFailures < b.config.Threshold {
+		return 0, false
+	}
+
+	changed := !b.open
+	b.open = true
+	b.until = time.Now().Add(b.config.Cooldown)
+	return b.config.Cooldown, changed
+}
+
+// paused returns true if the circuit is open and its cooldown didn't end
+// yet.
+func (b *circuitBreaker) paused(now time.Time) bool {
+	return b != nil && b.open && now.Before(b.until)
+}
+
+// breakerEvent reports a changed circuit of a collector as Event on the HPAs
+// it collects for.
+func (t *CollectorScheduler) breakerEvent(b *circuitBreaker, refs []resourceReference, config *collector.MetricConfig, consecutiveFailures int, err error) {
+	if b.open {
+		glog.Warningf("Opened circuit of metric '%s' of HPA %s after %d consecutive failures, pausing collection for %s: %v", config.Name, refs[0], consecutiveFailures, b.config.Cooldown, err)
+		t.event(refs, v1.EventTypeWarning, "CircuitOpen", fmt.Sprintf("Metric '%s' failed %d times in a row, pausing collection for %s: %v", config.Name, consecutiveFailures, b.config.Cooldown, err))
+		return
+	}
+
+	glog.Infof("Closed circuit of metric '%s' of HPA %s, collection recovered", config.Name, refs[0])
+	t.event(refs, v1.EventTypeNormal, "CircuitClosed", fmt.Sprintf("Collection of metric '%s' recovered", config.Name))
+}
+
+// event emits an Event on the HPAs a collector collects for if the
+// scheduler reports events.
+func (t *CollectorScheduler) event(refs []resourceReference, eventType, reason, message string) {
+	if t.events == nil {
+		return
+	}
+	for _, resourceRef := range refs {
+		t.events(resourceRef, eventType, reason, message)
+	}
+}
+
+// SetCircuitBreaker enables the circuit breaker of the collectors.
+func (p *HPAProvider) SetCircuitBreaker(config *CircuitBreakerConfig) {
+	p.circuitBreaker = config
+	for _, cluster := range p.clusters {
+		cluster.circuitBreaker = config
+	}
+}
+
+// hpaEvent emits an Event on the HPA of the resource reference.
+func (p *HPAProvider) hpaEvent(resourceRef resourceReference, eventType, reason, message string) {
+	if p.getHPA == nil {
+		return
+	}
+
+	hpa, err := p.getHPA(resourceRef.Namespace, resourceRef.Name)
+	if err != nil {
+		return
+	}
+	p.recorder.Event(hpa, eventType, reason, message)
+}
@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+)
+
+// ClusterLabel is the label external metrics are tagged with if the
+// provider discovers HPAs across clusters.
+const ClusterLabel = "cluster"
+
+// SetClusterName sets the name of the cluster the provider runs in. The
+// external metrics collected for its HPAs are tagged with it like the
+// metrics of remote clusters.
+func (p *HPAProvider) SetClusterName(name string) {
+	p.clusterName = name
+}
+
+// AddCluster adds a remote cluster whose HPAs are discovered in addition to
+// the HPAs of the cluster the provider runs in. Only external metrics are
+// collected for HPAs of remote clusters, they are tagged with the cluster
+// label and stored in the metric store of the provider, such that they're
+// served through its external metrics API.
+func (p *HPAProvider) AddCluster(name string, client kubernetes.Interface, collectorFactory *collector.CollectorFactory, recorder record.EventRecorder) {
+	cluster := NewHPAProvider(client, p.interval, p.collectorInterval, collectorFactory, recorder)
+	cluster.metricStore = p.metricStore
+	cluster.clusterName = name
+	cluster.remote = true
+	cluster.replicator = p.replicator
+	cluster.gcInterval = p.gcInterval
+	cluster.collectorJitter = p.collectorJitter
+	cluster.collectorMaxBackoff = p.collectorMaxBackoff
+	cluster.maxConcurrentCollections = p.maxConcurrentCollections
+	cluster.circuitBreaker = p.circuitBreaker
+	cluster.adaptiveInterval = p.adaptiveInterval
+	cluster.collectorWorkers = p.collectorWorkers
+	cluster.shutdownDrainTimeout = p.shutdownDrainTimeout
+	p.clusters = append(p.clusters, cluster)
+}
+
+// tagCluster sets the cluster label on collected external metrics if the
+// provider has a cluster name. The labels of the collected metrics are copied before they are
+// modified.
+func (p *HPAProvider) tagCluster(values []collector.CollectedMetric) {
+	if p.clusterName == "" {
+		return
+	}
+
+	for i, value := range values {
+		if value.Type != autoscalingv2.ExternalMetricSourceType {
+			continue
+		}
+
+		metricLabels := make(map[string]string, len(value.External.MetricLabels)+1)
+		for key, val := range value.External.MetricLabels {
+			metricLabels[key] = val
+		}
+		metricLabels[ClusterLabel] = p.clusterName
+		values[i].External.MetricLabels = metricLabels
+	}
+}
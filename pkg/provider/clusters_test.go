@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+)
+
+func TestTagCluster(t *testing.T) {
+	for _, tc := range []struct {
+		msg         string
+		clusterName string
+		expected    map[string]string
+	}{
+		{
+			msg:      "no cluster name",
+			expected: map[string]string{"queue-name": "foobar"},
+		},
+		{
+			msg:         "local cluster name",
+			clusterName: "central",
+			expected:    map[string]string{"queue-name": "foobar", ClusterLabel: "central"},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			p := &HPAProvider{}
+			p.SetClusterName(tc.clusterName)
+			metricLabels := map[string]string{"queue-name": "foobar"}
+			values := []collector.CollectedMetric{
+				labeledExternalValue("queue-length", 1, metricLabels),
+				podValue("pod", 1, nil),
+			}
+
+			p.tagCluster(values)
+
+			labels := values[0].External.MetricLabels
+			if len(labels) != len(tc.expected) {
+				t.Fatalf("expected labels %v, got %v", tc.expected, labels)
+			}
+			for key, value := range tc.expected {
+				if labels[key] != value {
+					t.Errorf("expected labels %v, got %v", tc.expected, labels)
+				}
+			}
+			if _, ok := metricLabels[ClusterLabel]; ok {
+				t.Error("expected the labels of the collector not to be modified")
+			}
+			if values[1].External.MetricLabels != nil {
+				t.Error("expected non-external metrics not to be labeled")
+			}
+		})
+	}
+}
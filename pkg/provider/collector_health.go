@@ -0,0 +1,196 @@
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+)
+
+// CollectorHealth is the health of a running collector.
+type CollectorHealth struct {
+	Cluster             string     `json:"cluster,omitempty"`
+	Namespace           string     `json:"namespace"`
+	HPA                 string     `json:"hpa"`
+	MetricType          string     `json:"metricType"`
+	Metric              string     `json:"metric"`
+	Collector           string     `json:"collector"`
+	CollectorType       string     `json:"collectorType"`
+	Healthy             bool       `json:"healthy"`
+	LastCollection      *time.Time `json:"lastCollection,omitempty"`
+	LastSuccess         *time.Time `json:"lastSuccess,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+	LastErrorTime       *time.Time `json:"lastErrorTime,omitempty"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	ConsecutiveEmpty    int        `json:"consecutiveEmptyResults"`
+	LastDurationSeconds float64    `json:"lastDurationSeconds"`
+	CircuitOpen         bool       `json:"circuitOpen,omitempty"`
+	// LastPartialResponse is the last partial response of the collector,
+	// listing the targets whose values were missing.
+	LastPartialResponse     string     `json:"lastPartialResponse,omitempty"`
+	LastPartialResponseTime *time.Time `json:"lastPartialResponseTime,omitempty"`
+}
+
+// labels returns the label values of the collector metrics.
+func (h *CollectorHealth) labels() []string {
+	return []string{h.Namespace, h.HPA, h.MetricType, h.Metric}
+}
+
+// collectorHealthKey identifies a collector in the health registry.
+type collectorHealthKey struct {
+	HPA    resourceReference
+	Metric collector.MetricTypeName
+}
+
+// collectorHealthRegistry tracks the health of the running collectors of a
+// collector scheduler.
+type collectorHealthRegistry struct {
+	entries map[collectorHealthKey]*CollectorHealth
+	sync.Mutex
+}
+
+// newCollectorHealthRegistry initializes an empty collectorHealthRegistry.
+func newCollectorHealthRegistry() *collectorHealthRegistry {
+	return &collectorHealthRegistry{
+		entries: make(map[collectorHealthKey]*CollectorHealth),
+	}
+}
+
+// register adds a started collector to the registry. It replaces the entry
+// of a previous collector of the same metric of the HPA.
+func (r *collectorHealthRegistry) register(resourceRef resourceReference, config *collector.MetricConfig, metricCollector collector.Collector) *CollectorHealth {
+	r.Lock()
+	defer r.Unlock()
+
+	entry := &CollectorHealth{
+		Namespace:  resourceRef.Namespace,
+		HPA:        resourceRef.Name,
+		MetricType: string(config.Type),
+		Metric:     config.Name,
+		Collector:  fmt.Sprintf("%T", metricCollector),
+		Healthy:    true,
+	}
+	entry.CollectorType = config.CollectorName
+	if entry.CollectorType == "" {
+		entry.CollectorType = strings.ToLower(string(config.Type))
+	}
+	r.entries[collectorHealthKey{HPA: resourceRef, Metric: config.MetricTypeName}] = entry
+	return entry
+}
+
+// unregister removes a stopped collector from the registry, unless it was
+// already replaced by a new collector.
+func (r *collectorHealthRegistry) unregister(entry *CollectorHealth, resourceRef resourceReference, config *collector.MetricConfig) {
+	r.Lock()
+	defer r.Unlock()
+
+	key := collectorHealthKey{HPA: resourceRef, Metric: config.MetricTypeName}
+	if r.entries[key] != entry {
+		return
+	}
+
+	delete(r.entries, key)
+	collectorFailures.DeleteLabelValues(entry.labels()...)
+	collectorLastSuccess.DeleteLabelValues(entry.labels()...)
+	collectorLastDuration.DeleteLabelValues(entry.labels()...)
+	collectorEmptyResults.DeleteLabelValues(entry.labels()...)
+
+	// the run metrics are shared by the collectors of the same type of
+	// the HPA.
+	for _, other := range r.entries {
+		if other.Namespace == entry.Namespace && other.HPA == entry.HPA && other.CollectorType == entry.CollectorType {
+			return
+		}
+	}
+	deleteRunMetrics(entry.CollectorType, entry.Namespace, entry.HPA)
+}
+
+// record records the result of a collection which started at start.
+func (r *collectorHealthRegistry) record(entry *CollectorHealth, start time.Time, err error, consecutiveFailures, consecutiveEmpty int, circuitOpen bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now().UTC()
+	duration := now.Sub(start)
+	entry.LastCollection = &now
+	entry.LastDurationSeconds = duration.Seconds()
+	entry.ConsecutiveFailures = consecutiveFailures
+	entry.ConsecutiveEmpty = consecutiveEmpty
+	entry.CircuitOpen = circuitOpen
+	entry.Healthy = err == nil
+	if err != nil {
+		entry.LastError = err.Error()
+		entry.LastErrorTime = &now
+	} else {
+		entry.LastSuccess = &now
+		collectorLastSuccess.WithLabelValues(entry.labels()...).Set(float64(now.Unix()))
+	}
+
+	collectorFailures.WithLabelValues(entry.labels()...).Set(float64(consecutiveFailures))
+	collectorLastDuration.WithLabelValues(entry.labels()...).Set(duration.Seconds())
+	collectorEmptyResults.WithLabelValues(entry.labels()...).Set(float64(consecutiveEmpty))
+	observeRun(entry.CollectorType, entry.Namespace, entry.HPA, duration, now, err)
+}
+
+// recordPartial records a partial response of a collector.
+func (r *collectorHealthRegistry) recordPartial(entry *CollectorHealth, partial *collector.PartialResponseError) {
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now().UTC()
+	entry.LastPartialResponse = partial.Error()
+	entry.LastPartialResponseTime = &now
+}
+
+// list returns copies of the health of all running collectors.
+func (r *collectorHealthRegistry) list() []CollectorHealth {
+	r.Lock()
+	defer r.Unlock()
+
+	health := make([]CollectorHealth, 0, len(r.entries))
+	for _, entry := range r.entries {
+		health = append(health, *entry)
+	}
+	return health
+}
+
+// CollectorHealth returns the health of the running collectors of the
+// provider and its remote clusters, sorted by HPA and metric. If unhealthy
+// is true only collectors whose last collection failed are returned.
+func (p *HPAProvider) CollectorHealth(unhealthy bool) []CollectorHealth {
+	var health []CollectorHealth
+	for _, provider := range append([]*HPAProvider{p}, p.clusters...) {
+		if provider.collectorScheduler == nil {
+			continue
+		}
+
+		for _, entry := range provider.collectorScheduler.health.list() {
+			if unhealthy && entry.Healthy {
+				continue
+			}
+			entry.Cluster = provider.clusterName
+			health = append(health, entry)
+		}
+	}
+
+	sort.Slice(health, func(i, j int) bool {
+		a, b := health[i], health[j]
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.HPA != b.HPA {
+			return a.HPA < b.HPA
+		}
+		if a.MetricType != b.MetricType {
+			return a.MetricType < b.MetricType
+		}
+		return a.Metric < b.Metric
+	})
+	return health
+}
@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// results of the collector run metrics.
+const (
+	collectionResultSuccess = "success"
+	collectionResultError   = "error"
+)
+
+var (
+	collectorFailures = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_metrics_adapter_collector_consecutive_failures",
+		Help: "Number of consecutive failed collections of a collector, reset on success.",
+	}, []string{"namespace", "hpa", "metric_type", "metric"})
+	collectorLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_metrics_adapter_collector_last_success_timestamp_seconds",
+		Help: "Unix timestamp of the last successful collection of a collector.",
+	}, []string{"namespace", "hpa", "metric_type", "metric"})
+	collectorLastDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_metrics_adapter_collector_last_duration_seconds",
+		Help: "Duration of the last collection of a collector.",
+	}, []string{"namespace", "hpa", "metric_type", "metric"})
+	collectorEmptyResults = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_metrics_adapter_collector_consecutive_empty_results",
+		Help: "Number of consecutive successful collections of a collector which returned no values, reset when values are returned.",
+	}, []string{"namespace", "hpa", "metric_type", "metric"})
+	collectorRunDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kube_metrics_adapter_collector_run_duration_seconds",
+		Help:    "Duration of the collections of the collectors of an HPA by collector type.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 8),
+	}, []string{"collector", "namespace", "hpa"})
+	collectorRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_metrics_adapter_collector_runs_total",
+		Help: "Number of collections of the collectors of an HPA by collector type and result.",
+	}, []string{"collector", "namespace", "hpa", "result"})
+	collectorLastRun = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_metrics_adapter_collector_last_run_timestamp_seconds",
+		Help: "Unix timestamp of the last collection of the collectors of an HPA by collector type.",
+	}, []string{"collector", "namespace", "hpa"})
+)
+
+func init() {
+	prometheus.MustRegister(collectorFailures, collectorLastSuccess, collectorLastDuration, collectorEmptyResults, collectorRunDuration, collectorRuns, collectorLastRun)
+}
+
+// observeRun records a collection of a collector of the type which finished
+// at end.
+func observeRun(collectorType, namespace, hpa string, duration time.Duration, end time.Time, err error) {
+	result := collectionResultSuccess
+	if err != nil {
+		result = collectionResultError
+	}
+
+	collectorRunDuration.WithLabelValues(collectorType, namespace, hpa).Observe(duration.Seconds())
+	collectorRuns.WithLabelValues(collectorType, namespace, hpa, result).Inc()
+	collectorLastRun.WithLabelValues(collectorType, namespace, hpa).Set(float64(end.Unix()))
+}
+
+// deleteRunMetrics removes the run metrics of the collectors of the type of
+// an HPA.
+func deleteRunMetrics(collectorType, namespace, hpa string) {
+	collectorRunDuration.DeleteLabelValues(collectorType, namespace, hpa)
+	collectorRuns.DeleteLabelValues(collectorType, namespace, hpa, collectionResultSuccess)
+	collectorRuns.DeleteLabelValues(collectorType, namespace, hpa, collectionResultError)
+	collectorLastRun.DeleteLabelValues(collectorType, namespace, hpa)
+}
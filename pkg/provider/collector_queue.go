@@ -0,0 +1,411 @@
+package provider
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+)
+
+// defaultCollectorWorkers is the default number of workers running the
+// collections of a collector scheduler.
+const defaultCollectorWorkers = 100
+
+// scheduledCollector is a collector scheduled in the collection queue along
+// with the state of its collections.
+type scheduledCollector struct {
+	ctx         context.Context
+	cancel      context.CancelFunc
+	resourceRef resourceReference
+	config      *collector.MetricConfig
+	collector   collector.Collector
+	// refs returns the HPAs currently referencing a shared collector, it's
+	// nil for collectors of a single HPA.
+	refs                func() []resourceReference
+	timeout             time.Duration
+	health              *CollectorHealth
+	breaker             *circuitBreaker
+	consecutiveFailures int
+	consecutiveEmpty    int
+	// lastValues are the values of the last complete collection.
+	lastValues []collector.CollectedMetric
+
+	// next is the time of the next collection. high is true if the
+	// collector is queued as high priority. index is the index in its
+	// queue, -1 while it's not queued, i.e. while it's collecting.
+	// triggered is set if the collector was triggered while collecting.
+	// probe is set if the collector was triggered while its circuit is
+	// open, such that the next collection probes the backend.
+	next      time.Time
+	high      bool
+	index     int
+	triggered bool
+	probe     bool
+}
+
+// currentRefs returns the HPAs the collector collects for.
+func (c *scheduledCollector) currentRefs() []resourceReference {
+	if c.refs != nil {
+		if refs := c.refs(); len(refs) > 0 {
+			return refs
+		}
+	}
+	return []resourceReference{c.resourceRef}
+}
+
+// collection returns the collection of the values collected for the HPAs.
+func (c *scheduledCollector) collection(refs []resourceReference, values []collector.CollectedMetric, err error) metricCollection {
+	collection := metricCollection{
+		Values: values,
+		Error:  err,
+		Config: c.config,
+		HPA:    refs[0],
+	}
+	if c.refs != nil {
+		collection.SharedWith = refs[1:]
+	}
+	return collection
+}
+
+// collectorHeap is a min-heap of collectors ordered by the time of their
+// next collection.
+type collectorHeap []*scheduledCollector
+
+func (h collectorHeap) Len() int           { return len(h) }
+func (h collectorHeap) Less(i, j int) bool { return h[i].next.Before(h[j].next) }
+func (h collectorHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *collectorHeap) Push(x interface{}) {
+	c := x.(*scheduledCollector)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+
+func (h *collectorHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	c := old[n-1]
+	old[n-1] = nil
+	c.index = -1
+	*h = old[:n-1]
+	return c
+}
+
+// collectionQueue queues the collectors by the time of their next
+// collection. Due high priority collectors are dequeued before due
+// best-effort collectors.
+type collectionQueue struct {
+	high       collectorHeap
+	bestEffort collectorHeap
+	// wake wakes up a worker waiting for the next due collector.
+	wake chan struct{}
+	sync.Mutex
+}
+
+// newCollectionQueue initializes an empty collectionQueue.
+func newCollectionQueue() *collectionQueue {
+	return &collectionQueue{
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// queue returns the queue of the priority.
+func (q *collectionQueue) queue(high bool) *collectorHeap {
+	if high {
+		return &q.high
+	}
+	return &q.bestEffort
+}
+
+// notify wakes up a waiting worker.
+func (q *collectionQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// push queues a collector for its next collection at next, or right away
+// if it was triggered while collecting.
+func (q *collectionQueue) push(c *scheduledCollector, next time.Time, high bool) {
+	q.Lock()
+	if c.triggered {
+		next = time.Now()
+		c.triggered = false
+	}
+	c.next = next
+	c.high = high
+	heap.Push(q.queue(high), c)
+	q.Unlock()
+	q.notify()
+}
+
+// remove removes a stopped collector from the queue.
+func (q *collectionQueue) remove(c *scheduledCollector) {
+	q.Lock()
+	defer q.Unlock()
+
+	if c.index >= 0 {
+		heap.Remove(q.queue(c.high), c.index)
+	}
+}
+
+// trigger moves the next collection of a collector to now.
+func (q *collectionQueue) trigger(c *scheduledCollector) {
+	q.Lock()
+	c.probe = true
+	if c.index >= 0 {
+		c.next = time.Now()
+		heap.Fix(q.queue(c.high), c.index)
+	} else {
+		c.triggered = true
+	}
+	q.Unlock()
+	q.notify()
+}
+
+// probe returns true if the collector was triggered since its last
+// collection and resets it.
+func (q *collectionQueue) probe(c *scheduledCollector) bool {
+	q.Lock()
+	defer q.Unlock()
+
+	probe := c.probe
+	c.probe = false
+	return probe
+}
+
+// pop waits for the next due collector and dequeues it. Stopped collectors
+// are dropped. It returns nil once the context is canceled.
+func (q *collectionQueue) pop(ctx context.Context) *scheduledCollector {
+	for {
+		var due *scheduledCollector
+		wait := time.Duration(-1)
+
+		q.Lock()
+		now := time.Now()
+		for _, h := range []*collectorHeap{&q.high, &q.bestEffort} {
+			if h.Len() == 0 {
+				continue
+			}
+			if !(*h)[0].next.After(now) {
+				due = heap.Pop(h).(*scheduledCollector)
+				break
+			}
+			if d := (*h)[0].next.Sub(now); wait < 0 || d < wait {
+				wait = d
+			}
+		}
+		q.Unlock()
+
+		if due != nil {
+			// further collectors may be due, let the next worker
+			// check.
+			q.notify()
+			if due.ctx.Err() != nil {
+				continue
+			}
+			return due
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if wait >= 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+
+		select {
+		case <-q.wake:
+		case <-timeout:
+		case <-ctx.Done():
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// Run starts the workers running the collections of the scheduler until the
+// context of the scheduler is canceled. No collections are started after,
+// while the collections in flight are finished for at most the drain
+// timeout before they are canceled.
+func (t *CollectorScheduler) Run(workers int) {
+	if workers <= 0 {
+		workers = defaultCollectorWorkers
+	}
+
+	t.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer t.workers.Done()
+			t.worker()
+		}()
+	}
+
+	go t.drain()
+}
+
+// drain waits for the in-flight collections to finish once the scheduler
+// context is canceled and cancels them after the drain timeout.
+func (t *CollectorScheduler) drain() {
+	<-t.ctx.Done()
+
+	stopped := make(chan struct{})
+	go func() {
+		t.workers.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(t.drainTimeout):
+		glog.Warningf("Canceling collections still running after %s", t.drainTimeout)
+	}
+	t.cancelCollections()
+
+	<-stopped
+	close(t.drained)
+}
+
+// worker runs the collections of due collectors and queues the collectors
+// for their next collection.
+func (t *CollectorScheduler) worker() {
+	for {
+		c := t.queue.pop(t.ctx)
+		if c == nil {
+			glog.V(2).Infof("stopping collector worker...")
+			return
+		}
+
+		wait := t.collect(c)
+		if c.ctx.Err() != nil {
+			continue
+		}
+		t.queue.push(c, time.Now().Add(wait), t.isHighPriority(c.currentRefs()))
+	}
+}
+
+// schedule schedules a collector for its first collection after the start
+// delay. The caller must hold the write lock.
+func (t *CollectorScheduler) schedule(resourceRef resourceReference, config *collector.MetricConfig, metricCollector collector.Collector, refs func() []resourceReference) *scheduledCollector {
+	ctx, cancel := context.WithCancel(t.collectionCtx)
+
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = metricCollector.Interval()
+	}
+
+	c := &scheduledCollector{
+		ctx:         ctx,
+		cancel:      cancel,
+		resourceRef: resourceRef,
+		config:      config,
+		collector:   metricCollector,
+		refs:        refs,
+		timeout:     timeout,
+		health:      t.health.register(resourceRef, config, metricCollector),
+		breaker:     newCircuitBreaker(t.circuitBreaker),
+		index:       -1,
+	}
+
+	t.queue.push(c, time.Now().Add(t.startDelay(metricCollector.Interval())), t.highPriority[resourceRef])
+	return c
+}
+
+// stop stops a scheduled collector and removes it from the queue.
+func (t *CollectorScheduler) stop(c *scheduledCollector) {
+	c.cancel()
+	t.queue.remove(c)
+	t.health.unregister(c.health, c.resourceRef, c.config)
+}
+
+// collect runs a single collection of a collector and returns the time to
+// wait before the next collection. Each collection is canceled after the
+// timeout of the metric, which defaults to the collector interval. The
+// interval is adapted to the scaling activity of the HPAs if enabled.
+// Failing collectors are retried with exponential backoff and paused while
+// their circuit is open.
+func (t *CollectorScheduler) collect(c *scheduledCollector) time.Duration {
+	refs := c.currentRefs()
+	if c.breaker.paused(time.Now()) && !t.queue.probe(c) {
+		return t.serveStale(c, refs)
+	}
+
+	if !t.acquire(c.ctx, refs) {
+		return 0
+	}
+	start := time.Now()
+	collectCtx, cancel := context.WithTimeout(c.ctx, c.timeout)
+	values, err := c.collector.GetMetrics(collectCtx)
+	if err != nil && collectCtx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("collection timed out after %s: %v", c.timeout, err)
+	}
+	cancel()
+	t.releaseSlot()
+
+	// the collector was stopped while collecting.
+	if c.ctx.Err() != nil {
+		return 0
+	}
+
+	if partial, ok := err.(*collector.PartialResponseError); ok {
+		values, err = t.partialResponse(c, refs, partial)
+	} else if err == nil {
+		c.lastValues = values
+	}
+	if err != nil {
+		values = staleValues(c, refs[0], err)
+	}
+
+	collection := c.collection(refs, values, err)
+	t.metricSink <- collection
+
+	if err != nil {
+		c.consecutiveFailures++
+	} else {
+		c.consecutiveFailures = 0
+	}
+	t.recordEmpty(c, refs, values, err)
+
+	interval := t.adaptInterval(c.collector.Interval(), refs)
+	wait := collectorBackoff(interval, c.consecutiveFailures, t.maxBackoff)
+	if wait > interval {
+		glog.V(1).Infof("Collector of metric '%s' of HPA %s failed %d times in a row, backing off for %s", c.config.Name, refs[0], c.consecutiveFailures, wait)
+	}
+
+	cooldown, changed := c.breaker.record(c.consecutiveFailures)
+	if changed {
+		t.breakerEvent(c.breaker, refs, c.config, c.consecutiveFailures, err)
+	}
+	t.health.record(c.health, start, err, c.consecutiveFailures, c.consecutiveEmpty, cooldown > 0)
+	if cooldown > wait {
+		wait = cooldown
+		// stale values are served at the interval while the circuit
+		// is open, such that they don't expire during the cooldown.
+		if servesStale(c.config) && interval < wait {
+			wait = interval
+		}
+	}
+
+	// respect the backend asking us to wait longer than the
+	// collection interval before the next query.
+	if retryAfter, ok := collector.RetryAfter(err); ok && retryAfter > wait {
+		glog.Infof("Backend asked to retry after %s, delaying next collection", retryAfter)
+		wait = retryAfter
+	}
+
+	return wait
+}
@@ -0,0 +1,137 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// queuedCollector returns a collector which can be queued.
+func queuedCollector(ctx context.Context) *scheduledCollector {
+	return &scheduledCollector{ctx: ctx, index: -1}
+}
+
+func TestCollectionQueueOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	now := time.Now()
+	late := queuedCollector(ctx)
+	early := queuedCollector(ctx)
+	high := queuedCollector(ctx)
+	future := queuedCollector(ctx)
+
+	q := newCollectionQueue()
+	q.push(late, now.Add(-time.Second), false)
+	q.push(early, now.Add(-time.Minute), false)
+	q.push(high, now.Add(-time.Millisecond), true)
+	q.push(future, now.Add(time.Hour), true)
+
+	for i, expected := range []*scheduledCollector{high, early, late} {
+		if c := q.pop(ctx); c != expected {
+			t.Errorf("expected collector %d to be dequeued", i)
+		}
+		if expected.index != -1 {
+			t.Errorf("expected dequeued collector %d to have no index", i)
+		}
+	}
+
+	if q.high.Len() != 1 || q.bestEffort.Len() != 0 {
+		t.Errorf("expected only the future collector to be queued")
+	}
+}
+
+func TestCollectionQueueTrigger(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := newCollectionQueue()
+
+	// triggering a queued collector makes it due.
+	queued := queuedCollector(ctx)
+	q.push(queued, time.Now().Add(time.Hour), false)
+	q.trigger(queued)
+	if c := q.pop(ctx); c != queued {
+		t.Fatal("expected triggered collector to be dequeued")
+	}
+	if !q.probe(queued) || q.probe(queued) {
+		t.Error("expected triggered collector to probe once")
+	}
+
+	// triggering a collecting collector queues it for right away.
+	collecting := queuedCollector(ctx)
+	q.trigger(collecting)
+	q.push(collecting, time.Now().Add(time.Hour), false)
+	if collecting.triggered {
+		t.Error("expected trigger to be reset once queued")
+	}
+	if c := q.pop(ctx); c != collecting {
+		t.Fatal("expected collector triggered while collecting to be dequeued")
+	}
+}
+
+func TestCollectionQueueRemove(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	q := newCollectionQueue()
+	removed := queuedCollector(ctx)
+	q.push(removed, time.Now(), false)
+	q.remove(removed)
+	if q.bestEffort.Len() != 0 {
+		t.Error("expected removed collector not to be queued")
+	}
+
+	// stopped collectors are dropped when dequeued.
+	stoppedCtx, stop := context.WithCancel(ctx)
+	stopped := queuedCollector(stoppedCtx)
+	q.push(stopped, time.Now(), false)
+	stop()
+
+	popped := make(chan *scheduledCollector)
+	go func() {
+		popped <- q.pop(ctx)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if c := <-popped; c != nil {
+		t.Error("expected stopped collector to be dropped")
+	}
+}
+
+func TestCollectionQueueWaitsForDueCollector(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	q := newCollectionQueue()
+	c := queuedCollector(ctx)
+	start := time.Now()
+	q.push(c, start.Add(50*time.Millisecond), false)
+
+	if popped := q.pop(ctx); popped != c {
+		t.Fatal("expected collector to be dequeued once due")
+	}
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Errorf("expected collector to be dequeued when due, waited %s", waited)
+	}
+}
+
+func TestCollectorBackoff(t *testing.T) {
+	for _, tc := range []struct {
+		msg        string
+		failures   int
+		maxBackoff time.Duration
+		expected   time.Duration
+	}{
+		{msg: "no failures", failures: 0, maxBackoff: time.Minute, expected: 10 * time.Second},
+		{msg: "first failure", failures: 1, maxBackoff: time.Minute, expected: 10 * time.Second},
+		{msg: "doubled", failures: 3, maxBackoff: time.Minute, expected: 40 * time.Second},
+		{msg: "capped", failures: 10, maxBackoff: time.Minute, expected: time.Minute},
+		{msg: "max backoff below interval", failures: 10, maxBackoff: time.Second, expected: 10 * time.Second},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			if wait := collectorBackoff(10*time.Second, tc.failures, tc.maxBackoff); wait != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, wait)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	v1 "k8s.io/api/core/v1"
+)
+
+// emptyResultsThreshold is the number of consecutive empty results after
+// which a collector is reported as returning no data.
+const emptyResultsThreshold = 3
+
+// withheld returns true if the values of the last collection of the
+// collector were withheld during its warm-up.
+func (c *scheduledCollector) withheld() bool {
+	warmUp, ok := c.collector.(*collector.WarmUpCollector)
+	return ok && warmUp.Withheld()
+}
+
+// recordEmpty tracks the consecutive successful collections of a collector
+// which returned no values, e.g. a query matching nothing, which would
+// otherwise leave the HPA stalled silently. Once the threshold is reached a
+// warning is logged on every empty result and an Event is emitted on the
+// HPAs. Failed collections and collections withheld during the warm-up leave
+// the count as is.
+func (t *CollectorScheduler) recordEmpty(c *scheduledCollector, refs []resourceReference, values []collector.CollectedMetric, err error) {
+	if err != nil || c.withheld() {
+		return
+	}
+
+	if len(values) > 0 {
+		if c.consecutiveEmpty >= emptyResultsThreshold {
+			glog.Infof("Collector of metric '%s' of HPA %s returned values again after %d empty results", c.config.Name, refs[0], c.consecutiveEmpty)
+		}
+		c.consecutiveEmpty = 0
+		return
+	}
+
+	c.consecutiveEmpty++
+	if c.consecutiveEmpty < emptyResultsThreshold {
+		glog.V(1).Infof("Collector of metric '%s' of HPA %s returned no values", c.config.Name, refs[0])
+		return
+	}
+
+	glog.Warningf("Collector of metric '%s' of HPA %s returned no values %d times in a row", c.config.Name, refs[0], c.consecutiveEmpty)
+	if c.consecutiveEmpty == emptyResultsThreshold {
+		t.event(refs, v1.EventTypeWarning, "EmptyResults", fmt.Sprintf("Metric '%s' returned no values %d times in a row, check that its query matches any data", c.config.Name, c.consecutiveEmpty))
+	}
+}
@@ -0,0 +1,86 @@
+package provider
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+)
+
+// Policies defining what is served for metrics which were collected before
+// but have since expired. Metrics which were never collected are always
+// reported as NotFound.
+const (
+	// ExpiredMetricPolicyNotFound reports expired metrics as NotFound,
+	// telling when they expired. This is the default.
+	ExpiredMetricPolicyNotFound = "not-found"
+	// ExpiredMetricPolicyServeLast serves the last collected value of
+	// expired metrics until the store forgets them after the expired
+	// retention.
+	ExpiredMetricPolicyServeLast = "serve-last"
+)
+
+// ValidExpiredMetricPolicy returns true if the policy is a supported expired
+// metric policy.
+func ValidExpiredMetricPolicy(policy string) bool {
+	return policy == ExpiredMetricPolicyNotFound || policy == ExpiredMetricPolicyServeLast
+}
+
+// SetExpiredMetricPolicy sets the policy for serving expired metrics.
+func (p *HPAProvider) SetExpiredMetricPolicy(policy string) {
+	p.expiredMetricPolicy = policy
+}
+
+// expiredCustomMetric returns the last value of an expired custom metric if
+// the expired metric policy serves it. Otherwise it returns a NotFound error
+// telling apart metrics which expired from metrics which were never
+// collected.
+func (p *HPAProvider) expiredCustomMetric(groupResource schema.GroupResource, namespace, name, metricName string, metricSelector labels.Selector) (*custom_metrics.MetricValue, error) {
+	value, expiredAt, ok := p.metricStore.ExpiredCustomMetric(metricName, groupResource, namespace, name, metricSelector)
+	if !ok {
+		return nil, metricNotFoundError(fmt.Sprintf("the server could not find the metric %s for %s %s: metric was never collected", metricName, groupResource.String(), name))
+	}
+
+	if p.expiredMetricPolicy == ExpiredMetricPolicyServeLast {
+		glog.V(1).Infof("Serving last value of metric %s for %s %s/%s, expired at %s", metricName, groupResource.String(), namespace, name, expiredAt.Format(time.RFC3339))
+		return value, nil
+	}
+	return nil, metricNotFoundError(fmt.Sprintf("the server could not find the metric %s for %s %s: metric expired at %s", metricName, groupResource.String(), name, expiredAt.Format(time.RFC3339)))
+}
+
+// expiredCustomMetricsBySelector returns the last values of the expired
+// custom metrics of the resources matching the selector if the expired
+// metric policy serves them.
+func (p *HPAProvider) expiredCustomMetricsBySelector(groupResource schema.GroupResource, namespace string, selector labels.Selector, metricName string, metricSelector labels.Selector) []custom_metrics.MetricValue {
+	if p.expiredMetricPolicy != ExpiredMetricPolicyServeLast {
+		return nil
+	}
+
+	values, expiredAt, ok := p.metricStore.ExpiredCustomMetricsBySelector(metricName, groupResource, namespace, selector, metricSelector)
+	if !ok {
+		return nil
+	}
+	glog.V(1).Infof("Serving last values of metric %s for %d %s in namespace %s, expired at %s", metricName, len(values), groupResource.String(), namespace, expiredAt.Format(time.RFC3339))
+	return values
+}
+
+// expiredExternalMetric returns the last values of the expired series of an
+// external metric matching the selector if the expired metric policy serves
+// them. Otherwise it returns a NotFound error telling apart metrics which
+// expired from metrics which were never collected.
+func (p *HPAProvider) expiredExternalMetric(metricName string, selector labels.Selector) ([]external_metrics.ExternalMetricValue, error) {
+	values, expiredAt, ok := p.metricStore.ExpiredExternalMetric(metricName, selector)
+	if !ok {
+		return nil, metricNotFoundError(fmt.Sprintf("the server could not find the external metric %s [%s]: metric was never collected", metricName, selector.String()))
+	}
+
+	if p.expiredMetricPolicy == ExpiredMetricPolicyServeLast {
+		glog.V(1).Infof("Serving last values of external metric %s [%s], expired at %s", metricName, selector.String(), expiredAt.Format(time.RFC3339))
+		return values, nil
+	}
+	return nil, metricNotFoundError(fmt.Sprintf("the server could not find the external metric %s [%s]: metric expired at %s", metricName, selector.String(), expiredAt.Format(time.RFC3339)))
+}
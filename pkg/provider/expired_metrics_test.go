@@ -0,0 +1,185 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+	"sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+)
+
+// expiredState describes the state of the metrics in the store of a test.
+type expiredState int
+
+const (
+	neverCollected expiredState = iota
+	collected
+	expiredInStore
+	expiredRemoved
+)
+
+// storeMetrics inserts a custom and an external metric into the store in
+// the state.
+func storeMetrics(store *InMemoryMetricStore, state expiredState) {
+	if state == neverCollected {
+		return
+	}
+
+	config := &collector.MetricConfig{}
+	if state != collected {
+		config.TTL = time.Nanosecond
+	}
+
+	store.InsertAll([]collector.CollectedMetric{
+		{
+			Type: autoscalingv2.PodsMetricSourceType,
+			Custom: custom_metrics.MetricValue{
+				DescribedObject: custom_metrics.ObjectReference{Kind: "Pod", Namespace: "default", Name: "pod-1"},
+				Metric:          custom_metrics.MetricIdentifier{Name: "requests"},
+				Value:           *resource.NewQuantity(5, resource.DecimalSI),
+			},
+			Labels: map[string]string{"app": "foo"},
+		},
+		{
+			Type: autoscalingv2.ExternalMetricSourceType,
+			External: external_metrics.ExternalMetricValue{
+				MetricName:   "queue-length",
+				MetricLabels: map[string]string{"queue": "foo"},
+				Value:        *resource.NewQuantity(7, resource.DecimalSI),
+			},
+		},
+	}, config)
+
+	time.Sleep(time.Millisecond)
+	if state == expiredRemoved {
+		store.RemoveExpired()
+	}
+}
+
+func TestExpiredMetricPolicy(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+
+	for _, tc := range []struct {
+		msg      string
+		policy   string
+		state    expiredState
+		notFound bool
+		reason   string
+	}{
+		{
+			msg:      "never collected",
+			policy:   ExpiredMetricPolicyNotFound,
+			state:    neverCollected,
+			notFound: true,
+			reason:   "never collected",
+		},
+		{
+			msg:      "never collected with serve-last",
+			policy:   ExpiredMetricPolicyServeLast,
+			state:    neverCollected,
+			notFound: true,
+			reason:   "never collected",
+		},
+		{
+			msg:    "collected",
+			policy: ExpiredMetricPolicyNotFound,
+			state:  collected,
+		},
+		{
+			msg:      "expired in store",
+			policy:   ExpiredMetricPolicyNotFound,
+			state:    expiredInStore,
+			notFound: true,
+			reason:   "expired at",
+		},
+		{
+			msg:      "expired and removed",
+			policy:   ExpiredMetricPolicyNotFound,
+			state:    expiredRemoved,
+			notFound: true,
+			reason:   "expired at",
+		},
+		{
+			msg:    "expired in store with serve-last",
+			policy: ExpiredMetricPolicyServeLast,
+			state:  expiredInStore,
+		},
+		{
+			msg:    "expired and removed with serve-last",
+			policy: ExpiredMetricPolicyServeLast,
+			state:  expiredRemoved,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			p := NewHPAProvider(fake.NewSimpleClientset(), time.Minute, time.Minute, nil, nil)
+			p.SetExpiredMetricPolicy(tc.policy)
+			store := p.metricStore.(*InMemoryMetricStore)
+			storeMetrics(store, tc.state)
+
+			checkErr := func(err error) bool {
+				t.Helper()
+				if tc.notFound {
+					if !apierrors.IsNotFound(err) {
+						t.Fatalf("expected NotFound error, got %v", err)
+					}
+					if status := err.(apierrors.APIStatus).Status(); !strings.Contains(status.Message, tc.reason) {
+						t.Errorf("expected reason '%s' in message '%s'", tc.reason, status.Message)
+					}
+					return false
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return true
+			}
+
+			value, err := p.GetMetricByName(context.Background(), types.NamespacedName{Namespace: "default", Name: "pod-1"}, provider.CustomMetricInfo{GroupResource: pods, Metric: "requests", Namespaced: true}, labels.Everything())
+			if checkErr(err) && value.Value.Value() != 5 {
+				t.Errorf("expected custom metric value 5, got %s", value.Value.String())
+			}
+
+			external, err := p.GetExternalMetric(context.Background(), "default", labels.SelectorFromSet(labels.Set{"queue": "foo"}), provider.ExternalMetricInfo{Metric: "queue-length"})
+			if checkErr(err) && (len(external.Items) != 1 || external.Items[0].Value.Value() != 7) {
+				t.Errorf("expected external metric value 7, got %v", external.Items)
+			}
+
+			if tc.notFound {
+				return
+			}
+
+			list, err := p.GetMetricBySelector(context.Background(), "default", labels.SelectorFromSet(labels.Set{"app": "foo"}), provider.CustomMetricInfo{GroupResource: pods, Metric: "requests", Namespaced: true}, labels.Everything())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if list == nil || len(list.Items) != 1 {
+				t.Fatalf("expected one custom metric by selector, got %v", list)
+			}
+		})
+	}
+}
+
+func TestListStoredMetricsExpired(t *testing.T) {
+	store := NewInMemoryMetricStore(time.Minute)
+	storeMetrics(store, expiredRemoved)
+
+	metrics := store.ListStoredMetrics()
+	if len(metrics) != 2 {
+		t.Fatalf("expected 2 remembered expired series, got %d", len(metrics))
+	}
+	for _, metric := range metrics {
+		if !metric.Expired || metric.ExpiredAt == nil {
+			t.Errorf("expected series %s to be listed as expired", metric.Metric)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package provider
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// healthIntervals is the number of intervals after which HPA discovery or
+// metric collection is considered unhealthy if no progress was made.
+const healthIntervals = 3
+
+// healthStatus tracks the progress of HPA discovery and metric collection.
+type healthStatus struct {
+	lastDiscovery  time.Time
+	lastCollection time.Time
+	standby        bool
+	// replicating is the number of replication streams of the leader
+	// whose snapshot of the metric store was restored.
+	replicating int
+	// discoveryErr is the last error of HPA discovery, which failed at
+	// discoveryErrTime.
+	discoveryErr     error
+	discoveryErrTime time.Time
+	sync.RWMutex
+}
+
+// discovered records a successful HPA discovery.
+func (h *healthStatus) discovered() {
+	h.Lock()
+	h.lastDiscovery = time.Now().UTC()
+	h.Unlock()
+}
+
+// discoveryFailed records a failed HPA discovery, e.g. a failing watch of the
+// HPA informer.
+func (h *healthStatus) discoveryFailed(err error) {
+	h.Lock()
+	h.discoveryErr = err
+	h.discoveryErrTime = time.Now().UTC()
+	h.Unlock()
+}
+
+// discoveryFailedSince returns true if HPA discovery failed after the time.
+func (h *healthStatus) discoveryFailedSince(t time.Time) bool {
+	h.RLock()
+	defer h.RUnlock()
+	return h.discoveryErrTime.After(t)
+}
+
+// collected records that a metric collection was processed.
+func (h *healthStatus) collected() {
+	h.Lock()
+	h.lastCollection = time.Now().UTC()
+	h.Unlock()
+}
+
+// setStandby records whether the provider is a standby replica which doesn't
+// discover HPAs or collect metrics.
+func (h *healthStatus) setStandby(standby bool) {
+	h.Lock()
+	h.standby = standby
+	h.Unlock()
+}
+
+// isStandby returns true if the provider is a standby replica.
+func (h *healthStatus) isStandby() bool {
+	h.RLock()
+	defer h.RUnlock()
+	return h.standby
+}
+
+// replicationStarted records that a replication stream of the leader started
+// filling the metric store.
+func (h *healthStatus) replicationStarted() {
+	h.Lock()
+	h.replicating++
+	h.Unlock()
+}
+
+// replicationStopped records that a replication stream of the leader ended.
+func (h *healthStatus) replicationStopped() {
+	h.Lock()
+	h.replicating--
+	h.Unlock()
+}
+
+// Ready returns an error if the provider doesn't hold the metrics it would
+// serve, i.e. if it's a standby replica whose metric store is neither shared
+// with nor replicated from the leader. The metrics API of such a replica
+// would answer all requests with NotFound, so it must not receive requests.
+func (p *HPAProvider) Ready() error {
+	p.health.RLock()
+	defer p.health.RUnlock()
+
+	if !p.health.standby {
+		return nil
+	}
+
+	if _, ok := p.metricStore.(*RedisMetricStore); ok {
+		return nil
+	}
+
+	if p.health.replicating > 0 {
+		return nil
+	}
+
+	return fmt.Errorf("standby replica doesn't hold the collected metrics")
+}
+
+// Healthy returns an error if HPA discovery or metric collection has not
+// made progress recently. This is independent of the health of the metrics
+// API which is reported to the kube-apiserver, such that a broken collection
+// doesn't make the aggregated API appear unavailable.
+func (p *HPAProvider) Healthy() error {
+	p.health.RLock()
+	defer p.health.RUnlock()
+
+	// standby replicas don't make any progress to report.
+	if p.health.standby {
+		return nil
+	}
+
+	now := time.Now().UTC()
+
+	if p.health.discoveryErrTime.After(p.health.lastDiscovery) {
+		return fmt.Errorf("HPA discovery failing since %s: %v", p.health.discoveryErrTime.Format(time.RFC3339), p.health.discoveryErr)
+	}
+
+	if p.health.lastDiscovery.IsZero() {
+		return fmt.Errorf("HPA discovery has not completed yet")
+	}
+
+	if now.Sub(p.health.lastDiscovery) > healthIntervals*p.interval {
+		return fmt.Errorf("HPA discovery has not succeeded since %s", p.health.lastDiscovery.Format(time.RFC3339))
+	}
+
+	if p.collectorScheduler != nil && p.collectorScheduler.Len() > 0 {
+		lastCollection := p.health.lastCollection
+		if lastCollection.IsZero() {
+			lastCollection = p.health.lastDiscovery
+		}
+
+		if now.Sub(lastCollection) > healthIntervals*p.collectorInterval {
+			return fmt.Errorf("no metrics collected since %s", lastCollection.Format(time.RFC3339))
+		}
+	}
+
+	return nil
+}
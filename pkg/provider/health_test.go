@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestHealthy(t *testing.T) {
+	now := time.Now().UTC()
+
+	for _, tc := range []struct {
+		msg              string
+		standby          bool
+		lastDiscovery    time.Time
+		discoveryErrTime time.Time
+		healthy          bool
+	}{
+		{
+			msg:           "recent discovery",
+			lastDiscovery: now,
+			healthy:       true,
+		},
+		{
+			msg: "discovery not completed",
+		},
+		{
+			msg:           "stale discovery",
+			lastDiscovery: now.Add(-4 * time.Minute),
+		},
+		{
+			msg:              "discovery failing",
+			lastDiscovery:    now.Add(-time.Minute),
+			discoveryErrTime: now,
+		},
+		{
+			msg:              "discovery recovered",
+			lastDiscovery:    now,
+			discoveryErrTime: now.Add(-time.Minute),
+			healthy:          true,
+		},
+		{
+			msg:              "discovery failing before completing",
+			discoveryErrTime: now,
+		},
+		{
+			msg:     "standby",
+			standby: true,
+			healthy: true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			p := &HPAProvider{interval: time.Minute}
+			p.health.standby = tc.standby
+			p.health.lastDiscovery = tc.lastDiscovery
+			if !tc.discoveryErrTime.IsZero() {
+				p.health.discoveryErr = fmt.Errorf("watch failed")
+				p.health.discoveryErrTime = tc.discoveryErrTime
+			}
+
+			err := p.Healthy()
+			if tc.healthy && err != nil {
+				t.Errorf("expected healthy, got %v", err)
+			}
+			if !tc.healthy && err == nil {
+				t.Error("expected unhealthy")
+			}
+		})
+	}
+}
+
+func TestDiscoveryFailedSince(t *testing.T) {
+	h := &healthStatus{}
+	before := time.Now().UTC()
+	if h.discoveryFailedSince(before) {
+		t.Error("expected no failure to be recorded")
+	}
+
+	h.discoveryFailed(fmt.Errorf("watch failed"))
+	if !h.discoveryFailedSince(before) {
+		t.Error("expected failure after the check to be recorded")
+	}
+	if h.discoveryFailedSince(time.Now().UTC().Add(time.Second)) {
+		t.Error("expected no failure after the failure")
+	}
+}
+
+func TestReady(t *testing.T) {
+	for _, tc := range []struct {
+		msg         string
+		standby     bool
+		store       MetricStore
+		replicating int
+		ready       bool
+	}{
+		{
+			msg:   "leader",
+			store: NewInMemoryMetricStore(time.Minute),
+			ready: true,
+		},
+		{
+			msg:     "standby with in-memory store",
+			standby: true,
+			store:   NewInMemoryMetricStore(time.Minute),
+		},
+		{
+			msg:         "standby receiving replication",
+			standby:     true,
+			store:       NewInMemoryMetricStore(time.Minute),
+			replicating: 1,
+			ready:       true,
+		},
+		{
+			msg:     "standby with shared store",
+			standby: true,
+			store:   &RedisMetricStore{},
+			ready:   true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			p := &HPAProvider{metricStore: tc.store}
+			p.health.standby = tc.standby
+			p.health.replicating = tc.replicating
+
+			err := p.Ready()
+			if tc.ready && err != nil {
+				t.Errorf("expected ready, got %v", err)
+			}
+			if !tc.ready && err == nil {
+				t.Error("expected not ready")
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package provider
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+)
+
+// rawHistoryRetention is the time collected values are kept as is in the
+// metric history before they're downsampled.
+const rawHistoryRetention = 10 * time.Minute
+
+// HistoryPoint is a value in the metric history. Downsampled points
+// aggregate all values collected within the resolution starting at Time.
+type HistoryPoint struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+	// Min, Max and Count are only set for downsampled points, where
+	// Value is the average.
+	Min   float64 `json:"min,omitempty"`
+	Max   float64 `json:"max,omitempty"`
+	Count int     `json:"count,omitempty"`
+}
+
+// HistorySeries is the history of a single metric series.
+type HistorySeries struct {
+	Type   autoscalingv2.MetricSourceType `json:"type"`
+	Metric string                         `json:"metric"`
+	// Namespace, Kind and Name describe the object of custom metrics.
+	Namespace string `json:"namespace,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name,omitempty"`
+	// Labels are the labels of external metrics.
+	Labels      map[string]string `json:"labels,omitempty"`
+	Downsampled []HistoryPoint    `json:"downsampled"`
+	Raw         []HistoryPoint    `json:"raw"`
+}
+
+// metricHistory keeps the recently collected values of all metric series.
+// Values are kept as is for rawHistoryRetention and downsampled to the
+// resolution afterwards until the retention passed.
+type metricHistory struct {
+	retention  time.Duration
+	resolution time.Duration
+	series     map[string]*HistorySeries
+	sync.RWMutex
+}
+
+// newMetricHistory initializes a new metricHistory.
+func newMetricHistory(retention, resolution time.Duration) *metricHistory {
+	return &metricHistory{
+		retention:  retention,
+		resolution: resolution,
+		series:     make(map[string]*HistorySeries),
+	}
+}
+
+// EnableMetricHistory enables keeping the values collected within the
+// retention, downsampled to the resolution after rawHistoryRetention.
+func (p *HPAProvider) EnableMetricHistory(retention, resolution time.Duration) {
+	p.history = newMetricHistory(retention, resolution)
+}
+
+// MetricHistory returns the history of the series of a metric. The series
+// of custom metrics can be restricted to a namespace and the name of the
+// described object.
+func (p *HPAProvider) MetricHistory(metricName, namespace, name string) []HistorySeries {
+	if p.history == nil {
+		return nil
+	}
+	return p.history.get(metricName, namespace, name)
+}
+
+// record records collected values.
+func (h *metricHistory) record(values []collector.CollectedMetric, now time.Time) {
+	h.Lock()
+	defer h.Unlock()
+
+	for _, value := range values {
+		var key string
+		var milliValue int64
+		series := HistorySeries{
+			Type: value.Type,
+		}
+
+		switch value.Type {
+		case autoscalingv2.ObjectMetricSourceType, autoscalingv2.PodsMetricSourceType:
+			object := value.Custom.DescribedObject
+			series.Metric = value.Custom.Metric.Name
+			series.Namespace = object.Namespace
+			series.Kind = object.Kind
+			series.Name = object.Name
+			key = string(value.Type) + "/" + series.Metric + "/" + object.Namespace + "/" + object.Kind + "/" + object.Name
+			milliValue = value.Custom.Value.MilliValue()
+		case autoscalingv2.ExternalMetricSourceType:
+			series.Metric = value.External.MetricName
+			series.Labels = value.External.MetricLabels
+			key = string(value.Type) + "/" + series.Metric + "/" + hashLabelMap(series.Labels)
+			milliValue = value.External.Value.MilliValue()
+		default:
+			continue
+		}
+
+		stored, ok := h.series[key]
+		if !ok {
+			stored = &series
+			h.series[key] = stored
+		}
+
+		stored.Raw = append(stored.Raw, HistoryPoint{
+			Time:  now,
+			Value: float64(milliValue) / 1000,
+		})
+		h.downsample(stored, now)
+	}
+}
+
+// downsample moves the raw points older than rawHistoryRetention into the
+// downsampled points and drops points older than the retention.
+func (h *metricHistory) downsample(series *HistorySeries, now time.Time) {
+	rawStart := now.Add(-rawHistoryRetention)
+
+	i := 0
+	for ; i < len(series.Raw) && series.Raw[i].Time.Before(rawStart); i++ {
+		point := series.Raw[i]
+		bucket := point.Time.Truncate(h.resolution)
+
+		last := len(series.Downsampled) - 1
+		if last >= 0 && series.Downsampled[last].Time.Equal(bucket) {
+			downsampled := &series.Downsampled[last]
+			downsampled.Value = (downsampled.Value*float64(downsampled.Count) + point.Value) / float64(downsampled.Count+1)
+			if point.Value < downsampled.Min {
+				downsampled.Min = point.Value
+			}
+			if point.Value > downsampled.Max {
+				downsampled.Max = point.Value
+			}
+			downsampled.Count++
+			continue
+		}
+
+		series.Downsampled = append(series.Downsampled, HistoryPoint{
+			Time:  bucket,
+			Value: point.Value,
+			Min:   point.Value,
+			Max:   point.Value,
+			Count: 1,
+		})
+	}
+	series.Raw = series.Raw[i:]
+
+	start := now.Add(-h.retention)
+	i = 0
+	for i < len(series.Downsampled) && series.Downsampled[i].Time.Before(start) {
+		i++
+	}
+	series.Downsampled = series.Downsampled[i:]
+}
+
+// removeExpired removes the series which weren't collected within the
+// retention.
+func (h *metricHistory) removeExpired(now time.Time) {
+	h.Lock()
+	defer h.Unlock()
+
+	for key, series := range h.series {
+		h.downsample(series, now)
+		if len(series.Raw) == 0 && len(series.Downsampled) == 0 {
+			delete(h.series, key)
+		}
+	}
+}
+
+// get returns copies of the series of a metric, optionally restricted to a
+// namespace and the name of the described object.
+func (h *metricHistory) get(metricName, namespace, name string) []HistorySeries {
+	h.RLock()
+	defer h.RUnlock()
+
+	result := make([]HistorySeries, 0)
+	for _, series := range h.series {
+		if series.Metric != metricName {
+			continue
+		}
+
+		if (namespace != "" && series.Namespace != namespace) || (name != "" && series.Name != name) {
+			continue
+		}
+
+		copied := *series
+		copied.Raw = append([]HistoryPoint(nil), series.Raw...)
+		copied.Downsampled = append([]HistoryPoint(nil), series.Downsampled...)
+		result = append(result, copied)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return hashLabelMap(result[i].Labels) < hashLabelMap(result[j].Labels)
+	})
+
+	return result
+}
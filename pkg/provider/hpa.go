@@ -2,37 +2,99 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
 	"reflect"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/golang/glog"
-	"github.com/kubernetes-incubator/custom-metrics-apiserver/pkg/provider"
 	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
-	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/metrics/pkg/apis/custom_metrics"
 	"k8s.io/metrics/pkg/apis/external_metrics"
+	"sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
 )
 
+// resyncIntervalAnnotation defines the interval at which the collectors of
+// an HPA are set up again, independent of changes to the HPA.
+const resyncIntervalAnnotation = "kube-metrics-adapter/resync-interval"
+
+// shutdownStoreTimeout is the time to store the drained collections on
+// shutdown, after the drain timeout.
+const shutdownStoreTimeout = 5 * time.Second
+
+// defaultGCInterval is the default interval at which expired metrics are
+// removed from the metric store.
+const defaultGCInterval = 10 * time.Minute
+
 type objectCollector struct {
-	ObjectReference *autoscalingv2beta1.CrossVersionObjectReference
+	ObjectReference *autoscalingv2.CrossVersionObjectReference
 }
 
 // HPAProvider is a base provider for initializing metric collectors based on
 // HPA resources.
 type HPAProvider struct {
-	client             kubernetes.Interface
-	interval           time.Duration
-	collectorScheduler *CollectorScheduler
-	collectorInterval  time.Duration
-	metricSink         chan metricCollection
-	hpaCache           map[resourceReference]autoscalingv2beta1.HorizontalPodAutoscaler
-	metricStore        *MetricStore
-	collectorFactory   *collector.CollectorFactory
+	client              kubernetes.Interface
+	interval            time.Duration
+	collectorScheduler  *CollectorScheduler
+	collectorInterval   time.Duration
+	metricSink          chan metricCollection
+	hpaCache            map[resourceReference]autoscalingv2.HorizontalPodAutoscaler
+	hpaSetupTimes       map[resourceReference]time.Time
+	getHPA              hpaGetter
+	metricStore         MetricStore
+	collectorFactory    *collector.CollectorFactory
+	recorder            record.EventRecorder
+	restMapper          *restmapper.DeferredDiscoveryRESTMapper
+	health              healthStatus
+	leaderElection      *LeaderElectionConfig
+	statusReporter      *statusReporter
+	namespaceFilter     *NamespaceFilter
+	clusterName         string
+	remote              bool
+	clusters            []*HPAProvider
+	standaloneMetrics   []StandaloneMetric
+	hpaSelector         string
+	shard               *Shard
+	snapshotStorage     SnapshotStorage
+	snapshotInterval    time.Duration
+	history             *metricHistory
+	replicator          *replicator
+	maxMetricAge        time.Duration
+	expiredMetricPolicy string
+	gcInterval          time.Duration
+	namespaceQuota      *NamespaceQuota
+	collectorJitter     float64
+	collectorMaxBackoff time.Duration
+	// maxConcurrentCollections limits the number of simultaneous
+	// collections. Remote clusters have their own limit.
+	maxConcurrentCollections int
+	circuitBreaker           *CircuitBreakerConfig
+	adaptiveInterval         *AdaptiveIntervalConfig
+	collectorWorkers         int
+	shutdownDrainTimeout     time.Duration
+	// running tracks the running metric collection, to wait for it to
+	// be drained on shutdown.
+	running sync.WaitGroup
 }
 
 // metricCollection is a container for sending collected metrics across a
@@ -40,36 +102,280 @@ type HPAProvider struct {
 type metricCollection struct {
 	Values []collector.CollectedMetric
 	Error  error
+	Config *collector.MetricConfig
+	HPA    resourceReference
+	// SharedWith are the other HPAs a shared collector collects for.
+	SharedWith []resourceReference
 }
 
 // NewHPAProvider initializes a new HPAProvider.
-func NewHPAProvider(client kubernetes.Interface, interval, collectorInterval time.Duration, collectorFactory *collector.CollectorFactory) *HPAProvider {
+func NewHPAProvider(client kubernetes.Interface, interval, collectorInterval time.Duration, collectorFactory *collector.CollectorFactory, recorder record.EventRecorder) *HPAProvider {
 	metricsc := make(chan metricCollection)
 	return &HPAProvider{
 		client:            client,
 		interval:          interval,
 		collectorInterval: collectorInterval,
 		metricSink:        metricsc,
-		metricStore:       NewMetricStore(),
+		hpaCache:          make(map[resourceReference]autoscalingv2.HorizontalPodAutoscaler),
+		hpaSetupTimes:     make(map[resourceReference]time.Time),
+		metricStore:       NewInMemoryMetricStore(collectorInterval),
 		collectorFactory:  collectorFactory,
+		recorder:          recorder,
+		restMapper:        restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(client.Discovery())),
+		gcInterval:        defaultGCInterval,
+		collectorWorkers:  defaultCollectorWorkers,
+	}
+}
+
+// SetMetricStore replaces the in-memory metric store of the provider, e.g.
+// with a store shared by multiple adapter replicas.
+func (p *HPAProvider) SetMetricStore(store MetricStore) {
+	p.metricStore = store
+}
+
+// SetMetricTTL sets the time collected values are served for if their
+// config defines neither a TTL nor a staleness policy.
+func (p *HPAProvider) SetMetricTTL(ttl time.Duration) {
+	p.metricStore.SetDefaultTTL(ttl)
+}
+
+// SetMetricStoreGC sets the interval at which expired metrics are removed
+// from the metric store and the time expired metrics are kept in the store
+// before, to report when they expired.
+func (p *HPAProvider) SetMetricStoreGC(interval, retention time.Duration) {
+	p.gcInterval = interval
+	for _, cluster := range p.clusters {
+		cluster.gcInterval = interval
+	}
+	p.metricStore.SetExpiredRetention(retention)
+}
+
+// SetCollectorJitter sets the fraction of their interval the first
+// collection of the collectors set up at startup is randomly delayed by.
+func (p *HPAProvider) SetCollectorJitter(jitter float64) {
+	p.collectorJitter = jitter
+	for _, cluster := range p.clusters {
+		cluster.collectorJitter = jitter
+	}
+}
+
+// SetCollectorMaxBackoff sets the maximum time failing collectors back off
+// for before the next collection.
+func (p *HPAProvider) SetCollectorMaxBackoff(maxBackoff time.Duration) {
+	p.collectorMaxBackoff = maxBackoff
+	for _, cluster := range p.clusters {
+		cluster.collectorMaxBackoff = maxBackoff
+	}
+}
+
+// SetShutdownDrainTimeout sets the maximum time the collections in flight
+// are waited for on shutdown before they are canceled.
+func (p *HPAProvider) SetShutdownDrainTimeout(timeout time.Duration) {
+	p.shutdownDrainTimeout = timeout
+	for _, cluster := range p.clusters {
+		cluster.shutdownDrainTimeout = timeout
+	}
+}
+
+// WaitForShutdown waits until the collections in flight when the context
+// passed to Run was canceled were drained and stored, at most for the drain
+// timeout and the time to store the drained collections.
+func (p *HPAProvider) WaitForShutdown() {
+	done := make(chan struct{})
+	go func() {
+		p.running.Wait()
+		for _, cluster := range p.clusters {
+			cluster.running.Wait()
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		glog.Info("Drained metrics collection.")
+	case <-time.After(p.shutdownDrainTimeout + shutdownStoreTimeout):
+		glog.Warning("Timed out waiting for the metrics collection to drain.")
+	}
+}
+
+// SetCollectorWorkers sets the number of workers running the collections of
+// the collectors. Remote clusters have their own workers.
+func (p *HPAProvider) SetCollectorWorkers(workers int) {
+	p.collectorWorkers = workers
+	for _, cluster := range p.clusters {
+		cluster.collectorWorkers = workers
 	}
 }
 
-// Run runs the HPA resource discovery and metric collection.
+// SetMaxConcurrentCollections limits the number of collections running at
+// the same time. Collectors wait for a free slot before collecting. A limit
+// of 0 disables it.
+func (p *HPAProvider) SetMaxConcurrentCollections(max int) {
+	p.maxConcurrentCollections = max
+	for _, cluster := range p.clusters {
+		cluster.maxConcurrentCollections = max
+	}
+}
+
+// SetMaxMetricAge sets the maximum age of served values. Values collected
+// longer ago are not served, even if they haven't expired yet. A max age of
+// 0 disables the check.
+func (p *HPAProvider) SetMaxMetricAge(maxAge time.Duration) {
+	p.maxMetricAge = maxAge
+}
+
+// tooOld returns true if a value collected at the timestamp exceeds the max
+// age.
+func (p *HPAProvider) tooOld(timestamp time.Time) bool {
+	return p.maxMetricAge > 0 && !timestamp.IsZero() && time.Since(timestamp) > p.maxMetricAge
+}
+
+// metricTooOldError returns a NotFound error for values exceeding the max
+// age.
+func (p *HPAProvider) metricTooOldError(metric string, timestamp time.Time) error {
+	return metricNotFoundError(fmt.Sprintf("the server could not find a recent value of the metric %s: value collected at %s exceeds the max age of %s", metric, timestamp.Format(time.RFC3339), p.maxMetricAge))
+}
+
+// Run runs the HPA resource discovery and metric collection. If leader
+// election is enabled, discovery and collection only run while the provider
+// is the leader.
 func (p *HPAProvider) Run(ctx context.Context) {
+	if p.snapshotStorage != nil {
+		p.restoreSnapshot()
+	}
+
+	if p.replicator != nil {
+		go p.runReplicationServer(ctx)
+	}
+
+	if p.leaderElection != nil {
+		p.runLeaderElection(ctx)
+		return
+	}
+	p.run(ctx)
+}
+
+// run runs the HPA resource discovery and metric collection until the
+// context is canceled.
+func (p *HPAProvider) run(ctx context.Context) {
+	// start from an empty cache such that all collectors are set up when
+	// run again after losing the leadership.
+	p.hpaCache = make(map[resourceReference]autoscalingv2.HorizontalPodAutoscaler)
+	p.hpaSetupTimes = make(map[resourceReference]time.Time)
+
 	// initialize collector table
 	p.collectorScheduler = NewCollectorScheduler(ctx, p.metricSink)
+	p.collectorScheduler.jitter = p.collectorJitter
+	p.collectorScheduler.maxBackoff = p.collectorMaxBackoff
+	if p.maxConcurrentCollections > 0 {
+		p.collectorScheduler.slots = newCollectionSlots(p.maxConcurrentCollections)
+	}
+	p.collectorScheduler.circuitBreaker = p.circuitBreaker
+	p.collectorScheduler.events = p.hpaEvent
+	p.collectorScheduler.adaptiveInterval = p.adaptiveInterval
+	p.collectorScheduler.activity = p.scalingActivity
+	p.collectorScheduler.drainTimeout = p.shutdownDrainTimeout
+	p.collectorScheduler.Run(p.collectorWorkers)
 
-	go p.collectMetrics(ctx)
+	p.running.Add(1)
+	go p.collectMetrics(ctx, p.collectorScheduler)
 
-	for {
-		err := p.updateHPAs()
-		if err != nil {
-			glog.Error(err)
+	p.scheduleStandaloneMetrics()
+
+	if p.statusReporter != nil {
+		go p.statusReporter.run(ctx)
+	}
+
+	// remote clusters share the replicator of the provider.
+	if p.replicator != nil && !p.remote {
+		go p.runReplication(ctx)
+	}
+
+	if p.snapshotStorage != nil {
+		go p.runSnapshots(ctx)
+	}
+
+	for _, cluster := range p.clusters {
+		cluster.namespaceFilter = p.namespaceFilter
+		cluster.hpaSelector = p.hpaSelector
+		cluster.shard = p.shard
+		go cluster.run(ctx)
+	}
+
+	// the informer resyncs all HPAs at the discovery interval as fallback
+	// for missed watch events. If only a single namespace is watched the
+	// informer is limited to it, otherwise HPAs are filtered when
+	// enqueued.
+	var informerOptions []informers.SharedInformerOption
+	if namespace, ok := p.namespaceFilter.singleNamespace(); ok {
+		informerOptions = append(informerOptions, informers.WithNamespace(namespace))
+	}
+	if p.hpaSelector != "" {
+		informerOptions = append(informerOptions, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = p.hpaSelector
+		}))
+	}
+	informerFactory := informers.NewSharedInformerFactoryWithOptions(p.client, p.interval, informerOptions...)
+	hpaInformer, getHPA, err := newHPAInformer(p.client, informerFactory)
+	if err != nil {
+		glog.Errorf("Failed to detect the served autoscaling API: %v", err)
+		p.health.discoveryFailed(err)
+		return
+	}
+	p.getHPA = getHPA
+
+	// the informer keeps serving its cache while listing or watching HPAs
+	// fails, such failures are reported as failed discovery.
+	err = hpaInformer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		if !apierrors.IsResourceExpired(err) && !apierrors.IsGone(err) && err != io.EOF {
+			p.health.discoveryFailed(err)
+		}
+		cache.DefaultWatchErrorHandler(r, err)
+	})
+	if err != nil {
+		glog.Errorf("Failed to set watch error handler of HPA informer: %v", err)
+	}
+
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer queue.ShutDown()
+
+	hpaInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			p.enqueueHPA(queue, obj)
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			p.enqueueHPA(queue, obj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			p.enqueueHPA(queue, obj)
+		},
+	})
+
+	informerFactory.Start(ctx.Done())
+
+	glog.Info("Looking for HPAs")
+	if !cache.WaitForCacheSync(ctx.Done(), hpaInformer.HasSynced) {
+		glog.Error("Failed to sync HPA cache")
+		return
+	}
+	p.health.discovered()
+
+	go func() {
+		for p.processNextHPA(queue) {
 		}
+	}()
 
+	lastCheck := time.Now().UTC()
+	for {
 		select {
 		case <-time.After(p.interval):
+			// discovery only made progress if listing and watching
+			// HPAs didn't fail since the last check.
+			now := time.Now().UTC()
+			if hpaInformer.HasSynced() && !p.health.discoveryFailedSince(lastCheck) {
+				p.health.discovered()
+			}
+			lastCheck = now
 		case <-ctx.Done():
 			glog.Info("Stopped HPA provider.")
 			return
@@ -77,96 +383,325 @@ func (p *HPAProvider) Run(ctx context.Context) {
 	}
 }
 
-// updateHPAs discovers all HPA resources and sets up metric collectors for new
-// HPAs.
-func (p *HPAProvider) updateHPAs() error {
-	glog.Info("Looking for HPAs")
+// enqueueHPA adds the key of an HPA to the queue.
+func (p *HPAProvider) enqueueHPA(queue workqueue.Interface, obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		glog.Errorf("Failed to get key of HPA: %v", err)
+		return
+	}
+
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		glog.Errorf("Failed to get namespace of HPA %s: %v", key, err)
+		return
+	}
+
+	if !p.namespaceFilter.Allowed(namespace) || !p.shard.Owns(namespace, name) {
+		return
+	}
+
+	queue.Add(key)
+}
+
+// processNextHPA processes the next HPA from the queue. HPAs which fail to
+// sync are requeued with backoff. It returns false when the queue is shut
+// down.
+func (p *HPAProvider) processNextHPA(queue workqueue.RateLimitingInterface) bool {
+	key, shutdown := queue.Get()
+	if shutdown {
+		return false
+	}
+	defer queue.Done(key)
+
+	err := p.syncHPA(key.(string))
+	if err != nil {
+		glog.Errorf("Failed to sync HPA %s, retrying: %v", key, err)
+		queue.AddRateLimited(key)
+		return true
+	}
+
+	queue.Forget(key)
+
+	// HPAs with a resync interval are synced again independent of the
+	// informer resync.
+	if resyncInterval, ok := p.hpaResyncInterval(key.(string)); ok {
+		queue.AddAfter(key, resyncInterval)
+	}
+	return true
+}
+
+// hpaResyncInterval returns the resync interval defined for a cached HPA.
+func (p *HPAProvider) hpaResyncInterval(key string) (time.Duration, bool) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return 0, false
+	}
+
+	hpa, ok := p.hpaCache[resourceReference{Name: name, Namespace: namespace}]
+	if !ok {
+		return 0, false
+	}
+
+	return resyncInterval(&hpa)
+}
 
-	hpas, err := p.client.AutoscalingV2beta1().HorizontalPodAutoscalers(metav1.NamespaceAll).List(metav1.ListOptions{})
+// resyncInterval returns the interval defined by the resync interval
+// annotation of an HPA. Invalid intervals are ignored.
+func resyncInterval(hpa *autoscalingv2.HorizontalPodAutoscaler) (time.Duration, bool) {
+	value, ok := hpa.Annotations[resyncIntervalAnnotation]
+	if !ok {
+		return 0, false
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		glog.Warningf("Ignoring invalid resync interval '%s' of HPA %s/%s", value, hpa.Namespace, hpa.Name)
+		return 0, false
+	}
+	return interval, true
+}
+
+// syncHPA sets up metric collectors for a new or updated HPA and removes the
+// collectors of a deleted HPA.
+func (p *HPAProvider) syncHPA(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
 	if err != nil {
 		return err
 	}
 
-	newHPACache := make(map[resourceReference]autoscalingv2beta1.HorizontalPodAutoscaler, len(hpas.Items))
+	resourceRef := resourceReference{
+		Name:      name,
+		Namespace: namespace,
+	}
 
-	newHPAs := 0
+	cachedHPA, cached := p.hpaCache[resourceRef]
 
-	for _, hpa := range hpas.Items {
-		resourceRef := resourceReference{
-			Name:      hpa.Name,
-			Namespace: hpa.Namespace,
+	hpaObj, err := p.getHPA(namespace, name)
+	if apierrors.IsNotFound(err) {
+		// collectors may also be scheduled for HPAs which were not
+		// cached because some of their collectors failed.
+		glog.V(2).Infof("Removing previously scheduled metrics collector: %s", resourceRef)
+		p.collectorScheduler.Remove(resourceRef)
+		delete(p.hpaCache, resourceRef)
+		delete(p.hpaSetupTimes, resourceRef)
+		p.namespaceQuota.remove(resourceRef)
+		if p.statusReporter != nil {
+			p.statusReporter.remove(resourceRef)
 		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 
-		if cachedHPA, ok := p.hpaCache[resourceRef]; !ok || !equalHPA(cachedHPA, hpa) {
-			metricConfigs, err := collector.ParseHPAMetrics(&hpa)
-			if err != nil {
-				glog.Errorf("Failed to parse HPA metrics: %v", err)
+	hpa := *hpaObj
+
+	// unchanged HPAs are only set up again once their resync interval
+	// passed.
+	if cached && equalHPA(cachedHPA, hpa) && !p.resyncDue(resourceRef, &hpa) {
+		return nil
+	}
+
+	metricConfigs, err := collector.ParseHPAMetrics(&hpa)
+	if err != nil {
+		// invalid annotations won't get valid without the HPA
+		// changing, so don't retry.
+		glog.Errorf("Failed to parse HPA metrics: %v", err)
+		return nil
+	}
+
+	if p.remote {
+		configs := make([]*collector.MetricConfig, 0, len(metricConfigs))
+		for _, config := range metricConfigs {
+			if config.Type != autoscalingv2.ExternalMetricSourceType {
+				glog.V(2).Infof("Skipping %s metric '%s' of HPA %s in cluster %s, only external metrics are collected for remote clusters", config.Type, config.Name, resourceRef, p.clusterName)
 				continue
 			}
+			configs = append(configs, config)
+		}
+		metricConfigs = configs
+	}
 
-			cache := true
-			for _, config := range metricConfigs {
-				interval := config.Interval
-				if interval == 0 {
-					interval = p.collectorInterval
-				}
-
-				collector, err := p.collectorFactory.NewCollector(&hpa, config, interval)
-				if err != nil {
-					// TODO: log and send event
-					glog.Errorf("Failed to create new metrics collector: %v", err)
-					cache = false
-					continue
-				}
+	if p.statusReporter != nil {
+		p.statusReporter.retain(resourceRef, metricConfigs)
+	}
 
-				glog.Infof("Adding new metrics collector: %T", collector)
-				p.collectorScheduler.Add(resourceRef, config.MetricTypeName, collector)
+	// the collectors of paused metrics are stopped, their last values are
+	// served until they expire. Their status isn't reported while they're
+	// paused.
+	configs := make([]*collector.MetricConfig, 0, len(metricConfigs))
+	for _, config := range metricConfigs {
+		if config.Paused {
+			if p.statusReporter != nil {
+				p.statusReporter.removeMetric(resourceRef, config.MetricTypeName)
 			}
-			newHPAs++
+			if p.collectorScheduler.RemoveMetric(resourceRef, config.MetricTypeName) {
+				glog.Infof("Paused collection of metric '%s' of HPA %s", config.Name, resourceRef)
+				p.recorder.Eventf(&hpa, v1.EventTypeNormal, "CollectionPaused", "Paused collection of metric '%s'", config.Name)
+			}
+			continue
+		}
+		configs = append(configs, config)
+	}
+	metricConfigs = configs
+
+	// HPAs exceeding the collector quota of their namespace aren't
+	// retried with backoff, but when the informer resyncs them, such that
+	// they're set up once the namespace has capacity again. The rejection
+	// is only reported once.
+	first, err := p.namespaceQuota.admitCollectors(p.collectorScheduler, resourceRef, len(metricConfigs))
+	if err != nil {
+		glog.Errorf("Rejecting HPA %s: %v", resourceRef, err)
+		if first {
+			p.recorder.Eventf(&hpa, v1.EventTypeWarning, "NamespaceQuotaExceeded", "Not collecting metrics: %v", err)
+		}
+		p.collectorScheduler.Remove(resourceRef)
+		delete(p.hpaCache, resourceRef)
+		return nil
+	}
+
+	p.collectorScheduler.SetPriority(resourceRef, highPriority(&hpa))
+
+	var errs []string
+	for _, config := range metricConfigs {
+
+		interval := config.Interval
+		if interval == 0 {
+			interval = p.collectorInterval
+		}
 
-			// if we get an error setting up the collectors for the
-			// HPA, don't cache it, but try again later.
-			if !cache {
+		if config.Type == autoscalingv2.ObjectMetricSourceType && config.TargetNamespace != hpa.Namespace {
+			err := p.checkObjectAccess(config)
+			if err != nil {
+				glog.Errorf("Failed to access object for metric '%s': %v", config.Name, err)
+				p.recorder.Eventf(&hpa, v1.EventTypeWarning, "CrossNamespaceAccessDenied", "Unable to access object for metric '%s': %v", config.Name, err)
+				errs = append(errs, err.Error())
 				continue
 			}
 		}
 
-		newHPACache[resourceRef] = hpa
-	}
+		metricCollector, err := p.collectorFactory.NewCollector(&hpa, config, interval)
+		if err != nil {
+			// TODO: log and send event
+			glog.Errorf("Failed to create new metrics collector: %v", err)
+			errs = append(errs, err.Error())
+			continue
+		}
 
-	for ref := range p.hpaCache {
-		if _, ok := newHPACache[ref]; ok {
+		if key, ok := collector.SharedCollectorKey(&hpa, config); ok {
+			glog.Infof("Adding new shared metrics collector: %T", metricCollector)
+			p.collectorScheduler.AddShared(key, resourceRef, config, metricCollector)
 			continue
 		}
 
-		glog.V(2).Infof("Removing previously scheduled metrics collector: %s", ref)
-		p.collectorScheduler.Remove(ref)
+		glog.Infof("Adding new metrics collector: %T", metricCollector)
+		p.collectorScheduler.Add(resourceRef, config, metricCollector)
+	}
+
+	// if we get an error setting up the collectors for the HPA, don't
+	// cache it, but try again later.
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to set up collectors: %s", strings.Join(errs, "; "))
+	}
+
+	glog.Infof("Set up collectors for new/updated HPA %s", resourceRef)
+	p.hpaCache[resourceRef] = hpa
+	p.hpaSetupTimes[resourceRef] = time.Now()
+	return nil
+}
+
+// resyncDue returns true if the collectors of an HPA with a resync interval
+// were set up longer than the interval ago.
+func (p *HPAProvider) resyncDue(resourceRef resourceReference, hpa *autoscalingv2.HorizontalPodAutoscaler) bool {
+	interval, ok := resyncInterval(hpa)
+	if !ok {
+		return false
+	}
+
+	return time.Since(p.hpaSetupTimes[resourceRef]) >= interval
+}
+
+// checkObjectAccess checks that the adapter is allowed to read the object
+// described by an Object metric in the target namespace.
+func (p *HPAProvider) checkObjectAccess(config *collector.MetricConfig) error {
+	gv, err := schema.ParseGroupVersion(config.ObjectReference.APIVersion)
+	if err != nil {
+		return err
+	}
+
+	resource, err := p.kindToResource(gv.WithKind(config.ObjectReference.Kind))
+	if err != nil {
+		return err
+	}
+
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: config.TargetNamespace,
+				Verb:      "get",
+				Group:     gv.Group,
+				Resource:  resource,
+				Name:      config.ObjectReference.Name,
+			},
+		},
+	}
+
+	review, err = p.client.AuthorizationV1().SelfSubjectAccessReviews().Create(context.TODO(), review, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+
+	if !review.Status.Allowed {
+		return fmt.Errorf("not allowed to get %s %s/%s: %s", config.ObjectReference.Kind, config.TargetNamespace, config.ObjectReference.Name, review.Status.Reason)
 	}
 
-	glog.Infof("Found %d new/updated HPA(s)", newHPAs)
-	p.hpaCache = newHPACache
 	return nil
 }
 
+// kindToResource resolves the resource name of a kind with the REST mapper.
+// The cached discovery information is refreshed once if the kind is unknown,
+// e.g. because its CRD was installed after the adapter started.
+func (p *HPAProvider) kindToResource(gvk schema.GroupVersionKind) (string, error) {
+	mapping, err := p.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		p.restMapper.Reset()
+		mapping, err = p.restMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve resource of %s: %v", gvk, err)
+	}
+	return mapping.Resource.Resource, nil
+}
+
 // equalHPA returns true if two HPAs are identical (apart from their status).
-func equalHPA(a, b autoscalingv2beta1.HorizontalPodAutoscaler) bool {
+func equalHPA(a, b autoscalingv2.HorizontalPodAutoscaler) bool {
 	// reset resource version to not compare it since this will change
 	// whenever the status of the object is updated. We only want to
 	// compare the metadata and the spec.
 	a.ObjectMeta.ResourceVersion = ""
 	b.ObjectMeta.ResourceVersion = ""
+	// the status annotation is updated by the adapter itself.
+	a.ObjectMeta.Annotations = withoutStatusAnnotation(a.ObjectMeta.Annotations)
+	b.ObjectMeta.Annotations = withoutStatusAnnotation(b.ObjectMeta.Annotations)
 	return reflect.DeepEqual(a.ObjectMeta, b.ObjectMeta) && reflect.DeepEqual(a.Spec, b.Spec)
 }
 
 // collectMetrics collects all metrics from collectors and manages a central
-// metric store.
-func (p *HPAProvider) collectMetrics(ctx context.Context) {
-	// run garbage collection every 10 minutes
+// metric store. Once the context is canceled, the collections still in flight
+// are stored until the scheduler is drained.
+func (p *HPAProvider) collectMetrics(ctx context.Context, scheduler *CollectorScheduler) {
+	defer p.running.Done()
+
+	// run garbage collection every gc interval
 	go func(ctx context.Context) {
 		for {
 			select {
-			case <-time.After(10 * time.Minute):
+			case <-time.After(p.gcInterval):
 				p.metricStore.RemoveExpired()
+				if p.history != nil {
+					p.history.removeExpired(time.Now().UTC())
+				}
 			case <-ctx.Done():
 				glog.Info("Stopped metrics store garbage collection.")
 				return
@@ -177,66 +712,163 @@ func (p *HPAProvider) collectMetrics(ctx context.Context) {
 	for {
 		select {
 		case collection := <-p.metricSink:
-			if collection.Error != nil {
-				glog.Errorf("Failed to collect metrics: %v", collection.Error)
-			}
-
-			glog.Infof("Collected %d new metric(s)", len(collection.Values))
-			for _, value := range collection.Values {
-				switch value.Type {
-				case autoscalingv2beta1.ObjectMetricSourceType, autoscalingv2beta1.PodsMetricSourceType:
-					glog.Infof("Collected new custom metric '%s' (%s) for %s %s/%s",
-						value.Custom.MetricName,
-						value.Custom.Value.String(),
-						value.Custom.DescribedObject.Kind,
-						value.Custom.DescribedObject.Namespace,
-						value.Custom.DescribedObject.Name,
-					)
-				case autoscalingv2beta1.ExternalMetricSourceType:
-					glog.Infof("Collected new external metric '%s' (%s) [%s]",
-						value.External.MetricName,
-						value.External.Value.String(),
-						labels.Set(value.External.MetricLabels).String(),
-					)
+			p.storeCollection(collection)
+		case <-ctx.Done():
+			// store the collections still in flight until the
+			// scheduler is drained.
+			for {
+				select {
+				case collection := <-p.metricSink:
+					p.storeCollection(collection)
+				case <-scheduler.drained:
+					glog.Info("Stopped metrics collection.")
+					return
 				}
-				p.metricStore.Insert(value)
 			}
-		case <-ctx.Done():
-			glog.Info("Stopped metrics collection.")
-			return
 		}
 	}
 }
 
-// GetRootScopedMetricByName returns metrics for a root scoped resource by
-// name.
-func (p *HPAProvider) GetRootScopedMetricByName(groupResource schema.GroupResource, name string, metricName string) (*custom_metrics.MetricValue, error) {
-	metric := p.metricStore.GetMetricsByName(metricName, groupResource, "", name)
-	if metric == nil {
-		return nil, provider.NewMetricNotFoundForError(groupResource, metricName, name)
+// storeCollection stores the values of a collection in the metric store
+// and records its result.
+func (p *HPAProvider) storeCollection(collection metricCollection) {
+	p.health.collected()
+
+	// values substituted for a failed collection count towards the quota
+	// like collected values.
+	if collection.Error == nil || len(collection.Values) > 0 {
+		first, err := p.namespaceQuota.admitSeries(p.metricStore, collection.HPA, collection.Config, collection.Values)
+		if err != nil {
+			if first {
+				p.quotaExceeded(collection, err)
+			}
+			collection.Values = nil
+			collection.Error = err
+		}
+	}
+
+	if collection.Error != nil {
+		glog.Errorf("Failed to collect metrics: %v", collection.Error)
+	}
+
+	if p.statusReporter != nil {
+		p.statusReporter.record(collection.HPA, collection.Config, collection.Error)
+		for _, hpa := range collection.SharedWith {
+			p.statusReporter.record(hpa, collection.Config, collection.Error)
+		}
+	}
+
+	glog.Infof("Collected %d new metric(s)", len(collection.Values))
+	for _, value := range collection.Values {
+		switch value.Type {
+		case autoscalingv2.ObjectMetricSourceType, autoscalingv2.PodsMetricSourceType:
+			glog.Infof("Collected new custom metric '%s' (%s) for %s %s/%s",
+				value.Custom.Metric.Name,
+				value.Custom.Value.String(),
+				value.Custom.DescribedObject.Kind,
+				value.Custom.DescribedObject.Namespace,
+				value.Custom.DescribedObject.Name,
+			)
+		case autoscalingv2.ExternalMetricSourceType:
+			glog.Infof("Collected new external metric '%s' (%s) [%s]",
+				value.External.MetricName,
+				value.External.Value.String(),
+				labels.Set(value.External.MetricLabels).String(),
+			)
+		}
+	}
+	p.tagCluster(collection.Values)
+	p.insertCollection(collection.Values, collection.Config)
+	if p.replicator != nil {
+		p.replicator.push(collection.Values, collection.Config)
 	}
-	return metric, nil
 }
 
-// GetRootScopedMetricBySelector returns metrics for root scoped resources by
-// label selector.
-func (p *HPAProvider) GetRootScopedMetricBySelector(groupResource schema.GroupResource, selector labels.Selector, metricName string) (*custom_metrics.MetricValueList, error) {
-	return p.metricStore.GetMetricsBySelector(metricName, groupResource, "", selector), nil
+// insertCollection inserts collected metrics into the metric store and the
+// metric history.
+func (p *HPAProvider) insertCollection(values []collector.CollectedMetric, config *collector.MetricConfig) {
+	p.metricStore.InsertAll(values, config)
+	observeInserts(values)
+	if p.history != nil {
+		p.history.record(values, time.Now().UTC())
+	}
 }
 
-// GetNamespacedMetricByName returns metrics for a namespaced resource by name.
-func (p *HPAProvider) GetNamespacedMetricByName(groupResource schema.GroupResource, namespace string, name string, metricName string) (*custom_metrics.MetricValue, error) {
-	metric := p.metricStore.GetMetricsByName(metricName, groupResource, namespace, name)
+// GetMetricByName returns metrics for a resource by name. For root scoped
+// resources the namespace of the name is empty.
+func (p *HPAProvider) GetMetricByName(ctx context.Context, name types.NamespacedName, info provider.CustomMetricInfo, metricSelector labels.Selector) (*custom_metrics.MetricValue, error) {
+	if !p.namespaceFilter.Allowed(name.Namespace) {
+		return nil, namespaceNotServedError(name.Namespace)
+	}
+
+	start := time.Now()
+	metric := p.metricStore.GetMetricsByName(info.Metric, info.GroupResource, name.Namespace, name.Name, metricSelector)
+	observeLookup(lookupMetricByName, start, metric != nil)
 	if metric == nil {
-		return nil, provider.NewMetricNotFoundForError(groupResource, metricName, name)
+		var err error
+		metric, err = p.expiredCustomMetric(info.GroupResource, name.Namespace, name.Name, info.Metric, metricSelector)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.tooOld(metric.Timestamp.Time) {
+		return nil, p.metricTooOldError(info.Metric, metric.Timestamp.Time)
 	}
 	return metric, nil
 }
 
-// GetNamespacedMetricBySelector returns metrics for namespaced resources by
-// label selector.
-func (p *HPAProvider) GetNamespacedMetricBySelector(groupResource schema.GroupResource, namespace string, selector labels.Selector, metricName string) (*custom_metrics.MetricValueList, error) {
-	return p.metricStore.GetMetricsBySelector(metricName, groupResource, namespace, selector), nil
+// namespaceNotServedError returns a NotFound error for requests for metrics
+// of a namespace excluded by the namespace filter.
+func namespaceNotServedError(namespace string) error {
+	return metricNotFoundError(fmt.Sprintf("metrics of namespace %s are not served by this adapter", namespace))
+}
+
+// metricNotFoundError returns a NotFound status error with the given
+// message.
+func metricNotFoundError(message string) error {
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    int32(http.StatusNotFound),
+		Reason:  metav1.StatusReasonNotFound,
+		Message: message,
+	}}
+}
+
+// GetMetricBySelector returns metrics for resources by label selector. For
+// root scoped resources the namespace is empty.
+func (p *HPAProvider) GetMetricBySelector(ctx context.Context, namespace string, selector labels.Selector, info provider.CustomMetricInfo, metricSelector labels.Selector) (*custom_metrics.MetricValueList, error) {
+	if !p.namespaceFilter.Allowed(namespace) {
+		return nil, namespaceNotServedError(namespace)
+	}
+
+	start := time.Now()
+	metrics := p.metricStore.GetMetricsBySelector(info.Metric, info.GroupResource, namespace, selector, metricSelector)
+	if metrics == nil || len(metrics.Items) == 0 {
+		if expired := p.expiredCustomMetricsBySelector(info.GroupResource, namespace, selector, info.Metric, metricSelector); len(expired) > 0 {
+			metrics = &custom_metrics.MetricValueList{Items: expired}
+		}
+	}
+	if metrics == nil {
+		observeLookup(lookupMetricsBySelector, start, false)
+		return nil, nil
+	}
+
+	observeLookup(lookupMetricsBySelector, start, len(metrics.Items) > 0)
+
+	if p.maxMetricAge > 0 && len(metrics.Items) > 0 {
+		items := make([]custom_metrics.MetricValue, 0, len(metrics.Items))
+		for _, item := range metrics.Items {
+			if !p.tooOld(item.Timestamp.Time) {
+				items = append(items, item)
+			}
+		}
+		if len(items) == 0 {
+			return nil, p.metricTooOldError(info.Metric, metrics.Items[0].Timestamp.Time)
+		}
+		metrics.Items = items
+	}
+	return metrics, nil
 }
 
 // ListAllMetrics list all available metrics from the provicer.
@@ -244,8 +876,44 @@ func (p *HPAProvider) ListAllMetrics() []provider.CustomMetricInfo {
 	return p.metricStore.ListAllMetrics()
 }
 
-func (p *HPAProvider) GetExternalMetric(namespace string, metricName string, metricSelector labels.Selector) (*external_metrics.ExternalMetricValueList, error) {
-	return p.metricStore.GetExternalMetric(namespace, metricName, metricSelector)
+// GetExternalMetric returns external metrics matching the metric selector.
+// If no metrics match a NotFound error is returned, telling whether matching
+// metrics were never collected or have expired, unless the expired metric
+// policy serves the last values of expired metrics.
+func (p *HPAProvider) GetExternalMetric(ctx context.Context, namespace string, metricSelector labels.Selector, info provider.ExternalMetricInfo) (*external_metrics.ExternalMetricValueList, error) {
+	if !p.namespaceFilter.Allowed(namespace) {
+		return nil, namespaceNotServedError(namespace)
+	}
+
+	metricName := info.Metric
+	start := time.Now()
+	metrics, err := p.metricStore.GetExternalMetric(namespace, metricName, metricSelector)
+	if err != nil {
+		return nil, err
+	}
+	observeLookup(lookupExternalMetric, start, len(metrics.Items) > 0)
+
+	if len(metrics.Items) == 0 {
+		metrics.Items, err = p.expiredExternalMetric(metricName, metricSelector)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.maxMetricAge > 0 && len(metrics.Items) > 0 {
+		items := make([]external_metrics.ExternalMetricValue, 0, len(metrics.Items))
+		for _, item := range metrics.Items {
+			if !p.tooOld(item.Timestamp.Time) {
+				items = append(items, item)
+			}
+		}
+		if len(items) == 0 {
+			return nil, p.metricTooOldError(metricName, metrics.Items[0].Timestamp.Time)
+		}
+		metrics.Items = items
+	}
+
+	return metrics, nil
 }
 
 func (p *HPAProvider) ListAllExternalMetrics() []provider.ExternalMetricInfo {
@@ -259,26 +927,125 @@ type resourceReference struct {
 
 // CollectorScheduler is a scheduler for running metric collection jobs.
 // It keeps track of all running collectors and stops them if they are to be
-// removed.
+// removed. The collectors are queued by the time of their next collection
+// and run by a fixed number of workers, such that the number of goroutines
+// doesn't grow with the number of collectors.
 type CollectorScheduler struct {
-	ctx        context.Context
-	table      map[resourceReference]map[collector.MetricTypeName]context.CancelFunc
+	ctx    context.Context
+	table  map[resourceReference]map[collector.MetricTypeName]context.CancelFunc
+	shared map[string]*sharedCollector
+	// collectors are the scheduled collectors of the metrics of the HPAs.
+	collectors map[resourceReference]map[collector.MetricTypeName]*scheduledCollector
+	// queue queues the collectors for the workers by the time of their
+	// next collection.
+	queue      *collectionQueue
 	metricSink chan<- metricCollection
+	// jitter is the fraction of their interval the first collection of
+	// collectors added at startup is randomly delayed by.
+	jitter  float64
+	started time.Time
+	// maxBackoff is the maximum time failing collectors wait before the
+	// next collection.
+	maxBackoff time.Duration
+	// slots limits the number of simultaneous collections if not nil.
+	slots *collectionSlots
+	// highPriority are the HPAs whose collectors get a collection slot
+	// first.
+	highPriority map[resourceReference]bool
+	// circuitBreaker configures the circuit breaker of the collectors,
+	// it's disabled if nil.
+	circuitBreaker *CircuitBreakerConfig
+	// events emits Events on HPAs.
+	events func(resourceRef resourceReference, eventType, reason, message string)
+	// health tracks the health of the running collectors.
+	health *collectorHealthRegistry
+	// collectionCtx is the parent context of the collections. It's only
+	// canceled once the in-flight collections were drained for the drain
+	// timeout after the scheduler context was canceled. drained is closed
+	// once all workers stopped.
+	collectionCtx     context.Context
+	cancelCollections context.CancelFunc
+	drainTimeout      time.Duration
+	workers           sync.WaitGroup
+	drained           chan struct{}
+	// adaptiveInterval configures the adaptive collection interval, it's
+	// disabled if nil. activity returns the scaling activity of an HPA.
+	adaptiveInterval *AdaptiveIntervalConfig
+	activity         func(resourceRef resourceReference) scalingActivity
 	sync.RWMutex
 }
 
+// sharedCollector is a collector shared by all HPAs with an identical metric
+// config. It's stopped once no HPA references it anymore.
+type sharedCollector struct {
+	collector *scheduledCollector
+	// refs are the HPAs referencing the collector in the order they were
+	// added.
+	refs []resourceReference
+}
+
 // NewCollectorScheudler initializes a new CollectorScheduler.
 func NewCollectorScheduler(ctx context.Context, metricsc chan<- metricCollection) *CollectorScheduler {
+	collectionCtx, cancelCollections := context.WithCancel(context.Background())
 	return &CollectorScheduler{
-		ctx:        ctx,
-		table:      map[resourceReference]map[collector.MetricTypeName]context.CancelFunc{},
-		metricSink: metricsc,
+		collectionCtx:     collectionCtx,
+		cancelCollections: cancelCollections,
+		drained:           make(chan struct{}),
+		ctx:               ctx,
+		table:             map[resourceReference]map[collector.MetricTypeName]context.CancelFunc{},
+		shared:            map[string]*sharedCollector{},
+		collectors:        map[resourceReference]map[collector.MetricTypeName]*scheduledCollector{},
+		queue:             newCollectionQueue(),
+		highPriority:      map[resourceReference]bool{},
+		metricSink:        metricsc,
+		started:           time.Now(),
+		health:            newCollectorHealthRegistry(),
+	}
+}
+
+// startDelay returns the delay of the first collection of a collector with
+// the interval. Collectors added within one interval of the scheduler start,
+// i.e. when the adapter starts or becomes the leader, are spread randomly
+// over the jitter fraction of their interval, such that they don't collect
+// in lockstep. Collectors added later collect right away.
+func (t *CollectorScheduler) startDelay(interval time.Duration) time.Duration {
+	if t.jitter <= 0 || time.Since(t.started) >= interval {
+		return 0
 	}
+	return time.Duration(rand.Float64() * t.jitter * float64(interval))
 }
 
 // Add adds a new collector to the collector scheduler. Once the collector is
 // added it will be started to collect metrics.
-func (t *CollectorScheduler) Add(resourceRef resourceReference, typeName collector.MetricTypeName, metricCollector collector.Collector) {
+func (t *CollectorScheduler) Add(resourceRef resourceReference, config *collector.MetricConfig, metricCollector collector.Collector) {
+	t.Lock()
+	defer t.Unlock()
+
+	collectors, ok := t.table[resourceRef]
+	if !ok {
+		collectors = map[collector.MetricTypeName]context.CancelFunc{}
+		t.table[resourceRef] = collectors
+	}
+
+	if cancelCollector, ok := collectors[config.MetricTypeName]; ok {
+		// stop old collector
+		cancelCollector()
+	}
+
+	// schedule new collector
+	scheduled := t.schedule(resourceRef, config, metricCollector, nil)
+	collectors[config.MetricTypeName] = func() {
+		t.stop(scheduled)
+	}
+	t.setCollector(resourceRef, config, scheduled)
+}
+
+// AddShared adds a collector which is shared by all HPAs adding a collector
+// with the same key and interval, see collector.SharedCollectorKey. The
+// collector of the first HPA is started and the collectors of further HPAs
+// are only referenced. The shared collector is stopped once it was removed
+// for all HPAs.
+func (t *CollectorScheduler) AddShared(key string, resourceRef resourceReference, config *collector.MetricConfig, metricCollector collector.Collector) {
 	t.Lock()
 	defer t.Unlock()
 
@@ -288,36 +1055,115 @@ func (t *CollectorScheduler) Add(resourceRef resourceReference, typeName collect
 		t.table[resourceRef] = collectors
 	}
 
-	if cancelCollector, ok := collectors[typeName]; ok {
+	if cancelCollector, ok := collectors[config.MetricTypeName]; ok {
 		// stop old collector
 		cancelCollector()
 	}
 
-	ctx, cancel := context.WithCancel(t.ctx)
-	collectors[typeName] = cancel
+	key += "/" + metricCollector.Interval().String()
+	shared, ok := t.shared[key]
+	if !ok {
+		shared = &sharedCollector{}
+		t.shared[key] = shared
+
+		shared.collector = t.schedule(resourceRef, config, metricCollector, func() []resourceReference {
+			t.RLock()
+			defer t.RUnlock()
+			return append([]resourceReference(nil), shared.refs...)
+		})
+	} else {
+		glog.V(1).Infof("Sharing collector of metric '%s' with %d other HPA(s)", config.Name, len(shared.refs))
+	}
 
-	// start runner for new collector
-	go collectorRunner(ctx, metricCollector, t.metricSink)
+	shared.refs = append(shared.refs, resourceRef)
+	t.setCollector(resourceRef, config, shared.collector)
+	collectors[config.MetricTypeName] = func() {
+		t.release(key, resourceRef)
+	}
 }
 
-// collectorRunner runs a collector at the desirec interval. If the passed
-// context is canceled the collection will be stopped.
-func collectorRunner(ctx context.Context, collector collector.Collector, metricsc chan<- metricCollection) {
-	for {
-		values, err := collector.GetMetrics()
+// release removes the reference of an HPA to a shared collector and stops
+// the collector if it's no longer referenced. The caller must hold the
+// write lock.
+func (t *CollectorScheduler) release(key string, resourceRef resourceReference) {
+	shared, ok := t.shared[key]
+	if !ok {
+		return
+	}
 
-		metricsc <- metricCollection{
-			Values: values,
-			Error:  err,
+	for i, ref := range shared.refs {
+		if ref == resourceRef {
+			shared.refs = append(shared.refs[:i], shared.refs[i+1:]...)
+			break
 		}
+	}
 
-		select {
-		case <-time.After(collector.Interval()):
-		case <-ctx.Done():
-			glog.V(2).Infof("stopping collector runner...")
-			return
-		}
+	if len(shared.refs) == 0 {
+		t.stop(shared.collector)
+		delete(t.shared, key)
+	}
+}
+
+// Len returns the number of HPAs with scheduled collectors.
+func (t *CollectorScheduler) Len() int {
+	t.RLock()
+	defer t.RUnlock()
+	return len(t.table)
+}
+
+// acquire waits for a free collection slot if the number of simultaneous
+// collections is limited. Collectors of high priority HPAs get a slot
+// first. It returns false if the context was canceled while waiting.
+func (t *CollectorScheduler) acquire(ctx context.Context, refs []resourceReference) bool {
+	if t.slots == nil {
+		return true
+	}
+	return t.slots.acquire(ctx, t.isHighPriority(refs))
+}
+
+// releaseSlot frees the collection slot taken by acquire.
+func (t *CollectorScheduler) releaseSlot() {
+	if t.slots != nil {
+		t.slots.release()
+	}
+}
+
+// collectorBackoff returns the time to wait before the next collection of a
+// collector which failed the number of times in a row. The interval is
+// doubled for each failure after the first, up to the max backoff. The
+// interval is never shortened and backoff is disabled if the max backoff is
+// 0.
+func collectorBackoff(interval time.Duration, failures int, maxBackoff time.Duration) time.Duration {
+	wait := interval
+	for i := 1; i < failures && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxBackoff && maxBackoff > interval {
+		wait = maxBackoff
+	}
+	return wait
+}
+
+// RemoveMetric stops and removes the collector of a metric of an HPA. It
+// returns false if no collector of the metric was scheduled.
+func (t *CollectorScheduler) RemoveMetric(resourceRef resourceReference, metric collector.MetricTypeName) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	collectors, ok := t.table[resourceRef]
+	if !ok {
+		return false
 	}
+
+	cancelCollector, ok := collectors[metric]
+	if !ok {
+		return false
+	}
+
+	cancelCollector()
+	delete(collectors, metric)
+	delete(t.collectors[resourceRef], metric)
+	return true
 }
 
 // Remove removes a collector from the Collector schduler. The collector is
@@ -332,4 +1178,6 @@ func (t *CollectorScheduler) Remove(resourceRef resourceReference) {
 		}
 		delete(t.table, resourceRef)
 	}
+	delete(t.collectors, resourceRef)
+	delete(t.highPriority, resourceRef)
 }
@@ -0,0 +1,263 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/golang/glog"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// hpaGetter gets an HPA from an informer cache as autoscaling/v2 HPA.
+type hpaGetter func(namespace, name string) (*autoscalingv2.HorizontalPodAutoscaler, error)
+
+// newHPAInformer returns an informer for the HPAs of the newest autoscaling
+// API served by the cluster, autoscaling/v2, autoscaling/v2beta2 or
+// autoscaling/v2beta1, and a getter for HPAs from its cache. HPAs of the
+// beta APIs are converted to autoscaling/v2 such that the rest of the adapter
+// only deals with one API version.
+func newHPAInformer(client kubernetes.Interface, factory informers.SharedInformerFactory) (cache.SharedIndexInformer, hpaGetter, error) {
+	version, err := servedHPAVersion(client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	glog.Infof("Using %s HPAs", version)
+
+	switch version {
+	case autoscalingv2.SchemeGroupVersion:
+		hpaInformer := factory.Autoscaling().V2().HorizontalPodAutoscalers()
+		lister := hpaInformer.Lister()
+		return hpaInformer.Informer(), func(namespace, name string) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+			hpa, err := lister.HorizontalPodAutoscalers(namespace).Get(name)
+			if err != nil {
+				return nil, err
+			}
+			return hpa.DeepCopy(), nil
+		}, nil
+	case autoscalingv2beta2.SchemeGroupVersion:
+		hpaInformer := factory.Autoscaling().V2beta2().HorizontalPodAutoscalers()
+		lister := hpaInformer.Lister()
+		return hpaInformer.Informer(), func(namespace, name string) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+			hpa, err := lister.HorizontalPodAutoscalers(namespace).Get(name)
+			if err != nil {
+				return nil, err
+			}
+			return ConvertV2beta2HPA(hpa)
+		}, nil
+	default:
+		hpaInformer := factory.Autoscaling().V2beta1().HorizontalPodAutoscalers()
+		lister := hpaInformer.Lister()
+		return hpaInformer.Informer(), func(namespace, name string) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+			hpa, err := lister.HorizontalPodAutoscalers(namespace).Get(name)
+			if err != nil {
+				return nil, err
+			}
+			return ConvertV2beta1HPA(hpa), nil
+		}, nil
+	}
+}
+
+// servedHPAVersion returns the newest autoscaling API version defining
+// metrics served by the cluster. autoscaling/v2beta1 is assumed if neither
+// autoscaling/v2 nor autoscaling/v2beta2 are served.
+func servedHPAVersion(client kubernetes.Interface) (schema.GroupVersion, error) {
+	for _, version := range []schema.GroupVersion{autoscalingv2.SchemeGroupVersion, autoscalingv2beta2.SchemeGroupVersion} {
+		served, err := servesGroupVersion(client, version.String())
+		if err != nil {
+			return schema.GroupVersion{}, err
+		}
+		if served {
+			return version, nil
+		}
+	}
+	return autoscalingv2beta1.SchemeGroupVersion, nil
+}
+
+// servesGroupVersion returns true if the API server serves the group
+// version.
+func servesGroupVersion(client kubernetes.Interface, groupVersion string) (bool, error) {
+	_, err := client.Discovery().ServerResourcesForGroupVersion(groupVersion)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ConvertV2beta2HPA converts an autoscaling/v2beta2 HPA to autoscaling/v2.
+// The two versions are structurally identical, so the conversion is done by
+// a JSON round trip.
+func ConvertV2beta2HPA(hpa *autoscalingv2beta2.HorizontalPodAutoscaler) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	data, err := json.Marshal(hpa)
+	if err != nil {
+		return nil, err
+	}
+
+	var converted autoscalingv2.HorizontalPodAutoscaler
+	err = json.Unmarshal(data, &converted)
+	if err != nil {
+		return nil, err
+	}
+
+	converted.APIVersion = autoscalingv2.SchemeGroupVersion.String()
+	converted.Kind = "HorizontalPodAutoscaler"
+	return &converted, nil
+}
+
+// ConvertV2beta1HPA converts an autoscaling/v2beta1 HPA to autoscaling/v2.
+// The metric targets of autoscaling/v2beta1 are defined by the field set,
+// e.g. targetAverageValue, which is mapped to the target type of
+// autoscaling/v2. The current metrics of the status aren't converted.
+func ConvertV2beta1HPA(hpa *autoscalingv2beta1.HorizontalPodAutoscaler) *autoscalingv2.HorizontalPodAutoscaler {
+	// don't share any fields with the shared informer cache.
+	hpa = hpa.DeepCopy()
+
+	converted := &autoscalingv2.HorizontalPodAutoscaler{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: autoscalingv2.SchemeGroupVersion.String(),
+			Kind:       "HorizontalPodAutoscaler",
+		},
+		ObjectMeta: hpa.ObjectMeta,
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference(hpa.Spec.ScaleTargetRef),
+			MinReplicas:    hpa.Spec.MinReplicas,
+			MaxReplicas:    hpa.Spec.MaxReplicas,
+			Metrics:        make([]autoscalingv2.MetricSpec, 0, len(hpa.Spec.Metrics)),
+		},
+		Status: autoscalingv2.HorizontalPodAutoscalerStatus{
+			ObservedGeneration: hpa.Status.ObservedGeneration,
+			LastScaleTime:      hpa.Status.LastScaleTime,
+			CurrentReplicas:    hpa.Status.CurrentReplicas,
+			DesiredReplicas:    hpa.Status.DesiredReplicas,
+		},
+	}
+
+	for _, condition := range hpa.Status.Conditions {
+		converted.Status.Conditions = append(converted.Status.Conditions, autoscalingv2.HorizontalPodAutoscalerCondition{
+			Type:               autoscalingv2.HorizontalPodAutoscalerConditionType(condition.Type),
+			Status:             condition.Status,
+			LastTransitionTime: condition.LastTransitionTime,
+			Reason:             condition.Reason,
+			Message:            condition.Message,
+		})
+	}
+
+	for _, metric := range hpa.Spec.Metrics {
+		converted.Spec.Metrics = append(converted.Spec.Metrics, convertV2beta1MetricSpec(metric))
+	}
+
+	return converted
+}
+
+// convertV2beta1MetricSpec converts an autoscaling/v2beta1 metric spec to
+// autoscaling/v2.
+func convertV2beta1MetricSpec(metric autoscalingv2beta1.MetricSpec) autoscalingv2.MetricSpec {
+	spec := autoscalingv2.MetricSpec{Type: autoscalingv2.MetricSourceType(metric.Type)}
+
+	switch {
+	case metric.Object != nil:
+		spec.Object = &autoscalingv2.ObjectMetricSource{
+			DescribedObject: autoscalingv2.CrossVersionObjectReference(metric.Object.Target),
+			Metric:          autoscalingv2.MetricIdentifier{Name: metric.Object.MetricName, Selector: metric.Object.Selector},
+			Target:          averageOrValueTarget(metric.Object.AverageValue, &metric.Object.TargetValue),
+		}
+	case metric.Pods != nil:
+		spec.Pods = &autoscalingv2.PodsMetricSource{
+			Metric: autoscalingv2.MetricIdentifier{Name: metric.Pods.MetricName, Selector: metric.Pods.Selector},
+			Target: autoscalingv2.MetricTarget{Type: autoscalingv2.AverageValueMetricType, AverageValue: &metric.Pods.TargetAverageValue},
+		}
+	case metric.Resource != nil:
+		spec.Resource = &autoscalingv2.ResourceMetricSource{
+			Name:   metric.Resource.Name,
+			Target: utilizationOrAverageTarget(metric.Resource.TargetAverageUtilization, metric.Resource.TargetAverageValue),
+		}
+	case metric.ContainerResource != nil:
+		spec.ContainerResource = &autoscalingv2.ContainerResourceMetricSource{
+			Name:      metric.ContainerResource.Name,
+			Container: metric.ContainerResource.Container,
+			Target:    utilizationOrAverageTarget(metric.ContainerResource.TargetAverageUtilization, metric.ContainerResource.TargetAverageValue),
+		}
+	case metric.External != nil:
+		spec.External = &autoscalingv2.ExternalMetricSource{
+			Metric: autoscalingv2.MetricIdentifier{Name: metric.External.MetricName, Selector: metric.External.MetricSelector},
+			Target: averageOrValueTarget(metric.External.TargetAverageValue, metric.External.TargetValue),
+		}
+	}
+
+	return spec
+}
+
+// averageOrValueTarget returns an average value target if the average value
+// is set and a value target otherwise.
+func averageOrValueTarget(averageValue, value *resource.Quantity) autoscalingv2.MetricTarget {
+	if averageValue != nil {
+		return autoscalingv2.MetricTarget{Type: autoscalingv2.AverageValueMetricType, AverageValue: averageValue}
+	}
+	return autoscalingv2.MetricTarget{Type: autoscalingv2.ValueMetricType, Value: value}
+}
+
+// utilizationOrAverageTarget returns a utilization target if the utilization
+// is set and an average value target otherwise.
+func utilizationOrAverageTarget(utilization *int32, averageValue *resource.Quantity) autoscalingv2.MetricTarget {
+	if utilization != nil {
+		return autoscalingv2.MetricTarget{Type: autoscalingv2.UtilizationMetricType, AverageUtilization: utilization}
+	}
+	return autoscalingv2.MetricTarget{Type: autoscalingv2.AverageValueMetricType, AverageValue: averageValue}
+}
+
+// ListHPAs lists the HPAs in a namespace using the newest autoscaling API
+// served by the cluster. HPAs of all namespaces are listed if namespace is
+// "".
+func ListHPAs(client kubernetes.Interface, namespace string) ([]autoscalingv2.HorizontalPodAutoscaler, error) {
+	version, err := servedHPAVersion(client)
+	if err != nil {
+		return nil, err
+	}
+
+	switch version {
+	case autoscalingv2.SchemeGroupVersion:
+		hpas, err := client.AutoscalingV2().HorizontalPodAutoscalers(namespace).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return hpas.Items, nil
+	case autoscalingv2beta2.SchemeGroupVersion:
+		hpas, err := client.AutoscalingV2beta2().HorizontalPodAutoscalers(namespace).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		converted := make([]autoscalingv2.HorizontalPodAutoscaler, 0, len(hpas.Items))
+		for i := range hpas.Items {
+			hpa, err := ConvertV2beta2HPA(&hpas.Items[i])
+			if err != nil {
+				return nil, err
+			}
+			converted = append(converted, *hpa)
+		}
+		return converted, nil
+	default:
+		hpas, err := client.AutoscalingV2beta1().HorizontalPodAutoscalers(namespace).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		converted := make([]autoscalingv2.HorizontalPodAutoscaler, 0, len(hpas.Items))
+		for i := range hpas.Items {
+			converted = append(converted, *ConvertV2beta1HPA(&hpas.Items[i]))
+		}
+		return converted, nil
+	}
+}
@@ -0,0 +1,122 @@
+package provider
+
+import (
+	"testing"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestServedHPAVersion(t *testing.T) {
+	for _, tc := range []struct {
+		msg      string
+		served   []schema.GroupVersion
+		expected schema.GroupVersion
+	}{
+		{
+			msg:      "autoscaling/v2 served",
+			served:   []schema.GroupVersion{autoscalingv2.SchemeGroupVersion, autoscalingv2beta2.SchemeGroupVersion, autoscalingv2beta1.SchemeGroupVersion},
+			expected: autoscalingv2.SchemeGroupVersion,
+		},
+		{
+			msg:      "autoscaling/v2beta2 served",
+			served:   []schema.GroupVersion{autoscalingv2beta2.SchemeGroupVersion, autoscalingv2beta1.SchemeGroupVersion},
+			expected: autoscalingv2beta2.SchemeGroupVersion,
+		},
+		{
+			msg:      "only autoscaling/v2beta1 served",
+			served:   []schema.GroupVersion{autoscalingv2beta1.SchemeGroupVersion},
+			expected: autoscalingv2beta1.SchemeGroupVersion,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			for _, version := range tc.served {
+				client.Discovery().(*fakediscovery.FakeDiscovery).Resources = append(client.Discovery().(*fakediscovery.FakeDiscovery).Resources, &metav1.APIResourceList{
+					GroupVersion: version.String(),
+				})
+			}
+
+			version, err := servedHPAVersion(client)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if version != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, version)
+			}
+		})
+	}
+}
+
+func TestConvertV2beta1HPA(t *testing.T) {
+	utilization := int32(80)
+	averageValue := resource.MustParse("30")
+	value := resource.MustParse("10")
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"queue-name": "foobar"}}
+
+	hpa := ConvertV2beta1HPA(&autoscalingv2beta1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default", Annotations: map[string]string{"metric-config.external.queue-length.sqs/interval": "30s"}},
+		Spec: autoscalingv2beta1.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2beta1.CrossVersionObjectReference{Kind: "Deployment", Name: "app", APIVersion: "apps/v1"},
+			MaxReplicas:    10,
+			Metrics: []autoscalingv2beta1.MetricSpec{
+				{
+					Type: autoscalingv2beta1.PodsMetricSourceType,
+					Pods: &autoscalingv2beta1.PodsMetricSource{MetricName: "requests-per-second", TargetAverageValue: averageValue},
+				},
+				{
+					Type: autoscalingv2beta1.ObjectMetricSourceType,
+					Object: &autoscalingv2beta1.ObjectMetricSource{
+						Target:      autoscalingv2beta1.CrossVersionObjectReference{Kind: "Ingress", Name: "app", APIVersion: "networking.k8s.io/v1"},
+						MetricName:  "requests-per-second",
+						TargetValue: value,
+					},
+				},
+				{
+					Type:     autoscalingv2beta1.ExternalMetricSourceType,
+					External: &autoscalingv2beta1.ExternalMetricSource{MetricName: "queue-length", MetricSelector: selector, TargetAverageValue: &averageValue},
+				},
+				{
+					Type:              autoscalingv2beta1.ContainerResourceMetricSourceType,
+					ContainerResource: &autoscalingv2beta1.ContainerResourceMetricSource{Name: "cpu", Container: "app", TargetAverageUtilization: &utilization},
+				},
+			},
+		},
+	})
+
+	if hpa.Name != "hpa" || hpa.Namespace != "default" || len(hpa.Annotations) != 1 {
+		t.Errorf("expected the metadata to be kept, got %v", hpa.ObjectMeta)
+	}
+	if hpa.Spec.ScaleTargetRef.Name != "app" || hpa.Spec.MaxReplicas != 10 {
+		t.Errorf("expected the scale target and replicas to be kept, got %v", hpa.Spec)
+	}
+	if len(hpa.Spec.Metrics) != 4 {
+		t.Fatalf("expected 4 metrics, got %d", len(hpa.Spec.Metrics))
+	}
+
+	pods := hpa.Spec.Metrics[0].Pods
+	if pods.Metric.Name != "requests-per-second" || pods.Target.Type != autoscalingv2.AverageValueMetricType || pods.Target.AverageValue.Cmp(averageValue) != 0 {
+		t.Errorf("unexpected pods metric %v", pods)
+	}
+
+	object := hpa.Spec.Metrics[1].Object
+	if object.DescribedObject.Kind != "Ingress" || object.Target.Type != autoscalingv2.ValueMetricType || object.Target.Value.Cmp(value) != 0 {
+		t.Errorf("unexpected object metric %v", object)
+	}
+
+	external := hpa.Spec.Metrics[2].External
+	if external.Metric.Selector.MatchLabels["queue-name"] != "foobar" || external.Target.Type != autoscalingv2.AverageValueMetricType {
+		t.Errorf("unexpected external metric %v", external)
+	}
+
+	containerResource := hpa.Spec.Metrics[3].ContainerResource
+	if containerResource.Container != "app" || containerResource.Target.Type != autoscalingv2.UtilizationMetricType || *containerResource.Target.AverageUtilization != utilization {
+		t.Errorf("unexpected container resource metric %v", containerResource)
+	}
+}
@@ -0,0 +1,74 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestKindToResource(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "networking.k8s.io/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "ingresses", Kind: "Ingress", Namespaced: true},
+			},
+		},
+		{
+			GroupVersion: "zalando.org/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "routegroups", Kind: "RouteGroup", Namespaced: true},
+				{Name: "policies", Kind: "Policy", Namespaced: true},
+			},
+		},
+	}
+	p := NewHPAProvider(client, time.Minute, time.Minute, nil, nil)
+
+	for _, tc := range []struct {
+		msg      string
+		gvk      schema.GroupVersionKind
+		resource string
+		err      bool
+	}{
+		{
+			msg:      "kind ending with s",
+			gvk:      schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"},
+			resource: "ingresses",
+		},
+		{
+			msg:      "custom resource",
+			gvk:      schema.GroupVersionKind{Group: "zalando.org", Version: "v1", Kind: "RouteGroup"},
+			resource: "routegroups",
+		},
+		{
+			msg:      "irregular plural",
+			gvk:      schema.GroupVersionKind{Group: "zalando.org", Version: "v1", Kind: "Policy"},
+			resource: "policies",
+		},
+		{
+			msg: "unknown kind",
+			gvk: schema.GroupVersionKind{Group: "zalando.org", Version: "v1", Kind: "Unknown"},
+			err: true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			resource, err := p.kindToResource(tc.gvk)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error, got %s", resource)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resource != tc.resource {
+				t.Errorf("expected resource %s, got %s", tc.resource, resource)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package provider
+
+import (
+	"time"
+
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// interpolationPolicy defines how a single missed collection of a metric is
+// filled in from the trend of the previous values. The fields are exported
+// such that the policy can be stored along with the metric in a shared
+// metric store.
+type interpolationPolicy struct {
+	Interval time.Duration `json:"interval"`
+	Mode     string        `json:"mode"`
+}
+
+// newInterpolationPolicy returns the interpolation policy of a metric config
+// or nil if none is configured. The collector interval is used if the
+// config doesn't define an interval.
+func newInterpolationPolicy(config *collector.MetricConfig, collectorInterval time.Duration) *interpolationPolicy {
+	if config == nil || config.Interpolation == "" {
+		return nil
+	}
+
+	interval := config.Interval
+	if interval == 0 {
+		interval = collectorInterval
+	}
+
+	return &interpolationPolicy{
+		Interval: interval,
+		Mode:     config.Interpolation,
+	}
+}
+
+// grace returns how late a collection may be before it's considered missed,
+// such that collections delayed by jitter or slow backends don't make the
+// served value jump.
+func (p *interpolationPolicy) grace() time.Duration {
+	return p.Interval / 2
+}
+
+// ttl returns the TTL of a metric collected at the specified time, extended
+// such that the metric doesn't expire before the missed collection was
+// filled in.
+func (p *interpolationPolicy) ttl(ttl, collected time.Time) time.Time {
+	if p == nil {
+		return ttl
+	}
+
+	filled := collected.Add(2*p.Interval + p.grace())
+	if ttl.Before(filled) {
+		return filled
+	}
+	return ttl
+}
+
+// previous returns the sample of the stored value the trend is computed
+// from when the next value is collected. It returns nil if no policy is
+// configured or no value was stored.
+func (p *interpolationPolicy) previous(value resource.Quantity, collected time.Time) *metricSample {
+	if p == nil || collected.IsZero() {
+		return nil
+	}
+	return &metricSample{MilliValue: value.MilliValue(), Time: collected}
+}
+
+// value returns the value of a metric collected at the specified time. If
+// the collection after it is overdue by more than the grace period, the
+// value expected at the current time is extrapolated from the trend between
+// the previous and the collected value for the duration of one interval.
+// Afterwards the collected value is served as is. Non-negative metrics
+// aren't extrapolated below 0.
+func (p *interpolationPolicy) value(value resource.Quantity, previous *metricSample, collected, now time.Time) resource.Quantity {
+	if p == nil || previous == nil || !previous.Time.Before(collected) {
+		return value
+	}
+
+	elapsed := now.Sub(collected)
+	if elapsed < p.Interval+p.grace() || elapsed >= 2*p.Interval+p.grace() {
+		return value
+	}
+
+	current := value.MilliValue()
+	slope := float64(current-previous.MilliValue) / float64(collected.Sub(previous.Time))
+	extrapolated := int64(float64(current) + slope*float64(elapsed))
+	if extrapolated < 0 && current >= 0 && previous.MilliValue >= 0 {
+		extrapolated = 0
+	}
+
+	return *resource.NewMilliQuantity(extrapolated, value.Format)
+}
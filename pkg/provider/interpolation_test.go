@@ -0,0 +1,105 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestInterpolationPolicyValue(t *testing.T) {
+	collected := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	policy := &interpolationPolicy{Interval: 30 * time.Second, Mode: "linear"}
+	rising := &metricSample{MilliValue: 80000, Time: collected.Add(-30 * time.Second)}
+
+	for _, tc := range []struct {
+		msg      string
+		policy   *interpolationPolicy
+		previous *metricSample
+		value    int64
+		elapsed  time.Duration
+		expected int64
+	}{
+		{
+			msg:      "no policy",
+			previous: rising,
+			value:    100,
+			elapsed:  time.Minute,
+			expected: 100,
+		},
+		{
+			msg:      "next collection not due",
+			policy:   policy,
+			previous: rising,
+			value:    100,
+			elapsed:  10 * time.Second,
+			expected: 100,
+		},
+		{
+			msg:      "next collection within the grace period",
+			policy:   policy,
+			previous: rising,
+			value:    100,
+			elapsed:  40 * time.Second,
+			expected: 100,
+		},
+		{
+			msg:      "missed collection projected to the current time",
+			policy:   policy,
+			previous: rising,
+			value:    100,
+			elapsed:  time.Minute,
+			expected: 140,
+		},
+		{
+			msg:      "missed collection at the end of the grace period",
+			policy:   policy,
+			previous: rising,
+			value:    100,
+			elapsed:  45 * time.Second,
+			expected: 130,
+		},
+		{
+			msg:      "several missed collections",
+			policy:   policy,
+			previous: rising,
+			value:    100,
+			elapsed:  75 * time.Second,
+			expected: 100,
+		},
+		{
+			msg:      "no previous value",
+			policy:   policy,
+			value:    100,
+			elapsed:  time.Minute,
+			expected: 100,
+		},
+		{
+			msg:      "non-negative metric not extrapolated below 0",
+			policy:   policy,
+			previous: &metricSample{MilliValue: 30000, Time: collected.Add(-30 * time.Second)},
+			value:    10,
+			elapsed:  time.Minute,
+			expected: 0,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			value := tc.policy.value(*resource.NewQuantity(tc.value, resource.DecimalSI), tc.previous, collected, collected.Add(tc.elapsed))
+			if value.Value() != tc.expected {
+				t.Errorf("expected value %d, got %s", tc.expected, value.String())
+			}
+		})
+	}
+}
+
+func TestInterpolationPolicyTTL(t *testing.T) {
+	collected := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	policy := &interpolationPolicy{Interval: 30 * time.Second, Mode: "linear"}
+
+	if ttl := policy.ttl(collected.Add(time.Minute), collected); !ttl.Equal(collected.Add(75 * time.Second)) {
+		t.Errorf("expected TTL to be extended to the end of the interpolation, got %s", ttl)
+	}
+	if ttl := policy.ttl(collected.Add(time.Hour), collected); !ttl.Equal(collected.Add(time.Hour)) {
+		t.Errorf("expected longer TTL to be kept, got %s", ttl)
+	}
+}
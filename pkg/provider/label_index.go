@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// labelIndex is an inverted index from the label pairs of the series of a
+// metric to the ids of the series, such that selector lookups only need to
+// look at the series matching the equality requirements of the selector.
+type labelIndex map[string]map[string]map[string]struct{}
+
+// labelPair returns the index key of a label.
+func labelPair(key, value string) string {
+	return key + "=" + value
+}
+
+// add adds a series of a metric with its labels to the index.
+func (i labelIndex) add(metricName, id string, seriesLabels map[string]string) {
+	pairs, ok := i[metricName]
+	if !ok {
+		pairs = make(map[string]map[string]struct{})
+		i[metricName] = pairs
+	}
+
+	for key, value := range seriesLabels {
+		pair := labelPair(key, value)
+		ids, ok := pairs[pair]
+		if !ok {
+			ids = make(map[string]struct{})
+			pairs[pair] = ids
+		}
+		ids[id] = struct{}{}
+	}
+}
+
+// remove removes a series of a metric with its labels from the index.
+func (i labelIndex) remove(metricName, id string, seriesLabels map[string]string) {
+	pairs, ok := i[metricName]
+	if !ok {
+		return
+	}
+
+	for key, value := range seriesLabels {
+		pair := labelPair(key, value)
+		if ids, ok := pairs[pair]; ok {
+			delete(ids, id)
+			if len(ids) == 0 {
+				delete(pairs, pair)
+			}
+		}
+	}
+
+	if len(pairs) == 0 {
+		delete(i, metricName)
+	}
+}
+
+// candidates returns the ids of the series of a metric which match the
+// equality requirements of the selector. Other requirements are not
+// evaluated, so the series must still be matched against the selector. It
+// returns false if the selector has no equality requirements, in which case
+// all series must be matched against the selector.
+func (i labelIndex) candidates(metricName string, selector labels.Selector) (map[string]struct{}, bool) {
+	requirements, selectable := selector.Requirements()
+	if !selectable {
+		return nil, false
+	}
+
+	var result map[string]struct{}
+	indexed := false
+	for _, requirement := range requirements {
+		switch requirement.Operator() {
+		case selection.Equals, selection.DoubleEquals, selection.In:
+		default:
+			continue
+		}
+
+		matching := make(map[string]struct{})
+		for value := range requirement.Values() {
+			for id := range i[metricName][labelPair(requirement.Key(), value)] {
+				if result == nil || hasID(result, id) {
+					matching[id] = struct{}{}
+				}
+			}
+		}
+
+		result = matching
+		indexed = true
+		if len(result) == 0 {
+			break
+		}
+	}
+
+	return result, indexed
+}
+
+// hasID returns true if the set contains the id.
+func hasID(ids map[string]struct{}, id string) bool {
+	_, ok := ids[id]
+	return ok
+}
@@ -0,0 +1,92 @@
+package provider
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// LeaderElectionConfig configures the leader election between multiple
+// adapter replicas.
+type LeaderElectionConfig struct {
+	// Namespace and Name of the Lease used as lock.
+	Namespace string
+	Name      string
+	// Identity of this replica, must be unique among all replicas.
+	Identity      string
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+// SetLeaderElection enables leader election for the provider. Only the
+// leader discovers HPAs and runs the metric collectors, while all replicas
+// serve the metrics API from their metric store.
+func (p *HPAProvider) SetLeaderElection(config *LeaderElectionConfig) {
+	p.leaderElection = config
+	p.health.setStandby(true)
+}
+
+// runLeaderElection runs the HPA resource discovery and metric collection
+// whenever the provider becomes the leader. It takes part in the election
+// again after losing the leadership until the context is canceled.
+func (p *HPAProvider) runLeaderElection(ctx context.Context) {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Namespace: p.leaderElection.Namespace,
+			Name:      p.leaderElection.Name,
+		},
+		Client: p.client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: p.leaderElection.Identity,
+		},
+	}
+
+	p.health.setStandby(true)
+
+	for {
+		elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   p.leaderElection.LeaseDuration,
+			RenewDeadline:   p.leaderElection.RenewDeadline,
+			RetryPeriod:     p.leaderElection.RetryPeriod,
+			ReleaseOnCancel: true,
+			Name:            p.leaderElection.Name,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					glog.Infof("Acquired leadership as %s, starting metric collection", p.leaderElection.Identity)
+					p.health.setStandby(false)
+					p.run(ctx)
+				},
+				OnStoppedLeading: func() {
+					glog.Infof("Lost leadership as %s, stopped metric collection", p.leaderElection.Identity)
+					p.health.setStandby(true)
+				},
+				OnNewLeader: func(identity string) {
+					if identity != p.leaderElection.Identity {
+						glog.Infof("New leader elected: %s", identity)
+					}
+				},
+			},
+		})
+		if err != nil {
+			glog.Errorf("Failed to set up leader election: %v", err)
+			return
+		}
+
+		// Run returns when the leadership is lost or the context is
+		// canceled.
+		elector.Run(ctx)
+
+		select {
+		case <-ctx.Done():
+			glog.Info("Stopped leader election.")
+			return
+		default:
+		}
+	}
+}
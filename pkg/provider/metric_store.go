@@ -1,134 +1,498 @@
 package provider
 
 import (
+	"container/list"
 	"fmt"
+	"math"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/kubernetes-incubator/custom-metrics-apiserver/pkg/provider"
 	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
-	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/metrics/pkg/apis/custom_metrics"
 	"k8s.io/metrics/pkg/apis/external_metrics"
+	"sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
 )
 
 // customMetricsStoredMetric is a wrapper around custom_metrics.MetricValue with a TTL used
 // to clean up stale metrics from the customMetricsStore.
 type customMetricsStoredMetric struct {
-	Value  custom_metrics.MetricValue
-	Labels map[string]string
-	TTL    time.Time
+	Value     custom_metrics.MetricValue
+	Labels    map[string]string
+	TTL       time.Time
+	Collected time.Time
+	Staleness *stalenessPolicy
+	Smoothing *smoothingPolicy
+	Samples   []metricSample
+	// Interpolation fills in a missed collection from the trend between
+	// the Previous value and the current one.
+	Interpolation *interpolationPolicy
+	Previous      *metricSample
+}
+
+// served returns the value of the metric as served at the specified time.
+func (m customMetricsStoredMetric) served(now time.Time) custom_metrics.MetricValue {
+	value := m.Value
+	value.Value = m.Smoothing.value(value.Value, m.Samples, now)
+	value.Value = m.Interpolation.value(value.Value, m.Previous, m.Collected, now)
+	value.Value = m.Staleness.value(value.Value, m.Collected, now)
+	return value
 }
 
 type externalMetricsStoredMetric struct {
-	Value external_metrics.ExternalMetricValue
-	TTL   time.Time
+	Value     external_metrics.ExternalMetricValue
+	TTL       time.Time
+	Collected time.Time
+	Staleness *stalenessPolicy
+	Smoothing *smoothingPolicy
+	Samples   []metricSample
+	// Interpolation fills in a missed collection from the trend between
+	// the Previous value and the current one.
+	Interpolation *interpolationPolicy
+	Previous      *metricSample
+}
+
+// served returns the value of the metric as served at the specified time.
+func (m externalMetricsStoredMetric) served(now time.Time) external_metrics.ExternalMetricValue {
+	value := m.Value
+	value.Value = m.Smoothing.value(value.Value, m.Samples, now)
+	value.Value = m.Interpolation.value(value.Value, m.Previous, m.Collected, now)
+	value.Value = m.Staleness.value(value.Value, m.Collected, now)
+	return value
+}
+
+// defaultExpiredMetricRetention defines for how long the store remembers
+// that a metric expired by default.
+const defaultExpiredMetricRetention = 1 * time.Hour
+
+// customMetricKey identifies a single custom metric in the store.
+type customMetricKey struct {
+	MetricName    string
+	GroupResource schema.GroupResource
+	Namespace     string
+	Name          string
+	// Selector is the metric selector the value was collected for.
+	Selector string
+}
+
+// customObjectKey identifies the values of a custom metric of an object in
+// its namespace. Values collected for different metric selectors of the
+// same object, e.g. by two HPAs, are stored side by side.
+type customObjectKey struct {
+	Name     string
+	Selector string
+}
+
+// expiredCustomMetric records the last value of a custom metric and when it
+// expired.
+type expiredCustomMetric struct {
+	Value     custom_metrics.MetricValue
+	Labels    map[string]string
+	ExpiredAt time.Time
+}
+
+// expiredExternalMetric records the last value of an external metric series
+// and when it expired.
+type expiredExternalMetric struct {
+	Value     external_metrics.ExternalMetricValue
+	ExpiredAt time.Time
 }
 
-// MetricStore is a simple in-memory Metrics Store for HPA metrics.
-type MetricStore struct {
-	customMetricsStore   map[string]map[schema.GroupResource]map[string]map[string]customMetricsStoredMetric
+// MetricStore stores the collected metrics and serves them to the metrics
+// APIs.
+type MetricStore interface {
+	// Insert inserts a collected metric into the store. The config of
+	// the metric defines how the value is stored, it may be nil.
+	Insert(value collector.CollectedMetric, config *collector.MetricConfig)
+	// InsertAll inserts all metrics of a collection into the store.
+	InsertAll(values []collector.CollectedMetric, config *collector.MetricConfig)
+	// GetMetricsBySelector gets the custom metrics of the resources
+	// matching the selector which were collected for the metric
+	// selector. If namespace is "" the resources of all namespaces are
+	// matched.
+	GetMetricsBySelector(metricName string, groupResource schema.GroupResource, namespace string, selector, metricSelector labels.Selector) *custom_metrics.MetricValueList
+	// GetMetricsByName gets the custom metric of a resource by name
+	// which was collected for the metric selector. If namespace is ""
+	// the resource is looked up in all namespaces.
+	GetMetricsByName(metricName string, groupResource schema.GroupResource, namespace, name string, metricSelector labels.Selector) *custom_metrics.MetricValue
+	// ExpiredCustomMetric returns the last value of a custom metric and
+	// the time it expired if it was collected before but is no longer
+	// served.
+	ExpiredCustomMetric(metricName string, groupResource schema.GroupResource, namespace, name string, metricSelector labels.Selector) (*custom_metrics.MetricValue, time.Time, bool)
+	// ExpiredCustomMetricsBySelector returns the last values of the
+	// expired custom metrics of the resources matching the selector and
+	// the time the most recently expired one expired.
+	ExpiredCustomMetricsBySelector(metricName string, groupResource schema.GroupResource, namespace string, selector, metricSelector labels.Selector) ([]custom_metrics.MetricValue, time.Time, bool)
+	// ListAllMetrics lists all custom metrics in the store.
+	ListAllMetrics() []provider.CustomMetricInfo
+	// GetExternalMetric gets the external metrics matching the
+	// selector.
+	GetExternalMetric(namespace string, metricName string, selector labels.Selector) (*external_metrics.ExternalMetricValueList, error)
+	// ExpiredExternalMetric returns the last values of the expired
+	// external metric series matching the selector and the time the most
+	// recently expired series expired.
+	ExpiredExternalMetric(metricName string, selector labels.Selector) ([]external_metrics.ExternalMetricValue, time.Time, bool)
+	// ListAllExternalMetrics lists all external metrics in the store.
+	ListAllExternalMetrics() []provider.ExternalMetricInfo
+	// ListStoredMetrics lists all metric series in the store for
+	// troubleshooting.
+	ListStoredMetrics() []StoredMetric
+	// Stored returns true if the series of a collected value is stored
+	// and hasn't expired.
+	Stored(value collector.CollectedMetric) bool
+	// RemoveExpired removes expired metrics from the store.
+	RemoveExpired()
+	// SetDefaultTTL sets the time metrics are served for after they were
+	// collected if their config defines neither a TTL nor a staleness
+	// policy.
+	SetDefaultTTL(ttl time.Duration)
+	// SetExpiredRetention sets the time expired metrics are kept in the
+	// store to report when they expired, before RemoveExpired removes
+	// them.
+	SetExpiredRetention(retention time.Duration)
+}
+
+// InMemoryMetricStore is a simple in-memory Metrics Store for HPA metrics.
+type InMemoryMetricStore struct {
+	customMetricsStore   map[string]map[schema.GroupResource]map[string]map[customObjectKey]customMetricsStoredMetric
 	externalMetricsStore map[string]map[string]externalMetricsStoredMetric
+	// expired metrics are remembered for a while to be able to tell
+	// metrics which expired apart from metrics which were never
+	// collected.
+	expiredCustomMetrics   map[customMetricKey]expiredCustomMetric
+	expiredExternalMetrics map[string]map[string]expiredExternalMetric
+	// collectorInterval is the interval of collectors which don't
+	// define one in their config.
+	collectorInterval time.Duration
+	// defaultTTL is the time metrics are served for which don't define
+	// a TTL or staleness policy in their config.
+	defaultTTL time.Duration
+	// expiredRetention is the time expired metrics are remembered for.
+	expiredRetention time.Duration
+	// the label indexes map the labels of the stored series to the
+	// series.
+	customLabelIndex   labelIndex
+	externalLabelIndex labelIndex
+	// lru orders the stored series from least to most recently
+	// collected to evict series when the store exceeds maxEntries or
+	// maxBytes.
+	lru        *list.List
+	entries    map[storeEntryKey]*list.Element
+	bytes      int
+	maxEntries int
+	maxBytes   int
 	sync.RWMutex
 }
 
-// NewMetricStore initializes an empty Metrics Store.
-func NewMetricStore() *MetricStore {
-	return &MetricStore{
-		customMetricsStore:   make(map[string]map[schema.GroupResource]map[string]map[string]customMetricsStoredMetric, 0),
-		externalMetricsStore: make(map[string]map[string]externalMetricsStoredMetric, 0),
+// NewInMemoryMetricStore initializes an empty in-memory Metrics Store. The
+// collector interval is the default interval of collectors used for
+// staleness policies.
+func NewInMemoryMetricStore(collectorInterval time.Duration) *InMemoryMetricStore {
+	return &InMemoryMetricStore{
+		collectorInterval:      collectorInterval,
+		defaultTTL:             defaultMetricTTL,
+		expiredRetention:       defaultExpiredMetricRetention,
+		customMetricsStore:     make(map[string]map[schema.GroupResource]map[string]map[customObjectKey]customMetricsStoredMetric, 0),
+		externalMetricsStore:   make(map[string]map[string]externalMetricsStoredMetric, 0),
+		expiredCustomMetrics:   make(map[customMetricKey]expiredCustomMetric),
+		expiredExternalMetrics: make(map[string]map[string]expiredExternalMetric),
+		customLabelIndex:       make(labelIndex),
+		externalLabelIndex:     make(labelIndex),
+		lru:                    list.New(),
+		entries:                make(map[storeEntryKey]*list.Element),
 	}
 }
 
-// Insert inserts a collected metric into the metric customMetricsStore.
-func (s *MetricStore) Insert(value collector.CollectedMetric) {
-	switch value.Type {
-	case autoscalingv2beta1.ObjectMetricSourceType, autoscalingv2beta1.PodsMetricSourceType:
-		s.insertCustomMetric(value.Custom, value.Labels)
-	case autoscalingv2beta1.ExternalMetricSourceType:
-		s.insertExternalMetric(value.External)
-	}
+// SetDefaultTTL sets the time metrics are served for after they were
+// collected if their config defines neither a TTL nor a staleness policy.
+func (s *InMemoryMetricStore) SetDefaultTTL(ttl time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.defaultTTL = ttl
 }
 
-// insertCustomMetric inserts a custom metric plus labels into the store.
-func (s *MetricStore) insertCustomMetric(value custom_metrics.MetricValue, labels map[string]string) {
+// SetExpiredRetention sets the time expired metrics are remembered for to
+// tell them apart from metrics which were never collected.
+func (s *InMemoryMetricStore) SetExpiredRetention(retention time.Duration) {
 	s.Lock()
 	defer s.Unlock()
 
-	// TODO: handle this mapping nicer
-	var groupResource schema.GroupResource
-	switch value.DescribedObject.Kind {
-	case "Pod":
-		groupResource = schema.GroupResource{
-			Resource: "pods",
-		}
-	case "Ingress":
-		groupResource = schema.GroupResource{
-			Resource: "ingresses",
-			Group:    "extensions",
-		}
+	s.expiredRetention = retention
+}
+
+// Insert inserts a collected metric into the metric customMetricsStore. The
+// config of the metric defines how the value is stored, it may be nil.
+func (s *InMemoryMetricStore) Insert(value collector.CollectedMetric, config *collector.MetricConfig) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.insert(value, config, time.Now().UTC())
+}
+
+// InsertAll inserts all metrics of a collection into the store. The store is
+// locked only once for all the metrics, which reduces lock contention
+// compared to inserting the metrics one by one. All metrics get the same TTL.
+func (s *InMemoryMetricStore) InsertAll(values []collector.CollectedMetric, config *collector.MetricConfig) {
+	if len(values) == 0 {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now().UTC()
+	for _, value := range values {
+		s.insert(value, config, now)
+	}
+}
+
+// Stored returns true if the series of a collected value is stored and
+// hasn't expired.
+func (s *InMemoryMetricStore) Stored(value collector.CollectedMetric) bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	now := time.Now().UTC()
+	if value.Type == autoscalingv2.ExternalMetricSourceType {
+		metric, ok := s.externalMetricsStore[value.External.MetricName][hashLabelMap(value.External.MetricLabels)]
+		return ok && metric.TTL.After(now)
+	}
+
+	object := value.Custom.DescribedObject
+	key := customObjectKey{Name: object.Name, Selector: valueSelector(value.Custom)}
+	metric, ok := s.customMetricsStore[value.Custom.Metric.Name][describedGroupResource(object)][object.Namespace][key]
+	return ok && metric.TTL.After(now)
+}
+
+// insert inserts a collected metric into the store. The caller must hold the
+// write lock.
+func (s *InMemoryMetricStore) insert(value collector.CollectedMetric, config *collector.MetricConfig, now time.Time) {
+	switch value.Type {
+	case autoscalingv2.ObjectMetricSourceType, autoscalingv2.PodsMetricSourceType:
+		s.insertCustomMetric(value.Custom, value.Labels, config, now)
+	case autoscalingv2.ExternalMetricSourceType:
+		s.insertExternalMetric(value.External, config, now)
 	}
+}
+
+// insertCustomMetric inserts a custom metric plus labels into the store.
+func (s *InMemoryMetricStore) insertCustomMetric(value custom_metrics.MetricValue, labels map[string]string, config *collector.MetricConfig, now time.Time) {
+	groupResource := describedGroupResource(value.DescribedObject)
 
+	staleness := newStalenessPolicy(config, s.collectorInterval)
 	metric := customMetricsStoredMetric{
-		Value:  value,
-		Labels: labels,
-		TTL:    time.Now().UTC().Add(15 * time.Minute), // TODO: make TTL configurable
+		Value:     value,
+		Labels:    labels,
+		TTL:       metricTTL(config, staleness, s.defaultTTL, now),
+		Collected: now,
+		Staleness: staleness,
 	}
 
-	metrics, ok := s.customMetricsStore[value.MetricName]
+	key := customMetricKey{
+		MetricName:    value.Metric.Name,
+		GroupResource: groupResource,
+		Namespace:     value.DescribedObject.Namespace,
+		Name:          value.DescribedObject.Name,
+		Selector:      valueSelector(value),
+	}
+	object := customObjectKey{Name: key.Name, Selector: key.Selector}
+	delete(s.expiredCustomMetrics, key)
+
+	metrics, ok := s.customMetricsStore[value.Metric.Name]
 	if !ok {
-		s.customMetricsStore[value.MetricName] = map[schema.GroupResource]map[string]map[string]customMetricsStoredMetric{
-			groupResource: map[string]map[string]customMetricsStoredMetric{
-				value.DescribedObject.Namespace: map[string]customMetricsStoredMetric{
-					value.DescribedObject.Name: metric,
-				},
-			},
-		}
-		return
+		metrics = make(map[schema.GroupResource]map[string]map[customObjectKey]customMetricsStoredMetric)
+		s.customMetricsStore[value.Metric.Name] = metrics
 	}
 
 	group, ok := metrics[groupResource]
 	if !ok {
-		metrics[groupResource] = map[string]map[string]customMetricsStoredMetric{
-			value.DescribedObject.Namespace: map[string]customMetricsStoredMetric{
-				value.DescribedObject.Name: metric,
-			},
-		}
+		group = make(map[string]map[customObjectKey]customMetricsStoredMetric)
+		metrics[groupResource] = group
 	}
 
 	namespace, ok := group[value.DescribedObject.Namespace]
 	if !ok {
-		group[value.DescribedObject.Namespace] = map[string]customMetricsStoredMetric{
-			value.DescribedObject.Name: metric,
+		namespace = make(map[customObjectKey]customMetricsStoredMetric)
+		group[value.DescribedObject.Namespace] = namespace
+	}
+
+	stored, ok := namespace[object]
+
+	metric.Smoothing = newSmoothingPolicy(config)
+	metric.Samples = metric.Smoothing.samples(stored.Samples, value.Value, now)
+	metric.Interpolation = newInterpolationPolicy(config, s.collectorInterval)
+	metric.Previous = metric.Interpolation.previous(stored.Value.Value, stored.Collected)
+	metric.TTL = metric.Interpolation.ttl(metric.TTL, now)
+
+	// keep the stored value if it's identical to the new one, only
+	// refreshing its freshness.
+	if ok && deduplicate(config, stored.Value.Value, value.Value) {
+		stored.Value.Timestamp = value.Timestamp
+		stored.TTL = metric.TTL
+		stored.Collected = metric.Collected
+		stored.Staleness = metric.Staleness
+		stored.Smoothing = metric.Smoothing
+		stored.Samples = metric.Samples
+		stored.Interpolation = metric.Interpolation
+		stored.Previous = metric.Previous
+		metric = stored
+	}
+
+	namespace[object] = metric
+
+	id := customMetricID(groupResource, key.Namespace, key.Name, key.Selector)
+	if ok {
+		s.customLabelIndex.remove(value.Metric.Name, id, stored.Labels)
+	}
+	s.customLabelIndex.add(value.Metric.Name, id, metric.Labels)
+
+	s.touch(storeEntryKey{customMetricKey: key}, customMetricSize(metric))
+}
+
+// customMetricID returns the id of a custom metric series, which is unique
+// among the series of a metric. The metric selector is last as it may
+// contain slashes.
+func customMetricID(groupResource schema.GroupResource, namespace, name, selector string) string {
+	id := groupResource.String() + "/" + namespace + "/" + name
+	if selector != "" {
+		id += "/" + selector
+	}
+	return id
+}
+
+// parseCustomMetricID parses the id of a custom metric series into its group
+// resource, namespace, name and metric selector.
+func parseCustomMetricID(id string) (schema.GroupResource, string, string, string, error) {
+	parts := strings.SplitN(id, "/", 4)
+	if len(parts) < 3 {
+		return schema.GroupResource{}, "", "", "", fmt.Errorf("invalid custom metric id '%s'", id)
+	}
+
+	var selector string
+	if len(parts) == 4 {
+		selector = parts[3]
+	}
+	return schema.ParseGroupResource(parts[0]), parts[1], parts[2], selector, nil
+}
+
+// valueSelector returns the metric selector a custom metric value was
+// collected for in the form it's stored under.
+func valueSelector(value custom_metrics.MetricValue) string {
+	if value.Metric.Selector == nil {
+		return ""
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(value.Metric.Selector)
+	if err != nil {
+		return metav1.FormatLabelSelector(value.Metric.Selector)
+	}
+	return selector.String()
+}
+
+// requestSelector returns the metric selector of a request in the form
+// values are stored under. Requests without a metric selector get the values
+// of metrics without a selector in the HPA.
+func requestSelector(metricSelector labels.Selector) string {
+	if metricSelector == nil {
+		return ""
+	}
+	return metricSelector.String()
+}
+
+// describedGroupResource returns the group resource a custom metric is
+// stored under for the object it describes.
+func describedGroupResource(object custom_metrics.ObjectReference) schema.GroupResource {
+	// TODO: handle this mapping nicer
+	var groupResource schema.GroupResource
+	switch object.Kind {
+	case "Pod":
+		groupResource = schema.GroupResource{
+			Resource: "pods",
+		}
+	case "Ingress":
+		// the group depends on the API version the HPA references
+		// the Ingress with, e.g. networking.k8s.io.
+		gv, _ := schema.ParseGroupVersion(object.APIVersion)
+		groupResource = schema.GroupResource{
+			Resource: "ingresses",
+			Group:    gv.Group,
 		}
 	}
+	return groupResource
+}
+
+// deduplicate returns true if the metric config enables deduplication and
+// the two values are identical within the configured epsilon.
+func deduplicate(config *collector.MetricConfig, stored, value resource.Quantity) bool {
+	if config == nil || !config.Deduplicate {
+		return false
+	}
 
-	namespace[value.DescribedObject.Name] = metric
+	diff := float64(stored.MilliValue()-value.MilliValue()) / 1000
+	return math.Abs(diff) <= config.DeduplicationEpsilon
 }
 
 // insertExternalMetric inserts an external metric into the store.
-func (s *MetricStore) insertExternalMetric(metric external_metrics.ExternalMetricValue) {
-	s.Lock()
-	defer s.Unlock()
-
+func (s *InMemoryMetricStore) insertExternalMetric(metric external_metrics.ExternalMetricValue, config *collector.MetricConfig, now time.Time) {
+	staleness := newStalenessPolicy(config, s.collectorInterval)
+	interpolation := newInterpolationPolicy(config, s.collectorInterval)
 	storedMetric := externalMetricsStoredMetric{
-		Value: metric,
-		TTL:   time.Now().UTC().Add(15 * time.Minute), // TODO: make TTL configurable
+		Value:         metric,
+		TTL:           interpolation.ttl(metricTTL(config, staleness, s.defaultTTL, now), now),
+		Collected:     now,
+		Staleness:     staleness,
+		Interpolation: interpolation,
 	}
 
 	labelsKey := hashLabelMap(metric.MetricLabels)
 
+	if expired, ok := s.expiredExternalMetrics[metric.MetricName]; ok {
+		delete(expired, labelsKey)
+		if len(expired) == 0 {
+			delete(s.expiredExternalMetrics, metric.MetricName)
+		}
+	}
+
 	if metrics, ok := s.externalMetricsStore[metric.MetricName]; ok {
+		stored, ok := metrics[labelsKey]
+		storedMetric.Smoothing = newSmoothingPolicy(config)
+		storedMetric.Samples = storedMetric.Smoothing.samples(stored.Samples, metric.Value, now)
+		storedMetric.Previous = interpolation.previous(stored.Value.Value, stored.Collected)
+
+		if ok && deduplicate(config, stored.Value.Value, metric.Value) {
+			stored.Value.Timestamp = metric.Timestamp
+			stored.TTL = storedMetric.TTL
+			stored.Collected = storedMetric.Collected
+			stored.Staleness = storedMetric.Staleness
+			stored.Smoothing = storedMetric.Smoothing
+			stored.Samples = storedMetric.Samples
+			stored.Interpolation = storedMetric.Interpolation
+			stored.Previous = storedMetric.Previous
+			storedMetric = stored
+		}
 		metrics[labelsKey] = storedMetric
 	} else {
+		storedMetric.Smoothing = newSmoothingPolicy(config)
+		storedMetric.Samples = storedMetric.Smoothing.samples(nil, metric.Value, now)
 		s.externalMetricsStore[metric.MetricName] = map[string]externalMetricsStoredMetric{
 			labelsKey: storedMetric,
 		}
 	}
+
+	s.externalLabelIndex.add(metric.MetricName, labelsKey, metric.MetricLabels)
+
+	s.touch(storeEntryKey{
+		customMetricKey: customMetricKey{MetricName: metric.MetricName},
+		External:        true,
+		LabelsKey:       labelsKey,
+	}, externalMetricSize(storedMetric))
 }
 
 // hashLabelMap converts a map into a sorted string to provide a stable
@@ -143,9 +507,11 @@ func hashLabelMap(labels map[string]string) string {
 }
 
 // GetMetricsBySelector gets metric from the customMetricsStore using a label selector to
-// find metrics for matching resources.
-func (s *MetricStore) GetMetricsBySelector(metricName string, groupResource schema.GroupResource, namespace string, selector labels.Selector) *custom_metrics.MetricValueList {
+// find metrics for matching resources. Only the values collected for the
+// metric selector are returned.
+func (s *InMemoryMetricStore) GetMetricsBySelector(metricName string, groupResource schema.GroupResource, namespace string, selector, metricSelector labels.Selector) *custom_metrics.MetricValueList {
 	matchedMetrics := make([]custom_metrics.MetricValue, 0)
+	objectSelector := requestSelector(metricSelector)
 
 	s.RLock()
 	defer s.RUnlock()
@@ -160,18 +526,33 @@ func (s *MetricStore) GetMetricsBySelector(metricName string, groupResource sche
 		return nil
 	}
 
-	if namespace == "" {
+	now := time.Now().UTC()
+
+	// only look at the series matching the equality requirements of the
+	// selector if there are any.
+	if ids, ok := s.customLabelIndex.candidates(metricName, selector); ok {
+		for id := range ids {
+			gr, ns, name, sel, err := parseCustomMetricID(id)
+			if err != nil || gr != groupResource || (namespace != "" && ns != namespace) || sel != objectSelector {
+				continue
+			}
+
+			if metric, ok := group[ns][customObjectKey{Name: name, Selector: sel}]; ok && metric.TTL.After(now) && selector.Matches(labels.Set(metric.Labels)) {
+				matchedMetrics = append(matchedMetrics, metric.served(now))
+			}
+		}
+	} else if namespace == "" {
 		for _, metricMap := range group {
-			for _, metric := range metricMap {
-				if selector.Matches(labels.Set(metric.Labels)) {
-					matchedMetrics = append(matchedMetrics, metric.Value)
+			for object, metric := range metricMap {
+				if object.Selector == objectSelector && metric.TTL.After(now) && selector.Matches(labels.Set(metric.Labels)) {
+					matchedMetrics = append(matchedMetrics, metric.served(now))
 				}
 			}
 		}
 	} else if metricMap, ok := group[namespace]; ok {
-		for _, metric := range metricMap {
-			if selector.Matches(labels.Set(metric.Labels)) {
-				matchedMetrics = append(matchedMetrics, metric.Value)
+		for object, metric := range metricMap {
+			if object.Selector == objectSelector && metric.TTL.After(now) && selector.Matches(labels.Set(metric.Labels)) {
+				matchedMetrics = append(matchedMetrics, metric.served(now))
 			}
 		}
 	}
@@ -179,9 +560,10 @@ func (s *MetricStore) GetMetricsBySelector(metricName string, groupResource sche
 	return &custom_metrics.MetricValueList{Items: matchedMetrics}
 }
 
-// GetMetricsByName looks up metrics in the customMetricsStore by resource name. If
-// namespace is "" if will look for the resource in all namespaces.
-func (s *MetricStore) GetMetricsByName(metricName string, groupResource schema.GroupResource, namespace, name string) *custom_metrics.MetricValue {
+// GetMetricsByName looks up metrics in the customMetricsStore by resource name
+// and metric selector. If namespace is "" if will look for the resource in
+// all namespaces.
+func (s *InMemoryMetricStore) GetMetricsByName(metricName string, groupResource schema.GroupResource, namespace, name string, metricSelector labels.Selector) *custom_metrics.MetricValue {
 	s.RLock()
 	defer s.RUnlock()
 
@@ -195,24 +577,102 @@ func (s *MetricStore) GetMetricsByName(metricName string, groupResource schema.G
 		return nil
 	}
 
+	now := time.Now().UTC()
+	object := customObjectKey{Name: name, Selector: requestSelector(metricSelector)}
+
 	if namespace == "" {
 		// TODO: rethink no namespace queries
 		for _, metricMap := range group {
-			if metric, ok := metricMap[name]; ok {
-				return &metric.Value
+			if metric, ok := metricMap[object]; ok && metric.TTL.After(now) {
+				value := metric.served(now)
+				return &value
 			}
 		}
 	} else if metricMap, ok := group[namespace]; ok {
-		if metric, ok := metricMap[name]; ok {
-			return &metric.Value
+		if metric, ok := metricMap[object]; ok && metric.TTL.After(now) {
+			value := metric.served(now)
+			return &value
 		}
 	}
 
 	return nil
 }
 
+// ExpiredCustomMetric returns the last value of a custom metric and the time
+// it expired if it was collected before but is no longer available in the
+// store. If namespace is "" it will look for the resource in all namespaces.
+func (s *InMemoryMetricStore) ExpiredCustomMetric(metricName string, groupResource schema.GroupResource, namespace, name string, metricSelector labels.Selector) (*custom_metrics.MetricValue, time.Time, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	now := time.Now().UTC()
+	object := customObjectKey{Name: name, Selector: requestSelector(metricSelector)}
+
+	// metrics past their TTL which have not yet been garbage collected
+	// are also considered expired.
+	if metrics, ok := s.customMetricsStore[metricName]; ok {
+		for ns, metricMap := range metrics[groupResource] {
+			if namespace != "" && ns != namespace {
+				continue
+			}
+			if metric, ok := metricMap[object]; ok && !metric.TTL.After(now) {
+				value := metric.Value
+				return &value, metric.TTL, true
+			}
+		}
+	}
+
+	for key, expired := range s.expiredCustomMetrics {
+		if key.MetricName == metricName && key.GroupResource == groupResource && key.Name == name && key.Selector == object.Selector && (namespace == "" || key.Namespace == namespace) {
+			value := expired.Value
+			return &value, expired.ExpiredAt, true
+		}
+	}
+
+	return nil, time.Time{}, false
+}
+
+// ExpiredCustomMetricsBySelector returns the last values of the expired
+// custom metrics of the resources matching the selector and the time the most
+// recently expired one expired. If namespace is "" the resources of all
+// namespaces are matched.
+func (s *InMemoryMetricStore) ExpiredCustomMetricsBySelector(metricName string, groupResource schema.GroupResource, namespace string, selector, metricSelector labels.Selector) ([]custom_metrics.MetricValue, time.Time, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	now := time.Now().UTC()
+	objectSelector := requestSelector(metricSelector)
+
+	var values []custom_metrics.MetricValue
+	var expiredAt time.Time
+	for ns, metricMap := range s.customMetricsStore[metricName][groupResource] {
+		if namespace != "" && ns != namespace {
+			continue
+		}
+		for object, metric := range metricMap {
+			if object.Selector == objectSelector && !metric.TTL.After(now) && selector.Matches(labels.Set(metric.Labels)) {
+				values = append(values, metric.Value)
+				if metric.TTL.After(expiredAt) {
+					expiredAt = metric.TTL
+				}
+			}
+		}
+	}
+
+	for key, expired := range s.expiredCustomMetrics {
+		if key.MetricName == metricName && key.GroupResource == groupResource && key.Selector == objectSelector && (namespace == "" || key.Namespace == namespace) && selector.Matches(labels.Set(expired.Labels)) {
+			values = append(values, expired.Value)
+			if expired.ExpiredAt.After(expiredAt) {
+				expiredAt = expired.ExpiredAt
+			}
+		}
+	}
+
+	return values, expiredAt, len(values) > 0
+}
+
 // ListAllMetrics lists all custom metrics in the Metrics Store.
-func (s *MetricStore) ListAllMetrics() []provider.CustomMetricInfo {
+func (s *InMemoryMetricStore) ListAllMetrics() []provider.CustomMetricInfo {
 	s.RLock()
 	defer s.RUnlock()
 
@@ -236,16 +696,28 @@ func (s *MetricStore) ListAllMetrics() []provider.CustomMetricInfo {
 
 // GetExternalMetric gets external metric from the store by metric name and
 // selector.
-func (s *MetricStore) GetExternalMetric(namespace string, metricName string, selector labels.Selector) (*external_metrics.ExternalMetricValueList, error) {
+func (s *InMemoryMetricStore) GetExternalMetric(namespace string, metricName string, selector labels.Selector) (*external_metrics.ExternalMetricValueList, error) {
 	matchedMetrics := make([]external_metrics.ExternalMetricValue, 0)
 
 	s.RLock()
 	defer s.RUnlock()
 
+	now := time.Now().UTC()
+
 	if metrics, ok := s.externalMetricsStore[metricName]; ok {
-		for _, metric := range metrics {
-			if selector.Matches(labels.Set(metric.Value.MetricLabels)) {
-				matchedMetrics = append(matchedMetrics, metric.Value)
+		// only look at the series matching the equality requirements
+		// of the selector if there are any.
+		if labelsKeys, ok := s.externalLabelIndex.candidates(metricName, selector); ok {
+			for labelsKey := range labelsKeys {
+				if metric, ok := metrics[labelsKey]; ok && metric.TTL.After(now) && selector.Matches(labels.Set(metric.Value.MetricLabels)) {
+					matchedMetrics = append(matchedMetrics, metric.served(now))
+				}
+			}
+		} else {
+			for _, metric := range metrics {
+				if metric.TTL.After(now) && selector.Matches(labels.Set(metric.Value.MetricLabels)) {
+					matchedMetrics = append(matchedMetrics, metric.served(now))
+				}
 			}
 		}
 	}
@@ -253,38 +725,90 @@ func (s *MetricStore) GetExternalMetric(namespace string, metricName string, sel
 	return &external_metrics.ExternalMetricValueList{Items: matchedMetrics}, nil
 }
 
+// ExpiredExternalMetric returns the last values of the expired external
+// metric series matching the selector and the time the most recently expired
+// series expired, if any series matching the selector was collected before
+// but is no longer available in the store.
+func (s *InMemoryMetricStore) ExpiredExternalMetric(metricName string, selector labels.Selector) ([]external_metrics.ExternalMetricValue, time.Time, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	now := time.Now().UTC()
+
+	var values []external_metrics.ExternalMetricValue
+	var expiredAt time.Time
+
+	for _, metric := range s.externalMetricsStore[metricName] {
+		if metric.TTL.After(now) {
+			continue
+		}
+
+		if selector.Matches(labels.Set(metric.Value.MetricLabels)) {
+			values = append(values, metric.Value)
+			if metric.TTL.After(expiredAt) {
+				expiredAt = metric.TTL
+			}
+		}
+	}
+
+	for _, expired := range s.expiredExternalMetrics[metricName] {
+		if selector.Matches(labels.Set(expired.Value.MetricLabels)) {
+			values = append(values, expired.Value)
+			if expired.ExpiredAt.After(expiredAt) {
+				expiredAt = expired.ExpiredAt
+			}
+		}
+	}
+
+	return values, expiredAt, len(values) > 0
+}
+
 // ListAllExternalMetrics lists all external metrics in the Metrics Store.
-func (s *MetricStore) ListAllExternalMetrics() []provider.ExternalMetricInfo {
+func (s *InMemoryMetricStore) ListAllExternalMetrics() []provider.ExternalMetricInfo {
 	s.RLock()
 	defer s.RUnlock()
 
 	metricsInfo := make([]provider.ExternalMetricInfo, 0, len(s.externalMetricsStore))
 
-	for metricName, metrics := range s.externalMetricsStore {
-		for _, metric := range metrics {
-			info := provider.ExternalMetricInfo{
-				Metric: metricName,
-				Labels: metric.Value.MetricLabels,
-			}
-			metricsInfo = append(metricsInfo, info)
+	for metricName := range s.externalMetricsStore {
+		info := provider.ExternalMetricInfo{
+			Metric: metricName,
 		}
+		metricsInfo = append(metricsInfo, info)
 	}
 	return metricsInfo
 }
 
 // RemoveExpired removes expired metrics from the Metrics Store. A metric is
 // considered expired if its TTL is before time.Now().
-func (s *MetricStore) RemoveExpired() {
+func (s *InMemoryMetricStore) RemoveExpired() {
 	s.Lock()
 	defer s.Unlock()
 
+	now := time.Now().UTC()
+
 	// cleanup custom metrics
 	for metricName, groups := range s.customMetricsStore {
 		for group, namespaces := range groups {
 			for namespace, resources := range namespaces {
-				for resource, metric := range resources {
-					if metric.TTL.Before(time.Now().UTC()) {
-						delete(resources, resource)
+				for object, metric := range resources {
+					if metric.TTL.Before(now) {
+						key := customMetricKey{
+							MetricName:    metricName,
+							GroupResource: group,
+							Namespace:     namespace,
+							Name:          object.Name,
+							Selector:      object.Selector,
+						}
+						s.expiredCustomMetrics[key] = expiredCustomMetric{
+							Value:     metric.Value,
+							Labels:    metric.Labels,
+							ExpiredAt: metric.TTL,
+						}
+						delete(resources, object)
+						s.customLabelIndex.remove(metricName, customMetricID(group, namespace, object.Name, object.Selector), metric.Labels)
+						s.forget(storeEntryKey{customMetricKey: key})
+						metricStoreExpirations.WithLabelValues(storeMetricTypeCustom).Inc()
 					}
 				}
 				if len(resources) == 0 {
@@ -303,12 +827,46 @@ func (s *MetricStore) RemoveExpired() {
 	// cleanup external metrics
 	for metricName, metrics := range s.externalMetricsStore {
 		for k, metric := range metrics {
-			if metric.TTL.Before(time.Now().UTC()) {
+			if metric.TTL.Before(now) {
+				expired, ok := s.expiredExternalMetrics[metricName]
+				if !ok {
+					expired = make(map[string]expiredExternalMetric)
+					s.expiredExternalMetrics[metricName] = expired
+				}
+				expired[k] = expiredExternalMetric{
+					Value:     metric.Value,
+					ExpiredAt: metric.TTL,
+				}
 				delete(metrics, k)
+				s.externalLabelIndex.remove(metricName, k, metric.Value.MetricLabels)
+				s.forget(storeEntryKey{
+					customMetricKey: customMetricKey{MetricName: metricName},
+					External:        true,
+					LabelsKey:       k,
+				})
+				metricStoreExpirations.WithLabelValues(storeMetricTypeExternal).Inc()
 			}
 		}
 		if len(metrics) == 0 {
 			delete(s.externalMetricsStore, metricName)
 		}
 	}
+
+	// forget about metrics which expired a long time ago
+	for key, expired := range s.expiredCustomMetrics {
+		if expired.ExpiredAt.Add(s.expiredRetention).Before(now) {
+			delete(s.expiredCustomMetrics, key)
+		}
+	}
+
+	for metricName, expired := range s.expiredExternalMetrics {
+		for k, metric := range expired {
+			if metric.ExpiredAt.Add(s.expiredRetention).Before(now) {
+				delete(expired, k)
+			}
+		}
+		if len(expired) == 0 {
+			delete(s.expiredExternalMetrics, metricName)
+		}
+	}
 }
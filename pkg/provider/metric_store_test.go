@@ -0,0 +1,345 @@
+package provider
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+)
+
+// podValue returns a collected pods metric of the pod with the value.
+func podValue(pod string, value int64, podLabels map[string]string) collector.CollectedMetric {
+	return collector.CollectedMetric{
+		Type: autoscalingv2.PodsMetricSourceType,
+		Custom: custom_metrics.MetricValue{
+			DescribedObject: custom_metrics.ObjectReference{Kind: "Pod", Namespace: "default", Name: pod},
+			Metric:          custom_metrics.MetricIdentifier{Name: "requests"},
+			Value:           *resource.NewQuantity(value, resource.DecimalSI),
+		},
+		Labels: podLabels,
+	}
+}
+
+// labeledExternalValue returns a collected external metric with the value
+// and labels.
+func labeledExternalValue(name string, value int64, metricLabels map[string]string) collector.CollectedMetric {
+	return collector.CollectedMetric{
+		Type: autoscalingv2.ExternalMetricSourceType,
+		External: external_metrics.ExternalMetricValue{
+			MetricName:   name,
+			MetricLabels: metricLabels,
+			Value:        *resource.NewQuantity(value, resource.DecimalSI),
+		},
+	}
+}
+
+func TestInMemoryMetricStore(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+	store := NewInMemoryMetricStore(time.Minute)
+	store.InsertAll([]collector.CollectedMetric{
+		podValue("pod-1", 1, map[string]string{"app": "foo"}),
+		podValue("pod-2", 2, map[string]string{"app": "foo"}),
+		podValue("pod-3", 3, map[string]string{"app": "bar"}),
+		labeledExternalValue("queue-length", 10, map[string]string{"queue": "foo"}),
+		labeledExternalValue("queue-length", 20, map[string]string{"queue": "bar"}),
+	}, &collector.MetricConfig{})
+
+	for _, tc := range []struct {
+		msg      string
+		get      func() []int64
+		expected []int64
+	}{
+		{
+			msg: "custom metric by name",
+			get: func() []int64 {
+				metric := store.GetMetricsByName("requests", pods, "default", "pod-2", labels.Everything())
+				if metric == nil {
+					return nil
+				}
+				return []int64{metric.Value.Value()}
+			},
+			expected: []int64{2},
+		},
+		{
+			msg: "unknown custom metric",
+			get: func() []int64 {
+				if store.GetMetricsByName("requests", pods, "default", "pod-4", labels.Everything()) != nil {
+					return []int64{0}
+				}
+				return nil
+			},
+		},
+		{
+			msg: "custom metrics by selector",
+			get: func() []int64 {
+				var values []int64
+				for _, metric := range store.GetMetricsBySelector("requests", pods, "default", labels.SelectorFromSet(labels.Set{"app": "foo"}), labels.Everything()).Items {
+					values = append(values, metric.Value.Value())
+				}
+				return values
+			},
+			expected: []int64{1, 2},
+		},
+		{
+			msg: "external metric by selector",
+			get: func() []int64 {
+				list, _ := store.GetExternalMetric("default", "queue-length", labels.SelectorFromSet(labels.Set{"queue": "bar"}))
+				var values []int64
+				for _, metric := range list.Items {
+					values = append(values, metric.Value.Value())
+				}
+				return values
+			},
+			expected: []int64{20},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			values := tc.get()
+			if len(values) != len(tc.expected) {
+				t.Fatalf("expected values %v, got %v", tc.expected, values)
+			}
+			found := map[int64]bool{}
+			for _, value := range values {
+				found[value] = true
+			}
+			for _, value := range tc.expected {
+				if !found[value] {
+					t.Errorf("expected values %v, got %v", tc.expected, values)
+				}
+			}
+		})
+	}
+}
+
+func TestInMemoryMetricStoreMetricSelector(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+	store := NewInMemoryMetricStore(time.Minute)
+
+	selectorValue := func(value int64, selector *metav1.LabelSelector) collector.CollectedMetric {
+		metric := podValue("pod-1", value, map[string]string{"app": "foo"})
+		metric.Custom.Metric.Selector = selector
+		return metric
+	}
+	store.InsertAll([]collector.CollectedMetric{
+		selectorValue(1, nil),
+		selectorValue(2, &metav1.LabelSelector{MatchLabels: map[string]string{"queue": "orders"}}),
+		selectorValue(3, &metav1.LabelSelector{MatchLabels: map[string]string{"example.com/queue": "orders"}}),
+	}, &collector.MetricConfig{})
+
+	for _, tc := range []struct {
+		msg      string
+		selector labels.Selector
+		expected int64
+	}{
+		{
+			msg:      "no metric selector",
+			selector: labels.Everything(),
+			expected: 1,
+		},
+		{
+			msg:      "metric selector",
+			selector: labels.SelectorFromSet(labels.Set{"queue": "orders"}),
+			expected: 2,
+		},
+		{
+			msg:      "metric selector with a slash",
+			selector: labels.SelectorFromSet(labels.Set{"example.com/queue": "orders"}),
+			expected: 3,
+		},
+		{
+			msg:      "unknown metric selector",
+			selector: labels.SelectorFromSet(labels.Set{"queue": "payments"}),
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			metric := store.GetMetricsByName("requests", pods, "default", "pod-1", tc.selector)
+			list := store.GetMetricsBySelector("requests", pods, "default", labels.SelectorFromSet(labels.Set{"app": "foo"}), tc.selector)
+			if tc.expected == 0 {
+				if metric != nil || len(list.Items) != 0 {
+					t.Errorf("expected no values, got %v and %v", metric, list.Items)
+				}
+				return
+			}
+
+			if metric == nil || metric.Value.Value() != tc.expected {
+				t.Errorf("expected value %d by name, got %v", tc.expected, metric)
+			}
+			if len(list.Items) != 1 || list.Items[0].Value.Value() != tc.expected {
+				t.Errorf("expected value %d by selector, got %v", tc.expected, list.Items)
+			}
+		})
+	}
+}
+
+func TestInMemoryMetricStoreExpiry(t *testing.T) {
+	store := NewInMemoryMetricStore(time.Minute)
+	store.Insert(labeledExternalValue("queue-length", 10, nil), &collector.MetricConfig{TTL: time.Nanosecond})
+	time.Sleep(time.Millisecond)
+
+	list, _ := store.GetExternalMetric("default", "queue-length", labels.Everything())
+	if len(list.Items) != 0 {
+		t.Errorf("expected expired metric not to be served, got %v", list.Items)
+	}
+
+	store.RemoveExpired()
+	if infos := store.ListAllExternalMetrics(); len(infos) != 0 {
+		t.Errorf("expected expired metric to be removed, got %v", infos)
+	}
+}
+
+func TestDeduplicate(t *testing.T) {
+	for _, tc := range []struct {
+		msg      string
+		config   *collector.MetricConfig
+		stored   string
+		value    string
+		expected bool
+	}{
+		{
+			msg:    "no config",
+			stored: "1",
+			value:  "1",
+		},
+		{
+			msg:    "disabled",
+			config: &collector.MetricConfig{},
+			stored: "1",
+			value:  "1",
+		},
+		{
+			msg:      "identical",
+			config:   &collector.MetricConfig{Deduplicate: true},
+			stored:   "1",
+			value:    "1",
+			expected: true,
+		},
+		{
+			msg:      "within epsilon",
+			config:   &collector.MetricConfig{Deduplicate: true, DeduplicationEpsilon: 0.5},
+			stored:   "1",
+			value:    "1500m",
+			expected: true,
+		},
+		{
+			msg:    "outside epsilon",
+			config: &collector.MetricConfig{Deduplicate: true, DeduplicationEpsilon: 0.5},
+			stored: "1",
+			value:  "1501m",
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			if result := deduplicate(tc.config, resource.MustParse(tc.stored), resource.MustParse(tc.value)); result != tc.expected {
+				t.Errorf("expected %t, got %t", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestInMemoryMetricStoreDeduplication(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+	store := NewInMemoryMetricStore(time.Minute)
+	config := &collector.MetricConfig{Deduplicate: true, DeduplicationEpsilon: 1}
+
+	first := podValue("pod-1", 10, nil)
+	first.Custom.Timestamp.Time = time.Now().Add(-time.Minute)
+	store.Insert(first, config)
+
+	second := podValue("pod-1", 11, nil)
+	second.Custom.Timestamp.Time = time.Now()
+	store.Insert(second, config)
+
+	metric := store.GetMetricsByName("requests", pods, "default", "pod-1", labels.Everything())
+	if metric == nil {
+		t.Fatal("expected stored metric")
+	}
+	if metric.Value.Value() != 10 {
+		t.Errorf("expected deduplicated value 10, got %s", metric.Value.String())
+	}
+	if !metric.Timestamp.Time.Equal(second.Custom.Timestamp.Time) {
+		t.Errorf("expected timestamp of the latest collection, got %s", metric.Timestamp)
+	}
+}
+
+func TestInMemoryMetricStoreConcurrentInsertAll(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+	store := NewInMemoryMetricStore(time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			store.InsertAll([]collector.CollectedMetric{
+				podValue(fmt.Sprintf("pod-%d", i), int64(i), map[string]string{"app": "foo"}),
+				labeledExternalValue("queue-length", int64(i), map[string]string{"queue": fmt.Sprintf("queue-%d", i)}),
+			}, &collector.MetricConfig{})
+		}(i)
+		go func() {
+			defer wg.Done()
+			store.GetMetricsBySelector("requests", pods, "default", labels.Everything(), labels.Everything())
+			store.GetExternalMetric("default", "queue-length", labels.Everything())
+		}()
+	}
+	wg.Wait()
+
+	if list := store.GetMetricsBySelector("requests", pods, "default", labels.Everything(), labels.Everything()); len(list.Items) != 10 {
+		t.Errorf("expected 10 pod metrics, got %d", len(list.Items))
+	}
+}
+
+// benchmarkValues returns a collection of the number of pod metrics.
+func benchmarkValues(n int) []collector.CollectedMetric {
+	values := make([]collector.CollectedMetric, 0, n)
+	for i := 0; i < n; i++ {
+		values = append(values, podValue(fmt.Sprintf("pod-%d", i), int64(i), map[string]string{"app": "foo"}))
+	}
+	return values
+}
+
+func BenchmarkInMemoryMetricStoreInsert(b *testing.B) {
+	store := NewInMemoryMetricStore(time.Minute)
+	values := benchmarkValues(100)
+	config := &collector.MetricConfig{}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, value := range values {
+			store.Insert(value, config)
+		}
+	}
+}
+
+func BenchmarkInMemoryMetricStoreInsertAll(b *testing.B) {
+	store := NewInMemoryMetricStore(time.Minute)
+	values := benchmarkValues(100)
+	config := &collector.MetricConfig{}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		store.InsertAll(values, config)
+	}
+}
+
+func BenchmarkInMemoryMetricStoreInsertAllParallel(b *testing.B) {
+	pods := schema.GroupResource{Resource: "pods"}
+	store := NewInMemoryMetricStore(time.Minute)
+	values := benchmarkValues(100)
+	config := &collector.MetricConfig{}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			store.InsertAll(values, config)
+			store.GetMetricsBySelector("requests", pods, "default", labels.Everything(), labels.Everything())
+		}
+	})
+}
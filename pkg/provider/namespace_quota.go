@@ -0,0 +1,199 @@
+package provider
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/api/core/v1"
+)
+
+// NamespaceQuota limits the number of collectors and stored metric series
+// per namespace, such that the HPAs of one namespace can't exhaust the
+// resources of the adapter. A limit of 0 disables it.
+type NamespaceQuota struct {
+	MaxCollectors int
+	MaxSeries     int
+
+	// series are the series stored for each collector by their key, by
+	// namespace.
+	series map[string]map[seriesOwner]map[string]collector.CollectedMetric
+	// rejected are the collectors whose last collection was rejected, to
+	// only report the rejection once.
+	rejected map[seriesOwner]bool
+	// rejectedHPAs are the HPAs which were rejected for exceeding the
+	// collector limit, to only report the rejection once.
+	rejectedHPAs map[resourceReference]bool
+	sync.Mutex
+}
+
+// seriesOwner identifies the collector of a metric of an HPA.
+type seriesOwner struct {
+	HPA    resourceReference
+	Metric collector.MetricTypeName
+}
+
+// NewNamespaceQuota initializes a new NamespaceQuota.
+func NewNamespaceQuota(maxCollectors, maxSeries int) *NamespaceQuota {
+	return &NamespaceQuota{
+		MaxCollectors: maxCollectors,
+		MaxSeries:     maxSeries,
+		series:        make(map[string]map[seriesOwner]map[string]collector.CollectedMetric),
+		rejected:      make(map[seriesOwner]bool),
+		rejectedHPAs:  make(map[resourceReference]bool),
+	}
+}
+
+// SetNamespaceQuota limits the number of collectors and stored metric series
+// per namespace.
+func (p *HPAProvider) SetNamespaceQuota(quota *NamespaceQuota) {
+	p.namespaceQuota = quota
+}
+
+// admitCollectors returns an error if adding the collectors of an HPA would
+// exceed the collector limit of its namespace. The current collectors of the
+// HPA don't count against the limit as they are replaced. It returns true if
+// the HPA is rejected for the first time since it was last admitted.
+func (q *NamespaceQuota) admitCollectors(scheduler *CollectorScheduler, hpa resourceReference, collectors int) (bool, error) {
+	if q == nil || q.MaxCollectors <= 0 {
+		return false, nil
+	}
+
+	current := scheduler.namespaceCollectors(hpa.Namespace, hpa)
+
+	q.Lock()
+	defer q.Unlock()
+
+	if current+collectors > q.MaxCollectors {
+		first := !q.rejectedHPAs[hpa]
+		q.rejectedHPAs[hpa] = true
+		return first, fmt.Errorf("%d collector(s) would exceed the limit of %d collectors of namespace %s, which has %d collector(s)", collectors, q.MaxCollectors, hpa.Namespace, current)
+	}
+
+	delete(q.rejectedHPAs, hpa)
+	return false, nil
+}
+
+// admitSeries returns an error if storing the values of a collection would
+// exceed the series limit of the namespace of the HPA. The series stored
+// for the collectors of the namespace are counted until they expire or are
+// removed from the store, series replaced by the collection don't count
+// twice. It returns true if the collector is rejected for the first time
+// since it was last admitted.
+func (q *NamespaceQuota) admitSeries(store MetricStore, hpa resourceReference, config *collector.MetricConfig, values []collector.CollectedMetric) (bool, error) {
+	if q == nil || q.MaxSeries <= 0 || config == nil {
+		return false, nil
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	owner := seriesOwner{HPA: hpa, Metric: config.MetricTypeName}
+	owners, ok := q.series[hpa.Namespace]
+	if !ok {
+		owners = make(map[seriesOwner]map[string]collector.CollectedMetric)
+		q.series[hpa.Namespace] = owners
+	}
+
+	collected := make(map[string]collector.CollectedMetric, len(values))
+	for _, value := range values {
+		collected[seriesKey(value)] = value
+	}
+
+	current := 0
+	for o, series := range owners {
+		for key, value := range series {
+			if !store.Stored(value) {
+				delete(series, key)
+				continue
+			}
+			if _, ok := collected[key]; ok && o == owner {
+				continue
+			}
+			current++
+		}
+		if len(series) == 0 {
+			delete(owners, o)
+		}
+	}
+
+	if current+len(collected) > q.MaxSeries {
+		first := !q.rejected[owner]
+		q.rejected[owner] = true
+		return first, fmt.Errorf("%d series would exceed the limit of %d series of namespace %s, which has %d series", len(collected), q.MaxSeries, hpa.Namespace, current)
+	}
+
+	series, ok := owners[owner]
+	if !ok {
+		series = make(map[string]collector.CollectedMetric, len(collected))
+		owners[owner] = series
+	}
+	for key, value := range collected {
+		series[key] = value
+	}
+	delete(q.rejected, owner)
+	return false, nil
+}
+
+// seriesKey returns the key of the series of a collected value in the metric
+// store.
+func seriesKey(value collector.CollectedMetric) string {
+	if value.Type == autoscalingv2.ExternalMetricSourceType {
+		return "external/" + value.External.MetricName + "/" + hashLabelMap(value.External.MetricLabels)
+	}
+	object := value.Custom.DescribedObject
+	return "custom/" + value.Custom.Metric.Name + "/" + customMetricID(describedGroupResource(object), object.Namespace, object.Name, valueSelector(value.Custom))
+}
+
+// quotaExceeded reports a collection rejected because it exceeded the series
+// quota of its namespace as Event on the HPAs it was collected for.
+func (p *HPAProvider) quotaExceeded(collection metricCollection, err error) {
+	glog.Errorf("Rejecting metric '%s' of HPA %s: %v", collection.Config.Name, collection.HPA, err)
+	for _, hpa := range append([]resourceReference{collection.HPA}, collection.SharedWith...) {
+		p.hpaEvent(hpa, v1.EventTypeWarning, "NamespaceQuotaExceeded", fmt.Sprintf("Not storing metric '%s': %v", collection.Config.Name, err))
+	}
+}
+
+// remove forgets the series of the collectors of a deleted HPA.
+func (q *NamespaceQuota) remove(hpa resourceReference) {
+	if q == nil {
+		return
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	owners := q.series[hpa.Namespace]
+	for owner := range owners {
+		if owner.HPA == hpa {
+			delete(owners, owner)
+		}
+	}
+	if len(owners) == 0 {
+		delete(q.series, hpa.Namespace)
+	}
+
+	for owner := range q.rejected {
+		if owner.HPA == hpa {
+			delete(q.rejected, owner)
+		}
+	}
+	delete(q.rejectedHPAs, hpa)
+}
+
+// namespaceCollectors returns the number of collectors of the HPAs of a
+// namespace, excluding the collectors of the given HPA.
+func (t *CollectorScheduler) namespaceCollectors(namespace string, exclude resourceReference) int {
+	t.RLock()
+	defer t.RUnlock()
+
+	count := 0
+	for ref, collectors := range t.table {
+		if ref.Namespace == namespace && ref != exclude {
+			count += len(collectors)
+		}
+	}
+	return count
+}
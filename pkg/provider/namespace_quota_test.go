@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+)
+
+func TestNamespaceQuotaAdmitSeries(t *testing.T) {
+	store := NewInMemoryMetricStore(time.Minute)
+	quota := NewNamespaceQuota(0, 3)
+	hpa := resourceReference{Name: "hpa", Namespace: "default"}
+	other := resourceReference{Name: "other", Namespace: "default"}
+	config := &collector.MetricConfig{
+		MetricTypeName: collector.MetricTypeName{Type: autoscalingv2.PodsMetricSourceType, Name: "requests"},
+	}
+
+	admit := func(hpa resourceReference, values ...collector.CollectedMetric) (bool, error) {
+		first, err := quota.admitSeries(store, hpa, config, values)
+		if err == nil {
+			store.InsertAll(values, config)
+		}
+		return first, err
+	}
+
+	_, err := admit(hpa, podValue("a", 1, nil), podValue("b", 1, nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the series of the previous collection are replaced.
+	_, err = admit(hpa, podValue("a", 1, nil), podValue("b", 1, nil))
+	if err != nil {
+		t.Fatalf("expected replaced series not to count twice, got %v", err)
+	}
+
+	// the series of pod a is still stored although it wasn't collected.
+	_, err = admit(hpa, podValue("b", 1, nil), podValue("c", 1, nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	first, err := admit(other, podValue("d", 1, nil))
+	if err == nil {
+		t.Fatal("expected the stored series to count against the quota")
+	}
+	if !first {
+		t.Error("expected the first rejection to be reported")
+	}
+	first, err = admit(other, podValue("d", 1, nil))
+	if err == nil || first {
+		t.Errorf("expected the repeated rejection not to be reported, got %t: %v", first, err)
+	}
+
+	// expired series don't count.
+	store.SetDefaultTTL(time.Nanosecond)
+	_, err = admit(hpa, podValue("c", 1, nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	_, err = admit(other, podValue("d", 1, nil))
+	if err != nil {
+		t.Errorf("expected expired series not to count against the quota, got %v", err)
+	}
+}
+
+func TestNamespaceQuotaAdmitCollectors(t *testing.T) {
+	scheduler, _ := newTestScheduler()
+	quota := NewNamespaceQuota(1, 0)
+	hpa := resourceReference{Name: "hpa", Namespace: "default"}
+	other := resourceReference{Name: "other", Namespace: "default"}
+
+	scheduler.Add(hpa, &collector.MetricConfig{
+		MetricTypeName: collector.MetricTypeName{Type: autoscalingv2.ExternalMetricSourceType, Name: "queue"},
+	}, &fakeCollector{})
+	defer scheduler.Remove(hpa)
+
+	first, err := quota.admitCollectors(scheduler, other, 1)
+	if err == nil || !first {
+		t.Fatalf("expected the first rejection to be reported, got %t: %v", first, err)
+	}
+	first, err = quota.admitCollectors(scheduler, other, 1)
+	if err == nil || first {
+		t.Errorf("expected the repeated rejection not to be reported, got %t: %v", first, err)
+	}
+
+	_, err = quota.admitCollectors(scheduler, hpa, 1)
+	if err != nil {
+		t.Errorf("expected the collectors of the HPA to be replaced, got %v", err)
+	}
+
+	scheduler.Remove(hpa)
+	quota.remove(other)
+	_, err = quota.admitCollectors(scheduler, other, 1)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package provider
+
+// NamespaceFilter restricts the namespaces HPAs are discovered in and
+// metrics are served for.
+type NamespaceFilter struct {
+	include map[string]bool
+	exclude map[string]bool
+}
+
+// NewNamespaceFilter initializes a new NamespaceFilter. If include is empty
+// all namespaces which are not excluded are allowed.
+func NewNamespaceFilter(include, exclude []string) *NamespaceFilter {
+	f := &NamespaceFilter{
+		exclude: make(map[string]bool, len(exclude)),
+	}
+
+	if len(include) > 0 {
+		f.include = make(map[string]bool, len(include))
+		for _, namespace := range include {
+			f.include[namespace] = true
+		}
+	}
+
+	for _, namespace := range exclude {
+		f.exclude[namespace] = true
+	}
+
+	return f
+}
+
+// Allowed returns true if the namespace is allowed by the filter. The empty
+// namespace of cluster scoped resources is always allowed.
+func (f *NamespaceFilter) Allowed(namespace string) bool {
+	if f == nil || namespace == "" {
+		return true
+	}
+
+	if f.exclude[namespace] {
+		return false
+	}
+
+	return f.include == nil || f.include[namespace]
+}
+
+// singleNamespace returns the namespace if the filter only allows a single
+// namespace.
+func (f *NamespaceFilter) singleNamespace() (string, bool) {
+	if f == nil || len(f.include) != 1 {
+		return "", false
+	}
+
+	for namespace := range f.include {
+		return namespace, !f.exclude[namespace]
+	}
+	return "", false
+}
+
+// SetNamespaceFilter restricts the namespaces HPAs are discovered in and
+// metrics are served for.
+func (p *HPAProvider) SetNamespaceFilter(filter *NamespaceFilter) {
+	p.namespaceFilter = filter
+}
@@ -0,0 +1,32 @@
+package provider
+
+import (
+	"github.com/golang/glog"
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	"k8s.io/api/core/v1"
+)
+
+// partialResponse applies the partial response policy of the metric to a
+// partial response of a collector. With use-partial (the default) the
+// values of the successful targets are used, with serve-last the last
+// complete values of the collector are served and with error the
+// collection fails. The partial response is recorded in the health of the
+// collector and emitted as PartialResponse event on the HPAs.
+func (t *CollectorScheduler) partialResponse(c *scheduledCollector, refs []resourceReference, partial *collector.PartialResponseError) ([]collector.CollectedMetric, error) {
+	t.health.recordPartial(c.health, partial)
+	t.event(refs, v1.EventTypeWarning, "PartialResponse", partial.Error())
+
+	switch c.config.PartialResponsePolicy {
+	case collector.PartialResponsePolicyServeLast:
+		if c.lastValues == nil {
+			return nil, partial
+		}
+		glog.Warningf("Got %v for metric '%s' of HPA %s, serving last values", partial, c.config.Name, refs[0])
+		return c.lastValues, nil
+	case collector.PartialResponsePolicyError:
+		return nil, partial
+	default:
+		glog.Warningf("Got %v for metric '%s' of HPA %s, using partial values", partial, c.config.Name, refs[0])
+		return partial.Values, nil
+	}
+}
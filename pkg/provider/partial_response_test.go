@@ -0,0 +1,129 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+)
+
+// fakeCollector returns the configured values and error.
+type fakeCollector struct {
+	values []collector.CollectedMetric
+	err    error
+}
+
+func (c *fakeCollector) GetMetrics(ctx context.Context) ([]collector.CollectedMetric, error) {
+	return c.values, c.err
+}
+
+func (c *fakeCollector) Interval() time.Duration {
+	return time.Minute
+}
+
+// externalValue returns a collected external metric with the value.
+func externalValue(name string, value int64) collector.CollectedMetric {
+	return collector.CollectedMetric{
+		Type: autoscalingv2.ExternalMetricSourceType,
+		External: external_metrics.ExternalMetricValue{
+			MetricName: name,
+			Value:      *resource.NewQuantity(value, resource.DecimalSI),
+		},
+	}
+}
+
+// newTestScheduler initializes a scheduler whose collections are sent to the
+// returned channel.
+func newTestScheduler() (*CollectorScheduler, chan metricCollection) {
+	metricsc := make(chan metricCollection, 10)
+	return NewCollectorScheduler(context.Background(), metricsc), metricsc
+}
+
+func TestPartialResponsePolicy(t *testing.T) {
+	partial := &collector.PartialResponseError{
+		Values:        []collector.CollectedMetric{externalValue("queue", 2)},
+		FailedTargets: []collector.FailedTarget{{Target: "pod-2", Err: fmt.Errorf("timeout")}},
+		Err:           fmt.Errorf("1 of 2 targets failed"),
+	}
+
+	for _, tc := range []struct {
+		msg      string
+		policy   string
+		complete bool
+		expected []int64
+		err      bool
+	}{
+		{
+			msg:      "use-partial is the default",
+			expected: []int64{2},
+		},
+		{
+			msg:      "use-partial",
+			policy:   collector.PartialResponsePolicyUsePartial,
+			expected: []int64{2},
+		},
+		{
+			msg:      "serve-last",
+			policy:   collector.PartialResponsePolicyServeLast,
+			complete: true,
+			expected: []int64{5},
+		},
+		{
+			msg:    "serve-last without complete collection",
+			policy: collector.PartialResponsePolicyServeLast,
+			err:    true,
+		},
+		{
+			msg:      "error",
+			policy:   collector.PartialResponsePolicyError,
+			complete: true,
+			err:      true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			scheduler, metricsc := newTestScheduler()
+			fake := &fakeCollector{values: []collector.CollectedMetric{externalValue("queue", 5)}}
+			config := &collector.MetricConfig{
+				MetricTypeName:        collector.MetricTypeName{Type: autoscalingv2.ExternalMetricSourceType, Name: "queue"},
+				PartialResponsePolicy: tc.policy,
+			}
+			c := scheduler.schedule(resourceReference{Name: "hpa", Namespace: "default"}, config, fake, nil)
+
+			if tc.complete {
+				scheduler.collect(c)
+				<-metricsc
+			}
+
+			fake.values, fake.err = nil, partial
+			scheduler.collect(c)
+			collection := <-metricsc
+
+			if c.health.LastPartialResponse == "" || c.health.LastPartialResponseTime == nil {
+				t.Errorf("expected partial response to be recorded in the collector health")
+			}
+
+			if tc.err {
+				if collection.Error == nil {
+					t.Fatalf("expected collection error, got %v", collection.Values)
+				}
+				return
+			}
+			if collection.Error != nil {
+				t.Fatalf("unexpected error: %v", collection.Error)
+			}
+			if len(collection.Values) != len(tc.expected) {
+				t.Fatalf("expected %d values, got %d", len(tc.expected), len(collection.Values))
+			}
+			for i, value := range collection.Values {
+				if value.External.Value.Value() != tc.expected[i] {
+					t.Errorf("expected value %d, got %s", tc.expected[i], value.External.Value.String())
+				}
+			}
+		})
+	}
+}
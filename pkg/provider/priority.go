@@ -0,0 +1,160 @@
+package provider
+
+import (
+	"context"
+	"sync"
+
+	"github.com/golang/glog"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+)
+
+// priorityAnnotation defines the priority class of the collectors of an
+// HPA.
+const priorityAnnotation = "kube-metrics-adapter/priority"
+
+// Priority classes of collectors.
+const (
+	// PriorityHigh collectors get a free collection slot before
+	// best-effort collectors.
+	PriorityHigh = "high"
+	// PriorityBestEffort is the default priority class.
+	PriorityBestEffort = "best-effort"
+)
+
+// highPriority returns true if the priority annotation of an HPA marks its
+// collectors as high priority. Invalid priorities are ignored.
+func highPriority(hpa *autoscalingv2.HorizontalPodAutoscaler) bool {
+	value, ok := hpa.Annotations[priorityAnnotation]
+	if !ok {
+		return false
+	}
+
+	switch value {
+	case PriorityHigh:
+		return true
+	case PriorityBestEffort:
+		return false
+	default:
+		glog.Warningf("Ignoring invalid priority '%s' of HPA %s/%s, must be %s or %s", value, hpa.Namespace, hpa.Name, PriorityHigh, PriorityBestEffort)
+		return false
+	}
+}
+
+// collectionSlots limits the number of simultaneous collections. Once all
+// slots are taken, freed slots are handed to waiting high priority
+// collectors before waiting best-effort collectors, each in the order they
+// started waiting.
+type collectionSlots struct {
+	max   int
+	taken int
+	// waiting are the collectors waiting for a slot, by priority. A
+	// waiting collector gets the slot when its channel is closed.
+	high       []chan struct{}
+	bestEffort []chan struct{}
+	sync.Mutex
+}
+
+// newCollectionSlots initializes collectionSlots with max slots.
+func newCollectionSlots(max int) *collectionSlots {
+	return &collectionSlots{max: max}
+}
+
+// acquire waits for a free slot. It returns false if the context was
+// canceled while waiting.
+func (s *collectionSlots) acquire(ctx context.Context, high bool) bool {
+	s.Lock()
+	if s.taken < s.max {
+		s.taken++
+		s.Unlock()
+		return true
+	}
+
+	ready := make(chan struct{})
+	if high {
+		s.high = append(s.high, ready)
+	} else {
+		s.bestEffort = append(s.bestEffort, ready)
+	}
+	s.Unlock()
+
+	select {
+	case <-ready:
+		return true
+	case <-ctx.Done():
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	select {
+	case <-ready:
+		// the slot was handed over while the context was canceled,
+		// pass it on.
+		s.handOver()
+	default:
+		if high {
+			s.high = withoutWaiter(s.high, ready)
+		} else {
+			s.bestEffort = withoutWaiter(s.bestEffort, ready)
+		}
+	}
+	return false
+}
+
+// release frees a slot taken by acquire.
+func (s *collectionSlots) release() {
+	s.Lock()
+	defer s.Unlock()
+	s.handOver()
+}
+
+// handOver hands a freed slot to the next waiting collector, or returns it
+// if none is waiting. The caller must hold the lock.
+func (s *collectionSlots) handOver() {
+	switch {
+	case len(s.high) > 0:
+		close(s.high[0])
+		s.high = s.high[1:]
+	case len(s.bestEffort) > 0:
+		close(s.bestEffort[0])
+		s.bestEffort = s.bestEffort[1:]
+	default:
+		s.taken--
+	}
+}
+
+// withoutWaiter removes a waiting collector from a queue.
+func withoutWaiter(queue []chan struct{}, ready chan struct{}) []chan struct{} {
+	for i, waiter := range queue {
+		if waiter == ready {
+			return append(queue[:i], queue[i+1:]...)
+		}
+	}
+	return queue
+}
+
+// SetPriority sets the priority class of the collectors of an HPA.
+func (t *CollectorScheduler) SetPriority(resourceRef resourceReference, high bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	if high {
+		t.highPriority[resourceRef] = true
+	} else {
+		delete(t.highPriority, resourceRef)
+	}
+}
+
+// isHighPriority returns true if any of the HPAs of a collector is high
+// priority.
+func (t *CollectorScheduler) isHighPriority(refs []resourceReference) bool {
+	t.RLock()
+	defer t.RUnlock()
+
+	for _, ref := range refs {
+		if t.highPriority[ref] {
+			return true
+		}
+	}
+	return false
+}
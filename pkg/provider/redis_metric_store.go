@@ -0,0 +1,713 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/gomodule/redigo/redis"
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	"k8s.io/metrics/pkg/apis/external_metrics"
+	"sigs.k8s.io/custom-metrics-apiserver/pkg/provider"
+)
+
+const (
+	redisCustomMetricsKey   = "custom"
+	redisExternalMetricsKey = "external"
+)
+
+// RedisConfig configures the connection to the Redis server of a
+// RedisMetricStore.
+type RedisConfig struct {
+	// Address of the Redis server as host:port.
+	Address  string
+	Password string
+	Database int
+	// KeyPrefix is prepended to all keys written by the store, such
+	// that several adapters can share a Redis server.
+	KeyPrefix string
+}
+
+// RedisMetricStore is a Metrics Store which stores the metrics in Redis,
+// such that multiple adapter replicas can share the collected metrics.
+//
+// The names of the stored metrics are kept in the sets <prefix>custom and
+// <prefix>external. The values of a metric are kept in the hash
+// <prefix>custom:<metric> keyed by <group resource>/<namespace>/<name>,
+// followed by /<metric selector> for values collected for a selector, and
+// <prefix>external:<metric> keyed by the labels of the series. Metrics are
+// kept for the expired retention after they expired to be able to tell
+// metrics which expired apart from metrics which were never collected.
+type RedisMetricStore struct {
+	pool              *redis.Pool
+	keyPrefix         string
+	collectorInterval time.Duration
+	defaultTTL        time.Duration
+	expiredRetention  time.Duration
+	sync.RWMutex
+}
+
+// NewRedisMetricStore initializes a Metrics Store backed by the Redis server
+// of the config. The collector interval is the default interval of
+// collectors used for staleness policies.
+func NewRedisMetricStore(config RedisConfig, collectorInterval time.Duration) (*RedisMetricStore, error) {
+	pool := &redis.Pool{
+		MaxIdle:     10,
+		IdleTimeout: 5 * time.Minute,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", config.Address,
+				redis.DialPassword(config.Password),
+				redis.DialDatabase(config.Database),
+			)
+		},
+		TestOnBorrow: func(conn redis.Conn, lastUsed time.Time) error {
+			if time.Since(lastUsed) < time.Minute {
+				return nil
+			}
+			_, err := conn.Do("PING")
+			return err
+		},
+	}
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("PING")
+	if err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect to redis at %s: %v", config.Address, err)
+	}
+
+	return &RedisMetricStore{
+		pool:              pool,
+		keyPrefix:         config.KeyPrefix,
+		collectorInterval: collectorInterval,
+		defaultTTL:        defaultMetricTTL,
+		expiredRetention:  defaultExpiredMetricRetention,
+	}, nil
+}
+
+// key returns the key of the parts prefixed with the key prefix.
+func (s *RedisMetricStore) key(parts ...string) string {
+	return s.keyPrefix + strings.Join(parts, ":")
+}
+
+// SetDefaultTTL sets the time metrics are served for after they were
+// collected if their config defines neither a TTL nor a staleness policy.
+func (s *RedisMetricStore) SetDefaultTTL(ttl time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.defaultTTL = ttl
+}
+
+// SetExpiredRetention sets the time expired metrics are kept in redis to
+// tell them apart from metrics which were never collected.
+func (s *RedisMetricStore) SetExpiredRetention(retention time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.expiredRetention = retention
+}
+
+// Insert inserts a collected metric into the store. The config of the metric
+// defines how the value is stored, it may be nil.
+func (s *RedisMetricStore) Insert(value collector.CollectedMetric, config *collector.MetricConfig) {
+	s.InsertAll([]collector.CollectedMetric{value}, config)
+}
+
+// InsertAll inserts all metrics of a collection into the store using a
+// single connection. All metrics get the same TTL.
+func (s *RedisMetricStore) InsertAll(values []collector.CollectedMetric, config *collector.MetricConfig) {
+	if len(values) == 0 {
+		return
+	}
+
+	s.RLock()
+	defaultTTL := s.defaultTTL
+	s.RUnlock()
+
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	now := time.Now().UTC()
+	for _, value := range values {
+		var err error
+		switch value.Type {
+		case autoscalingv2.ObjectMetricSourceType, autoscalingv2.PodsMetricSourceType:
+			err = s.insertCustomMetric(conn, value.Custom, value.Labels, config, defaultTTL, now)
+		case autoscalingv2.ExternalMetricSourceType:
+			err = s.insertExternalMetric(conn, value.External, config, defaultTTL, now)
+		}
+		if err != nil {
+			glog.Errorf("Failed to insert metric into redis: %v", err)
+		}
+	}
+}
+
+// insertCustomMetric inserts a custom metric plus labels into the store.
+func (s *RedisMetricStore) insertCustomMetric(conn redis.Conn, value custom_metrics.MetricValue, labels map[string]string, config *collector.MetricConfig, defaultTTL time.Duration, now time.Time) error {
+	staleness := newStalenessPolicy(config, s.collectorInterval)
+	interpolation := newInterpolationPolicy(config, s.collectorInterval)
+	metric := customMetricsStoredMetric{
+		Value:         value,
+		Labels:        labels,
+		TTL:           interpolation.ttl(metricTTL(config, staleness, defaultTTL, now), now),
+		Collected:     now,
+		Staleness:     staleness,
+		Interpolation: interpolation,
+	}
+
+	key := s.key(redisCustomMetricsKey, value.Metric.Name)
+	field := customMetricID(describedGroupResource(value.DescribedObject), value.DescribedObject.Namespace, value.DescribedObject.Name, valueSelector(value))
+
+	metric.Smoothing = newSmoothingPolicy(config)
+	if metric.Smoothing != nil || interpolation != nil || (config != nil && config.Deduplicate) {
+		var stored customMetricsStoredMetric
+		found, err := s.get(conn, key, field, &stored)
+		if err != nil {
+			return err
+		}
+
+		metric.Samples = metric.Smoothing.samples(stored.Samples, value.Value, now)
+		metric.Previous = interpolation.previous(stored.Value.Value, stored.Collected)
+
+		// keep the stored value if it's identical to the new one,
+		// only refreshing its freshness.
+		if found && deduplicate(config, stored.Value.Value, value.Value) {
+			metric.Value.Value = stored.Value.Value
+		}
+	}
+
+	return s.set(conn, redisCustomMetricsKey, value.Metric.Name, field, metric)
+}
+
+// insertExternalMetric inserts an external metric into the store.
+func (s *RedisMetricStore) insertExternalMetric(conn redis.Conn, value external_metrics.ExternalMetricValue, config *collector.MetricConfig, defaultTTL time.Duration, now time.Time) error {
+	staleness := newStalenessPolicy(config, s.collectorInterval)
+	interpolation := newInterpolationPolicy(config, s.collectorInterval)
+	metric := externalMetricsStoredMetric{
+		Value:         value,
+		TTL:           interpolation.ttl(metricTTL(config, staleness, defaultTTL, now), now),
+		Collected:     now,
+		Staleness:     staleness,
+		Interpolation: interpolation,
+	}
+
+	key := s.key(redisExternalMetricsKey, value.MetricName)
+	field := hashLabelMap(value.MetricLabels)
+
+	metric.Smoothing = newSmoothingPolicy(config)
+	if metric.Smoothing != nil || interpolation != nil || (config != nil && config.Deduplicate) {
+		var stored externalMetricsStoredMetric
+		found, err := s.get(conn, key, field, &stored)
+		if err != nil {
+			return err
+		}
+
+		metric.Samples = metric.Smoothing.samples(stored.Samples, value.Value, now)
+		metric.Previous = interpolation.previous(stored.Value.Value, stored.Collected)
+
+		if found && deduplicate(config, stored.Value.Value, value.Value) {
+			metric.Value.Value = stored.Value.Value
+		}
+	}
+
+	return s.set(conn, redisExternalMetricsKey, value.MetricName, field, metric)
+}
+
+// get reads a stored metric from a hash field. It returns false if the field
+// doesn't exist.
+func (s *RedisMetricStore) get(conn redis.Conn, key, field string, metric interface{}) (bool, error) {
+	data, err := redis.Bytes(conn.Do("HGET", key, field))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	err = json.Unmarshal(data, metric)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode metric %s %s: %v", key, field, err)
+	}
+	return true, nil
+}
+
+// set writes a stored metric to a hash field and records the metric name.
+func (s *RedisMetricStore) set(conn redis.Conn, kind, metricName, field string, metric interface{}) error {
+	data, err := json.Marshal(metric)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Do("HSET", s.key(kind, metricName), field, data)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Do("SADD", s.key(kind), metricName)
+	return err
+}
+
+// Stored returns true if the series of a collected value is stored and
+// hasn't expired.
+func (s *RedisMetricStore) Stored(value collector.CollectedMetric) bool {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	var found bool
+	var ttl time.Time
+	var err error
+	if value.Type == autoscalingv2.ExternalMetricSourceType {
+		var stored externalMetricsStoredMetric
+		found, err = s.get(conn, s.key(redisExternalMetricsKey, value.External.MetricName), hashLabelMap(value.External.MetricLabels), &stored)
+		ttl = stored.TTL
+	} else {
+		object := value.Custom.DescribedObject
+		field := customMetricID(describedGroupResource(object), object.Namespace, object.Name, valueSelector(value.Custom))
+		var stored customMetricsStoredMetric
+		found, err = s.get(conn, s.key(redisCustomMetricsKey, value.Custom.Metric.Name), field, &stored)
+		ttl = stored.TTL
+	}
+	if err != nil {
+		glog.Errorf("Failed to get metric from redis: %v", err)
+		return false
+	}
+	return found && ttl.After(time.Now().UTC())
+}
+
+// customMetrics reads all stored values of a custom metric keyed by their
+// hash field.
+func (s *RedisMetricStore) customMetrics(conn redis.Conn, metricName string) (map[string]customMetricsStoredMetric, error) {
+	values, err := redis.StringMap(conn.Do("HGETALL", s.key(redisCustomMetricsKey, metricName)))
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make(map[string]customMetricsStoredMetric, len(values))
+	for field, data := range values {
+		var metric customMetricsStoredMetric
+		err := json.Unmarshal([]byte(data), &metric)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode custom metric %s %s: %v", metricName, field, err)
+		}
+		metrics[field] = metric
+	}
+	return metrics, nil
+}
+
+// externalMetrics reads all stored series of an external metric keyed by
+// their labels.
+func (s *RedisMetricStore) externalMetrics(conn redis.Conn, metricName string) (map[string]externalMetricsStoredMetric, error) {
+	values, err := redis.StringMap(conn.Do("HGETALL", s.key(redisExternalMetricsKey, metricName)))
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make(map[string]externalMetricsStoredMetric, len(values))
+	for field, data := range values {
+		var metric externalMetricsStoredMetric
+		err := json.Unmarshal([]byte(data), &metric)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode external metric %s %s: %v", metricName, field, err)
+		}
+		metrics[field] = metric
+	}
+	return metrics, nil
+}
+
+// GetMetricsBySelector gets metric from the store using a label selector to
+// find metrics for matching resources. Only the values collected for the
+// metric selector are returned.
+func (s *RedisMetricStore) GetMetricsBySelector(metricName string, groupResource schema.GroupResource, namespace string, selector, metricSelector labels.Selector) *custom_metrics.MetricValueList {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	metrics, err := s.customMetrics(conn, metricName)
+	if err != nil {
+		glog.Errorf("Failed to get custom metric %s from redis: %v", metricName, err)
+		return nil
+	}
+
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	objectSelector := requestSelector(metricSelector)
+	matchedMetrics := make([]custom_metrics.MetricValue, 0)
+	for field, metric := range metrics {
+		gr, ns, _, sel, err := parseCustomMetricID(field)
+		if err != nil {
+			glog.Errorf("Failed to get custom metric %s from redis: %v", metricName, err)
+			continue
+		}
+
+		if gr != groupResource || (namespace != "" && ns != namespace) || sel != objectSelector {
+			continue
+		}
+
+		if metric.TTL.After(now) && selector.Matches(labels.Set(metric.Labels)) {
+			matchedMetrics = append(matchedMetrics, metric.served(now))
+		}
+	}
+
+	return &custom_metrics.MetricValueList{Items: matchedMetrics}
+}
+
+// GetMetricsByName looks up metrics in the store by resource name and metric
+// selector. If namespace is "" if will look for the resource in all
+// namespaces.
+func (s *RedisMetricStore) GetMetricsByName(metricName string, groupResource schema.GroupResource, namespace, name string, metricSelector labels.Selector) *custom_metrics.MetricValue {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	now := time.Now().UTC()
+	objectSelector := requestSelector(metricSelector)
+
+	if namespace != "" {
+		var metric customMetricsStoredMetric
+		found, err := s.get(conn, s.key(redisCustomMetricsKey, metricName), customMetricID(groupResource, namespace, name, objectSelector), &metric)
+		if err != nil {
+			glog.Errorf("Failed to get custom metric %s from redis: %v", metricName, err)
+			return nil
+		}
+
+		if found && metric.TTL.After(now) {
+			value := metric.served(now)
+			return &value
+		}
+		return nil
+	}
+
+	metrics, err := s.customMetrics(conn, metricName)
+	if err != nil {
+		glog.Errorf("Failed to get custom metric %s from redis: %v", metricName, err)
+		return nil
+	}
+
+	for field, metric := range metrics {
+		gr, _, n, sel, err := parseCustomMetricID(field)
+		if err != nil {
+			continue
+		}
+
+		if gr == groupResource && n == name && sel == objectSelector && metric.TTL.After(now) {
+			value := metric.served(now)
+			return &value
+		}
+	}
+
+	return nil
+}
+
+// ExpiredCustomMetric returns the last value of a custom metric and the time
+// it expired if it was collected before but is no longer available in the
+// store. If namespace is "" it will look for the resource in all namespaces.
+func (s *RedisMetricStore) ExpiredCustomMetric(metricName string, groupResource schema.GroupResource, namespace, name string, metricSelector labels.Selector) (*custom_metrics.MetricValue, time.Time, bool) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	metrics, err := s.customMetrics(conn, metricName)
+	if err != nil {
+		glog.Errorf("Failed to get custom metric %s from redis: %v", metricName, err)
+		return nil, time.Time{}, false
+	}
+
+	now := time.Now().UTC()
+	objectSelector := requestSelector(metricSelector)
+	for field, metric := range metrics {
+		gr, ns, n, sel, err := parseCustomMetricID(field)
+		if err != nil {
+			continue
+		}
+
+		if gr == groupResource && n == name && sel == objectSelector && (namespace == "" || ns == namespace) && !metric.TTL.After(now) {
+			value := metric.Value
+			return &value, metric.TTL, true
+		}
+	}
+
+	return nil, time.Time{}, false
+}
+
+// ExpiredCustomMetricsBySelector returns the last values of the expired
+// custom metrics of the resources matching the selector and the time the most
+// recently expired one expired. If namespace is "" the resources of all
+// namespaces are matched.
+func (s *RedisMetricStore) ExpiredCustomMetricsBySelector(metricName string, groupResource schema.GroupResource, namespace string, selector, metricSelector labels.Selector) ([]custom_metrics.MetricValue, time.Time, bool) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	metrics, err := s.customMetrics(conn, metricName)
+	if err != nil {
+		glog.Errorf("Failed to get custom metric %s from redis: %v", metricName, err)
+		return nil, time.Time{}, false
+	}
+
+	now := time.Now().UTC()
+	objectSelector := requestSelector(metricSelector)
+	var values []custom_metrics.MetricValue
+	var expiredAt time.Time
+	for field, metric := range metrics {
+		gr, ns, _, sel, err := parseCustomMetricID(field)
+		if err != nil {
+			continue
+		}
+
+		if gr != groupResource || (namespace != "" && ns != namespace) || sel != objectSelector || metric.TTL.After(now) {
+			continue
+		}
+
+		if selector.Matches(labels.Set(metric.Labels)) {
+			values = append(values, metric.Value)
+			if metric.TTL.After(expiredAt) {
+				expiredAt = metric.TTL
+			}
+		}
+	}
+
+	return values, expiredAt, len(values) > 0
+}
+
+// ListAllMetrics lists all custom metrics in the store.
+func (s *RedisMetricStore) ListAllMetrics() []provider.CustomMetricInfo {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	metricNames, err := redis.Strings(conn.Do("SMEMBERS", s.key(redisCustomMetricsKey)))
+	if err != nil {
+		glog.Errorf("Failed to list custom metrics from redis: %v", err)
+		return nil
+	}
+
+	now := time.Now().UTC()
+	infos := make(map[provider.CustomMetricInfo]struct{})
+	for _, metricName := range metricNames {
+		metrics, err := s.customMetrics(conn, metricName)
+		if err != nil {
+			glog.Errorf("Failed to get custom metric %s from redis: %v", metricName, err)
+			continue
+		}
+
+		for field, metric := range metrics {
+			gr, ns, _, _, err := parseCustomMetricID(field)
+			if err != nil || !metric.TTL.After(now) {
+				continue
+			}
+
+			infos[provider.CustomMetricInfo{
+				GroupResource: gr,
+				Namespaced:    ns != "",
+				Metric:        metricName,
+			}] = struct{}{}
+		}
+	}
+
+	metrics := make([]provider.CustomMetricInfo, 0, len(infos))
+	for info := range infos {
+		metrics = append(metrics, info)
+	}
+	return metrics
+}
+
+// GetExternalMetric gets external metric from the store by metric name and
+// selector.
+func (s *RedisMetricStore) GetExternalMetric(namespace string, metricName string, selector labels.Selector) (*external_metrics.ExternalMetricValueList, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	metrics, err := s.externalMetrics(conn, metricName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get external metric %s from redis: %v", metricName, err)
+	}
+
+	now := time.Now().UTC()
+	matchedMetrics := make([]external_metrics.ExternalMetricValue, 0)
+	for _, metric := range metrics {
+		if metric.TTL.After(now) && selector.Matches(labels.Set(metric.Value.MetricLabels)) {
+			matchedMetrics = append(matchedMetrics, metric.served(now))
+		}
+	}
+
+	return &external_metrics.ExternalMetricValueList{Items: matchedMetrics}, nil
+}
+
+// ExpiredExternalMetric returns the last values of the expired external
+// metric series matching the selector and the time the most recently expired
+// series expired, if any series matching the selector was collected before
+// but is no longer available in the store.
+func (s *RedisMetricStore) ExpiredExternalMetric(metricName string, selector labels.Selector) ([]external_metrics.ExternalMetricValue, time.Time, bool) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	metrics, err := s.externalMetrics(conn, metricName)
+	if err != nil {
+		glog.Errorf("Failed to get external metric %s from redis: %v", metricName, err)
+		return nil, time.Time{}, false
+	}
+
+	now := time.Now().UTC()
+
+	var values []external_metrics.ExternalMetricValue
+	var expiredAt time.Time
+	for _, metric := range metrics {
+		if metric.TTL.After(now) {
+			continue
+		}
+
+		if selector.Matches(labels.Set(metric.Value.MetricLabels)) {
+			values = append(values, metric.Value)
+			if metric.TTL.After(expiredAt) {
+				expiredAt = metric.TTL
+			}
+		}
+	}
+
+	return values, expiredAt, len(values) > 0
+}
+
+// ListAllExternalMetrics lists all external metrics in the store.
+func (s *RedisMetricStore) ListAllExternalMetrics() []provider.ExternalMetricInfo {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	metricNames, err := redis.Strings(conn.Do("SMEMBERS", s.key(redisExternalMetricsKey)))
+	if err != nil {
+		glog.Errorf("Failed to list external metrics from redis: %v", err)
+		return nil
+	}
+
+	metricsInfo := make([]provider.ExternalMetricInfo, 0, len(metricNames))
+	for _, metricName := range metricNames {
+		metricsInfo = append(metricsInfo, provider.ExternalMetricInfo{
+			Metric: metricName,
+		})
+	}
+	return metricsInfo
+}
+
+// ListStoredMetrics lists all metric series in the store, including expired
+// series which weren't removed yet.
+func (s *RedisMetricStore) ListStoredMetrics() []StoredMetric {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	now := time.Now().UTC()
+	metrics := make([]StoredMetric, 0)
+
+	customNames, err := redis.Strings(conn.Do("SMEMBERS", s.key(redisCustomMetricsKey)))
+	if err != nil {
+		glog.Errorf("Failed to list custom metrics from redis: %v", err)
+	}
+	for _, metricName := range customNames {
+		series, err := s.customMetrics(conn, metricName)
+		if err != nil {
+			glog.Errorf("Failed to get custom metric %s from redis: %v", metricName, err)
+			continue
+		}
+		for _, metric := range series {
+			metrics = append(metrics, metric.describe(now))
+		}
+	}
+
+	externalNames, err := redis.Strings(conn.Do("SMEMBERS", s.key(redisExternalMetricsKey)))
+	if err != nil {
+		glog.Errorf("Failed to list external metrics from redis: %v", err)
+	}
+	for _, metricName := range externalNames {
+		series, err := s.externalMetrics(conn, metricName)
+		if err != nil {
+			glog.Errorf("Failed to get external metric %s from redis: %v", metricName, err)
+			continue
+		}
+		for _, metric := range series {
+			metrics = append(metrics, metric.describe(now))
+		}
+	}
+
+	sortStoredMetrics(metrics)
+	return metrics
+}
+
+// RemoveExpired removes metrics from the store which expired more than the
+// expired retention ago. Metrics which expired more recently are kept
+// to report when they expired.
+func (s *RedisMetricStore) RemoveExpired() {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	s.RLock()
+	cutoff := time.Now().UTC().Add(-s.expiredRetention)
+	s.RUnlock()
+
+	for _, kind := range []string{redisCustomMetricsKey, redisExternalMetricsKey} {
+		metricNames, err := redis.Strings(conn.Do("SMEMBERS", s.key(kind)))
+		if err != nil {
+			glog.Errorf("Failed to list %s metrics from redis: %v", kind, err)
+			continue
+		}
+
+		for _, metricName := range metricNames {
+			err := s.removeExpired(conn, kind, metricName, cutoff)
+			if err != nil {
+				glog.Errorf("Failed to remove expired %s metric %s from redis: %v", kind, metricName, err)
+			}
+		}
+	}
+}
+
+// removeExpired removes the values of a metric which expired before the
+// cutoff and forgets the metric if no values are left.
+func (s *RedisMetricStore) removeExpired(conn redis.Conn, kind, metricName string, cutoff time.Time) error {
+	key := s.key(kind, metricName)
+
+	values, err := redis.StringMap(conn.Do("HGETALL", key))
+	if err != nil {
+		return err
+	}
+
+	expired := []interface{}{key}
+	for field, data := range values {
+		// only the TTL is needed, which both kinds of stored metrics
+		// have.
+		var metric struct {
+			TTL time.Time
+		}
+		err := json.Unmarshal([]byte(data), &metric)
+		if err != nil || metric.TTL.Before(cutoff) {
+			expired = append(expired, field)
+		}
+	}
+
+	if len(expired) > 1 {
+		_, err = conn.Do("HDEL", expired...)
+		if err != nil {
+			return err
+		}
+		// the kinds are the metric types of the store metrics.
+		metricStoreExpirations.WithLabelValues(kind).Add(float64(len(expired) - 1))
+	}
+
+	if len(expired)-1 == len(values) {
+		_, err = conn.Do("SREM", s.key(kind), metricName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close closes the connections to the Redis server.
+func (s *RedisMetricStore) Close() error {
+	return s.pool.Close()
+}
@@ -0,0 +1,517 @@
+package provider
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// replicationMethod is the full name of the client streaming gRPC
+	// method the leader pushes metric store inserts with.
+	replicationMethod = "/kubemetricsadapter.Replication/Replicate"
+	// replicationBuffer is the number of collections buffered per peer.
+	// Collections are dropped for peers which can't keep up.
+	replicationBuffer = 100
+	// replicationResolveInterval is the interval the peers are resolved
+	// at.
+	replicationResolveInterval = 30 * time.Second
+	// replicationRetryInterval is the time waited before reconnecting to
+	// a peer after the stream failed.
+	replicationRetryInterval = 5 * time.Second
+)
+
+// ReplicationConfig configures the replication of the metric store from the
+// leader to the standby replicas.
+type ReplicationConfig struct {
+	// Address is the address the replication server listens on.
+	Address string
+	// Peers is a host:port whose host resolves to the addresses of all
+	// replicas, e.g. a headless service. The addresses of this replica
+	// are skipped.
+	Peers string
+	// TokenFile is the path of a file containing a token shared by all
+	// replicas. The leader sends it with each stream and streams without
+	// it are rejected.
+	TokenFile string
+	// CertFile and KeyFile are the certificate the replicas serve and
+	// connect to their peers with. CAFile is the CA the certificates of
+	// both the servers and the clients are verified with. The server
+	// certificates must be valid for the host of Peers.
+	CertFile string
+	KeyFile  string
+	CAFile   string
+}
+
+// Validate returns an error if the replication isn't authenticated by either
+// mutual TLS or a shared token.
+func (c *ReplicationConfig) Validate() error {
+	tlsFiles := 0
+	for _, file := range []string{c.CertFile, c.KeyFile, c.CAFile} {
+		if file != "" {
+			tlsFiles++
+		}
+	}
+
+	switch {
+	case tlsFiles != 0 && tlsFiles != 3:
+		return fmt.Errorf("mutual TLS for replication requires a certificate, a key and a CA")
+	case tlsFiles == 0 && c.TokenFile == "":
+		return fmt.Errorf("replication requires mutual TLS or a shared token")
+	}
+	return nil
+}
+
+// tlsConfig returns the TLS config of the replication server and clients,
+// or nil if TLS isn't configured. Clients must present a certificate signed
+// by the CA.
+func (c *ReplicationConfig) tlsConfig() (*tls.Config, error) {
+	if c.CertFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load replication certificate: %v", err)
+	}
+
+	ca, err := ioutil.ReadFile(c.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read replication CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates found in replication CA %s", c.CAFile)
+	}
+
+	host, _, err := net.SplitHostPort(c.Peers)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peers '%s': %v", c.Peers, err)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		RootCAs:      pool,
+		ServerName:   host,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// token reads the shared token of the replicas. It's read for each stream,
+// such that the token can be rotated.
+func (c *ReplicationConfig) token() (string, error) {
+	if c.TokenFile == "" {
+		return "", nil
+	}
+
+	token, err := ioutil.ReadFile(c.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read replication token: %v", err)
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+// authenticate returns an Unauthenticated error if the shared token is
+// configured and the stream doesn't carry it.
+func (c *ReplicationConfig) authenticate(ctx context.Context) error {
+	token, err := c.token()
+	if err != nil {
+		glog.Errorf("Failed to authenticate replication stream: %v", err)
+		return status.Error(codes.Internal, "failed to authenticate replication stream")
+	}
+	if token == "" {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		if subtle.ConstantTimeCompare([]byte(value), []byte("Bearer "+token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid replication token")
+}
+
+// replicationMessage is a message of the replication stream. The first
+// message of a stream carries a snapshot of the metric store of the leader,
+// the following messages the collected metrics inserted into it.
+type replicationMessage struct {
+	Snapshot []byte                      `json:"snapshot,omitempty"`
+	Values   []collector.CollectedMetric `json:"values,omitempty"`
+	Config   *collector.MetricConfig     `json:"config,omitempty"`
+}
+
+// replicationCodec encodes the replication messages as JSON, such that no
+// generated protobuf code is needed.
+type replicationCodec struct{}
+
+func (replicationCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (replicationCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (replicationCodec) String() string {
+	return "json"
+}
+
+// replicationHandler is implemented by the replication server.
+type replicationHandler interface {
+	replicate(stream grpc.ServerStream) error
+}
+
+// replicationServiceDesc describes the replication gRPC service.
+var replicationServiceDesc = grpc.ServiceDesc{
+	ServiceName: "kubemetricsadapter.Replication",
+	HandlerType: (*replicationHandler)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Replicate",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				return srv.(replicationHandler).replicate(stream)
+			},
+			ClientStreams: true,
+		},
+	},
+}
+
+// EnableReplication enables the replication of the metric store. All
+// replicas serve the replication stream on the configured address, while
+// the leader pushes the metrics it collects to all peers.
+func (p *HPAProvider) EnableReplication(config *ReplicationConfig) {
+	p.replicator = newReplicator(config)
+	for _, cluster := range p.clusters {
+		cluster.replicator = p.replicator
+	}
+}
+
+// runReplicationServer serves the replication stream until the context is
+// canceled. Standby replicas insert the received metrics into their store.
+func (p *HPAProvider) runReplicationServer(ctx context.Context) {
+	options := []grpc.ServerOption{grpc.CustomCodec(replicationCodec{})}
+	tlsConfig, err := p.replicator.config.tlsConfig()
+	if err != nil {
+		glog.Errorf("Failed to serve metric store replication: %v", err)
+		return
+	}
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	server := grpc.NewServer(options...)
+	server.RegisterService(&replicationServiceDesc, &replicationServer{provider: p})
+
+	go func() {
+		<-ctx.Done()
+		server.Stop()
+	}()
+
+	// remove expired metrics also while standby, when the garbage
+	// collection of the metric collection isn't running.
+	go func() {
+		for {
+			select {
+			case <-time.After(p.gcInterval):
+				if p.health.isStandby() {
+					p.metricStore.RemoveExpired()
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	listener, err := net.Listen("tcp", p.replicator.config.Address)
+	if err != nil {
+		glog.Errorf("Failed to listen on replication address %s: %v", p.replicator.config.Address, err)
+		return
+	}
+
+	glog.Infof("Serving metric store replication on %s", p.replicator.config.Address)
+	err = server.Serve(listener)
+	if err != nil {
+		glog.Errorf("Failed to serve metric store replication: %v", err)
+	}
+}
+
+// replicationServer receives the metrics pushed by the leader.
+type replicationServer struct {
+	provider *HPAProvider
+}
+
+// replicate receives a replication stream until the leader closes it. The
+// received metrics are only inserted while this replica is a standby, such
+// that the store of the leader is only written by its own collectors.
+func (s *replicationServer) replicate(stream grpc.ServerStream) error {
+	err := s.provider.replicator.config.authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	restored := false
+	defer func() {
+		if restored {
+			s.provider.health.replicationStopped()
+		}
+	}()
+
+	for {
+		var message replicationMessage
+		err := stream.RecvMsg(&message)
+		if err == io.EOF {
+			return stream.SendMsg(&struct{}{})
+		}
+		if err != nil {
+			return err
+		}
+
+		if !s.provider.health.isStandby() {
+			return status.Error(codes.FailedPrecondition, "metric store is only replicated to standby replicas")
+		}
+
+		if message.Snapshot != nil {
+			snapshotter, ok := s.provider.metricStore.(metricStoreSnapshotter)
+			if ok {
+				err := snapshotter.Restore(message.Snapshot)
+				if err != nil {
+					glog.Errorf("Failed to restore replicated metric store snapshot: %v", err)
+				} else if !restored {
+					restored = true
+					s.provider.health.replicationStarted()
+				}
+			}
+		}
+
+		if len(message.Values) > 0 {
+			s.provider.insertCollection(message.Values, message.Config)
+		}
+	}
+}
+
+// replicator pushes the collected metrics of the leader to its peers.
+type replicator struct {
+	config *ReplicationConfig
+	peers  map[string]chan replicationMessage
+	sync.Mutex
+}
+
+// newReplicator initializes a new replicator.
+func newReplicator(config *ReplicationConfig) *replicator {
+	return &replicator{
+		config: config,
+		peers:  make(map[string]chan replicationMessage),
+	}
+}
+
+// push queues collected metrics for all peers. The metrics are dropped for
+// peers whose queue is full.
+func (r *replicator) push(values []collector.CollectedMetric, config *collector.MetricConfig) {
+	r.Lock()
+	defer r.Unlock()
+
+	message := replicationMessage{Values: values, Config: replicatedConfig(config)}
+	for address, queue := range r.peers {
+		select {
+		case queue <- message:
+		default:
+			glog.Warningf("Dropping replicated metrics for peer %s, replication queue is full", address)
+		}
+	}
+}
+
+// replicatedConfig returns the metric config sent to the peers along with the
+// collected metrics. The collector config is dropped, as it may contain
+// credentials read from Secrets and the metric store only needs the settings
+// of how the values are stored.
+func replicatedConfig(config *collector.MetricConfig) *collector.MetricConfig {
+	if config == nil {
+		return nil
+	}
+
+	replicated := *config
+	replicated.Config = nil
+	return &replicated
+}
+
+// runReplication resolves the peers and pushes the collected metrics to
+// them until the context is canceled. It's only run by the leader.
+func (p *HPAProvider) runReplication(ctx context.Context) {
+	r := p.replicator
+	cancels := make(map[string]context.CancelFunc)
+
+	defer func() {
+		r.Lock()
+		defer r.Unlock()
+		for address, cancel := range cancels {
+			cancel()
+			delete(r.peers, address)
+		}
+	}()
+
+	for {
+		addresses, err := r.resolvePeers()
+		if err != nil {
+			glog.Errorf("Failed to resolve replication peers: %v", err)
+		} else {
+			r.Lock()
+			for address := range addresses {
+				if _, ok := r.peers[address]; ok {
+					continue
+				}
+				queue := make(chan replicationMessage, replicationBuffer)
+				peerCtx, cancel := context.WithCancel(ctx)
+				r.peers[address] = queue
+				cancels[address] = cancel
+				go p.replicateTo(peerCtx, address, queue)
+			}
+			for address, cancel := range cancels {
+				if _, ok := addresses[address]; !ok {
+					cancel()
+					delete(cancels, address)
+					delete(r.peers, address)
+				}
+			}
+			r.Unlock()
+		}
+
+		select {
+		case <-time.After(replicationResolveInterval):
+		case <-ctx.Done():
+			glog.Info("Stopped metric store replication.")
+			return
+		}
+	}
+}
+
+// resolvePeers returns the addresses of the peers, skipping the addresses
+// of this replica.
+func (r *replicator) resolvePeers() (map[string]struct{}, error) {
+	host, port, err := net.SplitHostPort(r.config.Peers)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peers '%s': %v", r.config.Peers, err)
+	}
+
+	ips, err := net.LookupHost(host)
+	if err != nil {
+		return nil, err
+	}
+
+	local := make(map[string]struct{})
+	interfaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range interfaceAddrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			local[ipNet.IP.String()] = struct{}{}
+		}
+	}
+
+	addresses := make(map[string]struct{}, len(ips))
+	for _, ip := range ips {
+		if _, ok := local[ip]; ok {
+			continue
+		}
+		addresses[net.JoinHostPort(ip, port)] = struct{}{}
+	}
+	return addresses, nil
+}
+
+// replicateTo streams the queued metrics to a peer until the context is
+// canceled, reconnecting if the stream fails. Each stream starts with a
+// snapshot of the metric store.
+func (p *HPAProvider) replicateTo(ctx context.Context, address string, queue chan replicationMessage) {
+	for {
+		err := p.stream(ctx, address, queue)
+		if err != nil {
+			glog.Errorf("Failed to replicate metric store to peer %s: %v", address, err)
+		}
+
+		select {
+		case <-time.After(replicationRetryInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// stream opens a replication stream to a peer and sends the snapshot of the
+// metric store followed by the queued metrics.
+func (p *HPAProvider) stream(ctx context.Context, address string, queue chan replicationMessage) error {
+	config := p.replicator.config
+	options := []grpc.DialOption{grpc.WithCodec(replicationCodec{})}
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		options = append(options, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		options = append(options, grpc.WithInsecure())
+	}
+
+	token, err := config.token()
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+
+	conn, err := grpc.DialContext(ctx, address, options...)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stream, err := conn.NewStream(ctx, &replicationServiceDesc.Streams[0], replicationMethod)
+	if err != nil {
+		return err
+	}
+
+	if snapshotter, ok := p.metricStore.(metricStoreSnapshotter); ok {
+		snapshot, err := snapshotter.Snapshot()
+		if err != nil {
+			return fmt.Errorf("failed to snapshot metric store: %v", err)
+		}
+
+		err = stream.SendMsg(&replicationMessage{Snapshot: snapshot})
+		if err != nil {
+			return err
+		}
+	}
+
+	glog.Infof("Replicating metric store to peer %s", address)
+	for {
+		select {
+		case message := <-queue:
+			err := stream.SendMsg(&message)
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
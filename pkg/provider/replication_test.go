@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestReplicationConfigValidate(t *testing.T) {
+	for _, tc := range []struct {
+		msg    string
+		config ReplicationConfig
+		err    bool
+	}{
+		{
+			msg:    "unauthenticated",
+			config: ReplicationConfig{},
+			err:    true,
+		},
+		{
+			msg:    "shared token",
+			config: ReplicationConfig{TokenFile: "/secrets/token"},
+		},
+		{
+			msg:    "mutual TLS",
+			config: ReplicationConfig{CertFile: "tls.crt", KeyFile: "tls.key", CAFile: "ca.crt"},
+		},
+		{
+			msg:    "TLS without CA",
+			config: ReplicationConfig{CertFile: "tls.crt", KeyFile: "tls.key"},
+			err:    true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			err := tc.config.Validate()
+			if tc.err && err == nil {
+				t.Error("expected error")
+			}
+			if !tc.err && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestReplicationConfigAuthenticate(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	err := ioutil.WriteFile(tokenFile, []byte("secret\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ReplicationConfig{TokenFile: tokenFile}
+
+	for _, tc := range []struct {
+		msg   string
+		token string
+		code  codes.Code
+	}{
+		{
+			msg:   "valid token",
+			token: "Bearer secret",
+			code:  codes.OK,
+		},
+		{
+			msg:   "invalid token",
+			token: "Bearer guess",
+			code:  codes.Unauthenticated,
+		},
+		{
+			msg:  "no token",
+			code: codes.Unauthenticated,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.token != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", tc.token))
+			}
+
+			err := config.authenticate(ctx)
+			if code := status.Code(err); code != tc.code {
+				t.Errorf("expected code %s, got %s", tc.code, code)
+			}
+		})
+	}
+}
+
+func TestReplicatedConfig(t *testing.T) {
+	config := &collector.MetricConfig{
+		Config:      map[string]string{"query": "up", "token": "secret"},
+		Deduplicate: true,
+	}
+
+	replicated := replicatedConfig(config)
+	if replicated.Config != nil {
+		t.Errorf("expected collector config not to be replicated, got %v", replicated.Config)
+	}
+	if !replicated.Deduplicate {
+		t.Error("expected storage settings to be replicated")
+	}
+	if config.Config["token"] != "secret" {
+		t.Error("expected the config of the collector to be unchanged")
+	}
+	if replicatedConfig(nil) != nil {
+		t.Error("expected nil config to stay nil")
+	}
+}
@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"sort"
+
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/metrics/pkg/apis/custom_metrics"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+// PodResourceMetrics returns the collected pod metrics in the shape of the
+// resource metrics API (metrics.k8s.io) for tools which can only consume
+// resource metrics. The mapping defines which custom metric is reported as
+// which resource. As the collected metrics are per pod, each pod is reported
+// with a single container named like the pod. The values collected for
+// ContainerResource metrics are additionally reported as the usage of their
+// container. If namespace is "" the metrics of all namespaces are returned.
+func (p *HPAProvider) PodResourceMetrics(namespace string, mapping map[v1.ResourceName]string) *metricsv1beta1.PodMetricsList {
+	podMetrics := make(map[string]*metricsv1beta1.PodMetrics)
+
+	// values of ContainerResource metrics are only reported for their
+	// container.
+	notContainer, _ := labels.NewRequirement(collector.ContainerLabel, selection.DoesNotExist, nil)
+	for resourceName, metricName := range mapping {
+		for _, value := range p.podResourceValues(metricName, namespace, labels.NewSelector().Add(*notContainer)) {
+			p.addContainerUsage(podMetrics, value, value.DescribedObject.Name, resourceName)
+		}
+	}
+
+	for resourceName, containers := range p.storedContainers(namespace) {
+		for _, container := range containers {
+			selector := labels.SelectorFromSet(labels.Set{collector.ContainerLabel: container})
+			for _, value := range p.podResourceValues(string(resourceName), namespace, selector) {
+				p.addContainerUsage(podMetrics, value, container, resourceName)
+			}
+		}
+	}
+
+	list := &metricsv1beta1.PodMetricsList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "PodMetricsList",
+			APIVersion: metricsv1beta1.SchemeGroupVersion.String(),
+		},
+		Items: make([]metricsv1beta1.PodMetrics, 0, len(podMetrics)),
+	}
+
+	for _, metrics := range podMetrics {
+		list.Items = append(list.Items, *metrics)
+	}
+
+	sort.Slice(list.Items, func(i, j int) bool {
+		if list.Items[i].Namespace != list.Items[j].Namespace {
+			return list.Items[i].Namespace < list.Items[j].Namespace
+		}
+		return list.Items[i].Name < list.Items[j].Name
+	})
+
+	return list
+}
+
+// podResourceValues returns the stored values of a pod metric in the
+// namespaces allowed by the namespace filter.
+func (p *HPAProvider) podResourceValues(metricName, namespace string, selector labels.Selector) []custom_metrics.MetricValue {
+	values := p.metricStore.GetMetricsBySelector(metricName, schema.GroupResource{Resource: "pods"}, namespace, selector, labels.Everything())
+	if values == nil {
+		return nil
+	}
+
+	allowed := make([]custom_metrics.MetricValue, 0, len(values.Items))
+	for _, value := range values.Items {
+		if p.namespaceFilter.Allowed(value.DescribedObject.Namespace) {
+			allowed = append(allowed, value)
+		}
+	}
+	return allowed
+}
+
+// storedContainers returns the containers for which ContainerResource
+// metrics are stored per resource.
+func (p *HPAProvider) storedContainers(namespace string) map[v1.ResourceName][]string {
+	seen := make(map[v1.ResourceName]map[string]struct{})
+	for _, metric := range p.metricStore.ListStoredMetrics() {
+		container, ok := metric.Labels[collector.ContainerLabel]
+		if !ok || metric.Type != autoscalingv2.PodsMetricSourceType || metric.Expired {
+			continue
+		}
+		if namespace != "" && metric.Namespace != namespace {
+			continue
+		}
+		resourceName := v1.ResourceName(metric.Metric)
+		if seen[resourceName] == nil {
+			seen[resourceName] = make(map[string]struct{})
+		}
+		seen[resourceName][container] = struct{}{}
+	}
+
+	containers := make(map[v1.ResourceName][]string, len(seen))
+	for _, resourceName := range collector.ContainerResources {
+		for container := range seen[resourceName] {
+			containers[resourceName] = append(containers[resourceName], container)
+		}
+	}
+	return containers
+}
+
+// addContainerUsage adds a value as the usage of a resource by a container
+// to the metrics of its pod.
+func (p *HPAProvider) addContainerUsage(podMetrics map[string]*metricsv1beta1.PodMetrics, value custom_metrics.MetricValue, container string, resourceName v1.ResourceName) {
+	key := value.DescribedObject.Namespace + "/" + value.DescribedObject.Name
+	metrics, ok := podMetrics[key]
+	if !ok {
+		metrics = &metricsv1beta1.PodMetrics{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      value.DescribedObject.Name,
+				Namespace: value.DescribedObject.Namespace,
+			},
+			Timestamp: value.Timestamp,
+			Window:    metav1.Duration{Duration: p.collectorInterval},
+		}
+		podMetrics[key] = metrics
+	}
+
+	// report the oldest timestamp of the combined values.
+	if value.Timestamp.Before(&metrics.Timestamp) {
+		metrics.Timestamp = value.Timestamp
+	}
+
+	for i := range metrics.Containers {
+		if metrics.Containers[i].Name == container {
+			metrics.Containers[i].Usage[resourceName] = value.Value
+			return
+		}
+	}
+	metrics.Containers = append(metrics.Containers, metricsv1beta1.ContainerMetrics{
+		Name:  container,
+		Usage: v1.ResourceList{resourceName: value.Value},
+	})
+}
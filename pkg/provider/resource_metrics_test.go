@@ -0,0 +1,61 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	"k8s.io/api/core/v1"
+)
+
+// containerValue returns a pod value collected for a ContainerResource
+// metric of the container.
+func containerValue(pod, resourceName, container string, value int64) collector.CollectedMetric {
+	metric := podValue(pod, value, map[string]string{collector.ContainerLabel: container})
+	metric.Custom.Metric.Name = resourceName
+	return metric
+}
+
+func TestPodResourceMetrics(t *testing.T) {
+	p := &HPAProvider{
+		metricStore:       NewInMemoryMetricStore(time.Minute),
+		collectorInterval: time.Minute,
+	}
+
+	requests := podValue("pod-a", 5, nil)
+	p.metricStore.InsertAll([]collector.CollectedMetric{requests}, &collector.MetricConfig{})
+	p.metricStore.InsertAll([]collector.CollectedMetric{
+		containerValue("pod-a", "cpu", "app", 2),
+		containerValue("pod-b", "cpu", "app", 3),
+	}, &collector.MetricConfig{})
+	p.metricStore.InsertAll([]collector.CollectedMetric{containerValue("pod-a", "memory", "app", 100)}, &collector.MetricConfig{})
+
+	list := p.PodResourceMetrics("default", map[v1.ResourceName]string{v1.ResourceCPU: requests.Custom.Metric.Name})
+	if len(list.Items) != 2 {
+		t.Fatalf("expected metrics of 2 pods, got %v", list.Items)
+	}
+
+	podA := list.Items[0]
+	if podA.Name != "pod-a" || len(podA.Containers) != 2 {
+		t.Fatalf("expected the mapped and the container usage of pod-a, got %v", podA)
+	}
+	for _, container := range podA.Containers {
+		switch container.Name {
+		case "pod-a":
+			if container.Usage.Cpu().Value() != 5 {
+				t.Errorf("expected the mapped cpu usage 5, got %v", container.Usage)
+			}
+		case "app":
+			if container.Usage.Cpu().Value() != 2 || container.Usage.Memory().Value() != 100 {
+				t.Errorf("expected the container usage of cpu 2 and memory 100, got %v", container.Usage)
+			}
+		default:
+			t.Errorf("unexpected container %s", container.Name)
+		}
+	}
+
+	podB := list.Items[1]
+	if podB.Name != "pod-b" || len(podB.Containers) != 1 || podB.Containers[0].Name != "app" || podB.Containers[0].Usage.Cpu().Value() != 3 {
+		t.Errorf("expected the container usage of pod-b, got %v", podB)
+	}
+}
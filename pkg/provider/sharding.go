@@ -0,0 +1,59 @@
+package provider
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// Shard identifies the subset of HPAs an adapter instance owns when HPAs
+// are sharded across multiple instances.
+type Shard struct {
+	Index int
+	Count int
+}
+
+// NewShard initializes a new Shard.
+func NewShard(index, count int) (*Shard, error) {
+	if count < 1 || index < 0 || index >= count {
+		return nil, fmt.Errorf("invalid shard %d of %d shards", index, count)
+	}
+
+	return &Shard{
+		Index: index,
+		Count: count,
+	}, nil
+}
+
+// Owns returns true if the HPA is owned by the shard. HPAs are assigned to
+// shards using rendezvous hashing, so when the number of shards changes
+// only the HPAs of the added or removed shards are reassigned.
+func (s *Shard) Owns(namespace, name string) bool {
+	if s == nil || s.Count <= 1 {
+		return true
+	}
+
+	owner := 0
+	var maxWeight uint64
+	for i := 0; i < s.Count; i++ {
+		h := fnv.New64a()
+		fmt.Fprintf(h, "%d/%s/%s", i, namespace, name)
+		weight := h.Sum64()
+		if i == 0 || weight > maxWeight {
+			owner = i
+			maxWeight = weight
+		}
+	}
+
+	return owner == s.Index
+}
+
+// SetHPASelector restricts the discovered HPAs to the HPAs matching the
+// label selector.
+func (p *HPAProvider) SetHPASelector(selector string) {
+	p.hpaSelector = selector
+}
+
+// SetShard restricts the discovered HPAs to the HPAs owned by the shard.
+func (p *HPAProvider) SetShard(shard *Shard) {
+	p.shard = shard
+}
@@ -0,0 +1,124 @@
+package provider
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// maxSmoothingSamples limits the number of samples kept per metric, such
+// that a long smoothing window combined with a short collection interval
+// doesn't grow the store unbounded.
+const maxSmoothingSamples = 1000
+
+// metricSample is a collected value of a metric.
+type metricSample struct {
+	// MilliValue is the value in milli units.
+	MilliValue int64     `json:"milliValue"`
+	Time       time.Time `json:"time"`
+}
+
+// smoothingPolicy defines how the samples of a metric collected within the
+// window are aggregated into the served value. The fields are exported such
+// that the policy can be stored along with the metric in a shared metric
+// store.
+type smoothingPolicy struct {
+	Window   time.Duration `json:"window"`
+	Function string        `json:"function"`
+}
+
+// newSmoothingPolicy returns the smoothing policy of a metric config or nil
+// if none is configured.
+func newSmoothingPolicy(config *collector.MetricConfig) *smoothingPolicy {
+	if config == nil || config.SmoothingWindow == 0 {
+		return nil
+	}
+
+	function := config.SmoothingFunction
+	if function == "" {
+		function = collector.SmoothingFunctionAvg
+	}
+
+	return &smoothingPolicy{
+		Window:   config.SmoothingWindow,
+		Function: function,
+	}
+}
+
+// samples appends the value collected at the specified time to the previous
+// samples and drops the samples which are no longer within the window. It
+// returns nil if no policy is configured.
+func (p *smoothingPolicy) samples(previous []metricSample, value resource.Quantity, now time.Time) []metricSample {
+	if p == nil {
+		return nil
+	}
+
+	start := now.Add(-p.Window)
+	samples := make([]metricSample, 0, len(previous)+1)
+	for _, sample := range previous {
+		if sample.Time.After(start) {
+			samples = append(samples, sample)
+		}
+	}
+	samples = append(samples, metricSample{MilliValue: value.MilliValue(), Time: now})
+
+	if len(samples) > maxSmoothingSamples {
+		samples = samples[len(samples)-maxSmoothingSamples:]
+	}
+	return samples
+}
+
+// value returns the aggregation of the samples within the window at the
+// specified time. The value is returned as is if no policy is configured or
+// no samples are within the window.
+func (p *smoothingPolicy) value(value resource.Quantity, samples []metricSample, now time.Time) resource.Quantity {
+	if p == nil {
+		return value
+	}
+
+	start := now.Add(-p.Window)
+	values := make([]int64, 0, len(samples))
+	for _, sample := range samples {
+		if sample.Time.After(start) {
+			values = append(values, sample.MilliValue)
+		}
+	}
+
+	if len(values) == 0 {
+		return value
+	}
+
+	var aggregated int64
+	switch p.Function {
+	case collector.SmoothingFunctionMin:
+		aggregated = values[0]
+		for _, v := range values[1:] {
+			if v < aggregated {
+				aggregated = v
+			}
+		}
+	case collector.SmoothingFunctionMax:
+		aggregated = values[0]
+		for _, v := range values[1:] {
+			if v > aggregated {
+				aggregated = v
+			}
+		}
+	case collector.SmoothingFunctionP95:
+		sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+		// nearest rank percentile.
+		rank := int(math.Ceil(0.95*float64(len(values)))) - 1
+		aggregated = values[rank]
+	default:
+		var sum int64
+		for _, v := range values {
+			sum += v
+		}
+		aggregated = sum / int64(len(values))
+	}
+
+	return *resource.NewMilliQuantity(aggregated, value.Format)
+}
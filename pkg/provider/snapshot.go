@@ -0,0 +1,357 @@
+package provider
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+)
+
+// snapshotConfigMapKey is the key of the binary data of the snapshot
+// ConfigMap holding the gzipped snapshot.
+const snapshotConfigMapKey = "snapshot.json.gz"
+
+// SnapshotStorage stores snapshots of the metric store.
+type SnapshotStorage interface {
+	// Load loads the last saved snapshot. It returns nil if no
+	// snapshot was saved yet.
+	Load() ([]byte, error)
+	// Save saves a snapshot, replacing the last saved snapshot.
+	Save(snapshot []byte) error
+}
+
+// metricStoreSnapshotter is implemented by metric stores which can be
+// snapshotted. Stores which persist the metrics themselves don't need to.
+type metricStoreSnapshotter interface {
+	Snapshot() ([]byte, error)
+	Restore(snapshot []byte) error
+}
+
+// metricStoreSnapshot is the serialized form of the in-memory metric store.
+type metricStoreSnapshot struct {
+	Custom   []customMetricsStoredMetric   `json:"custom"`
+	External []externalMetricsStoredMetric `json:"external"`
+}
+
+// Snapshot returns a snapshot of all metrics in the store which haven't
+// expired yet.
+func (s *InMemoryMetricStore) Snapshot() ([]byte, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	now := time.Now().UTC()
+
+	var snapshot metricStoreSnapshot
+	for _, groups := range s.customMetricsStore {
+		for _, namespaces := range groups {
+			for _, resources := range namespaces {
+				for _, metric := range resources {
+					if metric.TTL.After(now) {
+						snapshot.Custom = append(snapshot.Custom, metric)
+					}
+				}
+			}
+		}
+	}
+
+	for _, metrics := range s.externalMetricsStore {
+		for _, metric := range metrics {
+			if metric.TTL.After(now) {
+				snapshot.External = append(snapshot.External, metric)
+			}
+		}
+	}
+
+	return json.Marshal(snapshot)
+}
+
+// Restore inserts the metrics of a snapshot into the store. Metrics which
+// expired since the snapshot was taken are skipped and metrics already in
+// the store are not overwritten.
+func (s *InMemoryMetricStore) Restore(data []byte) error {
+	var snapshot metricStoreSnapshot
+	err := json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to decode snapshot: %v", err)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now().UTC()
+
+	for _, metric := range snapshot.Custom {
+		if !metric.TTL.After(now) {
+			continue
+		}
+
+		object := metric.Value.DescribedObject
+		groupResource := describedGroupResource(object)
+
+		metrics, ok := s.customMetricsStore[metric.Value.Metric.Name]
+		if !ok {
+			metrics = make(map[schema.GroupResource]map[string]map[customObjectKey]customMetricsStoredMetric)
+			s.customMetricsStore[metric.Value.Metric.Name] = metrics
+		}
+
+		group, ok := metrics[groupResource]
+		if !ok {
+			group = make(map[string]map[customObjectKey]customMetricsStoredMetric)
+			metrics[groupResource] = group
+		}
+
+		namespace, ok := group[object.Namespace]
+		if !ok {
+			namespace = make(map[customObjectKey]customMetricsStoredMetric)
+			group[object.Namespace] = namespace
+		}
+
+		key := customObjectKey{Name: object.Name, Selector: valueSelector(metric.Value)}
+		if _, ok := namespace[key]; !ok {
+			namespace[key] = metric
+			s.customLabelIndex.add(metric.Value.Metric.Name, customMetricID(groupResource, object.Namespace, object.Name, key.Selector), metric.Labels)
+			s.touch(storeEntryKey{customMetricKey: customMetricKey{
+				MetricName:    metric.Value.Metric.Name,
+				GroupResource: groupResource,
+				Namespace:     object.Namespace,
+				Name:          object.Name,
+				Selector:      key.Selector,
+			}}, customMetricSize(metric))
+		}
+	}
+
+	for _, metric := range snapshot.External {
+		if !metric.TTL.After(now) {
+			continue
+		}
+
+		metrics, ok := s.externalMetricsStore[metric.Value.MetricName]
+		if !ok {
+			metrics = make(map[string]externalMetricsStoredMetric)
+			s.externalMetricsStore[metric.Value.MetricName] = metrics
+		}
+
+		labelsKey := hashLabelMap(metric.Value.MetricLabels)
+		if _, ok := metrics[labelsKey]; !ok {
+			metrics[labelsKey] = metric
+			s.externalLabelIndex.add(metric.Value.MetricName, labelsKey, metric.Value.MetricLabels)
+			s.touch(storeEntryKey{
+				customMetricKey: customMetricKey{MetricName: metric.Value.MetricName},
+				External:        true,
+				LabelsKey:       labelsKey,
+			}, externalMetricSize(metric))
+		}
+	}
+
+	return nil
+}
+
+// FileSnapshotStorage stores snapshots in a file, e.g. on a persistent
+// volume.
+type FileSnapshotStorage struct {
+	path string
+}
+
+// NewFileSnapshotStorage initializes a new FileSnapshotStorage.
+func NewFileSnapshotStorage(path string) *FileSnapshotStorage {
+	return &FileSnapshotStorage{
+		path: path,
+	}
+}
+
+// Load loads the snapshot from the file.
+func (s *FileSnapshotStorage) Load() ([]byte, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// Save writes the snapshot to a temporary file which is then renamed to the
+// snapshot file, such that a partially written snapshot is never loaded.
+func (s *FileSnapshotStorage) Save(snapshot []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(snapshot)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// ConfigMapSnapshotStorage stores gzipped snapshots in a ConfigMap. As
+// ConfigMaps are limited to 1MiB it's only suitable for a moderate number
+// of metrics.
+type ConfigMapSnapshotStorage struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// NewConfigMapSnapshotStorage initializes a new ConfigMapSnapshotStorage.
+func NewConfigMapSnapshotStorage(client kubernetes.Interface, namespace, name string) *ConfigMapSnapshotStorage {
+	return &ConfigMapSnapshotStorage{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+// Load loads the snapshot from the ConfigMap.
+func (s *ConfigMapSnapshotStorage) Load() ([]byte, error) {
+	configMap, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(context.TODO(), s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := configMap.BinaryData[snapshotConfigMapKey]
+	if !ok {
+		return nil, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
+
+// Save saves the snapshot to the ConfigMap, creating it if it doesn't exist.
+func (s *ConfigMapSnapshotStorage) Save(snapshot []byte) error {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, err := writer.Write(snapshot)
+	if err != nil {
+		return err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	configMaps := s.client.CoreV1().ConfigMaps(s.namespace)
+	configMap, err := configMaps.Get(context.TODO(), s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = configMaps.Create(context.TODO(), &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: s.namespace,
+				Name:      s.name,
+			},
+			BinaryData: map[string][]byte{
+				snapshotConfigMapKey: buf.Bytes(),
+			},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if configMap.BinaryData == nil {
+		configMap.BinaryData = make(map[string][]byte)
+	}
+	configMap.BinaryData[snapshotConfigMapKey] = buf.Bytes()
+
+	_, err = configMaps.Update(context.TODO(), configMap, metav1.UpdateOptions{})
+	return err
+}
+
+// EnableSnapshots enables periodically saving snapshots of the metric store
+// to the storage at the specified interval. The last snapshot is restored
+// when the provider is run, such that the metrics are served before the
+// collectors ran. Only the provider collecting the metrics saves snapshots.
+func (p *HPAProvider) EnableSnapshots(storage SnapshotStorage, interval time.Duration) {
+	p.snapshotStorage = storage
+	p.snapshotInterval = interval
+}
+
+// restoreSnapshot restores the last snapshot into the metric store.
+func (p *HPAProvider) restoreSnapshot() {
+	snapshotter, ok := p.metricStore.(metricStoreSnapshotter)
+	if !ok {
+		glog.Warning("Metric store doesn't support snapshots, not restoring snapshot.")
+		return
+	}
+
+	data, err := p.snapshotStorage.Load()
+	if err != nil {
+		glog.Errorf("Failed to load metric store snapshot: %v", err)
+		return
+	}
+
+	if data == nil {
+		glog.Info("No metric store snapshot to restore.")
+		return
+	}
+
+	err = snapshotter.Restore(data)
+	if err != nil {
+		glog.Errorf("Failed to restore metric store snapshot: %v", err)
+		return
+	}
+	glog.Info("Restored metric store snapshot.")
+}
+
+// saveSnapshot saves a snapshot of the metric store.
+func (p *HPAProvider) saveSnapshot() {
+	snapshotter, ok := p.metricStore.(metricStoreSnapshotter)
+	if !ok {
+		return
+	}
+
+	data, err := snapshotter.Snapshot()
+	if err != nil {
+		glog.Errorf("Failed to take metric store snapshot: %v", err)
+		return
+	}
+
+	err = p.snapshotStorage.Save(data)
+	if err != nil {
+		glog.Errorf("Failed to save metric store snapshot: %v", err)
+	}
+}
+
+// runSnapshots saves a snapshot of the metric store at the snapshot interval
+// and a final one when the context is canceled.
+func (p *HPAProvider) runSnapshots(ctx context.Context) {
+	for {
+		select {
+		case <-time.After(p.snapshotInterval):
+			p.saveSnapshot()
+		case <-ctx.Done():
+			p.saveSnapshot()
+			glog.Info("Stopped metric store snapshots.")
+			return
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package provider
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+)
+
+// servesStale returns true if the stale behavior of the metric serves values
+// while its collector is failing.
+func servesStale(config *collector.MetricConfig) bool {
+	switch config.StaleBehavior {
+	case collector.StaleBehaviorHold, collector.StaleBehaviorZero, collector.StaleBehaviorValue:
+		return true
+	}
+	return false
+}
+
+// staleValues returns the values substituted for the series of the last
+// complete collection of a failing collector according to the stale
+// behavior of its metric. Nothing is substituted before the first complete
+// collection, as the series to substitute are unknown.
+func staleValues(c *scheduledCollector, resourceRef resourceReference, err error) []collector.CollectedMetric {
+	if len(c.lastValues) == 0 || !servesStale(c.config) {
+		return nil
+	}
+
+	values, subErr := collector.StaleValues(c.lastValues, c.config)
+	if subErr != nil {
+		glog.Errorf("Failed to substitute values of metric '%s' of HPA %s: %v", c.config.Name, resourceRef, subErr)
+		return nil
+	}
+
+	glog.V(1).Infof("Collection of metric '%s' of HPA %s failed, serving %d value(s) with stale behavior %s: %v", c.config.Name, resourceRef, len(values), c.config.StaleBehavior, err)
+	return values
+}
+
+// serveStale sends the stale values of a collector whose circuit is open
+// without querying its backend and returns the time to wait before the next
+// collection, at most the end of the cooldown when the backend is probed
+// again. It's only scheduled during the cooldown for metrics whose stale
+// behavior serves values.
+func (t *CollectorScheduler) serveStale(c *scheduledCollector, refs []resourceReference) time.Duration {
+	err := fmt.Errorf("circuit of metric '%s' is open after %d consecutive failures", c.config.Name, c.consecutiveFailures)
+	t.metricSink <- c.collection(refs, staleValues(c, refs[0], err), err)
+
+	wait := time.Until(c.breaker.until)
+	if interval := t.adaptInterval(c.collector.Interval(), refs); interval < wait {
+		wait = interval
+	}
+	return wait
+}
@@ -0,0 +1,133 @@
+package provider
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStaleBehavior(t *testing.T) {
+	target := resource.MustParse("10")
+	failure := fmt.Errorf("backend unavailable")
+
+	for _, tc := range []struct {
+		msg      string
+		config   collector.MetricConfig
+		breaker  *CircuitBreakerConfig
+		complete bool
+		expected []int64
+	}{
+		{
+			msg:      "error substitutes nothing",
+			config:   collector.MetricConfig{StaleBehavior: collector.StaleBehaviorError},
+			complete: true,
+		},
+		{
+			msg:    "nothing substituted before a complete collection",
+			config: collector.MetricConfig{StaleBehavior: collector.StaleBehaviorHold},
+		},
+		{
+			msg:      "hold",
+			config:   collector.MetricConfig{StaleBehavior: collector.StaleBehaviorHold},
+			complete: true,
+			expected: []int64{5},
+		},
+		{
+			msg:      "value",
+			config:   collector.MetricConfig{StaleBehavior: collector.StaleBehaviorValue, StaleValue: 20},
+			complete: true,
+			expected: []int64{20},
+		},
+		{
+			msg:      "value with utilization",
+			config:   collector.MetricConfig{StaleBehavior: collector.StaleBehaviorValue, StaleValue: 20, Utilization: true, Target: &target},
+			complete: true,
+			expected: []int64{20, 2},
+		},
+		{
+			msg:      "zero while the circuit is open",
+			config:   collector.MetricConfig{StaleBehavior: collector.StaleBehaviorZero},
+			breaker:  &CircuitBreakerConfig{Threshold: 1, Cooldown: time.Hour},
+			complete: true,
+			expected: []int64{0},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			scheduler, metricsc := newTestScheduler()
+			scheduler.circuitBreaker = tc.breaker
+
+			config := tc.config
+			config.MetricTypeName = collector.MetricTypeName{Type: autoscalingv2.ExternalMetricSourceType, Name: "queue"}
+			var metricCollector collector.Collector = &fakeCollector{values: []collector.CollectedMetric{externalValue("queue", 5)}}
+			fake := metricCollector.(*fakeCollector)
+			if config.Utilization {
+				metricCollector = collector.NewUtilizationCollector(metricCollector, target)
+			}
+			c := scheduler.schedule(resourceReference{Name: "hpa", Namespace: "default"}, &config, metricCollector, nil)
+
+			if tc.complete {
+				scheduler.collect(c)
+				<-metricsc
+			}
+
+			fake.values, fake.err = nil, failure
+			wait := scheduler.collect(c)
+			collection := <-metricsc
+
+			if tc.breaker != nil {
+				if !c.breaker.paused(time.Now()) {
+					t.Fatalf("expected circuit to be open")
+				}
+				if wait > c.collector.Interval() {
+					t.Errorf("expected stale values to be served at the interval while the circuit is open, waiting %s", wait)
+				}
+
+				// the backend isn't queried while the circuit is
+				// open.
+				fake.err = fmt.Errorf("unexpected query")
+				scheduler.collect(c)
+				collection = <-metricsc
+				if collection.Error == nil || collection.Error.Error() == fake.err.Error() {
+					t.Fatalf("expected circuit open error, got %v", collection.Error)
+				}
+			}
+
+			if collection.Error == nil {
+				t.Fatalf("expected the collection error to be reported")
+			}
+			if len(collection.Values) != len(tc.expected) {
+				t.Fatalf("expected %d values, got %d", len(tc.expected), len(collection.Values))
+			}
+			for i, value := range collection.Values {
+				if value.External.Value.Value() != tc.expected[i] {
+					t.Errorf("expected value %d, got %s", tc.expected[i], value.External.Value.String())
+				}
+			}
+		})
+	}
+}
+
+func TestStaleValuesCountTowardsQuota(t *testing.T) {
+	p := NewHPAProvider(fake.NewSimpleClientset(), time.Minute, time.Minute, nil, nil)
+	p.SetNamespaceQuota(NewNamespaceQuota(0, 1))
+	config := &collector.MetricConfig{
+		MetricTypeName: collector.MetricTypeName{Type: autoscalingv2.ExternalMetricSourceType, Name: "queue"},
+		StaleBehavior:  collector.StaleBehaviorHold,
+	}
+
+	p.storeCollection(metricCollection{
+		Values: []collector.CollectedMetric{labeledExternalValue("queue", 1, map[string]string{"queue": "a"}), labeledExternalValue("queue", 2, map[string]string{"queue": "b"})},
+		Error:  fmt.Errorf("backend unavailable"),
+		Config: config,
+		HPA:    resourceReference{Name: "hpa", Namespace: "default"},
+	})
+
+	if metrics := p.metricStore.(*InMemoryMetricStore).ListStoredMetrics(); len(metrics) != 0 {
+		t.Errorf("expected substituted values exceeding the quota to be rejected, got %d stored series", len(metrics))
+	}
+}
@@ -0,0 +1,82 @@
+package provider
+
+import (
+	"math"
+	"time"
+
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// defaultMetricTTL is the time a metric is served for after it was last
+// collected if neither a TTL nor a staleness policy is configured.
+const defaultMetricTTL = 15 * time.Minute
+
+// stalenessPolicy defines for how long the last value of a metric is served
+// when collection fails and how it decays in the meantime. The fields are
+// exported such that the policy can be stored along with the metric in a
+// shared metric store.
+type stalenessPolicy struct {
+	Interval  time.Duration `json:"interval"`
+	Intervals int           `json:"intervals"`
+	Decay     float64       `json:"decay,omitempty"`
+}
+
+// newStalenessPolicy returns the staleness policy of a metric config or nil
+// if none is configured. The collector interval is used if the config
+// doesn't define an interval.
+func newStalenessPolicy(config *collector.MetricConfig, collectorInterval time.Duration) *stalenessPolicy {
+	if config == nil || config.StaleIntervals == 0 {
+		return nil
+	}
+
+	interval := config.Interval
+	if interval == 0 {
+		interval = collectorInterval
+	}
+
+	return &stalenessPolicy{
+		Interval:  interval,
+		Intervals: config.StaleIntervals,
+		Decay:     config.StaleDecay,
+	}
+}
+
+// ttl returns the time until a metric collected at the specified time is
+// served. The value is served for the current interval plus the configured
+// number of missed intervals.
+func (p *stalenessPolicy) ttl(collected time.Time) time.Time {
+	return collected.Add(time.Duration(p.Intervals+1) * p.Interval)
+}
+
+// metricTTL returns the time until a metric collected at the specified time
+// is served. A TTL defined in the metric config takes precedence over the
+// staleness policy, which takes precedence over the default TTL.
+func metricTTL(config *collector.MetricConfig, staleness *stalenessPolicy, defaultTTL time.Duration, collected time.Time) time.Time {
+	if config != nil && config.TTL > 0 {
+		return collected.Add(config.TTL)
+	}
+
+	if staleness != nil {
+		return staleness.ttl(collected)
+	}
+
+	return collected.Add(defaultTTL)
+}
+
+// value returns the value of a metric collected at the specified time,
+// reduced by the decay for each fully missed collection interval.
+func (p *stalenessPolicy) value(value resource.Quantity, collected, now time.Time) resource.Quantity {
+	if p == nil || p.Decay == 0 {
+		return value
+	}
+
+	// the collection of the current interval is not missed yet.
+	missed := int(now.Sub(collected)/p.Interval) - 1
+	if missed <= 0 {
+		return value
+	}
+
+	decayed := float64(value.MilliValue()) * math.Pow(1-p.Decay, float64(missed))
+	return *resource.NewMilliQuantity(int64(decayed), value.Format)
+}
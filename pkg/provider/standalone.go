@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// standaloneNamePrefix prefixes the names standalone metrics are scheduled
+// under, such that they can't clash with HPA names.
+const standaloneNamePrefix = "standalone:"
+
+// StandaloneMetric is an external metric collected without an HPA
+// referencing it.
+type StandaloneMetric struct {
+	// Namespace is the namespace the metric is served in.
+	Namespace string `json:"namespace"`
+	// Name is the name of the external metric.
+	Name string `json:"name"`
+	// Collector is the name of the collector, as in the metric-config
+	// annotations.
+	Collector string `json:"collector"`
+	// Labels are the labels of the metric, as in the metric selector of
+	// an HPA.
+	Labels map[string]string `json:"labels"`
+	// Config are the keys of the metric-config annotations, e.g. query
+	// or interval.
+	Config map[string]string `json:"config"`
+}
+
+// LoadStandaloneMetrics loads standalone metrics from a YAML or JSON file.
+func LoadStandaloneMetrics(path string) ([]StandaloneMetric, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var metrics []StandaloneMetric
+	err = yaml.Unmarshal(data, &metrics)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse standalone metrics: %v", err)
+	}
+
+	// standalone metrics are scheduled by namespace and name, so a
+	// second metric with the same name would replace the first one.
+	seen := make(map[string]struct{}, len(metrics))
+	for _, metric := range metrics {
+		if metric.Namespace == "" || metric.Name == "" {
+			return nil, fmt.Errorf("standalone metrics must define a namespace and name")
+		}
+
+		key := metric.Namespace + "/" + metric.Name
+		if _, ok := seen[key]; ok {
+			return nil, fmt.Errorf("standalone metric %s is defined more than once", key)
+		}
+		seen[key] = struct{}{}
+	}
+
+	return metrics, nil
+}
+
+// SetStandaloneMetrics sets the metrics which are collected independent of
+// any HPA.
+func (p *HPAProvider) SetStandaloneMetrics(metrics []StandaloneMetric) {
+	p.standaloneMetrics = metrics
+}
+
+// hpa returns an HPA referencing the standalone metric with its config
+// defined as annotations, such that the metric is set up the same way as
+// metrics of discovered HPAs.
+func (m StandaloneMetric) hpa() *autoscalingv2.HorizontalPodAutoscaler {
+	annotations := make(map[string]string, len(m.Config))
+	for key, value := range m.Config {
+		annotations[fmt.Sprintf("metric-config.external.%s.%s/%s", m.Name, m.Collector, key)] = value
+	}
+
+	return &autoscalingv2.HorizontalPodAutoscaler{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: autoscalingv2.SchemeGroupVersion.String(),
+			Kind:       "HorizontalPodAutoscaler",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   m.Namespace,
+			Name:        standaloneNamePrefix + m.Name,
+			Annotations: annotations,
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			Metrics: []autoscalingv2.MetricSpec{
+				{
+					Type: autoscalingv2.ExternalMetricSourceType,
+					External: &autoscalingv2.ExternalMetricSource{
+						Metric: autoscalingv2.MetricIdentifier{
+							Name:     m.Name,
+							Selector: &metav1.LabelSelector{MatchLabels: m.Labels},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// scheduleStandaloneMetrics sets up the collectors of the standalone
+// metrics. Metrics which can't be set up are logged and skipped.
+func (p *HPAProvider) scheduleStandaloneMetrics() {
+	for _, metric := range p.standaloneMetrics {
+		hpa := metric.hpa()
+		if !p.shard.Owns(hpa.Namespace, hpa.Name) {
+			continue
+		}
+
+		resourceRef := resourceReference{
+			Name:      hpa.Name,
+			Namespace: hpa.Namespace,
+		}
+
+		metricConfigs, err := collector.ParseHPAMetrics(hpa)
+		if err != nil {
+			glog.Errorf("Failed to parse standalone metric %s/%s: %v", metric.Namespace, metric.Name, err)
+			continue
+		}
+
+		for _, config := range metricConfigs {
+			interval := config.Interval
+			if interval == 0 {
+				interval = p.collectorInterval
+			}
+
+			metricCollector, err := p.collectorFactory.NewCollector(hpa, config, interval)
+			if err != nil {
+				glog.Errorf("Failed to create collector for standalone metric %s/%s: %v", metric.Namespace, metric.Name, err)
+				continue
+			}
+
+			glog.Infof("Adding metrics collector for standalone metric %s/%s: %T", metric.Namespace, metric.Name, metricCollector)
+			p.collectorScheduler.Add(resourceRef, config, metricCollector)
+		}
+	}
+}
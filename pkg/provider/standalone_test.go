@@ -0,0 +1,64 @@
+package provider
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadStandaloneMetrics(t *testing.T) {
+	for _, tc := range []struct {
+		msg     string
+		metrics string
+		err     bool
+	}{
+		{
+			msg: "unique names",
+			metrics: `
+- namespace: myapp
+  name: queue-length
+- namespace: other
+  name: queue-length
+- namespace: myapp
+  name: job-queue
+`,
+		},
+		{
+			msg: "duplicate name",
+			metrics: `
+- namespace: myapp
+  name: queue-length
+  labels:
+    queue-name: foo
+- namespace: myapp
+  name: queue-length
+  labels:
+    queue-name: bar
+`,
+			err: true,
+		},
+		{
+			msg: "missing namespace",
+			metrics: `
+- name: queue-length
+`,
+			err: true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "metrics.yaml")
+			err := ioutil.WriteFile(path, []byte(tc.metrics), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = LoadStandaloneMetrics(path)
+			if tc.err && err == nil {
+				t.Error("expected error")
+			}
+			if !tc.err && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
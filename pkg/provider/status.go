@@ -0,0 +1,276 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// statusAnnotation is the annotation the collection status is reported in
+// on the HPA.
+const statusAnnotation = "kube-metrics-adapter/status"
+
+// statusRefreshInterval is the interval at which the status of an HPA is
+// reported again if only the collection times changed.
+const statusRefreshInterval = 10 * time.Minute
+
+// HPAStatus is the collection status of the metrics of an HPA.
+type HPAStatus struct {
+	Metrics []MetricStatus `json:"metrics"`
+}
+
+// MetricStatus is the collection status of a single metric.
+type MetricStatus struct {
+	Type           string     `json:"type"`
+	Name           string     `json:"name"`
+	Collector      string     `json:"collector,omitempty"`
+	Healthy        bool       `json:"healthy"`
+	LastCollection *time.Time `json:"lastCollection,omitempty"`
+	LastSuccess    *time.Time `json:"lastSuccess,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+}
+
+// statusReporter records the collection status of the metrics of all HPAs
+// and periodically reports it as annotation on the HPAs.
+type statusReporter struct {
+	client   kubernetes.Interface
+	interval time.Duration
+	statuses map[resourceReference]map[collector.MetricTypeName]*MetricStatus
+	reported map[resourceReference]reportedStatus
+	sync.Mutex
+}
+
+// reportedStatus is the last status reported for an HPA.
+type reportedStatus struct {
+	// signature is the encoded status without collection times.
+	signature string
+	time      time.Time
+}
+
+// encodedStatus is the encoded status of an HPA to be reported.
+type encodedStatus struct {
+	status    string
+	signature string
+}
+
+// newStatusReporter initializes a new statusReporter.
+func newStatusReporter(client kubernetes.Interface, interval time.Duration) *statusReporter {
+	return &statusReporter{
+		client:   client,
+		interval: interval,
+		statuses: make(map[resourceReference]map[collector.MetricTypeName]*MetricStatus),
+		reported: make(map[resourceReference]reportedStatus),
+	}
+}
+
+// EnableStatusReporting enables reporting the collection status of the
+// metrics of an HPA as annotation on the HPA at the specified interval.
+func (p *HPAProvider) EnableStatusReporting(interval time.Duration) {
+	p.statusReporter = newStatusReporter(p.client, interval)
+}
+
+// record records the result of a collection.
+func (r *statusReporter) record(resourceRef resourceReference, config *collector.MetricConfig, err error) {
+	r.Lock()
+	defer r.Unlock()
+
+	metrics, ok := r.statuses[resourceRef]
+	if !ok {
+		metrics = make(map[collector.MetricTypeName]*MetricStatus)
+		r.statuses[resourceRef] = metrics
+	}
+
+	status, ok := metrics[config.MetricTypeName]
+	if !ok {
+		status = &MetricStatus{
+			Type:      string(config.Type),
+			Name:      config.Name,
+			Collector: config.CollectorName,
+		}
+		metrics[config.MetricTypeName] = status
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	status.LastCollection = &now
+	status.Healthy = err == nil
+	if err != nil {
+		status.LastError = err.Error()
+	} else {
+		status.LastSuccess = &now
+		status.LastError = ""
+	}
+}
+
+// remove removes the status of an HPA.
+func (r *statusReporter) remove(resourceRef resourceReference) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.statuses, resourceRef)
+	delete(r.reported, resourceRef)
+}
+
+// removeMetric removes the status of a single metric of an HPA.
+func (r *statusReporter) removeMetric(resourceRef resourceReference, metric collector.MetricTypeName) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.statuses[resourceRef], metric)
+}
+
+// retain removes the status of all metrics of an HPA which are not
+// configured anymore.
+func (r *statusReporter) retain(resourceRef resourceReference, configs []*collector.MetricConfig) {
+	r.Lock()
+	defer r.Unlock()
+
+	configured := make(map[collector.MetricTypeName]struct{}, len(configs))
+	for _, config := range configs {
+		configured[config.MetricTypeName] = struct{}{}
+	}
+
+	for metric := range r.statuses[resourceRef] {
+		if _, ok := configured[metric]; !ok {
+			delete(r.statuses[resourceRef], metric)
+		}
+	}
+}
+
+// run reports the status at the interval until the context is canceled.
+func (r *statusReporter) run(ctx context.Context) {
+	for {
+		select {
+		case <-time.After(r.interval):
+			r.report(ctx)
+		case <-ctx.Done():
+			glog.Info("Stopped HPA status reporting.")
+			return
+		}
+	}
+}
+
+// report patches the status annotation of all HPAs whose status changed
+// since the last report. Statuses where only the collection times changed
+// are reported at most every statusRefreshInterval, such that HPAs aren't
+// patched on every collection.
+func (r *statusReporter) report(ctx context.Context) {
+	for resourceRef, status := range r.changedStatuses(time.Now()) {
+		err := r.patch(ctx, resourceRef, status.status)
+		if err != nil {
+			if !apierrors.IsNotFound(err) {
+				glog.Errorf("Failed to report status of HPA %s: %v", resourceRef, err)
+			}
+			continue
+		}
+
+		r.Lock()
+		// skip HPAs removed while patching.
+		if _, ok := r.statuses[resourceRef]; ok {
+			r.reported[resourceRef] = reportedStatus{
+				signature: status.signature,
+				time:      time.Now(),
+			}
+		}
+		r.Unlock()
+	}
+}
+
+// changedStatuses returns the encoded statuses of all HPAs which changed
+// since the last report or whose last report is older than the refresh
+// interval.
+func (r *statusReporter) changedStatuses(now time.Time) map[resourceReference]encodedStatus {
+	r.Lock()
+	defer r.Unlock()
+
+	changed := make(map[resourceReference]encodedStatus)
+	for resourceRef, metrics := range r.statuses {
+		status := HPAStatus{Metrics: make([]MetricStatus, 0, len(metrics))}
+		for _, metric := range metrics {
+			status.Metrics = append(status.Metrics, *metric)
+		}
+		sort.Slice(status.Metrics, func(i, j int) bool {
+			if status.Metrics[i].Type != status.Metrics[j].Type {
+				return status.Metrics[i].Type < status.Metrics[j].Type
+			}
+			return status.Metrics[i].Name < status.Metrics[j].Name
+		})
+
+		data, err := json.Marshal(status)
+		if err != nil {
+			glog.Errorf("Failed to encode status of HPA %s: %v", resourceRef, err)
+			continue
+		}
+
+		signature, err := statusSignature(status)
+		if err != nil {
+			glog.Errorf("Failed to encode status of HPA %s: %v", resourceRef, err)
+			continue
+		}
+
+		reported, ok := r.reported[resourceRef]
+		if ok && reported.signature == signature && now.Sub(reported.time) < statusRefreshInterval {
+			continue
+		}
+		changed[resourceRef] = encodedStatus{status: string(data), signature: signature}
+	}
+	return changed
+}
+
+// statusSignature encodes a status without the collection times, such that
+// it only differs if the health or the errors of the metrics changed.
+func statusSignature(status HPAStatus) (string, error) {
+	metrics := make([]MetricStatus, 0, len(status.Metrics))
+	for _, metric := range status.Metrics {
+		metric.LastCollection = nil
+		metric.LastSuccess = nil
+		metrics = append(metrics, metric)
+	}
+
+	data, err := json.Marshal(HPAStatus{Metrics: metrics})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// patch sets the status annotation of an HPA. The annotation is patched via
+// the autoscaling/v1 API which is served by all clusters.
+func (r *statusReporter) patch(ctx context.Context, resourceRef resourceReference, status string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				statusAnnotation: status,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.AutoscalingV1().HorizontalPodAutoscalers(resourceRef.Namespace).Patch(ctx, resourceRef.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// withoutStatusAnnotation returns the annotations without the status
+// annotation or nil if no other annotations are defined. The passed
+// annotations are not modified.
+func withoutStatusAnnotation(annotations map[string]string) map[string]string {
+	var filtered map[string]string
+	for key, value := range annotations {
+		if key == statusAnnotation {
+			continue
+		}
+		if filtered == nil {
+			filtered = make(map[string]string, len(annotations))
+		}
+		filtered[key] = value
+	}
+	return filtered
+}
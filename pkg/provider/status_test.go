@@ -0,0 +1,153 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func statusMetricConfig(name string) *collector.MetricConfig {
+	return &collector.MetricConfig{
+		MetricTypeName: collector.MetricTypeName{Type: autoscalingv2.ExternalMetricSourceType, Name: name},
+		CollectorName:  "prometheus",
+	}
+}
+
+func TestStatusReporterChangedStatuses(t *testing.T) {
+	resourceRef := resourceReference{Name: "hpa", Namespace: "default"}
+	config := statusMetricConfig("jobs")
+	now := time.Now()
+
+	for _, tc := range []struct {
+		msg      string
+		update   func(r *statusReporter)
+		elapsed  time.Duration
+		expected bool
+	}{
+		{
+			msg:      "unchanged status",
+			update:   func(r *statusReporter) {},
+			elapsed:  time.Minute,
+			expected: false,
+		},
+		{
+			msg: "only collection times changed",
+			update: func(r *statusReporter) {
+				later := now.Add(time.Minute)
+				r.statuses[resourceRef][config.MetricTypeName].LastCollection = &later
+				r.statuses[resourceRef][config.MetricTypeName].LastSuccess = &later
+			},
+			elapsed:  time.Minute,
+			expected: false,
+		},
+		{
+			msg: "only collection times changed after the refresh interval",
+			update: func(r *statusReporter) {
+				later := now.Add(time.Minute)
+				r.statuses[resourceRef][config.MetricTypeName].LastCollection = &later
+			},
+			elapsed:  statusRefreshInterval,
+			expected: true,
+		},
+		{
+			msg: "collection failed",
+			update: func(r *statusReporter) {
+				r.record(resourceRef, config, errors.New("query returned no data"))
+			},
+			elapsed:  time.Minute,
+			expected: true,
+		},
+		{
+			msg: "metric removed",
+			update: func(r *statusReporter) {
+				r.retain(resourceRef, nil)
+			},
+			elapsed:  time.Minute,
+			expected: true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			r := newStatusReporter(fake.NewSimpleClientset(), time.Minute)
+			r.record(resourceRef, config, nil)
+			for ref, status := range r.changedStatuses(now) {
+				r.reported[ref] = reportedStatus{signature: status.signature, time: now}
+			}
+
+			tc.update(r)
+			_, changed := r.changedStatuses(now.Add(tc.elapsed))[resourceRef]
+			if changed != tc.expected {
+				t.Errorf("expected changed %t, got %t", tc.expected, changed)
+			}
+		})
+	}
+}
+
+func TestStatusReporterRetain(t *testing.T) {
+	resourceRef := resourceReference{Name: "hpa", Namespace: "default"}
+	r := newStatusReporter(fake.NewSimpleClientset(), time.Minute)
+	r.record(resourceRef, statusMetricConfig("jobs"), nil)
+	r.record(resourceRef, statusMetricConfig("queue"), nil)
+
+	r.retain(resourceRef, []*collector.MetricConfig{statusMetricConfig("queue")})
+
+	if len(r.statuses[resourceRef]) != 1 {
+		t.Fatalf("expected a single metric status, got %v", r.statuses[resourceRef])
+	}
+	if _, ok := r.statuses[resourceRef][statusMetricConfig("queue").MetricTypeName]; !ok {
+		t.Errorf("expected the status of the configured metric to be kept")
+	}
+}
+
+func TestStatusReporterReport(t *testing.T) {
+	client := fake.NewSimpleClientset(&autoscalingv1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "default"},
+	})
+	resourceRef := resourceReference{Name: "hpa", Namespace: "default"}
+	r := newStatusReporter(client, time.Minute)
+	r.record(resourceRef, statusMetricConfig("jobs"), nil)
+
+	r.report(context.Background())
+	r.record(resourceRef, statusMetricConfig("jobs"), nil)
+	r.report(context.Background())
+
+	patches := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "patch" {
+			patches++
+		}
+	}
+	if patches != 1 {
+		t.Errorf("expected a single patch, got %d", patches)
+	}
+
+	hpa, err := client.AutoscalingV1().HorizontalPodAutoscalers("default").Get(context.Background(), "hpa", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hpa.Annotations[statusAnnotation] == "" {
+		t.Error("expected the status annotation to be set")
+	}
+}
+
+func TestStatusReporterRemoveMetric(t *testing.T) {
+	resourceRef := resourceReference{Name: "hpa", Namespace: "default"}
+	r := newStatusReporter(fake.NewSimpleClientset(), time.Minute)
+	r.record(resourceRef, statusMetricConfig("jobs"), nil)
+	r.record(resourceRef, statusMetricConfig("queue"), nil)
+
+	r.removeMetric(resourceRef, statusMetricConfig("jobs").MetricTypeName)
+
+	if _, ok := r.statuses[resourceRef][statusMetricConfig("jobs").MetricTypeName]; ok {
+		t.Error("expected the status of the removed metric to be dropped")
+	}
+	if len(r.statuses[resourceRef]) != 1 {
+		t.Errorf("expected a single metric status, got %v", r.statuses[resourceRef])
+	}
+}
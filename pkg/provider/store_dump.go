@@ -0,0 +1,158 @@
+package provider
+
+import (
+	"sort"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+)
+
+// StoredMetric describes a metric series in the metric store for
+// troubleshooting.
+type StoredMetric struct {
+	Type   autoscalingv2.MetricSourceType `json:"type"`
+	Metric string                         `json:"metric"`
+	// Namespace, Kind and Name describe the object of custom metrics.
+	Namespace string `json:"namespace,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name,omitempty"`
+	// Labels are the labels of the object of custom metrics and the
+	// metric labels of external metrics.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Value is the value currently served for the series.
+	Value     string    `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
+	// TTLRemaining is the time the series is served for until it
+	// expires. It's negative for expired series which weren't removed
+	// from the store yet.
+	TTLRemaining string `json:"ttlRemaining"`
+	Expired      bool   `json:"expired"`
+	// ExpiredAt is the time expired series expired. Their value is the
+	// last collected value, which is only served with the serve-last
+	// expired metric policy.
+	ExpiredAt *time.Time `json:"expiredAt,omitempty"`
+}
+
+// describe returns the description of a stored custom metric.
+func (m customMetricsStoredMetric) describe(now time.Time) StoredMetric {
+	value := m.served(now)
+	object := value.DescribedObject
+	metricType := autoscalingv2.ObjectMetricSourceType
+	if object.Kind == "Pod" {
+		metricType = autoscalingv2.PodsMetricSourceType
+	}
+
+	return StoredMetric{
+		Type:         metricType,
+		Metric:       value.Metric.Name,
+		Namespace:    object.Namespace,
+		Kind:         object.Kind,
+		Name:         object.Name,
+		Labels:       m.Labels,
+		Value:        value.Value.String(),
+		Timestamp:    value.Timestamp.Time,
+		TTLRemaining: m.TTL.Sub(now).Round(time.Second).String(),
+		Expired:      !m.TTL.After(now),
+		ExpiredAt:    expiredAt(m.TTL, now),
+	}
+}
+
+// describe returns the description of a stored external metric.
+func (m externalMetricsStoredMetric) describe(now time.Time) StoredMetric {
+	value := m.served(now)
+	return StoredMetric{
+		Type:         autoscalingv2.ExternalMetricSourceType,
+		Metric:       value.MetricName,
+		Labels:       value.MetricLabels,
+		Value:        value.Value.String(),
+		Timestamp:    value.Timestamp.Time,
+		TTLRemaining: m.TTL.Sub(now).Round(time.Second).String(),
+		Expired:      !m.TTL.After(now),
+		ExpiredAt:    expiredAt(m.TTL, now),
+	}
+}
+
+// describe returns the description of a custom metric which expired and was
+// removed from the store.
+func (m expiredCustomMetric) describe(now time.Time) StoredMetric {
+	metric := customMetricsStoredMetric{Value: m.Value, Labels: m.Labels, TTL: m.ExpiredAt}
+	return metric.describe(now)
+}
+
+// describe returns the description of an external metric which expired and
+// was removed from the store.
+func (m expiredExternalMetric) describe(now time.Time) StoredMetric {
+	metric := externalMetricsStoredMetric{Value: m.Value, TTL: m.ExpiredAt}
+	return metric.describe(now)
+}
+
+// expiredAt returns the TTL of a series if it expired.
+func expiredAt(ttl, now time.Time) *time.Time {
+	if ttl.After(now) {
+		return nil
+	}
+	return &ttl
+}
+
+// sortStoredMetrics sorts stored metrics by type, metric, namespace, name
+// and labels.
+func sortStoredMetrics(metrics []StoredMetric) {
+	sort.Slice(metrics, func(i, j int) bool {
+		a, b := metrics[i], metrics[j]
+		switch {
+		case a.Type != b.Type:
+			return a.Type < b.Type
+		case a.Metric != b.Metric:
+			return a.Metric < b.Metric
+		case a.Namespace != b.Namespace:
+			return a.Namespace < b.Namespace
+		case a.Name != b.Name:
+			return a.Name < b.Name
+		}
+		return hashLabelMap(a.Labels) < hashLabelMap(b.Labels)
+	})
+}
+
+// ListStoredMetrics lists all metric series in the store, including expired
+// series which weren't removed yet and the series the store remembers after
+// they expired.
+func (s *InMemoryMetricStore) ListStoredMetrics() []StoredMetric {
+	s.RLock()
+	defer s.RUnlock()
+
+	now := time.Now().UTC()
+	metrics := make([]StoredMetric, 0, s.lru.Len())
+	for _, groups := range s.customMetricsStore {
+		for _, namespaces := range groups {
+			for _, resources := range namespaces {
+				for _, metric := range resources {
+					metrics = append(metrics, metric.describe(now))
+				}
+			}
+		}
+	}
+
+	for _, series := range s.externalMetricsStore {
+		for _, metric := range series {
+			metrics = append(metrics, metric.describe(now))
+		}
+	}
+
+	for _, metric := range s.expiredCustomMetrics {
+		metrics = append(metrics, metric.describe(now))
+	}
+
+	for _, series := range s.expiredExternalMetrics {
+		for _, metric := range series {
+			metrics = append(metrics, metric.describe(now))
+		}
+	}
+
+	sortStoredMetrics(metrics)
+	return metrics
+}
+
+// StoredMetrics lists all metric series in the metric store.
+func (p *HPAProvider) StoredMetrics() []StoredMetric {
+	return p.metricStore.ListStoredMetrics()
+}
@@ -0,0 +1,195 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// storedMetricOverhead is the estimated size in bytes of a stored
+	// metric without its variable length fields.
+	storedMetricOverhead = 512
+	// metricSampleSize is the estimated size in bytes of a sample kept
+	// for smoothing.
+	metricSampleSize = 32
+)
+
+var (
+	metricStoreEntries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "kube_metrics_adapter_metric_store_entries",
+		Help: "Number of metric series in the in-memory metric store.",
+	})
+	metricStoreBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "kube_metrics_adapter_metric_store_bytes",
+		Help: "Estimated size in bytes of the metric series in the in-memory metric store.",
+	})
+	metricStoreEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kube_metrics_adapter_metric_store_evictions_total",
+		Help: "Number of metric series evicted from the in-memory metric store because it was full.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(metricStoreEntries, metricStoreBytes, metricStoreEvictions)
+}
+
+// storeEntryKey identifies a metric series in the in-memory metric store.
+type storeEntryKey struct {
+	customMetricKey
+	// External is set for external metrics, which are identified by
+	// MetricName and LabelsKey.
+	External  bool
+	LabelsKey string
+}
+
+// storeEntry is an element of the least recently collected list of the
+// in-memory metric store.
+type storeEntry struct {
+	key  storeEntryKey
+	size int
+}
+
+// SetLimits limits the number of metric series and their estimated size in
+// bytes kept in the store. If a limit is exceeded the least recently
+// collected series are evicted. A limit of 0 disables it.
+func (s *InMemoryMetricStore) SetLimits(maxEntries, maxBytes int) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.maxEntries = maxEntries
+	s.maxBytes = maxBytes
+	s.evict()
+}
+
+// SetMetricStoreLimits limits the size of the in-memory metric store, see
+// InMemoryMetricStore.SetLimits.
+func (p *HPAProvider) SetMetricStoreLimits(maxEntries, maxBytes int) error {
+	store, ok := p.metricStore.(*InMemoryMetricStore)
+	if !ok {
+		return fmt.Errorf("metric store doesn't support limits")
+	}
+	store.SetLimits(maxEntries, maxBytes)
+	return nil
+}
+
+// touch marks a series as most recently collected and updates its size.
+// The caller must hold the write lock.
+func (s *InMemoryMetricStore) touch(key storeEntryKey, size int) {
+	if element, ok := s.entries[key]; ok {
+		entry := element.Value.(*storeEntry)
+		s.bytes += size - entry.size
+		entry.size = size
+		s.lru.MoveToBack(element)
+	} else {
+		s.entries[key] = s.lru.PushBack(&storeEntry{key: key, size: size})
+		s.bytes += size
+	}
+
+	s.evict()
+	s.updateSizeMetrics()
+}
+
+// forget removes a series from the least recently collected list. The
+// caller must hold the write lock.
+func (s *InMemoryMetricStore) forget(key storeEntryKey) {
+	element, ok := s.entries[key]
+	if !ok {
+		return
+	}
+
+	s.bytes -= element.Value.(*storeEntry).size
+	s.lru.Remove(element)
+	delete(s.entries, key)
+	s.updateSizeMetrics()
+}
+
+// evict removes the least recently collected series until the store is
+// within its limits. The caller must hold the write lock.
+func (s *InMemoryMetricStore) evict() {
+	for s.lru.Len() > 0 && ((s.maxEntries > 0 && s.lru.Len() > s.maxEntries) || (s.maxBytes > 0 && s.bytes > s.maxBytes)) {
+		entry := s.lru.Front().Value.(*storeEntry)
+		glog.V(1).Infof("Evicting metric '%s' from full metric store", entry.key.MetricName)
+		s.remove(entry.key)
+		s.forget(entry.key)
+		metricStoreEvictions.Inc()
+	}
+}
+
+// remove removes a series from the store. The caller must hold the write
+// lock.
+func (s *InMemoryMetricStore) remove(key storeEntryKey) {
+	if key.External {
+		metrics, ok := s.externalMetricsStore[key.MetricName]
+		if !ok {
+			return
+		}
+		if metric, ok := metrics[key.LabelsKey]; ok {
+			s.externalLabelIndex.remove(key.MetricName, key.LabelsKey, metric.Value.MetricLabels)
+		}
+		delete(metrics, key.LabelsKey)
+		if len(metrics) == 0 {
+			delete(s.externalMetricsStore, key.MetricName)
+		}
+		return
+	}
+
+	groups, ok := s.customMetricsStore[key.MetricName]
+	if !ok {
+		return
+	}
+
+	namespaces, ok := groups[key.GroupResource]
+	if !ok {
+		return
+	}
+
+	resources, ok := namespaces[key.Namespace]
+	if !ok {
+		return
+	}
+
+	object := customObjectKey{Name: key.Name, Selector: key.Selector}
+	if metric, ok := resources[object]; ok {
+		s.customLabelIndex.remove(key.MetricName, customMetricID(key.GroupResource, key.Namespace, key.Name, key.Selector), metric.Labels)
+	}
+	delete(resources, object)
+	if len(resources) == 0 {
+		delete(namespaces, key.Namespace)
+	}
+	if len(namespaces) == 0 {
+		delete(groups, key.GroupResource)
+	}
+	if len(groups) == 0 {
+		delete(s.customMetricsStore, key.MetricName)
+	}
+}
+
+// updateSizeMetrics updates the metrics of the store size.
+func (s *InMemoryMetricStore) updateSizeMetrics() {
+	metricStoreEntries.Set(float64(s.lru.Len()))
+	metricStoreBytes.Set(float64(s.bytes))
+}
+
+// customMetricSize returns the estimated size in bytes of a stored custom
+// metric.
+func customMetricSize(metric customMetricsStoredMetric) int {
+	object := metric.Value.DescribedObject
+	size := storedMetricOverhead + len(metric.Value.Metric.Name) + len(object.APIVersion) + len(object.Kind) +
+		len(object.Namespace) + len(object.Name) + len(metric.Samples)*metricSampleSize
+	for k, v := range metric.Labels {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+// externalMetricSize returns the estimated size in bytes of a stored
+// external metric.
+func externalMetricSize(metric externalMetricsStoredMetric) int {
+	size := storedMetricOverhead + len(metric.Value.MetricName) + len(metric.Samples)*metricSampleSize
+	for k, v := range metric.Value.MetricLabels {
+		size += len(k) + len(v)
+	}
+	return size
+}
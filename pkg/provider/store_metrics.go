@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"time"
+
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+)
+
+// metric types of the metric store metrics.
+const (
+	storeMetricTypeCustom   = "custom"
+	storeMetricTypeExternal = "external"
+)
+
+// lookup operations of the metric store metrics.
+const (
+	lookupMetricByName      = "get_metric_by_name"
+	lookupMetricsBySelector = "get_metrics_by_selector"
+	lookupExternalMetric    = "get_external_metric"
+)
+
+var (
+	metricStoreInserts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_metrics_adapter_metric_store_inserts_total",
+		Help: "Number of collected values inserted into the metric store.",
+	}, []string{"type"})
+	metricStoreExpirations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_metrics_adapter_metric_store_expirations_total",
+		Help: "Number of metric series removed from the metric store because they expired.",
+	}, []string{"type"})
+	metricStoreLookupDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kube_metrics_adapter_metric_store_lookup_duration_seconds",
+		Help:    "Duration of metric lookups in the metric store.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+	}, []string{"operation"})
+	metricStoreLookupsNotFound = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_metrics_adapter_metric_store_lookups_not_found_total",
+		Help: "Number of metric lookups in the metric store which found no values.",
+	}, []string{"operation"})
+)
+
+func init() {
+	prometheus.MustRegister(metricStoreInserts, metricStoreExpirations, metricStoreLookupDuration, metricStoreLookupsNotFound)
+}
+
+// observeInserts records collected values inserted into the metric store.
+func observeInserts(values []collector.CollectedMetric) {
+	for _, value := range values {
+		switch value.Type {
+		case autoscalingv2.ObjectMetricSourceType, autoscalingv2.PodsMetricSourceType:
+			metricStoreInserts.WithLabelValues(storeMetricTypeCustom).Inc()
+		case autoscalingv2.ExternalMetricSourceType:
+			metricStoreInserts.WithLabelValues(storeMetricTypeExternal).Inc()
+		}
+	}
+}
+
+// observeLookup records the duration of a lookup in the metric store which
+// started at start and whether it found any values.
+func observeLookup(operation string, start time.Time, found bool) {
+	metricStoreLookupDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if !found {
+		metricStoreLookupsNotFound.WithLabelValues(operation).Inc()
+	}
+}
@@ -0,0 +1,59 @@
+package provider
+
+import (
+	"github.com/golang/glog"
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+)
+
+// setCollector sets the scheduled collector of a metric of an HPA. The
+// caller must hold the write lock.
+func (t *CollectorScheduler) setCollector(resourceRef resourceReference, config *collector.MetricConfig, scheduled *scheduledCollector) {
+	collectors, ok := t.collectors[resourceRef]
+	if !ok {
+		collectors = map[collector.MetricTypeName]*scheduledCollector{}
+		t.collectors[resourceRef] = collectors
+	}
+	collectors[config.MetricTypeName] = scheduled
+}
+
+// Trigger forces an immediate collection of the collectors of an HPA, or
+// only of the collectors of the named metric if metric is not empty. A
+// collection which is already triggered isn't triggered again. It returns
+// the number of triggered collectors.
+func (t *CollectorScheduler) Trigger(resourceRef resourceReference, metric string) int {
+	t.RLock()
+	defer t.RUnlock()
+
+	triggered := 0
+	for metricTypeName, scheduled := range t.collectors[resourceRef] {
+		if metric != "" && metricTypeName.Name != metric {
+			continue
+		}
+
+		glog.V(1).Infof("Triggering collection of metric '%s' of HPA %s", scheduled.config.Name, resourceRef)
+		t.queue.trigger(scheduled)
+		triggered++
+	}
+	return triggered
+}
+
+// TriggerCollection forces an immediate collection of the metrics of an
+// HPA, or only of the named metric if metric is not empty, in the cluster of
+// the provider and its remote clusters. It returns the number of triggered
+// collectors.
+func (p *HPAProvider) TriggerCollection(namespace, name, metric string) int {
+	resourceRef := resourceReference{Name: name, Namespace: namespace}
+
+	triggered := 0
+	for _, provider := range append([]*HPAProvider{p}, p.clusters...) {
+		if provider.collectorScheduler == nil {
+			continue
+		}
+		triggered += provider.collectorScheduler.Trigger(resourceRef, metric)
+	}
+
+	if triggered > 0 {
+		glog.Infof("Triggered %d collector(s) of HPA %s", triggered, resourceRef)
+	}
+	return triggered
+}
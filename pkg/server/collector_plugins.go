@@ -0,0 +1,479 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/golang/glog"
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// objectCollector is the kind of the objects and the collector name an
+// object collector plugin is registered for.
+type objectCollector struct {
+	kind      string
+	collector string
+}
+
+// collectorPlugin is the collector plugin of a metric backend and the
+// metrics it's registered for. The plugins of the adapter, the mock plugin
+// and the plugins validating metric configs are all registered for the
+// metrics of the same table of collector plugins.
+type collectorPlugin struct {
+	name string
+	// enabled is true if the plugin is enabled by the options.
+	enabled bool
+	// pods is true if the plugin is the default collector of pods
+	// metrics.
+	pods bool
+	// objects are the object metrics the plugin is registered for.
+	objects []objectCollector
+	// external are the collector names of the external metrics the
+	// plugin is registered for.
+	external []string
+	// new initializes the plugin.
+	new func() (collector.CollectorPlugin, error)
+}
+
+// register registers a plugin for the metrics of the collector plugin.
+func (p collectorPlugin) register(collectorFactory *collector.CollectorFactory, plugin collector.CollectorPlugin) error {
+	if p.pods {
+		err := collectorFactory.RegisterPodsCollector("", plugin)
+		if err != nil {
+			return fmt.Errorf("failed to register %s collector plugin: %v", p.name, err)
+		}
+	}
+
+	for _, object := range p.objects {
+		err := collectorFactory.RegisterObjectCollector(object.kind, object.collector, plugin)
+		if err != nil {
+			return fmt.Errorf("failed to register %s collector plugin: %v", p.name, err)
+		}
+	}
+
+	if len(p.external) > 0 {
+		collectorFactory.RegisterExternalCollector(p.external, plugin)
+	}
+	return nil
+}
+
+// collectorPlugins returns the collector plugins of all metric backends.
+// The plugins are initialized in order, plugins depending on other plugins
+// follow them. The AWS session of the plugins is initialized with the AWS
+// config, if not nil.
+func (o AdapterServerOptions) collectorPlugins(client kubernetes.Interface, dynamicClient dynamic.Interface, awsConfig *aws.Config, stopCh <-chan struct{}) []collectorPlugin {
+	var promPlugin *collector.PrometheusCollectorPlugin
+	var gcpMonitoringPlugin *collector.GCPMonitoringCollectorPlugin
+
+	// the AWS session and the Azure credential are shared by the plugins
+	// of the cloud provider.
+	var sess *session.Session
+	awsSession := func() (*session.Session, error) {
+		if sess != nil {
+			return sess, nil
+		}
+
+		var err error
+		sess, err = session.NewSession(awsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize aws session: %v", err)
+		}
+		return sess, nil
+	}
+
+	var credential azcore.TokenCredential
+	azureCredential := func() (azcore.TokenCredential, error) {
+		if credential != nil {
+			return credential, nil
+		}
+
+		var err error
+		credential, err = collector.NewAzureCredential(o.AzureClientID)
+		return credential, err
+	}
+
+	return []collectorPlugin{
+		{
+			name:    "prometheus",
+			enabled: o.PrometheusServer != "",
+			objects: []objectCollector{{"", collector.PrometheusCollectorName}},
+			new: func() (collector.CollectorPlugin, error) {
+				promAuth, err := o.prometheusAuth()
+				if err != nil {
+					return nil, err
+				}
+
+				promPlugin, err = collector.NewPrometheusCollectorPlugin(client, o.PrometheusServer, promAuth)
+				if err != nil {
+					return nil, fmt.Errorf("failed to initialize prometheus collector plugin: %v", err)
+				}
+
+				if o.PrometheusAllowedServers != "" {
+					promPlugin.SetAllowedServers(strings.Split(o.PrometheusAllowedServers, ","))
+				}
+
+				if o.PrometheusNamespaceTenants != "" {
+					namespaceTenants, err := parseNamespaceMapping(o.PrometheusNamespaceTenants)
+					if err != nil {
+						return nil, err
+					}
+					promPlugin.SetNamespaceTenants(namespaceTenants)
+				}
+				return promPlugin, nil
+			},
+		},
+		{
+			// skipper collector can only be enabled if prometheus is.
+			name:    "skipper",
+			enabled: o.PrometheusServer != "" && o.SkipperIngressMetrics,
+			objects: []objectCollector{{"Ingress", ""}},
+			new: func() (collector.CollectorPlugin, error) {
+				skipperPlugin, err := collector.NewSkipperCollectorPlugin(client, promPlugin)
+				if err != nil {
+					return nil, fmt.Errorf("failed to initialize skipper collector plugin: %v", err)
+				}
+				return skipperPlugin, nil
+			},
+		},
+		{
+			name:    "victoriametrics",
+			enabled: o.VictoriaMetricsServer != "",
+			objects: []objectCollector{{"", collector.VictoriaMetricsCollectorName}},
+			new: func() (collector.CollectorPlugin, error) {
+				vmAuth := &collector.PrometheusAuth{BearerTokenFile: o.VictoriaMetricsBearerTokenFile}
+				vmPlugin, err := collector.NewVictoriaMetricsCollectorPlugin(client, o.VictoriaMetricsServer, vmAuth)
+				if err != nil {
+					return nil, fmt.Errorf("failed to initialize victoriametrics collector plugin: %v", err)
+				}
+
+				if o.PrometheusAllowedServers != "" {
+					vmPlugin.SetAllowedServers(strings.Split(o.PrometheusAllowedServers, ","))
+				}
+
+				if o.PrometheusNamespaceTenants != "" {
+					namespaceTenants, err := parseNamespaceMapping(o.PrometheusNamespaceTenants)
+					if err != nil {
+						return nil, err
+					}
+					vmPlugin.SetNamespaceTenants(namespaceTenants)
+				}
+				return vmPlugin, nil
+			},
+		},
+		{
+			name:     "influxdb",
+			enabled:  o.InfluxDBServer != "",
+			external: []string{collector.InfluxDBCollectorName},
+			new: func() (collector.CollectorPlugin, error) {
+				influxDBPlugin, err := collector.NewInfluxDBCollectorPlugin(o.InfluxDBServer, o.InfluxDBOrg, o.InfluxDBTokenFile)
+				if err != nil {
+					return nil, fmt.Errorf("failed to initialize influxdb collector plugin: %v", err)
+				}
+				return influxDBPlugin, nil
+			},
+		},
+		{
+			name:     "graphite",
+			enabled:  o.GraphiteServer != "",
+			external: []string{collector.GraphiteCollectorName},
+			new: func() (collector.CollectorPlugin, error) {
+				graphitePlugin, err := collector.NewGraphiteCollectorPlugin(o.GraphiteServer)
+				if err != nil {
+					return nil, fmt.Errorf("failed to initialize graphite collector plugin: %v", err)
+				}
+				return graphitePlugin, nil
+			},
+		},
+		{
+			name:     "datadog",
+			enabled:  o.DatadogMetrics,
+			external: []string{collector.DatadogCollectorName},
+			new: func() (collector.CollectorPlugin, error) {
+				return collector.NewDatadogCollectorPlugin(o.DatadogSite, o.DatadogAPIKeyFile, o.DatadogAppKeyFile), nil
+			},
+		},
+		{
+			name:     "newrelic",
+			enabled:  o.NewRelicMetrics,
+			external: []string{collector.NewRelicCollectorName},
+			new: func() (collector.CollectorPlugin, error) {
+				newRelicPlugin, err := collector.NewNewRelicCollectorPlugin(o.NewRelicRegion, o.NewRelicAccountID, o.NewRelicAPIKeyFile)
+				if err != nil {
+					return nil, fmt.Errorf("failed to initialize newrelic collector plugin: %v", err)
+				}
+				return newRelicPlugin, nil
+			},
+		},
+		{
+			name:     "dynatrace",
+			enabled:  o.DynatraceMetrics,
+			external: []string{collector.DynatraceCollectorName},
+			new: func() (collector.CollectorPlugin, error) {
+				return collector.NewDynatraceCollectorPlugin(o.DynatraceEnvironment, o.DynatraceTokenFile), nil
+			},
+		},
+		{
+			name:     "appdynamics",
+			enabled:  o.AppDynamicsMetrics,
+			external: []string{collector.AppDynamicsCollectorName},
+			new: func() (collector.CollectorPlugin, error) {
+				return collector.NewAppDynamicsCollectorPlugin(o.AppDynamicsController, o.AppDynamicsTokenFile), nil
+			},
+		},
+		{
+			name:     "wavefront",
+			enabled:  o.WavefrontMetrics,
+			external: []string{collector.WavefrontCollectorName},
+			new: func() (collector.CollectorPlugin, error) {
+				return collector.NewWavefrontCollectorPlugin(o.WavefrontCluster, o.WavefrontTokenFile), nil
+			},
+		},
+		{
+			name:     "gcp-monitoring",
+			enabled:  o.GCPMonitoringMetrics,
+			external: []string{collector.GCPMonitoringCollectorName},
+			new: func() (collector.CollectorPlugin, error) {
+				gcpMonitoringPlugin = collector.NewGCPMonitoringCollectorPlugin(o.GCPProject, o.GCPCredentialsFile)
+				return gcpMonitoringPlugin, nil
+			},
+		},
+		{
+			// the pubsub collector queries the subscription metrics
+			// through the cloud monitoring collector.
+			name:     "pubsub",
+			enabled:  o.GCPMonitoringMetrics,
+			external: []string{collector.PubSubCollectorName},
+			new: func() (collector.CollectorPlugin, error) {
+				return collector.NewPubSubCollectorPlugin(gcpMonitoringPlugin), nil
+			},
+		},
+		{
+			name:     "azure-monitor",
+			enabled:  o.AzureMonitorMetrics,
+			external: []string{collector.AzureMonitorCollectorName},
+			new: func() (collector.CollectorPlugin, error) {
+				credential, err := azureCredential()
+				if err != nil {
+					return nil, err
+				}
+				return collector.NewAzureMonitorCollectorPlugin(credential), nil
+			},
+		},
+		{
+			name:     "azure-service-bus",
+			enabled:  o.AzureServiceBusMetrics,
+			external: []string{collector.AzureServiceBusCollectorName},
+			new: func() (collector.CollectorPlugin, error) {
+				credential, err := azureCredential()
+				if err != nil {
+					return nil, err
+				}
+				return collector.NewAzureServiceBusCollectorPlugin(credential), nil
+			},
+		},
+		{
+			// generic pod collector
+			name:    "pod",
+			enabled: true,
+			pods:    true,
+			new: func() (collector.CollectorPlugin, error) {
+				return collector.NewPodCollectorPlugin(client), nil
+			},
+		},
+		{
+			name:     "aws",
+			enabled:  o.AWSExternalMetrics,
+			external: []string{collector.AWSSQSQueueLengthMetric, collector.AWSSQSCollectorName},
+			new: func() (collector.CollectorPlugin, error) {
+				sess, err := awsSession()
+				if err != nil {
+					return nil, err
+				}
+
+				awsPlugin := collector.NewAWSCollectorPlugin(sess)
+				if o.AWSNamespaceRoles != "" {
+					namespaceRoles, err := parseNamespaceMapping(o.AWSNamespaceRoles)
+					if err != nil {
+						return nil, err
+					}
+					awsPlugin.SetNamespaceRoles(namespaceRoles)
+				}
+				return awsPlugin, nil
+			},
+		},
+		{
+			name:     "cloudwatch",
+			enabled:  o.AWSExternalMetrics,
+			external: []string{collector.CloudWatchCollectorName},
+			new: func() (collector.CollectorPlugin, error) {
+				sess, err := awsSession()
+				if err != nil {
+					return nil, err
+				}
+				return collector.NewCloudWatchCollectorPlugin(sess), nil
+			},
+		},
+		{
+			name:     "kinesis",
+			enabled:  o.AWSExternalMetrics,
+			external: []string{collector.KinesisCollectorName},
+			new: func() (collector.CollectorPlugin, error) {
+				sess, err := awsSession()
+				if err != nil {
+					return nil, err
+				}
+				return collector.NewKinesisCollectorPlugin(sess), nil
+			},
+		},
+		{
+			name:     "dynamodb",
+			enabled:  o.AWSExternalMetrics,
+			external: []string{collector.DynamoDBCollectorName},
+			new: func() (collector.CollectorPlugin, error) {
+				sess, err := awsSession()
+				if err != nil {
+					return nil, err
+				}
+				return collector.NewDynamoDBCollectorPlugin(sess), nil
+			},
+		},
+		{
+			name:     "job queue",
+			enabled:  o.JobQueueMetrics,
+			external: []string{collector.JobQueueMetric},
+			new: func() (collector.CollectorPlugin, error) {
+				jobQueuePlugin, err := collector.NewJobQueueCollectorPlugin(client, stopCh)
+				if err != nil {
+					return nil, fmt.Errorf("failed to initialize job queue collector plugin: %v", err)
+				}
+				return jobQueuePlugin, nil
+			},
+		},
+		{
+			name:     "scaling schedule",
+			enabled:  o.ScalingScheduleMetrics,
+			external: []string{collector.ScalingScheduleMetric},
+			new: func() (collector.CollectorPlugin, error) {
+				return collector.NewScalingScheduleCollectorPlugin(dynamicClient), nil
+			},
+		},
+		{
+			name:     "cluster scaling schedule",
+			enabled:  o.ScalingScheduleMetrics,
+			external: []string{collector.ClusterScalingScheduleMetric},
+			new: func() (collector.CollectorPlugin, error) {
+				return collector.NewClusterScalingScheduleCollectorPlugin(dynamicClient), nil
+			},
+		},
+	}
+}
+
+// registerCollectors initializes and registers the enabled collector
+// plugins.
+func registerCollectors(collectorFactory *collector.CollectorFactory, plugins []collectorPlugin) error {
+	for _, plugin := range plugins {
+		if !plugin.enabled {
+			continue
+		}
+
+		p, err := plugin.new()
+		if err != nil {
+			return err
+		}
+
+		err = plugin.register(collectorFactory, p)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerMetaCollectors registers the collector plugins which combine the
+// collectors of the other registered plugins.
+func registerMetaCollectors(collectorFactory *collector.CollectorFactory) error {
+	// cross check collector collects from two sources of the other
+	// registered plugins.
+	crossCheckPlugin := collector.NewCrossCheckCollectorPlugin(collectorFactory)
+	err := collectorFactory.RegisterPodsCollector(collector.CrossCheckCollectorName, crossCheckPlugin)
+	if err != nil {
+		return fmt.Errorf("failed to register cross check collector plugin: %v", err)
+	}
+
+	err = collectorFactory.RegisterObjectCollector("", collector.CrossCheckCollectorName, crossCheckPlugin)
+	if err != nil {
+		return fmt.Errorf("failed to register cross check collector plugin: %v", err)
+	}
+	collectorFactory.RegisterExternalCollector([]string{collector.CrossCheckCollectorName}, crossCheckPlugin)
+
+	// static collector returns fixed values, e.g. as fallback source.
+	staticPlugin := collector.NewStaticCollectorPlugin()
+	err = collectorFactory.RegisterObjectCollector("", collector.StaticCollectorName, staticPlugin)
+	if err != nil {
+		return fmt.Errorf("failed to register static collector plugin: %v", err)
+	}
+	collectorFactory.RegisterExternalCollector([]string{collector.StaticCollectorName}, staticPlugin)
+
+	// fallback collector collects from a primary source and falls back to
+	// a secondary source of the other registered plugins.
+	fallbackPlugin := collector.NewFallbackCollectorPlugin(collectorFactory)
+	err = collectorFactory.RegisterPodsCollector(collector.FallbackCollectorName, fallbackPlugin)
+	if err != nil {
+		return fmt.Errorf("failed to register fallback collector plugin: %v", err)
+	}
+
+	err = collectorFactory.RegisterObjectCollector("", collector.FallbackCollectorName, fallbackPlugin)
+	if err != nil {
+		return fmt.Errorf("failed to register fallback collector plugin: %v", err)
+	}
+	collectorFactory.RegisterExternalCollector([]string{collector.FallbackCollectorName}, fallbackPlugin)
+
+	// composite collector combines the values of sources of the other
+	// registered plugins.
+	compositePlugin := collector.NewCompositeCollectorPlugin(collectorFactory)
+	err = collectorFactory.RegisterObjectCollector("", collector.CompositeCollectorName, compositePlugin)
+	if err != nil {
+		return fmt.Errorf("failed to register composite collector plugin: %v", err)
+	}
+	collectorFactory.RegisterExternalCollector([]string{collector.CompositeCollectorName}, compositePlugin)
+
+	return nil
+}
+
+// registerMockCollectors registers the mock collector plugin in place of all
+// collector plugins of metric backends.
+func registerMockCollectors(client kubernetes.Interface, collectorFactory *collector.CollectorFactory, plugins []collectorPlugin, valuesFile string) error {
+	values := map[string]*collector.MockValue{}
+	if valuesFile != "" {
+		var err error
+		values, err = collector.LoadMockValues(valuesFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	mockPlugin := collector.NewMockCollectorPlugin(client, values)
+
+	for _, plugin := range plugins {
+		err := plugin.register(collectorFactory, mockPlugin)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the mock plugin additionally serves metrics of objects of any kind
+	// and the mock external metric.
+	err := collectorFactory.RegisterObjectCollector("", "", mockPlugin)
+	if err != nil {
+		return err
+	}
+	collectorFactory.RegisterExternalCollector([]string{collector.MockMetric}, mockPlugin)
+
+	glog.Warning("Using mock collectors, metrics are not collected from any backend")
+	return nil
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// requireDebugAccess wraps a debug handler such that it's only served to
+// requests with a bearer token of a user which is allowed to access the path
+// of the request as non-resource URL with the verb of the request method,
+// e.g. get or post. The token is authenticated with a
+// TokenReview and the access is authorized with a SubjectAccessReview.
+func requireDebugAccess(client kubernetes.Interface, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || token == r.Header.Get("Authorization") {
+			http.Error(w, "a bearer token is required", http.StatusUnauthorized)
+			return
+		}
+
+		status, err := authorizeDebugAccess(r.Context(), client, token, strings.ToLower(r.Method), r.URL.Path)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// authorizeDebugAccess returns an error and the HTTP status to respond with
+// if the token is invalid or the user of the token isn't allowed to access
+// the path with the verb.
+func authorizeDebugAccess(ctx context.Context, client kubernetes.Interface, token, verb, path string) (int, error) {
+	review, err := client.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token: token,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to review token: %v", err)
+	}
+
+	if !review.Status.Authenticated {
+		return http.StatusUnauthorized, fmt.Errorf("invalid bearer token")
+	}
+
+	user := review.Status.User
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for key, value := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(value)
+	}
+
+	access, err := client.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			NonResourceAttributes: &authorizationv1.NonResourceAttributes{
+				Path: path,
+				Verb: verb,
+			},
+			User:   user.Username,
+			Groups: user.Groups,
+			Extra:  extra,
+			UID:    user.UID,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to review access: %v", err)
+	}
+
+	if !access.Status.Allowed {
+		return http.StatusForbidden, fmt.Errorf("user %s is not allowed to %s %s", user.Username, verb, path)
+	}
+
+	return http.StatusOK, nil
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/provider"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	resourceMetricsPath = "/apis/metrics.k8s.io/v1beta1/"
+	metricHistoryPath   = "/debug/metrics-history"
+	metricStorePath     = "/debug/metrics-store"
+	collectorsPath      = "/debug/collectors"
+	collectPath         = "/debug/collect"
+)
+
+// serveMetrics serves the collection health of the HPA provider on the
+// specified address. It's served separately from the metrics API such that
+// the health reported to the kube-apiserver for the aggregated API is not
+// affected by the health of the metric collection.
+//
+// The Prometheus metrics of the adapter are served on /metrics. The values
+// collected for ContainerResource metrics and the pod metrics of the
+// resource metrics mapping are served in the shape of the resource metrics
+// API to users allowed to get the path of the request.
+//
+// The history of the metrics is served on /debug/metrics-history and the
+// contents of the metric store on /debug/metrics-store to users allowed to
+// get the paths, authenticated by their bearer token, as is the health of
+// the running collectors on /debug/collectors. Users allowed to post to
+// /debug/collect can trigger an immediate collection of the metrics of an
+// HPA. As the bearer tokens are sent with the requests, the address is
+// served with TLS if a certificate and key file are specified.
+func serveMetrics(address, certFile, keyFile string, client kubernetes.Interface, hpaProvider *provider.HPAProvider, resourceMetrics map[v1.ResourceName]string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if err := hpaProvider.Healthy(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+
+	// the metrics of the adapter itself.
+	mux.Handle("/metrics", promhttp.Handler())
+
+	mux.HandleFunc(resourceMetricsPath, requireDebugAccess(client, func(w http.ResponseWriter, r *http.Request) {
+		namespace, ok := parseResourceMetricsPath(r.URL.Path)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(hpaProvider.PodResourceMetrics(namespace, resourceMetrics))
+		if err != nil {
+			glog.Errorf("Failed to encode resource metrics: %v", err)
+		}
+	}))
+
+	// the history of a metric, e.g.
+	// /debug/metrics-history?metric=requests-per-second&namespace=default
+	mux.HandleFunc(metricHistoryPath, requireDebugAccess(client, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		metric := query.Get("metric")
+		if metric == "" {
+			http.Error(w, "metric must be specified", http.StatusBadRequest)
+			return
+		}
+
+		history := hpaProvider.MetricHistory(metric, query.Get("namespace"), query.Get("name"))
+		if history == nil {
+			http.Error(w, "metric history is not enabled", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(history)
+		if err != nil {
+			glog.Errorf("Failed to encode metric history: %v", err)
+		}
+	}))
+
+	// all series in the metric store.
+	mux.HandleFunc(metricStorePath, requireDebugAccess(client, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(hpaProvider.StoredMetrics())
+		if err != nil {
+			glog.Errorf("Failed to encode metric store contents: %v", err)
+		}
+	}))
+
+	// the health of the running collectors, only of the unhealthy ones
+	// with ?unhealthy=true.
+	mux.HandleFunc(collectorsPath, requireDebugAccess(client, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(hpaProvider.CollectorHealth(r.URL.Query().Get("unhealthy") == "true"))
+		if err != nil {
+			glog.Errorf("Failed to encode collector health: %v", err)
+		}
+	}))
+
+	// trigger an immediate collection of the metrics of an HPA, e.g.
+	// POST /debug/collect?namespace=default&name=my-hpa&metric=queue-length
+	mux.HandleFunc(collectPath, requireDebugAccess(client, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		namespace, name := query.Get("namespace"), query.Get("name")
+		if namespace == "" || name == "" {
+			http.Error(w, "namespace and name of the HPA must be specified", http.StatusBadRequest)
+			return
+		}
+
+		triggered := hpaProvider.TriggerCollection(namespace, name, query.Get("metric"))
+		if triggered == 0 {
+			http.Error(w, "no matching collectors", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(map[string]int{"triggered": triggered})
+		if err != nil {
+			glog.Errorf("Failed to encode triggered collectors: %v", err)
+		}
+	}))
+
+	if certFile != "" {
+		glog.Fatal(http.ListenAndServeTLS(address, certFile, keyFile, mux))
+	}
+	glog.Fatal(http.ListenAndServe(address, mux))
+}
+
+// parseResourceMetricsPath returns the namespace of a request for pod
+// resource metrics. Supported paths are
+// /apis/metrics.k8s.io/v1beta1/pods and
+// /apis/metrics.k8s.io/v1beta1/namespaces/<namespace>/pods.
+func parseResourceMetricsPath(path string) (string, bool) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, resourceMetricsPath), "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "pods":
+		return "", true
+	case len(parts) == 3 && parts[0] == "namespaces" && parts[2] == "pods":
+		return parts[1], true
+	}
+	return "", false
+}
@@ -20,34 +20,68 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/kubernetes-incubator/custom-metrics-apiserver/pkg/cmd/server"
+	"github.com/golang/glog"
 	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
 	"github.com/mikkeloscar/kube-metrics-adapter/pkg/provider"
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/timewindow"
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/webhook"
 	"github.com/spf13/cobra"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apiserver/pkg/server/healthz"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/custom-metrics-apiserver/pkg/cmd/server"
 )
 
 // NewCommandStartAdapterServer provides a CLI handler for 'start adapter server' command
-func NewCommandStartAdapterServer(out, errOut io.Writer, stopCh <-chan struct{}) *cobra.Command {
-	baseOpts := server.NewCustomMetricsAdapterServerOptions(out, errOut)
+func NewCommandStartAdapterServer(stopCh <-chan struct{}) *cobra.Command {
+	baseOpts := server.NewCustomMetricsAdapterServerOptions()
 	o := AdapterServerOptions{
 		CustomMetricsAdapterServerOptions: baseOpts,
 		EnableCustomMetricsAPI:            true,
 		EnableExternalMetricsAPI:          true,
+		QueryAuditLogRate:                 10,
+		MetricsAddress:                    ":7979",
+		DefaultTimezone:                   "UTC",
+		ShardCount:                        1,
+		MetricTTL:                         15 * time.Minute,
+		MetricStoreGCInterval:             10 * time.Minute,
+		CollectorJitter:                   1,
+		CollectorWorkers:                  100,
+		ShutdownDrainTimeout:              20 * time.Second,
+		AdaptiveIntervalSteadyPeriod:      5 * time.Minute,
+		CollectorMaxBackoff:               5 * time.Minute,
+		CircuitBreakerCooldown:            10 * time.Minute,
+		MetricStoreExpiredRetention:       1 * time.Hour,
+		ExpiredMetricPolicy:               provider.ExpiredMetricPolicyNotFound,
+		MetricStore:                       "memory",
+		RedisKeyPrefix:                    "kube-metrics-adapter:",
+		SnapshotInterval:                  1 * time.Minute,
+		PluginConfigInterval:              30 * time.Second,
+		MetricHistoryResolution:           1 * time.Minute,
+		LeaderElectionNamespace:           "kube-system",
+		LeaderElectionName:                "kube-metrics-adapter",
+		LeaderElectionLeaseDuration:       15 * time.Second,
+		LeaderElectionRenewDeadline:       10 * time.Second,
+		LeaderElectionRetryPeriod:         2 * time.Second,
 	}
 
 	cmd := &cobra.Command{
 		Short: "Launch the custom metrics API adapter server",
 		Long:  "Launch the custom metrics API adapter server",
 		RunE: func(c *cobra.Command, args []string) error {
-			if err := o.Complete(); err != nil {
-				return err
-			}
 			if err := o.Validate(args); err != nil {
 				return err
 			}
@@ -73,10 +107,259 @@ func NewCommandStartAdapterServer(out, errOut io.Writer, stopCh <-chan struct{})
 		"whether to enable External Metrics API")
 	flags.StringVar(&o.PrometheusServer, "prometheus-server", o.PrometheusServer, ""+
 		"url of prometheus server to query")
+	flags.StringVar(&o.VictoriaMetricsServer, "victoriametrics-server", o.VictoriaMetricsServer, ""+
+		"url of the VictoriaMetrics server queried by the victoriametrics collector, e.g. the select path "+
+		"http://vmselect:8481/select/0/prometheus of a cluster")
+	flags.StringVar(&o.VictoriaMetricsBearerTokenFile, "victoriametrics-bearer-token-file", o.VictoriaMetricsBearerTokenFile, ""+
+		"path of a file containing the bearer token sent to --victoriametrics-server. Read on each request")
+	flags.StringVar(&o.InfluxDBServer, "influxdb-server", o.InfluxDBServer, ""+
+		"url of the InfluxDB 2.x server queried by the influxdb collector")
+	flags.StringVar(&o.InfluxDBOrg, "influxdb-org", o.InfluxDBOrg, ""+
+		"organization of the InfluxDB queries of metrics which don't define an org")
+	flags.StringVar(&o.InfluxDBTokenFile, "influxdb-token-file", o.InfluxDBTokenFile, ""+
+		"path of a file containing the API token of the InfluxDB queries of metrics which don't define a token. Read on each query")
+	flags.StringVar(&o.GraphiteServer, "graphite-server", o.GraphiteServer, ""+
+		"url of the Graphite server whose render API is queried by the graphite collector")
+	flags.BoolVar(&o.DatadogMetrics, "datadog-metrics", o.DatadogMetrics, ""+
+		"whether to enable the datadog collector running Datadog metrics queries")
+	flags.StringVar(&o.DatadogSite, "datadog-site", o.DatadogSite, ""+
+		"Datadog site of the queries of metrics which don't define a site, e.g. datadoghq.eu")
+	flags.StringVar(&o.DatadogAPIKeyFile, "datadog-api-key-file", o.DatadogAPIKeyFile, ""+
+		"path of a file containing the Datadog API key of metrics which don't define a key. Read on each query")
+	flags.StringVar(&o.DatadogAppKeyFile, "datadog-app-key-file", o.DatadogAppKeyFile, ""+
+		"path of a file containing the Datadog application key of metrics which don't define a key. Read on each query")
+	flags.BoolVar(&o.NewRelicMetrics, "newrelic-metrics", o.NewRelicMetrics, ""+
+		"whether to enable the newrelic collector running NRQL queries")
+	flags.StringVar(&o.NewRelicRegion, "newrelic-region", o.NewRelicRegion, ""+
+		"New Relic region, us or eu, of the queries of metrics which don't define a region")
+	flags.StringVar(&o.NewRelicAccountID, "newrelic-account-id", o.NewRelicAccountID, ""+
+		"New Relic account ID of the queries of metrics which don't define an account ID")
+	flags.StringVar(&o.NewRelicAPIKeyFile, "newrelic-api-key-file", o.NewRelicAPIKeyFile, ""+
+		"path of a file containing the New Relic user API key of metrics which don't define a key. Read on each query")
+	flags.BoolVar(&o.DynatraceMetrics, "dynatrace-metrics", o.DynatraceMetrics, ""+
+		"whether to enable the dynatrace collector querying the Dynatrace metrics v2 API")
+	flags.StringVar(&o.DynatraceEnvironment, "dynatrace-environment", o.DynatraceEnvironment, ""+
+		"url of the Dynatrace environment of metrics which don't define an environment, e.g. https://abc12345.live.dynatrace.com")
+	flags.StringVar(&o.DynatraceTokenFile, "dynatrace-token-file", o.DynatraceTokenFile, ""+
+		"path of a file containing the Dynatrace API token of metrics which don't define a token. Read on each query")
+	flags.BoolVar(&o.AppDynamicsMetrics, "appdynamics-metrics", o.AppDynamicsMetrics, ""+
+		"whether to enable the appdynamics collector querying metric paths from the AppDynamics REST API")
+	flags.StringVar(&o.AppDynamicsController, "appdynamics-controller", o.AppDynamicsController, ""+
+		"url of the AppDynamics controller of metrics which don't define a controller, e.g. https://example.saas.appdynamics.com")
+	flags.StringVar(&o.AppDynamicsTokenFile, "appdynamics-token-file", o.AppDynamicsTokenFile, ""+
+		"path of a file containing the AppDynamics API client token of metrics which don't define a token. Read on each query")
+	flags.BoolVar(&o.WavefrontMetrics, "wavefront-metrics", o.WavefrontMetrics, ""+
+		"whether to enable the wavefront collector running WQL queries against the Wavefront API")
+	flags.StringVar(&o.WavefrontCluster, "wavefront-cluster", o.WavefrontCluster, ""+
+		"url of the Wavefront cluster of metrics which don't define a cluster, e.g. https://example.wavefront.com")
+	flags.StringVar(&o.WavefrontTokenFile, "wavefront-token-file", o.WavefrontTokenFile, ""+
+		"path of a file containing the Wavefront API token of metrics which don't define a token. Read on each query")
+	flags.BoolVar(&o.GCPMonitoringMetrics, "gcp-monitoring-metrics", o.GCPMonitoringMetrics, ""+
+		"whether to enable the gcp-monitoring and pubsub collectors querying time series from Google Cloud Monitoring")
+	flags.StringVar(&o.GCPProject, "gcp-project", o.GCPProject, ""+
+		"Google Cloud project of metrics which don't define a project. Defaults to the project of the credentials")
+	flags.StringVar(&o.GCPCredentialsFile, "gcp-credentials-file", o.GCPCredentialsFile, ""+
+		"path of a service account key file used for metrics which don't define a key. If not set the application default credentials, e.g. of Workload Identity, are used")
+	flags.BoolVar(&o.AzureMonitorMetrics, "azure-monitor-metrics", o.AzureMonitorMetrics, ""+
+		"whether to enable the azure-monitor collector querying the metrics of Azure resources from Azure Monitor")
+	flags.BoolVar(&o.AzureServiceBusMetrics, "azure-servicebus-metrics", o.AzureServiceBusMetrics, ""+
+		"whether to enable the azure-servicebus collector exposing the active messages of Azure Service Bus queues and subscriptions")
+	flags.StringVar(&o.AzureClientID, "azure-client-id", o.AzureClientID, ""+
+		"client ID of the user assigned managed identity the Azure collectors authenticate with. If not set the system assigned identity or Workload Identity is used")
+	flags.StringVar(&o.PrometheusBearerTokenFile, "prometheus-bearer-token-file", o.PrometheusBearerTokenFile, ""+
+		"path of a file containing the bearer token sent to --prometheus-server. Read on each request")
+	flags.StringVar(&o.PrometheusUsername, "prometheus-username", o.PrometheusUsername, ""+
+		"username of the basic auth of --prometheus-server")
+	flags.StringVar(&o.PrometheusPasswordFile, "prometheus-password-file", o.PrometheusPasswordFile, ""+
+		"path of a file containing the password of the basic auth of --prometheus-server")
+	flags.StringArrayVar(&o.PrometheusHeaders, "prometheus-header", o.PrometheusHeaders, ""+
+		"header sent with the requests to --prometheus-server as <name>: <value>. Can be repeated")
+	flags.StringVar(&o.PrometheusNamespaceTenants, "prometheus-namespace-tenants", o.PrometheusNamespaceTenants, ""+
+		"comma separated mapping of namespaces to the tenants their HPAs may query with the tenant key "+
+		"(e.g. team-a=tenant-a,team-b=tenant-b). Tenants aren't restricted if empty")
+	flags.StringVar(&o.PrometheusAllowedServers, "prometheus-allowed-servers", o.PrometheusAllowedServers, ""+
+		"comma separated urls of the prometheus servers HPAs may query instead of --prometheus-server "+
+		"with the server or replicas keys. No other server is allowed if empty")
+	flags.StringVar(&o.PrometheusOperatorSelector, "prometheus-operator-selector", o.PrometheusOperatorSelector, ""+
+		"label selector for discovering the prometheus server to query from Prometheus Operator resources. "+
+		"Falls back to --prometheus-server if discovery fails")
+	flags.StringVar(&o.PrometheusOperatorNamespace, "prometheus-operator-namespace", o.PrometheusOperatorNamespace, ""+
+		"namespace to discover Prometheus Operator resources in. Defaults to all namespaces")
 	flags.BoolVar(&o.SkipperIngressMetrics, "skipper-ingress-metrics", o.SkipperIngressMetrics, ""+
 		"whether to enable skipper ingress metrics")
 	flags.BoolVar(&o.AWSExternalMetrics, "aws-external-metrics", o.AWSExternalMetrics, ""+
 		"whether to enable AWS external metrics")
+	flags.StringVar(&o.AWSNamespaceRoles, "aws-namespace-roles", o.AWSNamespaceRoles, ""+
+		"comma separated mapping of namespaces to the IAM role ARNs their HPAs may assume with the role-arn key "+
+		"(e.g. team-a=arn:aws:iam::123456789012:role/queue-reader). No role can be assumed if empty")
+	flags.BoolVar(&o.JobQueueMetrics, "job-queue-metrics", o.JobQueueMetrics, ""+
+		"whether to enable job queue external metrics")
+	flags.BoolVar(&o.ScalingScheduleMetrics, "scaling-schedule-metrics", o.ScalingScheduleMetrics, ""+
+		"whether to enable external metrics based on ScalingSchedule and ClusterScalingSchedule resources")
+	flags.StringVar(&o.MetricsAddress, "metrics-address", o.MetricsAddress, ""+
+		"address to serve the health of the metric collection on")
+	flags.StringVar(&o.MetricsCertFile, "metrics-cert-file", o.MetricsCertFile, ""+
+		"path of the TLS certificate file of --metrics-address. Served without TLS if empty")
+	flags.StringVar(&o.MetricsKeyFile, "metrics-key-file", o.MetricsKeyFile, ""+
+		"path of the TLS key file of --metrics-address")
+	flags.StringVar(&o.QueryAuditLog, "query-audit-log", o.QueryAuditLog, ""+
+		"path of a file to log all queries run against metric backends to. Use '-' for stdout")
+	flags.Float64Var(&o.QueryAuditLogRate, "query-audit-log-rate", o.QueryAuditLogRate, ""+
+		"maximum number of query audit records to write per second")
+	flags.StringArrayVar(&o.RateLimits, "rate-limit", o.RateLimits, ""+
+		"rate limit of the collections of all collectors of a backend, shared by all its collectors, as "+
+		"<backend>=<n>/<unit> with the unit s, m or h, e.g. cloudwatch=5/s. Can be repeated")
+	flags.BoolVar(&o.MockBackends, "mock-backends", o.MockBackends, ""+
+		"whether to replace all collectors with mock collectors returning synthetic values. For development only")
+	flags.StringVar(&o.MockValues, "mock-values", o.MockValues, ""+
+		"path of a YAML file defining the synthetic values per metric name for --mock-backends")
+	flags.StringVar(&o.QueryPolicy, "query-policy", o.QueryPolicy, ""+
+		"path of a file defining the policy for queries defined in HPA annotations")
+	flags.StringVar(&o.PluginConfig, "plugin-config", o.PluginConfig, ""+
+		"path of a YAML file defining external collector plugins and disabled collectors, reloaded when it changes")
+	flags.DurationVar(&o.PluginConfigInterval, "plugin-config-interval", o.PluginConfigInterval, ""+
+		"interval at which the --plugin-config file is checked for changes")
+	flags.StringVar(&o.ResourceMetrics, "resource-metrics", o.ResourceMetrics, ""+
+		"comma separated mapping of resources to pod metrics (e.g. cpu=cpu-usage) to serve in the shape "+
+		"of the resource metrics API on --metrics-address")
+	flags.StringVar(&o.DefaultTimezone, "default-timezone", o.DefaultTimezone, ""+
+		"IANA name of the timezone used for time windows which don't define a timezone")
+	flags.StringVar(&o.StandaloneMetrics, "standalone-metrics", o.StandaloneMetrics, ""+
+		"path of a YAML file defining external metrics which are collected without an HPA referencing them")
+	flags.StringVar(&o.ClusterKubeConfigFile, "cluster-kubeconfig", o.ClusterKubeConfigFile, ""+
+		"kubeconfig file defining the contexts of the remote clusters to discover HPAs in")
+	flags.StringSliceVar(&o.Clusters, "clusters", o.Clusters, ""+
+		"contexts of --cluster-kubeconfig of remote clusters to discover HPAs in. External metrics of their "+
+		"HPAs are labeled with the context name as cluster. Requires --cluster-name")
+	flags.StringVar(&o.ClusterName, "cluster-name", o.ClusterName, ""+
+		"name of the cluster the adapter runs in. External metrics of its HPAs are labeled with it as cluster "+
+		"like the metrics of the remote clusters of --clusters")
+	flags.StringVar(&o.HPASelector, "hpa-selector", o.HPASelector, ""+
+		"label selector restricting the HPAs to discover")
+	flags.IntVar(&o.ShardCount, "shard-count", o.ShardCount, ""+
+		"number of adapter instances the HPAs are sharded across. Requires --metric-store=redis")
+	flags.IntVar(&o.ShardIndex, "shard-index", o.ShardIndex, ""+
+		"index of this adapter instance from 0 to --shard-count - 1. Each instance only discovers the HPAs of its shard")
+	flags.StringSliceVar(&o.WatchNamespaces, "watch-namespaces", o.WatchNamespaces, ""+
+		"namespaces to discover HPAs in and serve metrics for. Defaults to all namespaces")
+	flags.StringSliceVar(&o.ExcludeNamespaces, "exclude-namespaces", o.ExcludeNamespaces, ""+
+		"namespaces to not discover HPAs in and not serve metrics for")
+	flags.IntVar(&o.NamespaceMaxCollectors, "namespace-max-collectors", o.NamespaceMaxCollectors, ""+
+		"maximum number of collectors of the HPAs of a namespace. HPAs exceeding it are rejected. Unlimited if 0")
+	flags.IntVar(&o.NamespaceMaxSeries, "namespace-max-series", o.NamespaceMaxSeries, ""+
+		"maximum number of metric series stored for the HPAs of a namespace. Collections exceeding it are "+
+		"rejected. Unlimited if 0")
+	flags.StringVar(&o.MetricStore, "metric-store", o.MetricStore, ""+
+		"backend of the store of collected metrics, 'memory' or 'redis'. With 'redis' multiple replicas "+
+		"can serve the metrics collected by the leader")
+	flags.StringVar(&o.RedisAddress, "redis-address", o.RedisAddress, ""+
+		"host:port of the Redis server of --metric-store=redis. The password is read from the REDIS_PASSWORD "+
+		"environment variable")
+	flags.IntVar(&o.RedisDatabase, "redis-database", o.RedisDatabase, ""+
+		"Redis database of --metric-store=redis")
+	flags.StringVar(&o.RedisKeyPrefix, "redis-key-prefix", o.RedisKeyPrefix, ""+
+		"prefix of the Redis keys written by --metric-store=redis")
+	flags.StringVar(&o.SnapshotFile, "snapshot-file", o.SnapshotFile, ""+
+		"path of a file, e.g. on a persistent volume, to periodically save snapshots of the metric store to. "+
+		"The snapshot is restored on startup")
+	flags.StringVar(&o.SnapshotConfigMap, "snapshot-configmap", o.SnapshotConfigMap, ""+
+		"namespace/name of a ConfigMap to periodically save snapshots of the metric store to. "+
+		"The snapshot is restored on startup")
+	flags.DurationVar(&o.SnapshotInterval, "snapshot-interval", o.SnapshotInterval, ""+
+		"interval at which snapshots of the metric store are saved")
+	flags.DurationVar(&o.MetricHistoryRetention, "metric-history-retention", o.MetricHistoryRetention, ""+
+		"time the collected values are kept for to be queried on /debug/metrics-history of --metrics-address. "+
+		"The history is disabled if 0")
+	flags.DurationVar(&o.MetricHistoryResolution, "metric-history-resolution", o.MetricHistoryResolution, ""+
+		"resolution the metric history is downsampled to after 10 minutes")
+	flags.IntVar(&o.MetricStoreMaxEntries, "metric-store-max-entries", o.MetricStoreMaxEntries, ""+
+		"maximum number of metric series kept in the in-memory metric store. The least recently collected series "+
+		"are evicted if exceeded. Unlimited if 0")
+	flags.IntVar(&o.MetricStoreMaxBytes, "metric-store-max-bytes", o.MetricStoreMaxBytes, ""+
+		"maximum estimated size in bytes of the metric series kept in the in-memory metric store. The least "+
+		"recently collected series are evicted if exceeded. Unlimited if 0")
+	flags.DurationVar(&o.MetricTTL, "metric-ttl", o.MetricTTL, ""+
+		"time collected values are served for after they were collected, unless the metric defines a ttl or "+
+		"stale-intervals in its config")
+	flags.Float64Var(&o.CollectorJitter, "collector-jitter", o.CollectorJitter, ""+
+		"fraction of their interval the first collection of the collectors set up at startup is randomly delayed "+
+		"by, such that they don't collect in lockstep. Disabled if 0")
+	flags.DurationVar(&o.CollectorMaxBackoff, "collector-max-backoff", o.CollectorMaxBackoff, ""+
+		"maximum time failing collectors wait before the next collection. The interval of a collector is "+
+		"doubled for each consecutive failure up to this maximum. Backoff is disabled if 0")
+	flags.Float64Var(&o.AdaptiveIntervalFactor, "adaptive-interval-factor", o.AdaptiveIntervalFactor, ""+
+		"factor the collection interval of HPAs which are scaling is divided by and the interval of HPAs at "+
+		"steady state is multiplied by. Disabled if 0")
+	flags.DurationVar(&o.AdaptiveIntervalSteadyPeriod, "adaptive-interval-steady-period", o.AdaptiveIntervalSteadyPeriod, ""+
+		"time since the last scaling after which an HPA is at steady state, if its desired replicas match its "+
+		"current replicas")
+	flags.IntVar(&o.CollectorWorkers, "collector-workers", o.CollectorWorkers, ""+
+		"number of workers running the collections of all collectors. Collections due while all workers are "+
+		"busy are delayed until a worker is free")
+	flags.DurationVar(&o.ShutdownDrainTimeout, "shutdown-drain-timeout", o.ShutdownDrainTimeout, ""+
+		"maximum time to wait on shutdown for the collections in flight to finish and be stored before they "+
+		"are canceled")
+	flags.IntVar(&o.MaxConcurrentCollections, "max-concurrent-collections", o.MaxConcurrentCollections, ""+
+		"maximum number of collections running at the same time. Collectors wait for a free slot before "+
+		"collecting. Unlimited if 0")
+	flags.IntVar(&o.CircuitBreakerThreshold, "circuit-breaker-threshold", o.CircuitBreakerThreshold, ""+
+		"number of consecutive failures after which the circuit of a collector opens and its backend isn't "+
+		"queried for --circuit-breaker-cooldown. Disabled if 0")
+	flags.DurationVar(&o.CircuitBreakerCooldown, "circuit-breaker-cooldown", o.CircuitBreakerCooldown, ""+
+		"time the backend of a collector isn't queried for while its circuit is open")
+	flags.DurationVar(&o.MetricStoreGCInterval, "metric-store-gc-interval", o.MetricStoreGCInterval, ""+
+		"interval at which expired metrics are removed from the metric store")
+	flags.DurationVar(&o.MetricStoreExpiredRetention, "metric-store-expired-retention", o.MetricStoreExpiredRetention, ""+
+		"time expired metrics are kept in the metric store after they expired, to report when they expired "+
+		"instead of reporting them as never collected. The time values are served for is set with --metric-ttl")
+	flags.StringVar(&o.ExpiredMetricPolicy, "expired-metric-policy", o.ExpiredMetricPolicy, ""+
+		"what to serve for metrics which expired while the metric store still remembers them: "+
+		"'not-found' reports them as NotFound, 'serve-last' serves their last collected value. Metrics "+
+		"which were never collected are always reported as NotFound")
+	flags.DurationVar(&o.MaxMetricAge, "max-metric-age", o.MaxMetricAge, ""+
+		"maximum time since collection of served values. Older values are reported as NotFound even if they "+
+		"haven't expired yet. Disabled if 0")
+	flags.DurationVar(&o.HPAStatusInterval, "hpa-status-interval", o.HPAStatusInterval, ""+
+		"interval at which the collection status of each metric is reported as annotation on the HPAs. "+
+		"Status reporting is disabled if 0")
+	flags.BoolVar(&o.LeaderElect, "leader-elect", o.LeaderElect, ""+
+		"whether to elect a leader among multiple replicas. Only the leader collects metrics")
+	flags.StringVar(&o.LeaderElectionNamespace, "leader-election-namespace", o.LeaderElectionNamespace, ""+
+		"namespace of the lease used for leader election")
+	flags.StringVar(&o.LeaderElectionName, "leader-election-name", o.LeaderElectionName, ""+
+		"name of the lease used for leader election")
+	flags.DurationVar(&o.LeaderElectionLeaseDuration, "leader-election-lease-duration", o.LeaderElectionLeaseDuration, ""+
+		"duration that non-leader replicas wait before trying to acquire an unrenewed leadership")
+	flags.DurationVar(&o.LeaderElectionRenewDeadline, "leader-election-renew-deadline", o.LeaderElectionRenewDeadline, ""+
+		"duration that the leader retries renewing the leadership before giving it up")
+	flags.DurationVar(&o.LeaderElectionRetryPeriod, "leader-election-retry-period", o.LeaderElectionRetryPeriod, ""+
+		"duration replicas wait between attempts to acquire or renew the leadership")
+	flags.StringVar(&o.ReplicationAddress, "replication-address", o.ReplicationAddress, ""+
+		"address to serve the gRPC replication of the metric store on. Requires --leader-elect. "+
+		"Replication is disabled if empty")
+	flags.StringVar(&o.ReplicationPeers, "replication-peers", o.ReplicationPeers, ""+
+		"host:port whose host resolves to the addresses of all replicas, e.g. a headless service, "+
+		"the leader pushes the metric store to")
+	flags.StringVar(&o.ReplicationTokenFile, "replication-token-file", o.ReplicationTokenFile, ""+
+		"path of a file containing a token shared by all replicas to authenticate the replication of the metric store. "+
+		"Either the token or mutual TLS is required for replication")
+	flags.StringVar(&o.ReplicationCertFile, "replication-cert-file", o.ReplicationCertFile, ""+
+		"path of the TLS certificate file replicas serve and connect to their peers with for mutual TLS. "+
+		"The certificate must be valid for the host of --replication-peers")
+	flags.StringVar(&o.ReplicationKeyFile, "replication-key-file", o.ReplicationKeyFile, ""+
+		"path of the TLS key file of --replication-cert-file")
+	flags.StringVar(&o.ReplicationCAFile, "replication-ca-file", o.ReplicationCAFile, ""+
+		"path of the CA file the certificates of the replicas are verified with for mutual TLS")
+	flags.StringVar(&o.WebhookAddress, "webhook-address", o.WebhookAddress, ""+
+		"address to serve the validating admission webhook for HPA metric configurations on. "+
+		"The webhook is disabled if empty")
+	flags.StringVar(&o.WebhookCertFile, "webhook-cert-file", o.WebhookCertFile, ""+
+		"path of the TLS certificate file of the validating admission webhook")
+	flags.StringVar(&o.WebhookKeyFile, "webhook-key-file", o.WebhookKeyFile, ""+
+		"path of the TLS key file of the validating admission webhook")
+	flags.BoolVar(&o.WebhookWarnOnly, "webhook-warn-only", o.WebhookWarnOnly, ""+
+		"whether the validating admission webhook admits HPAs with invalid metric configurations with a warning "+
+		"instead of rejecting them")
 
 	return cmd
 }
@@ -87,6 +370,12 @@ func (o AdapterServerOptions) RunCustomMetricsAdapterServer(stopCh <-chan struct
 		return err
 	}
 
+	defaultLocation, err := timewindow.LoadLocation(o.DefaultTimezone)
+	if err != nil {
+		return err
+	}
+	timewindow.SetDefaultLocation(defaultLocation)
+
 	var clientConfig *rest.Config
 	if len(o.RemoteKubeConfigFile) > 0 {
 		loadingRules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: o.RemoteKubeConfigFile}
@@ -105,49 +394,248 @@ func (o AdapterServerOptions) RunCustomMetricsAdapterServer(stopCh <-chan struct
 		return fmt.Errorf("failed to initialize new client: %v", err)
 	}
 
-	collectorFactory := collector.NewCollectorFactory()
+	if o.QueryAuditLog != "" {
+		auditWriter := io.Writer(os.Stdout)
+		if o.QueryAuditLog != "-" {
+			auditFile, err := os.OpenFile(o.QueryAuditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+			if err != nil {
+				return fmt.Errorf("failed to open query audit log: %v", err)
+			}
+			defer auditFile.Close()
+			auditWriter = auditFile
+		}
+		collector.SetQueryAuditLogger(collector.NewQueryAuditLogger(auditWriter, o.QueryAuditLogRate))
+	}
 
-	if o.PrometheusServer != "" {
-		promPlugin, err := collector.NewPrometheusCollectorPlugin(client, o.PrometheusServer)
+	if len(o.RateLimits) > 0 {
+		limits := make(map[string]float64, len(o.RateLimits))
+		for _, value := range o.RateLimits {
+			backend, limit, err := collector.ParseBackendRateLimit(value)
+			if err != nil {
+				return err
+			}
+			limits[backend] = limit
+		}
+		collector.SetBackendRateLimits(limits)
+	}
+
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&corev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "kube-metrics-adapter"})
+
+	dynamicClient, err := dynamic.NewForConfig(clientConfig)
+	if err != nil {
+		return fmt.Errorf("failed to initialize new dynamic client: %v", err)
+	}
+
+	collectorFactory, err := o.newCollectorFactory(client, dynamicClient, recorder, stopCh)
+	if err != nil {
+		return err
+	}
+
+	hpaProvider := provider.NewHPAProvider(client, 30*time.Second, 1*time.Minute, collectorFactory, recorder)
+
+	// the metric store must be set before adding clusters, which share
+	// it.
+	switch o.MetricStore {
+	case "memory":
+	case "redis":
+		if o.RedisAddress == "" {
+			return fmt.Errorf("--redis-address must be set for the redis metric store")
+		}
+
+		store, err := provider.NewRedisMetricStore(provider.RedisConfig{
+			Address:   o.RedisAddress,
+			Password:  os.Getenv("REDIS_PASSWORD"),
+			Database:  o.RedisDatabase,
+			KeyPrefix: o.RedisKeyPrefix,
+		}, 1*time.Minute)
 		if err != nil {
-			return fmt.Errorf("failed to initialize prometheus collector plugin: %v", err)
+			return fmt.Errorf("failed to initialize redis metric store: %v", err)
+		}
+		defer store.Close()
+		hpaProvider.SetMetricStore(store)
+	default:
+		return fmt.Errorf("invalid metric store '%s'", o.MetricStore)
+	}
+
+	if o.MetricTTL > 0 {
+		hpaProvider.SetMetricTTL(o.MetricTTL)
+	}
+
+	if o.MaxMetricAge > 0 {
+		hpaProvider.SetMaxMetricAge(o.MaxMetricAge)
+	}
+
+	if !provider.ValidExpiredMetricPolicy(o.ExpiredMetricPolicy) {
+		return fmt.Errorf("invalid expired metric policy '%s'", o.ExpiredMetricPolicy)
+	}
+	hpaProvider.SetExpiredMetricPolicy(o.ExpiredMetricPolicy)
+
+	if o.MetricStoreGCInterval <= 0 {
+		return fmt.Errorf("--metric-store-gc-interval must be greater than 0")
+	}
+	if o.MetricStoreExpiredRetention < 0 {
+		return fmt.Errorf("--metric-store-expired-retention must not be negative")
+	}
+	hpaProvider.SetMetricStoreGC(o.MetricStoreGCInterval, o.MetricStoreExpiredRetention)
+
+	if o.CollectorJitter < 0 || o.CollectorJitter > 1 {
+		return fmt.Errorf("--collector-jitter must be between 0 and 1")
+	}
+	hpaProvider.SetCollectorJitter(o.CollectorJitter)
+	hpaProvider.SetCollectorMaxBackoff(o.CollectorMaxBackoff)
+	hpaProvider.SetMaxConcurrentCollections(o.MaxConcurrentCollections)
+
+	if o.CollectorWorkers <= 0 {
+		return fmt.Errorf("--collector-workers must be greater than 0")
+	}
+	hpaProvider.SetCollectorWorkers(o.CollectorWorkers)
+	hpaProvider.SetShutdownDrainTimeout(o.ShutdownDrainTimeout)
+
+	if o.AdaptiveIntervalFactor != 0 {
+		if o.AdaptiveIntervalFactor <= 1 {
+			return fmt.Errorf("--adaptive-interval-factor must be greater than 1")
 		}
+		hpaProvider.SetAdaptiveInterval(&provider.AdaptiveIntervalConfig{
+			Factor:       o.AdaptiveIntervalFactor,
+			SteadyPeriod: o.AdaptiveIntervalSteadyPeriod,
+		})
+	}
 
-		err = collectorFactory.RegisterObjectCollector("", "prometheus", promPlugin)
+	if o.CircuitBreakerThreshold > 0 {
+		hpaProvider.SetCircuitBreaker(&provider.CircuitBreakerConfig{
+			Threshold: o.CircuitBreakerThreshold,
+			Cooldown:  o.CircuitBreakerCooldown,
+		})
+	}
+
+	if o.MetricStoreMaxEntries > 0 || o.MetricStoreMaxBytes > 0 {
+		err := hpaProvider.SetMetricStoreLimits(o.MetricStoreMaxEntries, o.MetricStoreMaxBytes)
 		if err != nil {
-			return fmt.Errorf("failed to register prometheus collector plugin: %v", err)
+			return fmt.Errorf("failed to limit the metric store: %v", err)
 		}
+	}
 
-		// skipper collector can only be enabled if prometheus is.
-		if o.SkipperIngressMetrics {
-			skipperPlugin, err := collector.NewSkipperCollectorPlugin(client, promPlugin)
-			if err != nil {
-				return fmt.Errorf("failed to initialize skipper collector plugin: %v", err)
-			}
+	if o.MetricHistoryRetention > 0 {
+		if o.MetricHistoryResolution <= 0 {
+			return fmt.Errorf("--metric-history-resolution must be greater than 0")
+		}
+		hpaProvider.EnableMetricHistory(o.MetricHistoryRetention, o.MetricHistoryResolution)
+	}
 
-			err = collectorFactory.RegisterObjectCollector("Ingress", "", skipperPlugin)
-			if err != nil {
-				return fmt.Errorf("failed to register skipper collector plugin: %v", err)
-			}
+	switch {
+	case o.SnapshotFile != "" && o.SnapshotConfigMap != "":
+		return fmt.Errorf("only one of --snapshot-file and --snapshot-configmap can be set")
+	case (o.SnapshotFile != "" || o.SnapshotConfigMap != "") && o.SnapshotInterval <= 0:
+		return fmt.Errorf("--snapshot-interval must be greater than 0")
+	case o.SnapshotFile != "":
+		hpaProvider.EnableSnapshots(provider.NewFileSnapshotStorage(o.SnapshotFile), o.SnapshotInterval)
+	case o.SnapshotConfigMap != "":
+		parts := strings.Split(o.SnapshotConfigMap, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid snapshot ConfigMap '%s', must be namespace/name", o.SnapshotConfigMap)
 		}
+		hpaProvider.EnableSnapshots(provider.NewConfigMapSnapshotStorage(client, parts[0], parts[1]), o.SnapshotInterval)
 	}
 
-	// register generic pod collector
-	err = collectorFactory.RegisterPodsCollector("", collector.NewPodCollectorPlugin(client))
-	if err != nil {
-		return fmt.Errorf("failed to register skipper collector plugin: %v", err)
+	if o.StandaloneMetrics != "" {
+		standaloneMetrics, err := provider.LoadStandaloneMetrics(o.StandaloneMetrics)
+		if err != nil {
+			return fmt.Errorf("failed to load standalone metrics: %v", err)
+		}
+		hpaProvider.SetStandaloneMetrics(standaloneMetrics)
 	}
 
-	sess, err := session.NewSession()
-	if err != nil {
-		return fmt.Errorf("failed to register skipper collector plugin: %v", err)
+	if len(o.Clusters) > 0 && o.ClusterName == "" {
+		return fmt.Errorf("--cluster-name must be set to discover HPAs in --clusters")
+	}
+	hpaProvider.SetClusterName(o.ClusterName)
+
+	for _, clusterContext := range o.Clusters {
+		if clusterContext == o.ClusterName {
+			return fmt.Errorf("remote cluster %s has the same name as --cluster-name", clusterContext)
+		}
+		err = o.addCluster(hpaProvider, clusterContext, stopCh)
+		if err != nil {
+			return err
+		}
+	}
+
+	if o.HPASelector != "" {
+		_, err := labels.Parse(o.HPASelector)
+		if err != nil {
+			return fmt.Errorf("invalid HPA selector '%s': %v", o.HPASelector, err)
+		}
+		hpaProvider.SetHPASelector(o.HPASelector)
+	}
+
+	if o.ShardCount > 1 {
+		// each instance only collects the metrics of its shard, all
+		// instances can only serve all metrics from a shared store.
+		if o.MetricStore != "redis" {
+			return fmt.Errorf("--shard-count requires --metric-store=redis")
+		}
+
+		shard, err := provider.NewShard(o.ShardIndex, o.ShardCount)
+		if err != nil {
+			return err
+		}
+		hpaProvider.SetShard(shard)
+	}
+
+	if len(o.WatchNamespaces) > 0 || len(o.ExcludeNamespaces) > 0 {
+		hpaProvider.SetNamespaceFilter(provider.NewNamespaceFilter(o.WatchNamespaces, o.ExcludeNamespaces))
+	}
+
+	if o.NamespaceMaxCollectors > 0 || o.NamespaceMaxSeries > 0 {
+		hpaProvider.SetNamespaceQuota(provider.NewNamespaceQuota(o.NamespaceMaxCollectors, o.NamespaceMaxSeries))
+	}
+
+	if o.HPAStatusInterval > 0 {
+		hpaProvider.EnableStatusReporting(o.HPAStatusInterval)
 	}
 
-	if o.AWSExternalMetrics {
-		collectorFactory.RegisterExternalCollector([]string{collector.AWSSQSQueueLengthMetric}, collector.NewAWSCollectorPlugin(sess))
+	if o.LeaderElect {
+		identity, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("failed to get identity for leader election: %v", err)
+		}
+
+		hpaProvider.SetLeaderElection(&provider.LeaderElectionConfig{
+			Namespace:     o.LeaderElectionNamespace,
+			Name:          o.LeaderElectionName,
+			Identity:      identity,
+			LeaseDuration: o.LeaderElectionLeaseDuration,
+			RenewDeadline: o.LeaderElectionRenewDeadline,
+			RetryPeriod:   o.LeaderElectionRetryPeriod,
+		})
 	}
 
-	hpaProvider := provider.NewHPAProvider(client, 30*time.Second, 1*time.Minute, collectorFactory)
+	if o.ReplicationAddress != "" {
+		switch {
+		case !o.LeaderElect:
+			return fmt.Errorf("--replication-address requires --leader-elect")
+		case o.ReplicationPeers == "":
+			return fmt.Errorf("--replication-peers must be set to replicate the metric store")
+		case o.MetricStore != "memory":
+			return fmt.Errorf("only the in-memory metric store can be replicated")
+		}
+
+		replicationConfig := &provider.ReplicationConfig{
+			Address:   o.ReplicationAddress,
+			Peers:     o.ReplicationPeers,
+			TokenFile: o.ReplicationTokenFile,
+			CertFile:  o.ReplicationCertFile,
+			KeyFile:   o.ReplicationKeyFile,
+			CAFile:    o.ReplicationCAFile,
+		}
+		if err := replicationConfig.Validate(); err != nil {
+			return err
+		}
+
+		hpaProvider.EnableReplication(replicationConfig)
+	}
 
 	// convert stop channel to a context
 	ctx, cancel := context.WithCancel(context.Background())
@@ -158,6 +646,29 @@ func (o AdapterServerOptions) RunCustomMetricsAdapterServer(stopCh <-chan struct
 
 	go hpaProvider.Run(ctx)
 
+	if o.MetricsAddress != "" {
+		if (o.MetricsCertFile == "") != (o.MetricsKeyFile == "") {
+			return fmt.Errorf("--metrics-cert-file and --metrics-key-file must be set together")
+		}
+
+		resourceMetrics, err := parseResourceMetricsMapping(o.ResourceMetrics)
+		if err != nil {
+			return err
+		}
+		go serveMetrics(o.MetricsAddress, o.MetricsCertFile, o.MetricsKeyFile, client, hpaProvider, resourceMetrics)
+	}
+
+	if o.WebhookAddress != "" {
+		if o.WebhookCertFile == "" || o.WebhookKeyFile == "" {
+			return fmt.Errorf("--webhook-cert-file and --webhook-key-file must be set to serve the webhook")
+		}
+
+		webhookServer := webhook.NewServer(o.WebhookWarnOnly)
+		go func() {
+			glog.Fatal(webhookServer.ListenAndServeTLS(o.WebhookAddress, o.WebhookCertFile, o.WebhookKeyFile))
+		}()
+	}
+
 	customMetricsProvider := hpaProvider
 	externalMetricsProvider := hpaProvider
 
@@ -170,11 +681,196 @@ func (o AdapterServerOptions) RunCustomMetricsAdapterServer(stopCh <-chan struct
 	}
 
 	// In this example, the same provider implements both Custom Metrics API and External Metrics API
-	server, err := config.Complete().New("kube-metrics-adapter", customMetricsProvider, externalMetricsProvider)
+	server, err := config.Complete(nil).New("kube-metrics-adapter", customMetricsProvider, externalMetricsProvider)
+	if err != nil {
+		return err
+	}
+
+	// standby replicas not holding the collected metrics are taken out of
+	// the endpoints of the metrics API, such that requests reach replicas
+	// which can answer them.
+	err = server.GenericAPIServer.AddReadyzChecks(healthz.NamedCheck("metric-store", func(_ *http.Request) error {
+		return hpaProvider.Ready()
+	}))
 	if err != nil {
 		return err
 	}
-	return server.GenericAPIServer.PrepareRun().Run(ctx.Done())
+
+	err = server.GenericAPIServer.PrepareRun().Run(ctx.Done())
+
+	// the provider stops collecting once the context is canceled, wait
+	// for the collections in flight to be stored before exiting.
+	hpaProvider.WaitForShutdown()
+	return err
+}
+
+// newCollectorFactory initializes a collector factory with the collector
+// plugins enabled by the options, using the clients of the cluster the HPAs
+// are discovered in.
+func (o AdapterServerOptions) newCollectorFactory(client kubernetes.Interface, dynamicClient dynamic.Interface, recorder record.EventRecorder, stopCh <-chan struct{}) (*collector.CollectorFactory, error) {
+	collectorFactory := collector.NewCollectorFactory(client, recorder)
+	collectorFactory.SetDynamicClient(dynamicClient)
+
+	if o.QueryPolicy != "" {
+		queryPolicy, err := collector.LoadQueryPolicy(o.QueryPolicy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load query policy: %v", err)
+		}
+		collectorFactory.SetQueryPolicy(queryPolicy)
+	}
+
+	if o.PrometheusOperatorSelector != "" {
+		discovered, err := collector.DiscoverPrometheusServer(dynamicClient, o.PrometheusOperatorNamespace, o.PrometheusOperatorSelector)
+		if err != nil {
+			if o.PrometheusServer == "" {
+				return nil, fmt.Errorf("failed to discover prometheus server: %v", err)
+			}
+			glog.Warningf("Failed to discover prometheus server, falling back to %s: %v", o.PrometheusServer, err)
+		} else {
+			glog.Infof("Discovered prometheus server %s", discovered)
+			// the discovered server replaces the configured one.
+			o.PrometheusServer = discovered
+		}
+	}
+
+	plugins := o.collectorPlugins(client, dynamicClient, nil, stopCh)
+	if o.MockBackends {
+		err := registerMockCollectors(client, collectorFactory, plugins, o.MockValues)
+		if err != nil {
+			return nil, fmt.Errorf("failed to register mock collector plugins: %v", err)
+		}
+	} else {
+		err := registerCollectors(collectorFactory, plugins)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := registerMetaCollectors(collectorFactory)
+	if err != nil {
+		return nil, err
+	}
+
+	// the plugin config is applied last, such that it can disable any of
+	// the collectors registered above.
+	if o.PluginConfig != "" {
+		if o.PluginConfigInterval <= 0 {
+			return nil, fmt.Errorf("--plugin-config-interval must be greater than 0")
+		}
+
+		err = collectorFactory.WatchPluginConfig(o.PluginConfig, o.PluginConfigInterval, stopCh)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load plugin config: %v", err)
+		}
+	}
+
+	return collectorFactory, nil
+}
+
+// prometheusAuth returns the authentication of the requests to the
+// Prometheus server defined by the options.
+func (o AdapterServerOptions) prometheusAuth() (*collector.PrometheusAuth, error) {
+	auth := &collector.PrometheusAuth{
+		BearerTokenFile: o.PrometheusBearerTokenFile,
+		Username:        o.PrometheusUsername,
+		Headers:         make(map[string]string, len(o.PrometheusHeaders)),
+	}
+
+	if o.PrometheusBearerTokenFile != "" && o.PrometheusUsername != "" {
+		return nil, fmt.Errorf("--prometheus-bearer-token-file and --prometheus-username can't be combined")
+	}
+
+	if o.PrometheusPasswordFile != "" {
+		if o.PrometheusUsername == "" {
+			return nil, fmt.Errorf("--prometheus-password-file requires --prometheus-username")
+		}
+
+		password, err := ioutil.ReadFile(o.PrometheusPasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prometheus password: %v", err)
+		}
+		auth.Password = strings.TrimSpace(string(password))
+	}
+
+	for _, header := range o.PrometheusHeaders {
+		name, value, err := collector.ParsePrometheusHeader(header)
+		if err != nil {
+			return nil, err
+		}
+		auth.Headers[name] = value
+	}
+
+	return auth, nil
+}
+
+// addCluster adds the remote cluster of a context of the cluster kubeconfig
+// to the HPA provider. The context name is used as cluster name.
+func (o AdapterServerOptions) addCluster(hpaProvider *provider.HPAProvider, clusterContext string, stopCh <-chan struct{}) error {
+	loadingRules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: o.ClusterKubeConfigFile}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: clusterContext}
+	clientConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+	if err != nil {
+		return fmt.Errorf("unable to construct client config for cluster %s: %v", clusterContext, err)
+	}
+
+	client, err := kubernetes.NewForConfig(clientConfig)
+	if err != nil {
+		return fmt.Errorf("failed to initialize new client for cluster %s: %v", clusterContext, err)
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(clientConfig)
+	if err != nil {
+		return fmt.Errorf("failed to initialize new dynamic client for cluster %s: %v", clusterContext, err)
+	}
+
+	// events are recorded on the HPAs in their cluster.
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&corev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "kube-metrics-adapter"})
+
+	collectorFactory, err := o.newCollectorFactory(client, dynamicClient, recorder, stopCh)
+	if err != nil {
+		return fmt.Errorf("failed to initialize collectors for cluster %s: %v", clusterContext, err)
+	}
+
+	glog.Infof("Discovering HPAs in cluster %s", clusterContext)
+	hpaProvider.AddCluster(clusterContext, client, collectorFactory, recorder)
+	return nil
+}
+
+// parseResourceMetricsMapping parses a mapping of resources to metric names
+// of the form <resource>=<metric>,...
+func parseResourceMetricsMapping(mapping string) (map[v1.ResourceName]string, error) {
+	resourceMetrics := make(map[v1.ResourceName]string)
+	if mapping == "" {
+		return resourceMetrics, nil
+	}
+
+	for _, pair := range strings.Split(mapping, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid resource metrics mapping '%s'", pair)
+		}
+		resourceMetrics[v1.ResourceName(parts[0])] = parts[1]
+	}
+
+	return resourceMetrics, nil
+}
+
+// parseNamespaceMapping parses a mapping of namespaces to values of the form
+// team-a=tenant-a,team-b=tenant-b. A namespace can be mapped to multiple
+// values by repeating it.
+func parseNamespaceMapping(mapping string) (map[string][]string, error) {
+	namespaceValues := make(map[string][]string)
+	for _, pair := range strings.Split(mapping, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid namespace mapping '%s'", pair)
+		}
+		namespaceValues[parts[0]] = append(namespaceValues[parts[0]], parts[1])
+	}
+
+	return namespaceValues, nil
 }
 
 type AdapterServerOptions struct {
@@ -189,10 +885,291 @@ type AdapterServerOptions struct {
 	// PrometheusServer enables prometheus queries to the specified
 	// server.
 	PrometheusServer string
+	// VictoriaMetricsServer enables the victoriametrics collector querying
+	// the specified server.
+	VictoriaMetricsServer string
+	// VictoriaMetricsBearerTokenFile is the path of the file containing
+	// the bearer token sent to VictoriaMetricsServer.
+	VictoriaMetricsBearerTokenFile string
+	// InfluxDBServer enables the influxdb collector querying the specified
+	// server.
+	InfluxDBServer string
+	// InfluxDBOrg is the default organization of the InfluxDB queries.
+	InfluxDBOrg string
+	// InfluxDBTokenFile is the path of the file containing the default
+	// API token of the InfluxDB queries.
+	InfluxDBTokenFile string
+	// GraphiteServer enables the graphite collector querying the specified
+	// server.
+	GraphiteServer string
+	// DatadogMetrics enables the datadog collector.
+	DatadogMetrics bool
+	// DatadogSite is the default Datadog site of the queries.
+	DatadogSite string
+	// DatadogAPIKeyFile and DatadogAppKeyFile are the paths of the files
+	// containing the default Datadog API and application keys.
+	DatadogAPIKeyFile string
+	DatadogAppKeyFile string
+	// NewRelicMetrics enables the newrelic collector.
+	NewRelicMetrics bool
+	// NewRelicRegion and NewRelicAccountID are the default region and
+	// account ID of the NRQL queries.
+	NewRelicRegion    string
+	NewRelicAccountID string
+	// NewRelicAPIKeyFile is the path of the file containing the default
+	// New Relic API key.
+	NewRelicAPIKeyFile string
+	// DynatraceMetrics enables the dynatrace collector.
+	DynatraceMetrics bool
+	// DynatraceEnvironment is the url of the default Dynatrace
+	// environment.
+	DynatraceEnvironment string
+	// DynatraceTokenFile is the path of the file containing the default
+	// Dynatrace API token.
+	DynatraceTokenFile string
+	// AppDynamicsMetrics enables the appdynamics collector.
+	AppDynamicsMetrics bool
+	// AppDynamicsController is the url of the default AppDynamics
+	// controller.
+	AppDynamicsController string
+	// AppDynamicsTokenFile is the path of the file containing the default
+	// AppDynamics API client token.
+	AppDynamicsTokenFile string
+	// WavefrontMetrics enables the wavefront collector.
+	WavefrontMetrics bool
+	// WavefrontCluster is the url of the default Wavefront cluster.
+	WavefrontCluster string
+	// WavefrontTokenFile is the path of the file containing the default
+	// Wavefront API token.
+	WavefrontTokenFile string
+	// GCPMonitoringMetrics enables the gcp-monitoring collector.
+	GCPMonitoringMetrics bool
+	// GCPProject is the default Google Cloud project.
+	GCPProject string
+	// GCPCredentialsFile is the path of the default service account key
+	// file.
+	GCPCredentialsFile string
+	// AzureMonitorMetrics enables the azure-monitor collector.
+	AzureMonitorMetrics bool
+	// AzureServiceBusMetrics enables the azure-servicebus collector.
+	AzureServiceBusMetrics bool
+	// AzureClientID is the client ID of the managed identity of the Azure
+	// collectors.
+	AzureClientID string
+	// PrometheusBearerTokenFile is the path of the file containing the
+	// bearer token sent to PrometheusServer.
+	PrometheusBearerTokenFile string
+	// PrometheusUsername and PrometheusPasswordFile are the basic auth
+	// credentials of PrometheusServer.
+	PrometheusUsername     string
+	PrometheusPasswordFile string
+	// PrometheusHeaders are the headers sent to PrometheusServer, as
+	// <name>: <value>.
+	PrometheusHeaders []string
+	// PrometheusNamespaceTenants is a mapping of namespaces to the
+	// tenants the HPAs of the namespace may query.
+	PrometheusNamespaceTenants string
+	// PrometheusAllowedServers are the comma separated servers HPAs may
+	// query instead of PrometheusServer. HPAs can't query other servers
+	// if empty.
+	PrometheusAllowedServers string
+	// PrometheusOperatorSelector enables discovering the prometheus
+	// server from Prometheus Operator resources matching the selector.
+	PrometheusOperatorSelector string
+	// PrometheusOperatorNamespace is the namespace to discover Prometheus
+	// Operator resources in.
+	PrometheusOperatorNamespace string
 	// SkipperIngressMetrics switches on support for skipper ingress based
 	// metric collection.
 	SkipperIngressMetrics bool
 	// AWSExternalMetrics switches on support for getting external metrics
 	// from AWS.
 	AWSExternalMetrics bool
+	// AWSNamespaceRoles is a mapping of namespaces to the IAM roles the
+	// HPAs of the namespace may assume.
+	AWSNamespaceRoles string
+	// JobQueueMetrics switches on support for getting external metrics
+	// based on the number of queued Jobs in a namespace.
+	JobQueueMetrics bool
+	// ScalingScheduleMetrics switches on support for getting external
+	// metrics based on ScalingSchedule and ClusterScalingSchedule
+	// resources.
+	ScalingScheduleMetrics bool
+	// QueryAuditLog is the path of the file to log the queries run
+	// against metric backends to.
+	QueryAuditLog string
+	// QueryAuditLogRate is the maximum number of query audit records
+	// written per second.
+	QueryAuditLogRate float64
+	// RateLimits are the rate limits of the collections of the backends,
+	// as <backend>=<n>/<unit>.
+	RateLimits []string
+	// MetricsAddress is the address to serve the health of the metric
+	// collection on.
+	MetricsAddress string
+	// MetricsCertFile is the path of the TLS certificate file of the
+	// metrics address.
+	MetricsCertFile string
+	// MetricsKeyFile is the path of the TLS key file of the metrics
+	// address.
+	MetricsKeyFile string
+	// MockBackends switches all collectors to mock collectors returning
+	// synthetic values for offline development.
+	MockBackends bool
+	// MockValues is the path of a file defining the synthetic values per
+	// metric name.
+	MockValues string
+	// DefaultTimezone is the timezone used for time windows which don't
+	// define a timezone.
+	DefaultTimezone string
+	// ResourceMetrics is a mapping of resources to pod metrics which are
+	// served in the shape of the resource metrics API.
+	ResourceMetrics string
+	// QueryPolicy is the path of the file defining the policy for queries
+	// defined in HPA annotations.
+	QueryPolicy string
+	// PluginConfig is the path of the file defining external collector
+	// plugins and disabled collectors.
+	PluginConfig string
+	// PluginConfigInterval is the interval at which the plugin config is
+	// checked for changes.
+	PluginConfigInterval time.Duration
+	// StandaloneMetrics is the path of the file defining external metrics
+	// which are collected without an HPA referencing them.
+	StandaloneMetrics string
+	// ClusterKubeConfigFile is the kubeconfig defining the contexts of
+	// the remote clusters.
+	ClusterKubeConfigFile string
+	// Clusters are the contexts of the remote clusters to discover HPAs
+	// in.
+	Clusters []string
+	// ClusterName is the name of the cluster the adapter runs in, which
+	// its external metrics are labeled with.
+	ClusterName string
+	// HPASelector is the label selector restricting the HPAs to discover.
+	HPASelector string
+	// ShardCount is the number of adapter instances the HPAs are sharded
+	// across.
+	ShardCount int
+	// ShardIndex is the index of the shard of this adapter instance.
+	ShardIndex int
+	// WatchNamespaces are the namespaces to discover HPAs in and serve
+	// metrics for. All namespaces if empty.
+	WatchNamespaces []string
+	// ExcludeNamespaces are the namespaces to not discover HPAs in and
+	// not serve metrics for.
+	ExcludeNamespaces []string
+	// NamespaceMaxCollectors and NamespaceMaxSeries limit the number of
+	// collectors and stored metric series of the HPAs of a namespace.
+	NamespaceMaxCollectors int
+	NamespaceMaxSeries     int
+	// MetricStore is the backend of the store of collected metrics,
+	// memory or redis.
+	MetricStore string
+	// RedisAddress, RedisDatabase and RedisKeyPrefix configure the Redis
+	// server of the redis metric store.
+	RedisAddress   string
+	RedisDatabase  int
+	RedisKeyPrefix string
+	// SnapshotFile is the path of the file to save snapshots of the
+	// metric store to.
+	SnapshotFile string
+	// SnapshotConfigMap is the namespace/name of the ConfigMap to save
+	// snapshots of the metric store to.
+	SnapshotConfigMap string
+	// SnapshotInterval is the interval at which snapshots of the metric
+	// store are saved.
+	SnapshotInterval time.Duration
+	// MetricStoreMaxEntries and MetricStoreMaxBytes limit the number of
+	// series and their estimated size kept in the in-memory metric
+	// store.
+	MetricStoreMaxEntries int
+	MetricStoreMaxBytes   int
+	// MetricHistoryRetention is the time the collected values are kept
+	// for in the metric history. MetricHistoryResolution is the
+	// resolution the history is downsampled to.
+	MetricHistoryRetention  time.Duration
+	MetricHistoryResolution time.Duration
+	// MetricTTL is the time collected values are served for if their
+	// config defines neither a TTL nor a staleness policy.
+	MetricTTL time.Duration
+	// CollectorJitter is the fraction of their interval the first
+	// collection of the collectors set up at startup is delayed by.
+	CollectorJitter float64
+	// CollectorMaxBackoff is the maximum time failing collectors wait
+	// before the next collection.
+	CollectorMaxBackoff time.Duration
+	// AdaptiveIntervalFactor is the factor the collection interval of
+	// scaling HPAs is divided by and the interval of steady HPAs is
+	// multiplied by. HPAs are steady once they didn't scale for
+	// AdaptiveIntervalSteadyPeriod.
+	AdaptiveIntervalFactor       float64
+	AdaptiveIntervalSteadyPeriod time.Duration
+	// CollectorWorkers is the number of workers running the collections.
+	CollectorWorkers int
+	// ShutdownDrainTimeout is the maximum time the collections in flight
+	// are waited for on shutdown.
+	ShutdownDrainTimeout time.Duration
+	// MaxConcurrentCollections is the maximum number of collections
+	// running at the same time.
+	MaxConcurrentCollections int
+	// CircuitBreakerThreshold is the number of consecutive failures after
+	// which the circuit of a collector opens for CircuitBreakerCooldown.
+	CircuitBreakerThreshold int
+	CircuitBreakerCooldown  time.Duration
+	// MetricStoreGCInterval is the interval at which expired metrics are
+	// removed from the metric store. MetricStoreExpiredRetention is the
+	// time expired metrics are kept in the store before.
+	MetricStoreGCInterval       time.Duration
+	MetricStoreExpiredRetention time.Duration
+	// ExpiredMetricPolicy defines what is served for expired metrics.
+	ExpiredMetricPolicy string
+	// MaxMetricAge is the maximum time since collection of served values.
+	MaxMetricAge time.Duration
+	// HPAStatusInterval is the interval at which the collection status
+	// is reported on the HPAs.
+	HPAStatusInterval time.Duration
+	// LeaderElect enables leader election among multiple replicas such
+	// that only the leader collects metrics.
+	LeaderElect bool
+	// LeaderElectionNamespace is the namespace of the lease used for
+	// leader election.
+	LeaderElectionNamespace string
+	// LeaderElectionName is the name of the lease used for leader
+	// election.
+	LeaderElectionName string
+	// LeaderElectionLeaseDuration is the duration that non-leader
+	// replicas wait before trying to acquire an unrenewed leadership.
+	LeaderElectionLeaseDuration time.Duration
+	// LeaderElectionRenewDeadline is the duration that the leader retries
+	// renewing the leadership before giving it up.
+	LeaderElectionRenewDeadline time.Duration
+	// LeaderElectionRetryPeriod is the duration replicas wait between
+	// attempts to acquire or renew the leadership.
+	LeaderElectionRetryPeriod time.Duration
+	// ReplicationAddress is the address to serve the replication of the
+	// metric store on.
+	ReplicationAddress string
+	// ReplicationPeers is the host:port resolving to the addresses of
+	// all replicas the leader replicates the metric store to.
+	ReplicationPeers string
+	// ReplicationTokenFile is the path of the file containing the token
+	// shared by all replicas to authenticate the replication.
+	ReplicationTokenFile string
+	// ReplicationCertFile, ReplicationKeyFile and ReplicationCAFile
+	// configure mutual TLS for the replication.
+	ReplicationCertFile string
+	ReplicationKeyFile  string
+	ReplicationCAFile   string
+	// WebhookAddress is the address to serve the validating admission
+	// webhook for HPA metric configurations on.
+	WebhookAddress string
+	// WebhookCertFile is the path of the TLS certificate file of the
+	// webhook.
+	WebhookCertFile string
+	// WebhookKeyFile is the path of the TLS key file of the webhook.
+	WebhookKeyFile string
+	// WebhookWarnOnly makes the webhook admit HPAs with invalid metric
+	// configurations with a warning instead of rejecting them.
+	WebhookWarnOnly bool
 }
@@ -0,0 +1,405 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/ghodss/yaml"
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/provider"
+	"github.com/spf13/cobra"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// defaultValidateInterval is the collector interval reported for
+	// metrics which don't define one, matching the default of the
+	// adapter.
+	defaultValidateInterval = "1m"
+
+	// dryRunPlaceholder is the placeholder of the accounts of the adapter
+	// the collector plugins are initialized with for validation.
+	dryRunPlaceholder = "dry-run"
+	// dryRunCredentialFile is the placeholder of the credential files of
+	// the adapter, which are never read for validation.
+	dryRunCredentialFile = "/dev/null"
+)
+
+// yamlDocumentSeparator splits multi document YAML files.
+var yamlDocumentSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// ValidateOptions are the options of the validate command.
+type ValidateOptions struct {
+	// Files are the paths of HPA manifests to validate. Use '-' for
+	// stdin.
+	Files []string
+	// KubeConfigFile is the kubeconfig of the cluster to validate the HPAs
+	// of if no files are specified.
+	KubeConfigFile string
+	// Namespace is the namespace to validate the HPAs of in the cluster.
+	// All namespaces if empty.
+	Namespace string
+	// QueryPolicy is the path of the file defining the policy for queries
+	// defined in HPA annotations.
+	QueryPolicy string
+	// PrometheusAllowedServers are the Prometheus servers HPAs can query
+	// besides the server of the adapter, like the flag of the adapter.
+	PrometheusAllowedServers string
+}
+
+// NewCommandValidate provides a CLI handler for the 'validate' command which
+// validates the metric configuration of HPAs without collecting any
+// metrics.
+func NewCommandValidate() *cobra.Command {
+	o := ValidateOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate the metric configuration of HPAs",
+		Long: "Validate the metric configuration of HPAs from manifest files or a live cluster and report " +
+			"which metrics would be collected and which queries would be run, without accessing the network",
+		RunE: func(c *cobra.Command, args []string) error {
+			return o.Run(c.OutOrStdout())
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringSliceVarP(&o.Files, "filename", "f", o.Files, ""+
+		"HPA manifest files to validate. Use '-' for stdin. Validates the HPAs of the cluster if not set")
+	flags.StringVar(&o.KubeConfigFile, "kubeconfig", o.KubeConfigFile, ""+
+		"kubeconfig file of the cluster to validate the HPAs of")
+	flags.StringVarP(&o.Namespace, "namespace", "n", o.Namespace, ""+
+		"namespace to validate the HPAs of in the cluster. Defaults to all namespaces")
+	flags.StringVar(&o.QueryPolicy, "query-policy", o.QueryPolicy, ""+
+		"path of a file defining the policy for queries defined in HPA annotations")
+	flags.StringVar(&o.PrometheusAllowedServers, "prometheus-allowed-servers", o.PrometheusAllowedServers, ""+
+		"comma separated list of prometheus servers HPAs are allowed to query, like the flag of the adapter")
+
+	return cmd
+}
+
+// Run validates the HPAs and writes the report to out. An error is returned
+// if any HPA is invalid.
+func (o ValidateOptions) Run(out io.Writer) error {
+	var client kubernetes.Interface
+	var dynamicClient dynamic.Interface
+	var hpas []autoscalingv2.HorizontalPodAutoscaler
+
+	if len(o.Files) > 0 {
+		for _, file := range o.Files {
+			fileHPAs, err := readHPAManifests(file)
+			if err != nil {
+				return err
+			}
+			hpas = append(hpas, fileHPAs...)
+		}
+	} else {
+		loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+		loadingRules.ExplicitPath = o.KubeConfigFile
+		clientConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{}).ClientConfig()
+		if err != nil {
+			return fmt.Errorf("unable to construct client config: %v", err)
+		}
+
+		client, err = kubernetes.NewForConfig(clientConfig)
+		if err != nil {
+			return fmt.Errorf("failed to initialize new client: %v", err)
+		}
+
+		dynamicClient, err = dynamic.NewForConfig(clientConfig)
+		if err != nil {
+			return fmt.Errorf("failed to initialize new dynamic client: %v", err)
+		}
+
+		hpas, err = provider.ListHPAs(client, o.Namespace)
+		if err != nil {
+			return fmt.Errorf("failed to list HPAs: %v", err)
+		}
+	}
+
+	// the collector plugins are initialized with clients refusing all
+	// requests, the cluster is only accessed to read the HPAs and their
+	// metric configuration resources.
+	restConfig := &rest.Config{Host: "https://kubernetes.dry-run.invalid", Transport: collector.NewDryRunTransport()}
+	dryRunClient, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return fmt.Errorf("failed to initialize new dry run client: %v", err)
+	}
+
+	dryRunDynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return fmt.Errorf("failed to initialize new dry run dynamic client: %v", err)
+	}
+
+	if client == nil {
+		client, dynamicClient = dryRunClient, dryRunDynamicClient
+	}
+
+	collectorFactory := collector.NewCollectorFactory(client, nil)
+	collectorFactory.SetDynamicClient(dynamicClient)
+
+	if o.QueryPolicy != "" {
+		queryPolicy, err := collector.LoadQueryPolicy(o.QueryPolicy)
+		if err != nil {
+			return fmt.Errorf("failed to load query policy: %v", err)
+		}
+		collectorFactory.SetQueryPolicy(queryPolicy)
+	}
+
+	recorder := collector.NewDryRunRecorder()
+	err = o.registerDryRunCollectors(collectorFactory, dryRunClient, dryRunDynamicClient, recorder)
+	if err != nil {
+		return err
+	}
+
+	invalid := 0
+	for i := range hpas {
+		if !validateHPA(out, collectorFactory, recorder, &hpas[i]) {
+			invalid++
+		}
+	}
+
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d HPA(s) have an invalid metric configuration", invalid, len(hpas))
+	}
+
+	fmt.Fprintf(out, "%d HPA(s) validated\n", len(hpas))
+	return nil
+}
+
+// dryRunOptions returns the options the collector plugins are initialized
+// with for validation. All plugins are enabled, with placeholders for the
+// servers, accounts and credential files of the adapter.
+func (o ValidateOptions) dryRunOptions() AdapterServerOptions {
+	return AdapterServerOptions{
+		PrometheusServer:         "http://prometheus.dry-run.invalid",
+		PrometheusAllowedServers: o.PrometheusAllowedServers,
+		SkipperIngressMetrics:    true,
+		VictoriaMetricsServer:    "http://victoriametrics.dry-run.invalid",
+		InfluxDBServer:           "http://influxdb.dry-run.invalid",
+		InfluxDBOrg:              dryRunPlaceholder,
+		InfluxDBTokenFile:        dryRunCredentialFile,
+		GraphiteServer:           "http://graphite.dry-run.invalid",
+		DatadogMetrics:           true,
+		DatadogAPIKeyFile:        dryRunCredentialFile,
+		DatadogAppKeyFile:        dryRunCredentialFile,
+		NewRelicMetrics:          true,
+		NewRelicAccountID:        "0",
+		NewRelicAPIKeyFile:       dryRunCredentialFile,
+		DynatraceMetrics:         true,
+		DynatraceEnvironment:     "https://dynatrace.dry-run.invalid",
+		DynatraceTokenFile:       dryRunCredentialFile,
+		AppDynamicsMetrics:       true,
+		AppDynamicsController:    "https://appdynamics.dry-run.invalid",
+		AppDynamicsTokenFile:     dryRunCredentialFile,
+		WavefrontMetrics:         true,
+		WavefrontCluster:         "https://wavefront.dry-run.invalid",
+		WavefrontTokenFile:       dryRunCredentialFile,
+		GCPMonitoringMetrics:     true,
+		GCPProject:               dryRunPlaceholder,
+		AzureMonitorMetrics:      true,
+		AzureServiceBusMetrics:   true,
+		AWSExternalMetrics:       true,
+		JobQueueMetrics:          true,
+		ScalingScheduleMetrics:   true,
+	}
+}
+
+// registerDryRunCollectors registers the collector plugins of the adapter
+// for validation. The plugins are initialized with clients refusing all
+// requests and record the configs of the collectors they create. Plugins
+// which can't be initialized without network access reject all metrics
+// with a dry run error.
+func (o ValidateOptions) registerDryRunCollectors(collectorFactory *collector.CollectorFactory, client kubernetes.Interface, dynamicClient dynamic.Interface, recorder *collector.DryRunRecorder) error {
+	awsConfig := &aws.Config{
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.AnonymousCredentials,
+		HTTPClient:  &http.Client{Transport: collector.NewDryRunTransport()},
+	}
+
+	// plugins waiting for the cluster, like the job queue plugin waiting
+	// for its informer to sync, give up right away.
+	stopCh := make(chan struct{})
+	close(stopCh)
+
+	for _, plugin := range o.dryRunOptions().collectorPlugins(client, dynamicClient, awsConfig, stopCh) {
+		p, err := plugin.new()
+		if err != nil {
+			p = &unavailableCollectorPlugin{
+				err: fmt.Errorf("%s collector plugin can't be initialized, %v: %v", plugin.name, collector.ErrDryRun, err),
+			}
+		}
+
+		// the default google cloud credentials would be looked up
+		// from the metadata server.
+		if gcpMonitoringPlugin, ok := p.(*collector.GCPMonitoringCollectorPlugin); ok {
+			gcpMonitoringPlugin.SetDefaultCredentials(&google.Credentials{
+				ProjectID:   dryRunPlaceholder,
+				TokenSource: dryRunTokenSource{},
+			})
+		}
+
+		err = plugin.register(collectorFactory, recorder.Wrap(p))
+		if err != nil {
+			return err
+		}
+	}
+
+	return registerMetaCollectors(collectorFactory)
+}
+
+// unavailableCollectorPlugin is a collector plugin which can't be
+// initialized for validation.
+type unavailableCollectorPlugin struct {
+	err error
+}
+
+// NewCollector returns the error of initializing the plugin.
+func (p *unavailableCollectorPlugin) NewCollector(hpa *autoscalingv2.HorizontalPodAutoscaler, config *collector.MetricConfig, interval time.Duration) (collector.Collector, error) {
+	return nil, p.err
+}
+
+// dryRunTokenSource is an oauth2.TokenSource refusing to get tokens.
+type dryRunTokenSource struct{}
+
+// Token returns the dry run error.
+func (dryRunTokenSource) Token() (*oauth2.Token, error) {
+	return nil, collector.ErrDryRun
+}
+
+// validateHPA validates the metric configuration of a single HPA and writes
+// the metrics which would be collected to out. It returns false if the
+// configuration is invalid.
+func validateHPA(out io.Writer, collectorFactory *collector.CollectorFactory, recorder *collector.DryRunRecorder, hpa *autoscalingv2.HorizontalPodAutoscaler) bool {
+	fmt.Fprintf(out, "%s/%s:\n", hpa.Namespace, hpa.Name)
+
+	metricConfigs, err := collector.ParseHPAMetrics(hpa)
+	if err != nil {
+		fmt.Fprintf(out, "  error: %v\n", err)
+		return false
+	}
+
+	valid := true
+	for _, config := range metricConfigs {
+		_, err := collectorFactory.NewCollector(hpa, config, config.Interval)
+		if err != nil {
+			// drop configs recorded before the error.
+			recorder.Configs()
+
+			// metrics which can only be checked with network access
+			// aren't invalid.
+			if collector.IsDryRunError(err) {
+				fmt.Fprintf(out, "  %s %s: not checked: %v\n", config.Type, config.Name, err)
+				continue
+			}
+
+			fmt.Fprintf(out, "  %s %s: error: %v\n", config.Type, config.Name, err)
+			valid = false
+			continue
+		}
+
+		for _, collected := range recorder.Configs() {
+			interval := defaultValidateInterval
+			if collected.Interval > 0 {
+				interval = collected.Interval.String()
+			}
+
+			collectorName := collected.CollectorName
+			if collectorName == "" {
+				collectorName = "default"
+			}
+
+			fmt.Fprintf(out, "  %s %s (collector: %s, interval: %s)\n", collected.Type, collected.Name, collectorName, interval)
+
+			keys := make([]string, 0, len(collected.Config))
+			for key := range collected.Config {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			for _, key := range keys {
+				fmt.Fprintf(out, "    %s: %s\n", key, strings.TrimSpace(collector.RedactConfigValue(key, collected.Config[key])))
+			}
+		}
+	}
+
+	return valid
+}
+
+// readHPAManifests reads the HPAs from a YAML or JSON manifest file which
+// may contain multiple documents. Other kinds of resources are skipped.
+func readHPAManifests(file string) ([]autoscalingv2.HorizontalPodAutoscaler, error) {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var hpas []autoscalingv2.HorizontalPodAutoscaler
+	for _, document := range yamlDocumentSeparator.Split(string(data), -1) {
+		if strings.TrimSpace(document) == "" {
+			continue
+		}
+
+		var typeMeta metav1.TypeMeta
+		err := yaml.Unmarshal([]byte(document), &typeMeta)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", file, err)
+		}
+
+		if typeMeta.Kind != "HorizontalPodAutoscaler" {
+			continue
+		}
+
+		// autoscaling/v2beta2 HPAs have the same shape as
+		// autoscaling/v2 HPAs, autoscaling/v1 HPAs don't define any
+		// metrics.
+		var hpa autoscalingv2.HorizontalPodAutoscaler
+		switch typeMeta.APIVersion {
+		case autoscalingv1.SchemeGroupVersion.String():
+			continue
+		case autoscalingv2beta1.SchemeGroupVersion.String():
+			var v2beta1HPA autoscalingv2beta1.HorizontalPodAutoscaler
+			err = yaml.Unmarshal([]byte(document), &v2beta1HPA)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse HPA in %s: %v", file, err)
+			}
+			hpa = *provider.ConvertV2beta1HPA(&v2beta1HPA)
+		default:
+			err = yaml.Unmarshal([]byte(document), &hpa)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse HPA in %s: %v", file, err)
+			}
+		}
+
+		if hpa.Namespace == "" {
+			hpa.Namespace = metav1.NamespaceDefault
+		}
+		hpas = append(hpas, hpa)
+	}
+
+	return hpas, nil
+}
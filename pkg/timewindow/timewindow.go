@@ -0,0 +1,260 @@
+// Package timewindow implements timezone aware recurring time windows like
+// "Mon-Fri 09:00-17:00" shared by the features scheduling collection or
+// scaling behavior by wall clock time.
+//
+// Windows are defined in wall clock time of a location, so a window from
+// 09:00 to 17:00 always covers 09:00 to 17:00 local time, independent of
+// daylight saving time. Around DST transitions the following rules apply:
+//
+//   - When the clocks are set forward, wall clock times in the skipped hour
+//     don't exist. A window starting in the skipped hour starts at the first
+//     instant after the transition.
+//   - When the clocks are set back, wall clock times in the repeated hour
+//     occur twice. Both occurrences are contained in a window covering them
+//     and a window starting in the repeated hour starts at the first
+//     occurrence.
+package timewindow
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	defaultLocationMu sync.RWMutex
+	defaultLocation   = time.UTC
+)
+
+// SetDefaultLocation sets the location used for windows which don't define
+// a timezone.
+func SetDefaultLocation(loc *time.Location) {
+	defaultLocationMu.Lock()
+	defer defaultLocationMu.Unlock()
+	defaultLocation = loc
+}
+
+// DefaultLocation returns the location used for windows which don't define
+// a timezone.
+func DefaultLocation() *time.Location {
+	defaultLocationMu.RLock()
+	defer defaultLocationMu.RUnlock()
+	return defaultLocation
+}
+
+// LoadLocation returns the location for an IANA timezone name like
+// "Europe/Berlin". An empty name returns the default location.
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return DefaultLocation(), nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone '%s': %v", name, err)
+	}
+	return loc, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Window is a recurring time window on a set of weekdays. A window whose end
+// is before its start spans midnight and belongs to the day it starts on.
+type Window struct {
+	// Days are the weekdays the window starts on.
+	Days [7]bool
+	// Start and End are the minutes since midnight in wall clock time.
+	Start int
+	End   int
+	// Location is the location the wall clock times are defined in.
+	Location *time.Location
+}
+
+// Parse parses a window definition of the form "[days] HH:MM-HH:MM" in the
+// specified timezone. Days are a comma separated list of weekdays or ranges
+// of weekdays like "Mon-Fri,Sun". Without days the window recurs every day.
+// An empty timezone uses the default location.
+func Parse(definition, timezone string) (*Window, error) {
+	loc, err := LoadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Window{Location: loc}
+
+	fields := strings.Fields(definition)
+	var times string
+	switch len(fields) {
+	case 1:
+		times = fields[0]
+		for i := range w.Days {
+			w.Days[i] = true
+		}
+	case 2:
+		err = w.parseDays(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		times = fields[1]
+	default:
+		return nil, fmt.Errorf("invalid time window '%s'", definition)
+	}
+
+	parts := strings.Split(times, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid time range '%s'", times)
+	}
+
+	w.Start, err = parseClock(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	w.End, err = parseClock(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if w.Start == w.End {
+		return nil, fmt.Errorf("time range '%s' is empty", times)
+	}
+
+	return w, nil
+}
+
+// parseDays parses a comma separated list of weekdays and weekday ranges.
+func (w *Window) parseDays(days string) error {
+	for _, part := range strings.Split(days, ",") {
+		bounds := strings.Split(part, "-")
+		if len(bounds) > 2 {
+			return fmt.Errorf("invalid weekday range '%s'", part)
+		}
+
+		from, ok := weekdays[strings.ToLower(bounds[0])]
+		if !ok {
+			return fmt.Errorf("invalid weekday '%s'", bounds[0])
+		}
+
+		to := from
+		if len(bounds) == 2 {
+			to, ok = weekdays[strings.ToLower(bounds[1])]
+			if !ok {
+				return fmt.Errorf("invalid weekday '%s'", bounds[1])
+			}
+		}
+
+		for day := from; ; day = (day + 1) % 7 {
+			w.Days[day] = true
+			if day == to {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parseClock parses a wall clock time of the form HH:MM into minutes since
+// midnight. 24:00 is accepted as the end of the day.
+func parseClock(clock string) (int, error) {
+	var hour, minute int
+	_, err := fmt.Sscanf(clock, "%d:%d", &hour, &minute)
+	if err != nil || len(clock) != 5 || hour < 0 || minute < 0 || minute > 59 || hour > 24 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time '%s', expected HH:MM", clock)
+	}
+	return hour*60 + minute, nil
+}
+
+// spansMidnight returns true if the window ends on the day after it starts.
+func (w *Window) spansMidnight() bool {
+	return w.End < w.Start
+}
+
+// Contains returns true if the time is within an occurrence of the window.
+func (w *Window) Contains(t time.Time) bool {
+	local := t.In(w.Location)
+	minute := minutesOfDay(local)
+	day := local.Weekday()
+
+	if !w.spansMidnight() {
+		return w.Days[day] && minute >= w.Start && minute < w.End
+	}
+
+	if w.Days[day] && minute >= w.Start {
+		return true
+	}
+
+	// the part after midnight belongs to the window of the previous day.
+	return w.Days[(day+6)%7] && minute < w.End
+}
+
+// Next returns the start and end of the next occurrence of the window which
+// hasn't ended at the specified time. If the time is within an occurrence,
+// that occurrence is returned.
+func (w *Window) Next(t time.Time) (time.Time, time.Time) {
+	local := t.In(w.Location)
+
+	// start one day before to find an occurrence spanning midnight which
+	// started on the previous day. Eight days cover all occurrences of a
+	// weekly window.
+	for i := -1; i <= 7; i++ {
+		date := time.Date(local.Year(), local.Month(), local.Day()+i, 0, 0, 0, 0, w.Location)
+		if !w.Days[date.Weekday()] {
+			continue
+		}
+
+		start := wallClock(date, w.Start, w.Location)
+		endDate := date
+		if w.spansMidnight() {
+			endDate = date.AddDate(0, 0, 1)
+		}
+		end := wallClock(endDate, w.End, w.Location)
+
+		if end.After(t) {
+			return start, end
+		}
+	}
+
+	// unreachable for windows with at least one day.
+	return time.Time{}, time.Time{}
+}
+
+// wallClock returns the instant at the specified minutes since midnight on
+// the date in the location. Wall clock times skipped by a DST transition
+// resolve to the instant of the transition and repeated wall clock times
+// resolve to their first occurrence.
+func wallClock(date time.Time, minutes int, loc *time.Location) time.Time {
+	t := time.Date(date.Year(), date.Month(), date.Day(), 0, minutes, 0, 0, loc)
+
+	if minutesOfDay(t) == minutes%(24*60) {
+		// time.Date doesn't guarantee which occurrence of a repeated
+		// wall clock time it returns, make sure it's the first.
+		if earlier := t.Add(-time.Hour); minutesOfDay(earlier) == minutesOfDay(t) {
+			return earlier
+		}
+		return t
+	}
+
+	// the wall clock time was skipped, move back to the transition.
+	_, offset := t.Zone()
+	for {
+		prev := t.Add(-time.Minute)
+		if _, prevOffset := prev.Zone(); prevOffset != offset {
+			return t
+		}
+		t = prev
+	}
+}
+
+// minutesOfDay returns the minutes since midnight of the wall clock time.
+func minutesOfDay(t time.Time) int {
+	return t.Hour()*60 + t.Minute()
+}
@@ -0,0 +1,250 @@
+package timewindow
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("failed to load location %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		msg        string
+		definition string
+		timezone   string
+		days       []time.Weekday
+		start      int
+		end        int
+		err        bool
+	}{
+		{
+			msg:        "every day",
+			definition: "09:00-17:00",
+			days:       []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday},
+			start:      9 * 60,
+			end:        17 * 60,
+		},
+		{
+			msg:        "weekday range and day",
+			definition: "Mon-Wed,Sat 22:00-06:30",
+			days:       []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Saturday},
+			start:      22 * 60,
+			end:        6*60 + 30,
+		},
+		{
+			msg:        "weekday range wrapping the week",
+			definition: "Fri-Mon 00:00-24:00",
+			days:       []time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday},
+			start:      0,
+			end:        24 * 60,
+		},
+		{msg: "invalid timezone", definition: "09:00-17:00", timezone: "Mars/Olympus", err: true},
+		{msg: "invalid weekday", definition: "Moo 09:00-17:00", err: true},
+		{msg: "invalid clock", definition: "9:00-17:00", err: true},
+		{msg: "invalid minute", definition: "09:60-17:00", err: true},
+		{msg: "after end of day", definition: "09:00-24:30", err: true},
+		{msg: "empty range", definition: "09:00-09:00", err: true},
+		{msg: "too many fields", definition: "Mon 09:00 17:00", err: true},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			w, err := Parse(tc.definition, tc.timezone)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", w)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var days [7]bool
+			for _, day := range tc.days {
+				days[day] = true
+			}
+			if w.Days != days {
+				t.Errorf("expected days %v, got %v", days, w.Days)
+			}
+			if w.Start != tc.start || w.End != tc.end {
+				t.Errorf("expected %d-%d, got %d-%d", tc.start, tc.end, w.Start, w.End)
+			}
+		})
+	}
+}
+
+func TestContains(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+
+	for _, tc := range []struct {
+		msg        string
+		definition string
+		time       time.Time
+		expected   bool
+	}{
+		{
+			msg:        "within window",
+			definition: "Mon-Fri 09:00-17:00",
+			time:       time.Date(2026, 10, 14, 12, 0, 0, 0, berlin),
+			expected:   true,
+		},
+		{
+			msg:        "end is exclusive",
+			definition: "Mon-Fri 09:00-17:00",
+			time:       time.Date(2026, 10, 14, 17, 0, 0, 0, berlin),
+		},
+		{
+			msg:        "wrong weekday",
+			definition: "Mon-Fri 09:00-17:00",
+			time:       time.Date(2026, 10, 17, 12, 0, 0, 0, berlin),
+		},
+		{
+			msg:        "in location of the window",
+			definition: "Mon-Fri 09:00-17:00",
+			time:       time.Date(2026, 10, 14, 7, 30, 0, 0, time.UTC),
+			expected:   true,
+		},
+		{
+			msg:        "after midnight belongs to the previous day",
+			definition: "Fri 22:00-06:00",
+			time:       time.Date(2026, 10, 17, 5, 0, 0, 0, berlin),
+			expected:   true,
+		},
+		{
+			msg:        "after midnight of a day without window",
+			definition: "Fri 22:00-06:00",
+			time:       time.Date(2026, 10, 16, 5, 0, 0, 0, berlin),
+		},
+		{
+			// 2026-10-25 02:15 CET, the second occurrence of 02:15.
+			msg:        "repeated hour after the clocks are set back",
+			definition: "02:00-02:30",
+			time:       time.Date(2026, 10, 25, 1, 15, 0, 0, time.UTC),
+			expected:   true,
+		},
+		{
+			msg:        "wall clock time after the clocks are set forward",
+			definition: "09:00-17:00",
+			time:       time.Date(2026, 3, 29, 7, 0, 0, 0, time.UTC),
+			expected:   true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			w, err := Parse(tc.definition, "Europe/Berlin")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if contains := w.Contains(tc.time); contains != tc.expected {
+				t.Errorf("expected %t for %s, got %t", tc.expected, tc.time, contains)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	utc := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	for _, tc := range []struct {
+		msg        string
+		definition string
+		time       time.Time
+		start      time.Time
+		end        time.Time
+	}{
+		{
+			msg:        "next occurrence on the same day",
+			definition: "Mon-Fri 09:00-17:00",
+			time:       utc(time.October, 14, 5, 0),
+			start:      utc(time.October, 14, 7, 0),
+			end:        utc(time.October, 14, 15, 0),
+		},
+		{
+			msg:        "current occurrence",
+			definition: "Mon-Fri 09:00-17:00",
+			time:       utc(time.October, 14, 10, 0),
+			start:      utc(time.October, 14, 7, 0),
+			end:        utc(time.October, 14, 15, 0),
+		},
+		{
+			msg:        "next occurrence after the weekend",
+			definition: "Mon-Fri 09:00-17:00",
+			time:       utc(time.October, 16, 16, 0),
+			start:      utc(time.October, 19, 7, 0),
+			end:        utc(time.October, 19, 15, 0),
+		},
+		{
+			msg:        "occurrence spanning midnight started the previous day",
+			definition: "Sat 22:00-06:00",
+			time:       utc(time.October, 18, 3, 0),
+			start:      utc(time.October, 17, 20, 0),
+			end:        utc(time.October, 18, 4, 0),
+		},
+		{
+			// the clocks are set forward from 02:00 to 03:00 CET on
+			// 2026-03-29, 02:30 doesn't exist.
+			msg:        "start skipped when the clocks are set forward",
+			definition: "02:30-04:00",
+			time:       utc(time.March, 28, 23, 0),
+			start:      utc(time.March, 29, 1, 0),
+			end:        utc(time.March, 29, 2, 0),
+		},
+		{
+			msg:        "wall clock times after the clocks are set forward",
+			definition: "09:00-17:00",
+			time:       utc(time.March, 29, 2, 0),
+			start:      utc(time.March, 29, 7, 0),
+			end:        utc(time.March, 29, 15, 0),
+		},
+		{
+			// the clocks are set back from 03:00 to 02:00 CEST on
+			// 2026-10-25, 02:30 occurs twice.
+			msg:        "start at the first occurrence when the clocks are set back",
+			definition: "02:30-03:30",
+			time:       utc(time.October, 24, 23, 0),
+			start:      utc(time.October, 25, 0, 30),
+			end:        utc(time.October, 25, 2, 30),
+		},
+		{
+			msg:        "window spanning midnight is an hour longer when the clocks are set back",
+			definition: "Sat 22:00-06:00",
+			time:       utc(time.October, 24, 12, 0),
+			start:      utc(time.October, 24, 20, 0),
+			end:        utc(time.October, 25, 5, 0),
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			w, err := Parse(tc.definition, "Europe/Berlin")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			start, end := w.Next(tc.time)
+			if !start.Equal(tc.start) || !end.Equal(tc.end) {
+				t.Errorf("expected %s - %s, got %s - %s", tc.start.UTC(), tc.end.UTC(), start.UTC(), end.UTC())
+			}
+		})
+	}
+}
+
+func TestDefaultLocation(t *testing.T) {
+	defer SetDefaultLocation(time.UTC)
+
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	SetDefaultLocation(berlin)
+
+	w, err := Parse("09:00-17:00", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w.Location != berlin {
+		t.Errorf("expected default location %s, got %s", berlin, w.Location)
+	}
+}
@@ -0,0 +1,135 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/golang/glog"
+	"github.com/mikkeloscar/kube-metrics-adapter/pkg/collector"
+	admissionv1 "k8s.io/api/admission/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ValidatePath is the path the validating webhook is served on.
+const ValidatePath = "/validate"
+
+// Server is a validating admission webhook server validating the metric
+// configuration of HPAs.
+type Server struct {
+	// WarnOnly makes the webhook admit HPAs with an invalid metric
+	// configuration and return a warning instead of rejecting them.
+	WarnOnly bool
+}
+
+// NewServer initializes a new webhook Server.
+func NewServer(warnOnly bool) *Server {
+	return &Server{
+		WarnOnly: warnOnly,
+	}
+}
+
+// ListenAndServeTLS serves the webhook on the specified address using the
+// certificate and key from the specified files.
+func (s *Server) ListenAndServeTLS(address, certFile, keyFile string) error {
+	mux := http.NewServeMux()
+	mux.Handle(ValidatePath, s)
+	return http.ListenAndServeTLS(address, certFile, keyFile, mux)
+}
+
+// ServeHTTP handles AdmissionReview requests.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var review admissionv1.AdmissionReview
+	err = json.Unmarshal(body, &review)
+	if err != nil || review.Request == nil {
+		http.Error(w, "invalid AdmissionReview", http.StatusBadRequest)
+		return
+	}
+
+	review.Response = s.review(review.Request)
+	review.Response.UID = review.Request.UID
+	review.Request = nil
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(review)
+	if err != nil {
+		glog.Errorf("Failed to encode AdmissionReview: %v", err)
+	}
+}
+
+// review validates the metric configuration of the HPA in the admission
+// request.
+func (s *Server) review(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	allowed := &admissionv1.AdmissionResponse{Allowed: true}
+
+	if req.Kind.Group != "autoscaling" || req.Kind.Kind != "HorizontalPodAutoscaler" {
+		return allowed
+	}
+
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return allowed
+	}
+
+	// autoscaling/v2beta2 HPAs have the same shape as autoscaling/v2
+	// HPAs. autoscaling/v1 HPAs don't define any metrics to validate.
+	if req.Kind.Version == "v1" {
+		return allowed
+	}
+
+	var hpa autoscalingv2.HorizontalPodAutoscaler
+	err := json.Unmarshal(req.Object.Raw, &hpa)
+	if err != nil {
+		return &admissionv1.AdmissionResponse{
+			Allowed: false,
+			Result: &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Message: fmt.Sprintf("failed to decode HPA: %v", err),
+				Reason:  metav1.StatusReasonBadRequest,
+				Code:    http.StatusBadRequest,
+			},
+		}
+	}
+
+	err = Validate(&hpa)
+	if err == nil {
+		return allowed
+	}
+
+	message := fmt.Sprintf("invalid metric configuration: %v", err)
+	glog.V(2).Infof("HPA %s/%s has an %s", req.Namespace, hpa.Name, message)
+
+	if s.WarnOnly {
+		allowed.Warnings = []string{message}
+		return allowed
+	}
+
+	return &admissionv1.AdmissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: message,
+			Reason:  metav1.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+		},
+	}
+}
+
+// Validate validates the metric configuration of an HPA the same way it's
+// parsed when setting up the collectors.
+func Validate(hpa *autoscalingv2.HorizontalPodAutoscaler) error {
+	_, err := collector.ParseHPAMetrics(hpa)
+	return err
+}